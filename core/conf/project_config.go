@@ -1,24 +1,109 @@
 package conf
 
+import "time"
+
+const default_file_extension = "sql"
+
+// Extension of the migration and hook files of drivers not using SQL files
+var driverFileExtensions = map[string]string{
+	"opensearch": "json",
+	"neo4j":      "cypher",
+	"redis":      "redis",
+	"valkey":     "redis",
+	"mongodb":    "json",
+}
+
+// Drivers executing the COPY ... FROM STDIN statements the maestro:load directive is expanded to, or the
+// LOAD DATA LOCAL INFILE statements with mariadb
+var loadDirectiveDrivers = map[string]bool{
+	"postgres":    true,
+	"cockroachdb": true,
+	"greenplum":   true,
+	"mariadb":     true,
+}
+
 type sslConfig struct {
 	SSLMode     string `yaml:"sslmode" default:"disable"`
 	SSLRootCert string `yaml:"sslrootcert,omitempty"`
 }
 
+// backupConfig configures the backup of the database taken by migrate before destructive migrations.
+type backupConfig struct {
+	Path    string   `yaml:"path,omitempty"`    // Directory the dumps are written to
+	Bucket  string   `yaml:"bucket,omitempty"`  // s3:// or gs:// URL the dumps are uploaded to
+	Schemas []string `yaml:"schemas,omitempty"` // Schemas (databases with MariaDB) dumped, the configured one if empty
+}
+
+// Enabled reports whether the backup is configured, with a path or a bucket.
+func (c *backupConfig) Enabled() bool {
+	return c.Path != "" || c.Bucket != ""
+}
+
+// historySyncConfig keeps the history table of a previous name in sync with the history table, once copied
+// to the configured name by the history-table-migrate command.
+type historySyncConfig struct {
+	Table string    `yaml:"table,omitempty"` // Previous name of the history table
+	Until time.Time `yaml:"until,omitempty"` // End of the grace period, e.g. 2025-06-30, unlimited if zero
+}
+
+// Active reports whether the previous history table is kept in sync at the given time.
+func (c *historySyncConfig) Active(now time.Time) bool {
+	return c.Table != "" && (c.Until.IsZero() || now.Before(c.Until))
+}
+
+// OwnersConfig maps the migrations to the teams owning them, reported with their failures and in the reports of
+// pull requests, so the right team is paged. Teams are free-form, e.g. "@acme/payments" or "payments-oncall".
+type OwnersConfig struct {
+	Locations map[string]string `yaml:"locations,omitempty"` // Team owning the migrations of a location, e.g. "./migrations/auth": "@acme/identity"
+	Tags      map[string]string `yaml:"tags,omitempty"`      // Team owning the migrations with a tag of their "-- maestro:tags" header line
+	Default   string            `yaml:"default,omitempty"`   // Team owning the migrations without other owner
+}
+
 type MigrationConfig struct {
-	Locations        []string `yaml:"locations" default:"[\"./migrations\"]"`
-	Validate         bool     `yaml:"validate" default:"true"`
-	Down             bool     `yaml:"down,omitempty"`
-	InTransaction    bool     `yaml:"in-transaction" default:"true"`
-	Destination      *uint16  `yaml:"destination,omitempty"`
-	Force            bool     `yaml:"force" default:"false"`
-	UseRepeatable    bool     `yaml:"use-repeatable" default:"true"`
-	UseBefore        bool     `yaml:"use-before" default:"true"`
-	UseAfter         bool     `yaml:"use-after" default:"true"`
-	UseBeforeEach    bool     `yaml:"use-before-each" default:"true"`
-	UseAfterEach     bool     `yaml:"use-after-each" default:"true"`
-	UseBeforeVersion bool     `yaml:"use-before-version" default:"true"`
-	UseAfterVersion  bool     `yaml:"use-after-version" default:"true"`
+	Locations            []string                     `yaml:"locations" default:"[\"./migrations\"]"`
+	VersionRanges        map[string]string            `yaml:"version-ranges,omitempty"`        // Versions owned by locations, e.g. "./migrations/auth": "1000-1999"
+	LocationDependencies map[string]map[string]uint16 `yaml:"location-dependencies,omitempty"` // Minimum versions of other locations required by the migrations of a location
+	Track                string                       `yaml:"track" default:"schema"`
+	Validate             bool                         `yaml:"validate" default:"true"`
+	ValidateAppliedOnly  bool                         `yaml:"validate-applied-only,omitempty"`  // Ignore local migrations newer than the latest applied version
+	ValidateAllowMissing bool                         `yaml:"validate-allow-missing,omitempty"` // Warn instead of failing when applied migrations are missing locally
+	ValidationIgnore     []uint16                     `yaml:"validation-ignore,omitempty"`      // Versions whose history entries are not validated
+	Down                 bool                         `yaml:"down,omitempty"`
+	InTransaction        bool                         `yaml:"in-transaction" default:"true"`
+	Destination          *uint16                      `yaml:"destination,omitempty"`
+	DestinationName      string                       `yaml:"destination-name,omitempty"`   // File name or description of the destination, resolved to its version
+	StrictDestination    bool                         `yaml:"strict-destination,omitempty"` // Fail instead of warning when the destination is on the wrong side of the latest applied version
+	Force                bool                         `yaml:"force" default:"false"`
+	MaxErrors            int                          `yaml:"max-errors,omitempty"`    // Failed migrations and hooks after which a forced run is aborted, unlimited if 0
+	SkipVersions         []uint16                     `yaml:"skip-versions,omitempty"` // Pending versions recorded as applied without being executed
+	UseRepeatable        bool                         `yaml:"use-repeatable" default:"true"`
+	UseBefore            bool                         `yaml:"use-before" default:"true"`
+	UseAfter             bool                         `yaml:"use-after" default:"true"`
+	UseBeforeEach        bool                         `yaml:"use-before-each" default:"true"`
+	UseAfterEach         bool                         `yaml:"use-after-each" default:"true"`
+	UseBeforeVersion     bool                         `yaml:"use-before-version" default:"true"`
+	UseAfterVersion      bool                         `yaml:"use-after-version" default:"true"`
+	UseAssertions        bool                         `yaml:"use-assertions" default:"true"`
+	UseBeforeValidate    bool                         `yaml:"use-before-validate" default:"true"`
+	UseRunStart          bool                         `yaml:"use-run-start" default:"true"`
+	UseRunEnd            bool                         `yaml:"use-run-end" default:"true"`
+	Extension            string                       `yaml:"extension,omitempty"`             // Extension of migration and hook files, "sql" if empty
+	Driver               string                       `yaml:"-"`                               // Driver of the project, checked against the directives it does not support if not empty
+	Manifest             string                       `yaml:"manifest,omitempty"`              // Cache of the unchanged loaded files, disabled if empty
+	ExplainMaxCost       float64                      `yaml:"explain-max-cost,omitempty"`      // Planner cost above which explain flags a pending statement, disabled if 0
+	ExplainMaxScanRows   float64                      `yaml:"explain-max-scan-rows,omitempty"` // Rows of a table above which explain flags its full scan, disabled if 0
+	LockIdentity         string                       `yaml:"lock-identity,omitempty"`         // Recorded with the lock as its holder (e.g. the name of the pod), the host name if empty
+	RemoteKey            string                       `yaml:"remote-key,omitempty"`            // PEM Ed25519 public key verifying the signed manifests of the remote locations
+
+	Owners OwnersConfig `yaml:"owners,omitempty"`
+
+	// Thresholds of the guard of the transaction of the migrations, disabled if 0
+	TransactionWarnAfter  time.Duration `yaml:"transaction-warn-after,omitempty"`  // Duration of the transaction after which a warning is logged
+	TransactionAbortAfter time.Duration `yaml:"transaction-abort-after,omitempty"` // Duration of the transaction after which it is cancelled
+	LockWaitWarnAfter     time.Duration `yaml:"lock-wait-warn-after,omitempty"`    // Wait of a statement for a lock after which a warning is logged
+	LockWaitAbortAfter    time.Duration `yaml:"lock-wait-abort-after,omitempty"`   // Wait of a statement for a lock after which the transaction is cancelled
+
+	DisallowDuplicateHooks bool `yaml:"disallow-duplicate-hooks" default:"false"`
 }
 
 type ProjectConfig struct {
@@ -29,9 +114,66 @@ type ProjectConfig struct {
 	User         string `yaml:"user" default:"postgres"`
 	Password     string `yaml:"password" default:"postgres"`
 	Schema       string `yaml:"schema" default:"public"`
+	Protected    bool   `yaml:"protected" default:"false"` // Refuses destructive commands (e.g. reset)
 	HistoryTable string `yaml:"history-table" default:"schema_history"`
+	HTTPPath     string `yaml:"http-path,omitempty"` // HTTP path of the SQL warehouse (e.g. Databricks)
+	SID          string `yaml:"sid,omitempty"`       // System identifier of the Oracle instance, instead of the service name of the database
+	Server       string `yaml:"server,omitempty"`    // Database server name of the Informix instance (INFORMIXSERVER)
+	Auth         string `yaml:"auth,omitempty"`      // Authentication of SQL Server: azure-ad for Azure AD tokens instead of the user and password
+
+	Plugin        string            `yaml:"plugin,omitempty"`         // External driver of the plugin driver, the binary maestro-driver-<plugin> of the PATH
+	PluginOptions map[string]string `yaml:"plugin-options,omitempty"` // Settings passed as is to the external driver
+
+	CreateDatabase   bool `yaml:"create-database" default:"false"`   // Creates the database if missing before connecting
+	SingleConnection bool `yaml:"single-connection" default:"false"` // Runs every query on one pinned connection
+
+	SeedHistoryTable string `yaml:"seed-history-table" default:"seed_history"`
+	DataHistoryTable string `yaml:"data-history-table" default:"data_history"`
+
+	Editor string `yaml:"editor,omitempty"` // Command opening the migrations created with create --edit, $VISUAL or $EDITOR if empty
+	Author string `yaml:"author,omitempty"` // Author written in the header of created migrations, the git user if empty
 
 	SSL sslConfig `yaml:"ssl"`
 
+	Backup backupConfig `yaml:"backup,omitempty"`
+
+	HistoryTableSync historySyncConfig `yaml:"history-table-sync,omitempty"` // Previous history table of the schema track kept in sync
+
 	Migration MigrationConfig `yaml:"migrations"`
 }
+
+// FileExtension returns the extension of the migration and hook files: the configured one, or the default
+// of the driver.
+func (c *ProjectConfig) FileExtension() string {
+	if c.Migration.Extension != "" {
+		return c.Migration.Extension
+	}
+
+	if extension, ok := driverFileExtensions[c.Driver]; ok {
+		return extension
+	}
+	return default_file_extension
+}
+
+// FileExtension returns the extension of the migration and hook files, "sql" if not configured.
+func (c *MigrationConfig) FileExtension() string {
+	if c.Extension == "" {
+		return default_file_extension
+	}
+	return c.Extension
+}
+
+// SupportsLoadDirective reports whether the driver executes the statements the maestro:load directive is
+// expanded to. An empty driver, e.g. of a migrator built without project configuration, is not checked.
+func SupportsLoadDirective(driver string) bool {
+	return driver == "" || loadDirectiveDrivers[driver]
+}
+
+// TrackHistoryTable returns the history table of the configured migration track. The tables default to the ones
+// of the struct tags, set by defaults.Set like the other settings.
+func (c *ProjectConfig) TrackHistoryTable() string {
+	if c.Migration.Track != "data" {
+		return c.HistoryTable
+	}
+	return c.DataHistoryTable
+}
@@ -0,0 +1,255 @@
+package database
+
+import (
+	"cmp"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/maestro-go/maestro/internal/migrations"
+)
+
+// ErrNotApplied is returned for versions missing from the schema history table.
+var ErrNotApplied = errors.New("version not found in the schema history table")
+
+// ErrNoExecutionTimes is returned by SnapshotAt when no applied migration has an execution time.
+var ErrNoExecutionTimes = errors.New("no execution time recorded in the schema history table")
+
+// EXECUTED_AT_LAYOUT is the layout of the execution times read from the schema history table, in the time zone
+// of the database (UTC with SQLite and Trino).
+const EXECUTED_AT_LAYOUT = "2006-01-02 15:04:05"
+
+// AppliedMigration is a row of the schema history table: a migration applied to the database,
+// successfully or not.
+type AppliedMigration struct {
+	Version     uint16
+	Description string
+	Checksum    string
+	Success     bool
+	Author      string // Author of the migration header, empty if unknown
+	Ticket      string // Ticket of the migration header, empty if unknown
+
+	// Skipped is whether the migration was recorded as applied without being executed, e.g. with --skip-versions.
+	// False if the repository does not record it.
+	Skipped bool
+
+	// InstalledRank is the position of the latest execution of the migration among the executions recorded in
+	// the schema history table, kept when the version is repaired. 0 if the repository does not record it.
+	InstalledRank int64
+
+	// ExecutedAt is the time of the latest execution of the migration, in the time zone of the database and the
+	// UTC location. Zero if the repository does not read it.
+	ExecutedAt time.Time
+}
+
+// ParseExecutedAt parses an execution time formatted with EXECUTED_AT_LAYOUT. Returns the zero time for an
+// empty value.
+func ParseExecutedAt(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(EXECUTED_AT_LAYOUT, value)
+}
+
+// HistorySnapshot is the state of the schema history at a point in time, e.g. for incident forensics.
+type HistorySnapshot struct {
+	At      time.Time
+	Version uint16              // Highest version successfully applied at that time, 0 if none
+	Applied []*AppliedMigration // Successfully applied at that time, in the order of their executions
+	Later   []*AppliedMigration // Executed after that time, in the order of their executions
+}
+
+// SnapshotAt returns the state of the schema history at the given time, from the execution times of the
+// applied migrations. As the history only records the latest execution of each version, the versions executed
+// again after that time are in Later, and the versions rolled back since then are missing. The migrations
+// without execution time are ignored. Returns ErrNoExecutionTimes if none has one.
+func SnapshotAt(applied []*AppliedMigration, at time.Time) (*HistorySnapshot, error) {
+	executed := make([]*AppliedMigration, 0, len(applied))
+	for _, migration := range applied {
+		if !migration.ExecutedAt.IsZero() {
+			executed = append(executed, migration)
+		}
+	}
+
+	if len(executed) == 0 && len(applied) > 0 {
+		return nil, ErrNoExecutionTimes
+	}
+
+	slices.SortFunc(executed, func(a, b *AppliedMigration) int {
+		return cmp.Or(a.ExecutedAt.Compare(b.ExecutedAt), cmp.Compare(a.InstalledRank, b.InstalledRank),
+			cmp.Compare(a.Version, b.Version))
+	})
+
+	snapshot := &HistorySnapshot{
+		At:      at,
+		Applied: make([]*AppliedMigration, 0),
+		Later:   make([]*AppliedMigration, 0),
+	}
+
+	for _, migration := range executed {
+		switch {
+		case migration.ExecutedAt.After(at):
+			snapshot.Later = append(snapshot.Later, migration)
+		case migration.Success:
+			snapshot.Applied = append(snapshot.Applied, migration)
+			snapshot.Version = max(snapshot.Version, migration.Version)
+		}
+	}
+
+	return snapshot, nil
+}
+
+// SortByInstalledRank returns the applied migrations in the order of their executions. Migrations without
+// installed rank come first, ordered by version.
+func SortByInstalledRank(applied []*AppliedMigration) []*AppliedMigration {
+	sorted := slices.Clone(applied)
+	slices.SortFunc(sorted, func(a, b *AppliedMigration) int {
+		if rank := cmp.Compare(a.InstalledRank, b.InstalledRank); rank != 0 {
+			return rank
+		}
+		return cmp.Compare(a.Version, b.Version)
+	})
+	return sorted
+}
+
+// LatestAppliedVersion returns the highest version successfully applied, or 0 if there is none.
+func LatestAppliedVersion(applied []*AppliedMigration) uint16 {
+	latest := uint16(0)
+	for _, migration := range applied {
+		if migration.Success && migration.Version > latest {
+			latest = migration.Version
+		}
+	}
+	return latest
+}
+
+// FailingAppliedMigrations returns the applied migrations that failed (success = false).
+func FailingAppliedMigrations(applied []*AppliedMigration) []*AppliedMigration {
+	failing := make([]*AppliedMigration, 0)
+	for _, migration := range applied {
+		if !migration.Success {
+			failing = append(failing, migration)
+		}
+	}
+	return failing
+}
+
+// HistoryComparison is the difference between the schema histories of two databases, e.g. of two environments.
+// Only the successfully applied migrations are compared.
+type HistoryComparison struct {
+	OnlyInFirst        []*AppliedMigration // Applied to the first database only
+	OnlyInSecond       []*AppliedMigration // Applied to the second database only
+	ChecksumMismatches []uint16            // Applied to both databases with different checksums
+}
+
+// Equal reports whether both databases have the same migrations applied.
+func (c *HistoryComparison) Equal() bool {
+	return len(c.OnlyInFirst) == 0 && len(c.OnlyInSecond) == 0 && len(c.ChecksumMismatches) == 0
+}
+
+// CompareAppliedMigrations compares the schema histories of two databases, ordered by version.
+func CompareAppliedMigrations(first []*AppliedMigration, second []*AppliedMigration) *HistoryComparison {
+	comparison := &HistoryComparison{
+		OnlyInFirst:        make([]*AppliedMigration, 0),
+		OnlyInSecond:       make([]*AppliedMigration, 0),
+		ChecksumMismatches: make([]uint16, 0),
+	}
+
+	secondByVersion := make(map[uint16]*AppliedMigration, len(second))
+	for _, migration := range second {
+		if migration.Success {
+			secondByVersion[migration.Version] = migration
+		}
+	}
+
+	firstVersions := make(map[uint16]bool, len(first))
+	for _, migration := range first {
+		if !migration.Success {
+			continue
+		}
+		firstVersions[migration.Version] = true
+
+		other, ok := secondByVersion[migration.Version]
+		if !ok {
+			comparison.OnlyInFirst = append(comparison.OnlyInFirst, migration)
+			continue
+		}
+
+		if other.Checksum != migration.Checksum {
+			comparison.ChecksumMismatches = append(comparison.ChecksumMismatches, migration.Version)
+		}
+	}
+
+	for _, migration := range second {
+		if migration.Success && !firstVersions[migration.Version] {
+			comparison.OnlyInSecond = append(comparison.OnlyInSecond, migration)
+		}
+	}
+
+	return comparison
+}
+
+// VersionHoles are the versions missing below the highest local migration and below the highest version of the
+// schema history table, reported separately for each side. With version ranges, the versions are missing below
+// the highest version of their range, or of the shared versions.
+type VersionHoles struct {
+	Files   []*VersionHole // Versions without local migration file
+	History []*VersionHole // Versions without row in the schema history table
+}
+
+// VersionHole is a missing version, with the sides that have it.
+type VersionHole struct {
+	Version uint16
+	Local   bool // A local migration file has the version
+	Applied bool // The schema history table has a row for the version, successful or not
+}
+
+// Empty reports whether neither side misses a version.
+func (h *VersionHoles) Empty() bool {
+	return len(h.Files) == 0 && len(h.History) == 0
+}
+
+// FindVersionHoles returns the holes of the local up migrations and of the schema history table, ordered by version.
+// The ranges are the version ranges of the locations, nil if none.
+func FindVersionHoles(local []*migrations.Migration, applied []*AppliedMigration,
+	ranges migrations.VersionRanges) *VersionHoles {
+
+	holes := &VersionHoles{
+		Files:   make([]*VersionHole, 0),
+		History: make([]*VersionHole, 0),
+	}
+
+	localVersions := make(map[uint16]bool, len(local))
+	localHead := uint16(0)
+	localList := make([]uint16, 0, len(local))
+	for _, migration := range local {
+		localVersions[migration.Version] = true
+		localHead = max(localHead, migration.Version)
+		localList = append(localList, migration.Version)
+	}
+
+	appliedVersions := make(map[uint16]bool, len(applied))
+	historyHead := uint16(0)
+	appliedList := make([]uint16, 0, len(applied))
+	for _, migration := range applied {
+		appliedVersions[migration.Version] = true
+		historyHead = max(historyHead, migration.Version)
+		appliedList = append(appliedList, migration.Version)
+	}
+
+	belowLocalHead, belowHistoryHead := ranges.Heads(localList), ranges.Heads(appliedList)
+
+	for version := uint16(1); version < localHead; version++ {
+		if !localVersions[version] && belowLocalHead(version) {
+			holes.Files = append(holes.Files, &VersionHole{Version: version, Applied: appliedVersions[version]})
+		}
+	}
+
+	for version := uint16(1); version < historyHead; version++ {
+		if !appliedVersions[version] && belowHistoryHead(version) {
+			holes.History = append(holes.History, &VersionHole{Version: version, Local: localVersions[version]})
+		}
+	}
+
+	return holes
+}
@@ -0,0 +1,118 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/maestro-go/maestro/internal/migrations"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompareAppliedMigrations(t *testing.T) {
+	staging := []*AppliedMigration{
+		{Version: 1, Checksum: "a", Success: true},
+		{Version: 2, Checksum: "b", Success: true},
+		{Version: 3, Checksum: "c", Success: true},
+		{Version: 4, Checksum: "d", Success: true},
+	}
+	production := []*AppliedMigration{
+		{Version: 1, Checksum: "a", Success: true},
+		{Version: 2, Checksum: "changed", Success: true},
+		{Version: 3, Checksum: "c", Success: false}, // Failed rows are not applied
+		{Version: 5, Checksum: "e", Success: true},
+	}
+
+	comparison := CompareAppliedMigrations(staging, production)
+	assert.False(t, comparison.Equal())
+	assert.Equal(t, []*AppliedMigration{staging[2], staging[3]}, comparison.OnlyInFirst)
+	assert.Equal(t, []*AppliedMigration{production[3]}, comparison.OnlyInSecond)
+	assert.Equal(t, []uint16{2}, comparison.ChecksumMismatches)
+
+	assert.True(t, CompareAppliedMigrations(staging, staging).Equal())
+}
+
+func TestSortByInstalledRank(t *testing.T) {
+	applied := []*AppliedMigration{
+		{Version: 1, InstalledRank: 2},
+		{Version: 2, InstalledRank: 1}, // Applied out of order
+		{Version: 3},                   // Inserted by repair
+		{Version: 4, InstalledRank: 3},
+		{Version: 5},
+	}
+
+	sorted := SortByInstalledRank(applied)
+	assert.Equal(t, []*AppliedMigration{applied[2], applied[4], applied[1], applied[0], applied[3]}, sorted)
+
+	// The history is not reordered
+	assert.Equal(t, uint16(1), applied[0].Version)
+}
+
+func TestSnapshotAt(t *testing.T) {
+	at := func(value string) time.Time {
+		executedAt, err := ParseExecutedAt(value)
+		assert.NoError(t, err)
+		return executedAt
+	}
+
+	applied := []*AppliedMigration{
+		{Version: 1, Success: true, ExecutedAt: at("2024-04-01 10:00:00")},
+		{Version: 2, Success: true, ExecutedAt: at("2024-05-02 10:00:00")}, // Executed again after the date
+		{Version: 3, Success: true, ExecutedAt: at("2024-04-20 10:00:00")},
+		{Version: 4, Success: false, ExecutedAt: at("2024-04-30 10:00:00")},
+		{Version: 5, Success: true, ExecutedAt: at("2024-04-15 10:00:00")}, // Applied out of order
+		{Version: 6, Success: true},                                        // Without execution time
+	}
+
+	snapshot, err := SnapshotAt(applied, at("2024-05-01 00:00:00"))
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(5), snapshot.Version)
+	assert.Equal(t, []*AppliedMigration{applied[0], applied[4], applied[2]}, snapshot.Applied)
+	assert.Equal(t, []*AppliedMigration{applied[1]}, snapshot.Later)
+
+	// Before the first execution
+	snapshot, err = SnapshotAt(applied, at("2024-01-01 00:00:00"))
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(0), snapshot.Version)
+	assert.Empty(t, snapshot.Applied)
+	assert.Len(t, snapshot.Later, 5)
+
+	_, err = SnapshotAt(applied[5:], at("2024-05-01 00:00:00"))
+	assert.ErrorIs(t, err, ErrNoExecutionTimes)
+
+	executedAt, err := ParseExecutedAt("")
+	assert.NoError(t, err)
+	assert.True(t, executedAt.IsZero())
+}
+
+func TestFindVersionHoles(t *testing.T) {
+	local := []*migrations.Migration{{Version: 1}, {Version: 3}, {Version: 5}, {Version: 6}}
+	applied := []*AppliedMigration{
+		{Version: 1, Success: true},
+		{Version: 2, Success: true},
+		{Version: 4, Success: false}, // Failed rows fill the hole
+		{Version: 6, Success: true},
+	}
+
+	holes := FindVersionHoles(local, applied, nil)
+	assert.False(t, holes.Empty())
+	assert.Equal(t, []*VersionHole{
+		{Version: 2, Applied: true},
+		{Version: 4, Applied: true},
+	}, holes.Files)
+	assert.Equal(t, []*VersionHole{
+		{Version: 3, Local: true},
+		{Version: 5, Local: true},
+	}, holes.History)
+
+	// Pending migrations after the highest applied version are not holes
+	assert.True(t, FindVersionHoles(local[:1], applied[:2], nil).Empty())
+
+	// The versions between the shared versions and a version range are not holes
+	ranges := migrations.VersionRanges{{Location: "migrations/auth", First: 1000, Last: 1999}}
+	local = []*migrations.Migration{{Version: 1}, {Version: 1000}, {Version: 1002}}
+	applied = []*AppliedMigration{{Version: 1, Success: true}, {Version: 1000, Success: true}}
+
+	holes = FindVersionHoles(local, applied, ranges)
+	assert.Equal(t, []*VersionHole{{Version: 1001}}, holes.Files)
+	assert.Empty(t, holes.History)
+}
@@ -0,0 +1,14 @@
+package database
+
+// Batches splits the items in consecutive batches of at most size items, e.g. to stay below the
+// limit of parameters of a statement inserting many rows.
+func Batches[T any](items []T, size int) [][]T {
+	batches := make([][]T, 0, (len(items)+size-1)/size)
+	for size < len(items) {
+		items, batches = items[size:], append(batches, items[:size])
+	}
+	if len(items) > 0 {
+		batches = append(batches, items)
+	}
+	return batches
+}
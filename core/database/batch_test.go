@@ -0,0 +1,13 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatches(t *testing.T) {
+	assert.Equal(t, [][]int{}, Batches([]int{}, 2))
+	assert.Equal(t, [][]int{{1, 2}}, Batches([]int{1, 2}, 2))
+	assert.Equal(t, [][]int{{1, 2}, {3, 4}, {5}}, Batches([]int{1, 2, 3, 4, 5}, 2))
+}
@@ -0,0 +1,21 @@
+package database
+
+// Capabilities describes the features of the database behind a repository, so callers can adapt
+// their behavior (e.g. not opening transactions) instead of failing in driver-specific ways.
+type Capabilities struct {
+	// SupportsTransactions reports whether DoInTransaction rolls back the changes of a failing callback.
+	// Otherwise the callback is run directly and changes are committed as they are executed.
+	SupportsTransactions bool
+
+	// SupportsAdvisoryLock reports whether DoInLock uses a lock of the server, released if the session
+	// ends. Otherwise a lock table (or key, node or document) is used, which must be unlocked manually
+	// if the process is killed while holding it.
+	SupportsAdvisoryLock bool
+
+	// SupportsMultiStatement reports whether migration scripts are sent to the server at once.
+	// Otherwise scripts are split into statements executed one at a time.
+	SupportsMultiStatement bool
+
+	// MaxIdentifierLength is the maximum length of table names and other identifiers, 0 if not limited.
+	MaxIdentifierLength int
+}
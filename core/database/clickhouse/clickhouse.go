@@ -0,0 +1,997 @@
+// Package clickhouse implements the maestro repository for ClickHouse 23.3 and later.
+//
+// ClickHouse has no multi-statement transactions and no row updates outside of mutations, so the
+// repository executes scripts one statement at a time and keeps the schema history table append-only: it is
+// a ReplacingMergeTree where each change of a version inserts a new row, read with FINAL. DoInLock uses a lock
+// table of claims expiring after a TTL, so a lock left by a killed process is released by the server.
+//
+// The package does not import a database driver: open the connection with the ClickHouse driver
+// (github.com/ClickHouse/clickhouse-go/v2) and pass it to NewClickHouseRepository.
+package clickhouse
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/maestro-go/maestro/core/database"
+	"github.com/maestro-go/maestro/core/enums"
+	"github.com/maestro-go/maestro/internal/conf"
+	"github.com/maestro-go/maestro/internal/migrations"
+)
+
+const default_history_table = "schema_history"
+const lock_table = "schema_lock"
+
+// lock_ttl is the time after which the claim of the lock expires if it is not refreshed, e.g. when the
+// process holding it was killed. Claims are refreshed every lock_refresh while waiting for and holding the lock.
+const lock_ttl = 2 * time.Minute
+const lock_refresh = 30 * time.Second
+
+// lock_timeout is the time DoInLock waits for the lock held by another process, checking every lock_retry.
+const lock_timeout = time.Minute
+const lock_retry = 2 * time.Second
+
+// lock_settle is the time waited after claiming the lock before reading the claims, so the claims inserted
+// at the same time on other replicas are visible.
+const lock_settle = time.Second
+
+// repair_batch_size is the number of migrations inserted per statement by Repair.
+const repair_batch_size = 1000
+
+// history_columns are the columns of a row of the history table, in the order of historyRow.values.
+const history_columns = "version, description, md5_checksum, success, executed_at, repaired_at, notes, run_id, author, ticket, skipped, deleted"
+
+// ClickHouseRepository executes migration scripts one statement at a time. A failed migration can not be
+// rolled back: its failure is recorded in the schema history table, and DoInTransaction only runs the callback.
+type ClickHouseRepository struct {
+	database.Repository
+	ctx           context.Context
+	db            database.Database
+	history_table string
+	run           database.RunInfo
+}
+
+func NewClickHouseRepository(ctx context.Context, db database.Database, history_table *string) *ClickHouseRepository {
+	repo := &ClickHouseRepository{
+		ctx: ctx,
+		db:  db,
+		run: database.RunInfo{MaestroVersion: conf.VERSION},
+	}
+
+	if history_table != nil {
+		repo.history_table = *history_table
+	} else {
+		repo.history_table = default_history_table
+	}
+
+	return repo
+}
+
+// historyRow is the current row of a version in the history table.
+type historyRow struct {
+	version     uint16
+	description string
+	checksum    string
+	success     bool
+	executedAt  *time.Time // Time of the insertion of the row if nil
+	repairedAt  *time.Time
+	notes       string
+	runID       string
+	author      string
+	ticket      string
+	skipped     bool // Recorded without being executed
+}
+
+// values returns the values of the row as parameters of "SELECT ?, ..." in the order of history_columns.
+func (h *historyRow) values(deleted bool) (string, []any) {
+	var executedAt, repairedAt any
+	if h.executedAt != nil {
+		executedAt = *h.executedAt
+	}
+	if h.repairedAt != nil {
+		repairedAt = *h.repairedAt
+	}
+
+	return "SELECT ?, ?, ?, ?, coalesce(?, now64(3)), ?, ?, ?, ?, ?, ?, ?", []any{
+		h.version, h.description, h.checksum, h.success, executedAt, repairedAt, nullable(h.notes),
+		nullable(h.runID), nullable(h.author), nullable(h.ticket), h.skipped, deleted,
+	}
+}
+
+func (r *ClickHouseRepository) GetLatestMigration() (uint16, error) {
+	tableExists, err := r.CheckSchemaHistoryTable()
+	if err != nil {
+		return 0, err
+	}
+
+	if !tableExists {
+		return 0, nil
+	}
+
+	query := fmt.Sprintf(`
+		SELECT max(version)
+		FROM %s FINAL
+		WHERE success AND NOT deleted
+	`, r.history_table)
+
+	version := uint16(0)
+	err = r.db.QueryRowContext(r.ctx, query).Scan(&version)
+	if err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+// AssertSchemaHistoryTable creates the audit table and the history table. The history table is a
+// ReplacingMergeTree of the versions, whose latest revision replaces the previous ones and is removed
+// from the reads with FINAL once deleted.
+func (r *ClickHouseRepository) AssertSchemaHistoryTable() error {
+	query := fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			run_id String,
+			maestro_version String,
+			direction String,
+			version UInt16,
+			description String,
+			success Bool,
+			executed_at DateTime64(3) DEFAULT now64(3)
+		) ENGINE = MergeTree
+		ORDER BY executed_at
+	`, r.auditTable())
+
+	_, err := r.db.ExecContext(r.ctx, query)
+	if err != nil {
+		return err
+	}
+
+	query = fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			version UInt16,
+			description String,
+			md5_checksum String,
+			success Bool DEFAULT false,
+			executed_at DateTime64(3) DEFAULT now64(3),
+			repaired_at Nullable(DateTime64(3)),
+			notes Nullable(String),
+			run_id Nullable(String),
+			author Nullable(String),
+			ticket Nullable(String),
+			skipped Bool DEFAULT false,
+			deleted UInt8 DEFAULT 0,
+			revision DateTime64(9) DEFAULT now64(9)
+		) ENGINE = ReplacingMergeTree(revision, deleted)
+		ORDER BY version
+	`, r.history_table)
+
+	_, err = r.db.ExecContext(r.ctx, query)
+	if err != nil {
+		return err
+	}
+
+	return r.upgradeHistoryTable()
+}
+
+// upgradeHistoryTable adds the skipped column to the history tables created by previous versions.
+func (r *ClickHouseRepository) upgradeHistoryTable() error {
+	_, err := r.db.ExecContext(r.ctx, fmt.Sprintf(`
+		ALTER TABLE %s ADD COLUMN IF NOT EXISTS skipped Bool DEFAULT false AFTER ticket
+	`, r.history_table))
+	return err
+}
+
+func (r *ClickHouseRepository) CheckSchemaHistoryTable() (bool, error) {
+	return r.tableExists(r.history_table)
+}
+
+func (r *ClickHouseRepository) tableExists(table string) (bool, error) {
+	query := `
+		SELECT count() FROM system.tables
+		WHERE database = currentDatabase() AND name = ?
+	`
+
+	count := 0
+	err := r.db.QueryRowContext(r.ctx, query, table).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// historyRows returns the current rows of the history table, ordered by version, or of the given version.
+func (r *ClickHouseRepository) historyRows(version *uint16) ([]*historyRow, error) {
+	// History tables created by previous versions have no skipped column until the next run
+	count := 0
+	err := r.db.QueryRowContext(r.ctx, `
+		SELECT count() FROM system.columns
+		WHERE database = currentDatabase() AND table = ? AND name = 'skipped'
+	`, r.history_table).Scan(&count)
+	if err != nil {
+		return nil, err
+	}
+
+	skipped := "false"
+	if count > 0 {
+		skipped = "skipped"
+	}
+
+	query := fmt.Sprintf(`
+		SELECT version, description, md5_checksum, success, executed_at, repaired_at, notes, run_id, author, ticket,
+			%s
+		FROM %s FINAL
+		WHERE NOT deleted
+	`, skipped, r.history_table)
+
+	args := make([]any, 0, 1)
+	if version != nil {
+		query += " AND version = ?"
+		args = append(args, *version)
+	}
+	query += " ORDER BY version ASC"
+
+	rows, err := r.db.QueryContext(r.ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := make([]*historyRow, 0)
+	for rows.Next() {
+		row := &historyRow{executedAt: new(time.Time)}
+		repairedAt := sql.NullTime{}
+		notes, runID, author, ticket := sql.NullString{}, sql.NullString{}, sql.NullString{}, sql.NullString{}
+		err := rows.Scan(&row.version, &row.description, &row.checksum, &row.success, row.executedAt, &repairedAt,
+			&notes, &runID, &author, &ticket, &row.skipped)
+		if err != nil {
+			return nil, err
+		}
+
+		if repairedAt.Valid {
+			row.repairedAt = &repairedAt.Time
+		}
+		row.notes, row.runID, row.author, row.ticket = notes.String, runID.String, author.String, ticket.String
+		history = append(history, row)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return history, nil
+}
+
+// historyRow returns the current row of the version in the history table, nil if there is none.
+func (r *ClickHouseRepository) historyRow(version uint16) (*historyRow, error) {
+	history, err := r.historyRows(&version)
+	if err != nil || len(history) == 0 {
+		return nil, err
+	}
+	return history[0], nil
+}
+
+// insertHistory inserts the rows in the history table, replacing the current rows of their versions, or
+// removing them if deleted is set.
+func (r *ClickHouseRepository) insertHistory(history []*historyRow, deleted bool) error {
+	selects := make([]string, 0, len(history))
+	args := make([]any, 0, len(history)*12)
+	for _, row := range history {
+		values, rowArgs := row.values(deleted)
+		selects = append(selects, values)
+		args = append(args, rowArgs...)
+	}
+
+	query := fmt.Sprintf("INSERT INTO %s (%s) %s", r.history_table, history_columns,
+		strings.Join(selects, " UNION ALL "))
+
+	_, err := r.db.ExecContext(r.ctx, query, args...)
+	return err
+}
+
+func (r *ClickHouseRepository) ValidateMigrations(localMigrations []*migrations.Migration) []error {
+	if len(localMigrations) < 1 {
+		return nil
+	}
+
+	tableExists, err := r.CheckSchemaHistoryTable()
+	if err != nil {
+		return []error{err}
+	}
+
+	if !tableExists {
+		return nil
+	}
+
+	byVersion := make(map[uint16]*migrations.Migration, len(localMigrations))
+	for _, migration := range localMigrations {
+		if migration.Type != enums.MIGRATION_UP {
+			return []error{fmt.Errorf("invalid migration type: %s", migration.Type.Name())}
+		}
+		byVersion[migration.Version] = migration
+	}
+
+	history, err := r.historyRows(nil)
+	if err != nil {
+		return []error{err}
+	}
+
+	errs := make([]error, 0)
+	expectedVersion := uint16(1)
+
+	for _, row := range history {
+		// Check gaps
+		if expectedVersion != row.version {
+			errs = append(errs, &database.MissingVersionError{Version: expectedVersion})
+		}
+		expectedVersion = row.version + 1
+
+		// Check description or checksum mismatch
+		local, ok := byVersion[row.version]
+		if row.success && (!ok || local.Description != row.description || *local.Checksum != row.checksum) {
+			errs = append(errs, &database.MismatchError{Version: row.version, Description: row.description,
+				Checksum: row.checksum})
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (r *ClickHouseRepository) ExecuteMigration(migration *migrations.Migration) []error {
+	if migration.Type != enums.MIGRATION_UP {
+		return []error{fmt.Errorf("invalid migration type: %s", migration.Type.Name())}
+	}
+
+	errs := make([]error, 0)
+
+	err := r.execScript(*migration.Content, migration.SkipStatements)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	success := err == nil
+
+	err = r.saveHistory(migration, success, false)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("migration %d: %w", migration.Version, err))
+	} else {
+		err = r.audit(migration, database.AUDIT_UP, success)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("migration %d: %w", migration.Version, err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// SkipMigration records the migration as applied and skipped in the history table without executing it, and
+// records the skip in the audit table.
+func (r *ClickHouseRepository) SkipMigration(migration *migrations.Migration) error {
+	if migration.Type != enums.MIGRATION_UP {
+		return fmt.Errorf("invalid migration type: %s", migration.Type.Name())
+	}
+
+	err := r.saveHistory(migration, true, true)
+	if err != nil {
+		return fmt.Errorf("migration %d: %w", migration.Version, err)
+	}
+
+	return r.audit(migration, database.AUDIT_SKIP, true)
+}
+
+// saveHistory replaces the history row of the migration with the given status, and whether it was skipped
+// without being executed, keeping its notes and repair time.
+func (r *ClickHouseRepository) saveHistory(migration *migrations.Migration, success bool, skipped bool) error {
+	current, err := r.historyRow(migration.Version)
+	if err != nil {
+		return err
+	}
+
+	row := &historyRow{
+		version:     migration.Version,
+		description: migration.Description,
+		checksum:    *migration.Checksum,
+		success:     success,
+		runID:       r.run.ID,
+		author:      migration.Author,
+		ticket:      migration.Ticket,
+		skipped:     skipped,
+	}
+	if current != nil {
+		row.repairedAt, row.notes = current.repairedAt, current.notes
+	}
+
+	return r.insertHistory([]*historyRow{row}, false)
+}
+
+func (r *ClickHouseRepository) ExecuteHook(hook *migrations.Hook) error {
+	return r.execScript(*hook.Content, 0)
+}
+
+func (r *ClickHouseRepository) ExecuteAssertion(hook *migrations.Hook) error {
+	rows, err := r.db.QueryContext(r.ctx, *hook.Content)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+
+	rowsCount := 0
+	isBool, isTrue := false, false
+	for rows.Next() {
+		rowsCount++
+		if rowsCount == 1 && len(columns) == 1 {
+			var value any
+			if err := rows.Scan(&value); err != nil {
+				return err
+			}
+			isTrue, isBool = boolValue(value)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if rowsCount == 0 || (rowsCount == 1 && isTrue) {
+		return nil
+	}
+
+	if rowsCount == 1 && isBool {
+		return fmt.Errorf("assertion failed: query returned false")
+	}
+
+	return fmt.Errorf("assertion failed: query returned %d rows", rowsCount)
+}
+
+// boolValue returns the boolean of a value returned by the server. Comparisons and logical functions of
+// ClickHouse return the UInt8 numbers 1 and 0, which are booleans.
+func boolValue(value any) (isTrue bool, isBool bool) {
+	switch v := value.(type) {
+	case bool:
+		return v, true
+	case uint8:
+		return v == 1, v <= 1
+	}
+	return false, false
+}
+
+func (r *ClickHouseRepository) RollbackMigration(migration *migrations.Migration) error {
+	if migration.Type != enums.MIGRATION_DOWN {
+		return fmt.Errorf("invalid migration type: %s", migration.Type.Name())
+	}
+
+	current, err := r.historyRow(migration.Version)
+	if err != nil {
+		return err
+	}
+
+	if current == nil {
+		return nil
+	}
+
+	err = r.execScript(*migration.Content, 0)
+	if err != nil {
+		return err
+	}
+
+	err = r.insertHistory([]*historyRow{current}, true)
+	if err != nil {
+		return fmt.Errorf("version was not deleted from \"%s\" table: %w", r.history_table, err)
+	}
+
+	return r.audit(migration, database.AUDIT_DOWN, true)
+}
+
+func (r *ClickHouseRepository) ServerInfo() (*database.ServerInfo, error) {
+	info := &database.ServerInfo{HistoryTable: r.history_table}
+
+	err := r.db.QueryRowContext(r.ctx, "SELECT version(), currentDatabase()").Scan(&info.Version, &info.Schema)
+	if err != nil {
+		return nil, err
+	}
+
+	info.HistoryTableExists, err = r.CheckSchemaHistoryTable()
+	if err != nil || !info.HistoryTableExists {
+		return info, err
+	}
+
+	query := fmt.Sprintf("SELECT count() FROM %s FINAL WHERE NOT deleted", r.history_table)
+	err = r.db.QueryRowContext(r.ctx, query).Scan(&info.HistoryRows)
+	if err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
+
+func (r *ClickHouseRepository) Capabilities() database.Capabilities {
+	return database.Capabilities{
+		SupportsTransactions:   false,
+		SupportsAdvisoryLock:   false,
+		SupportsMultiStatement: false,
+		MaxIdentifierLength:    0,
+	}
+}
+
+func (r *ClickHouseRepository) SetRunInfo(info database.RunInfo) {
+	r.run = info
+}
+
+func (r *ClickHouseRepository) auditTable() string {
+	return r.history_table + "_audit"
+}
+
+// audit records the execution of the migration in the audit table.
+func (r *ClickHouseRepository) audit(migration *migrations.Migration, direction string, success bool) error {
+	query := fmt.Sprintf(`
+		INSERT INTO %s (run_id, maestro_version, direction, version, description, success)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, r.auditTable())
+
+	_, err := r.db.ExecContext(r.ctx, query, r.run.ID, r.run.MaestroVersion, direction,
+		migration.Version, migration.Description, success)
+	if err != nil {
+		return fmt.Errorf("error recording audit: %w", err)
+	}
+
+	return nil
+}
+
+// DoInTransaction runs the callback without a transaction, as ClickHouse has no multi-statement
+// transactions: failed migrations are recorded in the schema history table instead of being rolled back.
+func (r *ClickHouseRepository) DoInTransaction(fn func() error) error {
+	return fn()
+}
+
+// DoOutsideTransaction runs the callback, as DoInTransaction does not start a transaction.
+func (r *ClickHouseRepository) DoOutsideTransaction(fn func() error) error {
+	return fn()
+}
+
+// Session returns a repository sharing the connections of this one, with its own run info.
+func (r *ClickHouseRepository) Session() database.Repository {
+	session := *r
+	return &session
+}
+
+// lockTable returns the lock table of the history table, so the migrations of several history tables of
+// the same database do not block each other.
+func (r *ClickHouseRepository) lockTable() string {
+	if r.history_table == default_history_table {
+		return lock_table
+	}
+	return r.history_table + "_lock"
+}
+
+// assertLockTable creates the lock table, a ReplacingMergeTree of the claims of the lock, whose latest
+// revision replaces the previous ones. Expired claims are deleted by the TTL of the table.
+func (r *ClickHouseRepository) assertLockTable() error {
+	_, err := r.db.ExecContext(r.ctx, fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			claim String,
+			run_id String,
+			pid UInt32,
+			host String,
+			claimed_at DateTime64(6),
+			expires_at DateTime,
+			released UInt8 DEFAULT 0,
+			revision DateTime64(9) DEFAULT now64(9)
+		) ENGINE = ReplacingMergeTree(revision)
+		ORDER BY claim
+		TTL expires_at + INTERVAL 1 DAY
+	`, r.lockTable()))
+	return err
+}
+
+// lockClaim is a claim of the lock. The lock is held by the oldest claim neither released nor expired,
+// the other claims wait for it in the order of their claim.
+type lockClaim struct {
+	claim     string
+	runID     string
+	pid       uint32
+	host      string
+	claimedAt time.Time
+}
+
+// lockHolder returns the claim holding the lock, nil if it is not held.
+func (r *ClickHouseRepository) lockHolder() (*lockClaim, error) {
+	query := fmt.Sprintf(`
+		SELECT claim, run_id, pid, host, claimed_at
+		FROM %s FINAL
+		WHERE NOT released AND expires_at > now()
+		ORDER BY claimed_at, claim
+		LIMIT 1
+	`, r.lockTable())
+
+	holder := &lockClaim{}
+	err := r.db.QueryRowContext(r.ctx, query).Scan(&holder.claim, &holder.runID, &holder.pid, &holder.host,
+		&holder.claimedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return holder, nil
+}
+
+// GetLockInfo reports whether a claim holds the lock, and the run, process and host holding it.
+func (r *ClickHouseRepository) GetLockInfo() (*database.LockInfo, error) {
+	exists, err := r.tableExists(r.lockTable())
+	if err != nil || !exists {
+		return &database.LockInfo{}, err
+	}
+
+	holder, err := r.lockHolder()
+	if err != nil || holder == nil {
+		return &database.LockInfo{}, err
+	}
+
+	return &database.LockInfo{
+		Locked:   true,
+		Owner:    fmt.Sprintf("run %s, pid %d on %s", holder.runID, holder.pid, holder.host),
+		LockedAt: &holder.claimedAt,
+	}, nil
+}
+
+// DoInLock claims the lock in the lock table and waits up to lock_timeout for the older claims to be
+// released. The claim is refreshed while the callback runs, and expires lock_ttl after the process holding
+// it stopped refreshing it, e.g. because it was killed.
+func (r *ClickHouseRepository) DoInLock(fn func() error) error {
+	err := r.assertLockTable()
+	if err != nil {
+		return err
+	}
+
+	claim := database.NewRunInfo().ID // Random
+	err = r.claimLock(claim)
+	if err != nil {
+		return err
+	}
+
+	stop := make(chan struct{})
+	refreshed := sync.WaitGroup{}
+	refreshed.Add(1)
+	go func() {
+		defer refreshed.Done()
+		r.refreshLock(claim, stop)
+	}()
+
+	defer func() {
+		close(stop)
+		refreshed.Wait()
+
+		err = r.updateClaim(claim, true)
+		if err != nil {
+			panic(fmt.Errorf("failed to release the lock: %w", err))
+		}
+	}()
+
+	err = r.waitForLock(claim)
+	if err != nil {
+		return err
+	}
+
+	err = fn()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// claimLock inserts the claim in the lock table, with the lock identity of the run as its host if set.
+func (r *ClickHouseRepository) claimLock(claim string) error {
+	query := fmt.Sprintf(`
+		INSERT INTO %s (claim, run_id, pid, host, claimed_at, expires_at)
+		SELECT ?, ?, ?, ?, now64(6), now() + ?
+	`, r.lockTable())
+
+	_, err := r.db.ExecContext(r.ctx, query, claim, r.run.ID, uint32(os.Getpid()), r.run.Holder(),
+		int64(lock_ttl/time.Second))
+	return err
+}
+
+// updateClaim extends the expiration of the claim by lock_ttl, or releases it.
+func (r *ClickHouseRepository) updateClaim(claim string, release bool) error {
+	query := fmt.Sprintf(`
+		INSERT INTO %s (claim, run_id, pid, host, claimed_at, expires_at, released)
+		SELECT claim, run_id, pid, host, claimed_at, now() + ?, ?
+		FROM %s FINAL
+		WHERE claim = ?
+	`, r.lockTable(), r.lockTable())
+
+	_, err := r.db.ExecContext(r.ctx, query, int64(lock_ttl/time.Second), release, claim)
+	return err
+}
+
+// refreshLock extends the expiration of the claim every lock_refresh until stop is closed. A failed refresh
+// is retried at the next one, the claim only expiring if none succeeds within lock_ttl.
+func (r *ClickHouseRepository) refreshLock(claim string, stop <-chan struct{}) {
+	ticker := time.NewTicker(lock_refresh)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			r.updateClaim(claim, false)
+		}
+	}
+}
+
+// waitForLock waits until the claim is the oldest one, holding the lock.
+func (r *ClickHouseRepository) waitForLock(claim string) error {
+	time.Sleep(lock_settle)
+
+	deadline := time.Now().Add(lock_timeout)
+	for {
+		holder, err := r.lockHolder()
+		if err != nil {
+			return err
+		}
+
+		if holder != nil && holder.claim == claim {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			if holder == nil {
+				return fmt.Errorf("timeout while waiting for the lock: the claim of %s expired", r.lockTable())
+			}
+			return fmt.Errorf("timeout while waiting for the lock of %s held by run %s, pid %d on %s",
+				r.lockTable(), holder.runID, holder.pid, holder.host)
+		}
+
+		time.Sleep(lock_retry)
+	}
+}
+
+// Repair replaces the history rows of the migrations. There are no transactions, but the rows of a batch
+// are inserted by a single statement.
+func (r *ClickHouseRepository) Repair(migrations []*migrations.Migration) []error {
+	tableExists, err := r.CheckSchemaHistoryTable()
+	if err != nil {
+		return []error{err}
+	}
+
+	if !tableExists {
+		return nil
+	}
+
+	// The rows are rewritten with every column
+	err = r.upgradeHistoryTable()
+	if err != nil {
+		return []error{err}
+	}
+
+	history, err := r.historyRows(nil)
+	if err != nil {
+		return []error{err}
+	}
+
+	current := make(map[uint16]*historyRow, len(history))
+	for _, row := range history {
+		current[row.version] = row
+	}
+
+	now := time.Now()
+	for _, batch := range database.Batches(migrations, repair_batch_size) {
+		rows := make([]*historyRow, 0, len(batch))
+		for _, migration := range batch {
+			row := &historyRow{repairedAt: &now}
+			if existing, ok := current[migration.Version]; ok {
+				*row = *existing
+				if existing.description != migration.Description || existing.checksum != *migration.Checksum {
+					row.repairedAt = &now
+				}
+			}
+
+			row.version, row.description, row.checksum = migration.Version, migration.Description, *migration.Checksum
+			row.success = true
+			rows = append(rows, row)
+		}
+
+		err = r.insertHistory(rows, false)
+		if err != nil {
+			return []error{err}
+		}
+	}
+
+	return nil
+}
+
+// Annotate sets the note of the version in the notes column of the history table.
+func (r *ClickHouseRepository) Annotate(version uint16, note string) error {
+	exists, err := r.CheckSchemaHistoryTable()
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return fmt.Errorf("version %d: %w", version, database.ErrNotApplied)
+	}
+
+	row, err := r.historyRow(version)
+	if err != nil {
+		return err
+	}
+
+	if row == nil {
+		return fmt.Errorf("version %d: %w", version, database.ErrNotApplied)
+	}
+
+	// The row is rewritten with every column
+	err = r.upgradeHistoryTable()
+	if err != nil {
+		return err
+	}
+
+	row.notes = note
+	return r.insertHistory([]*historyRow{row}, false)
+}
+
+func (r *ClickHouseRepository) GetFailingMigrations() ([]*migrations.Migration, error) {
+	exists, err := r.CheckSchemaHistoryTable()
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		return nil, nil
+	}
+
+	history, err := r.historyRows(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var failingMigrations []*migrations.Migration
+	for _, row := range history {
+		if row.success {
+			continue
+		}
+
+		checksum := row.checksum
+		failingMigrations = append(failingMigrations, &migrations.Migration{
+			Version:     row.version,
+			Description: row.description,
+			Checksum:    &checksum,
+		})
+	}
+
+	return failingMigrations, nil
+}
+
+func (r *ClickHouseRepository) GetAppliedMigrations() ([]*database.AppliedMigration, error) {
+	exists, err := r.CheckSchemaHistoryTable()
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		return nil, nil
+	}
+
+	history, err := r.historyRows(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	applied := make([]*database.AppliedMigration, 0, len(history))
+	for _, row := range history {
+		applied = append(applied, &database.AppliedMigration{
+			Version:     row.version,
+			Description: row.description,
+			Checksum:    row.checksum,
+			Success:     row.success,
+			Author:      row.author,
+			Ticket:      row.ticket,
+			Skipped:     row.skipped,
+		})
+	}
+
+	return applied, nil
+}
+
+// Clean drops the views, dictionaries and tables of the current database. The inner tables of materialized
+// views are dropped with them. The lock table is kept, so cleaning inside DoInLock does not release the lock.
+func (r *ClickHouseRepository) Clean() error {
+	query := `
+		SELECT name, engine
+		FROM system.tables
+		WHERE database = currentDatabase() AND NOT is_temporary AND NOT startsWith(name, '.inner') AND name <> ?
+		ORDER BY multiIf(engine IN ('View', 'MaterializedView', 'LiveView', 'WindowView'), 1,
+			engine = 'Dictionary', 2, 3)
+	`
+
+	rows, err := r.db.QueryContext(r.ctx, query, r.lockTable())
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	statements := make([]string, 0)
+	for rows.Next() {
+		name, engine := "", ""
+		if err := rows.Scan(&name, &engine); err != nil {
+			return err
+		}
+
+		kind := "TABLE"
+		switch engine {
+		case "View", "MaterializedView", "LiveView", "WindowView":
+			kind = "VIEW"
+		case "Dictionary":
+			kind = "DICTIONARY"
+		}
+		statements = append(statements, fmt.Sprintf("DROP %s IF EXISTS %s", kind, quoteName(name)))
+	}
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	for _, statement := range statements {
+		_, err = r.db.ExecContext(r.ctx, statement)
+		if err != nil {
+			return fmt.Errorf("error executing %q: %w", statement, err)
+		}
+	}
+
+	return nil
+}
+
+// execScript executes a migration or hook script one statement at a time, as ClickHouse does not accept
+// multiple statements in a single query.
+func (r *ClickHouseRepository) execScript(script string, skip int) error {
+	for i, statement := range migrations.SplitClickHouseStatements(script) {
+		if i < skip {
+			continue
+		}
+
+		_, err := r.db.ExecContext(r.ctx, statement)
+		if err != nil {
+			return &database.StatementError{Index: i + 1, Err: fmt.Errorf("statement %d (%s): %w", i+1, firstLine(statement), err)}
+		}
+	}
+
+	return nil
+}
+
+// quoteName quotes a table name with backticks.
+func quoteName(name string) string {
+	return "`" + strings.ReplaceAll(strings.ReplaceAll(name, `\`, `\\`), "`", "\\`") + "`"
+}
+
+// nullable returns the value as a query parameter, NULL if empty.
+func nullable(value string) any {
+	if value == "" {
+		return nil
+	}
+	return value
+}
+
+func firstLine(statement string) string {
+	line, _, _ := strings.Cut(statement, "\n")
+	return line
+}
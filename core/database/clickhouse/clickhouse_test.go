@@ -0,0 +1,343 @@
+package clickhouse
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+
+	"github.com/maestro-go/maestro/core/database"
+	"github.com/maestro-go/maestro/core/enums"
+	"github.com/maestro-go/maestro/core/maestrotest"
+	"github.com/maestro-go/maestro/internal/migrations"
+	testUtils "github.com/maestro-go/maestro/internal/utils/testing"
+	"github.com/stretchr/testify/suite"
+
+	_ "github.com/ClickHouse/clickhouse-go/v2"
+)
+
+type MigrationTestSuite struct {
+	suite.Suite
+	clickhouse *testUtils.ClickHouseContainer
+	suiteDb    *sql.DB
+
+	ctx context.Context
+
+	repository *ClickHouseRepository
+}
+
+func (s *MigrationTestSuite) SetupSuite() {
+	s.ctx = context.Background()
+
+	s.clickhouse = testUtils.SetupClickHouse(s.T())
+
+	db, err := sql.Open("clickhouse", s.clickhouse.URI)
+	s.Assert().NoError(err)
+
+	s.suiteDb = db
+
+	s.repository = NewClickHouseRepository(s.ctx, db, testUtils.ToPtr(default_history_table))
+}
+
+func (s *MigrationTestSuite) TearDownTest() {
+	if s.clickhouse != nil {
+		err := s.repository.Clean()
+		s.Assert().NoError(err)
+	}
+}
+
+func (s *MigrationTestSuite) checkTableExists(table string, shouldExist bool) {
+	s.T().Helper()
+
+	exists, err := s.repository.tableExists(table)
+	s.Assert().NoError(err)
+	s.Assert().Equal(shouldExist, exists)
+}
+
+// insertHistory inserts rows of the given success in the history table.
+func (s *MigrationTestSuite) insertHistory(success bool, versions ...uint16) {
+	s.T().Helper()
+
+	for _, version := range versions {
+		_, err := s.suiteDb.ExecContext(s.ctx, fmt.Sprintf(`
+			INSERT INTO %s (version, description, md5_checksum, success)
+			VALUES (?, 't', '0a52730597fb4ffa01fc117d9e71e3a9', ?)
+		`, default_history_table), version, success)
+		s.Require().NoError(err)
+	}
+}
+
+func TestMigrationSuite(t *testing.T) {
+	suite.Run(t, new(MigrationTestSuite))
+}
+
+func (s *MigrationTestSuite) TestAssertSchemaHistoryTable() {
+	err := s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+
+	s.checkTableExists(default_history_table, true)
+	s.checkTableExists(default_history_table+"_audit", true)
+
+	// Existing tables are kept
+	err = s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+}
+
+func (s *MigrationTestSuite) TestGetLatestMigration() {
+	version, err := s.repository.GetLatestMigration()
+	s.Assert().NoError(err)
+	s.Assert().Equal(uint16(0), version)
+
+	err = s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+
+	version, err = s.repository.GetLatestMigration()
+	s.Assert().NoError(err)
+	s.Assert().Equal(uint16(0), version)
+
+	s.insertHistory(true, 1, 40000)
+	s.insertHistory(false, 40001)
+
+	version, err = s.repository.GetLatestMigration()
+	s.Assert().NoError(err)
+	s.Assert().Equal(uint16(40000), version)
+}
+
+func (s *MigrationTestSuite) TestValidateMigrations() {
+	checksums := []string{"0a52730597fb4ffa01fc117d9e71e3a9", "3d41c8443df34e73867adb149efbb2ea"}
+	contents := []string{"EXAMPLE CONTENT 1", "EXAMPLE CONTENT 2"}
+	migrations := []*migrations.Migration{
+		{Version: 1, Description: "t", Type: enums.MIGRATION_UP, Checksum: &checksums[0], Content: &contents[0]},
+		{Version: 2, Description: "t", Type: enums.MIGRATION_UP, Checksum: &checksums[1], Content: &contents[1]},
+	}
+
+	errs := s.repository.ValidateMigrations(migrations)
+	s.Assert().Nil(errs)
+
+	err := s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+
+	// Version 1 is missing, and version 2 has another checksum
+	s.insertHistory(true, 2)
+
+	errs = s.repository.ValidateMigrations(migrations)
+	s.Assert().Len(errs, 2)
+
+	s.insertHistory(true, 1)
+	errs = s.repository.Repair(migrations)
+	s.Assert().Nil(errs)
+
+	errs = s.repository.ValidateMigrations(migrations)
+	s.Assert().Nil(errs)
+}
+
+func (s *MigrationTestSuite) TestExecuteMigration() {
+	checksum := "0a52730597fb4ffa01fc117d9e71e3a9"
+	content := "INVALID SQL"
+	migration := &migrations.Migration{
+		Version:     1,
+		Description: "abcd",
+		Type:        enums.MIGRATION_UP,
+		Checksum:    &checksum,
+		Content:     &content,
+		Author:      "Jane Doe <jane@example.com>",
+		Ticket:      "OPS-123",
+	}
+
+	// Invalid SQL, and no schema table
+	errs := s.repository.ExecuteMigration(migration)
+	s.Assert().Len(errs, 2)
+
+	err := s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+
+	*migration.Content = `
+CREATE TABLE test1 (id UInt64, name String) ENGINE = MergeTree ORDER BY id;
+INSERT INTO test1 VALUES (1, 'a;b');
+`
+
+	errs = s.repository.ExecuteMigration(migration)
+	s.Assert().Nil(errs)
+
+	s.checkTableExists("test1", true)
+
+	applied, err := s.repository.GetAppliedMigrations()
+	s.Assert().NoError(err)
+	s.Require().Len(applied, 1)
+	s.Assert().Equal(migration.Version, applied[0].Version)
+	s.Assert().Equal(*migration.Checksum, applied[0].Checksum)
+	s.Assert().True(applied[0].Success)
+	s.Assert().Equal(migration.Author, applied[0].Author)
+	s.Assert().Equal(migration.Ticket, applied[0].Ticket)
+
+	// The statements executed before the failed one stay, the failed statement is reported, and the failure
+	// replaces the row of the version
+	*migration.Content = "CREATE TABLE test2 (id UInt64) ENGINE = MergeTree ORDER BY id;\nINVALID SQL"
+
+	errs = s.repository.ExecuteMigration(migration)
+	s.Require().Len(errs, 1)
+
+	var statementErr *database.StatementError
+	s.Require().ErrorAs(errs[0], &statementErr)
+	s.Assert().Equal(2, statementErr.Index)
+
+	s.checkTableExists("test2", true)
+
+	failing, err := s.repository.GetFailingMigrations()
+	s.Assert().NoError(err)
+	s.Assert().Len(failing, 1)
+
+	applied, err = s.repository.GetAppliedMigrations()
+	s.Assert().NoError(err)
+	s.Assert().Len(applied, 1)
+}
+
+func (s *MigrationTestSuite) TestExecuteAssertion() {
+	content := "SELECT 1 = 1"
+	hook := &migrations.Hook{
+		Order:   1,
+		Content: &content,
+		Type:    enums.HOOK_ASSERTION,
+	}
+
+	err := s.repository.ExecuteAssertion(hook)
+	s.Assert().NoError(err)
+
+	*hook.Content = "SELECT 1 = 2"
+	err = s.repository.ExecuteAssertion(hook)
+	s.Assert().ErrorContains(err, "returned false")
+
+	*hook.Content = "SELECT number FROM system.numbers LIMIT 2"
+	err = s.repository.ExecuteAssertion(hook)
+	s.Assert().ErrorContains(err, "returned 2 rows")
+}
+
+func (s *MigrationTestSuite) TestRollbackMigration() {
+	content := "DROP TABLE test3;"
+	migration := &migrations.Migration{
+		Version:     1,
+		Description: "t",
+		Type:        enums.MIGRATION_DOWN,
+		Content:     &content,
+	}
+
+	err := s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+
+	// Versions not applied are not rolled back
+	err = s.repository.RollbackMigration(migration)
+	s.Assert().NoError(err)
+
+	_, err = s.suiteDb.ExecContext(s.ctx, "CREATE TABLE test3 (id UInt64) ENGINE = MergeTree ORDER BY id")
+	s.Assert().NoError(err)
+	s.insertHistory(true, 1)
+
+	err = s.repository.RollbackMigration(migration)
+	s.Assert().NoError(err)
+
+	s.checkTableExists("test3", false)
+
+	applied, err := s.repository.GetAppliedMigrations()
+	s.Assert().NoError(err)
+	s.Assert().Empty(applied)
+}
+
+func (s *MigrationTestSuite) TestDoInLock() {
+	info, err := s.repository.GetLockInfo()
+	s.Assert().NoError(err)
+	s.Assert().False(info.Locked)
+
+	err = s.repository.DoInLock(func() error {
+		info, err := s.repository.GetLockInfo()
+		s.Assert().NoError(err)
+		s.Assert().True(info.Locked)
+		s.Assert().Contains(info.Owner, "pid")
+		s.Assert().NotNil(info.LockedAt)
+
+		// Later claims wait for the holder
+		err = s.repository.claimLock("other")
+		s.Require().NoError(err)
+
+		holder, err := s.repository.lockHolder()
+		s.Assert().NoError(err)
+		s.Assert().NotEqual("other", holder.claim)
+
+		return s.repository.updateClaim("other", true)
+	})
+	s.Assert().NoError(err)
+
+	info, err = s.repository.GetLockInfo()
+	s.Assert().NoError(err)
+	s.Assert().False(info.Locked)
+
+	// Expired claims do not hold the lock
+	_, err = s.suiteDb.ExecContext(s.ctx, fmt.Sprintf(`
+		INSERT INTO %s (claim, run_id, pid, host, claimed_at, expires_at)
+		SELECT 'expired', '', 1, 'host', now64(6), now() - 1
+	`, lock_table))
+	s.Assert().NoError(err)
+
+	info, err = s.repository.GetLockInfo()
+	s.Assert().NoError(err)
+	s.Assert().False(info.Locked)
+}
+
+func (s *MigrationTestSuite) TestAnnotate() {
+	err := s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+
+	err = s.repository.Annotate(1, "note")
+	s.Assert().ErrorIs(err, database.ErrNotApplied)
+
+	s.insertHistory(true, 1)
+
+	err = s.repository.Annotate(1, "note")
+	s.Assert().NoError(err)
+
+	row, err := s.repository.historyRow(1)
+	s.Require().NoError(err)
+	s.Assert().Equal("note", row.notes)
+	s.Assert().True(row.success)
+}
+
+func (s *MigrationTestSuite) TestClean() {
+	err := s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+
+	hook := `
+CREATE TABLE clean_table (id UInt64) ENGINE = MergeTree ORDER BY id;
+CREATE VIEW clean_view AS SELECT id FROM clean_table;
+CREATE MATERIALIZED VIEW clean_mv ENGINE = MergeTree ORDER BY id AS SELECT id FROM clean_table;
+`
+	err = s.repository.ExecuteHook(&migrations.Hook{Content: &hook})
+	s.Require().NoError(err)
+
+	err = s.repository.DoInLock(func() error {
+		return s.repository.Clean()
+	})
+	s.Assert().NoError(err)
+
+	tables := 0
+	err = s.suiteDb.QueryRowContext(s.ctx, `
+		SELECT count() FROM system.tables WHERE database = currentDatabase() AND name <> ?
+	`, lock_table).Scan(&tables)
+	s.Assert().NoError(err)
+	s.Assert().Equal(0, tables)
+}
+
+func (s *MigrationTestSuite) TestRunConcurrent() {
+	maestrotest.RunConcurrent(s.T(), 4, &maestrotest.Config{
+		NewRepository: func(t testing.TB) database.Repository {
+			db, err := sql.Open("clickhouse", s.clickhouse.URI)
+			s.Require().NoError(err)
+			t.Cleanup(func() { db.Close() })
+
+			return NewClickHouseRepository(s.ctx, db, testUtils.ToPtr(default_history_table))
+		},
+		Migrations: []string{
+			"CREATE TABLE concurrent1 (id UInt64) ENGINE = MergeTree ORDER BY id;",
+			"CREATE TABLE concurrent2 (id UInt64) ENGINE = MergeTree ORDER BY id;",
+			"CREATE TABLE concurrent3 (id UInt64) ENGINE = MergeTree ORDER BY id;",
+		},
+	})
+}
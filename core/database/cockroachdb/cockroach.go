@@ -2,24 +2,43 @@ package cockroachdb
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/maestro-go/maestro/core/database"
 	"github.com/maestro-go/maestro/core/enums"
+	"github.com/maestro-go/maestro/internal/conf"
 	"github.com/maestro-go/maestro/internal/migrations"
 )
 
 const default_history_table = "schema_history"
 const lock_table = "schema_lock"
 
+// batch_size is the number of migrations per statement of Repair and ValidateMigrations, keeping
+// the parameters of a statement below the limit of 65535.
+const batch_size = 1000
+
+// history_columns are the columns added to the history table after its first release, added by
+// upgradeHistoryTable to the tables created by previous versions.
+var history_columns = []struct{ name, definition string }{
+	{"notes", "TEXT"},
+	{"run_id", "VARCHAR(64)"},
+	{"author", "VARCHAR(255)"},
+	{"ticket", "VARCHAR(64)"},
+	{"skipped", "BOOLEAN NOT NULL DEFAULT false"},
+}
+
 type CockroachRepository struct {
 	database.Repository
 	ctx           context.Context
 	queriable     database.Queriable
 	db            database.Database
 	history_table string
+	run           database.RunInfo
 }
 
 func NewCockroachRepository(ctx context.Context, db database.Database, history_table *string) *CockroachRepository {
@@ -27,6 +46,7 @@ func NewCockroachRepository(ctx context.Context, db database.Database, history_t
 		ctx:       ctx,
 		queriable: db,
 		db:        db,
+		run:       database.RunInfo{MaestroVersion: conf.VERSION},
 	}
 
 	if history_table != nil {
@@ -63,23 +83,47 @@ func (r *CockroachRepository) GetLatestMigration() (uint16, error) {
 }
 
 func (r *CockroachRepository) AssertSchemaHistoryTable() error {
+	// Audit tables are also created for history tables of previous versions
+	query := fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			run_id VARCHAR(64) NOT NULL,
+			maestro_version VARCHAR(32) NOT NULL,
+			direction VARCHAR(4) NOT NULL,
+			version SMALLINT NOT NULL,
+			description VARCHAR(255) NOT NULL,
+			success BOOLEAN NOT NULL,
+			executed_at TIMESTAMP NOT NULL DEFAULT NOW()
+		);
+	`, r.auditTable())
+
+	_, err := r.queriable.ExecContext(r.ctx, query)
+	if err != nil {
+		return err
+	}
+
 	exists, err := r.CheckSchemaHistoryTable()
 	if err != nil {
 		return err
 	}
 
 	if exists {
-		return nil
+		return r.upgradeHistoryTable()
 	}
 
-	query := fmt.Sprintf(`
+	query = fmt.Sprintf(`
 		CREATE TABLE IF NOT EXISTS %s (
 			version SMALLINT NOT NULL PRIMARY KEY,
 			description VARCHAR(255) NOT NULL,
 			md5_checksum CHAR(32) NOT NULL,
 			success BOOLEAN NOT NULL DEFAULT false,
 			executed_at TIMESTAMP NOT NULL DEFAULT NOW(),
-			repaired_at TIMESTAMP
+			repaired_at TIMESTAMP,
+			notes TEXT,
+			run_id VARCHAR(64),
+			author VARCHAR(255),
+			ticket VARCHAR(64),
+			skipped BOOLEAN NOT NULL DEFAULT false
 		);
 	`, r.history_table)
 
@@ -91,6 +135,56 @@ func (r *CockroachRepository) AssertSchemaHistoryTable() error {
 	return nil
 }
 
+// upgradeHistoryTable adds the columns missing in history tables created by previous versions.
+// The catalog is checked first, as ALTER TABLE locks the table even when the column exists.
+func (r *CockroachRepository) upgradeHistoryTable() error {
+	columns, err := r.historyColumns()
+	if err != nil {
+		return err
+	}
+
+	for _, column := range history_columns {
+		if columns[column.name] {
+			continue
+		}
+
+		_, err = r.queriable.ExecContext(r.ctx, fmt.Sprintf(`
+			ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s %s;
+		`, r.history_table, column.name, column.definition))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// historyColumns returns the columns of the history table.
+func (r *CockroachRepository) historyColumns() (map[string]bool, error) {
+	query := `
+		SELECT column_name FROM information_schema.columns
+		WHERE table_name = $1 AND table_schema = current_schema();
+	`
+
+	rows, err := r.queriable.QueryContext(r.ctx, query, r.history_table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := map[string]bool{}
+	for rows.Next() {
+		var column string
+		err = rows.Scan(&column)
+		if err != nil {
+			return nil, err
+		}
+		columns[column] = true
+	}
+
+	return columns, rows.Err()
+}
+
 func (r *CockroachRepository) CheckSchemaHistoryTable() (bool, error) {
 	query := `
 		SELECT EXISTS (
@@ -122,22 +216,17 @@ func (r *CockroachRepository) ValidateMigrations(migrations []*migrations.Migrat
 		return nil
 	}
 
-	tuples := make([]string, 0, len(migrations))
-	params := make([]any, 0, len(migrations)*3)
-	for i, migration := range migrations {
-
+	local := make(map[uint16]bool, len(migrations))
+	for _, migration := range migrations {
 		if migration.Type != enums.MIGRATION_UP {
 			return []error{fmt.Errorf("invalid migration type: %s", migration.Type.Name())}
 		}
-
-		offset := i * 3
-		tuples = append(tuples, fmt.Sprintf("($%d, $%d, $%d)", offset+1, offset+2, offset+3))
-		params = append(params, migration.Version, migration.Description, *migration.Checksum)
+		local[migration.Version] = true
 	}
 
 	// Check gaps
 	query := fmt.Sprintf(`
-		SELECT version FROM %s ORDER BY version ASC;
+		SELECT version, description, md5_checksum, success FROM %s ORDER BY version ASC;
 	`, r.history_table)
 
 	versionsRows, err := r.queriable.QueryContext(r.ctx, query)
@@ -147,50 +236,76 @@ func (r *CockroachRepository) ValidateMigrations(migrations []*migrations.Migrat
 	defer versionsRows.Close()
 
 	errs := make([]error, 0)
+	mismatches := make([]*database.MismatchError, 0)
 	expectedVersion := uint16(1)
-	actualVersion := uint16(0)
 
 	for versionsRows.Next() {
-		err = versionsRows.Scan(&actualVersion)
+		applied, success := new(database.MismatchError), false
+		err = versionsRows.Scan(&applied.Version, &applied.Description, &applied.Checksum, &success)
 		if err != nil {
 			return []error{err}
 		}
 
-		if expectedVersion != actualVersion {
-			errs = append(errs, fmt.Errorf("missing version %d", expectedVersion))
+		if expectedVersion != applied.Version {
+			errs = append(errs, &database.MissingVersionError{Version: expectedVersion})
 		}
 
-		expectedVersion = actualVersion + 1
-	}
+		expectedVersion = applied.Version + 1
 
-	// Check description or checksum mismatch
-	query = fmt.Sprintf(`
-		SELECT version, description, md5_checksum
-		FROM %s
-		WHERE success = true AND (version, description, md5_checksum) NOT IN (%s);
-	`, r.history_table, strings.Join(tuples, ", "))
+		// Applied migrations missing locally mismatch
+		if success && !local[applied.Version] {
+			mismatches = append(mismatches, applied)
+		}
+	}
 
-	rows, err := r.queriable.QueryContext(r.ctx, query, params...)
-	if err != nil {
+	if err := versionsRows.Err(); err != nil {
 		return []error{err}
 	}
-	defer rows.Close()
 
-	type resStruct struct {
-		version      uint16
-		description  string
-		md5_checksum string
-	}
+	// Check description or checksum mismatch, joining the local migrations in batches
+	for _, batch := range database.Batches(migrations, batch_size) {
+		values := make([]string, 0, len(batch))
+		params := make([]any, 0, len(batch)*3)
+		for i, migration := range batch {
+			values = append(values, fmt.Sprintf("($%d::SMALLINT, $%d::TEXT, $%d::TEXT)", i*3+1, i*3+2, i*3+3))
+			params = append(params, migration.Version, migration.Description, *migration.Checksum)
+		}
 
-	for rows.Next() {
-		res := new(resStruct)
-		err := rows.Scan(&res.version, &res.description, &res.md5_checksum)
+		query = fmt.Sprintf(`
+			SELECT h.version, h.description, h.md5_checksum
+			FROM %s h
+			JOIN (VALUES %s) AS l (version, description, md5_checksum) ON l.version = h.version
+			WHERE h.success = true AND (h.description <> l.description OR h.md5_checksum <> l.md5_checksum);
+		`, r.history_table, strings.Join(values, ", "))
+
+		rows, err := r.queriable.QueryContext(r.ctx, query, params...)
 		if err != nil {
-			errs = append(errs, err)
+			return []error{err}
 		}
 
-		errs = append(errs, fmt.Errorf("invalid migration found: version: %d, description: %s, md5_checksum: %s."+
-			" Please check your local migration and changes", res.version, res.description, res.md5_checksum))
+		for rows.Next() {
+			mismatch := new(database.MismatchError)
+			err := rows.Scan(&mismatch.Version, &mismatch.Description, &mismatch.Checksum)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+
+			mismatches = append(mismatches, mismatch)
+		}
+
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return []error{err}
+		}
+	}
+
+	sort.Slice(mismatches, func(i, j int) bool {
+		return mismatches[i].Version < mismatches[j].Version
+	})
+	for _, mismatch := range mismatches {
+		errs = append(errs, mismatch)
 	}
 
 	if len(errs) > 0 {
@@ -206,23 +321,21 @@ func (r *CockroachRepository) ExecuteMigration(migration *migrations.Migration)
 
 	errs := make([]error, 0)
 
-	_, err := r.queriable.ExecContext(r.ctx, *migration.Content)
+	err := r.execScript(*migration.Content)
 	if err != nil {
 		errs = append(errs, err)
 	}
 
-	query := fmt.Sprintf(`
-		INSERT INTO %s (version, description, md5_checksum, success)
-		VALUES ($1, $2, $3, $4)
-		ON CONFLICT (version)
-		DO UPDATE SET description = $2, md5_checksum = $3, success = $4, executed_at = NOW();
-	`, r.history_table)
-
-	_, err = r.queriable.ExecContext(r.ctx, query, migration.Version, migration.Description,
-		migration.Checksum, err == nil)
+	success := err == nil
 
+	err = r.saveHistory(migration, success, false)
 	if err != nil {
 		errs = append(errs, fmt.Errorf("migration %d: %w", migration.Version, err))
+	} else {
+		err = r.audit(migration, database.AUDIT_UP, success)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("migration %d: %w", migration.Version, err))
+		}
 	}
 
 	if len(errs) > 0 {
@@ -232,8 +345,38 @@ func (r *CockroachRepository) ExecuteMigration(migration *migrations.Migration)
 	return nil
 }
 
+// saveHistory upserts the migration in the history table with the given status.
+func (r *CockroachRepository) saveHistory(migration *migrations.Migration, success bool, skipped bool) error {
+	query := fmt.Sprintf(`
+		INSERT INTO %s (version, description, md5_checksum, success, run_id, author, ticket, skipped)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, ''), NULLIF($7, ''), $8)
+		ON CONFLICT (version)
+		DO UPDATE SET description = $2, md5_checksum = $3, success = $4, run_id = NULLIF($5, ''),
+			author = NULLIF($6, ''), ticket = NULLIF($7, ''), skipped = $8, executed_at = NOW();
+	`, r.history_table)
+
+	_, err := r.queriable.ExecContext(r.ctx, query, migration.Version, migration.Description,
+		migration.Checksum, success, r.run.ID, migration.Author, migration.Ticket, skipped)
+	return err
+}
+
+// SkipMigration records the migration as applied and skipped in the history table without executing it, and
+// records the skip in the audit table.
+func (r *CockroachRepository) SkipMigration(migration *migrations.Migration) error {
+	if migration.Type != enums.MIGRATION_UP {
+		return fmt.Errorf("invalid migration type: %s", migration.Type.Name())
+	}
+
+	err := r.saveHistory(migration, true, true)
+	if err != nil {
+		return fmt.Errorf("migration %d: %w", migration.Version, err)
+	}
+
+	return r.audit(migration, database.AUDIT_SKIP, true)
+}
+
 func (r *CockroachRepository) ExecuteHook(hook *migrations.Hook) error {
-	_, err := r.queriable.ExecContext(r.ctx, *hook.Content)
+	err := r.execScript(*hook.Content)
 	if err != nil {
 		return err
 	}
@@ -241,6 +384,46 @@ func (r *CockroachRepository) ExecuteHook(hook *migrations.Hook) error {
 	return nil
 }
 
+func (r *CockroachRepository) ExecuteAssertion(hook *migrations.Hook) error {
+	rows, err := r.queriable.QueryContext(r.ctx, *hook.Content)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+
+	rowsCount := 0
+	isBool, isTrue := false, false
+	for rows.Next() {
+		rowsCount++
+		if rowsCount == 1 && len(columns) == 1 {
+			var value any
+			if err := rows.Scan(&value); err != nil {
+				return err
+			}
+			isTrue, isBool = value.(bool)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if rowsCount == 0 || (rowsCount == 1 && isTrue) {
+		return nil
+	}
+
+	if rowsCount == 1 && isBool {
+		return fmt.Errorf("assertion failed: query returned false")
+	}
+
+	return fmt.Errorf("assertion failed: query returned %d rows", rowsCount)
+}
+
 func (r *CockroachRepository) RollbackMigration(migration *migrations.Migration) error {
 	if migration.Type != enums.MIGRATION_DOWN {
 		return fmt.Errorf("invalid migration type: %s", migration.Type.Name())
@@ -262,7 +445,7 @@ func (r *CockroachRepository) RollbackMigration(migration *migrations.Migration)
 		return nil
 	}
 
-	_, err = r.queriable.ExecContext(r.ctx, *migration.Content)
+	err = r.execScript(*migration.Content)
 	if err != nil {
 		return err
 	}
@@ -286,6 +469,63 @@ func (r *CockroachRepository) RollbackMigration(migration *migrations.Migration)
 		return fmt.Errorf("version was not deleted from \"%s\" table", r.history_table)
 	}
 
+	return r.audit(migration, database.AUDIT_DOWN, true)
+}
+
+func (r *CockroachRepository) ServerInfo() (*database.ServerInfo, error) {
+	info := &database.ServerInfo{HistoryTable: r.history_table}
+
+	err := r.queriable.QueryRowContext(r.ctx, `
+		SELECT version(), COALESCE(current_schema(), '');
+	`).Scan(&info.Version, &info.Schema)
+	if err != nil {
+		return nil, err
+	}
+
+	info.HistoryTableExists, err = r.CheckSchemaHistoryTable()
+	if err != nil || !info.HistoryTableExists {
+		return info, err
+	}
+
+	query := fmt.Sprintf("SELECT COUNT(*) FROM %s;", r.history_table)
+	err = r.queriable.QueryRowContext(r.ctx, query).Scan(&info.HistoryRows)
+	if err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
+
+func (r *CockroachRepository) Capabilities() database.Capabilities {
+	return database.Capabilities{
+		SupportsTransactions:   true,
+		SupportsAdvisoryLock:   false,
+		SupportsMultiStatement: true,
+		MaxIdentifierLength:    0,
+	}
+}
+
+func (r *CockroachRepository) SetRunInfo(info database.RunInfo) {
+	r.run = info
+}
+
+func (r *CockroachRepository) auditTable() string {
+	return r.history_table + "_audit"
+}
+
+// audit records the execution of the migration in the audit table.
+func (r *CockroachRepository) audit(migration *migrations.Migration, direction string, success bool) error {
+	query := fmt.Sprintf(`
+		INSERT INTO %s (run_id, maestro_version, direction, version, description, success)
+		VALUES ($1, $2, $3, $4, $5, $6);
+	`, r.auditTable())
+
+	_, err := r.queriable.ExecContext(r.ctx, query, r.run.ID, r.run.MaestroVersion, direction,
+		migration.Version, migration.Description, success)
+	if err != nil {
+		return fmt.Errorf("error recording audit: %w", err)
+	}
+
 	return nil
 }
 
@@ -306,9 +546,56 @@ func (r *CockroachRepository) DoInTransaction(fn func() error) error {
 		return err
 	}
 
-	tx.Commit()
+	return tx.Commit()
+}
 
-	return nil
+func (r *CockroachRepository) DoOutsideTransaction(fn func() error) error {
+	if _, ok := r.queriable.(*sql.Tx); ok && database.SingleConnection(r.db) {
+		return errors.New("cannot run outside of the transaction with a single connection")
+	}
+
+	queriable := r.queriable
+	defer func() {
+		r.queriable = queriable
+	}()
+
+	r.queriable = r.db
+
+	return fn()
+}
+
+// Session returns a repository sharing the connections of this one, with its own transaction and run info.
+func (r *CockroachRepository) Session() database.Repository {
+	session := *r
+	session.queriable = r.db // Outside of the transaction of this repository
+	return &session
+}
+
+// GetLockInfo reports whether the lock table exists. The holder of the lock is not recorded.
+func (r *CockroachRepository) GetLockInfo() (*database.LockInfo, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT table_name FROM information_schema.tables
+			WHERE table_name = $1
+		);
+	`
+
+	exists := false
+	err := r.db.QueryRowContext(r.ctx, query, r.lockTable()).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+
+	return &database.LockInfo{Locked: exists}, nil
+}
+
+// lockTable returns the lock table of the history table, so the migrations of several history tables of
+// the same database do not block each other. The default history table keeps the lock table of previous versions.
+func (r *CockroachRepository) lockTable() string {
+	if r.history_table == default_history_table {
+		return lock_table
+	}
+	return r.history_table + "_lock"
 }
 
 func (r *CockroachRepository) DoInLock(fn func() error) error {
@@ -332,9 +619,9 @@ func (r *CockroachRepository) DoInLock(fn func() error) error {
 }
 
 // This function ensures that only one instance of the application can perform schema migrations at a time.
-// It achieves this by creating a lock table if it doesn't already exist. If the table exists,
-// it waits for up to 1 minute for the table to be deleted by another instance, indicating that the migration
-// process has completed.
+// It achieves this by creating a lock table, which fails if the table already exists, so two sessions checking
+// the table at the same time can not both take the lock. If the table exists, it waits for up to 1 minute for
+// the table to be deleted by another instance, indicating that the migration process has completed.
 func (r *CockroachRepository) lock() error {
 	query := `
 		SELECT EXISTS (
@@ -343,40 +630,41 @@ func (r *CockroachRepository) lock() error {
 		);
 	`
 
-	success := false
+	var createErr error
 	for range 12 {
+		_, createErr = r.db.ExecContext(r.ctx, fmt.Sprintf(`
+			CREATE TABLE %s (
+				unused INT NOT NULL PRIMARY KEY
+			);
+		`, r.lockTable()))
+		if createErr == nil {
+			return nil
+		}
+
+		// The creation failed because another instance holds the lock, unless the table does not exist: it was
+		// just deleted, or the creation failed for another reason, retried at once
 		exists := false
-		err := r.db.QueryRowContext(r.ctx, query, lock_table).Scan(&exists)
+		err := r.db.QueryRowContext(r.ctx, query, r.lockTable()).Scan(&exists)
 		if err != nil {
 			return err
 		}
-
 		if !exists {
-			_, err = r.db.ExecContext(r.ctx, fmt.Sprintf(`
-				CREATE TABLE IF NOT EXISTS %s (
-					unused INT NOT NULL PRIMARY KEY
-				);
-			`, lock_table))
-			if err != nil {
-				return err
-			}
-
-			success = true
-			break
+			continue
 		}
+		createErr = nil
 
 		time.Sleep(time.Second * 5) // Delays 5 seconds
 	}
 
-	if !success {
-		return fmt.Errorf("timeout while waiting for schema_lock deletion")
+	if createErr != nil {
+		return fmt.Errorf("failed to create lock table: %w", createErr)
 	}
 
-	return nil
+	return fmt.Errorf("timeout while waiting for schema_lock deletion")
 }
 
 func (r *CockroachRepository) unlock() error {
-	_, err := r.db.ExecContext(r.ctx, fmt.Sprintf("DROP TABLE IF EXISTS %s;", lock_table))
+	_, err := r.db.ExecContext(r.ctx, fmt.Sprintf("DROP TABLE IF EXISTS %s;", r.lockTable()))
 	if err != nil {
 		return err
 	}
@@ -394,30 +682,84 @@ func (r *CockroachRepository) Repair(migrations []*migrations.Migration) []error
 		return nil
 	}
 
-	errs := make([]error, 0)
+	err = r.inTransaction(func() error {
+		for _, batch := range database.Batches(migrations, batch_size) {
+			values := make([]string, 0, len(batch))
+			args := make([]any, 0, len(batch)*3)
+			for i, migration := range batch {
+				values = append(values, fmt.Sprintf("($%d, $%d, $%d, true, NOW())", i*3+1, i*3+2, i*3+3))
+				args = append(args, migration.Version, migration.Description, *migration.Checksum)
+			}
 
-	for _, migration := range migrations {
-		query := fmt.Sprintf(`
-			INSERT INTO %s (version, description, md5_checksum, success, repaired_at)
-			VALUES ($1, $2, $3, true, NOW())
-			ON CONFLICT (version) DO UPDATE
-			SET description = EXCLUDED.description, md5_checksum = EXCLUDED.md5_checksum,
-				repaired_at = CASE
-					WHEN EXCLUDED.description <> %s.description OR EXCLUDED.md5_checksum <> %s.md5_checksum
-					THEN NOW()
-					ELSE %s.repaired_at
-				END;
-		`, r.history_table, r.history_table, r.history_table, r.history_table)
-
-		_, err := r.queriable.ExecContext(r.ctx, query, migration.Version, migration.Description, *migration.Checksum)
-		if err != nil {
-			errs = append(errs, err)
+			query := fmt.Sprintf(`
+				INSERT INTO %s (version, description, md5_checksum, success, repaired_at)
+				VALUES %s
+				ON CONFLICT (version) DO UPDATE
+				SET description = EXCLUDED.description, md5_checksum = EXCLUDED.md5_checksum,
+					repaired_at = CASE
+						WHEN EXCLUDED.description <> %s.description OR EXCLUDED.md5_checksum <> %s.md5_checksum
+						THEN NOW()
+						ELSE %s.repaired_at
+					END;
+			`, r.history_table, strings.Join(values, ", "), r.history_table, r.history_table, r.history_table)
+
+			_, err := r.queriable.ExecContext(r.ctx, query, args...)
+			if err != nil {
+				return err
+			}
 		}
+		return nil
+	})
+	if err != nil {
+		return []error{err}
 	}
 
-	if len(errs) > 0 {
-		return errs
+	return nil
+}
+
+// inTransaction runs the callback in the transaction started by DoInTransaction, or in a new one.
+func (r *CockroachRepository) inTransaction(fn func() error) error {
+	if _, ok := r.queriable.(*sql.Tx); ok {
+		return fn()
+	}
+	return r.DoInTransaction(fn)
+}
+
+// Annotate sets the note of the version in the notes column of the history table, added if missing.
+func (r *CockroachRepository) Annotate(version uint16, note string) error {
+	exists, err := r.CheckSchemaHistoryTable()
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return fmt.Errorf("version %d: %w", version, database.ErrNotApplied)
+	}
+
+	// History tables created by previous versions have no notes column
+	err = r.upgradeHistoryTable()
+	if err != nil {
+		return err
 	}
+
+	query := fmt.Sprintf(`
+		UPDATE %s SET notes = NULLIF($1, '') WHERE version = $2;
+	`, r.history_table)
+
+	res, err := r.queriable.ExecContext(r.ctx, query, note, version)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected < 1 {
+		return fmt.Errorf("version %d: %w", version, database.ErrNotApplied)
+	}
+
 	return nil
 }
 
@@ -458,3 +800,177 @@ func (r *CockroachRepository) GetFailingMigrations() ([]*migrations.Migration, e
 
 	return failingMigrations, nil
 }
+
+func (r *CockroachRepository) GetAppliedMigrations() ([]*database.AppliedMigration, error) {
+	exists, err := r.CheckSchemaHistoryTable()
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		return nil, nil
+	}
+
+	// History tables created by previous versions have no author, ticket and skipped columns until the next run
+	columns, err := r.historyColumns()
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := "'', ''"
+	if columns["author"] && columns["ticket"] {
+		metadata = "COALESCE(author, ''), COALESCE(ticket, '')"
+	}
+
+	skipped := "false"
+	if columns["skipped"] {
+		skipped = "skipped"
+	}
+
+	query := fmt.Sprintf(`
+		SELECT version, description, md5_checksum, success, %s, %s
+		FROM %s
+		ORDER BY version ASC;
+	`, metadata, skipped, r.history_table)
+
+	rows, err := r.queriable.QueryContext(r.ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make([]*database.AppliedMigration, 0)
+	for rows.Next() {
+		migration := new(database.AppliedMigration)
+		err := rows.Scan(&migration.Version, &migration.Description, &migration.Checksum, &migration.Success,
+			&migration.Author, &migration.Ticket, &migration.Skipped)
+		if err != nil {
+			return nil, err
+		}
+		applied = append(applied, migration)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return applied, nil
+}
+
+func (r *CockroachRepository) Clean() error {
+	// The lock table is kept, so cleaning inside DoInLock does not release the lock
+	query := `
+		SELECT 'DROP MATERIALIZED VIEW IF EXISTS ' || quote_ident(matviewname) || ' CASCADE'
+		FROM pg_matviews WHERE schemaname = current_schema()
+		UNION ALL
+		SELECT 'DROP VIEW IF EXISTS ' || quote_ident(viewname) || ' CASCADE'
+		FROM pg_views WHERE schemaname = current_schema()
+		UNION ALL
+		SELECT 'DROP TABLE IF EXISTS ' || quote_ident(tablename) || ' CASCADE'
+		FROM pg_tables WHERE schemaname = current_schema() AND tablename <> $1
+		UNION ALL
+		SELECT 'DROP SEQUENCE IF EXISTS ' || quote_ident(sequence_name) || ' CASCADE'
+		FROM information_schema.sequences WHERE sequence_schema = current_schema()
+		UNION ALL
+		SELECT 'DROP TYPE IF EXISTS ' || quote_ident(t.typname) || ' CASCADE'
+		FROM pg_type t JOIN pg_namespace n ON n.oid = t.typnamespace
+		WHERE n.nspname = current_schema() AND t.typtype = 'e';
+	`
+
+	rows, err := r.queriable.QueryContext(r.ctx, query, r.lockTable())
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	statements := make([]string, 0)
+	for rows.Next() {
+		statement := ""
+		if err := rows.Scan(&statement); err != nil {
+			return err
+		}
+		statements = append(statements, statement)
+	}
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	for _, statement := range statements {
+		_, err = r.queriable.ExecContext(r.ctx, statement)
+		if err != nil {
+			return fmt.Errorf("error executing %q: %w", statement, err)
+		}
+	}
+
+	return nil
+}
+
+// execScript executes a migration or hook script. COPY ... FROM STDIN statements followed by inline data
+// are executed through the copy protocol, which requires a transaction: if the script is not already
+// running inside one, the whole script is executed in its own transaction.
+func (r *CockroachRepository) execScript(script string) error {
+	if !migrations.HasCopyFromStdin(script) {
+		_, err := r.queriable.ExecContext(r.ctx, script)
+		return err
+	}
+
+	parts, err := migrations.SplitCopyStatements(script)
+	if err != nil {
+		return err
+	}
+
+	tx, inTransaction := r.queriable.(*sql.Tx)
+	if !inTransaction {
+		tx, err = r.db.BeginTx(r.ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+	}
+
+	for _, part := range parts {
+		if !part.Copy {
+			_, err = tx.ExecContext(r.ctx, part.SQL)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		err = copyRows(r.ctx, tx, part)
+		if err != nil {
+			return err
+		}
+	}
+
+	if !inTransaction {
+		return tx.Commit()
+	}
+
+	return nil
+}
+
+func copyRows(ctx context.Context, tx *sql.Tx, part *migrations.ScriptPart) error {
+	stmt, err := tx.PrepareContext(ctx, part.SQL)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, row := range part.Rows {
+		_, err = stmt.ExecContext(ctx, row...)
+		if err != nil {
+			return fmt.Errorf("error copying rows: %w", err)
+		}
+	}
+
+	// Flushes the copy stream and reports pending errors
+	_, err = stmt.ExecContext(ctx)
+	if err != nil {
+		return fmt.Errorf("error copying rows: %w", err)
+	}
+
+	return nil
+}
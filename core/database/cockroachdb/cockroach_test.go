@@ -6,7 +6,9 @@ import (
 	"fmt"
 	"testing"
 
+	"github.com/maestro-go/maestro/core/database"
 	"github.com/maestro-go/maestro/core/enums"
+	"github.com/maestro-go/maestro/core/maestrotest"
 	"github.com/maestro-go/maestro/internal/migrations"
 	testUtils "github.com/maestro-go/maestro/internal/utils/testing"
 	"github.com/stretchr/testify/suite"
@@ -416,3 +418,67 @@ func (s *MigrationTestSuite) TestGetFailingMigrations() {
 	s.Assert().Equal(uint16(1), failingMigrations[0].Version)
 	s.Assert().Equal(uint16(3), failingMigrations[1].Version)
 }
+
+func (s *MigrationTestSuite) TestClean() {
+	err := s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+
+	_, err = s.suiteDb.ExecContext(s.ctx, `
+		CREATE TYPE clean_status AS ENUM ('a', 'b');
+		CREATE SEQUENCE clean_seq;
+		CREATE TABLE clean_table (id INT PRIMARY KEY, status clean_status);
+		CREATE VIEW clean_view AS SELECT id FROM clean_table;
+	`)
+	s.Require().NoError(err)
+
+	err = s.repository.DoInLock(func() error {
+		err := s.repository.Clean()
+		s.Assert().NoError(err)
+
+		s.checkTableExists(lock_table, true)
+		return nil
+	})
+	s.Assert().NoError(err)
+
+	s.checkTableExists(default_history_table, false)
+	s.checkTableExists("clean_table", false)
+	s.checkTableExists("clean_view", false)
+	s.checkTableExists("clean_seq", false)
+}
+
+func (s *MigrationTestSuite) TestRunConcurrent() {
+	maestrotest.RunConcurrent(s.T(), 4, &maestrotest.Config{
+		NewRepository: func(t testing.TB) database.Repository {
+			db, err := sql.Open("postgres", s.cockroach.URI)
+			s.Require().NoError(err)
+			t.Cleanup(func() { db.Close() })
+
+			return NewCockroachRepository(s.ctx, db, testUtils.ToPtr(default_history_table))
+		},
+		Migrations: []string{
+			"CREATE TABLE concurrent1 (id INT PRIMARY KEY);",
+			"CREATE TABLE concurrent2 (id INT PRIMARY KEY);",
+			"CREATE TABLE concurrent3 (id INT PRIMARY KEY);",
+		},
+	})
+}
+
+func (s *MigrationTestSuite) TestRunConcurrentSharedRepository() {
+	db, err := sql.Open("postgres", s.cockroach.URI)
+	s.Require().NoError(err)
+	defer db.Close()
+
+	// The migrators use sessions of the same repository, sharing its pool of connections
+	repository := NewCockroachRepository(s.ctx, db, testUtils.ToPtr(default_history_table))
+
+	maestrotest.RunConcurrent(s.T(), 4, &maestrotest.Config{
+		NewRepository: func(t testing.TB) database.Repository {
+			return repository
+		},
+		Migrations: []string{
+			"CREATE TABLE concurrent1 (id INT PRIMARY KEY);",
+			"CREATE TABLE concurrent2 (id INT PRIMARY KEY);",
+			"CREATE TABLE concurrent3 (id INT PRIMARY KEY);",
+		},
+	})
+}
@@ -0,0 +1,189 @@
+package databricks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const statements_api = "/api/2.0/sql/statements"
+
+// poll_interval is the delay between polls of statements still running after the wait timeout of the request.
+const poll_interval = time.Second
+
+var warehouseIDMatch = regexp.MustCompile(`/warehouses/([^/?]+)`)
+
+// WarehouseIDFromHTTPPath returns the ID of the SQL warehouse of its HTTP path (e.g. "/sql/1.0/warehouses/abc123"),
+// as shown in the connection details of the warehouse.
+func WarehouseIDFromHTTPPath(httpPath string) (string, error) {
+	matches := warehouseIDMatch.FindStringSubmatch(httpPath)
+	if matches == nil {
+		return "", fmt.Errorf("invalid HTTP path %q: expected the path of a SQL warehouse", httpPath)
+	}
+
+	return matches[1], nil
+}
+
+// parameter is a named parameter (":name") of a statement.
+type parameter struct {
+	Name  string  `json:"name"`
+	Value *string `json:"value"`
+	Type  string  `json:"type,omitempty"`
+}
+
+// statementResponse is the state and inline result of a statement of the Statement Execution API.
+type statementResponse struct {
+	StatementID string `json:"statement_id"`
+	Status      struct {
+		State string `json:"state"`
+		Error *struct {
+			ErrorCode string `json:"error_code"`
+			Message   string `json:"message"`
+		} `json:"error"`
+	} `json:"status"`
+	Manifest struct {
+		Schema struct {
+			Columns []struct {
+				Name     string `json:"name"`
+				TypeName string `json:"type_name"`
+			} `json:"columns"`
+		} `json:"schema"`
+	} `json:"manifest"`
+	Result struct {
+		DataArray [][]*string `json:"data_array"`
+	} `json:"result"`
+}
+
+// statementError is the error of a failed statement.
+type statementError struct {
+	code    string
+	message string
+}
+
+func (e *statementError) Error() string {
+	return fmt.Sprintf("%s: %s", e.code, e.message)
+}
+
+// client executes statements on a SQL warehouse through the Statement Execution API, authenticated
+// with a personal access token. Statements are executed and committed one at a time.
+type client struct {
+	http        *http.Client
+	url         string
+	token       string
+	warehouseID string
+	catalog     string
+	schema      string
+}
+
+// query executes the statement and returns its rows, with NULL values as nil. Values are returned as
+// strings, and the column types of the result are returned in the same order as the values.
+func (c *client) query(ctx context.Context, statement string, parameters ...*parameter) ([][]*string, []string, error) {
+	response := new(statementResponse)
+	err := c.do(ctx, http.MethodPost, statements_api, map[string]any{
+		"statement":       statement,
+		"warehouse_id":    c.warehouseID,
+		"catalog":         c.catalog,
+		"schema":          c.schema,
+		"parameters":      parameters,
+		"wait_timeout":    "30s",
+		"on_wait_timeout": "CONTINUE",
+		"disposition":     "INLINE",
+		"format":          "JSON_ARRAY",
+	}, response)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for response.Status.State == "PENDING" || response.Status.State == "RUNNING" {
+		select {
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		case <-time.After(poll_interval):
+		}
+
+		statementID := response.StatementID
+		response = new(statementResponse)
+		err = c.do(ctx, http.MethodGet, statements_api+"/"+statementID, nil, response)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if response.Status.State != "SUCCEEDED" {
+		if response.Status.Error != nil {
+			return nil, nil, &statementError{code: response.Status.Error.ErrorCode, message: response.Status.Error.Message}
+		}
+		return nil, nil, fmt.Errorf("statement %s", strings.ToLower(response.Status.State))
+	}
+
+	types := make([]string, 0, len(response.Manifest.Schema.Columns))
+	for _, column := range response.Manifest.Schema.Columns {
+		types = append(types, column.TypeName)
+	}
+
+	return response.Result.DataArray, types, nil
+}
+
+func (c *client) exec(ctx context.Context, statement string, parameters ...*parameter) error {
+	_, _, err := c.query(ctx, statement, parameters...)
+	return err
+}
+
+func (c *client) do(ctx context.Context, method string, path string, body any, response any) error {
+	var reader io.Reader
+	if body != nil {
+		content, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(content)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, method, c.url+path, reader)
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("Authorization", "Bearer "+c.token)
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+
+	httpResponse, err := c.http.Do(request)
+	if err != nil {
+		return err
+	}
+	defer httpResponse.Body.Close()
+
+	content, err := io.ReadAll(httpResponse.Body)
+	if err != nil {
+		return err
+	}
+
+	if httpResponse.StatusCode < 200 || httpResponse.StatusCode > 299 {
+		return fmt.Errorf("%s %s: %s: %s", method, path, http.StatusText(httpResponse.StatusCode),
+			strings.TrimSpace(string(content)))
+	}
+
+	return json.Unmarshal(content, response)
+}
+
+func stringParameter(name string, value string) *parameter {
+	return &parameter{Name: name, Value: &value, Type: "STRING"}
+}
+
+func smallintParameter(name string, value uint16) *parameter {
+	text := fmt.Sprint(value)
+	return &parameter{Name: name, Value: &text, Type: "SMALLINT"}
+}
+
+func booleanParameter(name string, value bool) *parameter {
+	text := fmt.Sprint(value)
+	return &parameter{Name: name, Value: &text, Type: "BOOLEAN"}
+}
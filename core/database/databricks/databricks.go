@@ -0,0 +1,819 @@
+// Package databricks implements the maestro repository for Databricks SQL warehouses, executing
+// Spark SQL migrations through the Statement Execution API.
+//
+// The schema history is stored in Delta tables of the configured catalog and schema, and a lock
+// table coordinates concurrent executions. The API executes and commits statements one at a time,
+// so failed migrations are recorded in the history and must be fixed and repaired manually.
+package databricks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/maestro-go/maestro/core/database"
+	"github.com/maestro-go/maestro/core/enums"
+	"github.com/maestro-go/maestro/internal/conf"
+	"github.com/maestro-go/maestro/internal/migrations"
+)
+
+const default_history_table = "schema_history"
+const lock_table = "schema_lock"
+
+const table_already_exists = "TABLE_OR_VIEW_ALREADY_EXISTS"
+
+// history_columns are the columns added to the history table after its first release, added by
+// upgradeHistoryTable to the tables created by previous versions.
+var history_columns = []struct{ name, definition string }{
+	{"notes", "STRING"},
+	{"run_id", "STRING"},
+	{"author", "STRING"},
+	{"ticket", "STRING"},
+	{"skipped", "BOOLEAN"},
+}
+
+type DatabricksRepository struct {
+	database.Repository
+	ctx           context.Context
+	client        *client
+	history_table string
+	run           database.RunInfo
+}
+
+// NewDatabricksRepository returns a repository executing statements on the SQL warehouse of the given ID,
+// in the workspace of the given URL (e.g. "https://dbc-1234.cloud.databricks.com"), authenticated with the
+// personal access token. Empty catalog and schema use the defaults of the warehouse.
+func NewDatabricksRepository(ctx context.Context, httpClient *http.Client, url string, token string,
+	warehouseID string, catalog string, schema string, history_table *string) *DatabricksRepository {
+
+	repo := &DatabricksRepository{
+		ctx: ctx,
+		client: &client{
+			http:        httpClient,
+			url:         strings.TrimSuffix(url, "/"),
+			token:       token,
+			warehouseID: warehouseID,
+			catalog:     catalog,
+			schema:      schema,
+		},
+		run: database.RunInfo{MaestroVersion: conf.VERSION},
+	}
+
+	if history_table != nil {
+		repo.history_table = *history_table
+	} else {
+		repo.history_table = default_history_table
+	}
+
+	return repo
+}
+
+// Ping checks that the warehouse is reachable, starting it if it is stopped.
+func (r *DatabricksRepository) Ping() error {
+	return r.client.exec(r.ctx, "SELECT 1")
+}
+
+func (r *DatabricksRepository) GetLatestMigration() (uint16, error) {
+	tableExists, err := r.CheckSchemaHistoryTable()
+	if err != nil {
+		return 0, err
+	}
+
+	if !tableExists {
+		return 0, nil
+	}
+
+	rows, _, err := r.client.query(r.ctx, fmt.Sprintf(`
+		SELECT COALESCE(MAX(version), 0)
+		FROM %s
+		WHERE success = true
+	`, quote(r.history_table)))
+	if err != nil {
+		return 0, err
+	}
+
+	return parseVersion(rows[0][0])
+}
+
+func (r *DatabricksRepository) AssertSchemaHistoryTable() error {
+	// Audit tables are also created for history tables of previous versions
+	err := r.client.exec(r.ctx, fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			run_id STRING NOT NULL,
+			maestro_version STRING NOT NULL,
+			direction STRING NOT NULL,
+			version SMALLINT NOT NULL,
+			description STRING NOT NULL,
+			success BOOLEAN NOT NULL,
+			executed_at TIMESTAMP NOT NULL
+		) USING DELTA
+	`, quote(r.auditTable())))
+	if err != nil {
+		return err
+	}
+
+	err = r.client.exec(r.ctx, fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			version SMALLINT NOT NULL,
+			description STRING NOT NULL,
+			md5_checksum STRING NOT NULL,
+			success BOOLEAN NOT NULL,
+			executed_at TIMESTAMP NOT NULL,
+			repaired_at TIMESTAMP,
+			notes STRING,
+			run_id STRING,
+			author STRING,
+			ticket STRING,
+			skipped BOOLEAN
+		) USING DELTA
+	`, quote(r.history_table)))
+	if err != nil {
+		return err
+	}
+
+	return r.upgradeHistoryTable()
+}
+
+// upgradeHistoryTable adds the columns missing in history tables created by previous versions.
+func (r *DatabricksRepository) upgradeHistoryTable() error {
+	columns, err := r.historyColumns()
+	if err != nil {
+		return err
+	}
+
+	for _, column := range history_columns {
+		if columns[column.name] {
+			continue
+		}
+
+		err = r.client.exec(r.ctx, fmt.Sprintf("ALTER TABLE %s ADD COLUMNS (%s %s)", quote(r.history_table),
+			column.name, column.definition))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// historyColumns returns the columns of the history table.
+func (r *DatabricksRepository) historyColumns() (map[string]bool, error) {
+	rows, _, err := r.client.query(r.ctx, fmt.Sprintf("DESCRIBE TABLE %s", quote(r.history_table)))
+	if err != nil {
+		return nil, err
+	}
+
+	columns := map[string]bool{}
+	for _, row := range rows {
+		if len(row) > 0 && row[0] != nil {
+			columns[*row[0]] = true
+		}
+	}
+
+	return columns, nil
+}
+
+func (r *DatabricksRepository) CheckSchemaHistoryTable() (bool, error) {
+	return r.tableExists(r.history_table)
+}
+
+func (r *DatabricksRepository) ValidateMigrations(localMigrations []*migrations.Migration) []error {
+	if len(localMigrations) < 1 {
+		return nil
+	}
+
+	byVersion := make(map[uint16]*migrations.Migration, len(localMigrations))
+	for _, migration := range localMigrations {
+		if migration.Type != enums.MIGRATION_UP {
+			return []error{fmt.Errorf("invalid migration type: %s", migration.Type.Name())}
+		}
+		byVersion[migration.Version] = migration
+	}
+
+	tableExists, err := r.CheckSchemaHistoryTable()
+	if err != nil {
+		return []error{err}
+	}
+
+	if !tableExists {
+		return nil
+	}
+
+	history, err := r.history(nil, "")
+	if err != nil {
+		return []error{err}
+	}
+
+	errs := make([]error, 0)
+	expectedVersion := uint16(1)
+
+	for _, applied := range history {
+		// Check gaps
+		if expectedVersion != applied.version {
+			errs = append(errs, &database.MissingVersionError{Version: expectedVersion})
+		}
+		expectedVersion = applied.version + 1
+
+		// Check description or checksum mismatch
+		local, ok := byVersion[applied.version]
+		if applied.success && (!ok || local.Description != applied.description || *local.Checksum != applied.checksum) {
+			errs = append(errs, &database.MismatchError{Version: applied.version, Description: applied.description, Checksum: applied.checksum})
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (r *DatabricksRepository) ExecuteMigration(migration *migrations.Migration) []error {
+	if migration.Type != enums.MIGRATION_UP {
+		return []error{fmt.Errorf("invalid migration type: %s", migration.Type.Name())}
+	}
+
+	errs := make([]error, 0)
+
+	err := r.execScript(*migration.Content, migration.SkipStatements)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	success := err == nil
+
+	err = r.saveHistory(migration, success, false)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("migration %d: %w", migration.Version, err))
+	} else {
+		err = r.audit(migration, database.AUDIT_UP, success)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("migration %d: %w", migration.Version, err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// saveHistory upserts the migration in the history table with the given status, and whether it was skipped
+// without being executed.
+func (r *DatabricksRepository) saveHistory(migration *migrations.Migration, success bool, skipped bool) error {
+	return r.client.exec(r.ctx, fmt.Sprintf(`
+		MERGE INTO %s AS h
+		USING (SELECT :version AS version) AS m
+		ON h.version = m.version
+		WHEN MATCHED THEN UPDATE SET description = :description, md5_checksum = :checksum, success = :success,
+			run_id = NULLIF(:run_id, ''), author = NULLIF(:author, ''), ticket = NULLIF(:ticket, ''),
+			skipped = :skipped, executed_at = current_timestamp()
+		WHEN NOT MATCHED THEN INSERT (version, description, md5_checksum, success, run_id, author, ticket, skipped,
+			executed_at)
+			VALUES (:version, :description, :checksum, :success, NULLIF(:run_id, ''), NULLIF(:author, ''),
+				NULLIF(:ticket, ''), :skipped, current_timestamp())
+	`, quote(r.history_table)),
+		smallintParameter("version", migration.Version),
+		stringParameter("description", migration.Description),
+		stringParameter("checksum", *migration.Checksum),
+		booleanParameter("success", success),
+		stringParameter("run_id", r.run.ID),
+		stringParameter("author", migration.Author),
+		stringParameter("ticket", migration.Ticket),
+		booleanParameter("skipped", skipped),
+	)
+}
+
+// SkipMigration records the migration as applied and skipped in the history table without executing it, and
+// records the skip in the audit table.
+func (r *DatabricksRepository) SkipMigration(migration *migrations.Migration) error {
+	if migration.Type != enums.MIGRATION_UP {
+		return fmt.Errorf("invalid migration type: %s", migration.Type.Name())
+	}
+
+	err := r.saveHistory(migration, true, true)
+	if err != nil {
+		return fmt.Errorf("migration %d: %w", migration.Version, err)
+	}
+
+	return r.audit(migration, database.AUDIT_SKIP, true)
+}
+
+func (r *DatabricksRepository) ExecuteHook(hook *migrations.Hook) error {
+	return r.execScript(*hook.Content, 0)
+}
+
+func (r *DatabricksRepository) ExecuteAssertion(hook *migrations.Hook) error {
+	rows, types, err := r.client.query(r.ctx, *hook.Content)
+	if err != nil {
+		return err
+	}
+
+	if len(rows) == 0 {
+		return nil
+	}
+
+	if len(rows) == 1 && len(rows[0]) == 1 && len(types) == 1 && types[0] == "BOOLEAN" {
+		if rows[0][0] != nil && *rows[0][0] == "true" {
+			return nil
+		}
+		return fmt.Errorf("assertion failed: query returned false")
+	}
+
+	return fmt.Errorf("assertion failed: query returned %d rows", len(rows))
+}
+
+func (r *DatabricksRepository) RollbackMigration(migration *migrations.Migration) error {
+	if migration.Type != enums.MIGRATION_DOWN {
+		return fmt.Errorf("invalid migration type: %s", migration.Type.Name())
+	}
+
+	history, err := r.history(nil, "WHERE version = :version", smallintParameter("version", migration.Version))
+	if err != nil {
+		return err
+	}
+
+	if len(history) < 1 {
+		return nil
+	}
+
+	err = r.execScript(*migration.Content, 0)
+	if err != nil {
+		return err
+	}
+
+	rows, _, err := r.client.query(r.ctx, fmt.Sprintf(`
+		DELETE FROM %s WHERE version = :version
+	`, quote(r.history_table)), smallintParameter("version", migration.Version))
+	if err != nil {
+		return err
+	}
+
+	// DELETE returns the number of affected rows
+	if len(rows) < 1 || len(rows[0]) < 1 || rows[0][0] == nil || *rows[0][0] == "0" {
+		return fmt.Errorf("version was not deleted from \"%s\" table", r.history_table)
+	}
+
+	return r.audit(migration, database.AUDIT_DOWN, true)
+}
+
+// ServerInfo returns the Spark version of the warehouse. The schema is qualified with the catalog.
+func (r *DatabricksRepository) ServerInfo() (*database.ServerInfo, error) {
+	rows, _, err := r.client.query(r.ctx, "SELECT version(), current_catalog() || '.' || current_schema()")
+	if err != nil {
+		return nil, err
+	}
+
+	info := &database.ServerInfo{HistoryTable: r.history_table}
+	if rows[0][0] != nil {
+		info.Version = *rows[0][0]
+	}
+	if rows[0][1] != nil {
+		info.Schema = *rows[0][1]
+	}
+
+	info.HistoryTableExists, err = r.CheckSchemaHistoryTable()
+	if err != nil || !info.HistoryTableExists {
+		return info, err
+	}
+
+	rows, _, err = r.client.query(r.ctx, fmt.Sprintf("SELECT COUNT(*) FROM %s", quote(r.history_table)))
+	if err != nil {
+		return nil, err
+	}
+
+	if rows[0][0] != nil {
+		info.HistoryRows, err = strconv.ParseInt(*rows[0][0], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return info, nil
+}
+
+func (r *DatabricksRepository) Capabilities() database.Capabilities {
+	return database.Capabilities{
+		SupportsTransactions:   false,
+		SupportsAdvisoryLock:   false,
+		SupportsMultiStatement: false,
+		MaxIdentifierLength:    255,
+	}
+}
+
+func (r *DatabricksRepository) SetRunInfo(info database.RunInfo) {
+	r.run = info
+}
+
+func (r *DatabricksRepository) auditTable() string {
+	return r.history_table + "_audit"
+}
+
+// audit records the execution of the migration in the audit table.
+func (r *DatabricksRepository) audit(migration *migrations.Migration, direction string, success bool) error {
+	err := r.client.exec(r.ctx, fmt.Sprintf(`
+		INSERT INTO %s (run_id, maestro_version, direction, version, description, success, executed_at)
+		VALUES (:run_id, :maestro_version, :direction, :version, :description, :success, current_timestamp())
+	`, quote(r.auditTable())),
+		stringParameter("run_id", r.run.ID),
+		stringParameter("maestro_version", r.run.MaestroVersion),
+		stringParameter("direction", direction),
+		smallintParameter("version", migration.Version),
+		stringParameter("description", migration.Description),
+		booleanParameter("success", success),
+	)
+	if err != nil {
+		return fmt.Errorf("error recording audit: %w", err)
+	}
+
+	return nil
+}
+
+// DoInTransaction runs the callback: the Statement Execution API commits statements one at a time.
+func (r *DatabricksRepository) DoInTransaction(fn func() error) error {
+	return fn()
+}
+
+// DoOutsideTransaction runs the callback, as DoInTransaction does not start a transaction.
+func (r *DatabricksRepository) DoOutsideTransaction(fn func() error) error {
+	return fn()
+}
+
+// Session returns a repository sharing the HTTP client of this one, with its own run info.
+func (r *DatabricksRepository) Session() database.Repository {
+	session := *r
+	return &session
+}
+
+// GetLockInfo reports whether the lock table exists. The holder of the lock is not recorded.
+func (r *DatabricksRepository) GetLockInfo() (*database.LockInfo, error) {
+	exists, err := r.tableExists(r.lockTable())
+	if err != nil {
+		return nil, err
+	}
+
+	return &database.LockInfo{Locked: exists}, nil
+}
+
+// lockTable returns the lock table of the history table, so the migrations of several history tables of
+// the same database do not block each other. The default history table keeps the lock table of previous versions.
+func (r *DatabricksRepository) lockTable() string {
+	if r.history_table == default_history_table {
+		return lock_table
+	}
+	return r.history_table + "_lock"
+}
+
+func (r *DatabricksRepository) DoInLock(fn func() error) error {
+	err := r.lock()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = r.unlock()
+		if err != nil {
+			panic(fmt.Errorf("failed to delete lock table: %w", err))
+		}
+	}()
+
+	err = fn()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// This function ensures that only one instance of the application can perform schema migrations at a time.
+// It achieves this by creating a lock table. If the table exists, it waits for up to 1 minute for the
+// table to be deleted by another instance, indicating that the migration process has completed.
+func (r *DatabricksRepository) lock() error {
+	for range 12 {
+		err := r.client.exec(r.ctx, fmt.Sprintf("CREATE TABLE %s (unused INT) USING DELTA", quote(r.lockTable())))
+		if err == nil {
+			return nil
+		}
+
+		if !isAlreadyExists(err) {
+			return err
+		}
+
+		time.Sleep(time.Second * 5) // Delays 5 seconds
+	}
+
+	return fmt.Errorf("timeout while waiting for %s deletion", r.lockTable())
+}
+
+func (r *DatabricksRepository) unlock() error {
+	return r.client.exec(r.ctx, fmt.Sprintf("DROP TABLE IF EXISTS %s", quote(r.lockTable())))
+}
+
+func (r *DatabricksRepository) Repair(migrations []*migrations.Migration) []error {
+	tableExists, err := r.CheckSchemaHistoryTable()
+	if err != nil {
+		return []error{err}
+	}
+
+	if !tableExists || len(migrations) == 0 {
+		return nil
+	}
+
+	// The Statement Execution API has no transactions, so every migration is merged by a single
+	// statement, which Delta tables commit atomically.
+	rows := make([]string, 0, len(migrations))
+	parameters := make([]*parameter, 0, len(migrations)*3)
+	for i, migration := range migrations {
+		rows = append(rows, fmt.Sprintf("(:version_%d, :description_%d, :checksum_%d)", i, i, i))
+		parameters = append(parameters,
+			smallintParameter(fmt.Sprintf("version_%d", i), migration.Version),
+			stringParameter(fmt.Sprintf("description_%d", i), migration.Description),
+			stringParameter(fmt.Sprintf("checksum_%d", i), *migration.Checksum),
+		)
+	}
+
+	err = r.client.exec(r.ctx, fmt.Sprintf(`
+		MERGE INTO %s AS h
+		USING (SELECT * FROM VALUES %s AS l(version, description, md5_checksum)) AS m
+		ON h.version = m.version
+		WHEN MATCHED THEN UPDATE SET
+			repaired_at = CASE
+				WHEN h.description <> m.description OR h.md5_checksum <> m.md5_checksum THEN current_timestamp()
+				ELSE h.repaired_at
+			END,
+			description = m.description, md5_checksum = m.md5_checksum, success = true
+		WHEN NOT MATCHED THEN INSERT (version, description, md5_checksum, success, executed_at, repaired_at)
+			VALUES (m.version, m.description, m.md5_checksum, true, current_timestamp(), current_timestamp())
+	`, quote(r.history_table), strings.Join(rows, ", ")), parameters...)
+	if err != nil {
+		return []error{err}
+	}
+
+	return nil
+}
+
+// Annotate sets the note of the version in the notes column of the history table, added if missing.
+func (r *DatabricksRepository) Annotate(version uint16, note string) error {
+	exists, err := r.CheckSchemaHistoryTable()
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return fmt.Errorf("version %d: %w", version, database.ErrNotApplied)
+	}
+
+	// History tables created by previous versions have no notes column
+	err = r.upgradeHistoryTable()
+	if err != nil {
+		return err
+	}
+
+	rows, _, err := r.client.query(r.ctx, fmt.Sprintf(`
+		UPDATE %s SET notes = NULLIF(:note, '') WHERE version = :version
+	`, quote(r.history_table)), stringParameter("note", note), smallintParameter("version", version))
+	if err != nil {
+		return err
+	}
+
+	// UPDATE returns the number of affected rows
+	if len(rows) < 1 || len(rows[0]) < 1 || rows[0][0] == nil || *rows[0][0] == "0" {
+		return fmt.Errorf("version %d: %w", version, database.ErrNotApplied)
+	}
+
+	return nil
+}
+
+func (r *DatabricksRepository) GetFailingMigrations() ([]*migrations.Migration, error) {
+	exists, err := r.CheckSchemaHistoryTable()
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		return nil, nil
+	}
+
+	history, err := r.history(nil, "WHERE success = false")
+	if err != nil {
+		return nil, err
+	}
+
+	var failingMigrations []*migrations.Migration
+	for _, failing := range history {
+		checksum := failing.checksum
+		failingMigrations = append(failingMigrations, &migrations.Migration{
+			Version:     failing.version,
+			Description: failing.description,
+			Checksum:    &checksum,
+		})
+	}
+
+	return failingMigrations, nil
+}
+
+func (r *DatabricksRepository) GetAppliedMigrations() ([]*database.AppliedMigration, error) {
+	exists, err := r.CheckSchemaHistoryTable()
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		return nil, nil
+	}
+
+	// History tables created by previous versions have no author, ticket and skipped columns until the next run
+	columns, err := r.historyColumns()
+	if err != nil {
+		return nil, err
+	}
+
+	history, err := r.history(columns, "")
+	if err != nil {
+		return nil, err
+	}
+
+	applied := make([]*database.AppliedMigration, 0, len(history))
+	for _, row := range history {
+		applied = append(applied, &database.AppliedMigration{
+			Version:     row.version,
+			Description: row.description,
+			Checksum:    row.checksum,
+			Success:     row.success,
+			Author:      row.author,
+			Ticket:      row.ticket,
+			Skipped:     row.skipped,
+		})
+	}
+
+	return applied, nil
+}
+
+// Clean drops every view, table and user function of the schema, except the lock table, so cleaning inside
+// DoInLock does not release the lock.
+func (r *DatabricksRepository) Clean() error {
+	views, _, err := r.client.query(r.ctx, "SHOW VIEWS")
+	if err != nil {
+		return err
+	}
+
+	// Columns: namespace, viewName, isTemporary
+	isView := make(map[string]bool, len(views))
+	statements := make([]string, 0)
+	for _, row := range views {
+		if row[1] == nil || (row[2] != nil && *row[2] == "true") {
+			continue
+		}
+		isView[*row[1]] = true
+		statements = append(statements, "DROP VIEW IF EXISTS "+quote(*row[1]))
+	}
+
+	tables, _, err := r.client.query(r.ctx, "SHOW TABLES")
+	if err != nil {
+		return err
+	}
+
+	// Columns: database, tableName, isTemporary
+	for _, row := range tables {
+		if row[1] == nil || isView[*row[1]] || strings.EqualFold(*row[1], r.lockTable()) ||
+			(row[2] != nil && *row[2] == "true") {
+			continue
+		}
+		statements = append(statements, "DROP TABLE IF EXISTS "+quote(*row[1]))
+	}
+
+	functions, _, err := r.client.query(r.ctx, "SHOW USER FUNCTIONS")
+	if err != nil {
+		return err
+	}
+
+	// Function names are qualified and already quoted where needed
+	for _, row := range functions {
+		if row[0] == nil {
+			continue
+		}
+		statements = append(statements, "DROP FUNCTION IF EXISTS "+*row[0])
+	}
+
+	for _, statement := range statements {
+		err = r.client.exec(r.ctx, statement)
+		if err != nil {
+			return fmt.Errorf("error executing %q: %w", statement, err)
+		}
+	}
+
+	return nil
+}
+
+type historyRow struct {
+	version     uint16
+	description string
+	checksum    string
+	success     bool
+	author      string
+	ticket      string
+	skipped     bool
+}
+
+// history returns the rows of the history table matching the filter, ordered by version, with the optional
+// columns found in columns (author and ticket, skipped), e.g. nil to only read the columns of the first release.
+func (r *DatabricksRepository) history(columns map[string]bool, filter string, parameters ...*parameter) ([]*historyRow, error) {
+	metadata := "NULL, NULL"
+	if columns["author"] && columns["ticket"] {
+		metadata = "author, ticket"
+	}
+
+	skipped := "NULL"
+	if columns["skipped"] {
+		skipped = "skipped"
+	}
+
+	rows, _, err := r.client.query(r.ctx, fmt.Sprintf(`
+		SELECT version, description, md5_checksum, success, %s, %s
+		FROM %s %s
+		ORDER BY version ASC
+	`, metadata, skipped, quote(r.history_table), filter), parameters...)
+	if err != nil {
+		return nil, err
+	}
+
+	history := make([]*historyRow, 0, len(rows))
+	for _, row := range rows {
+		version, err := parseVersion(row[0])
+		if err != nil {
+			return nil, err
+		}
+
+		applied := &historyRow{version: version}
+		if row[1] != nil {
+			applied.description = *row[1]
+		}
+		if row[2] != nil {
+			applied.checksum = *row[2]
+		}
+		applied.success = row[3] != nil && *row[3] == "true"
+		if len(row) > 6 && row[4] != nil {
+			applied.author = *row[4]
+		}
+		if len(row) > 6 && row[5] != nil {
+			applied.ticket = *row[5]
+		}
+		applied.skipped = len(row) > 6 && row[6] != nil && *row[6] == "true"
+
+		history = append(history, applied)
+	}
+
+	return history, nil
+}
+
+func (r *DatabricksRepository) tableExists(name string) (bool, error) {
+	rows, _, err := r.client.query(r.ctx, fmt.Sprintf("SHOW TABLES LIKE '%s'", strings.ReplaceAll(name, "'", "\\'")))
+	if err != nil {
+		return false, err
+	}
+
+	return len(rows) > 0, nil
+}
+
+// execScript executes a migration or hook script one statement at a time.
+func (r *DatabricksRepository) execScript(script string, skip int) error {
+	for i, statement := range migrations.SplitSparkStatements(script) {
+		if i < skip {
+			continue
+		}
+
+		err := r.client.exec(r.ctx, statement)
+		if err != nil {
+			line, _, _ := strings.Cut(strings.TrimSpace(statement), "\n")
+			return &database.StatementError{Index: i + 1, Err: fmt.Errorf("statement %d (%s): %w", i+1, line, err)}
+		}
+	}
+
+	return nil
+}
+
+func parseVersion(value *string) (uint16, error) {
+	if value == nil {
+		return 0, nil
+	}
+
+	version, err := strconv.ParseUint(*value, 10, 16)
+	if err != nil {
+		return 0, fmt.Errorf("invalid version %q: %w", *value, err)
+	}
+
+	return uint16(version), nil
+}
+
+func isAlreadyExists(err error) bool {
+	var statementErr *statementError
+	return errors.As(err, &statementErr) && strings.Contains(statementErr.message, table_already_exists)
+}
+
+// quote returns the name quoted with backticks, so any table name can be used.
+func quote(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
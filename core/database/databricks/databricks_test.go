@@ -0,0 +1,136 @@
+package databricks
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/maestro-go/maestro/internal/migrations"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeServer answers the lock and assertion statements of the repository through the Statement Execution API.
+// Assertions are answered as still running, so the repository has to poll for their result.
+type fakeServer struct {
+	mu         sync.Mutex
+	locked     bool
+	assertion  string
+	statements []string
+}
+
+func (f *fakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.Header.Get("Authorization") != "Bearer token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	if r.Method == http.MethodGet && r.URL.Path == statements_api+"/assertion" {
+		w.Write([]byte(`{"statement_id": "assertion", "status": {"state": "SUCCEEDED"}, ` + f.assertion + `}`))
+		return
+	}
+
+	if r.Method != http.MethodPost || r.URL.Path != statements_api {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	body := struct {
+		Statement   string `json:"statement"`
+		WarehouseID string `json:"warehouse_id"`
+	}{}
+	json.NewDecoder(r.Body).Decode(&body)
+
+	if body.WarehouseID != "abc123" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	statement := strings.TrimSpace(body.Statement)
+	f.statements = append(f.statements, statement)
+
+	switch {
+	case strings.HasPrefix(statement, "CREATE TABLE `schema_lock`"):
+		if f.locked {
+			w.Write([]byte(`{"statement_id": "lock", "status": {"state": "FAILED", "error": {"error_code": "BAD_REQUEST",` +
+				` "message": "[TABLE_OR_VIEW_ALREADY_EXISTS] Cannot create table or view"}}}`))
+			return
+		}
+		f.locked = true
+	case strings.HasPrefix(statement, "DROP TABLE IF EXISTS `schema_lock`"):
+		f.locked = false
+	case strings.HasPrefix(statement, "SELECT count(*)"):
+		w.Write([]byte(`{"statement_id": "assertion", "status": {"state": "RUNNING"}}`))
+		return
+	}
+
+	w.Write([]byte(`{"statement_id": "statement", "status": {"state": "SUCCEEDED"}}`))
+}
+
+func newTestRepository(server *fakeServer) (*DatabricksRepository, func()) {
+	httpServer := httptest.NewServer(server)
+	repo := NewDatabricksRepository(context.Background(), httpServer.Client(), httpServer.URL, "token", "abc123",
+		"main", "default", nil)
+	return repo, httpServer.Close
+}
+
+func TestWarehouseIDFromHTTPPath(t *testing.T) {
+	id, err := WarehouseIDFromHTTPPath("/sql/1.0/warehouses/abc123")
+	assert.NoError(t, err)
+	assert.Equal(t, "abc123", id)
+
+	_, err = WarehouseIDFromHTTPPath("/sql/protocolv1/o/0/cluster")
+	assert.Error(t, err)
+}
+
+func TestDoInLock(t *testing.T) {
+	server := &fakeServer{}
+	repo, cleanup := newTestRepository(server)
+	defer cleanup()
+
+	err := repo.DoInLock(func() error {
+		assert.True(t, server.locked)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.False(t, server.locked)
+}
+
+func TestLockAlreadyExists(t *testing.T) {
+	server := &fakeServer{locked: true}
+	repo, cleanup := newTestRepository(server)
+	defer cleanup()
+
+	err := repo.client.exec(repo.ctx, "CREATE TABLE `schema_lock` (unused INT) USING DELTA")
+	assert.True(t, isAlreadyExists(err))
+}
+
+func TestExecuteAssertion(t *testing.T) {
+	server := &fakeServer{}
+	repo, cleanup := newTestRepository(server)
+	defer cleanup()
+
+	content := "SELECT count(*) = 0 FROM users WHERE email IS NULL"
+	hook := &migrations.Hook{Content: &content}
+
+	server.assertion = `"manifest": {"schema": {"columns": [{"name": "ok", "type_name": "BOOLEAN"}]}},` +
+		` "result": {"data_array": [["true"]]}`
+	assert.NoError(t, repo.ExecuteAssertion(hook))
+
+	server.assertion = `"manifest": {"schema": {"columns": [{"name": "ok", "type_name": "BOOLEAN"}]}},` +
+		` "result": {"data_array": [["false"]]}`
+	assert.EqualError(t, repo.ExecuteAssertion(hook), "assertion failed: query returned false")
+
+	server.assertion = `"manifest": {"schema": {"columns": [{"name": "email", "type_name": "STRING"}]}},` +
+		` "result": {"data_array": [["a"], ["b"]]}`
+	assert.EqualError(t, repo.ExecuteAssertion(hook), "assertion failed: query returned 2 rows")
+
+	server.assertion = `"manifest": {"schema": {"columns": [{"name": "email", "type_name": "STRING"}]}}`
+	assert.NoError(t, repo.ExecuteAssertion(hook))
+}
@@ -0,0 +1,853 @@
+// Package exasol implements the maestro repository for Exasol.
+//
+// The package does not import a database driver: open the connection with the Exasol driver
+// (github.com/exasol/exasol-driver-go) and pass it to NewExasolRepository.
+package exasol
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/maestro-go/maestro/core/database"
+	"github.com/maestro-go/maestro/core/enums"
+	"github.com/maestro-go/maestro/internal/conf"
+	"github.com/maestro-go/maestro/internal/migrations"
+)
+
+const default_history_table = "schema_history"
+const lock_table = "schema_lock"
+
+// repair_batch_size is the number of migrations merged per statement by Repair.
+const repair_batch_size = 1000
+
+// history_columns are the columns added to the history table after its first release, added by
+// upgradeHistoryTable to the tables created by previous versions.
+var history_columns = []struct{ name, definition string }{
+	{"notes", "VARCHAR(2000)"},
+	{"run_id", "VARCHAR(64)"},
+	{"author", "VARCHAR(255)"},
+	{"ticket", "VARCHAR(64)"},
+	{"skipped", "BOOLEAN DEFAULT false NOT NULL"},
+}
+
+// ExasolRepository executes migrations statement by statement, as Exasol commits DDL implicitly.
+// Since a failed migration can not be rolled back, its failure is recorded in the schema history
+// table outside of any transaction, and DoInTransaction only runs the callback.
+type ExasolRepository struct {
+	database.Repository
+	ctx           context.Context
+	db            database.Database
+	history_table string
+	run           database.RunInfo
+}
+
+func NewExasolRepository(ctx context.Context, db database.Database, history_table *string) *ExasolRepository {
+	repo := &ExasolRepository{
+		ctx: ctx,
+		db:  db,
+		run: database.RunInfo{MaestroVersion: conf.VERSION},
+	}
+
+	if history_table != nil {
+		repo.history_table = *history_table
+	} else {
+		repo.history_table = default_history_table
+	}
+
+	return repo
+}
+
+func (r *ExasolRepository) GetLatestMigration() (uint16, error) {
+	tableExists, err := r.CheckSchemaHistoryTable()
+	if err != nil {
+		return 0, err
+	}
+
+	if !tableExists {
+		return 0, nil
+	}
+
+	query := fmt.Sprintf(`
+		SELECT COALESCE(MAX(version), 0)
+		FROM %s
+		WHERE success = true
+	`, r.history_table)
+
+	version := uint16(0)
+	err = r.db.QueryRowContext(r.ctx, query).Scan(&version)
+	if err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+func (r *ExasolRepository) AssertSchemaHistoryTable() error {
+	query := fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			id DECIMAL(18, 0) IDENTITY PRIMARY KEY,
+			run_id VARCHAR(64) NOT NULL,
+			maestro_version VARCHAR(32) NOT NULL,
+			direction VARCHAR(4) NOT NULL,
+			version SMALLINT NOT NULL,
+			description VARCHAR(255) NOT NULL,
+			success BOOLEAN NOT NULL,
+			executed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL
+		)
+	`, r.auditTable())
+
+	_, err := r.db.ExecContext(r.ctx, query)
+	if err != nil {
+		return err
+	}
+
+	query = fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			version SMALLINT NOT NULL PRIMARY KEY,
+			description VARCHAR(255) NOT NULL,
+			md5_checksum CHAR(32) NOT NULL,
+			success BOOLEAN DEFAULT false NOT NULL,
+			executed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+			repaired_at TIMESTAMP,
+			notes VARCHAR(2000),
+			run_id VARCHAR(64),
+			author VARCHAR(255),
+			ticket VARCHAR(64),
+			skipped BOOLEAN DEFAULT false NOT NULL
+		)
+	`, r.history_table)
+
+	_, err = r.db.ExecContext(r.ctx, query)
+	if err != nil {
+		return err
+	}
+
+	return r.upgradeHistoryTable()
+}
+
+// upgradeHistoryTable adds the columns missing in history tables created by previous versions.
+func (r *ExasolRepository) upgradeHistoryTable() error {
+	columns, err := r.historyColumns()
+	if err != nil {
+		return err
+	}
+
+	for _, column := range history_columns {
+		if columns[column.name] {
+			continue
+		}
+
+		_, err = r.db.ExecContext(r.ctx, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", r.history_table,
+			column.name, column.definition))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// historyColumns returns the columns of the history table, in lower case.
+func (r *ExasolRepository) historyColumns() (map[string]bool, error) {
+	query := `
+		SELECT COLUMN_NAME FROM SYS.EXA_ALL_COLUMNS
+		WHERE COLUMN_SCHEMA = CURRENT_SCHEMA AND COLUMN_TABLE = UPPER(?)
+	`
+
+	rows, err := r.db.QueryContext(r.ctx, query, r.history_table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := map[string]bool{}
+	for rows.Next() {
+		var column string
+		err = rows.Scan(&column)
+		if err != nil {
+			return nil, err
+		}
+		columns[strings.ToLower(column)] = true
+	}
+
+	return columns, rows.Err()
+}
+
+func (r *ExasolRepository) CheckSchemaHistoryTable() (bool, error) {
+	return r.tableExists(r.history_table)
+}
+
+func (r *ExasolRepository) tableExists(table string) (bool, error) {
+	// Unquoted identifiers are stored in upper case
+	query := `
+		SELECT COUNT(*) FROM SYS.EXA_ALL_TABLES
+		WHERE TABLE_SCHEMA = CURRENT_SCHEMA AND TABLE_NAME = UPPER(?)
+	`
+
+	count := 0
+	err := r.db.QueryRowContext(r.ctx, query, table).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+func (r *ExasolRepository) ValidateMigrations(localMigrations []*migrations.Migration) []error {
+	if len(localMigrations) < 1 {
+		return nil
+	}
+
+	tableExists, err := r.CheckSchemaHistoryTable()
+	if err != nil {
+		return []error{err}
+	}
+
+	if !tableExists {
+		return nil
+	}
+
+	byVersion := make(map[uint16]*migrations.Migration, len(localMigrations))
+	for _, migration := range localMigrations {
+		if migration.Type != enums.MIGRATION_UP {
+			return []error{fmt.Errorf("invalid migration type: %s", migration.Type.Name())}
+		}
+		byVersion[migration.Version] = migration
+	}
+
+	query := fmt.Sprintf(`
+		SELECT version, description, md5_checksum, success
+		FROM %s
+		ORDER BY version ASC
+	`, r.history_table)
+
+	rows, err := r.db.QueryContext(r.ctx, query)
+	if err != nil {
+		return []error{err}
+	}
+	defer rows.Close()
+
+	errs := make([]error, 0)
+	expectedVersion := uint16(1)
+
+	for rows.Next() {
+		version, description, checksum, success := uint16(0), "", "", false
+		err = rows.Scan(&version, &description, &checksum, &success)
+		if err != nil {
+			return []error{err}
+		}
+
+		// Check gaps
+		if expectedVersion != version {
+			errs = append(errs, &database.MissingVersionError{Version: expectedVersion})
+		}
+		expectedVersion = version + 1
+
+		// Check description or checksum mismatch
+		local, ok := byVersion[version]
+		if success && (!ok || local.Description != description || *local.Checksum != checksum) {
+			errs = append(errs, &database.MismatchError{Version: version, Description: description, Checksum: checksum})
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return []error{err}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (r *ExasolRepository) ExecuteMigration(migration *migrations.Migration) []error {
+	if migration.Type != enums.MIGRATION_UP {
+		return []error{fmt.Errorf("invalid migration type: %s", migration.Type.Name())}
+	}
+
+	errs := make([]error, 0)
+
+	err := r.execScript(*migration.Content, migration.SkipStatements)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	success := err == nil
+
+	err = r.saveHistory(migration, success, false)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("migration %d: %w", migration.Version, err))
+	} else {
+		err = r.audit(migration, database.AUDIT_UP, success)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("migration %d: %w", migration.Version, err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// SkipMigration records the migration as applied and skipped in the history table without executing it, and
+// records the skip in the audit table.
+func (r *ExasolRepository) SkipMigration(migration *migrations.Migration) error {
+	if migration.Type != enums.MIGRATION_UP {
+		return fmt.Errorf("invalid migration type: %s", migration.Type.Name())
+	}
+
+	err := r.saveHistory(migration, true, true)
+	if err != nil {
+		return fmt.Errorf("migration %d: %w", migration.Version, err)
+	}
+
+	return r.audit(migration, database.AUDIT_SKIP, true)
+}
+
+// saveHistory updates the history row of the migration, inserting it if it does not exist yet, with the given
+// status and whether it was skipped without being executed.
+func (r *ExasolRepository) saveHistory(migration *migrations.Migration, success bool, skipped bool) error {
+	query := fmt.Sprintf(`
+		UPDATE %s
+		SET description = ?, md5_checksum = ?, success = ?, run_id = ?, author = ?, ticket = ?, skipped = ?,
+			executed_at = CURRENT_TIMESTAMP
+		WHERE version = ?
+	`, r.history_table)
+
+	res, err := r.db.ExecContext(r.ctx, query, migration.Description, *migration.Checksum, success,
+		nullable(r.run.ID), nullable(migration.Author), nullable(migration.Ticket), skipped, migration.Version)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected > 0 {
+		return nil
+	}
+
+	query = fmt.Sprintf(`
+		INSERT INTO %s (version, description, md5_checksum, success, run_id, author, ticket, skipped)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, r.history_table)
+
+	_, err = r.db.ExecContext(r.ctx, query, migration.Version, migration.Description, *migration.Checksum,
+		success, nullable(r.run.ID), nullable(migration.Author), nullable(migration.Ticket), skipped)
+	return err
+}
+
+func (r *ExasolRepository) ExecuteHook(hook *migrations.Hook) error {
+	return r.execScript(*hook.Content, 0)
+}
+
+func (r *ExasolRepository) ExecuteAssertion(hook *migrations.Hook) error {
+	rows, err := r.db.QueryContext(r.ctx, *hook.Content)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+
+	rowsCount := 0
+	isBool, isTrue := false, false
+	for rows.Next() {
+		rowsCount++
+		if rowsCount == 1 && len(columns) == 1 {
+			var value any
+			if err := rows.Scan(&value); err != nil {
+				return err
+			}
+			isTrue, isBool = value.(bool)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if rowsCount == 0 || (rowsCount == 1 && isTrue) {
+		return nil
+	}
+
+	if rowsCount == 1 && isBool {
+		return fmt.Errorf("assertion failed: query returned false")
+	}
+
+	return fmt.Errorf("assertion failed: query returned %d rows", rowsCount)
+}
+
+func (r *ExasolRepository) RollbackMigration(migration *migrations.Migration) error {
+	if migration.Type != enums.MIGRATION_DOWN {
+		return fmt.Errorf("invalid migration type: %s", migration.Type.Name())
+	}
+
+	query := fmt.Sprintf(`
+		SELECT COUNT(*) FROM %s WHERE version = ?
+	`, r.history_table)
+
+	count := 0
+	err := r.db.QueryRowContext(r.ctx, query, migration.Version).Scan(&count)
+	if err != nil {
+		return err
+	}
+
+	if count < 1 {
+		return nil
+	}
+
+	err = r.execScript(*migration.Content, 0)
+	if err != nil {
+		return err
+	}
+
+	query = fmt.Sprintf(`
+		DELETE FROM %s
+		WHERE version = ?
+	`, r.history_table)
+
+	res, err := r.db.ExecContext(r.ctx, query, migration.Version)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected < 1 {
+		return fmt.Errorf("version was not deleted from \"%s\" table", r.history_table)
+	}
+
+	return r.audit(migration, database.AUDIT_DOWN, true)
+}
+
+func (r *ExasolRepository) ServerInfo() (*database.ServerInfo, error) {
+	info := &database.ServerInfo{HistoryTable: r.history_table}
+
+	err := r.db.QueryRowContext(r.ctx, `
+		SELECT PARAM_VALUE, COALESCE(CURRENT_SCHEMA, '')
+		FROM SYS.EXA_METADATA
+		WHERE PARAM_NAME = 'databaseProductVersion'
+	`).Scan(&info.Version, &info.Schema)
+	if err != nil {
+		return nil, err
+	}
+
+	info.HistoryTableExists, err = r.CheckSchemaHistoryTable()
+	if err != nil || !info.HistoryTableExists {
+		return info, err
+	}
+
+	query := fmt.Sprintf("SELECT COUNT(*) FROM %s", r.history_table)
+	err = r.db.QueryRowContext(r.ctx, query).Scan(&info.HistoryRows)
+	if err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
+
+func (r *ExasolRepository) Capabilities() database.Capabilities {
+	return database.Capabilities{
+		SupportsTransactions:   false,
+		SupportsAdvisoryLock:   false,
+		SupportsMultiStatement: false,
+		MaxIdentifierLength:    128,
+	}
+}
+
+func (r *ExasolRepository) SetRunInfo(info database.RunInfo) {
+	r.run = info
+}
+
+func (r *ExasolRepository) auditTable() string {
+	return r.history_table + "_audit"
+}
+
+// audit records the execution of the migration in the audit table.
+func (r *ExasolRepository) audit(migration *migrations.Migration, direction string, success bool) error {
+	query := fmt.Sprintf(`
+		INSERT INTO %s (run_id, maestro_version, direction, version, description, success)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, r.auditTable())
+
+	_, err := r.db.ExecContext(r.ctx, query, r.run.ID, r.run.MaestroVersion, direction,
+		migration.Version, migration.Description, success)
+	if err != nil {
+		return fmt.Errorf("error recording audit: %w", err)
+	}
+
+	return nil
+}
+
+// DoInTransaction runs the callback without a transaction: DDL is committed implicitly by Exasol,
+// so failed migrations are recorded in the schema history table instead of being rolled back.
+func (r *ExasolRepository) DoInTransaction(fn func() error) error {
+	return fn()
+}
+
+// DoOutsideTransaction runs the callback, as DoInTransaction does not start a transaction.
+func (r *ExasolRepository) DoOutsideTransaction(fn func() error) error {
+	return fn()
+}
+
+// Session returns a repository sharing the connections of this one, with its own run info.
+func (r *ExasolRepository) Session() database.Repository {
+	session := *r
+	return &session
+}
+
+// GetLockInfo reports whether the lock table exists. The holder of the lock is not recorded.
+func (r *ExasolRepository) GetLockInfo() (*database.LockInfo, error) {
+	exists, err := r.tableExists(r.lockTable())
+	if err != nil {
+		return nil, err
+	}
+
+	return &database.LockInfo{Locked: exists}, nil
+}
+
+// lockTable returns the lock table of the history table, so the migrations of several history tables of
+// the same database do not block each other. The default history table keeps the lock table of previous versions.
+func (r *ExasolRepository) lockTable() string {
+	if r.history_table == default_history_table {
+		return lock_table
+	}
+	return r.history_table + "_lock"
+}
+
+func (r *ExasolRepository) DoInLock(fn func() error) error {
+	err := r.lock()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = r.unlock()
+		if err != nil {
+			panic(fmt.Errorf("failed to delete lock table: %w", err))
+		}
+	}()
+
+	err = fn()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// This function ensures that only one instance of the application can perform schema migrations at a time.
+// It achieves this by creating a lock table if it doesn't already exist. If the table exists,
+// it waits for up to 1 minute for the table to be deleted by another instance, indicating that the migration
+// process has completed.
+func (r *ExasolRepository) lock() error {
+	for range 12 {
+		exists, err := r.tableExists(r.lockTable())
+		if err != nil {
+			return err
+		}
+
+		if !exists {
+			_, err = r.db.ExecContext(r.ctx, fmt.Sprintf(`
+				CREATE TABLE %s (
+					unused INT NOT NULL PRIMARY KEY
+				)
+			`, r.lockTable()))
+			if err != nil {
+				return err
+			}
+
+			return nil
+		}
+
+		time.Sleep(time.Second * 5) // Delays 5 seconds
+	}
+
+	return fmt.Errorf("timeout while waiting for %s deletion", r.lockTable())
+}
+
+func (r *ExasolRepository) unlock() error {
+	_, err := r.db.ExecContext(r.ctx, fmt.Sprintf("DROP TABLE IF EXISTS %s", r.lockTable()))
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *ExasolRepository) Repair(migrations []*migrations.Migration) []error {
+	tableExists, err := r.CheckSchemaHistoryTable()
+	if err != nil {
+		return []error{err}
+	}
+
+	if !tableExists {
+		return nil
+	}
+
+	// MERGE is DML, so unlike migrations the batches can be committed together.
+	tx, err := r.db.BeginTx(r.ctx, nil)
+	if err != nil {
+		return []error{err}
+	}
+	defer tx.Rollback()
+
+	for _, batch := range database.Batches(migrations, repair_batch_size) {
+		rows := make([]string, 0, len(batch))
+		args := make([]any, 0, len(batch)*3)
+		for _, migration := range batch {
+			rows = append(rows, "SELECT CAST(? AS SMALLINT) AS version, CAST(? AS VARCHAR(255)) AS description, "+
+				"CAST(? AS CHAR(32)) AS md5_checksum")
+			args = append(args, migration.Version, migration.Description, *migration.Checksum)
+		}
+
+		query := fmt.Sprintf(`
+			MERGE INTO %s h
+			USING (%s) l
+			ON h.version = l.version
+			WHEN MATCHED THEN UPDATE SET
+				repaired_at = CASE
+					WHEN l.description <> h.description OR l.md5_checksum <> h.md5_checksum
+					THEN CURRENT_TIMESTAMP
+					ELSE h.repaired_at
+				END,
+				description = l.description, md5_checksum = l.md5_checksum, success = true
+			WHEN NOT MATCHED THEN INSERT (version, description, md5_checksum, success, repaired_at)
+				VALUES (l.version, l.description, l.md5_checksum, true, CURRENT_TIMESTAMP)
+		`, r.history_table, strings.Join(rows, " UNION ALL "))
+
+		_, err := tx.ExecContext(r.ctx, query, args...)
+		if err != nil {
+			return []error{err}
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return []error{err}
+	}
+
+	return nil
+}
+
+// Annotate sets the note of the version in the notes column of the history table, added if missing.
+func (r *ExasolRepository) Annotate(version uint16, note string) error {
+	exists, err := r.CheckSchemaHistoryTable()
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return fmt.Errorf("version %d: %w", version, database.ErrNotApplied)
+	}
+
+	// History tables created by previous versions have no notes column
+	err = r.upgradeHistoryTable()
+	if err != nil {
+		return err
+	}
+
+	var value any
+	if note != "" {
+		value = note
+	}
+
+	res, err := r.db.ExecContext(r.ctx, fmt.Sprintf("UPDATE %s SET notes = ? WHERE version = ?", r.history_table),
+		value, version)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected < 1 {
+		return fmt.Errorf("version %d: %w", version, database.ErrNotApplied)
+	}
+
+	return nil
+}
+
+func (r *ExasolRepository) GetFailingMigrations() ([]*migrations.Migration, error) {
+	exists, err := r.CheckSchemaHistoryTable()
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		return nil, nil
+	}
+
+	query := fmt.Sprintf(`
+		SELECT version, description, md5_checksum
+		FROM %s
+		WHERE success = false
+	`, r.history_table)
+
+	rows, err := r.db.QueryContext(r.ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var failingMigrations []*migrations.Migration
+	for rows.Next() {
+		var migration migrations.Migration
+		if err := rows.Scan(&migration.Version, &migration.Description, &migration.Checksum); err != nil {
+			return nil, err
+		}
+		failingMigrations = append(failingMigrations, &migration)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return failingMigrations, nil
+}
+
+func (r *ExasolRepository) GetAppliedMigrations() ([]*database.AppliedMigration, error) {
+	exists, err := r.CheckSchemaHistoryTable()
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		return nil, nil
+	}
+
+	// History tables created by previous versions have no author, ticket and skipped columns until the next run
+	columns, err := r.historyColumns()
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := "CAST(NULL AS VARCHAR(255)), CAST(NULL AS VARCHAR(64))"
+	if columns["author"] && columns["ticket"] {
+		metadata = "author, ticket"
+	}
+
+	skipped := "false"
+	if columns["skipped"] {
+		skipped = "skipped"
+	}
+
+	query := fmt.Sprintf(`
+		SELECT version, description, md5_checksum, success, %s, %s
+		FROM %s
+		ORDER BY version ASC
+	`, metadata, skipped, r.history_table)
+
+	rows, err := r.db.QueryContext(r.ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make([]*database.AppliedMigration, 0)
+	for rows.Next() {
+		migration := new(database.AppliedMigration)
+		author, ticket := sql.NullString{}, sql.NullString{}
+		err := rows.Scan(&migration.Version, &migration.Description, &migration.Checksum, &migration.Success,
+			&author, &ticket, &migration.Skipped)
+		if err != nil {
+			return nil, err
+		}
+		migration.Author, migration.Ticket = author.String, ticket.String
+		applied = append(applied, migration)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return applied, nil
+}
+
+func (r *ExasolRepository) Clean() error {
+	// The lock table is kept, so cleaning inside DoInLock does not release the lock
+	query := `
+		SELECT CASE OBJECT_TYPE
+			WHEN 'TABLE' THEN 'DROP TABLE IF EXISTS "' || OBJECT_NAME || '" CASCADE CONSTRAINTS'
+			WHEN 'VIEW' THEN 'DROP VIEW IF EXISTS "' || OBJECT_NAME || '" CASCADE'
+			ELSE 'DROP ' || OBJECT_TYPE || ' IF EXISTS "' || OBJECT_NAME || '"'
+		END
+		FROM SYS.EXA_ALL_OBJECTS
+		WHERE ROOT_NAME = CURRENT_SCHEMA AND OBJECT_TYPE IN ('VIEW', 'TABLE', 'FUNCTION', 'SCRIPT')
+			AND OBJECT_NAME <> UPPER(?)
+		ORDER BY CASE OBJECT_TYPE WHEN 'VIEW' THEN 1 WHEN 'TABLE' THEN 2 ELSE 3 END
+	`
+
+	rows, err := r.db.QueryContext(r.ctx, query, r.lockTable())
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	statements := make([]string, 0)
+	for rows.Next() {
+		statement := ""
+		if err := rows.Scan(&statement); err != nil {
+			return err
+		}
+		statements = append(statements, statement)
+	}
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	for _, statement := range statements {
+		_, err = r.db.ExecContext(r.ctx, statement)
+		if err != nil {
+			return fmt.Errorf("error executing %q: %w", statement, err)
+		}
+	}
+
+	return nil
+}
+
+// execScript executes a migration or hook script one statement at a time, as the Exasol driver
+// does not accept multiple statements in a single call.
+func (r *ExasolRepository) execScript(script string, skip int) error {
+	for i, statement := range migrations.SplitStatements(script) {
+		if i < skip {
+			continue
+		}
+
+		_, err := r.db.ExecContext(r.ctx, statement)
+		if err != nil {
+			return &database.StatementError{Index: i + 1, Err: fmt.Errorf("statement %d (%s): %w", i+1, firstLine(statement), err)}
+		}
+	}
+
+	return nil
+}
+
+// nullable returns the value as a query parameter, NULL if empty.
+func nullable(value string) any {
+	if value == "" {
+		return nil
+	}
+	return value
+}
+
+func firstLine(statement string) string {
+	line, _, _ := strings.Cut(statement, "\n")
+	return line
+}
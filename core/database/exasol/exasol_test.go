@@ -0,0 +1,391 @@
+package exasol
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/maestro-go/maestro/core/database"
+	"github.com/maestro-go/maestro/core/enums"
+	"github.com/maestro-go/maestro/internal/migrations"
+	testUtils "github.com/maestro-go/maestro/internal/utils/testing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const checksum = "0a52730597fb4ffa01fc117d9e71e3a9"
+
+// newMockRepository returns a repository on a mocked connection, checking that every expected statement was
+// executed once the test ends.
+func newMockRepository(t *testing.T) (*ExasolRepository, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		assert.NoError(t, mock.ExpectationsWereMet())
+		db.Close()
+	})
+
+	return NewExasolRepository(context.Background(), db, testUtils.ToPtr(default_history_table)), mock
+}
+
+func expectTableExists(mock sqlmock.Sqlmock, table string, exists bool) {
+	count := 0
+	if exists {
+		count = 1
+	}
+	mock.ExpectQuery(regexp.QuoteMeta("FROM SYS.EXA_ALL_TABLES")).WithArgs(table).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(count))
+}
+
+func expectHistoryColumns(mock sqlmock.Sqlmock, columns ...string) {
+	rows := sqlmock.NewRows([]string{"column_name"})
+	for _, column := range columns {
+		rows.AddRow(column)
+	}
+	mock.ExpectQuery(regexp.QuoteMeta("FROM SYS.EXA_ALL_COLUMNS")).WithArgs(default_history_table).WillReturnRows(rows)
+}
+
+func upMigration(version uint16, content string) *migrations.Migration {
+	return &migrations.Migration{
+		Version:     version,
+		Description: "abcd",
+		Type:        enums.MIGRATION_UP,
+		Checksum:    testUtils.ToPtr(checksum),
+		Content:     &content,
+		Author:      "Jane Doe <jane@example.com>",
+	}
+}
+
+func TestAssertSchemaHistoryTable(t *testing.T) {
+	repository, mock := newMockRepository(t)
+
+	mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE IF NOT EXISTS schema_history_audit")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE IF NOT EXISTS schema_history (")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	// Tables created by previous versions get the missing columns
+	expectHistoryColumns(mock, "VERSION", "DESCRIPTION", "MD5_CHECKSUM", "SUCCESS", "EXECUTED_AT", "REPAIRED_AT",
+		"NOTES", "RUN_ID")
+	mock.ExpectExec(regexp.QuoteMeta("ALTER TABLE schema_history ADD COLUMN author VARCHAR(255)")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("ALTER TABLE schema_history ADD COLUMN ticket VARCHAR(64)")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("ALTER TABLE schema_history ADD COLUMN skipped BOOLEAN DEFAULT false NOT NULL")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err := repository.AssertSchemaHistoryTable()
+	assert.NoError(t, err)
+}
+
+func TestGetLatestMigration(t *testing.T) {
+	repository, mock := newMockRepository(t)
+
+	expectTableExists(mock, default_history_table, false)
+
+	version, err := repository.GetLatestMigration()
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(0), version)
+
+	expectTableExists(mock, default_history_table, true)
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COALESCE(MAX(version), 0)")).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(40000))
+
+	version, err = repository.GetLatestMigration()
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(40000), version)
+}
+
+func TestValidateMigrations(t *testing.T) {
+	repository, mock := newMockRepository(t)
+
+	local := []*migrations.Migration{upMigration(1, ""), upMigration(2, ""), upMigration(3, "")}
+	local[2].Checksum = testUtils.ToPtr("3d41c8443df34e73867adb149efbb2ea")
+
+	// Version 2 is missing, and the checksum of version 3 changed
+	expectTableExists(mock, default_history_table, true)
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT version, description, md5_checksum, success")).
+		WillReturnRows(sqlmock.NewRows([]string{"version", "description", "md5_checksum", "success"}).
+			AddRow(1, "abcd", checksum, true).
+			AddRow(3, "abcd", checksum, true))
+
+	errs := repository.ValidateMigrations(local)
+	require.Len(t, errs, 2)
+
+	var missingErr *database.MissingVersionError
+	assert.ErrorAs(t, errs[0], &missingErr)
+	assert.Equal(t, uint16(2), missingErr.Version)
+
+	var mismatchErr *database.MismatchError
+	assert.ErrorAs(t, errs[1], &mismatchErr)
+	assert.Equal(t, uint16(3), mismatchErr.Version)
+}
+
+func TestExecuteMigration(t *testing.T) {
+	repository, mock := newMockRepository(t)
+	repository.SetRunInfo(database.RunInfo{ID: "run", MaestroVersion: "test"})
+
+	migration := upMigration(1, "CREATE TABLE test1 (id INT);\nINSERT INTO test1 VALUES (1);")
+
+	// Each statement is executed on its own, then the history is recorded
+	mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE test1 (id INT)")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO test1 VALUES (1)")).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE schema_history")).
+		WithArgs("abcd", checksum, true, "run", migration.Author, nil, false, migration.Version).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO schema_history (")).
+		WithArgs(migration.Version, "abcd", checksum, true, "run", migration.Author, nil, false).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO schema_history_audit")).
+		WithArgs("run", "test", database.AUDIT_UP, migration.Version, "abcd", true).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	errs := repository.ExecuteMigration(migration)
+	assert.Nil(t, errs)
+
+	// The statements executed before the failed one are kept, and the failure is recorded
+	mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE test1 (id INT)")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO test1 VALUES (1)")).WillReturnError(errors.New("constraint violation"))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE schema_history")).
+		WithArgs("abcd", checksum, false, "run", migration.Author, nil, false, migration.Version).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO schema_history_audit")).
+		WithArgs("run", "test", database.AUDIT_UP, migration.Version, "abcd", false).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	errs = repository.ExecuteMigration(migration)
+	require.Len(t, errs, 1)
+
+	var statementErr *database.StatementError
+	require.ErrorAs(t, errs[0], &statementErr)
+	assert.Equal(t, 2, statementErr.Index)
+	assert.ErrorContains(t, errs[0], "statement 2 (INSERT INTO test1 VALUES (1))")
+
+	// Retried migrations skip the statements executed before
+	migration.SkipStatements = 1
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO test1 VALUES (1)")).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE schema_history")).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO schema_history_audit")).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	errs = repository.ExecuteMigration(migration)
+	assert.Nil(t, errs)
+
+	errs = repository.ExecuteMigration(&migrations.Migration{Type: enums.MIGRATION_DOWN})
+	assert.Len(t, errs, 1)
+}
+
+func TestSkipMigration(t *testing.T) {
+	repository, mock := newMockRepository(t)
+
+	migration := upMigration(1, "CREATE TABLE test1 (id INT);")
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE schema_history")).
+		WithArgs("abcd", checksum, true, nil, migration.Author, nil, true, migration.Version).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO schema_history (")).
+		WithArgs(migration.Version, "abcd", checksum, true, nil, migration.Author, nil, true).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO schema_history_audit")).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), database.AUDIT_SKIP, migration.Version, "abcd", true).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := repository.SkipMigration(migration)
+	assert.NoError(t, err)
+}
+
+func TestExecuteAssertion(t *testing.T) {
+	repository, mock := newMockRepository(t)
+
+	hook := &migrations.Hook{Content: testUtils.ToPtr("SELECT * FROM orphans"), Type: enums.HOOK_ASSERTION}
+
+	mock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	assert.NoError(t, repository.ExecuteAssertion(hook))
+
+	mock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows([]string{"ok"}).AddRow(true))
+	assert.NoError(t, repository.ExecuteAssertion(hook))
+
+	mock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows([]string{"ok"}).AddRow(false))
+	assert.EqualError(t, repository.ExecuteAssertion(hook), "assertion failed: query returned false")
+
+	mock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2))
+	assert.EqualError(t, repository.ExecuteAssertion(hook), "assertion failed: query returned 2 rows")
+}
+
+func TestRollbackMigration(t *testing.T) {
+	repository, mock := newMockRepository(t)
+
+	migration := &migrations.Migration{Version: 1, Description: "abcd", Type: enums.MIGRATION_DOWN,
+		Content: testUtils.ToPtr("DROP TABLE test1;")}
+
+	// Versions not applied are not rolled back
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM schema_history WHERE version = ?")).WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+
+	err := repository.RollbackMigration(migration)
+	assert.NoError(t, err)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM schema_history WHERE version = ?")).WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectExec(regexp.QuoteMeta("DROP TABLE test1")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM schema_history")).WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO schema_history_audit")).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), database.AUDIT_DOWN, 1, "abcd", true).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err = repository.RollbackMigration(migration)
+	assert.NoError(t, err)
+}
+
+func TestDoInLock(t *testing.T) {
+	repository, mock := newMockRepository(t)
+
+	expectTableExists(mock, lock_table, false)
+	mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE schema_lock")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("SELECT 1")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("DROP TABLE IF EXISTS schema_lock")).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err := repository.DoInLock(func() error {
+		_, err := repository.db.ExecContext(repository.ctx, "SELECT 1")
+		return err
+	})
+	assert.NoError(t, err)
+
+	expectTableExists(mock, lock_table, true)
+
+	info, err := repository.GetLockInfo()
+	assert.NoError(t, err)
+	assert.True(t, info.Locked)
+
+	// Each history table has its own lock table
+	other := NewExasolRepository(context.Background(), repository.db, testUtils.ToPtr("app_history"))
+	assert.Equal(t, "app_history_lock", other.lockTable())
+}
+
+func TestRepair(t *testing.T) {
+	repository, mock := newMockRepository(t)
+
+	local := []*migrations.Migration{upMigration(1, ""), upMigration(2, "")}
+
+	// The migrations are merged in a transaction
+	expectTableExists(mock, default_history_table, true)
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("MERGE INTO schema_history h")).
+		WithArgs(1, "abcd", checksum, 2, "abcd", checksum).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	errs := repository.Repair(local)
+	assert.Nil(t, errs)
+
+	expectTableExists(mock, default_history_table, true)
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("MERGE INTO schema_history h")).WillReturnError(errors.New("merge failed"))
+	mock.ExpectRollback()
+
+	errs = repository.Repair(local)
+	assert.Len(t, errs, 1)
+}
+
+func TestAnnotate(t *testing.T) {
+	repository, mock := newMockRepository(t)
+
+	expectTableExists(mock, default_history_table, false)
+
+	err := repository.Annotate(1, "note")
+	assert.ErrorIs(t, err, database.ErrNotApplied)
+
+	allColumns := []string{"VERSION", "NOTES", "RUN_ID", "AUTHOR", "TICKET", "SKIPPED"}
+
+	expectTableExists(mock, default_history_table, true)
+	expectHistoryColumns(mock, allColumns...)
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE schema_history SET notes = ? WHERE version = ?")).WithArgs("note", 1).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err = repository.Annotate(1, "note")
+	assert.ErrorIs(t, err, database.ErrNotApplied)
+
+	// Empty notes are removed
+	expectTableExists(mock, default_history_table, true)
+	expectHistoryColumns(mock, allColumns...)
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE schema_history SET notes = ? WHERE version = ?")).WithArgs(nil, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err = repository.Annotate(1, "")
+	assert.NoError(t, err)
+}
+
+func TestGetFailingMigrations(t *testing.T) {
+	repository, mock := newMockRepository(t)
+
+	expectTableExists(mock, default_history_table, true)
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE success = false")).
+		WillReturnRows(sqlmock.NewRows([]string{"version", "description", "md5_checksum"}).
+			AddRow(1, "abcd", checksum).
+			AddRow(3, "abcd", checksum))
+
+	failing, err := repository.GetFailingMigrations()
+	assert.NoError(t, err)
+	require.Len(t, failing, 2)
+	assert.Equal(t, uint16(3), failing[1].Version)
+}
+
+func TestGetAppliedMigrations(t *testing.T) {
+	repository, mock := newMockRepository(t)
+
+	// History tables created by previous versions have no metadata nor skipped columns
+	expectTableExists(mock, default_history_table, true)
+	expectHistoryColumns(mock, "VERSION", "DESCRIPTION", "MD5_CHECKSUM", "SUCCESS")
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT version, description, md5_checksum, success, " +
+		"CAST(NULL AS VARCHAR(255)), CAST(NULL AS VARCHAR(64)), false")).
+		WillReturnRows(sqlmock.NewRows([]string{"version", "description", "md5_checksum", "success", "author",
+			"ticket", "skipped"}).AddRow(1, "abcd", checksum, true, nil, nil, false))
+
+	applied, err := repository.GetAppliedMigrations()
+	assert.NoError(t, err)
+	require.Len(t, applied, 1)
+	assert.Empty(t, applied[0].Author)
+
+	expectTableExists(mock, default_history_table, true)
+	expectHistoryColumns(mock, "VERSION", "AUTHOR", "TICKET", "SKIPPED")
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT version, description, md5_checksum, success, author, ticket, skipped")).
+		WillReturnRows(sqlmock.NewRows([]string{"version", "description", "md5_checksum", "success", "author",
+			"ticket", "skipped"}).AddRow(1, "abcd", checksum, true, "jane", "OPS-1", true))
+
+	applied, err = repository.GetAppliedMigrations()
+	assert.NoError(t, err)
+	require.Len(t, applied, 1)
+	assert.Equal(t, "jane", applied[0].Author)
+	assert.Equal(t, "OPS-1", applied[0].Ticket)
+	assert.True(t, applied[0].Skipped)
+}
+
+func TestClean(t *testing.T) {
+	repository, mock := newMockRepository(t)
+
+	// The lock table is kept
+	mock.ExpectQuery(regexp.QuoteMeta("FROM SYS.EXA_ALL_OBJECTS")).WithArgs(lock_table).
+		WillReturnRows(sqlmock.NewRows([]string{"statement"}).
+			AddRow(`DROP VIEW IF EXISTS "V1" CASCADE`).
+			AddRow(`DROP TABLE IF EXISTS "T1" CASCADE CONSTRAINTS`))
+	mock.ExpectExec(regexp.QuoteMeta(`DROP VIEW IF EXISTS "V1" CASCADE`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`DROP TABLE IF EXISTS "T1" CASCADE CONSTRAINTS`)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err := repository.Clean()
+	assert.NoError(t, err)
+}
+
+func TestDoInTransaction(t *testing.T) {
+	repository, _ := newMockRepository(t)
+
+	// DDL is committed implicitly, so the callback runs without a transaction
+	err := repository.DoInTransaction(func() error {
+		return sql.ErrConnDone
+	})
+	assert.ErrorIs(t, err, sql.ErrConnDone)
+
+	assert.False(t, repository.Capabilities().SupportsTransactions)
+}
@@ -0,0 +1,28 @@
+package database
+
+// StatementPlan is the estimate of the planner of the database for a statement of a script, obtained
+// without executing the statement.
+type StatementPlan struct {
+	Index     int    // Index of the statement in the script, from 1
+	Statement string // Statement, including its leading comments
+	Cost      float64
+	Rows      float64      // Rows returned or changed by the statement
+	Scans     []*TableScan // Full scans of tables by the plan
+	Err       error        // Error of the planner, e.g. on a table created by a previous pending migration
+}
+
+// TableScan is a full scan of a table by a plan.
+type TableScan struct {
+	Table string
+	Rows  float64 // Rows of the table, as estimated by its statistics
+}
+
+// Explainer is a repository able to estimate the plans of the statements of a script (e.g. with EXPLAIN),
+// without executing them.
+type Explainer interface {
+	Repository
+
+	// ExplainScript returns the plans of the DML statements (INSERT, UPDATE, DELETE, MERGE) of the script.
+	// A statement the planner rejects has its Err set, without failing the other statements.
+	ExplainScript(script string) ([]*StatementPlan, error)
+}
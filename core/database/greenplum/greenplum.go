@@ -0,0 +1,246 @@
+package greenplum
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/maestro-go/maestro/core/database"
+	"github.com/maestro-go/maestro/core/database/postgres"
+)
+
+const default_history_table = "schema_history"
+const lock_table = "schema_lock"
+
+// lock_contention_errors are the SQLSTATE codes of the errors of acquiring the lock while another instance
+// creates, holds or drops the lock table.
+var lock_contention_errors = map[string]bool{
+	"23505": true, // unique_violation: the lock row exists, or the table type is created concurrently
+	"42P07": true, // duplicate_table: the table is created concurrently
+	"42P01": true, // undefined_table: the table is dropped between the statements
+}
+
+// lock_interval is the delay between the attempts of acquiring the lock.
+var lock_interval = 5 * time.Second
+
+// GreenplumRepository reuses the PostgreSQL repository, replacing the parts Greenplum handles differently:
+// advisory locks are not reliable across segments, so a lock table is used instead, and the history
+// tables are created with explicit distribution clauses.
+type GreenplumRepository struct {
+	*postgres.PostgresRepository
+	ctx           context.Context
+	db            database.Database
+	history_table string
+	locked        bool
+}
+
+func NewGreenplumRepository(ctx context.Context, db database.Database, history_table *string) *GreenplumRepository {
+	repo := &GreenplumRepository{
+		PostgresRepository: postgres.NewPostgresRepository(ctx, db, history_table),
+		ctx:                ctx,
+		db:                 db,
+	}
+
+	if history_table != nil {
+		repo.history_table = *history_table
+	} else {
+		repo.history_table = default_history_table
+	}
+
+	return repo
+}
+
+func (r *GreenplumRepository) AssertSchemaHistoryTable() error {
+	query := fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			id SERIAL PRIMARY KEY,
+			run_id VARCHAR(64) NOT NULL,
+			maestro_version VARCHAR(32) NOT NULL,
+			direction VARCHAR(4) NOT NULL,
+			version SMALLINT NOT NULL,
+			description VARCHAR(255) NOT NULL,
+			success BOOLEAN NOT NULL,
+			executed_at TIMESTAMP NOT NULL DEFAULT NOW()
+		) DISTRIBUTED BY (id);
+	`, r.history_table+"_audit")
+
+	_, err := r.db.ExecContext(r.ctx, query)
+	if err != nil {
+		return err
+	}
+
+	exists, err := r.CheckSchemaHistoryTable()
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		// The PostgreSQL repository only adds the columns missing in history tables of previous versions
+		return r.PostgresRepository.AssertSchemaHistoryTable()
+	}
+
+	query = fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			version SMALLINT NOT NULL PRIMARY KEY,
+			description VARCHAR(255) NOT NULL,
+			md5_checksum CHAR(32) NOT NULL,
+			success BOOLEAN NOT NULL DEFAULT false,
+			executed_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			repaired_at TIMESTAMP,
+			notes TEXT,
+			run_id VARCHAR(64),
+			author VARCHAR(255),
+			ticket VARCHAR(64),
+			installed_rank BIGINT,
+			skipped BOOLEAN NOT NULL DEFAULT false
+		) DISTRIBUTED BY (version);
+	`, r.history_table)
+
+	_, err = r.db.ExecContext(r.ctx, query)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Session returns a repository sharing the connections of this one, with its own transaction, run info
+// and lock state.
+func (r *GreenplumRepository) Session() database.Repository {
+	session := *r
+	session.PostgresRepository = r.PostgresRepository.Session().(*postgres.PostgresRepository)
+	session.locked = false
+	return &session
+}
+
+func (r *GreenplumRepository) Capabilities() database.Capabilities {
+	capabilities := r.PostgresRepository.Capabilities()
+	capabilities.SupportsAdvisoryLock = false // Lock table
+	return capabilities
+}
+
+// GetLockInfo reports whether the lock table exists. The holder of the lock is not recorded.
+func (r *GreenplumRepository) GetLockInfo() (*database.LockInfo, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM pg_tables
+			WHERE tablename = $1 AND schemaname = current_schema()
+		);
+	`
+
+	exists := false
+	err := r.db.QueryRowContext(r.ctx, query, r.lockTable()).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+
+	return &database.LockInfo{Locked: exists}, nil
+}
+
+// lockTable returns the lock table of the history table, so the migrations of several history tables of
+// the same database do not block each other. The default history table keeps the lock table of previous versions.
+func (r *GreenplumRepository) lockTable() string {
+	if r.history_table == default_history_table {
+		return lock_table
+	}
+	return r.history_table + "_lock"
+}
+
+func (r *GreenplumRepository) DoInLock(fn func() error) error {
+	err := r.lock()
+	if err != nil {
+		return err
+	}
+	r.locked = true
+	defer func() {
+		r.locked = false
+		err = r.unlock()
+		if err != nil {
+			panic(fmt.Errorf("failed to delete lock table: %w", err))
+		}
+	}()
+
+	err = fn()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *GreenplumRepository) Clean() error {
+	err := r.PostgresRepository.Clean()
+	if err != nil {
+		return err
+	}
+
+	if !r.locked {
+		return nil
+	}
+
+	// The lock table was dropped with the rest of the schema
+	acquired, err := r.tryLock()
+	if err != nil {
+		return err
+	}
+
+	if !acquired {
+		return fmt.Errorf("%s was created by another instance while cleaning", r.lockTable())
+	}
+
+	return nil
+}
+
+// This function ensures that only one instance of the application can perform schema migrations at a time.
+// It achieves this by inserting the single row of the lock table, created if it doesn't already exist. If the
+// row exists, it waits for up to 1 minute for the table to be deleted by another instance, indicating that the
+// migration process has completed.
+func (r *GreenplumRepository) lock() error {
+	for range 12 {
+		acquired, err := r.tryLock()
+		if err != nil {
+			return err
+		}
+
+		if acquired {
+			return nil
+		}
+
+		time.Sleep(lock_interval)
+	}
+
+	return fmt.Errorf("timeout while waiting for %s deletion", r.lockTable())
+}
+
+// tryLock creates the lock table and inserts its row, reporting whether the row was inserted. Both statements are
+// atomic, so concurrent instances can not both acquire the lock: the primary key rejects the second row, and the
+// table dropped by the holder between the statements is reported as not acquired.
+func (r *GreenplumRepository) tryLock() (bool, error) {
+	_, err := r.db.ExecContext(r.ctx, fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			unused INT NOT NULL PRIMARY KEY
+		) DISTRIBUTED BY (unused);
+	`, r.lockTable()))
+	if err == nil {
+		_, err = r.db.ExecContext(r.ctx, fmt.Sprintf("INSERT INTO %s (unused) VALUES (1);", r.lockTable()))
+	}
+
+	var sqlErr interface{ SQLState() string }
+	if errors.As(err, &sqlErr) && lock_contention_errors[sqlErr.SQLState()] {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+func (r *GreenplumRepository) unlock() error {
+	_, err := r.db.ExecContext(r.ctx, fmt.Sprintf("DROP TABLE IF EXISTS %s;", r.lockTable()))
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,186 @@
+package greenplum
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	testUtils "github.com/maestro-go/maestro/internal/utils/testing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newMockRepository returns a repository on a mocked connection, checking that every expected statement was
+// executed once the test ends.
+func newMockRepository(t *testing.T) (*GreenplumRepository, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		assert.NoError(t, mock.ExpectationsWereMet())
+		db.Close()
+	})
+
+	interval := lock_interval
+	lock_interval = time.Millisecond
+	t.Cleanup(func() {
+		lock_interval = interval
+	})
+
+	return NewGreenplumRepository(context.Background(), db, nil), mock
+}
+
+func expectTableExists(mock sqlmock.Sqlmock, table string, exists bool) {
+	mock.ExpectQuery(regexp.QuoteMeta("FROM pg_tables")).WithArgs(table).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(exists))
+}
+
+func expectLock(mock sqlmock.Sqlmock, table string, err error) {
+	mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE IF NOT EXISTS " + table + " (")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	insert := mock.ExpectExec(regexp.QuoteMeta("INSERT INTO " + table + " (unused) VALUES (1);"))
+	if err != nil {
+		insert.WillReturnError(err)
+	} else {
+		insert.WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+}
+
+func TestAssertSchemaHistoryTable(t *testing.T) {
+	repository, mock := newMockRepository(t)
+
+	// New history tables are distributed by version
+	mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE IF NOT EXISTS schema_history_audit")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	expectTableExists(mock, default_history_table, false)
+	mock.ExpectExec(`(?s)CREATE TABLE IF NOT EXISTS schema_history \(.*\) DISTRIBUTED BY \(version\);`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err := repository.AssertSchemaHistoryTable()
+	assert.NoError(t, err)
+
+	// Existing history tables are upgraded by the PostgreSQL repository
+	mock.ExpectExec(`(?s)CREATE TABLE IF NOT EXISTS schema_history_audit \(.*\) DISTRIBUTED BY \(id\);`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	expectTableExists(mock, default_history_table, true)
+	mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE IF NOT EXISTS schema_history_audit")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	expectTableExists(mock, default_history_table, true)
+	columns := sqlmock.NewRows([]string{"column_name", "data_type"})
+	for _, column := range []string{"version", "description", "md5_checksum", "success", "executed_at",
+		"repaired_at", "notes", "run_id", "author", "ticket", "installed_rank"} {
+		columns.AddRow(column, "text")
+	}
+	mock.ExpectQuery(regexp.QuoteMeta("FROM information_schema.columns")).WithArgs(default_history_table).
+		WillReturnRows(columns)
+	mock.ExpectExec(regexp.QuoteMeta("ALTER TABLE schema_history ADD COLUMN IF NOT EXISTS skipped")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err = repository.AssertSchemaHistoryTable()
+	assert.NoError(t, err)
+}
+
+func TestDoInLock(t *testing.T) {
+	repository, mock := newMockRepository(t)
+
+	// The lock is held by another instance until the second attempt, when the table is dropped concurrently
+	expectLock(mock, lock_table, &pq.Error{Code: "23505"})
+	expectLock(mock, lock_table, &pq.Error{Code: "42P01"})
+	expectLock(mock, lock_table, nil)
+	mock.ExpectExec(regexp.QuoteMeta("DROP TABLE IF EXISTS schema_lock;")).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	called := false
+	err := repository.DoInLock(func() error {
+		called = true
+		assert.True(t, repository.locked)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.True(t, called)
+	assert.False(t, repository.locked)
+
+	// Other errors are not retried
+	expectLock(mock, lock_table, errors.New("permission denied"))
+
+	err = repository.DoInLock(func() error {
+		t.Fatal("callback called without the lock")
+		return nil
+	})
+	assert.EqualError(t, err, "permission denied")
+}
+
+func TestDoInLockTimeout(t *testing.T) {
+	repository, mock := newMockRepository(t)
+
+	for range 12 {
+		expectLock(mock, lock_table, &pq.Error{Code: "23505"})
+	}
+
+	err := repository.DoInLock(func() error {
+		return nil
+	})
+	assert.EqualError(t, err, "timeout while waiting for schema_lock deletion")
+}
+
+func TestLockTable(t *testing.T) {
+	repository, mock := newMockRepository(t)
+
+	// Each history table has its own lock table
+	other := NewGreenplumRepository(context.Background(), repository.db, testUtils.ToPtr("app_history"))
+	assert.Equal(t, "app_history_lock", other.lockTable())
+
+	expectTableExists(mock, "app_history_lock", true)
+
+	info, err := other.GetLockInfo()
+	assert.NoError(t, err)
+	assert.True(t, info.Locked)
+}
+
+func TestCleanInLock(t *testing.T) {
+	repository, mock := newMockRepository(t)
+
+	expectLock(mock, lock_table, nil)
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT 'DROP MATERIALIZED VIEW IF EXISTS '")).
+		WillReturnRows(sqlmock.NewRows([]string{"statement"}).AddRow("DROP TABLE IF EXISTS schema_lock CASCADE"))
+	mock.ExpectExec(regexp.QuoteMeta("DROP TABLE IF EXISTS schema_lock CASCADE")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	// The lock dropped with the schema is acquired again
+	expectLock(mock, lock_table, nil)
+	mock.ExpectExec(regexp.QuoteMeta("DROP TABLE IF EXISTS schema_lock;")).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err := repository.DoInLock(repository.Clean)
+	assert.NoError(t, err)
+
+	// Outside of the lock, the lock table is not created
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT 'DROP MATERIALIZED VIEW IF EXISTS '")).
+		WillReturnRows(sqlmock.NewRows([]string{"statement"}))
+
+	err = repository.Clean()
+	assert.NoError(t, err)
+}
+
+func TestSession(t *testing.T) {
+	repository, mock := newMockRepository(t)
+
+	expectLock(mock, lock_table, nil)
+	// Cleaning in a session does not acquire the lock again
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT 'DROP MATERIALIZED VIEW IF EXISTS '")).
+		WillReturnRows(sqlmock.NewRows([]string{"statement"}))
+	mock.ExpectExec(regexp.QuoteMeta("DROP TABLE IF EXISTS schema_lock;")).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err := repository.DoInLock(func() error {
+		// Sessions do not hold the lock of the repository, nor share its PostgreSQL repository
+		session := repository.Session().(*GreenplumRepository)
+		assert.False(t, session.locked)
+		assert.NotSame(t, repository.PostgresRepository, session.PostgresRepository)
+		assert.Equal(t, repository.history_table, session.history_table)
+
+		return session.Clean()
+	})
+	assert.NoError(t, err)
+
+	assert.False(t, repository.Capabilities().SupportsAdvisoryLock)
+}
@@ -0,0 +1,33 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// HistoryRanks returns the highest installed rank of the history table, and the versions it records.
+// The migrations inserted in the history without being executed, e.g. by Repair, are ranked after it.
+func HistoryRanks(ctx context.Context, queriable Queriable, table string) (int64, map[uint16]bool, error) {
+	query := fmt.Sprintf("SELECT version, COALESCE(installed_rank, 0) FROM %s;", table)
+	rows, err := queriable.QueryContext(ctx, query)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer rows.Close()
+
+	maxRank := int64(0)
+	recorded := make(map[uint16]bool)
+	for rows.Next() {
+		var version uint16
+		var rank int64
+		err = rows.Scan(&version, &rank)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		recorded[version] = true
+		maxRank = max(maxRank, rank)
+	}
+
+	return maxRank, recorded, rows.Err()
+}
@@ -0,0 +1,154 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/maestro-go/maestro/internal/conf"
+)
+
+// ColumnFamily is a family of database types compatible with a column of the schema history table.
+type ColumnFamily int
+
+const (
+	COLUMN_INTEGER ColumnFamily = iota
+	COLUMN_TEXT
+	COLUMN_BOOLEAN
+	COLUMN_TIMESTAMP
+)
+
+// columnFamilyNames are the names of the families in error messages.
+var columnFamilyNames = map[ColumnFamily]string{
+	COLUMN_INTEGER:   "an integer type",
+	COLUMN_TEXT:      "a text type",
+	COLUMN_BOOLEAN:   "a boolean type",
+	COLUMN_TIMESTAMP: "a timestamp type",
+}
+
+// columnFamilyTypes are the words found in the lowercased database types of each family, e.g. "smallint" or
+// "character varying". Booleans are small integers on some databases.
+var columnFamilyTypes = map[ColumnFamily][]string{
+	COLUMN_INTEGER:   {"int", "serial", "number", "numeric", "decimal"},
+	COLUMN_TEXT:      {"char", "text", "string", "clob"},
+	COLUMN_BOOLEAN:   {"bool", "bit", "tinyint", "number"},
+	COLUMN_TIMESTAMP: {"timestamp", "datetime", "date"},
+}
+
+// HistoryColumn is a column of the schema history table expected by this version of maestro.
+type HistoryColumn struct {
+	Name       string
+	Family     ColumnFamily
+	Type       string // Type of the column in the statements upgrading the table, e.g. "SMALLINT"
+	Definition string // Definition of the column added to the table, e.g. "CHAR(32) NOT NULL DEFAULT ''"
+	Optional   bool   // Added after the first release, and by AssertSchemaHistoryTable to the tables missing it
+}
+
+// HistorySchemaError reports the columns of the schema history table missing or having a type incompatible
+// with the ones expected by this version of maestro, e.g. for a table altered by hand or created by another tool.
+type HistorySchemaError struct {
+	Table    string
+	Problems []string // e.g. "column md5_checksum is missing"
+	Upgrade  []string // Statements upgrading the table, empty if one of the columns can not be upgraded
+}
+
+func (e *HistorySchemaError) Error() string {
+	message := fmt.Sprintf("schema history table %s is not compatible with maestro %s: %s", e.Table, conf.VERSION,
+		strings.Join(e.Problems, ", "))
+
+	if len(e.Upgrade) > 0 {
+		return message + ". Upgrade it with: " + strings.Join(e.Upgrade, " ")
+	}
+	return message + ". Recreate it with the expected columns, or configure another history-table"
+}
+
+// HistorySchemaChecker is a repository able to compare the columns of its schema history table with the ones
+// expected by this version of maestro, so incompatible tables are reported before anything is recorded in them
+// instead of failing with a driver-specific error in the middle of a run.
+type HistorySchemaChecker interface {
+	Repository
+
+	// CheckHistorySchema returns a *HistorySchemaError if columns of the schema history table are missing or
+	// have incompatible types. Missing optional columns are not reported, as AssertSchemaHistoryTable adds them.
+	// Returns nil if the table does not exist.
+	CheckHistorySchema() error
+}
+
+// CompareHistoryColumns compares the columns of the schema history table, their lowercased database types by
+// their lowercased names, with the expected columns. The statement upgrading each incompatible column is
+// returned by upgrade, given whether the column is missing, or an empty string if it can not be upgraded.
+// Columns without type (e.g. with SQLite) are compatible with every family.
+// Returns a *HistorySchemaError if a column is incompatible, nil otherwise.
+func CompareHistoryColumns(table string, columns map[string]string, expected []*HistoryColumn,
+	upgrade func(column *HistoryColumn, missing bool) string) error {
+
+	schemaErr := &HistorySchemaError{Table: table}
+	upgradable := true
+
+	for _, column := range expected {
+		columnType, exists := columns[column.Name]
+
+		switch {
+		case !exists && column.Optional:
+			continue
+		case !exists:
+			schemaErr.Problems = append(schemaErr.Problems, fmt.Sprintf("column %s is missing", column.Name))
+		case columnType == "" || hasFamily(columnType, column.Family):
+			continue
+		default:
+			schemaErr.Problems = append(schemaErr.Problems, fmt.Sprintf("column %s has type %s instead of %s",
+				column.Name, columnType, columnFamilyNames[column.Family]))
+		}
+
+		// The version is the primary key of the rows, which can not get one once the column is added
+		statement := ""
+		if exists || column.Name != "version" {
+			statement = upgrade(column, !exists)
+		}
+		upgradable = upgradable && statement != ""
+		schemaErr.Upgrade = append(schemaErr.Upgrade, statement)
+	}
+
+	if len(schemaErr.Problems) == 0 {
+		return nil
+	}
+
+	if !upgradable {
+		schemaErr.Upgrade = nil
+	}
+	return schemaErr
+}
+
+// HistoryCopyColumns returns the expected columns copied from a history table to another one, given the
+// columns of both tables by lowercased name, and the values selected from the first table for each of them.
+// The installed ranks missing in the first table are set in the order of the executions.
+func HistoryCopyColumns(expected []*HistoryColumn, from map[string]string, to map[string]string) ([]string, []string) {
+	columns, values := make([]string, 0, len(expected)), make([]string, 0, len(expected))
+
+	for _, column := range expected {
+		if _, ok := to[column.Name]; !ok {
+			continue
+		}
+
+		_, ok := from[column.Name]
+		switch {
+		case ok:
+			values = append(values, column.Name)
+		case column.Name == "installed_rank":
+			values = append(values, "ROW_NUMBER() OVER (ORDER BY executed_at, version)")
+		default:
+			continue
+		}
+		columns = append(columns, column.Name)
+	}
+
+	return columns, values
+}
+
+func hasFamily(columnType string, family ColumnFamily) bool {
+	for _, word := range columnFamilyTypes[family] {
+		if strings.Contains(columnType, word) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,84 @@
+package database
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompareHistoryColumns(t *testing.T) {
+	expected := []*HistoryColumn{
+		{Name: "version", Family: COLUMN_INTEGER, Type: "SMALLINT", Definition: "SMALLINT NOT NULL"},
+		{Name: "md5_checksum", Family: COLUMN_TEXT, Type: "CHAR(32)", Definition: "CHAR(32) NOT NULL DEFAULT ''"},
+		{Name: "success", Family: COLUMN_BOOLEAN, Type: "BOOLEAN", Definition: "BOOLEAN NOT NULL DEFAULT false"},
+		{Name: "executed_at", Family: COLUMN_TIMESTAMP, Type: "TIMESTAMP", Definition: "TIMESTAMP NOT NULL"},
+		{Name: "notes", Family: COLUMN_TEXT, Type: "TEXT", Definition: "TEXT", Optional: true},
+	}
+	upgrade := func(column *HistoryColumn, missing bool) string {
+		if missing {
+			return fmt.Sprintf("ADD %s %s;", column.Name, column.Definition)
+		}
+		return fmt.Sprintf("ALTER %s %s;", column.Name, column.Type)
+	}
+
+	// Types of other databases are compatible, and optional columns may be missing
+	err := CompareHistoryColumns("history", map[string]string{
+		"version":      "smallint unsigned",
+		"md5_checksum": "character",
+		"success":      "tinyint",
+		"executed_at":  "timestamp without time zone",
+	}, expected, upgrade)
+	assert.NoError(t, err)
+
+	err = CompareHistoryColumns("history", map[string]string{
+		"version":     "integer",
+		"success":     "character varying",
+		"executed_at": "",
+		"notes":       "integer",
+	}, expected, upgrade)
+
+	var schemaErr *HistorySchemaError
+	assert.ErrorAs(t, err, &schemaErr)
+	assert.Equal(t, []string{
+		"column md5_checksum is missing",
+		"column success has type character varying instead of a boolean type",
+		"column notes has type integer instead of a text type",
+	}, schemaErr.Problems)
+	assert.Equal(t, []string{"ADD md5_checksum CHAR(32) NOT NULL DEFAULT '';", "ALTER success BOOLEAN;",
+		"ALTER notes TEXT;"}, schemaErr.Upgrade)
+	assert.Contains(t, err.Error(), ". Upgrade it with: ADD md5_checksum")
+
+	// Tables without version column can not be upgraded
+	err = CompareHistoryColumns("history", map[string]string{}, expected, upgrade)
+	assert.ErrorAs(t, err, &schemaErr)
+	assert.Empty(t, schemaErr.Upgrade)
+	assert.ErrorContains(t, err, "column version is missing, column md5_checksum is missing")
+	assert.ErrorContains(t, err, "Recreate it with the expected columns, or configure another history-table")
+}
+
+func TestHistoryCopyColumns(t *testing.T) {
+	expected := []*HistoryColumn{
+		{Name: "version"},
+		{Name: "md5_checksum"},
+		{Name: "executed_at"},
+		{Name: "notes", Optional: true},
+		{Name: "installed_rank", Optional: true},
+	}
+
+	// Table of a previous version copied to a new one
+	columns, values := HistoryCopyColumns(expected,
+		map[string]string{"version": "smallint", "md5_checksum": "character", "executed_at": "timestamp", "custom": "text"},
+		map[string]string{"version": "smallint", "md5_checksum": "character", "executed_at": "timestamp",
+			"notes": "text", "installed_rank": "bigint"})
+	assert.Equal(t, []string{"version", "md5_checksum", "executed_at", "installed_rank"}, columns)
+	assert.Equal(t, []string{"version", "md5_checksum", "executed_at",
+		"ROW_NUMBER() OVER (ORDER BY executed_at, version)"}, values)
+
+	// New table copied to the one of a previous version
+	columns, values = HistoryCopyColumns(expected,
+		map[string]string{"version": "smallint", "md5_checksum": "character", "notes": "text", "installed_rank": "bigint"},
+		map[string]string{"version": "smallint", "md5_checksum": "character"})
+	assert.Equal(t, []string{"version", "md5_checksum"}, columns)
+	assert.Equal(t, columns, values)
+}
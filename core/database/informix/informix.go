@@ -0,0 +1,913 @@
+// Package informix implements the maestro repository for Informix.
+//
+// The package does not import a database driver: open the connection with a database/sql driver
+// for Informix (for example, an ODBC driver) and pass it to NewInformixRepository.
+package informix
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/maestro-go/maestro/core/database"
+	"github.com/maestro-go/maestro/core/enums"
+	"github.com/maestro-go/maestro/internal/conf"
+	"github.com/maestro-go/maestro/internal/migrations"
+)
+
+const default_history_table = "schema_history"
+const lock_table = "schema_lock"
+
+// repair_batch_size is the number of migrations merged per statement by Repair, keeping the
+// statements short.
+const repair_batch_size = 100
+
+// history_columns are the columns added to the history table after its first release, added by
+// upgradeHistoryTable to the tables created by previous versions.
+var history_columns = []struct{ name, definition string }{
+	{"notes", "LVARCHAR(2048)"},
+	{"run_id", "VARCHAR(64)"},
+	{"author", "VARCHAR(255)"},
+	{"ticket", "VARCHAR(64)"},
+	{"skipped", "BOOLEAN DEFAULT 'f' NOT NULL"},
+}
+
+// InformixRepository executes scripts statement by statement, keeping SPL routines
+// (CREATE PROCEDURE ... END PROCEDURE) in a single statement. The database must be created
+// with logging, so DDL can run inside transactions.
+type InformixRepository struct {
+	database.Repository
+	ctx           context.Context
+	queriable     database.Queriable
+	db            database.Database
+	history_table string
+	run           database.RunInfo
+}
+
+func NewInformixRepository(ctx context.Context, db database.Database, history_table *string) *InformixRepository {
+	repo := &InformixRepository{
+		ctx:       ctx,
+		queriable: db,
+		db:        db,
+		run:       database.RunInfo{MaestroVersion: conf.VERSION},
+	}
+
+	if history_table != nil {
+		repo.history_table = *history_table
+	} else {
+		repo.history_table = default_history_table
+	}
+
+	return repo
+}
+
+func (r *InformixRepository) GetLatestMigration() (uint16, error) {
+	tableExists, err := r.CheckSchemaHistoryTable()
+	if err != nil {
+		return 0, err
+	}
+
+	if !tableExists {
+		return 0, nil
+	}
+
+	query := fmt.Sprintf(`
+		SELECT NVL(MAX(version), 0)
+		FROM %s
+		WHERE success = 't'
+	`, r.history_table)
+
+	version := uint16(0)
+	err = r.queriable.QueryRowContext(r.ctx, query).Scan(&version)
+	if err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+func (r *InformixRepository) AssertSchemaHistoryTable() error {
+	query := fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			id SERIAL NOT NULL PRIMARY KEY,
+			run_id VARCHAR(64) NOT NULL,
+			maestro_version VARCHAR(32) NOT NULL,
+			direction VARCHAR(4) NOT NULL,
+			version SMALLINT NOT NULL,
+			description VARCHAR(255) NOT NULL,
+			success BOOLEAN NOT NULL,
+			executed_at DATETIME YEAR TO FRACTION(3) DEFAULT CURRENT YEAR TO FRACTION(3) NOT NULL
+		)
+	`, r.auditTable())
+
+	_, err := r.queriable.ExecContext(r.ctx, query)
+	if err != nil {
+		return err
+	}
+
+	query = fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			version SMALLINT NOT NULL PRIMARY KEY,
+			description VARCHAR(255) NOT NULL,
+			md5_checksum CHAR(32) NOT NULL,
+			success BOOLEAN DEFAULT 'f' NOT NULL,
+			executed_at DATETIME YEAR TO FRACTION(3) DEFAULT CURRENT YEAR TO FRACTION(3) NOT NULL,
+			repaired_at DATETIME YEAR TO FRACTION(3),
+			notes LVARCHAR(2048),
+			run_id VARCHAR(64),
+			author VARCHAR(255),
+			ticket VARCHAR(64),
+			skipped BOOLEAN DEFAULT 'f' NOT NULL
+		)
+	`, r.history_table)
+
+	_, err = r.queriable.ExecContext(r.ctx, query)
+	if err != nil {
+		return err
+	}
+
+	return r.upgradeHistoryTable()
+}
+
+// upgradeHistoryTable adds the columns missing in history tables created by previous versions.
+func (r *InformixRepository) upgradeHistoryTable() error {
+	columns, err := r.historyColumns()
+	if err != nil {
+		return err
+	}
+
+	for _, column := range history_columns {
+		if columns[column.name] {
+			continue
+		}
+
+		_, err = r.queriable.ExecContext(r.ctx, fmt.Sprintf("ALTER TABLE %s ADD (%s %s)", r.history_table,
+			column.name, column.definition))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// historyColumns returns the columns of the history table.
+func (r *InformixRepository) historyColumns() (map[string]bool, error) {
+	query := `
+		SELECT c.colname FROM syscolumns c, systables t
+		WHERE c.tabid = t.tabid AND t.tabname = LOWER(?)
+	`
+
+	rows, err := r.queriable.QueryContext(r.ctx, query, r.history_table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := map[string]bool{}
+	for rows.Next() {
+		var column string
+		err = rows.Scan(&column)
+		if err != nil {
+			return nil, err
+		}
+		columns[strings.TrimSpace(column)] = true
+	}
+
+	return columns, rows.Err()
+}
+
+func (r *InformixRepository) CheckSchemaHistoryTable() (bool, error) {
+	return r.tableExists(r.queriable, r.history_table)
+}
+
+func (r *InformixRepository) tableExists(queriable database.Queriable, table string) (bool, error) {
+	// Unquoted identifiers are stored in lower case
+	query := `
+		SELECT COUNT(*) FROM systables
+		WHERE tabname = LOWER(?) AND tabtype = 'T'
+	`
+
+	count := 0
+	err := queriable.QueryRowContext(r.ctx, query, table).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+func (r *InformixRepository) ValidateMigrations(localMigrations []*migrations.Migration) []error {
+	if len(localMigrations) < 1 {
+		return nil
+	}
+
+	tableExists, err := r.CheckSchemaHistoryTable()
+	if err != nil {
+		return []error{err}
+	}
+
+	if !tableExists {
+		return nil
+	}
+
+	byVersion := make(map[uint16]*migrations.Migration, len(localMigrations))
+	for _, migration := range localMigrations {
+		if migration.Type != enums.MIGRATION_UP {
+			return []error{fmt.Errorf("invalid migration type: %s", migration.Type.Name())}
+		}
+		byVersion[migration.Version] = migration
+	}
+
+	query := fmt.Sprintf(`
+		SELECT version, description, md5_checksum, success
+		FROM %s
+		ORDER BY version ASC
+	`, r.history_table)
+
+	rows, err := r.queriable.QueryContext(r.ctx, query)
+	if err != nil {
+		return []error{err}
+	}
+	defer rows.Close()
+
+	errs := make([]error, 0)
+	expectedVersion := uint16(1)
+
+	for rows.Next() {
+		version, description, checksum, success := uint16(0), "", "", false
+		err = rows.Scan(&version, &description, &checksum, &success)
+		if err != nil {
+			return []error{err}
+		}
+
+		// Check gaps
+		if expectedVersion != version {
+			errs = append(errs, &database.MissingVersionError{Version: expectedVersion})
+		}
+		expectedVersion = version + 1
+
+		// Check description or checksum mismatch
+		local, ok := byVersion[version]
+		if success && (!ok || local.Description != description || *local.Checksum != checksum) {
+			errs = append(errs, &database.MismatchError{Version: version, Description: description, Checksum: checksum})
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return []error{err}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (r *InformixRepository) ExecuteMigration(migration *migrations.Migration) []error {
+	if migration.Type != enums.MIGRATION_UP {
+		return []error{fmt.Errorf("invalid migration type: %s", migration.Type.Name())}
+	}
+
+	errs := make([]error, 0)
+
+	err := r.execScript(*migration.Content, migration.SkipStatements)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	success := err == nil
+
+	err = r.saveHistory(migration, success, false)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("migration %d: %w", migration.Version, err))
+	} else {
+		err = r.audit(migration, database.AUDIT_UP, success)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("migration %d: %w", migration.Version, err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// SkipMigration records the migration as applied and skipped in the history table without executing it, and
+// records the skip in the audit table.
+func (r *InformixRepository) SkipMigration(migration *migrations.Migration) error {
+	if migration.Type != enums.MIGRATION_UP {
+		return fmt.Errorf("invalid migration type: %s", migration.Type.Name())
+	}
+
+	err := r.saveHistory(migration, true, true)
+	if err != nil {
+		return fmt.Errorf("migration %d: %w", migration.Version, err)
+	}
+
+	return r.audit(migration, database.AUDIT_SKIP, true)
+}
+
+// saveHistory updates the history row of the migration, inserting it if it does not exist yet, with the given
+// status and whether it was skipped without being executed.
+func (r *InformixRepository) saveHistory(migration *migrations.Migration, success bool, skipped bool) error {
+	query := fmt.Sprintf(`
+		UPDATE %s
+		SET description = ?, md5_checksum = ?, success = ?, run_id = ?, author = ?, ticket = ?, skipped = ?,
+			executed_at = CURRENT YEAR TO FRACTION(3)
+		WHERE version = ?
+	`, r.history_table)
+
+	res, err := r.queriable.ExecContext(r.ctx, query, migration.Description, *migration.Checksum,
+		booleanLiteral(success), nullable(r.run.ID), nullable(migration.Author), nullable(migration.Ticket),
+		booleanLiteral(skipped), migration.Version)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected > 0 {
+		return nil
+	}
+
+	query = fmt.Sprintf(`
+		INSERT INTO %s (version, description, md5_checksum, success, run_id, author, ticket, skipped)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, r.history_table)
+
+	_, err = r.queriable.ExecContext(r.ctx, query, migration.Version, migration.Description,
+		*migration.Checksum, booleanLiteral(success), nullable(r.run.ID), nullable(migration.Author),
+		nullable(migration.Ticket), booleanLiteral(skipped))
+	return err
+}
+
+func (r *InformixRepository) ExecuteHook(hook *migrations.Hook) error {
+	return r.execScript(*hook.Content, 0)
+}
+
+func (r *InformixRepository) ExecuteAssertion(hook *migrations.Hook) error {
+	rows, err := r.queriable.QueryContext(r.ctx, *hook.Content)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+
+	rowsCount := 0
+	isBool, isTrue := false, false
+	for rows.Next() {
+		rowsCount++
+		if rowsCount == 1 && len(columns) == 1 {
+			var value any
+			if err := rows.Scan(&value); err != nil {
+				return err
+			}
+			isTrue, isBool = parseBoolean(value)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if rowsCount == 0 || (rowsCount == 1 && isTrue) {
+		return nil
+	}
+
+	if rowsCount == 1 && isBool {
+		return fmt.Errorf("assertion failed: query returned false")
+	}
+
+	return fmt.Errorf("assertion failed: query returned %d rows", rowsCount)
+}
+
+func (r *InformixRepository) RollbackMigration(migration *migrations.Migration) error {
+	if migration.Type != enums.MIGRATION_DOWN {
+		return fmt.Errorf("invalid migration type: %s", migration.Type.Name())
+	}
+
+	query := fmt.Sprintf(`
+		SELECT COUNT(*) FROM %s WHERE version = ?
+	`, r.history_table)
+
+	count := 0
+	err := r.queriable.QueryRowContext(r.ctx, query, migration.Version).Scan(&count)
+	if err != nil {
+		return err
+	}
+
+	if count < 1 {
+		return nil
+	}
+
+	err = r.execScript(*migration.Content, 0)
+	if err != nil {
+		return err
+	}
+
+	query = fmt.Sprintf(`
+		DELETE FROM %s
+		WHERE version = ?
+	`, r.history_table)
+
+	res, err := r.queriable.ExecContext(r.ctx, query, migration.Version)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected < 1 {
+		return fmt.Errorf("version was not deleted from \"%s\" table", r.history_table)
+	}
+
+	return r.audit(migration, database.AUDIT_DOWN, true)
+}
+
+func (r *InformixRepository) ServerInfo() (*database.ServerInfo, error) {
+	info := &database.ServerInfo{HistoryTable: r.history_table}
+
+	err := r.queriable.QueryRowContext(r.ctx, `
+		SELECT DBINFO('version', 'full'), TRIM(DBINFO('dbname'))
+		FROM systables WHERE tabid = 1
+	`).Scan(&info.Version, &info.Schema)
+	if err != nil {
+		return nil, err
+	}
+
+	info.HistoryTableExists, err = r.CheckSchemaHistoryTable()
+	if err != nil || !info.HistoryTableExists {
+		return info, err
+	}
+
+	query := fmt.Sprintf("SELECT COUNT(*) FROM %s", r.history_table)
+	err = r.queriable.QueryRowContext(r.ctx, query).Scan(&info.HistoryRows)
+	if err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
+
+func (r *InformixRepository) Capabilities() database.Capabilities {
+	return database.Capabilities{
+		SupportsTransactions:   true,
+		SupportsAdvisoryLock:   false,
+		SupportsMultiStatement: false,
+		MaxIdentifierLength:    128,
+	}
+}
+
+func (r *InformixRepository) SetRunInfo(info database.RunInfo) {
+	r.run = info
+}
+
+func (r *InformixRepository) auditTable() string {
+	return r.history_table + "_audit"
+}
+
+// audit records the execution of the migration in the audit table.
+func (r *InformixRepository) audit(migration *migrations.Migration, direction string, success bool) error {
+	query := fmt.Sprintf(`
+		INSERT INTO %s (run_id, maestro_version, direction, version, description, success)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, r.auditTable())
+
+	_, err := r.queriable.ExecContext(r.ctx, query, r.run.ID, r.run.MaestroVersion, direction,
+		migration.Version, migration.Description, booleanLiteral(success))
+	if err != nil {
+		return fmt.Errorf("error recording audit: %w", err)
+	}
+
+	return nil
+}
+
+func (r *InformixRepository) DoInTransaction(fn func() error) error {
+	tx, err := r.db.BeginTx(r.ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		tx.Rollback()
+		r.queriable = r.db // Always reset queriable to db
+	}()
+
+	r.queriable = tx
+
+	err = fn()
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *InformixRepository) DoOutsideTransaction(fn func() error) error {
+	if _, ok := r.queriable.(*sql.Tx); ok && database.SingleConnection(r.db) {
+		return errors.New("cannot run outside of the transaction with a single connection")
+	}
+
+	queriable := r.queriable
+	defer func() {
+		r.queriable = queriable
+	}()
+
+	r.queriable = r.db
+
+	return fn()
+}
+
+// Session returns a repository sharing the connections of this one, with its own transaction and run info.
+func (r *InformixRepository) Session() database.Repository {
+	session := *r
+	session.queriable = r.db // Outside of the transaction of this repository
+	return &session
+}
+
+// GetLockInfo reports whether the lock table exists. The holder of the lock is not recorded.
+func (r *InformixRepository) GetLockInfo() (*database.LockInfo, error) {
+	exists, err := r.tableExists(r.db, r.lockTable())
+	if err != nil {
+		return nil, err
+	}
+
+	return &database.LockInfo{Locked: exists}, nil
+}
+
+// lockTable returns the lock table of the history table, so the migrations of several history tables of
+// the same database do not block each other. The default history table keeps the lock table of previous versions.
+func (r *InformixRepository) lockTable() string {
+	if r.history_table == default_history_table {
+		return lock_table
+	}
+	return r.history_table + "_lock"
+}
+
+func (r *InformixRepository) DoInLock(fn func() error) error {
+	err := r.lock()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = r.unlock()
+		if err != nil {
+			panic(fmt.Errorf("failed to delete lock table: %w", err))
+		}
+	}()
+
+	err = fn()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// This function ensures that only one instance of the application can perform schema migrations at a time.
+// It achieves this by creating a lock table if it doesn't already exist. If the table exists,
+// it waits for up to 1 minute for the table to be deleted by another instance, indicating that the migration
+// process has completed.
+func (r *InformixRepository) lock() error {
+	for range 12 {
+		exists, err := r.tableExists(r.db, r.lockTable())
+		if err != nil {
+			return err
+		}
+
+		if !exists {
+			_, err = r.db.ExecContext(r.ctx, fmt.Sprintf(`
+				CREATE TABLE %s (
+					unused INT NOT NULL PRIMARY KEY
+				)
+			`, r.lockTable()))
+			if err != nil {
+				return err
+			}
+
+			return nil
+		}
+
+		time.Sleep(time.Second * 5) // Delays 5 seconds
+	}
+
+	return fmt.Errorf("timeout while waiting for %s deletion", r.lockTable())
+}
+
+func (r *InformixRepository) unlock() error {
+	_, err := r.db.ExecContext(r.ctx, fmt.Sprintf("DROP TABLE IF EXISTS %s", r.lockTable()))
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *InformixRepository) Repair(migrations []*migrations.Migration) []error {
+	tableExists, err := r.CheckSchemaHistoryTable()
+	if err != nil {
+		return []error{err}
+	}
+
+	if !tableExists {
+		return nil
+	}
+
+	err = r.inTransaction(func() error {
+		for _, batch := range database.Batches(migrations, repair_batch_size) {
+			rows := make([]string, 0, len(batch))
+			args := make([]any, 0, len(batch)*3)
+			for _, migration := range batch {
+				rows = append(rows, "SELECT CAST(? AS SMALLINT) AS version, CAST(? AS VARCHAR(255)) AS description, "+
+					"CAST(? AS CHAR(32)) AS md5_checksum FROM sysmaster:sysdual")
+				args = append(args, migration.Version, migration.Description, *migration.Checksum)
+			}
+
+			query := fmt.Sprintf(`
+				MERGE INTO %s h
+				USING (%s) l
+				ON (h.version = l.version)
+				WHEN MATCHED THEN UPDATE SET
+					repaired_at = CASE
+						WHEN l.description <> h.description OR l.md5_checksum <> h.md5_checksum
+						THEN CURRENT YEAR TO FRACTION(3)
+						ELSE h.repaired_at
+					END,
+					description = l.description, md5_checksum = l.md5_checksum, success = 't'
+				WHEN NOT MATCHED THEN INSERT (version, description, md5_checksum, success, repaired_at)
+					VALUES (l.version, l.description, l.md5_checksum, 't', CURRENT YEAR TO FRACTION(3))
+			`, r.history_table, strings.Join(rows, " UNION ALL "))
+
+			_, err := r.queriable.ExecContext(r.ctx, query, args...)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return []error{err}
+	}
+
+	return nil
+}
+
+// inTransaction runs the callback in the transaction started by DoInTransaction, or in a new one.
+func (r *InformixRepository) inTransaction(fn func() error) error {
+	if _, ok := r.queriable.(*sql.Tx); ok {
+		return fn()
+	}
+	return r.DoInTransaction(fn)
+}
+
+// Annotate sets the note of the version in the notes column of the history table, added if missing.
+func (r *InformixRepository) Annotate(version uint16, note string) error {
+	exists, err := r.CheckSchemaHistoryTable()
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return fmt.Errorf("version %d: %w", version, database.ErrNotApplied)
+	}
+
+	// History tables created by previous versions have no notes column
+	err = r.upgradeHistoryTable()
+	if err != nil {
+		return err
+	}
+
+	var value any
+	if note != "" {
+		value = note
+	}
+
+	res, err := r.queriable.ExecContext(r.ctx, fmt.Sprintf("UPDATE %s SET notes = ? WHERE version = ?", r.history_table),
+		value, version)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected < 1 {
+		return fmt.Errorf("version %d: %w", version, database.ErrNotApplied)
+	}
+
+	return nil
+}
+
+func (r *InformixRepository) GetFailingMigrations() ([]*migrations.Migration, error) {
+	exists, err := r.CheckSchemaHistoryTable()
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		return nil, nil
+	}
+
+	query := fmt.Sprintf(`
+		SELECT version, description, md5_checksum
+		FROM %s
+		WHERE success = 'f'
+	`, r.history_table)
+
+	rows, err := r.queriable.QueryContext(r.ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var failingMigrations []*migrations.Migration
+	for rows.Next() {
+		var migration migrations.Migration
+		if err := rows.Scan(&migration.Version, &migration.Description, &migration.Checksum); err != nil {
+			return nil, err
+		}
+		failingMigrations = append(failingMigrations, &migration)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return failingMigrations, nil
+}
+
+func (r *InformixRepository) GetAppliedMigrations() ([]*database.AppliedMigration, error) {
+	exists, err := r.CheckSchemaHistoryTable()
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		return nil, nil
+	}
+
+	// History tables created by previous versions have no author, ticket and skipped columns until the next run
+	columns, err := r.historyColumns()
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := "NULL::VARCHAR(255), NULL::VARCHAR(64)"
+	if columns["author"] && columns["ticket"] {
+		metadata = "author, ticket"
+	}
+
+	skipped := "'f'::BOOLEAN"
+	if columns["skipped"] {
+		skipped = "skipped"
+	}
+
+	query := fmt.Sprintf(`
+		SELECT version, description, md5_checksum, success, %s, %s
+		FROM %s
+		ORDER BY version ASC
+	`, metadata, skipped, r.history_table)
+
+	rows, err := r.queriable.QueryContext(r.ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make([]*database.AppliedMigration, 0)
+	for rows.Next() {
+		migration := new(database.AppliedMigration)
+		author, ticket := sql.NullString{}, sql.NullString{}
+		err := rows.Scan(&migration.Version, &migration.Description, &migration.Checksum, &migration.Success,
+			&author, &ticket, &migration.Skipped)
+		if err != nil {
+			return nil, err
+		}
+		migration.Author, migration.Ticket = author.String, ticket.String
+		applied = append(applied, migration)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return applied, nil
+}
+
+func (r *InformixRepository) Clean() error {
+	// User objects have tabid >= 100. The lock table is kept, so cleaning inside DoInLock does not release the lock
+	query := `
+		SELECT CASE tabtype
+			WHEN 'V' THEN 'DROP VIEW IF EXISTS ' || TRIM(tabname) || ' CASCADE'
+			WHEN 'Q' THEN 'DROP SEQUENCE IF EXISTS ' || TRIM(tabname)
+			WHEN 'S' THEN 'DROP SYNONYM IF EXISTS ' || TRIM(tabname)
+			ELSE 'DROP TABLE IF EXISTS ' || TRIM(tabname) || ' CASCADE'
+		END, CASE tabtype WHEN 'V' THEN 1 WHEN 'S' THEN 2 WHEN 'T' THEN 3 ELSE 4 END AS position
+		FROM systables
+		WHERE tabid >= 100 AND owner = USER AND tabtype IN ('T', 'V', 'Q', 'S') AND tabname <> LOWER(?)
+		UNION ALL
+		SELECT CASE isproc
+			WHEN 't' THEN 'DROP PROCEDURE IF EXISTS ' || TRIM(procname)
+			ELSE 'DROP FUNCTION IF EXISTS ' || TRIM(procname)
+		END, 5 AS position
+		FROM sysprocedures
+		WHERE owner = USER AND mode IN ('O', 'R', 'D') AND internal = 'f'
+		ORDER BY 2
+	`
+
+	rows, err := r.queriable.QueryContext(r.ctx, query, r.lockTable())
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	statements := make([]string, 0)
+	for rows.Next() {
+		statement, position := "", 0
+		if err := rows.Scan(&statement, &position); err != nil {
+			return err
+		}
+		statements = append(statements, statement)
+	}
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	for _, statement := range statements {
+		_, err = r.queriable.ExecContext(r.ctx, statement)
+		if err != nil {
+			return fmt.Errorf("error executing %q: %w", statement, err)
+		}
+	}
+
+	return nil
+}
+
+// execScript executes a migration or hook script one statement at a time, as Informix drivers
+// do not accept multiple statements in a single call.
+func (r *InformixRepository) execScript(script string, skip int) error {
+	for i, statement := range migrations.SplitSPLStatements(script) {
+		if i < skip {
+			continue
+		}
+
+		_, err := r.queriable.ExecContext(r.ctx, statement)
+		if err != nil {
+			line, _, _ := strings.Cut(statement, "\n")
+			return &database.StatementError{Index: i + 1, Err: fmt.Errorf("statement %d (%s): %w", i+1, line, err)}
+		}
+	}
+
+	return nil
+}
+
+// nullable returns the value as a query parameter, NULL if empty.
+func nullable(value string) any {
+	if value == "" {
+		return nil
+	}
+	return value
+}
+
+// booleanLiteral returns the representation of the value accepted by BOOLEAN columns.
+func booleanLiteral(value bool) string {
+	if value {
+		return "t"
+	}
+	return "f"
+}
+
+// parseBoolean reports the value of a BOOLEAN column as returned by the driver, and whether it is a boolean.
+func parseBoolean(value any) (bool, bool) {
+	switch v := value.(type) {
+	case bool:
+		return v, true
+	case string:
+		if v == "t" || v == "f" {
+			return v == "t", true
+		}
+	case []byte:
+		if string(v) == "t" || string(v) == "f" {
+			return string(v) == "t", true
+		}
+	}
+	return false, false
+}
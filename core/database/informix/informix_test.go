@@ -0,0 +1,353 @@
+package informix
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/maestro-go/maestro/core/database"
+	"github.com/maestro-go/maestro/core/enums"
+	"github.com/maestro-go/maestro/internal/migrations"
+	testUtils "github.com/maestro-go/maestro/internal/utils/testing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const checksum = "0a52730597fb4ffa01fc117d9e71e3a9"
+
+// newMockRepository returns a repository on a mocked connection, checking that every expected statement was
+// executed once the test ends.
+func newMockRepository(t *testing.T) (*InformixRepository, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		assert.NoError(t, mock.ExpectationsWereMet())
+		db.Close()
+	})
+
+	return NewInformixRepository(context.Background(), db, testUtils.ToPtr(default_history_table)), mock
+}
+
+func expectTableExists(mock sqlmock.Sqlmock, table string, exists bool) {
+	count := 0
+	if exists {
+		count = 1
+	}
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM systables")).WithArgs(table).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(count))
+}
+
+func expectHistoryColumns(mock sqlmock.Sqlmock, columns ...string) {
+	rows := sqlmock.NewRows([]string{"colname"})
+	for _, column := range columns {
+		rows.AddRow(column)
+	}
+	mock.ExpectQuery(regexp.QuoteMeta("FROM syscolumns c, systables t")).WithArgs(default_history_table).
+		WillReturnRows(rows)
+}
+
+func upMigration(version uint16, content string) *migrations.Migration {
+	return &migrations.Migration{
+		Version:     version,
+		Description: "abcd",
+		Type:        enums.MIGRATION_UP,
+		Checksum:    testUtils.ToPtr(checksum),
+		Content:     &content,
+		Author:      "Jane Doe <jane@example.com>",
+	}
+}
+
+func TestAssertSchemaHistoryTable(t *testing.T) {
+	repository, mock := newMockRepository(t)
+
+	mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE IF NOT EXISTS schema_history_audit")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE IF NOT EXISTS schema_history (")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	// Tables created by previous versions get the missing columns, the catalog pads the names
+	expectHistoryColumns(mock, "version ", "description", "md5_checksum", "success", "executed_at", "repaired_at",
+		"notes ", "run_id")
+	mock.ExpectExec(regexp.QuoteMeta("ALTER TABLE schema_history ADD (author VARCHAR(255))")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("ALTER TABLE schema_history ADD (ticket VARCHAR(64))")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("ALTER TABLE schema_history ADD (skipped BOOLEAN DEFAULT 'f' NOT NULL)")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err := repository.AssertSchemaHistoryTable()
+	assert.NoError(t, err)
+}
+
+func TestGetLatestMigration(t *testing.T) {
+	repository, mock := newMockRepository(t)
+
+	expectTableExists(mock, default_history_table, false)
+
+	version, err := repository.GetLatestMigration()
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(0), version)
+
+	expectTableExists(mock, default_history_table, true)
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT NVL(MAX(version), 0)")).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(3))
+
+	version, err = repository.GetLatestMigration()
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(3), version)
+}
+
+func TestValidateMigrations(t *testing.T) {
+	repository, mock := newMockRepository(t)
+
+	local := []*migrations.Migration{upMigration(1, ""), upMigration(2, ""), upMigration(3, "")}
+	local[2].Checksum = testUtils.ToPtr("3d41c8443df34e73867adb149efbb2ea")
+
+	// Version 2 is missing, and the checksum of version 3 changed. BOOLEAN columns are returned as 't' or 'f'
+	expectTableExists(mock, default_history_table, true)
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT version, description, md5_checksum, success")).
+		WillReturnRows(sqlmock.NewRows([]string{"version", "description", "md5_checksum", "success"}).
+			AddRow(1, "abcd", checksum, "t").
+			AddRow(3, "abcd", checksum, "t"))
+
+	errs := repository.ValidateMigrations(local)
+	require.Len(t, errs, 2)
+
+	var missingErr *database.MissingVersionError
+	assert.ErrorAs(t, errs[0], &missingErr)
+	assert.Equal(t, uint16(2), missingErr.Version)
+
+	var mismatchErr *database.MismatchError
+	assert.ErrorAs(t, errs[1], &mismatchErr)
+	assert.Equal(t, uint16(3), mismatchErr.Version)
+}
+
+func TestExecuteMigration(t *testing.T) {
+	repository, mock := newMockRepository(t)
+	repository.SetRunInfo(database.RunInfo{ID: "run", MaestroVersion: "test"})
+
+	migration := upMigration(1, `CREATE TABLE test1 (id INT);
+CREATE PROCEDURE add_test1(value INT)
+	INSERT INTO test1 VALUES (value);
+END PROCEDURE;`)
+
+	// SPL routines are executed as a single statement, then the history is recorded
+	mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE test1 (id INT)")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO test1 VALUES (value);\nEND PROCEDURE")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE schema_history")).
+		WithArgs("abcd", checksum, "t", "run", migration.Author, nil, "f", migration.Version).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO schema_history (")).
+		WithArgs(migration.Version, "abcd", checksum, "t", "run", migration.Author, nil, "f").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO schema_history_audit")).
+		WithArgs("run", "test", database.AUDIT_UP, migration.Version, "abcd", "t").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	errs := repository.ExecuteMigration(migration)
+	assert.Nil(t, errs)
+
+	// The failure is recorded, reporting the first line of the failed statement
+	mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE test1 (id INT)")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("CREATE PROCEDURE add_test1")).WillReturnError(errors.New("syntax error"))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE schema_history")).
+		WithArgs("abcd", checksum, "f", "run", migration.Author, nil, "f", migration.Version).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO schema_history_audit")).
+		WithArgs("run", "test", database.AUDIT_UP, migration.Version, "abcd", "f").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	errs = repository.ExecuteMigration(migration)
+	require.Len(t, errs, 1)
+
+	var statementErr *database.StatementError
+	require.ErrorAs(t, errs[0], &statementErr)
+	assert.Equal(t, 2, statementErr.Index)
+	assert.ErrorContains(t, errs[0], "statement 2 (CREATE PROCEDURE add_test1(value INT))")
+
+	errs = repository.ExecuteMigration(&migrations.Migration{Type: enums.MIGRATION_DOWN})
+	assert.Len(t, errs, 1)
+}
+
+func TestSkipMigration(t *testing.T) {
+	repository, mock := newMockRepository(t)
+
+	migration := upMigration(1, "CREATE TABLE test1 (id INT);")
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE schema_history")).
+		WithArgs("abcd", checksum, "t", nil, migration.Author, nil, "t", migration.Version).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO schema_history_audit")).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), database.AUDIT_SKIP, migration.Version, "abcd", "t").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := repository.SkipMigration(migration)
+	assert.NoError(t, err)
+}
+
+func TestExecuteAssertion(t *testing.T) {
+	repository, mock := newMockRepository(t)
+
+	hook := &migrations.Hook{Content: testUtils.ToPtr("SELECT * FROM orphans"), Type: enums.HOOK_ASSERTION}
+
+	mock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	assert.NoError(t, repository.ExecuteAssertion(hook))
+
+	mock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows([]string{"ok"}).AddRow("t"))
+	assert.NoError(t, repository.ExecuteAssertion(hook))
+
+	mock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows([]string{"ok"}).AddRow([]byte("f")))
+	assert.EqualError(t, repository.ExecuteAssertion(hook), "assertion failed: query returned false")
+
+	mock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2))
+	assert.EqualError(t, repository.ExecuteAssertion(hook), "assertion failed: query returned 2 rows")
+}
+
+func TestRollbackMigration(t *testing.T) {
+	repository, mock := newMockRepository(t)
+
+	migration := &migrations.Migration{Version: 1, Description: "abcd", Type: enums.MIGRATION_DOWN,
+		Content: testUtils.ToPtr("DROP TABLE test1;")}
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM schema_history WHERE version = ?")).WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectExec(regexp.QuoteMeta("DROP TABLE test1")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM schema_history")).WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	// The history row was deleted by the rollback script
+	err := repository.RollbackMigration(migration)
+	assert.EqualError(t, err, `version was not deleted from "schema_history" table`)
+}
+
+func TestDoInTransaction(t *testing.T) {
+	repository, mock := newMockRepository(t)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE test1")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	err := repository.DoInTransaction(func() error {
+		_, err := repository.queriable.ExecContext(repository.ctx, "CREATE TABLE test1 (id INT)")
+		assert.NoError(t, err)
+		return errors.New("migration failed")
+	})
+	assert.EqualError(t, err, "migration failed")
+	assert.Equal(t, repository.db, repository.queriable)
+
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	err = repository.DoInTransaction(func() error { return nil })
+	assert.NoError(t, err)
+}
+
+func TestSession(t *testing.T) {
+	repository, mock := newMockRepository(t)
+
+	// Sessions run outside of the transaction of the repository
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO test1")).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	err := repository.DoInTransaction(func() error {
+		session := repository.Session().(*InformixRepository)
+		assert.Equal(t, repository.db, session.queriable)
+		assert.NotEqual(t, repository.queriable, session.queriable)
+
+		_, err := repository.queriable.ExecContext(repository.ctx, "INSERT INTO test1 VALUES (1)")
+		return err
+	})
+	assert.NoError(t, err)
+}
+
+func TestDoInLock(t *testing.T) {
+	repository, mock := newMockRepository(t)
+
+	expectTableExists(mock, lock_table, false)
+	mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE schema_lock")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("DROP TABLE IF EXISTS schema_lock")).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err := repository.DoInLock(func() error {
+		return nil
+	})
+	assert.NoError(t, err)
+
+	expectTableExists(mock, "app_history_lock", true)
+
+	other := NewInformixRepository(context.Background(), repository.db, testUtils.ToPtr("app_history"))
+	info, err := other.GetLockInfo()
+	assert.NoError(t, err)
+	assert.True(t, info.Locked)
+}
+
+func TestRepair(t *testing.T) {
+	repository, mock := newMockRepository(t)
+
+	local := make([]*migrations.Migration, 0, repair_batch_size+1)
+	for version := range repair_batch_size + 1 {
+		local = append(local, upMigration(uint16(version+1), ""))
+	}
+
+	// The migrations are merged in batches, in a single transaction
+	expectTableExists(mock, default_history_table, true)
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("MERGE INTO schema_history h")).WillReturnResult(sqlmock.NewResult(0, 100))
+	mock.ExpectExec(regexp.QuoteMeta("MERGE INTO schema_history h")).WithArgs(101, "abcd", checksum).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	errs := repository.Repair(local)
+	assert.Nil(t, errs)
+}
+
+func TestAnnotate(t *testing.T) {
+	repository, mock := newMockRepository(t)
+
+	expectTableExists(mock, default_history_table, true)
+	expectHistoryColumns(mock, "version", "notes", "run_id", "author", "ticket", "skipped")
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE schema_history SET notes = ? WHERE version = ?")).WithArgs("note", 2).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err := repository.Annotate(2, "note")
+	assert.ErrorIs(t, err, database.ErrNotApplied)
+}
+
+func TestGetAppliedMigrations(t *testing.T) {
+	repository, mock := newMockRepository(t)
+
+	// History tables created by previous versions have no metadata nor skipped columns
+	expectTableExists(mock, default_history_table, true)
+	expectHistoryColumns(mock, "version", "description", "md5_checksum", "success")
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT version, description, md5_checksum, success, " +
+		"NULL::VARCHAR(255), NULL::VARCHAR(64), 'f'::BOOLEAN")).
+		WillReturnRows(sqlmock.NewRows([]string{"version", "description", "md5_checksum", "success", "author",
+			"ticket", "skipped"}).AddRow(1, "abcd", checksum, "t", nil, nil, "f"))
+
+	applied, err := repository.GetAppliedMigrations()
+	assert.NoError(t, err)
+	require.Len(t, applied, 1)
+	assert.True(t, applied[0].Success)
+	assert.False(t, applied[0].Skipped)
+	assert.Empty(t, applied[0].Author)
+}
+
+func TestClean(t *testing.T) {
+	repository, mock := newMockRepository(t)
+
+	// The lock table is kept
+	mock.ExpectQuery(regexp.QuoteMeta("FROM systables")).WithArgs(lock_table).
+		WillReturnRows(sqlmock.NewRows([]string{"statement", "position"}).
+			AddRow("DROP VIEW IF EXISTS v1 CASCADE", 1).
+			AddRow("DROP TABLE IF EXISTS t1 CASCADE", 3).
+			AddRow("DROP PROCEDURE IF EXISTS p1", 5))
+	mock.ExpectExec(regexp.QuoteMeta("DROP VIEW IF EXISTS v1 CASCADE")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("DROP TABLE IF EXISTS t1 CASCADE")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("DROP PROCEDURE IF EXISTS p1")).
+		WillReturnError(errors.New("routine in use"))
+
+	err := repository.Clean()
+	assert.EqualError(t, err, `error executing "DROP PROCEDURE IF EXISTS p1": routine in use`)
+}
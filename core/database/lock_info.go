@@ -0,0 +1,10 @@
+package database
+
+import "time"
+
+// LockInfo describes the state of the lock taken by DoInLock.
+type LockInfo struct {
+	Locked   bool
+	Owner    string     // Holder of the lock (run ID, session...), empty if the driver can not tell
+	LockedAt *time.Time // Time the lock was taken, nil if the driver can not tell
+}
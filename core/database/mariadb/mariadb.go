@@ -0,0 +1,1146 @@
+// Package mariadb implements the maestro repository for MariaDB.
+//
+// MariaDB is not treated as MySQL: DDL statements commit implicitly, locks are named server-wide locks
+// bound to the session taking them, and schemas may hold sequences. The connection must be opened with
+// multiple statements enabled (multiStatements=true with github.com/go-sql-driver/mysql), as migration
+// scripts are sent to the server at once. Scripts need no DELIMITER lines, which are client commands:
+// the server parses the bodies of routines itself. The LOAD DATA LOCAL INFILE statements the maestro:load
+// directive is expanded to send their inline data through a reader handler of github.com/go-sql-driver/mysql,
+// which the connection must be opened with.
+package mariadb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/maestro-go/maestro/core/database"
+	"github.com/maestro-go/maestro/core/enums"
+	"github.com/maestro-go/maestro/internal/conf"
+	"github.com/maestro-go/maestro/internal/migrations"
+)
+
+const default_history_table = "schema_history"
+
+// lock_timeout is the number of seconds DoInLock waits for the lock held by another session.
+const lock_timeout = 60
+
+// lock_name is the name of the lock of DoInLock, given the history table. Locks are shared by every database
+// of the server, so the name includes the current database.
+const lock_name = "CONCAT('maestro:', DATABASE(), '.', ?)"
+
+// loadDataReaders numbers the reader handlers of the LOAD DATA LOCAL INFILE statements, registered globally.
+var loadDataReaders atomic.Int64
+
+// batch_size is the number of migrations per statement of Repair and ValidateMigrations, keeping
+// the parameters of a statement below the limit of 65535.
+const batch_size = 1000
+
+// history_schema are the columns of the history table. The optional ones were added after its first release,
+// and are added by upgradeHistoryTable to the tables created by previous versions.
+var history_schema = []*database.HistoryColumn{
+	{Name: "version", Family: database.COLUMN_INTEGER, Type: "SMALLINT UNSIGNED", Definition: "SMALLINT UNSIGNED NOT NULL"},
+	{Name: "description", Family: database.COLUMN_TEXT, Type: "VARCHAR(255)", Definition: "VARCHAR(255) NOT NULL DEFAULT ''"},
+	{Name: "md5_checksum", Family: database.COLUMN_TEXT, Type: "CHAR(32)", Definition: "CHAR(32) NOT NULL DEFAULT ''"},
+	{Name: "success", Family: database.COLUMN_BOOLEAN, Type: "BOOLEAN", Definition: "BOOLEAN NOT NULL DEFAULT false"},
+	{Name: "executed_at", Family: database.COLUMN_TIMESTAMP, Type: "DATETIME", Definition: "DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP"},
+	{Name: "repaired_at", Family: database.COLUMN_TIMESTAMP, Type: "DATETIME", Definition: "DATETIME"},
+	{Name: "notes", Family: database.COLUMN_TEXT, Type: "TEXT", Definition: "TEXT", Optional: true},
+	{Name: "run_id", Family: database.COLUMN_TEXT, Type: "VARCHAR(64)", Definition: "VARCHAR(64)", Optional: true},
+	{Name: "author", Family: database.COLUMN_TEXT, Type: "VARCHAR(255)", Definition: "VARCHAR(255)", Optional: true},
+	{Name: "ticket", Family: database.COLUMN_TEXT, Type: "VARCHAR(64)", Definition: "VARCHAR(64)", Optional: true},
+	{Name: "installed_rank", Family: database.COLUMN_INTEGER, Type: "BIGINT", Definition: "BIGINT", Optional: true},
+	{Name: "skipped", Family: database.COLUMN_BOOLEAN, Type: "BOOLEAN", Definition: "BOOLEAN NOT NULL DEFAULT false", Optional: true},
+}
+
+// MariaDBRepository executes migration scripts at once, on connections with multiple statements enabled.
+// As DDL statements commit implicitly, DoInTransaction only rolls back the data changes of a failing callback,
+// and the repository does not report transaction support.
+type MariaDBRepository struct {
+	database.Repository
+	ctx           context.Context
+	queriable     database.Queriable
+	db            database.Database
+	history_table string
+	run           database.RunInfo
+}
+
+func NewMariaDBRepository(ctx context.Context, db database.Database, history_table *string) *MariaDBRepository {
+	repo := &MariaDBRepository{
+		ctx:       ctx,
+		queriable: db,
+		db:        db,
+		run:       database.RunInfo{MaestroVersion: conf.VERSION},
+	}
+
+	if history_table != nil {
+		repo.history_table = *history_table
+	} else {
+		repo.history_table = default_history_table
+	}
+
+	return repo
+}
+
+func (r *MariaDBRepository) GetLatestMigration() (uint16, error) {
+	tableExists, err := r.CheckSchemaHistoryTable()
+	if err != nil {
+		return 0, err
+	}
+
+	if !tableExists {
+		return 0, nil
+	}
+
+	query := fmt.Sprintf(`
+		SELECT COALESCE(MAX(version), 0)
+		FROM %s
+		WHERE success = true;
+	`, r.history_table)
+
+	version := uint16(0)
+	err = r.queriable.QueryRowContext(r.ctx, query).Scan(&version)
+	if err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+func (r *MariaDBRepository) AssertSchemaHistoryTable() error {
+	// Audit tables are also created for history tables of previous versions
+	query := fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+			run_id VARCHAR(64) NOT NULL,
+			maestro_version VARCHAR(32) NOT NULL,
+			direction VARCHAR(4) NOT NULL,
+			version SMALLINT UNSIGNED NOT NULL,
+			description VARCHAR(255) NOT NULL,
+			success BOOLEAN NOT NULL,
+			executed_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+		);
+	`, r.auditTable())
+
+	_, err := r.queriable.ExecContext(r.ctx, query)
+	if err != nil {
+		return err
+	}
+
+	exists, err := r.CheckSchemaHistoryTable()
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		return r.upgradeHistoryTable()
+	}
+
+	query = fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			version SMALLINT UNSIGNED NOT NULL PRIMARY KEY,
+			description VARCHAR(255) NOT NULL,
+			md5_checksum CHAR(32) NOT NULL,
+			success BOOLEAN NOT NULL DEFAULT false,
+			executed_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			repaired_at DATETIME,
+			notes TEXT,
+			run_id VARCHAR(64),
+			author VARCHAR(255),
+			ticket VARCHAR(64),
+			installed_rank BIGINT,
+			skipped BOOLEAN NOT NULL DEFAULT false
+		);
+	`, r.history_table)
+
+	_, err = r.queriable.ExecContext(r.ctx, query)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// upgradeHistoryTable adds the columns missing in history tables created by previous versions.
+// The catalog is checked first, as ALTER TABLE commits the running transaction even when the column exists.
+// The installed ranks of the rows are set in the order of their executions.
+func (r *MariaDBRepository) upgradeHistoryTable() error {
+	columns, err := r.historyColumns()
+	if err != nil {
+		return err
+	}
+
+	for _, column := range history_schema {
+		if _, ok := columns[column.Name]; ok || !column.Optional {
+			continue
+		}
+
+		_, err = r.queriable.ExecContext(r.ctx, fmt.Sprintf(`
+			ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s %s;
+		`, r.history_table, column.Name, column.Definition))
+		if err != nil {
+			return err
+		}
+
+		if column.Name == "installed_rank" {
+			_, err = r.queriable.ExecContext(r.ctx, fmt.Sprintf(`
+				UPDATE %s AS history
+				JOIN (
+					SELECT version, ROW_NUMBER() OVER (ORDER BY executed_at, version) AS installed_rank
+					FROM %s
+				) AS ranks USING (version)
+				SET history.installed_rank = ranks.installed_rank;
+			`, r.history_table, r.history_table))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// historyColumns returns the lowercased types of the columns of the history table, by lowercased name.
+func (r *MariaDBRepository) historyColumns() (map[string]string, error) {
+	return r.tableColumns(r.history_table)
+}
+
+// tableColumns returns the lowercased types of the columns of the table, by lowercased name. Returns no
+// column if the table does not exist.
+func (r *MariaDBRepository) tableColumns(table string) (map[string]string, error) {
+	query := `
+		SELECT column_name, data_type FROM information_schema.columns
+		WHERE table_name = ? AND table_schema = DATABASE();
+	`
+
+	rows, err := r.queriable.QueryContext(r.ctx, query, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := map[string]string{}
+	for rows.Next() {
+		var column, columnType string
+		err = rows.Scan(&column, &columnType)
+		if err != nil {
+			return nil, err
+		}
+		columns[strings.ToLower(column)] = strings.ToLower(columnType)
+	}
+
+	return columns, rows.Err()
+}
+
+// CopyHistoryFrom replaces the rows of the history table with the rows of the table.
+func (r *MariaDBRepository) CopyHistoryFrom(table string) (int64, error) {
+	return r.copyHistory(table, r.history_table)
+}
+
+// CopyHistoryTo replaces the rows of the table with the rows of the history table.
+func (r *MariaDBRepository) CopyHistoryTo(table string) (int64, error) {
+	return r.copyHistory(r.history_table, table)
+}
+
+// copyHistory replaces the rows of the history table to with the rows of the history table from, in a
+// transaction.
+func (r *MariaDBRepository) copyHistory(from string, to string) (int64, error) {
+	if from == to {
+		return 0, fmt.Errorf("can not copy history table %s to itself", from)
+	}
+
+	fromColumns, err := r.tableColumns(from)
+	if err != nil {
+		return 0, err
+	}
+	if len(fromColumns) == 0 {
+		return 0, fmt.Errorf("history table %s does not exist", from)
+	}
+
+	toColumns, err := r.tableColumns(to)
+	if err != nil {
+		return 0, err
+	}
+	if len(toColumns) == 0 {
+		return 0, fmt.Errorf("history table %s does not exist", to)
+	}
+
+	columns, values := database.HistoryCopyColumns(history_schema, fromColumns, toColumns)
+
+	copied := int64(0)
+	err = r.inTransaction(func() error {
+		_, err := r.queriable.ExecContext(r.ctx, fmt.Sprintf("DELETE FROM %s;", to))
+		if err != nil {
+			return err
+		}
+
+		result, err := r.queriable.ExecContext(r.ctx, fmt.Sprintf(`
+			INSERT INTO %s (%s)
+			SELECT %s FROM %s;
+		`, to, strings.Join(columns, ", "), strings.Join(values, ", "), from))
+		if err != nil {
+			return err
+		}
+
+		copied, err = result.RowsAffected()
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return copied, nil
+}
+
+// CheckHistorySchema compares the columns of the history table with the ones of history_schema, before
+// anything is recorded in it.
+func (r *MariaDBRepository) CheckHistorySchema() error {
+	exists, err := r.CheckSchemaHistoryTable()
+	if err != nil || !exists {
+		return err
+	}
+
+	columns, err := r.historyColumns()
+	if err != nil {
+		return err
+	}
+
+	return database.CompareHistoryColumns(r.history_table, columns, history_schema,
+		func(column *database.HistoryColumn, missing bool) string {
+			if missing {
+				return fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s;", r.history_table, column.Name, column.Definition)
+			}
+			return fmt.Sprintf("ALTER TABLE %s MODIFY COLUMN %s %s;", r.history_table, column.Name, column.Definition)
+		})
+}
+
+func (r *MariaDBRepository) CheckSchemaHistoryTable() (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM information_schema.tables
+			WHERE table_name = ? AND table_schema = DATABASE() AND table_type = 'BASE TABLE'
+		);
+	`
+
+	exists := false
+	err := r.queriable.QueryRowContext(r.ctx, query, r.history_table).Scan(&exists)
+	if err != nil {
+		return false, err
+	}
+
+	return exists, nil
+}
+
+func (r *MariaDBRepository) ValidateMigrations(migrations []*migrations.Migration) []error {
+	if len(migrations) < 1 {
+		return nil
+	}
+
+	tableExists, err := r.CheckSchemaHistoryTable()
+	if err != nil {
+		return []error{err}
+	}
+
+	if !tableExists {
+		return nil
+	}
+
+	local := make(map[uint16]bool, len(migrations))
+	for _, migration := range migrations {
+		if migration.Type != enums.MIGRATION_UP {
+			return []error{fmt.Errorf("invalid migration type: %s", migration.Type.Name())}
+		}
+		local[migration.Version] = true
+	}
+
+	// Check gaps
+	query := fmt.Sprintf(`
+		SELECT version, description, md5_checksum, success FROM %s ORDER BY version ASC;
+	`, r.history_table)
+
+	versionsRows, err := r.queriable.QueryContext(r.ctx, query)
+	if err != nil {
+		return []error{err}
+	}
+	defer versionsRows.Close()
+
+	errs := make([]error, 0)
+	mismatches := make([]*database.MismatchError, 0)
+	expectedVersion := uint16(1)
+
+	for versionsRows.Next() {
+		applied, success := new(database.MismatchError), false
+		err = versionsRows.Scan(&applied.Version, &applied.Description, &applied.Checksum, &success)
+		if err != nil {
+			return []error{err}
+		}
+
+		if expectedVersion != applied.Version {
+			errs = append(errs, &database.MissingVersionError{Version: expectedVersion})
+		}
+
+		expectedVersion = applied.Version + 1
+
+		// Applied migrations missing locally mismatch
+		if success && !local[applied.Version] {
+			mismatches = append(mismatches, applied)
+		}
+	}
+
+	if err := versionsRows.Err(); err != nil {
+		return []error{err}
+	}
+	versionsRows.Close() // A connection runs a single query at a time, e.g. in a transaction
+
+	// Check description or checksum mismatch, joining the local migrations in batches
+	for _, batch := range database.Batches(migrations, batch_size) {
+		values := make([]string, 0, len(batch))
+		params := make([]any, 0, len(batch)*3)
+		for _, migration := range batch {
+			values = append(values, "SELECT ? AS version, ? AS description, ? AS md5_checksum")
+			params = append(params, migration.Version, migration.Description, *migration.Checksum)
+		}
+
+		query = fmt.Sprintf(`
+			SELECT h.version, h.description, h.md5_checksum
+			FROM %s h
+			JOIN (%s) AS l ON l.version = h.version
+			WHERE h.success = true AND (h.description <> l.description OR h.md5_checksum <> l.md5_checksum);
+		`, r.history_table, strings.Join(values, " UNION ALL "))
+
+		rows, err := r.queriable.QueryContext(r.ctx, query, params...)
+		if err != nil {
+			return []error{err}
+		}
+
+		for rows.Next() {
+			mismatch := new(database.MismatchError)
+			err := rows.Scan(&mismatch.Version, &mismatch.Description, &mismatch.Checksum)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+
+			mismatches = append(mismatches, mismatch)
+		}
+
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return []error{err}
+		}
+	}
+
+	sort.Slice(mismatches, func(i, j int) bool {
+		return mismatches[i].Version < mismatches[j].Version
+	})
+	for _, mismatch := range mismatches {
+		errs = append(errs, mismatch)
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (r *MariaDBRepository) ExecuteMigration(migration *migrations.Migration) []error {
+	if migration.Type != enums.MIGRATION_UP {
+		return []error{fmt.Errorf("invalid migration type: %s", migration.Type.Name())}
+	}
+
+	errs := make([]error, 0)
+
+	err := r.execScript(*migration.Content)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	success := err == nil
+
+	err = r.saveHistory(migration, success, false)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("migration %d: %w", migration.Version, err))
+	} else {
+		err = r.audit(migration, database.AUDIT_UP, success)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("migration %d: %w", migration.Version, err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// saveHistory upserts the migration in the history table with the given status, and whether it was skipped
+// without being executed, ranked after the executions already recorded. The values are selected from the history table, as a subquery of VALUES can not read the
+// table the rows are inserted into.
+func (r *MariaDBRepository) saveHistory(migration *migrations.Migration, success bool, skipped bool) error {
+	query := fmt.Sprintf(`
+		INSERT INTO %s (version, description, md5_checksum, success, run_id, author, ticket, installed_rank, skipped)
+		SELECT ?, ?, ?, ?, NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), COALESCE(MAX(installed_rank), 0) + 1, ?
+		FROM %s
+		ON DUPLICATE KEY UPDATE description = VALUES(description), md5_checksum = VALUES(md5_checksum),
+			success = VALUES(success), run_id = VALUES(run_id), author = VALUES(author), ticket = VALUES(ticket),
+			installed_rank = VALUES(installed_rank), skipped = VALUES(skipped), executed_at = NOW();
+	`, r.history_table, r.history_table)
+
+	_, err := r.queriable.ExecContext(r.ctx, query, migration.Version, migration.Description,
+		migration.Checksum, success, r.run.ID, migration.Author, migration.Ticket, skipped)
+	return err
+}
+
+// SkipMigration records the migration as applied and skipped in the history table without executing it, and
+// records the skip in the audit table.
+func (r *MariaDBRepository) SkipMigration(migration *migrations.Migration) error {
+	if migration.Type != enums.MIGRATION_UP {
+		return fmt.Errorf("invalid migration type: %s", migration.Type.Name())
+	}
+
+	err := r.saveHistory(migration, true, true)
+	if err != nil {
+		return fmt.Errorf("migration %d: %w", migration.Version, err)
+	}
+
+	return r.audit(migration, database.AUDIT_SKIP, true)
+}
+
+func (r *MariaDBRepository) ExecuteHook(hook *migrations.Hook) error {
+	err := r.execScript(*hook.Content)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *MariaDBRepository) ExecuteAssertion(hook *migrations.Hook) error {
+	rows, err := r.queriable.QueryContext(r.ctx, *hook.Content)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+
+	rowsCount := 0
+	isBool, isTrue := false, false
+	for rows.Next() {
+		rowsCount++
+		if rowsCount == 1 && len(columns) == 1 {
+			var value any
+			if err := rows.Scan(&value); err != nil {
+				return err
+			}
+			isTrue, isBool = boolValue(value)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if rowsCount == 0 || (rowsCount == 1 && isTrue) {
+		return nil
+	}
+
+	if rowsCount == 1 && isBool {
+		return fmt.Errorf("assertion failed: query returned false")
+	}
+
+	return fmt.Errorf("assertion failed: query returned %d rows", rowsCount)
+}
+
+// boolValue returns the boolean of a value returned by the server. Booleans are TINYINT(1) numbers,
+// returned as text by queries without parameters: 1 is true and 0 is false.
+func boolValue(value any) (isTrue bool, isBool bool) {
+	switch v := value.(type) {
+	case bool:
+		return v, true
+	case int64:
+		return v == 1, v == 0 || v == 1
+	case []byte:
+		return string(v) == "1", string(v) == "0" || string(v) == "1"
+	}
+	return false, false
+}
+
+func (r *MariaDBRepository) RollbackMigration(migration *migrations.Migration) error {
+	if migration.Type != enums.MIGRATION_DOWN {
+		return fmt.Errorf("invalid migration type: %s", migration.Type.Name())
+	}
+
+	query := fmt.Sprintf(`
+		SELECT EXISTS (
+			SELECT version FROM %s WHERE version = ?
+		);
+	`, r.history_table)
+
+	exists := false
+	err := r.queriable.QueryRowContext(r.ctx, query, migration.Version).Scan(&exists)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return nil
+	}
+
+	err = r.execScript(*migration.Content)
+	if err != nil {
+		return err
+	}
+
+	// RETURNING reports the deleted version, whatever the client flags of affected rows
+	query = fmt.Sprintf(`
+		DELETE FROM %s
+		WHERE version = ?
+		RETURNING version;
+	`, r.history_table)
+
+	deleted := uint16(0)
+	err = r.queriable.QueryRowContext(r.ctx, query, migration.Version).Scan(&deleted)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("version was not deleted from \"%s\" table", r.history_table)
+	}
+	if err != nil {
+		return err
+	}
+
+	return r.audit(migration, database.AUDIT_DOWN, true)
+}
+
+func (r *MariaDBRepository) ServerInfo() (*database.ServerInfo, error) {
+	info := &database.ServerInfo{HistoryTable: r.history_table}
+
+	err := r.queriable.QueryRowContext(r.ctx, `
+		SELECT VERSION(), COALESCE(DATABASE(), '');
+	`).Scan(&info.Version, &info.Schema)
+	if err != nil {
+		return nil, err
+	}
+
+	info.HistoryTableExists, err = r.CheckSchemaHistoryTable()
+	if err != nil || !info.HistoryTableExists {
+		return info, err
+	}
+
+	query := fmt.Sprintf("SELECT COUNT(*) FROM %s;", r.history_table)
+	err = r.queriable.QueryRowContext(r.ctx, query).Scan(&info.HistoryRows)
+	if err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
+
+func (r *MariaDBRepository) Capabilities() database.Capabilities {
+	return database.Capabilities{
+		SupportsTransactions:   false, // DDL statements commit implicitly
+		SupportsAdvisoryLock:   true,
+		SupportsMultiStatement: true,
+		MaxIdentifierLength:    64,
+	}
+}
+
+func (r *MariaDBRepository) SetRunInfo(info database.RunInfo) {
+	r.run = info
+}
+
+func (r *MariaDBRepository) auditTable() string {
+	return r.history_table + "_audit"
+}
+
+// audit records the execution of the migration in the audit table.
+func (r *MariaDBRepository) audit(migration *migrations.Migration, direction string, success bool) error {
+	query := fmt.Sprintf(`
+		INSERT INTO %s (run_id, maestro_version, direction, version, description, success)
+		VALUES (?, ?, ?, ?, ?, ?);
+	`, r.auditTable())
+
+	_, err := r.queriable.ExecContext(r.ctx, query, r.run.ID, r.run.MaestroVersion, direction,
+		migration.Version, migration.Description, success)
+	if err != nil {
+		return fmt.Errorf("error recording audit: %w", err)
+	}
+
+	return nil
+}
+
+// DoInTransaction runs the callback in a transaction. DDL statements commit it implicitly, so only the
+// data changes made since the last DDL statement are rolled back if the callback fails.
+func (r *MariaDBRepository) DoInTransaction(fn func() error) error {
+	tx, err := r.db.BeginTx(r.ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		tx.Rollback()
+		r.queriable = r.db // Always reset queriable to db
+	}()
+
+	r.queriable = tx
+
+	err = fn()
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *MariaDBRepository) DoOutsideTransaction(fn func() error) error {
+	if _, ok := r.queriable.(*sql.Tx); ok && database.SingleConnection(r.db) {
+		return errors.New("cannot run outside of the transaction with a single connection")
+	}
+
+	queriable := r.queriable
+	defer func() {
+		r.queriable = queriable
+	}()
+
+	r.queriable = r.db
+
+	return fn()
+}
+
+// Session returns a repository sharing the connections of this one, with its own transaction and run info.
+func (r *MariaDBRepository) Session() database.Repository {
+	session := *r
+	session.queriable = r.db // Outside of the transaction of this repository
+	return &session
+}
+
+// GetLockInfo reports whether a session holds the lock, and the connection ID and user of the session.
+// The user is only known with the PROCESS privilege, if the session is not one of the current user.
+func (r *MariaDBRepository) GetLockInfo() (*database.LockInfo, error) {
+	holder := sql.NullInt64{}
+	err := r.queriable.QueryRowContext(r.ctx, "SELECT IS_USED_LOCK("+lock_name+");", r.history_table).Scan(&holder)
+	if err != nil {
+		return nil, err
+	}
+
+	if !holder.Valid {
+		return &database.LockInfo{}, nil
+	}
+
+	info := &database.LockInfo{Locked: true, Owner: fmt.Sprintf("connection %d", holder.Int64)}
+
+	user, host := "", ""
+	err = r.queriable.QueryRowContext(r.ctx, `
+		SELECT user, host FROM information_schema.processlist WHERE id = ?;
+	`, holder.Int64).Scan(&user, &host)
+	if errors.Is(err, sql.ErrNoRows) {
+		return info, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	info.Owner += fmt.Sprintf(", user %s@%s", user, host)
+	return info, nil
+}
+
+// DoInLock takes a named lock, released by the server if the session ends, waiting up to lock_timeout
+// seconds for another session to release it. The lock belongs to the session taking it, so the callback
+// runs while the connection taking the lock is reserved.
+func (r *MariaDBRepository) DoInLock(fn func() error) error {
+	return r.onConnection(func(conn connection) error {
+		// GET_LOCK returns 1 once the lock is taken, 0 on timeout and NULL on error
+		locked := sql.NullInt64{}
+		err := conn.QueryRowContext(r.ctx, "SELECT GET_LOCK("+lock_name+", ?);", r.history_table,
+			lock_timeout).Scan(&locked)
+		if err != nil {
+			return fmt.Errorf("failed to acquire lock: %w", err)
+		}
+		if locked.Int64 != 1 {
+			return fmt.Errorf("timeout while waiting for the lock of %s", r.history_table)
+		}
+		defer func() {
+			_, err = conn.ExecContext(r.ctx, "DO RELEASE_LOCK("+lock_name+");", r.history_table)
+			if err != nil {
+				panic(fmt.Errorf("failed to release lock: %w", err))
+			}
+		}()
+
+		return fn()
+	})
+}
+
+// execScript executes a migration or hook script at once. Scripts with LOAD DATA LOCAL INFILE statements followed
+// by inline data are executed part by part on the same connection, the inline data being sent as the file of
+// its statement by a reader handler registered for the statement.
+func (r *MariaDBRepository) execScript(script string) error {
+	if !migrations.HasLoadDataLocal(script) {
+		_, err := r.queriable.ExecContext(r.ctx, script)
+		return err
+	}
+
+	parts, err := migrations.SplitLoadDataStatements(script)
+	if err != nil {
+		return err
+	}
+
+	return r.onConnection(func(conn connection) error {
+		for _, part := range parts {
+			statement := part.SQL
+			if part.Copy {
+				data := part.Data
+				reader := fmt.Sprintf("maestro-%d", loadDataReaders.Add(1))
+				mysql.RegisterReaderHandler(reader, func() io.Reader { return strings.NewReader(data) })
+				defer mysql.DeregisterReaderHandler(reader)
+
+				statement = strings.Replace(statement, migrations.LOAD_DATA_READER, "Reader::"+reader, 1)
+			}
+
+			_, err := conn.ExecContext(r.ctx, statement)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// connection is the part of a database connection used by the statements depending on the state of their session.
+type connection interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// onConnection runs the callback on a connection of the pool reserved until it returns. In a transaction,
+// or with a single connection, the callback runs on the connection of the repository.
+func (r *MariaDBRepository) onConnection(fn func(conn connection) error) error {
+	pool, ok := r.queriable.(*sql.DB)
+	if !ok || database.SingleConnection(pool) {
+		return fn(r.queriable)
+	}
+
+	conn, err := pool.Conn(r.ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return fn(conn)
+}
+
+func (r *MariaDBRepository) Repair(migrations []*migrations.Migration) []error {
+	tableExists, err := r.CheckSchemaHistoryTable()
+	if err != nil {
+		return []error{err}
+	}
+
+	if !tableExists {
+		return nil
+	}
+
+	err = r.inTransaction(func() error {
+		// The migrations missing from the history are ranked after the executions already recorded
+		rank, recorded, err := database.HistoryRanks(r.ctx, r.queriable, r.history_table)
+		if err != nil {
+			return err
+		}
+
+		for _, batch := range database.Batches(migrations, batch_size) {
+			values := make([]string, 0, len(batch))
+			args := make([]any, 0, len(batch)*4)
+			for _, migration := range batch {
+				migrationRank := sql.NullInt64{}
+				if !recorded[migration.Version] {
+					rank++
+					migrationRank = sql.NullInt64{Int64: rank, Valid: true}
+				}
+				values = append(values, "(?, ?, ?, true, NOW(), ?)")
+				args = append(args, migration.Version, migration.Description, *migration.Checksum, migrationRank)
+			}
+
+			// Assignments see the values updated before them, so repaired_at is compared first.
+			// Recorded migrations keep their rank.
+			query := fmt.Sprintf(`
+				INSERT INTO %s (version, description, md5_checksum, success, repaired_at, installed_rank)
+				VALUES %s
+				ON DUPLICATE KEY UPDATE
+					repaired_at = IF(VALUES(description) <> description OR VALUES(md5_checksum) <> md5_checksum,
+						NOW(), repaired_at),
+					description = VALUES(description), md5_checksum = VALUES(md5_checksum);
+			`, r.history_table, strings.Join(values, ", "))
+
+			_, err := r.queriable.ExecContext(r.ctx, query, args...)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return []error{err}
+	}
+
+	return nil
+}
+
+// inTransaction runs the callback in the transaction started by DoInTransaction, or in a new one.
+func (r *MariaDBRepository) inTransaction(fn func() error) error {
+	if _, ok := r.queriable.(*sql.Tx); ok {
+		return fn()
+	}
+	return r.DoInTransaction(fn)
+}
+
+// Annotate sets the note of the version in the notes column of the history table, added if missing.
+func (r *MariaDBRepository) Annotate(version uint16, note string) error {
+	exists, err := r.CheckSchemaHistoryTable()
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return fmt.Errorf("version %d: %w", version, database.ErrNotApplied)
+	}
+
+	// History tables created by previous versions have no notes column
+	err = r.upgradeHistoryTable()
+	if err != nil {
+		return err
+	}
+
+	// Unchanged rows are not counted as affected rows, so the version is looked up first
+	query := fmt.Sprintf(`
+		SELECT EXISTS (SELECT version FROM %s WHERE version = ?);
+	`, r.history_table)
+
+	applied := false
+	err = r.queriable.QueryRowContext(r.ctx, query, version).Scan(&applied)
+	if err != nil {
+		return err
+	}
+
+	if !applied {
+		return fmt.Errorf("version %d: %w", version, database.ErrNotApplied)
+	}
+
+	query = fmt.Sprintf(`
+		UPDATE %s SET notes = NULLIF(?, '') WHERE version = ?;
+	`, r.history_table)
+
+	_, err = r.queriable.ExecContext(r.ctx, query, note, version)
+	return err
+}
+
+// PruneHistory deletes the history rows of the versions above latest, e.g. once the database was restored from a
+// backup taken before they were applied.
+func (r *MariaDBRepository) PruneHistory(latest uint16) ([]uint16, error) {
+	exists, err := r.CheckSchemaHistoryTable()
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		return nil, nil
+	}
+
+	query := fmt.Sprintf(`
+		DELETE FROM %s WHERE version > ? RETURNING version;
+	`, r.history_table)
+
+	rows, err := r.queriable.QueryContext(r.ctx, query, latest)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := make([]uint16, 0)
+	for rows.Next() {
+		version := uint16(0)
+		err = rows.Scan(&version)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, version)
+	}
+
+	sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
+	return versions, rows.Err()
+}
+
+func (r *MariaDBRepository) GetFailingMigrations() ([]*migrations.Migration, error) {
+	exists, err := r.CheckSchemaHistoryTable()
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		return nil, nil
+	}
+
+	query := fmt.Sprintf(`
+		SELECT version, description, md5_checksum
+		FROM %s
+		WHERE success = false;
+	`, r.history_table)
+
+	rows, err := r.queriable.QueryContext(r.ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var failingMigrations []*migrations.Migration
+	for rows.Next() {
+		var migration migrations.Migration
+		if err := rows.Scan(&migration.Version, &migration.Description, &migration.Checksum); err != nil {
+			return nil, err
+		}
+		failingMigrations = append(failingMigrations, &migration)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return failingMigrations, nil
+}
+
+func (r *MariaDBRepository) GetAppliedMigrations() ([]*database.AppliedMigration, error) {
+	exists, err := r.CheckSchemaHistoryTable()
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		return nil, nil
+	}
+
+	// History tables created by previous versions have no author, ticket, installed_rank and skipped columns
+	// until the next run
+	columns, err := r.historyColumns()
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := "'', ''"
+	_, author := columns["author"]
+	_, ticket := columns["ticket"]
+	if author && ticket {
+		metadata = "COALESCE(author, ''), COALESCE(ticket, '')"
+	}
+
+	rank := "0"
+	if _, ok := columns["installed_rank"]; ok {
+		rank = "COALESCE(installed_rank, 0)"
+	}
+
+	skipped := "false"
+	if _, ok := columns["skipped"]; ok {
+		skipped = "skipped"
+	}
+
+	// Execution times are formatted with database.EXECUTED_AT_LAYOUT, as drivers scan timestamps differently
+	query := fmt.Sprintf(`
+		SELECT version, description, md5_checksum, success, %s, %s, %s,
+			COALESCE(DATE_FORMAT(executed_at, '%%Y-%%m-%%d %%H:%%i:%%s'), '')
+		FROM %s
+		ORDER BY version ASC;
+	`, metadata, rank, skipped, r.history_table)
+
+	rows, err := r.queriable.QueryContext(r.ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make([]*database.AppliedMigration, 0)
+	for rows.Next() {
+		migration, executedAt := new(database.AppliedMigration), ""
+		err := rows.Scan(&migration.Version, &migration.Description, &migration.Checksum, &migration.Success,
+			&migration.Author, &migration.Ticket, &migration.InstalledRank, &migration.Skipped, &executedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		migration.ExecutedAt, err = database.ParseExecutedAt(executedAt)
+		if err != nil {
+			return nil, err
+		}
+		applied = append(applied, migration)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return applied, nil
+}
+
+// Clean drops the views, tables, sequences and routines of the current database. Foreign keys are not
+// checked while dropping, so tables are dropped in any order.
+func (r *MariaDBRepository) Clean() error {
+	query := `
+		SELECT 'VIEW', table_name FROM information_schema.views WHERE table_schema = DATABASE()
+		UNION ALL
+		SELECT IF(table_type = 'SEQUENCE', 'SEQUENCE', 'TABLE'), table_name FROM information_schema.tables
+		WHERE table_schema = DATABASE() AND table_type IN ('BASE TABLE', 'SEQUENCE')
+		UNION ALL
+		SELECT routine_type, routine_name FROM information_schema.routines WHERE routine_schema = DATABASE();
+	`
+
+	rows, err := r.queriable.QueryContext(r.ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	statements := make([]string, 0)
+	for rows.Next() {
+		kind, name := "", ""
+		if err := rows.Scan(&kind, &name); err != nil {
+			return err
+		}
+		statements = append(statements, fmt.Sprintf("DROP %s IF EXISTS %s", kind, quoteIdentifier(name)))
+	}
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	// The foreign key checks are disabled for the session, restored before the connection is released
+	return r.onConnection(func(conn connection) error {
+		checks := 0
+		err := conn.QueryRowContext(r.ctx, "SELECT @@foreign_key_checks;").Scan(&checks)
+		if err != nil {
+			return err
+		}
+
+		_, err = conn.ExecContext(r.ctx, "SET foreign_key_checks = 0;")
+		if err != nil {
+			return err
+		}
+		defer conn.ExecContext(r.ctx, "SET foreign_key_checks = ?;", checks)
+
+		for _, statement := range statements {
+			_, err = conn.ExecContext(r.ctx, statement)
+			if err != nil {
+				return fmt.Errorf("error executing %q: %w", statement, err)
+			}
+		}
+
+		return nil
+	})
+}
+
+func quoteIdentifier(identifier string) string {
+	return "`" + strings.ReplaceAll(identifier, "`", "``") + "`"
+}
@@ -0,0 +1,702 @@
+package mariadb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/maestro-go/maestro/core/database"
+	"github.com/maestro-go/maestro/core/enums"
+	"github.com/maestro-go/maestro/core/maestrotest"
+	"github.com/maestro-go/maestro/internal/migrations"
+	testUtils "github.com/maestro-go/maestro/internal/utils/testing"
+	"github.com/stretchr/testify/suite"
+
+	_ "github.com/go-sql-driver/mysql"
+)
+
+type MigrationTestSuite struct {
+	suite.Suite
+	mariadb *testUtils.MariaDBContainer
+	suiteDb *sql.DB
+
+	ctx context.Context
+
+	repository *MariaDBRepository
+}
+
+func (s *MigrationTestSuite) SetupSuite() {
+	s.ctx = context.Background()
+
+	s.mariadb = testUtils.SetupMariaDB(s.T())
+
+	db, err := sql.Open("mysql", s.mariadb.DSN)
+	s.Assert().NoError(err)
+
+	s.suiteDb = db
+
+	s.repository = NewMariaDBRepository(s.ctx, db, testUtils.ToPtr(default_history_table))
+}
+
+func (s *MigrationTestSuite) TearDownTest() {
+	if s.mariadb != nil {
+		err := s.repository.Clean()
+		s.Assert().NoError(err)
+	}
+}
+
+func (s *MigrationTestSuite) checkTableExists(table string, shouldExist bool) {
+	s.T().Helper()
+
+	query := `
+		SELECT EXISTS (
+			SELECT table_name FROM information_schema.tables
+			WHERE table_name = ? AND table_schema = DATABASE()
+		);
+	`
+
+	exists := false
+	err := s.suiteDb.QueryRowContext(s.ctx, query, table).Scan(&exists)
+	s.Assert().NoError(err)
+	s.Assert().Equal(shouldExist, exists)
+}
+
+func TestMigrationSuite(t *testing.T) {
+	suite.Run(t, new(MigrationTestSuite))
+}
+
+func (s *MigrationTestSuite) TestAssertSchemaHistoryTable() {
+	err := s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+
+	s.checkTableExists(default_history_table, true)
+
+	// Existing tables are kept
+	err = s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+}
+
+func (s *MigrationTestSuite) TestCheckSchemaHistoryTable() {
+	exists, err := s.repository.CheckSchemaHistoryTable()
+	s.Assert().NoError(err)
+	s.Assert().False(exists)
+
+	err = s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+
+	exists, err = s.repository.CheckSchemaHistoryTable()
+	s.Assert().NoError(err)
+	s.Assert().True(exists)
+}
+
+func (s *MigrationTestSuite) TestGetLatestMigration() {
+	version, err := s.repository.GetLatestMigration()
+	s.Assert().NoError(err)
+	s.Assert().Equal(uint16(0), version)
+
+	err = s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+
+	version, err = s.repository.GetLatestMigration()
+	s.Assert().NoError(err)
+	s.Assert().Equal(uint16(0), version)
+
+	query := fmt.Sprintf(`
+		INSERT INTO %s (version, description, md5_checksum, success) VALUES
+			(1, 't', '0a52730597fb4ffa01fc117d9e71e3a9', true),
+			(5, 't', '0a52730597fb4ffa01fc117d9e71e3a9', true),
+			(7, 't', '0a52730597fb4ffa01fc117d9e71e3a9', false);
+	`, default_history_table)
+
+	_, err = s.suiteDb.Exec(query)
+	s.Assert().NoError(err)
+
+	version, err = s.repository.GetLatestMigration()
+	s.Assert().NoError(err)
+	s.Assert().Equal(uint16(5), version)
+}
+
+func (s *MigrationTestSuite) TestValidateMigrations() {
+	checksums := []string{"0a52730597fb4ffa01fc117d9e71e3a9", "3d41c8443df34e73867adb149efbb2ea"}
+	contents := []string{"EXAMPLE CONTENT 1", "EXAMPLE CONTENT 2"}
+	migrations := []*migrations.Migration{
+		{
+			Version:     1,
+			Description: "abcd",
+			Type:        enums.MIGRATION_UP,
+			Checksum:    &checksums[0],
+			Content:     &contents[0],
+		},
+		{
+			Version:     2,
+			Description: "abcd",
+			Type:        enums.MIGRATION_UP,
+			Checksum:    &checksums[1],
+			Content:     &contents[1],
+		},
+	}
+
+	errs := s.repository.ValidateMigrations(migrations)
+	s.Assert().Nil(errs)
+
+	err := s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+
+	errs = s.repository.ValidateMigrations(migrations)
+	s.Assert().Nil(errs)
+
+	query := fmt.Sprintf(`
+		INSERT INTO %s (version, description, md5_checksum, success) VALUES
+			(?, ?, ?, true);
+	`, default_history_table)
+
+	_, err = s.suiteDb.ExecContext(s.ctx, query, migrations[1].Version,
+		migrations[1].Description, migrations[1].Checksum)
+	s.Assert().NoError(err)
+
+	errs = s.repository.ValidateMigrations(migrations)
+	s.Assert().Len(errs, 1)
+
+	_, err = s.suiteDb.ExecContext(s.ctx, query, migrations[0].Version,
+		migrations[0].Description, migrations[0].Checksum)
+	s.Assert().NoError(err)
+
+	errs = s.repository.ValidateMigrations(migrations)
+	s.Assert().Nil(errs)
+
+	query = fmt.Sprintf(`
+		UPDATE %s SET md5_checksum = ? WHERE version = ?;
+	`, default_history_table)
+
+	_, err = s.suiteDb.ExecContext(s.ctx, query, checksums[0], migrations[1].Version)
+	s.Assert().NoError(err)
+
+	errs = s.repository.ValidateMigrations(migrations)
+	s.Assert().Len(errs, 1)
+}
+
+func (s *MigrationTestSuite) TestExecuteMigrationLoadData() {
+	err := s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+
+	// The expansion of "-- maestro:load data/countries.csv INTO countries"
+	checksum := "0a52730597fb4ffa01fc117d9e71e3a9"
+	content := "CREATE TABLE countries (code CHAR(2) NOT NULL PRIMARY KEY, name TEXT);\n" +
+		"LOAD DATA LOCAL INFILE 'Reader::maestro' INTO TABLE countries CHARACTER SET utf8mb4 (code, name);\n" +
+		"BR\tBrasil\n" +
+		"PT\tPort\\tugal\n" +
+		"XX\t\\N\n" +
+		"\\.\n" +
+		"UPDATE countries SET name = 'Brazil' WHERE code = 'BR';\n"
+	migration := &migrations.Migration{
+		Version:     1,
+		Description: "countries",
+		Type:        enums.MIGRATION_UP,
+		Checksum:    &checksum,
+		Content:     &content,
+	}
+
+	errs := s.repository.ExecuteMigration(migration)
+	s.Require().Nil(errs)
+
+	rows, err := s.suiteDb.QueryContext(s.ctx, "SELECT code, name FROM countries ORDER BY code;")
+	s.Require().NoError(err)
+	defer rows.Close()
+
+	countries := map[string]*string{}
+	for rows.Next() {
+		code, name := "", sql.NullString{}
+		s.Require().NoError(rows.Scan(&code, &name))
+		countries[code] = nil
+		if name.Valid {
+			countries[code] = &name.String
+		}
+	}
+	s.Require().NoError(rows.Err())
+
+	s.Assert().Equal(map[string]*string{"BR": testUtils.ToPtr("Brazil"), "PT": testUtils.ToPtr("Port\tugal"),
+		"XX": nil}, countries)
+}
+
+func (s *MigrationTestSuite) TestExecuteMigration() {
+	checksum := "0a52730597fb4ffa01fc117d9e71e3a9"
+	content := "INVALID SQL"
+	migration := &migrations.Migration{
+		Version:     1,
+		Description: "abcd",
+		Type:        enums.MIGRATION_UP,
+		Checksum:    &checksum,
+		Content:     &content,
+		Author:      "Jane Doe <jane@example.com>",
+		Ticket:      "OPS-123",
+	}
+
+	// Invalid SQL
+	errs := s.repository.ExecuteMigration(migration)
+	s.Assert().Len(errs, 2)
+
+	*migration.Content = "CREATE TABLE test (id INT NOT NULL PRIMARY KEY);"
+
+	// No schema table
+	errs = s.repository.ExecuteMigration(migration)
+	s.Assert().Len(errs, 1)
+
+	err := s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+
+	// Several statements, with a routine, are sent at once
+	*migration.Content = `
+		CREATE TABLE test2 (id INT NOT NULL PRIMARY KEY);
+		CREATE PROCEDURE add_test2(IN p_id INT)
+		BEGIN
+			INSERT INTO test2 VALUES (p_id);
+		END;
+		CALL add_test2(1);
+	`
+
+	errs = s.repository.ExecuteMigration(migration)
+	s.Assert().Nil(errs)
+
+	s.checkTableExists(default_history_table, true)
+	s.checkTableExists("test2", true)
+
+	applied, err := s.repository.GetAppliedMigrations()
+	s.Assert().NoError(err)
+	s.Require().Len(applied, 1)
+	s.Assert().Equal(migration.Version, applied[0].Version)
+	s.Assert().Equal(migration.Description, applied[0].Description)
+	s.Assert().Equal(*migration.Checksum, applied[0].Checksum)
+	s.Assert().True(applied[0].Success)
+	s.Assert().Equal(migration.Author, applied[0].Author)
+	s.Assert().Equal(migration.Ticket, applied[0].Ticket)
+}
+
+func (s *MigrationTestSuite) TestExecuteAssertion() {
+	content := "SELECT 1 = 1"
+	hook := &migrations.Hook{
+		Order:   1,
+		Content: &content,
+		Type:    enums.HOOK_ASSERTION,
+	}
+
+	err := s.repository.ExecuteAssertion(hook)
+	s.Assert().NoError(err)
+
+	*hook.Content = "SELECT 1 = 2"
+	err = s.repository.ExecuteAssertion(hook)
+	s.Assert().ErrorContains(err, "returned false")
+
+	*hook.Content = "SELECT 1 FROM information_schema.tables WHERE false"
+	err = s.repository.ExecuteAssertion(hook)
+	s.Assert().NoError(err)
+}
+
+func (s *MigrationTestSuite) TestRollbackMigration() {
+	content := "INVALID SQL"
+	migration := &migrations.Migration{
+		Version:     1,
+		Description: "abcd",
+		Type:        enums.MIGRATION_DOWN,
+		Content:     &content,
+	}
+
+	err := s.repository.RollbackMigration(migration)
+	s.Assert().Error(err)
+
+	*migration.Content = "DROP TABLE IF EXISTS test4;"
+
+	err = s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+
+	// Versions not applied are not rolled back
+	err = s.repository.RollbackMigration(migration)
+	s.Assert().NoError(err)
+
+	_, err = s.suiteDb.ExecContext(s.ctx, "CREATE TABLE test4 (id INT NOT NULL PRIMARY KEY);")
+	s.Assert().NoError(err)
+	_, err = s.suiteDb.ExecContext(s.ctx, fmt.Sprintf(`
+		INSERT INTO %s (version, description, md5_checksum, success)
+		VALUES (1, 'abcd', '0a52730597fb4ffa01fc117d9e71e3a9', true);
+	`, default_history_table))
+	s.Assert().NoError(err)
+
+	s.checkTableExists("test4", true)
+
+	err = s.repository.RollbackMigration(migration)
+	s.Assert().NoError(err)
+
+	s.checkTableExists("test4", false)
+
+	version, err := s.repository.GetLatestMigration()
+	s.Assert().NoError(err)
+	s.Assert().Equal(uint16(0), version)
+}
+
+func (s *MigrationTestSuite) TestDoInTransaction() {
+	_, err := s.suiteDb.ExecContext(s.ctx, "CREATE TABLE test1 (id INT NOT NULL PRIMARY KEY);")
+	s.Require().NoError(err)
+
+	// Data changes are rolled back, DDL statements would commit them
+	err = s.repository.DoInTransaction(func() error {
+		_, err := s.repository.queriable.ExecContext(s.ctx, "INSERT INTO test1 VALUES (1);")
+		s.Assert().NoError(err)
+
+		return fmt.Errorf("example error")
+	})
+	s.Assert().Error(err)
+
+	count := 0
+	err = s.suiteDb.QueryRowContext(s.ctx, "SELECT COUNT(*) FROM test1;").Scan(&count)
+	s.Assert().NoError(err)
+	s.Assert().Equal(0, count)
+
+	s.Assert().False(s.repository.Capabilities().SupportsTransactions)
+}
+
+func (s *MigrationTestSuite) TestDoInLock() {
+	info, err := s.repository.GetLockInfo()
+	s.Assert().NoError(err)
+	s.Assert().False(info.Locked)
+
+	err = s.repository.DoInLock(func() error {
+		info, err := s.repository.GetLockInfo()
+		s.Assert().NoError(err)
+		s.Assert().True(info.Locked)
+		s.Assert().Contains(info.Owner, "user test_user@")
+
+		// Other sessions wait for the lock
+		locked := 1
+		err = s.suiteDb.QueryRowContext(s.ctx, "SELECT GET_LOCK("+lock_name+", 0);",
+			default_history_table).Scan(&locked)
+		s.Assert().NoError(err)
+		s.Assert().Equal(0, locked)
+		return nil
+	})
+	s.Assert().NoError(err)
+
+	info, err = s.repository.GetLockInfo()
+	s.Assert().NoError(err)
+	s.Assert().False(info.Locked)
+}
+
+func (s *MigrationTestSuite) TestRepair() {
+	checksums := []string{"0a52730597fb4ffa01fc117d9e71e3a9", "3d41c8443df34e73867adb149efbb2ea"}
+	contents := []string{"EXAMPLE CONTENT 1", "EXAMPLE CONTENT 2"}
+	migrations := []*migrations.Migration{
+		{
+			Version:     1,
+			Description: "abcd",
+			Type:        enums.MIGRATION_UP,
+			Checksum:    &checksums[0],
+			Content:     &contents[0],
+		},
+		{
+			Version:     2,
+			Description: "abcd",
+			Type:        enums.MIGRATION_UP,
+			Checksum:    &checksums[1],
+			Content:     &contents[1],
+		},
+	}
+
+	err := s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+
+	// Simulate a checksum mismatch
+	query := fmt.Sprintf(`
+		INSERT INTO %s (version, description, md5_checksum, success) VALUES
+			(?, ?, 'd41d8cd98f00b204e9800998ecf8427e', false);
+	`, default_history_table)
+
+	_, err = s.suiteDb.ExecContext(s.ctx, query, migrations[0].Version, migrations[0].Description)
+	s.Assert().NoError(err)
+
+	errs := s.repository.Repair(migrations)
+	s.Assert().Nil(errs)
+
+	query = fmt.Sprintf(`
+		SELECT md5_checksum, repaired_at IS NOT NULL FROM %s WHERE version = ?;
+	`, default_history_table)
+
+	repairedChecksum, repaired := "", false
+	err = s.suiteDb.QueryRowContext(s.ctx, query, migrations[0].Version).Scan(&repairedChecksum, &repaired)
+	s.Assert().NoError(err)
+	s.Assert().Equal(*migrations[0].Checksum, repairedChecksum)
+	s.Assert().True(repaired)
+
+	// Missing migrations are inserted
+	err = s.suiteDb.QueryRowContext(s.ctx, query, migrations[1].Version).Scan(&repairedChecksum, &repaired)
+	s.Assert().NoError(err)
+	s.Assert().Equal(*migrations[1].Checksum, repairedChecksum)
+}
+
+func (s *MigrationTestSuite) TestHistoryInstalledRank() {
+	// History table of a previous version, without the installed_rank column, with versions applied out of order
+	_, err := s.suiteDb.ExecContext(s.ctx, fmt.Sprintf(`
+		CREATE TABLE %[1]s (
+			version SMALLINT NOT NULL PRIMARY KEY,
+			description VARCHAR(255) NOT NULL,
+			md5_checksum CHAR(32) NOT NULL,
+			success BOOLEAN NOT NULL DEFAULT false,
+			executed_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			repaired_at DATETIME
+		);
+	`, default_history_table))
+	s.Require().NoError(err)
+
+	_, err = s.suiteDb.ExecContext(s.ctx, fmt.Sprintf(`
+		INSERT INTO %[1]s (version, description, md5_checksum, success, executed_at) VALUES
+			(1, 'abcd', 'checksum', true, '2024-01-02 00:00:00'), (2, 'efgh', 'checksum', true, '2024-01-01 00:00:00');
+	`, default_history_table))
+	s.Require().NoError(err)
+
+	ranks := func() []int64 {
+		applied, err := s.repository.GetAppliedMigrations()
+		s.Require().NoError(err)
+
+		ranks := make([]int64, 0, len(applied))
+		for _, migration := range applied {
+			ranks = append(ranks, migration.InstalledRank)
+		}
+		return ranks
+	}
+
+	// The history is read before the table is upgraded, e.g. by status
+	s.Assert().Equal([]int64{0, 0}, ranks())
+
+	// The rows are ranked in the order of their executions
+	err = s.repository.AssertSchemaHistoryTable()
+	s.Require().NoError(err)
+	s.Assert().Equal([]int64{2, 1}, ranks())
+
+	checksum := "0a52730597fb4ffa01fc117d9e71e3a9"
+	content := "SELECT 1;"
+	migration := &migrations.Migration{
+		Version:     1,
+		Description: "abcd",
+		Type:        enums.MIGRATION_UP,
+		Checksum:    &checksum,
+		Content:     &content,
+	}
+
+	// Repaired versions keep their rank, executed ones are ranked last
+	errs := s.repository.Repair([]*migrations.Migration{migration})
+	s.Require().Nil(errs)
+	s.Assert().Equal([]int64{2, 1}, ranks())
+
+	migration.Version = 3
+	errs = s.repository.ExecuteMigration(migration)
+	s.Require().Nil(errs)
+	s.Assert().Equal([]int64{2, 1, 3}, ranks())
+
+	migration.Version = 2
+	errs = s.repository.ExecuteMigration(migration)
+	s.Require().Nil(errs)
+	s.Assert().Equal([]int64{2, 4, 3}, ranks())
+}
+
+func (s *MigrationTestSuite) TestCopyHistory() {
+	// History table of a previous version, without the optional columns
+	_, err := s.suiteDb.ExecContext(s.ctx, `
+		CREATE TABLE old_history (
+			version SMALLINT NOT NULL PRIMARY KEY,
+			description VARCHAR(255) NOT NULL,
+			md5_checksum CHAR(32) NOT NULL,
+			success BOOLEAN NOT NULL DEFAULT false,
+			executed_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+		);
+	`)
+	s.Require().NoError(err)
+
+	_, err = s.suiteDb.ExecContext(s.ctx, `
+		INSERT INTO old_history (version, description, md5_checksum, success, executed_at) VALUES
+			(1, 'abcd', 'checksum', true, '2024-01-02 00:00:00'), (2, 'efgh', 'checksum', false, '2024-01-01 00:00:00');
+	`)
+	s.Require().NoError(err)
+
+	err = s.repository.AssertSchemaHistoryTable()
+	s.Require().NoError(err)
+
+	copied, err := s.repository.CopyHistoryFrom("old_history")
+	s.Require().NoError(err)
+	s.Assert().Equal(int64(2), copied)
+
+	applied, err := s.repository.GetAppliedMigrations()
+	s.Require().NoError(err)
+	s.Assert().Equal([]*database.AppliedMigration{
+		{Version: 1, Description: "abcd", Checksum: "checksum", Success: true, InstalledRank: 2,
+			ExecutedAt: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{Version: 2, Description: "efgh", Checksum: "checksum", Success: false, InstalledRank: 1,
+			ExecutedAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}, applied)
+
+	// The previous table is kept in sync, replacing its rows
+	_, err = s.suiteDb.ExecContext(s.ctx, fmt.Sprintf("DELETE FROM %s WHERE version = 2;", default_history_table))
+	s.Require().NoError(err)
+
+	copied, err = s.repository.CopyHistoryTo("old_history")
+	s.Require().NoError(err)
+	s.Assert().Equal(int64(1), copied)
+}
+
+func (s *MigrationTestSuite) TestAnnotate() {
+	err := s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+
+	err = s.repository.Annotate(1, "note")
+	s.Assert().Error(err)
+
+	_, err = s.suiteDb.ExecContext(s.ctx, fmt.Sprintf(`
+		INSERT INTO %s (version, description, md5_checksum, success)
+		VALUES (1, 'abcd', '0a52730597fb4ffa01fc117d9e71e3a9', true);
+	`, default_history_table))
+	s.Assert().NoError(err)
+
+	// Setting the same note twice changes no row
+	for range 2 {
+		err = s.repository.Annotate(1, "note")
+		s.Assert().NoError(err)
+	}
+
+	note := ""
+	err = s.suiteDb.QueryRowContext(s.ctx, fmt.Sprintf("SELECT notes FROM %s WHERE version = 1;",
+		default_history_table)).Scan(&note)
+	s.Assert().NoError(err)
+	s.Assert().Equal("note", note)
+}
+
+func (s *MigrationTestSuite) TestPruneHistory() {
+	versions, err := s.repository.PruneHistory(1)
+	s.Assert().NoError(err)
+	s.Assert().Empty(versions)
+
+	err = s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+
+	_, err = s.suiteDb.ExecContext(s.ctx, fmt.Sprintf(`
+		INSERT INTO %s (version, description, md5_checksum, success)
+		VALUES (1, 'a', '0a52730597fb4ffa01fc117d9e71e3a9', true), (2, 'b', '0a52730597fb4ffa01fc117d9e71e3a9', true),
+			(3, 'c', '0a52730597fb4ffa01fc117d9e71e3a9', false);
+	`, default_history_table))
+	s.Require().NoError(err)
+
+	versions, err = s.repository.PruneHistory(1)
+	s.Assert().NoError(err)
+	s.Assert().Equal([]uint16{2, 3}, versions)
+
+	latest, err := s.repository.GetLatestMigration()
+	s.Assert().NoError(err)
+	s.Assert().Equal(uint16(1), latest)
+}
+
+func (s *MigrationTestSuite) TestCheckHistorySchema() {
+	err := s.repository.CheckHistorySchema()
+	s.Assert().NoError(err)
+
+	err = s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+
+	err = s.repository.CheckHistorySchema()
+	s.Assert().NoError(err)
+
+	// Incompatible columns are reported with the statements upgrading them
+	_, err = s.suiteDb.ExecContext(s.ctx, fmt.Sprintf(`
+		ALTER TABLE %[1]s DROP COLUMN md5_checksum;
+		ALTER TABLE %[1]s MODIFY COLUMN repaired_at VARCHAR(32);
+	`, default_history_table))
+	s.Require().NoError(err)
+
+	err = s.repository.CheckHistorySchema()
+	s.Assert().ErrorContains(err, "column md5_checksum is missing, column repaired_at has type varchar instead of "+
+		"a timestamp type. Upgrade it with: ALTER TABLE schema_history ADD COLUMN md5_checksum CHAR(32) NOT NULL "+
+		"DEFAULT ''; ALTER TABLE schema_history MODIFY COLUMN repaired_at DATETIME;")
+
+	var schemaErr *database.HistorySchemaError
+	s.Require().ErrorAs(err, &schemaErr)
+
+	for _, statement := range schemaErr.Upgrade {
+		_, err = s.suiteDb.ExecContext(s.ctx, statement)
+		s.Require().NoError(err)
+	}
+
+	err = s.repository.CheckHistorySchema()
+	s.Assert().NoError(err)
+}
+
+func (s *MigrationTestSuite) TestGetFailingMigrations() {
+	err := s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+
+	query := fmt.Sprintf(`
+		INSERT INTO %s (version, description, md5_checksum, success) VALUES
+			(1, 't', '0a52730597fb4ffa01fc117d9e71e3a9', false),
+			(2, 't', '0a52730597fb4ffa01fc117d9e71e3a9', true),
+			(3, 't', '0a52730597fb4ffa01fc117d9e71e3a9', false);
+	`, default_history_table)
+
+	_, err = s.suiteDb.Exec(query)
+	s.Assert().NoError(err)
+
+	failingMigrations, err := s.repository.GetFailingMigrations()
+	s.Assert().NoError(err)
+	s.Assert().Len(failingMigrations, 2)
+	s.Assert().Equal(uint16(1), failingMigrations[0].Version)
+	s.Assert().Equal(uint16(3), failingMigrations[1].Version)
+}
+
+func (s *MigrationTestSuite) TestClean() {
+	err := s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+
+	_, err = s.suiteDb.ExecContext(s.ctx, `
+		CREATE SEQUENCE clean_seq;
+		CREATE TABLE clean_parent (id INT PRIMARY KEY);
+		CREATE TABLE clean_child (id INT PRIMARY KEY, parent_id INT REFERENCES clean_parent (id));
+		CREATE VIEW clean_view AS SELECT id FROM clean_child;
+		CREATE FUNCTION clean_function() RETURNS INT RETURN 1;
+	`)
+	s.Require().NoError(err)
+
+	err = s.repository.DoInLock(func() error {
+		return s.repository.Clean()
+	})
+	s.Assert().NoError(err)
+
+	s.checkTableExists(default_history_table, false)
+	s.checkTableExists("clean_parent", false)
+	s.checkTableExists("clean_child", false)
+	s.checkTableExists("clean_view", false)
+	s.checkTableExists("clean_seq", false)
+
+	routines := 0
+	err = s.suiteDb.QueryRowContext(s.ctx, `
+		SELECT COUNT(*) FROM information_schema.routines WHERE routine_schema = DATABASE();
+	`).Scan(&routines)
+	s.Assert().NoError(err)
+	s.Assert().Equal(0, routines)
+
+	// The foreign key checks of the connections are restored
+	checks := 0
+	err = s.suiteDb.QueryRowContext(s.ctx, "SELECT @@foreign_key_checks;").Scan(&checks)
+	s.Assert().NoError(err)
+	s.Assert().Equal(1, checks)
+}
+
+func (s *MigrationTestSuite) TestRunConcurrent() {
+	maestrotest.RunConcurrent(s.T(), 4, &maestrotest.Config{
+		NewRepository: func(t testing.TB) database.Repository {
+			db, err := sql.Open("mysql", s.mariadb.DSN)
+			s.Require().NoError(err)
+			t.Cleanup(func() { db.Close() })
+
+			return NewMariaDBRepository(s.ctx, db, testUtils.ToPtr(default_history_table))
+		},
+		Migrations: []string{
+			"CREATE TABLE concurrent1 (id INT PRIMARY KEY);",
+			"CREATE TABLE concurrent2 (id INT PRIMARY KEY);",
+			"CREATE TABLE concurrent3 (id INT PRIMARY KEY);",
+		},
+	})
+}
@@ -0,0 +1,16 @@
+package database
+
+import "fmt"
+
+// MismatchError reports an applied migration of the schema history table whose description or checksum
+// does not match the local migration of the same version, or that has no local migration.
+type MismatchError struct {
+	Version     uint16
+	Description string
+	Checksum    string
+}
+
+func (e *MismatchError) Error() string {
+	return fmt.Sprintf("invalid migration found: version: %d, description: %s, md5_checksum: %s."+
+		" Please check your local migration and changes", e.Version, e.Description, e.Checksum)
+}
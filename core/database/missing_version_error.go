@@ -0,0 +1,12 @@
+package database
+
+import "fmt"
+
+// MissingVersionError reports a version missing in the schema history table below a version it has.
+type MissingVersionError struct {
+	Version uint16
+}
+
+func (e *MissingVersionError) Error() string {
+	return fmt.Sprintf("missing version %d in the schema history table", e.Version)
+}
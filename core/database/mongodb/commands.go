@@ -0,0 +1,51 @@
+package mongodb
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// ParseCommands parses the database commands of a migration or hook file. The files contain either a single
+// command document or an array of commands, in MongoDB Extended JSON, executed in order with runCommand:
+//
+//	[
+//	  {"create": "users"},
+//	  {"createIndexes": "users", "indexes": [{"key": {"email": 1}, "name": "email_1", "unique": true}]},
+//	  {"insert": "roles", "documents": [{"_id": "admin", "createdAt": {"$date": "2024-01-01T00:00:00Z"}}]}
+//	]
+//
+// The order of the fields of the commands is kept, as the first field is the name of the command. Empty files
+// have no commands.
+func ParseCommands(content string) ([]bson.D, error) {
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return nil, nil
+	}
+
+	documents := []json.RawMessage{json.RawMessage(content)}
+	if strings.HasPrefix(content, "[") {
+		documents = nil
+		err := json.Unmarshal([]byte(content), &documents)
+		if err != nil {
+			return nil, fmt.Errorf("invalid commands: %w", err)
+		}
+	}
+
+	commands := make([]bson.D, 0, len(documents))
+	for i, document := range documents {
+		command := bson.D{}
+		err := bson.UnmarshalExtJSON(document, false, &command)
+		if err != nil {
+			return nil, fmt.Errorf("command %d: invalid command: %w", i+1, err)
+		}
+		if len(command) == 0 {
+			return nil, fmt.Errorf("command %d: empty command", i+1)
+		}
+		commands = append(commands, command)
+	}
+
+	return commands, nil
+}
@@ -0,0 +1,74 @@
+package mongodb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestParseCommands(t *testing.T) {
+	content := `[
+		{"create": "users"},
+		{"createIndexes": "users", "indexes": [{"key": {"email": 1}, "name": "email_1", "unique": true}]},
+		{"insert": "roles", "documents": [{"_id": "admin", "createdAt": {"$date": "2024-01-01T00:00:00Z"}}]}
+	]`
+
+	commands, err := ParseCommands(content)
+	assert.NoError(t, err)
+	assert.Len(t, commands, 3)
+
+	assert.Equal(t, bson.D{{Key: "create", Value: "users"}}, commands[0])
+	assert.Equal(t, "createIndexes", commands[1][0].Key)
+	assert.Equal(t, "indexes", commands[1][1].Key)
+
+	// Extended JSON types are decoded
+	documents := commands[2][1].Value.(bson.A)
+	createdAt := documents[0].(bson.D)[1].Value.(bson.DateTime)
+	assert.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), createdAt.Time().UTC())
+
+	// Single commands
+	commands, err = ParseCommands(`{"drop": "legacy"}`)
+	assert.NoError(t, err)
+	assert.Equal(t, []bson.D{{{Key: "drop", Value: "legacy"}}}, commands)
+
+	commands, err = ParseCommands("  \n")
+	assert.NoError(t, err)
+	assert.Empty(t, commands)
+}
+
+func TestParseCommandsErrors(t *testing.T) {
+	_, err := ParseCommands(`[{"create": "users"}, {"create": }]`)
+	assert.ErrorContains(t, err, "invalid commands")
+
+	_, err = ParseCommands(`[{"create": "users"}, {}]`)
+	assert.EqualError(t, err, "command 2: empty command")
+
+	_, err = ParseCommands(`[{"create": "users"}, "users"]`)
+	assert.ErrorContains(t, err, "command 2: invalid command")
+}
+
+func TestCheckAssertion(t *testing.T) {
+	reply := func(document bson.D) bson.Raw {
+		raw, err := bson.Marshal(document)
+		assert.NoError(t, err)
+		return raw
+	}
+
+	cursor := func(documents ...any) bson.D {
+		return bson.D{{Key: "cursor", Value: bson.D{{Key: "firstBatch", Value: append(bson.A{}, documents...)}}}, {Key: "ok", Value: 1}}
+	}
+
+	assert.NoError(t, checkAssertion(reply(cursor())))
+	assert.EqualError(t, checkAssertion(reply(cursor(bson.D{{Key: "_id", Value: 1}}))),
+		"assertion failed: command returned 1 documents")
+
+	assert.NoError(t, checkAssertion(reply(bson.D{{Key: "n", Value: int32(0)}, {Key: "ok", Value: 1}})))
+	assert.EqualError(t, checkAssertion(reply(bson.D{{Key: "n", Value: int32(3)}, {Key: "ok", Value: 1}})),
+		"assertion failed: command returned 3")
+
+	assert.NoError(t, checkAssertion(reply(bson.D{{Key: "values", Value: bson.A{}}, {Key: "ok", Value: 1}})))
+	assert.EqualError(t, checkAssertion(reply(bson.D{{Key: "ok", Value: 1}})),
+		"assertion failed: command returned neither documents nor a count")
+}
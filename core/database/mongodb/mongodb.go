@@ -0,0 +1,715 @@
+// Package mongodb implements the maestro repository for MongoDB, executing migrations of database
+// commands (see ParseCommands) with runCommand.
+//
+// The schema history is stored in a collection, with a document per version, and a lock document
+// inserted with a fixed _id coordinates concurrent executions. The lock document is a lease expiring after
+// lock_ttl unless refreshed, which is done between the commands of the migrations, so the lock of a killed
+// process is taken over by later runs. Commands are executed one at a time
+// without transactions: failed migrations are recorded in the history and must be fixed and repaired
+// manually.
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/maestro-go/maestro/core/database"
+	"github.com/maestro-go/maestro/core/enums"
+	"github.com/maestro-go/maestro/internal/conf"
+	"github.com/maestro-go/maestro/internal/migrations"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const default_history_collection = "schema_history"
+const lock_collection = "schema_lock"
+const lock_id = "lock"
+
+// lock_ttl is the time the lock document is kept without being refreshed. A single command running longer than
+// it lets another process take the lock over.
+const lock_ttl = 2 * time.Minute
+
+// namespace_exists is the code of the error of creating a collection that already exists.
+const namespace_exists = 48
+
+type historyDocument struct {
+	Version     uint16     `bson:"_id"`
+	Description string     `bson:"description"`
+	Checksum    string     `bson:"md5_checksum"`
+	Success     bool       `bson:"success"`
+	ExecutedAt  time.Time  `bson:"executed_at"`
+	RepairedAt  *time.Time `bson:"repaired_at,omitempty"`
+	Notes       string     `bson:"notes,omitempty"`
+	RunID       string     `bson:"run_id,omitempty"`
+	Author      string     `bson:"author,omitempty"`
+	Ticket      string     `bson:"ticket,omitempty"`
+	Skipped     bool       `bson:"skipped"`
+}
+
+type lockDocument struct {
+	ID        string    `bson:"_id"`
+	Owner     string    `bson:"owner"`
+	LockedAt  time.Time `bson:"locked_at"`
+	ExpiresAt time.Time `bson:"expires_at"`
+}
+
+type MongoDBRepository struct {
+	database.Repository
+	ctx                context.Context
+	db                 *mongo.Database
+	history_collection string
+	run                database.RunInfo
+
+	locked        bool      // Whether the lock document was inserted by the repository
+	lockRefreshed time.Time // Last time the expiry of the lock document was set
+}
+
+// NewMongoDBRepository returns a repository executing commands on the given database of a connected client.
+func NewMongoDBRepository(ctx context.Context, db *mongo.Database, history_collection *string) *MongoDBRepository {
+	repo := &MongoDBRepository{
+		ctx: ctx,
+		db:  db,
+		run: database.RunInfo{MaestroVersion: conf.VERSION},
+	}
+
+	if history_collection != nil {
+		repo.history_collection = *history_collection
+	} else {
+		repo.history_collection = default_history_collection
+	}
+
+	return repo
+}
+
+func (r *MongoDBRepository) history() *mongo.Collection {
+	return r.db.Collection(r.history_collection)
+}
+
+func (r *MongoDBRepository) GetLatestMigration() (uint16, error) {
+	documents, err := r.historyDocuments(bson.D{{Key: "success", Value: true}})
+	if err != nil {
+		return 0, err
+	}
+
+	if len(documents) == 0 {
+		return 0, nil
+	}
+
+	return documents[len(documents)-1].Version, nil
+}
+
+// AssertSchemaHistoryTable creates the history and audit collections if missing.
+func (r *MongoDBRepository) AssertSchemaHistoryTable() error {
+	for _, collection := range []string{r.auditCollection(), r.history_collection} {
+		err := r.db.CreateCollection(r.ctx, collection)
+		var commandErr mongo.CommandError
+		if errors.As(err, &commandErr) && commandErr.Code == namespace_exists {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *MongoDBRepository) CheckSchemaHistoryTable() (bool, error) {
+	names, err := r.db.ListCollectionNames(r.ctx, bson.D{{Key: "name", Value: r.history_collection}})
+	if err != nil {
+		return false, err
+	}
+
+	return len(names) > 0, nil
+}
+
+func (r *MongoDBRepository) ValidateMigrations(localMigrations []*migrations.Migration) []error {
+	if len(localMigrations) < 1 {
+		return nil
+	}
+
+	byVersion := make(map[uint16]*migrations.Migration, len(localMigrations))
+	for _, migration := range localMigrations {
+		if migration.Type != enums.MIGRATION_UP {
+			return []error{fmt.Errorf("invalid migration type: %s", migration.Type.Name())}
+		}
+		byVersion[migration.Version] = migration
+	}
+
+	documents, err := r.historyDocuments(bson.D{})
+	if err != nil {
+		return []error{err}
+	}
+
+	errs := make([]error, 0)
+	expectedVersion := uint16(1)
+
+	for _, document := range documents {
+		// Check gaps
+		if expectedVersion != document.Version {
+			errs = append(errs, &database.MissingVersionError{Version: expectedVersion})
+		}
+		expectedVersion = document.Version + 1
+
+		// Check description or checksum mismatch
+		local, ok := byVersion[document.Version]
+		if document.Success && (!ok || local.Description != document.Description || *local.Checksum != document.Checksum) {
+			errs = append(errs, &database.MismatchError{Version: document.Version, Description: document.Description,
+				Checksum: document.Checksum})
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (r *MongoDBRepository) ExecuteMigration(migration *migrations.Migration) []error {
+	if migration.Type != enums.MIGRATION_UP {
+		return []error{fmt.Errorf("invalid migration type: %s", migration.Type.Name())}
+	}
+
+	errs := make([]error, 0)
+
+	err := r.execCommands(*migration.Content, migration.SkipStatements)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	success := err == nil
+
+	err = r.saveHistory(migration, success, false)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("migration %d: %w", migration.Version, err))
+	} else {
+		err = r.audit(migration, database.AUDIT_UP, success)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("migration %d: %w", migration.Version, err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// saveHistory upserts the migration in the history collection with the given status, and whether it was skipped
+// without being executed. The repaired_at and notes fields of existing versions are kept.
+func (r *MongoDBRepository) saveHistory(migration *migrations.Migration, success bool, skipped bool) error {
+	_, err := r.history().UpdateOne(r.ctx, bson.D{{Key: "_id", Value: migration.Version}}, bson.D{{Key: "$set", Value: bson.D{
+		{Key: "description", Value: migration.Description},
+		{Key: "md5_checksum", Value: *migration.Checksum},
+		{Key: "success", Value: success},
+		{Key: "executed_at", Value: time.Now().UTC()},
+		{Key: "run_id", Value: r.run.ID},
+		{Key: "author", Value: migration.Author},
+		{Key: "ticket", Value: migration.Ticket},
+		{Key: "skipped", Value: skipped},
+	}}}, options.UpdateOne().SetUpsert(true))
+	return err
+}
+
+// SkipMigration records the migration as applied and skipped in the history collection without executing it, and
+// records the skip in the audit collection.
+func (r *MongoDBRepository) SkipMigration(migration *migrations.Migration) error {
+	if migration.Type != enums.MIGRATION_UP {
+		return fmt.Errorf("invalid migration type: %s", migration.Type.Name())
+	}
+
+	err := r.saveHistory(migration, true, true)
+	if err != nil {
+		return fmt.Errorf("migration %d: %w", migration.Version, err)
+	}
+
+	return r.audit(migration, database.AUDIT_SKIP, true)
+}
+
+func (r *MongoDBRepository) ExecuteHook(hook *migrations.Hook) error {
+	return r.execCommands(*hook.Content, 0)
+}
+
+// ExecuteAssertion executes the single command of the assertion hook, e.g. a find, aggregate or count command.
+// The assertion passes if the command returns no documents or a count of 0.
+func (r *MongoDBRepository) ExecuteAssertion(hook *migrations.Hook) error {
+	commands, err := ParseCommands(*hook.Content)
+	if err != nil {
+		return err
+	}
+
+	if len(commands) != 1 {
+		return fmt.Errorf("assertion must contain a single command, found %d", len(commands))
+	}
+
+	reply, err := r.db.RunCommand(r.ctx, commands[0]).Raw()
+	if err != nil {
+		return err
+	}
+
+	return checkAssertion(reply)
+}
+
+// checkAssertion returns an error unless the reply of the command of an assertion hook is empty: a cursor
+// without documents (find, aggregate), a count of 0 (count) or no values (distinct).
+func checkAssertion(reply bson.Raw) error {
+	if batch, err := reply.LookupErr("cursor", "firstBatch"); err == nil {
+		array, _ := batch.ArrayOK()
+		documents, _ := array.Values()
+		if len(documents) == 0 {
+			return nil
+		}
+		return fmt.Errorf("assertion failed: command returned %d documents", len(documents))
+	}
+
+	if n, err := reply.LookupErr("n"); err == nil {
+		count, ok := n.AsInt64OK()
+		if !ok {
+			return fmt.Errorf("assertion failed: command returned an invalid count %s", n)
+		}
+		if count == 0 {
+			return nil
+		}
+		return fmt.Errorf("assertion failed: command returned %d", count)
+	}
+
+	if values, err := reply.LookupErr("values"); err == nil {
+		array, _ := values.ArrayOK()
+		items, _ := array.Values()
+		if len(items) == 0 {
+			return nil
+		}
+		return fmt.Errorf("assertion failed: command returned %d values", len(items))
+	}
+
+	return fmt.Errorf("assertion failed: command returned neither documents nor a count")
+}
+
+func (r *MongoDBRepository) RollbackMigration(migration *migrations.Migration) error {
+	if migration.Type != enums.MIGRATION_DOWN {
+		return fmt.Errorf("invalid migration type: %s", migration.Type.Name())
+	}
+
+	document, err := r.historyDocument(migration.Version)
+	if err != nil {
+		return err
+	}
+
+	if document == nil {
+		return nil
+	}
+
+	err = r.execCommands(*migration.Content, 0)
+	if err != nil {
+		return err
+	}
+
+	result, err := r.history().DeleteOne(r.ctx, bson.D{{Key: "_id", Value: migration.Version}})
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount != 1 {
+		return fmt.Errorf("version was not deleted from \"%s\" collection", r.history_collection)
+	}
+
+	return r.audit(migration, database.AUDIT_DOWN, true)
+}
+
+// ServerInfo returns the version of the server and the name of the database. The history rows are the documents
+// of the history collection.
+func (r *MongoDBRepository) ServerInfo() (*database.ServerInfo, error) {
+	reply, err := r.db.RunCommand(r.ctx, bson.D{{Key: "buildInfo", Value: 1}}).Raw()
+	if err != nil {
+		return nil, err
+	}
+
+	info := &database.ServerInfo{Schema: r.db.Name(), HistoryTable: r.history_collection}
+	info.Version, _ = reply.Lookup("version").StringValueOK()
+
+	info.HistoryTableExists, err = r.CheckSchemaHistoryTable()
+	if err != nil || !info.HistoryTableExists {
+		return info, err
+	}
+
+	info.HistoryRows, err = r.history().CountDocuments(r.ctx, bson.D{})
+	if err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
+
+func (r *MongoDBRepository) Capabilities() database.Capabilities {
+	return database.Capabilities{
+		SupportsTransactions:   false,
+		SupportsAdvisoryLock:   false,
+		SupportsMultiStatement: false,
+		MaxIdentifierLength:    0,
+	}
+}
+
+func (r *MongoDBRepository) SetRunInfo(info database.RunInfo) {
+	r.run = info
+}
+
+func (r *MongoDBRepository) auditCollection() string {
+	return r.history_collection + "_audit"
+}
+
+// audit records the execution of the migration in the audit collection.
+func (r *MongoDBRepository) audit(migration *migrations.Migration, direction string, success bool) error {
+	_, err := r.db.Collection(r.auditCollection()).InsertOne(r.ctx, bson.D{
+		{Key: "run_id", Value: r.run.ID},
+		{Key: "maestro_version", Value: r.run.MaestroVersion},
+		{Key: "direction", Value: direction},
+		{Key: "version", Value: migration.Version},
+		{Key: "description", Value: migration.Description},
+		{Key: "success", Value: success},
+		{Key: "executed_at", Value: time.Now().UTC()},
+	})
+	if err != nil {
+		return fmt.Errorf("error recording audit: %w", err)
+	}
+
+	return nil
+}
+
+// DoInTransaction runs the callback: transactions need a replica set and can not create collections
+// before MongoDB 4.4, so commands are executed one at a time.
+func (r *MongoDBRepository) DoInTransaction(fn func() error) error {
+	return fn()
+}
+
+// DoOutsideTransaction runs the callback, as DoInTransaction does not start a transaction.
+func (r *MongoDBRepository) DoOutsideTransaction(fn func() error) error {
+	return fn()
+}
+
+// Session returns a repository sharing the client of this one, with its own run info.
+func (r *MongoDBRepository) Session() database.Repository {
+	session := *r
+	return &session
+}
+
+// lockCollection returns the lock collection of the history collection, so the migrations of several history
+// collections of the same database do not block each other.
+func (r *MongoDBRepository) lockCollection() *mongo.Collection {
+	if r.history_collection == default_history_collection {
+		return r.db.Collection(lock_collection)
+	}
+	return r.db.Collection(r.history_collection + "_lock")
+}
+
+// GetLockInfo reports whether the lock document exists and has not expired, with the run and holder it was
+// inserted by.
+func (r *MongoDBRepository) GetLockInfo() (*database.LockInfo, error) {
+	lock := new(lockDocument)
+	err := r.lockCollection().FindOne(r.ctx, bson.D{{Key: "_id", Value: lock_id}}).Decode(lock)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return &database.LockInfo{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Lock documents of previous versions have no expiry
+	if !lock.ExpiresAt.IsZero() && lock.ExpiresAt.Before(time.Now()) {
+		return &database.LockInfo{}, nil
+	}
+
+	lockedAt := lock.LockedAt.UTC()
+	return &database.LockInfo{Locked: true, Owner: lock.Owner, LockedAt: &lockedAt}, nil
+}
+
+func (r *MongoDBRepository) DoInLock(fn func() error) error {
+	err := r.lock()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = r.unlock()
+		if err != nil {
+			panic(fmt.Errorf("failed to delete lock document: %w", err))
+		}
+	}()
+
+	err = fn()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// This function ensures that only one instance of the application can perform schema migrations at a time.
+// It achieves this by inserting the lock document, whose _id is unique, or by taking over the lock document
+// once it expired. If the document exists, it waits for up to 1 minute for the document to be deleted by another
+// instance, indicating that the migration process has completed, or to expire.
+func (r *MongoDBRepository) lock() error {
+	for range 12 {
+		now := time.Now().UTC()
+		lock := &lockDocument{ID: lock_id, Owner: r.lockOwner(), LockedAt: now, ExpiresAt: now.Add(lock_ttl)}
+
+		_, err := r.lockCollection().InsertOne(r.ctx, lock)
+		if err == nil {
+			r.locked, r.lockRefreshed = true, now
+			return nil
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			return err
+		}
+
+		// The lock of a killed process is taken over once expired
+		result, err := r.lockCollection().ReplaceOne(r.ctx, bson.D{
+			{Key: "_id", Value: lock_id},
+			{Key: "expires_at", Value: bson.D{{Key: "$lt", Value: now}}},
+		}, lock)
+		if err != nil {
+			return err
+		}
+		if result.MatchedCount == 1 {
+			r.locked, r.lockRefreshed = true, now
+			return nil
+		}
+
+		time.Sleep(time.Second * 5) // Delays 5 seconds
+	}
+
+	return fmt.Errorf("timeout while waiting for %s deletion", r.lockCollection().Name())
+}
+
+// refreshLock sets the expiry of the lock document back to lock_ttl, at most every quarter of it, while the
+// lock is held. It returns an error if the lock document is no longer the one of the repository, as another
+// process took the lock over once it expired.
+func (r *MongoDBRepository) refreshLock() error {
+	if !r.locked || time.Since(r.lockRefreshed) < lock_ttl/4 {
+		return nil
+	}
+
+	now := time.Now().UTC()
+	result, err := r.lockCollection().UpdateOne(r.ctx,
+		bson.D{{Key: "_id", Value: lock_id}, {Key: "owner", Value: r.lockOwner()}},
+		bson.D{{Key: "$set", Value: bson.D{{Key: "expires_at", Value: now.Add(lock_ttl)}}}})
+	if err != nil {
+		return fmt.Errorf("failed to refresh lock document: %w", err)
+	}
+
+	if result.MatchedCount != 1 {
+		return fmt.Errorf("lock document of %s expired", r.lockCollection().Name())
+	}
+
+	r.lockRefreshed = now
+	return nil
+}
+
+// unlock deletes the lock document, unless another process took it over.
+func (r *MongoDBRepository) unlock() error {
+	r.locked = false
+	_, err := r.lockCollection().DeleteOne(r.ctx, bson.D{{Key: "_id", Value: lock_id}, {Key: "owner", Value: r.lockOwner()}})
+	return err
+}
+
+// lockOwner returns the owner recorded in the lock document: the run and its holder.
+func (r *MongoDBRepository) lockOwner() string {
+	return fmt.Sprintf("run %s on %s", r.run.ID, r.run.Holder())
+}
+
+// Repair upserts the migrations in the history collection with a single bulk write, ordered so it stops at the
+// first failure.
+func (r *MongoDBRepository) Repair(migrations []*migrations.Migration) []error {
+	exists, err := r.CheckSchemaHistoryTable()
+	if err != nil {
+		return []error{err}
+	}
+
+	if !exists {
+		return nil
+	}
+
+	if len(migrations) == 0 {
+		return nil
+	}
+
+	documents, err := r.historyDocuments(bson.D{})
+	if err != nil {
+		return []error{err}
+	}
+
+	byVersion := make(map[uint16]*historyDocument, len(documents))
+	for _, document := range documents {
+		byVersion[document.Version] = document
+	}
+
+	models := make([]mongo.WriteModel, 0, len(migrations))
+	for _, migration := range migrations {
+		repairedAt := time.Now().UTC()
+		document, ok := byVersion[migration.Version]
+		if !ok {
+			document = &historyDocument{Version: migration.Version, ExecutedAt: repairedAt, RepairedAt: &repairedAt}
+		} else if document.Description != migration.Description || document.Checksum != *migration.Checksum {
+			document.RepairedAt = &repairedAt
+		}
+
+		document.Description = migration.Description
+		document.Checksum = *migration.Checksum
+		document.Success = true
+
+		models = append(models, mongo.NewReplaceOneModel().
+			SetFilter(bson.D{{Key: "_id", Value: migration.Version}}).
+			SetReplacement(document).
+			SetUpsert(true))
+	}
+
+	_, err = r.history().BulkWrite(r.ctx, models)
+	if err != nil {
+		return []error{err}
+	}
+
+	return nil
+}
+
+// Annotate sets the note of the version in the notes field of its history document.
+func (r *MongoDBRepository) Annotate(version uint16, note string) error {
+	result, err := r.history().UpdateOne(r.ctx, bson.D{{Key: "_id", Value: version}},
+		bson.D{{Key: "$set", Value: bson.D{{Key: "notes", Value: note}}}})
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("version %d: %w", version, database.ErrNotApplied)
+	}
+
+	return nil
+}
+
+func (r *MongoDBRepository) GetFailingMigrations() ([]*migrations.Migration, error) {
+	documents, err := r.historyDocuments(bson.D{{Key: "success", Value: false}})
+	if err != nil {
+		return nil, err
+	}
+
+	var failingMigrations []*migrations.Migration
+	for _, document := range documents {
+		checksum := document.Checksum
+		failingMigrations = append(failingMigrations, &migrations.Migration{
+			Version:     document.Version,
+			Description: document.Description,
+			Checksum:    &checksum,
+		})
+	}
+
+	return failingMigrations, nil
+}
+
+func (r *MongoDBRepository) GetAppliedMigrations() ([]*database.AppliedMigration, error) {
+	documents, err := r.historyDocuments(bson.D{})
+	if err != nil {
+		return nil, err
+	}
+
+	applied := make([]*database.AppliedMigration, 0, len(documents))
+	for _, document := range documents {
+		applied = append(applied, &database.AppliedMigration{
+			Version:     document.Version,
+			Description: document.Description,
+			Checksum:    document.Checksum,
+			Success:     document.Success,
+			Author:      document.Author,
+			Ticket:      document.Ticket,
+			Skipped:     document.Skipped,
+			ExecutedAt:  document.ExecutedAt.UTC(),
+		})
+	}
+
+	return applied, nil
+}
+
+// Clean drops every view and collection of the database, except the lock collection, so cleaning inside
+// DoInLock does not release the lock. System collections are kept.
+func (r *MongoDBRepository) Clean() error {
+	specifications, err := r.db.ListCollectionSpecifications(r.ctx, bson.D{})
+	if err != nil {
+		return err
+	}
+
+	// Views are dropped first, as they may depend on the collections
+	lockCollection := r.lockCollection().Name()
+	for _, dropViews := range []bool{true, false} {
+		for _, specification := range specifications {
+			if (specification.Type == "view") != dropViews || specification.Name == lockCollection ||
+				strings.HasPrefix(specification.Name, "system.") {
+				continue
+			}
+
+			err = r.db.Collection(specification.Name).Drop(r.ctx)
+			if err != nil {
+				return fmt.Errorf("error dropping %s: %w", specification.Name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// execCommands executes the commands of a migration or hook file in order.
+func (r *MongoDBRepository) execCommands(content string, skip int) error {
+	commands, err := ParseCommands(content)
+	if err != nil {
+		return err
+	}
+
+	for i, command := range commands {
+		if i < skip {
+			continue
+		}
+
+		err = r.refreshLock()
+		if err != nil {
+			return err
+		}
+
+		err = r.db.RunCommand(r.ctx, command).Err()
+		if err != nil {
+			return &database.StatementError{Index: i + 1, Err: fmt.Errorf("command %d (%s): %w", i+1, command[0].Key, err)}
+		}
+	}
+
+	return nil
+}
+
+// historyDocuments returns the documents of the history collection matching the filter, ordered by version.
+func (r *MongoDBRepository) historyDocuments(filter bson.D) ([]*historyDocument, error) {
+	cursor, err := r.history().Find(r.ctx, filter, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	documents := make([]*historyDocument, 0)
+	err = cursor.All(r.ctx, &documents)
+	if err != nil {
+		return nil, fmt.Errorf("invalid history document: %w", err)
+	}
+
+	return documents, nil
+}
+
+// historyDocument returns the history document of the version, nil if it does not exist.
+func (r *MongoDBRepository) historyDocument(version uint16) (*historyDocument, error) {
+	document := new(historyDocument)
+	err := r.history().FindOne(r.ctx, bson.D{{Key: "_id", Value: version}}).Decode(document)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return document, nil
+}
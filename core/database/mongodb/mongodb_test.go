@@ -0,0 +1,547 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/maestro-go/maestro/core/database"
+	"github.com/maestro-go/maestro/core/enums"
+	"github.com/maestro-go/maestro/core/maestrotest"
+	"github.com/maestro-go/maestro/internal/migrations"
+	testUtils "github.com/maestro-go/maestro/internal/utils/testing"
+	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const test_database = "maestro"
+
+type MigrationTestSuite struct {
+	suite.Suite
+	mongodb     *testUtils.MongoDBContainer
+	suiteClient *mongo.Client
+	suiteDb     *mongo.Database
+
+	ctx context.Context
+
+	repository *MongoDBRepository
+}
+
+func (s *MigrationTestSuite) SetupSuite() {
+	s.ctx = context.Background()
+
+	s.mongodb = testUtils.SetupMongoDB(s.T())
+
+	client, err := mongo.Connect(options.Client().ApplyURI(s.mongodb.URI))
+	s.Require().NoError(err)
+
+	s.suiteClient = client
+	s.suiteDb = client.Database(test_database)
+
+	s.repository = NewMongoDBRepository(s.ctx, s.suiteDb, testUtils.ToPtr(default_history_collection))
+}
+
+func (s *MigrationTestSuite) TearDownSuite() {
+	if s.suiteClient != nil {
+		s.suiteClient.Disconnect(s.ctx)
+	}
+}
+
+func (s *MigrationTestSuite) TearDownTest() {
+	if s.mongodb != nil {
+		err := s.repository.Clean()
+		s.Assert().NoError(err)
+	}
+}
+
+func (s *MigrationTestSuite) checkCollectionExists(name string, shouldExist bool) {
+	s.T().Helper()
+
+	names, err := s.suiteDb.ListCollectionNames(s.ctx, bson.D{{Key: "name", Value: name}})
+	s.Assert().NoError(err)
+	s.Assert().Equal(shouldExist, len(names) > 0)
+}
+
+func (s *MigrationTestSuite) insertHistory(documents ...bson.D) {
+	s.T().Helper()
+
+	_, err := s.suiteDb.Collection(default_history_collection).InsertMany(s.ctx, documents)
+	s.Require().NoError(err)
+}
+
+func historyEntry(version uint16, success bool) bson.D {
+	return bson.D{
+		{Key: "_id", Value: version},
+		{Key: "description", Value: "abcd"},
+		{Key: "md5_checksum", Value: "0a52730597fb4ffa01fc117d9e71e3a9"},
+		{Key: "success", Value: success},
+	}
+}
+
+func TestMigrationSuite(t *testing.T) {
+	suite.Run(t, new(MigrationTestSuite))
+}
+
+func (s *MigrationTestSuite) TestAssertSchemaHistoryTable() {
+	err := s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+
+	s.checkCollectionExists(default_history_collection, true)
+	s.checkCollectionExists(default_history_collection+"_audit", true)
+
+	// Existing collections are kept
+	err = s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+}
+
+func (s *MigrationTestSuite) TestCheckSchemaHistoryTable() {
+	exists, err := s.repository.CheckSchemaHistoryTable()
+	s.Assert().NoError(err)
+	s.Assert().False(exists)
+
+	err = s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+
+	exists, err = s.repository.CheckSchemaHistoryTable()
+	s.Assert().NoError(err)
+	s.Assert().True(exists)
+}
+
+func (s *MigrationTestSuite) TestGetLatestMigration() {
+	version, err := s.repository.GetLatestMigration()
+	s.Assert().NoError(err)
+	s.Assert().Equal(uint16(0), version)
+
+	err = s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+
+	s.insertHistory(historyEntry(1, true), historyEntry(40000, true), historyEntry(40001, false))
+
+	version, err = s.repository.GetLatestMigration()
+	s.Assert().NoError(err)
+	s.Assert().Equal(uint16(40000), version)
+}
+
+func (s *MigrationTestSuite) TestValidateMigrations() {
+	checksums := []string{"0a52730597fb4ffa01fc117d9e71e3a9", "3d41c8443df34e73867adb149efbb2ea"}
+	contents := []string{"EXAMPLE CONTENT 1", "EXAMPLE CONTENT 2"}
+	migrations := []*migrations.Migration{
+		{
+			Version:     1,
+			Description: "abcd",
+			Type:        enums.MIGRATION_UP,
+			Checksum:    &checksums[0],
+			Content:     &contents[0],
+		},
+		{
+			Version:     2,
+			Description: "abcd",
+			Type:        enums.MIGRATION_UP,
+			Checksum:    &checksums[1],
+			Content:     &contents[1],
+		},
+	}
+
+	errs := s.repository.ValidateMigrations(migrations)
+	s.Assert().Nil(errs)
+
+	err := s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+
+	s.insertHistory(bson.D{
+		{Key: "_id", Value: migrations[1].Version},
+		{Key: "description", Value: migrations[1].Description},
+		{Key: "md5_checksum", Value: checksums[0]},
+		{Key: "success", Value: true},
+	})
+
+	errs = s.repository.ValidateMigrations(migrations)
+	s.Assert().Len(errs, 1)
+
+	_, err = s.suiteDb.Collection(default_history_collection).UpdateOne(s.ctx,
+		bson.D{{Key: "_id", Value: migrations[1].Version}},
+		bson.D{{Key: "$set", Value: bson.D{{Key: "md5_checksum", Value: checksums[1]}}}})
+	s.Assert().NoError(err)
+
+	errs = s.repository.ValidateMigrations(migrations)
+	s.Assert().Nil(errs)
+}
+
+func (s *MigrationTestSuite) TestExecuteMigration() {
+	checksum := "0a52730597fb4ffa01fc117d9e71e3a9"
+	content := "INVALID JSON"
+	migration := &migrations.Migration{
+		Version:     1,
+		Description: "abcd",
+		Type:        enums.MIGRATION_UP,
+		Checksum:    &checksum,
+		Content:     &content,
+		Author:      "Jane Doe <jane@example.com>",
+		Ticket:      "OPS-123",
+	}
+
+	err := s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+
+	// Invalid commands
+	errs := s.repository.ExecuteMigration(migration)
+	s.Assert().Len(errs, 1)
+
+	*migration.Content = `[
+		{"create": "users"},
+		{"createIndexes": "users", "indexes": [{"key": {"email": 1}, "name": "email_1", "unique": true}]},
+		{"insert": "users", "documents": [{"email": "jane@example.com"}]}
+	]`
+
+	errs = s.repository.ExecuteMigration(migration)
+	s.Assert().Nil(errs)
+
+	s.checkCollectionExists("users", true)
+
+	count, err := s.suiteDb.Collection("users").CountDocuments(s.ctx, bson.D{})
+	s.Assert().NoError(err)
+	s.Assert().Equal(int64(1), count)
+
+	applied, err := s.repository.GetAppliedMigrations()
+	s.Assert().NoError(err)
+	s.Require().Len(applied, 1)
+	s.Assert().Equal(migration.Version, applied[0].Version)
+	s.Assert().Equal(migration.Description, applied[0].Description)
+	s.Assert().Equal(*migration.Checksum, applied[0].Checksum)
+	s.Assert().True(applied[0].Success)
+	s.Assert().Equal(migration.Author, applied[0].Author)
+	s.Assert().Equal(migration.Ticket, applied[0].Ticket)
+
+	// The commands executed before the failed one are kept, and the failed command is reported
+	*migration.Content = `[
+		{"create": "roles"},
+		{"insert": "users", "documents": [{"email": "jane@example.com"}]}
+	]`
+
+	errs = s.repository.ExecuteMigration(migration)
+	s.Require().Len(errs, 1)
+
+	var statementErr *database.StatementError
+	s.Require().ErrorAs(errs[0], &statementErr)
+	s.Assert().Equal(2, statementErr.Index)
+
+	s.checkCollectionExists("roles", true)
+
+	failing, err := s.repository.GetFailingMigrations()
+	s.Assert().NoError(err)
+	s.Assert().Len(failing, 1)
+
+	// The commands executed before are skipped when the migration is retried
+	migration.SkipStatements = 1
+	*migration.Content = `[
+		{"create": "roles"},
+		{"insert": "roles", "documents": [{"_id": "admin"}]}
+	]`
+
+	errs = s.repository.ExecuteMigration(migration)
+	s.Assert().Nil(errs)
+
+	failing, err = s.repository.GetFailingMigrations()
+	s.Assert().NoError(err)
+	s.Assert().Empty(failing)
+}
+
+func (s *MigrationTestSuite) TestSkipMigration() {
+	checksum := "0a52730597fb4ffa01fc117d9e71e3a9"
+	content := `{"create": "skipped"}`
+	migration := &migrations.Migration{
+		Version:     1,
+		Description: "abcd",
+		Type:        enums.MIGRATION_UP,
+		Checksum:    &checksum,
+		Content:     &content,
+	}
+
+	err := s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+
+	err = s.repository.SkipMigration(migration)
+	s.Assert().NoError(err)
+
+	s.checkCollectionExists("skipped", false)
+
+	applied, err := s.repository.GetAppliedMigrations()
+	s.Assert().NoError(err)
+	s.Require().Len(applied, 1)
+	s.Assert().True(applied[0].Success)
+	s.Assert().True(applied[0].Skipped)
+}
+
+func (s *MigrationTestSuite) TestExecuteAssertion() {
+	err := s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+
+	content := fmt.Sprintf(`{"find": "%s", "filter": {"success": false}}`, default_history_collection)
+	hook := &migrations.Hook{
+		Order:   1,
+		Content: &content,
+		Type:    enums.HOOK_ASSERTION,
+	}
+
+	err = s.repository.ExecuteAssertion(hook)
+	s.Assert().NoError(err)
+
+	s.insertHistory(historyEntry(1, false))
+
+	err = s.repository.ExecuteAssertion(hook)
+	s.Assert().ErrorContains(err, "returned 1 documents")
+
+	*hook.Content = fmt.Sprintf(`{"count": "%s", "query": {"success": false}}`, default_history_collection)
+	err = s.repository.ExecuteAssertion(hook)
+	s.Assert().ErrorContains(err, "returned 1")
+
+	*hook.Content = fmt.Sprintf(`[{"count": "%s"}, {"count": "%s"}]`, default_history_collection,
+		default_history_collection)
+	err = s.repository.ExecuteAssertion(hook)
+	s.Assert().ErrorContains(err, "single command")
+}
+
+func (s *MigrationTestSuite) TestRollbackMigration() {
+	content := "INVALID JSON"
+	migration := &migrations.Migration{
+		Version:     1,
+		Description: "abcd",
+		Type:        enums.MIGRATION_DOWN,
+		Content:     &content,
+	}
+
+	err := s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+
+	// Versions not applied are not rolled back
+	err = s.repository.RollbackMigration(migration)
+	s.Assert().NoError(err)
+
+	s.insertHistory(historyEntry(1, true))
+
+	err = s.repository.RollbackMigration(migration)
+	s.Assert().Error(err)
+
+	err = s.suiteDb.CreateCollection(s.ctx, "rollback")
+	s.Require().NoError(err)
+
+	*migration.Content = `{"drop": "rollback"}`
+
+	err = s.repository.RollbackMigration(migration)
+	s.Assert().NoError(err)
+
+	s.checkCollectionExists("rollback", false)
+
+	version, err := s.repository.GetLatestMigration()
+	s.Assert().NoError(err)
+	s.Assert().Equal(uint16(0), version)
+}
+
+func (s *MigrationTestSuite) TestDoInTransaction() {
+	// Commands are not transactional, so nothing is rolled back
+	err := s.repository.DoInTransaction(func() error {
+		err := s.suiteDb.CreateCollection(s.ctx, "transaction")
+		s.Assert().NoError(err)
+
+		return fmt.Errorf("example error")
+	})
+	s.Assert().Error(err)
+
+	s.checkCollectionExists("transaction", true)
+
+	s.Assert().False(s.repository.Capabilities().SupportsTransactions)
+}
+
+func (s *MigrationTestSuite) TestDoInLock() {
+	info, err := s.repository.GetLockInfo()
+	s.Assert().NoError(err)
+	s.Assert().False(info.Locked)
+
+	err = s.repository.DoInLock(func() error {
+		// Other instances cannot insert the lock document
+		_, err := s.suiteDb.Collection(lock_collection).InsertOne(s.ctx, bson.D{{Key: "_id", Value: lock_id}})
+		s.Assert().True(mongo.IsDuplicateKeyError(err))
+
+		info, err := s.repository.GetLockInfo()
+		s.Assert().NoError(err)
+		s.Assert().True(info.Locked)
+		s.Assert().NotNil(info.LockedAt)
+
+		// Cleaning keeps the lock
+		err = s.repository.Clean()
+		s.Assert().NoError(err)
+
+		info, err = s.repository.GetLockInfo()
+		s.Assert().NoError(err)
+		s.Assert().True(info.Locked)
+		return nil
+	})
+	s.Assert().NoError(err)
+
+	info, err = s.repository.GetLockInfo()
+	s.Assert().NoError(err)
+	s.Assert().False(info.Locked)
+}
+
+func (s *MigrationTestSuite) TestLockExpiry() {
+	// The lock document of a killed process is taken over once expired
+	expired := time.Now().UTC().Add(-time.Minute)
+	err := s.repository.AssertSchemaHistoryTable()
+	s.Require().NoError(err)
+
+	_, err = s.suiteDb.Collection(lock_collection).InsertOne(s.ctx, bson.D{
+		{Key: "_id", Value: lock_id}, {Key: "owner", Value: "run killed on host"},
+		{Key: "locked_at", Value: expired.Add(-lock_ttl)}, {Key: "expires_at", Value: expired},
+	})
+	s.Require().NoError(err)
+
+	info, err := s.repository.GetLockInfo()
+	s.Assert().NoError(err)
+	s.Assert().False(info.Locked)
+
+	err = s.repository.DoInLock(func() error {
+		info, err := s.repository.GetLockInfo()
+		s.Assert().NoError(err)
+		s.Assert().True(info.Locked)
+		s.Assert().NotEqual("run killed on host", info.Owner)
+
+		// The migrations stop once another process took the expired lock over
+		_, err = s.suiteDb.Collection(lock_collection).UpdateOne(s.ctx, bson.D{{Key: "_id", Value: lock_id}},
+			bson.D{{Key: "$set", Value: bson.D{{Key: "owner", Value: "run other on host"}}}})
+		s.Require().NoError(err)
+		s.repository.lockRefreshed = time.Now().Add(-lock_ttl / 2)
+
+		content, checksum := `{"create": "users"}`, "0a52730597fb4ffa01fc117d9e71e3a9"
+		errs := s.repository.ExecuteMigration(&migrations.Migration{Version: 1, Description: "create_users",
+			Type: enums.MIGRATION_UP, Content: &content, Checksum: &checksum})
+		s.Assert().Len(errs, 1)
+		s.Assert().ErrorContains(errs[0], "lock document of schema_lock expired")
+		return nil
+	})
+	s.Assert().NoError(err)
+
+	// The lock taken over by the other process is kept
+	info, err = s.repository.GetLockInfo()
+	s.Assert().NoError(err)
+	s.Assert().True(info.Locked)
+	s.Assert().Equal("run other on host", info.Owner)
+
+	_, err = s.suiteDb.Collection(lock_collection).DeleteMany(s.ctx, bson.D{})
+	s.Require().NoError(err)
+}
+
+func (s *MigrationTestSuite) TestRepair() {
+	checksums := []string{"0a52730597fb4ffa01fc117d9e71e3a9", "3d41c8443df34e73867adb149efbb2ea"}
+	contents := []string{"EXAMPLE CONTENT 1", "EXAMPLE CONTENT 2"}
+	migrations := []*migrations.Migration{
+		{
+			Version:     1,
+			Description: "abcd",
+			Type:        enums.MIGRATION_UP,
+			Checksum:    &checksums[0],
+			Content:     &contents[0],
+		},
+		{
+			Version:     2,
+			Description: "abcd",
+			Type:        enums.MIGRATION_UP,
+			Checksum:    &checksums[1],
+			Content:     &contents[1],
+		},
+	}
+
+	err := s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+
+	// Simulate a checksum mismatch
+	s.insertHistory(bson.D{
+		{Key: "_id", Value: migrations[0].Version},
+		{Key: "description", Value: migrations[0].Description},
+		{Key: "md5_checksum", Value: "d41d8cd98f00b204e9800998ecf8427e"},
+		{Key: "success", Value: false},
+	})
+
+	errs := s.repository.Repair(migrations)
+	s.Assert().Nil(errs)
+
+	document, err := s.repository.historyDocument(migrations[0].Version)
+	s.Require().NoError(err)
+	s.Require().NotNil(document)
+	s.Assert().Equal(*migrations[0].Checksum, document.Checksum)
+	s.Assert().True(document.Success)
+	s.Assert().NotNil(document.RepairedAt)
+
+	// Missing migrations are inserted
+	document, err = s.repository.historyDocument(migrations[1].Version)
+	s.Require().NoError(err)
+	s.Require().NotNil(document)
+	s.Assert().Equal(*migrations[1].Checksum, document.Checksum)
+}
+
+func (s *MigrationTestSuite) TestAnnotate() {
+	err := s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+
+	err = s.repository.Annotate(1, "note")
+	s.Assert().ErrorIs(err, database.ErrNotApplied)
+
+	s.insertHistory(historyEntry(1, true))
+
+	err = s.repository.Annotate(1, "note")
+	s.Assert().NoError(err)
+
+	document, err := s.repository.historyDocument(1)
+	s.Require().NoError(err)
+	s.Assert().Equal("note", document.Notes)
+}
+
+func (s *MigrationTestSuite) TestGetFailingMigrations() {
+	err := s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+
+	s.insertHistory(historyEntry(1, false), historyEntry(2, true), historyEntry(3, false))
+
+	failingMigrations, err := s.repository.GetFailingMigrations()
+	s.Assert().NoError(err)
+	s.Assert().Len(failingMigrations, 2)
+}
+
+func (s *MigrationTestSuite) TestClean() {
+	err := s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+
+	hook := `[
+		{"create": "clean_collection"},
+		{"create": "clean_view", "viewOn": "clean_collection", "pipeline": []}
+	]`
+	err = s.repository.ExecuteHook(&migrations.Hook{Content: &hook})
+	s.Require().NoError(err)
+
+	err = s.repository.Clean()
+	s.Assert().NoError(err)
+
+	names, err := s.suiteDb.ListCollectionNames(s.ctx, bson.D{})
+	s.Assert().NoError(err)
+	s.Assert().Empty(names)
+}
+
+func (s *MigrationTestSuite) TestRunConcurrent() {
+	maestrotest.RunConcurrent(s.T(), 4, &maestrotest.Config{
+		NewRepository: func(t testing.TB) database.Repository {
+			client, err := mongo.Connect(options.Client().ApplyURI(s.mongodb.URI))
+			s.Require().NoError(err)
+			t.Cleanup(func() { client.Disconnect(s.ctx) })
+
+			return NewMongoDBRepository(s.ctx, client.Database(test_database),
+				testUtils.ToPtr(default_history_collection))
+		},
+		Migrations: []string{
+			`{"create": "concurrent1"}`,
+			`{"create": "concurrent2"}`,
+			`{"create": "concurrent3"}`,
+		},
+	})
+}
@@ -0,0 +1,130 @@
+package neo4j
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// statement is a Cypher statement of a request to the HTTP API.
+type statement struct {
+	Statement  string         `json:"statement"`
+	Parameters map[string]any `json:"parameters,omitempty"`
+}
+
+// result is the result of a statement, with the values of each row.
+type result struct {
+	Columns []string `json:"columns"`
+	Data    []struct {
+		Row []any `json:"row"`
+	} `json:"data"`
+}
+
+// queryError is an error reported by the server for a statement.
+type queryError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *queryError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// client executes Cypher statements through the transactional HTTP API of a database. Each call is
+// executed and committed in its own transaction.
+type client struct {
+	http     *http.Client
+	url      string
+	database string
+}
+
+func (c *client) run(ctx context.Context, statements ...*statement) ([]*result, error) {
+	content, err := json.Marshal(map[string]any{"statements": statements})
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		c.url+"/db/"+c.database+"/tx/commit", bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Accept", "application/json")
+
+	if request.URL.User != nil {
+		password, _ := request.URL.User.Password()
+		request.SetBasicAuth(request.URL.User.Username(), password)
+	}
+
+	response, err := c.http.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	content, err = io.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return nil, fmt.Errorf("%s: %s", http.StatusText(response.StatusCode), strings.TrimSpace(string(content)))
+	}
+
+	body := struct {
+		Results []*result     `json:"results"`
+		Errors  []*queryError `json:"errors"`
+	}{}
+
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+	err = decoder.Decode(&body)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(body.Errors) > 0 {
+		return nil, body.Errors[0]
+	}
+
+	return body.Results, nil
+}
+
+// single executes a statement and returns its rows.
+func (c *client) single(ctx context.Context, query string, parameters map[string]any) ([][]any, error) {
+	results, err := c.run(ctx, &statement{Statement: query, Parameters: parameters})
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make([][]any, 0)
+	for _, result := range results {
+		for _, data := range result.Data {
+			rows = append(rows, data.Row)
+		}
+	}
+
+	return rows, nil
+}
+
+func isErrorCode(err error, code string) bool {
+	queryErr, ok := err.(*queryError)
+	return ok && queryErr.Code == code
+}
+
+// toInt converts a number returned by the HTTP API.
+func toInt(value any) (int64, error) {
+	switch v := value.(type) {
+	case json.Number:
+		return v.Int64()
+	case nil:
+		return 0, nil
+	}
+	return 0, fmt.Errorf("unexpected value %v, expected a number", value)
+}
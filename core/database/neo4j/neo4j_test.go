@@ -0,0 +1,130 @@
+package neo4j
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/maestro-go/maestro/core/database"
+	"github.com/maestro-go/maestro/internal/migrations"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeServer answers the lock and assertion statements of the repository through the HTTP API.
+type fakeServer struct {
+	mu         sync.Mutex
+	locked     bool
+	assertRows string
+	statements []string
+}
+
+func (f *fakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.URL.Path != "/db/neo4j/tx/commit" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	body := struct {
+		Statements []*statement `json:"statements"`
+	}{}
+	json.NewDecoder(r.Body).Decode(&body)
+
+	query := strings.TrimSpace(body.Statements[0].Statement)
+	f.statements = append(f.statements, query)
+
+	switch {
+	case strings.HasPrefix(query, "CREATE (:`schema_lock`"):
+		if f.locked {
+			w.Write([]byte(`{"results": [], "errors": [{"code": "` + constraint_validation_failed + `", "message": "exists"}]}`))
+			return
+		}
+		f.locked = true
+	case strings.HasPrefix(query, "MATCH (l:`schema_lock`) DELETE l"):
+		f.locked = false
+	case strings.HasPrefix(query, "FAIL"):
+		w.Write([]byte(`{"results": [], "errors": [{"code": "Neo.ClientError.Statement.SyntaxError", "message": "invalid"}]}`))
+		return
+	case strings.HasPrefix(query, "MATCH (u:User)"):
+		w.Write([]byte(`{"results": [{"columns": ["ok"], "data": ` + f.assertRows + `}], "errors": []}`))
+		return
+	}
+
+	w.Write([]byte(`{"results": [{"columns": [], "data": []}], "errors": []}`))
+}
+
+func TestDoInLock(t *testing.T) {
+	server := &fakeServer{}
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	repo := NewNeo4jRepository(context.Background(), httpServer.Client(), httpServer.URL, "", nil)
+
+	err := repo.DoInLock(func() error {
+		assert.True(t, server.locked)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.False(t, server.locked)
+	assert.True(t, strings.HasPrefix(server.statements[0], "CREATE CONSTRAINT `schema_lock_id` IF NOT EXISTS"))
+}
+
+func TestExecuteAssertion(t *testing.T) {
+	server := &fakeServer{assertRows: `[]`}
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	repo := NewNeo4jRepository(context.Background(), httpServer.Client(), httpServer.URL, "neo4j", nil)
+
+	content := "MATCH (u:User) WHERE u.email IS NULL RETURN u"
+	assertion := &migrations.Hook{Content: &content}
+
+	assert.NoError(t, repo.ExecuteAssertion(assertion))
+
+	server.assertRows = `[{"row": [true]}]`
+	assert.NoError(t, repo.ExecuteAssertion(assertion))
+
+	server.assertRows = `[{"row": [false]}]`
+	assert.ErrorContains(t, repo.ExecuteAssertion(assertion), "returned false")
+
+	server.assertRows = `[{"row": [{"id": 1}]}, {"row": [{"id": 2}]}]`
+	assert.ErrorContains(t, repo.ExecuteAssertion(assertion), "returned 2 rows")
+}
+
+func TestExecuteHookSplitsStatements(t *testing.T) {
+	server := &fakeServer{}
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	repo := NewNeo4jRepository(context.Background(), httpServer.Client(), httpServer.URL, "", nil)
+
+	content := "CREATE INDEX user_email IF NOT EXISTS FOR (u:User) ON (u.email);\n" +
+		"MATCH (a:User)-->(b:User) SET a.friend = true;\n"
+	err := repo.ExecuteHook(&migrations.Hook{Content: &content})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"CREATE INDEX user_email IF NOT EXISTS FOR (u:User) ON (u.email)",
+		"MATCH (a:User)-->(b:User) SET a.friend = true",
+	}, server.statements)
+}
+
+func TestExecScriptSkipsStatements(t *testing.T) {
+	server := &fakeServer{}
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	repo := NewNeo4jRepository(context.Background(), httpServer.Client(), httpServer.URL, "", nil)
+
+	err := repo.execScript("CREATE (:A);\nCREATE (:B);\nFAIL;\nCREATE (:C);\n", 1)
+	assert.Equal(t, []string{"CREATE (:B)", "FAIL"}, server.statements)
+
+	var statementErr *database.StatementError
+	assert.ErrorAs(t, err, &statementErr)
+	assert.Equal(t, 3, statementErr.Index)
+}
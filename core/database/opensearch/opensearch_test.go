@@ -0,0 +1,93 @@
+package opensearch
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/maestro-go/maestro/internal/migrations"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeCluster answers the lock and count requests of the repository.
+type fakeCluster struct {
+	mu     sync.Mutex
+	locked bool
+	count  string
+	paths  []string
+}
+
+func (f *fakeCluster) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.paths = append(f.paths, r.Method+" "+r.URL.Path)
+
+	switch {
+	case r.URL.Path == "/"+lock_index+"/_doc/"+lock_id && r.Method == http.MethodPut:
+		if f.locked {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		f.locked = true
+		w.WriteHeader(http.StatusCreated)
+	case r.URL.Path == "/"+lock_index+"/_doc/"+lock_id && r.Method == http.MethodDelete:
+		if !f.locked {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		f.locked = false
+	case r.URL.Path == "/logs/_count":
+		w.Write([]byte(f.count))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestDoInLock(t *testing.T) {
+	cluster := &fakeCluster{}
+	server := httptest.NewServer(cluster)
+	defer server.Close()
+
+	repo := NewOpenSearchRepository(context.Background(), server.Client(), server.URL, nil)
+
+	err := repo.DoInLock(func() error {
+		assert.True(t, cluster.locked)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.False(t, cluster.locked)
+}
+
+func TestExecuteAssertion(t *testing.T) {
+	cluster := &fakeCluster{count: `{"count": 0}`}
+	server := httptest.NewServer(cluster)
+	defer server.Close()
+
+	repo := NewOpenSearchRepository(context.Background(), server.Client(), server.URL+"/", nil)
+
+	content := `{"method": "GET", "path": "/logs/_count", "body": {"query": {"term": {"level": "invalid"}}}}`
+	assertion := &migrations.Hook{Content: &content}
+
+	assert.NoError(t, repo.ExecuteAssertion(assertion))
+
+	cluster.count = `{"count": 2}`
+	assert.ErrorContains(t, repo.ExecuteAssertion(assertion), "returned 2 matches")
+
+	content = `{"method": "GET", "path": "/missing/_count"}`
+	assert.ErrorContains(t, repo.ExecuteAssertion(assertion), "Not Found")
+}
+
+func TestBulkErrors(t *testing.T) {
+	assert.Empty(t, bulkErrors([]byte(`{"errors": false, "items": [{"update": {"_id": "1", "status": 200}}]}`)))
+
+	errs := bulkErrors([]byte(`{"errors": true, "items": [
+		{"update": {"_id": "1", "status": 200}},
+		{"update": {"_id": "2", "status": 400, "error": {"type": "mapper_parsing_exception"}}}
+	]}`))
+	assert.Len(t, errs, 1)
+	assert.ErrorContains(t, errs[0], "update of document 2 failed")
+	assert.ErrorContains(t, errs[0], "mapper_parsing_exception")
+}
@@ -0,0 +1,131 @@
+package opensearch
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Request is a REST API request of a migration or hook file. The files contain either a single
+// request object or an array of requests, executed in order:
+//
+//	[
+//	  {"method": "PUT", "path": "/_index_template/logs", "body": {"index_patterns": ["logs-*"]}},
+//	  {"method": "POST", "path": "/_aliases", "body": {"actions": [...]}}
+//	]
+//
+// A string body is sent as is, as newline-delimited JSON (e.g. for the _bulk API).
+type Request struct {
+	Method string          `json:"method"`
+	Path   string          `json:"path"`
+	Body   json.RawMessage `json:"body,omitempty"`
+}
+
+// ParseRequests parses the requests of a migration or hook file. Empty files have no requests.
+func ParseRequests(content string) ([]*Request, error) {
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return nil, nil
+	}
+
+	requests := make([]*Request, 0)
+	if strings.HasPrefix(content, "[") {
+		err := json.Unmarshal([]byte(content), &requests)
+		if err != nil {
+			return nil, fmt.Errorf("invalid requests: %w", err)
+		}
+	} else {
+		request := new(Request)
+		err := json.Unmarshal([]byte(content), request)
+		if err != nil {
+			return nil, fmt.Errorf("invalid request: %w", err)
+		}
+		requests = append(requests, request)
+	}
+
+	for i, request := range requests {
+		request.Method = strings.ToUpper(strings.TrimSpace(request.Method))
+		if request.Method == "" {
+			return nil, fmt.Errorf("request %d: missing method", i+1)
+		}
+		if !strings.HasPrefix(request.Path, "/") {
+			return nil, fmt.Errorf("request %d: path must start with \"/\"", i+1)
+		}
+	}
+
+	return requests, nil
+}
+
+// body returns the reader and the content type of the request body.
+func (r *Request) body() (io.Reader, string, error) {
+	if len(r.Body) == 0 || string(r.Body) == "null" {
+		return nil, "", nil
+	}
+
+	if r.Body[0] == '"' {
+		ndjson := ""
+		err := json.Unmarshal(r.Body, &ndjson)
+		if err != nil {
+			return nil, "", err
+		}
+		if !strings.HasSuffix(ndjson, "\n") {
+			ndjson += "\n"
+		}
+		return strings.NewReader(ndjson), "application/x-ndjson", nil
+	}
+
+	return bytes.NewReader(r.Body), "application/json", nil
+}
+
+// responseError is returned for requests answered with an unexpected status.
+type responseError struct {
+	method string
+	path   string
+	status int
+	body   string
+}
+
+func (e *responseError) Error() string {
+	return fmt.Sprintf("%s %s: %s: %s", e.method, e.path, http.StatusText(e.status), e.body)
+}
+
+// countMatches returns the number of matches reported by a _count or _search response.
+func countMatches(response []byte) (int64, error) {
+	result := struct {
+		Count *int64 `json:"count"`
+		Hits  *struct {
+			Total json.RawMessage `json:"total"`
+		} `json:"hits"`
+	}{}
+
+	err := json.Unmarshal(response, &result)
+	if err != nil {
+		return 0, err
+	}
+
+	if result.Count != nil {
+		return *result.Count, nil
+	}
+
+	if result.Hits != nil && len(result.Hits.Total) > 0 {
+		// The total is an object since OpenSearch 1.0, and a number in older Elasticsearch versions
+		total := struct {
+			Value int64 `json:"value"`
+		}{}
+		if json.Unmarshal(result.Hits.Total, &total) == nil {
+			return total.Value, nil
+		}
+
+		value := int64(0)
+		err = json.Unmarshal(result.Hits.Total, &value)
+		if err != nil {
+			return 0, err
+		}
+		return value, nil
+	}
+
+	return 0, fmt.Errorf("response has no count nor hits")
+}
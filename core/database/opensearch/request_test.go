@@ -0,0 +1,73 @@
+package opensearch
+
+import (
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRequests(t *testing.T) {
+	requests, err := ParseRequests(`[
+		{"method": "put", "path": "/logs", "body": {"mappings": {"properties": {"message": {"type": "text"}}}}},
+		{"method": "POST", "path": "/_bulk", "body": "{\"index\": {\"_index\": \"logs\"}}\n{\"message\": \"hi\"}"},
+		{"method": "DELETE", "path": "/old-logs"}
+	]`)
+	assert.NoError(t, err)
+	assert.Len(t, requests, 3)
+
+	assert.Equal(t, "PUT", requests[0].Method)
+	body, contentType, err := requests[0].body()
+	assert.NoError(t, err)
+	assert.Equal(t, "application/json", contentType)
+	content, _ := io.ReadAll(body)
+	assert.JSONEq(t, `{"mappings": {"properties": {"message": {"type": "text"}}}}`, string(content))
+
+	body, contentType, err = requests[1].body()
+	assert.NoError(t, err)
+	assert.Equal(t, "application/x-ndjson", contentType)
+	content, _ = io.ReadAll(body)
+	assert.Equal(t, "{\"index\": {\"_index\": \"logs\"}}\n{\"message\": \"hi\"}\n", string(content))
+
+	body, _, err = requests[2].body()
+	assert.NoError(t, err)
+	assert.Nil(t, body)
+}
+
+func TestParseRequestsSingleAndEmpty(t *testing.T) {
+	requests, err := ParseRequests(`{"method": "GET", "path": "/_cluster/health"}`)
+	assert.NoError(t, err)
+	assert.Len(t, requests, 1)
+
+	requests, err = ParseRequests("  \n")
+	assert.NoError(t, err)
+	assert.Empty(t, requests)
+}
+
+func TestParseRequestsErrors(t *testing.T) {
+	_, err := ParseRequests(`{"path": "/logs"}`)
+	assert.ErrorContains(t, err, "missing method")
+
+	_, err = ParseRequests(`[{"method": "GET", "path": "logs"}]`)
+	assert.ErrorContains(t, err, "path must start with")
+
+	_, err = ParseRequests(`[{"method": "GET"`)
+	assert.ErrorContains(t, err, "invalid requests")
+}
+
+func TestCountMatches(t *testing.T) {
+	matches, err := countMatches([]byte(`{"count": 3}`))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), matches)
+
+	matches, err = countMatches([]byte(`{"hits": {"total": {"value": 0, "relation": "eq"}, "hits": []}}`))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), matches)
+
+	matches, err = countMatches([]byte(`{"hits": {"total": 7, "hits": []}}`))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(7), matches)
+
+	_, err = countMatches([]byte(`{"acknowledged": true}`))
+	assert.Error(t, err)
+}
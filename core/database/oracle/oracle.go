@@ -0,0 +1,956 @@
+// Package oracle implements the maestro repository for Oracle Database 12.2 and later.
+//
+// Migration scripts are split into statements as SQL*Plus does: statements end with a semicolon or a line
+// containing only a slash, and PL/SQL blocks (anonymous blocks and CREATE PROCEDURE, FUNCTION, PACKAGE,
+// TRIGGER and TYPE) end with a slash line. The history table is created in the current schema, and the
+// queries of the repository use the :1 parameters of github.com/sijms/go-ora/v2. DoInLock needs the
+// EXECUTE privilege on DBMS_LOCK.
+package oracle
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/maestro-go/maestro/core/database"
+	"github.com/maestro-go/maestro/core/enums"
+	"github.com/maestro-go/maestro/internal/conf"
+	"github.com/maestro-go/maestro/internal/migrations"
+)
+
+const default_history_table = "schema_history"
+
+// lock_timeout is the number of seconds DoInLock waits for the lock held by another session.
+const lock_timeout = 60
+
+// lock_prefix is the prefix of the user lock of DoInLock, followed by the current schema and the
+// history table, as user locks belong to the whole database.
+const lock_prefix = "maestro:"
+
+// repair_batch_size is the number of migrations merged per statement by Repair.
+const repair_batch_size = 1000
+
+// history_columns are the columns added to the history table after its first release, added by
+// upgradeHistoryTable to the tables created by previous versions.
+var history_columns = []struct{ name, definition string }{
+	{"notes", "VARCHAR2(4000 CHAR)"},
+	{"run_id", "VARCHAR2(64)"},
+	{"author", "VARCHAR2(255 CHAR)"},
+	{"ticket", "VARCHAR2(64 CHAR)"},
+	{"skipped", "NUMBER(1) DEFAULT 0 NOT NULL CHECK (skipped IN (0, 1))"},
+}
+
+// OracleRepository executes migration scripts one statement at a time. Oracle commits DDL statements
+// implicitly, so a failed migration can not be rolled back: its failure is recorded in the schema history
+// table, and DoInTransaction only runs the callback.
+type OracleRepository struct {
+	database.Repository
+	ctx           context.Context
+	db            database.Database
+	history_table string
+	run           database.RunInfo
+}
+
+func NewOracleRepository(ctx context.Context, db database.Database, history_table *string) *OracleRepository {
+	repo := &OracleRepository{
+		ctx: ctx,
+		db:  db,
+		run: database.RunInfo{MaestroVersion: conf.VERSION},
+	}
+
+	if history_table != nil {
+		repo.history_table = *history_table
+	} else {
+		repo.history_table = default_history_table
+	}
+
+	return repo
+}
+
+func (r *OracleRepository) GetLatestMigration() (uint16, error) {
+	tableExists, err := r.CheckSchemaHistoryTable()
+	if err != nil {
+		return 0, err
+	}
+
+	if !tableExists {
+		return 0, nil
+	}
+
+	query := fmt.Sprintf(`
+		SELECT COALESCE(MAX(version), 0)
+		FROM %s
+		WHERE success = 1
+	`, r.history_table)
+
+	version := uint16(0)
+	err = r.db.QueryRowContext(r.ctx, query).Scan(&version)
+	if err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+func (r *OracleRepository) AssertSchemaHistoryTable() error {
+	// Audit tables are also created for history tables of previous versions
+	exists, err := r.tableExists(r.auditTable())
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		_, err = r.db.ExecContext(r.ctx, fmt.Sprintf(`
+			CREATE TABLE %s (
+				id NUMBER(19) GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+				run_id VARCHAR2(64) NOT NULL,
+				maestro_version VARCHAR2(32) NOT NULL,
+				direction VARCHAR2(4) NOT NULL,
+				version NUMBER(5) NOT NULL,
+				description VARCHAR2(255 CHAR) NOT NULL,
+				success NUMBER(1) NOT NULL CHECK (success IN (0, 1)),
+				executed_at TIMESTAMP DEFAULT SYSTIMESTAMP NOT NULL
+			)
+		`, r.auditTable()))
+		if err != nil {
+			return err
+		}
+	}
+
+	exists, err = r.CheckSchemaHistoryTable()
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		return r.upgradeHistoryTable()
+	}
+
+	// Oracle has no unsigned integers nor booleans before 23ai
+	_, err = r.db.ExecContext(r.ctx, fmt.Sprintf(`
+		CREATE TABLE %s (
+			version NUMBER(5) NOT NULL PRIMARY KEY,
+			description VARCHAR2(255 CHAR) NOT NULL,
+			md5_checksum CHAR(32) NOT NULL,
+			success NUMBER(1) DEFAULT 0 NOT NULL CHECK (success IN (0, 1)),
+			executed_at TIMESTAMP DEFAULT SYSTIMESTAMP NOT NULL,
+			repaired_at TIMESTAMP,
+			notes VARCHAR2(4000 CHAR),
+			run_id VARCHAR2(64),
+			author VARCHAR2(255 CHAR),
+			ticket VARCHAR2(64 CHAR),
+			skipped NUMBER(1) DEFAULT 0 NOT NULL CHECK (skipped IN (0, 1))
+		)
+	`, r.history_table))
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// upgradeHistoryTable adds the columns missing in history tables created by previous versions.
+func (r *OracleRepository) upgradeHistoryTable() error {
+	columns, err := r.historyColumns()
+	if err != nil {
+		return err
+	}
+
+	for _, column := range history_columns {
+		if columns[column.name] {
+			continue
+		}
+
+		_, err = r.db.ExecContext(r.ctx, fmt.Sprintf("ALTER TABLE %s ADD (%s %s)", r.history_table,
+			column.name, column.definition))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// historyColumns returns the columns of the history table, in lower case.
+func (r *OracleRepository) historyColumns() (map[string]bool, error) {
+	query := `
+		SELECT column_name FROM user_tab_columns WHERE table_name = UPPER(:1)
+	`
+
+	rows, err := r.db.QueryContext(r.ctx, query, r.history_table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := map[string]bool{}
+	for rows.Next() {
+		var column string
+		err = rows.Scan(&column)
+		if err != nil {
+			return nil, err
+		}
+		columns[strings.ToLower(column)] = true
+	}
+
+	return columns, rows.Err()
+}
+
+func (r *OracleRepository) CheckSchemaHistoryTable() (bool, error) {
+	return r.tableExists(r.history_table)
+}
+
+func (r *OracleRepository) tableExists(table string) (bool, error) {
+	// Unquoted identifiers are stored in upper case
+	query := `
+		SELECT COUNT(*) FROM user_tables WHERE table_name = UPPER(:1)
+	`
+
+	count := 0
+	err := r.db.QueryRowContext(r.ctx, query, table).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+func (r *OracleRepository) ValidateMigrations(localMigrations []*migrations.Migration) []error {
+	if len(localMigrations) < 1 {
+		return nil
+	}
+
+	tableExists, err := r.CheckSchemaHistoryTable()
+	if err != nil {
+		return []error{err}
+	}
+
+	if !tableExists {
+		return nil
+	}
+
+	byVersion := make(map[uint16]*migrations.Migration, len(localMigrations))
+	for _, migration := range localMigrations {
+		if migration.Type != enums.MIGRATION_UP {
+			return []error{fmt.Errorf("invalid migration type: %s", migration.Type.Name())}
+		}
+		byVersion[migration.Version] = migration
+	}
+
+	query := fmt.Sprintf(`
+		SELECT version, description, md5_checksum, success
+		FROM %s
+		ORDER BY version ASC
+	`, r.history_table)
+
+	rows, err := r.db.QueryContext(r.ctx, query)
+	if err != nil {
+		return []error{err}
+	}
+	defer rows.Close()
+
+	errs := make([]error, 0)
+	expectedVersion := uint16(1)
+
+	for rows.Next() {
+		version, description, checksum, success := uint16(0), "", "", 0
+		err = rows.Scan(&version, &description, &checksum, &success)
+		if err != nil {
+			return []error{err}
+		}
+
+		// Check gaps
+		if expectedVersion != version {
+			errs = append(errs, &database.MissingVersionError{Version: expectedVersion})
+		}
+		expectedVersion = version + 1
+
+		// Check description or checksum mismatch
+		local, ok := byVersion[version]
+		if success == 1 && (!ok || local.Description != description || *local.Checksum != checksum) {
+			errs = append(errs, &database.MismatchError{Version: version, Description: description, Checksum: checksum})
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return []error{err}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (r *OracleRepository) ExecuteMigration(migration *migrations.Migration) []error {
+	if migration.Type != enums.MIGRATION_UP {
+		return []error{fmt.Errorf("invalid migration type: %s", migration.Type.Name())}
+	}
+
+	errs := make([]error, 0)
+
+	err := r.execScript(*migration.Content, migration.SkipStatements)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	success := err == nil
+
+	err = r.saveHistory(migration, success, false)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("migration %d: %w", migration.Version, err))
+	} else {
+		err = r.audit(migration, database.AUDIT_UP, success)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("migration %d: %w", migration.Version, err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// SkipMigration records the migration as applied and skipped in the history table without executing it, and
+// records the skip in the audit table.
+func (r *OracleRepository) SkipMigration(migration *migrations.Migration) error {
+	if migration.Type != enums.MIGRATION_UP {
+		return fmt.Errorf("invalid migration type: %s", migration.Type.Name())
+	}
+
+	err := r.saveHistory(migration, true, true)
+	if err != nil {
+		return fmt.Errorf("migration %d: %w", migration.Version, err)
+	}
+
+	return r.audit(migration, database.AUDIT_SKIP, true)
+}
+
+// saveHistory upserts the migration in the history table with the given status, skipped if it was recorded
+// without being executed. Empty strings are NULL in Oracle, so the missing run ID, author and ticket are
+// stored as NULL.
+func (r *OracleRepository) saveHistory(migration *migrations.Migration, success bool, skipped bool) error {
+	query := fmt.Sprintf(`
+		MERGE INTO %s h
+		USING (SELECT :1 AS version, :2 AS description, :3 AS md5_checksum, :4 AS success, :5 AS run_id,
+			:6 AS author, :7 AS ticket, :8 AS skipped FROM dual) l
+		ON (h.version = l.version)
+		WHEN MATCHED THEN UPDATE SET description = l.description, md5_checksum = l.md5_checksum,
+			success = l.success, run_id = l.run_id, author = l.author, ticket = l.ticket, skipped = l.skipped,
+			executed_at = SYSTIMESTAMP
+		WHEN NOT MATCHED THEN INSERT (version, description, md5_checksum, success, run_id, author, ticket,
+			skipped)
+			VALUES (l.version, l.description, l.md5_checksum, l.success, l.run_id, l.author, l.ticket,
+			l.skipped)
+	`, r.history_table)
+
+	_, err := r.db.ExecContext(r.ctx, query, int(migration.Version), migration.Description, *migration.Checksum,
+		number(success), r.run.ID, migration.Author, migration.Ticket, number(skipped))
+	return err
+}
+
+func (r *OracleRepository) ExecuteHook(hook *migrations.Hook) error {
+	return r.execScript(*hook.Content, 0)
+}
+
+func (r *OracleRepository) ExecuteAssertion(hook *migrations.Hook) error {
+	rows, err := r.db.QueryContext(r.ctx, strings.TrimSuffix(strings.TrimSpace(*hook.Content), ";"))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+
+	rowsCount := 0
+	isBool, isTrue := false, false
+	for rows.Next() {
+		rowsCount++
+		if rowsCount == 1 && len(columns) == 1 {
+			var value any
+			if err := rows.Scan(&value); err != nil {
+				return err
+			}
+			isTrue, isBool = boolValue(value)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if rowsCount == 0 || (rowsCount == 1 && isTrue) {
+		return nil
+	}
+
+	if rowsCount == 1 && isBool {
+		return fmt.Errorf("assertion failed: query returned false")
+	}
+
+	return fmt.Errorf("assertion failed: query returned %d rows", rowsCount)
+}
+
+// boolValue returns the boolean of a value returned by the server. Oracle has no boolean expressions in
+// select lists before 23ai, so the numbers 1 and 0 (e.g. of CASE expressions) are booleans.
+func boolValue(value any) (isTrue bool, isBool bool) {
+	switch v := value.(type) {
+	case bool:
+		return v, true
+	case int64:
+		return v == 1, v == 0 || v == 1
+	case float64:
+		return v == 1, v == 0 || v == 1
+	}
+	return false, false
+}
+
+func (r *OracleRepository) RollbackMigration(migration *migrations.Migration) error {
+	if migration.Type != enums.MIGRATION_DOWN {
+		return fmt.Errorf("invalid migration type: %s", migration.Type.Name())
+	}
+
+	query := fmt.Sprintf(`
+		SELECT COUNT(*) FROM %s WHERE version = :1
+	`, r.history_table)
+
+	count := 0
+	err := r.db.QueryRowContext(r.ctx, query, int(migration.Version)).Scan(&count)
+	if err != nil {
+		return err
+	}
+
+	if count < 1 {
+		return nil
+	}
+
+	err = r.execScript(*migration.Content, 0)
+	if err != nil {
+		return err
+	}
+
+	query = fmt.Sprintf(`
+		DELETE FROM %s
+		WHERE version = :1
+	`, r.history_table)
+
+	res, err := r.db.ExecContext(r.ctx, query, int(migration.Version))
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected < 1 {
+		return fmt.Errorf("version was not deleted from \"%s\" table", r.history_table)
+	}
+
+	return r.audit(migration, database.AUDIT_DOWN, true)
+}
+
+// ServerInfo returns the version of the server, and the current container and schema as schema.
+func (r *OracleRepository) ServerInfo() (*database.ServerInfo, error) {
+	info := &database.ServerInfo{HistoryTable: r.history_table}
+
+	err := r.db.QueryRowContext(r.ctx, `
+		SELECT product || ' ' || version, SYS_CONTEXT('USERENV', 'CON_NAME') || '.' ||
+			SYS_CONTEXT('USERENV', 'CURRENT_SCHEMA')
+		FROM product_component_version
+		WHERE product LIKE 'Oracle%' AND ROWNUM = 1
+	`).Scan(&info.Version, &info.Schema)
+	if err != nil {
+		return nil, err
+	}
+
+	info.HistoryTableExists, err = r.CheckSchemaHistoryTable()
+	if err != nil || !info.HistoryTableExists {
+		return info, err
+	}
+
+	query := fmt.Sprintf("SELECT COUNT(*) FROM %s", r.history_table)
+	err = r.db.QueryRowContext(r.ctx, query).Scan(&info.HistoryRows)
+	if err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
+
+func (r *OracleRepository) Capabilities() database.Capabilities {
+	return database.Capabilities{
+		SupportsTransactions:   false,
+		SupportsAdvisoryLock:   true,
+		SupportsMultiStatement: false,
+		MaxIdentifierLength:    128,
+	}
+}
+
+func (r *OracleRepository) SetRunInfo(info database.RunInfo) {
+	r.run = info
+}
+
+func (r *OracleRepository) auditTable() string {
+	return r.history_table + "_audit"
+}
+
+// audit records the execution of the migration in the audit table.
+func (r *OracleRepository) audit(migration *migrations.Migration, direction string, success bool) error {
+	query := fmt.Sprintf(`
+		INSERT INTO %s (run_id, maestro_version, direction, version, description, success)
+		VALUES (:1, :2, :3, :4, :5, :6)
+	`, r.auditTable())
+
+	_, err := r.db.ExecContext(r.ctx, query, r.run.ID, r.run.MaestroVersion, direction,
+		int(migration.Version), migration.Description, number(success))
+	if err != nil {
+		return fmt.Errorf("error recording audit: %w", err)
+	}
+
+	return nil
+}
+
+// DoInTransaction runs the callback without a transaction: DDL is committed implicitly by Oracle,
+// so failed migrations are recorded in the schema history table instead of being rolled back.
+func (r *OracleRepository) DoInTransaction(fn func() error) error {
+	return fn()
+}
+
+// DoOutsideTransaction runs the callback, as DoInTransaction does not start a transaction.
+func (r *OracleRepository) DoOutsideTransaction(fn func() error) error {
+	return fn()
+}
+
+// Session returns a repository sharing the connections of this one, with its own run info.
+func (r *OracleRepository) Session() database.Repository {
+	session := *r
+	return &session
+}
+
+// lockName returns the name of the user lock of DoInLock.
+func (r *OracleRepository) lockName() (string, error) {
+	schema := ""
+	err := r.db.QueryRowContext(r.ctx, `
+		SELECT SYS_CONTEXT('USERENV', 'CURRENT_SCHEMA') FROM dual
+	`).Scan(&schema)
+	if err != nil {
+		return "", err
+	}
+
+	return lock_prefix + schema + "." + strings.ToUpper(r.history_table), nil
+}
+
+// GetLockInfo reports whether a session holds the user lock, by trying to take it without waiting, and
+// the session, user and machine holding it, with the time it was taken. The holder is only known with the
+// SELECT privilege on V$LOCK, V$SESSION and DBMS_LOCK_ALLOCATED.
+func (r *OracleRepository) GetLockInfo() (*database.LockInfo, error) {
+	name, err := r.lockName()
+	if err != nil {
+		return nil, err
+	}
+
+	locked := 0
+	err = r.onConnection(func(conn connection) error {
+		// The lock is released at once if it was free
+		_, err := conn.ExecContext(r.ctx, `
+			DECLARE
+				handle VARCHAR2(128);
+				status INTEGER;
+			BEGIN
+				DBMS_LOCK.ALLOCATE_UNIQUE(:1, handle);
+				status := DBMS_LOCK.REQUEST(handle, DBMS_LOCK.X_MODE, 0, FALSE);
+				IF status = 0 THEN
+					status := DBMS_LOCK.RELEASE(handle);
+					:2 := 0;
+				ELSE
+					:2 := 1;
+				END IF;
+			END;
+		`, name, sql.Out{Dest: &locked})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if locked == 0 {
+		return &database.LockInfo{}, nil
+	}
+
+	info := &database.LockInfo{Locked: true}
+
+	session, user, machine, lockedAt := int64(0), sql.NullString{}, sql.NullString{}, time.Time{}
+	err = r.db.QueryRowContext(r.ctx, `
+		SELECT s.sid, s.username, s.machine, CAST(SYSTIMESTAMP - NUMTODSINTERVAL(l.ctime, 'SECOND') AS TIMESTAMP)
+		FROM v$lock l
+		JOIN dbms_lock_allocated a ON a.lockid = l.id1
+		JOIN v$session s ON s.sid = l.sid
+		WHERE l.type = 'UL' AND l.lmode = 6 AND a.name = :1 AND ROWNUM = 1
+	`, name).Scan(&session, &user, &machine, &lockedAt)
+	if errors.Is(err, sql.ErrNoRows) || isMissingTable(err) {
+		return info, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	info.Owner = fmt.Sprintf("session %d, user %s on %s", session, user.String, machine.String)
+	info.LockedAt = &lockedAt
+	return info, nil
+}
+
+// DoInLock takes an exclusive user lock (DBMS_LOCK), released by the server if the session ends, waiting
+// up to lock_timeout seconds for another session to release it. The lock belongs to the session taking it,
+// so the callback runs while the connection taking the lock is reserved.
+func (r *OracleRepository) DoInLock(fn func() error) error {
+	name, err := r.lockName()
+	if err != nil {
+		return err
+	}
+
+	return r.onConnection(func(conn connection) error {
+		// DBMS_LOCK.REQUEST returns 0 once the lock is taken, 1 on timeout and another status otherwise
+		status := 0
+		_, err := conn.ExecContext(r.ctx, `
+			DECLARE
+				handle VARCHAR2(128);
+			BEGIN
+				DBMS_LOCK.ALLOCATE_UNIQUE(:1, handle);
+				:2 := DBMS_LOCK.REQUEST(handle, DBMS_LOCK.X_MODE, :3, FALSE);
+			END;
+		`, name, sql.Out{Dest: &status}, lock_timeout)
+		if err != nil {
+			return fmt.Errorf("failed to acquire lock: %w", err)
+		}
+		if status == 1 {
+			return fmt.Errorf("timeout while waiting for the lock of %s", r.history_table)
+		}
+		if status != 0 {
+			return fmt.Errorf("failed to acquire lock: DBMS_LOCK.REQUEST returned %d", status)
+		}
+		defer func() {
+			// The handle of the name is the same as long as the lock is allocated
+			_, err = conn.ExecContext(r.ctx, `
+				DECLARE
+					handle VARCHAR2(128);
+					status INTEGER;
+				BEGIN
+					DBMS_LOCK.ALLOCATE_UNIQUE(:1, handle);
+					status := DBMS_LOCK.RELEASE(handle);
+				END;
+			`, name)
+			if err != nil {
+				panic(fmt.Errorf("failed to release lock: %w", err))
+			}
+		}()
+
+		return fn()
+	})
+}
+
+// connection is the part of a database connection used by the statements depending on the state of their session.
+type connection interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// onConnection runs the callback on a connection of the pool reserved until it returns. With a single
+// connection, the callback runs on the connection of the pool. The pool of read-only databases is used too,
+// as the callbacks only take and release locks.
+func (r *OracleRepository) onConnection(fn func(conn connection) error) error {
+	pool, ok := database.Pool(r.db)
+	if !ok {
+		return fn(r.db)
+	}
+	if database.SingleConnection(pool) {
+		return fn(pool)
+	}
+
+	conn, err := pool.Conn(r.ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return fn(conn)
+}
+
+func (r *OracleRepository) Repair(migrations []*migrations.Migration) []error {
+	tableExists, err := r.CheckSchemaHistoryTable()
+	if err != nil {
+		return []error{err}
+	}
+
+	if !tableExists {
+		return nil
+	}
+
+	// MERGE is DML, so unlike migrations the batches can be committed together.
+	tx, err := r.db.BeginTx(r.ctx, nil)
+	if err != nil {
+		return []error{err}
+	}
+	defer tx.Rollback()
+
+	for _, batch := range database.Batches(migrations, repair_batch_size) {
+		rows := make([]string, 0, len(batch))
+		args := make([]any, 0, len(batch)*3)
+		for i, migration := range batch {
+			rows = append(rows, fmt.Sprintf("SELECT :%d AS version, :%d AS description, :%d AS md5_checksum FROM dual",
+				i*3+1, i*3+2, i*3+3))
+			args = append(args, int(migration.Version), migration.Description, *migration.Checksum)
+		}
+
+		query := fmt.Sprintf(`
+			MERGE INTO %s h
+			USING (%s) l
+			ON (h.version = l.version)
+			WHEN MATCHED THEN UPDATE SET description = l.description, md5_checksum = l.md5_checksum,
+				repaired_at = SYSTIMESTAMP
+				WHERE h.description <> l.description OR h.md5_checksum <> l.md5_checksum
+			WHEN NOT MATCHED THEN INSERT (version, description, md5_checksum, success, repaired_at)
+				VALUES (l.version, l.description, l.md5_checksum, 1, SYSTIMESTAMP)
+		`, r.history_table, strings.Join(rows, " UNION ALL "))
+
+		_, err := tx.ExecContext(r.ctx, query, args...)
+		if err != nil {
+			return []error{err}
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return []error{err}
+	}
+
+	return nil
+}
+
+// Annotate sets the note of the version in the notes column of the history table, added if missing.
+func (r *OracleRepository) Annotate(version uint16, note string) error {
+	exists, err := r.CheckSchemaHistoryTable()
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return fmt.Errorf("version %d: %w", version, database.ErrNotApplied)
+	}
+
+	// History tables created by previous versions have no notes column
+	err = r.upgradeHistoryTable()
+	if err != nil {
+		return err
+	}
+
+	// An empty note is NULL
+	res, err := r.db.ExecContext(r.ctx, fmt.Sprintf("UPDATE %s SET notes = :1 WHERE version = :2", r.history_table),
+		note, int(version))
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected < 1 {
+		return fmt.Errorf("version %d: %w", version, database.ErrNotApplied)
+	}
+
+	return nil
+}
+
+func (r *OracleRepository) GetFailingMigrations() ([]*migrations.Migration, error) {
+	exists, err := r.CheckSchemaHistoryTable()
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		return nil, nil
+	}
+
+	query := fmt.Sprintf(`
+		SELECT version, description, md5_checksum
+		FROM %s
+		WHERE success = 0
+	`, r.history_table)
+
+	rows, err := r.db.QueryContext(r.ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var failingMigrations []*migrations.Migration
+	for rows.Next() {
+		var migration migrations.Migration
+		if err := rows.Scan(&migration.Version, &migration.Description, &migration.Checksum); err != nil {
+			return nil, err
+		}
+		failingMigrations = append(failingMigrations, &migration)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return failingMigrations, nil
+}
+
+func (r *OracleRepository) GetAppliedMigrations() ([]*database.AppliedMigration, error) {
+	exists, err := r.CheckSchemaHistoryTable()
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		return nil, nil
+	}
+
+	// History tables created by previous versions have no author, ticket and skipped columns until the next
+	// run
+	columns, err := r.historyColumns()
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := "CAST(NULL AS VARCHAR2(255)), CAST(NULL AS VARCHAR2(64))"
+	if columns["author"] && columns["ticket"] {
+		metadata = "author, ticket"
+	}
+
+	skipped := "0"
+	if columns["skipped"] {
+		skipped = "skipped"
+	}
+
+	query := fmt.Sprintf(`
+		SELECT version, description, md5_checksum, success, %s, %s
+		FROM %s
+		ORDER BY version ASC
+	`, metadata, skipped, r.history_table)
+
+	rows, err := r.db.QueryContext(r.ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make([]*database.AppliedMigration, 0)
+	for rows.Next() {
+		migration := new(database.AppliedMigration)
+		success, author, ticket, skipped := 0, sql.NullString{}, sql.NullString{}, 0
+		err := rows.Scan(&migration.Version, &migration.Description, &migration.Checksum, &success,
+			&author, &ticket, &skipped)
+		if err != nil {
+			return nil, err
+		}
+		migration.Success, migration.Author, migration.Ticket = success == 1, author.String, ticket.String
+		migration.Skipped = skipped == 1
+		applied = append(applied, migration)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return applied, nil
+}
+
+// Clean drops the materialized views, views, tables, sequences, routines, packages, synonyms and types of
+// the current schema. Tables are dropped with their constraints, so in any order, and purged from the
+// recycle bin. Objects generated by Oracle (e.g. the sequences of identity columns) are dropped with
+// the objects owning them.
+func (r *OracleRepository) Clean() error {
+	query := `
+		SELECT CASE object_type
+			WHEN 'TABLE' THEN 'DROP TABLE "' || object_name || '" CASCADE CONSTRAINTS PURGE'
+			WHEN 'TYPE' THEN 'DROP TYPE "' || object_name || '" FORCE'
+			ELSE 'DROP ' || object_type || ' "' || object_name || '"'
+		END
+		FROM user_objects
+		WHERE object_type IN ('MATERIALIZED VIEW', 'VIEW', 'TABLE', 'SEQUENCE', 'PROCEDURE', 'FUNCTION',
+				'PACKAGE', 'SYNONYM', 'TYPE')
+			AND generated = 'N' AND secondary = 'N' AND object_name NOT LIKE 'BIN$%'
+			AND NOT (object_type = 'TABLE' AND object_name IN (SELECT mview_name FROM user_mviews))
+			AND NOT (object_type = 'TABLE' AND object_name IN (SELECT table_name FROM user_tables WHERE nested = 'YES'))
+		ORDER BY CASE object_type
+			WHEN 'MATERIALIZED VIEW' THEN 1 WHEN 'VIEW' THEN 2 WHEN 'TABLE' THEN 3 WHEN 'TYPE' THEN 5 ELSE 4
+		END
+	`
+
+	rows, err := r.db.QueryContext(r.ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	statements := make([]string, 0)
+	for rows.Next() {
+		statement := ""
+		if err := rows.Scan(&statement); err != nil {
+			return err
+		}
+		statements = append(statements, statement)
+	}
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	for _, statement := range statements {
+		_, err = r.db.ExecContext(r.ctx, statement)
+		if err != nil {
+			return fmt.Errorf("error executing %q: %w", statement, err)
+		}
+	}
+
+	return nil
+}
+
+// execScript executes a migration or hook script one statement at a time, as the Oracle driver
+// does not accept multiple statements in a single call.
+func (r *OracleRepository) execScript(script string, skip int) error {
+	for i, statement := range migrations.SplitPLSQLStatements(script) {
+		if i < skip {
+			continue
+		}
+
+		_, err := r.db.ExecContext(r.ctx, statement)
+		if err != nil {
+			return &database.StatementError{Index: i + 1, Err: fmt.Errorf("statement %d (%s): %w", i+1, firstLine(statement), err)}
+		}
+	}
+
+	return nil
+}
+
+// isMissingTable reports whether the error is ORA-00942, returned for tables and views that do not exist
+// or that the user is not allowed to read.
+func isMissingTable(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "ORA-00942")
+}
+
+// number returns the NUMBER(1) value of a boolean.
+func number(value bool) int {
+	if value {
+		return 1
+	}
+	return 0
+}
+
+func firstLine(statement string) string {
+	line, _, _ := strings.Cut(statement, "\n")
+	return line
+}
@@ -0,0 +1,521 @@
+package oracle
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+
+	"github.com/maestro-go/maestro/core/database"
+	"github.com/maestro-go/maestro/core/enums"
+	"github.com/maestro-go/maestro/core/maestrotest"
+	"github.com/maestro-go/maestro/internal/migrations"
+	testUtils "github.com/maestro-go/maestro/internal/utils/testing"
+	"github.com/stretchr/testify/suite"
+
+	_ "github.com/sijms/go-ora/v2"
+)
+
+type MigrationTestSuite struct {
+	suite.Suite
+	oracle  *testUtils.OracleContainer
+	suiteDb *sql.DB
+
+	ctx context.Context
+
+	repository *OracleRepository
+}
+
+func (s *MigrationTestSuite) SetupSuite() {
+	s.ctx = context.Background()
+
+	s.oracle = testUtils.SetupOracle(s.T())
+
+	db, err := sql.Open("oracle", s.oracle.URI)
+	s.Assert().NoError(err)
+
+	s.suiteDb = db
+
+	s.repository = NewOracleRepository(s.ctx, db, testUtils.ToPtr(default_history_table))
+}
+
+func (s *MigrationTestSuite) TearDownTest() {
+	if s.oracle != nil {
+		err := s.repository.Clean()
+		s.Assert().NoError(err)
+	}
+}
+
+func (s *MigrationTestSuite) checkObjectExists(name string, shouldExist bool) {
+	s.T().Helper()
+
+	count := 0
+	err := s.suiteDb.QueryRowContext(s.ctx, `
+		SELECT COUNT(*) FROM user_objects WHERE object_name = UPPER(:1)
+	`, name).Scan(&count)
+	s.Assert().NoError(err)
+	s.Assert().Equal(shouldExist, count > 0)
+}
+
+func TestMigrationSuite(t *testing.T) {
+	suite.Run(t, new(MigrationTestSuite))
+}
+
+func (s *MigrationTestSuite) TestAssertSchemaHistoryTable() {
+	err := s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+
+	s.checkObjectExists(default_history_table, true)
+	s.checkObjectExists(default_history_table+"_audit", true)
+
+	// Existing tables are kept
+	err = s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+}
+
+func (s *MigrationTestSuite) TestCheckSchemaHistoryTable() {
+	exists, err := s.repository.CheckSchemaHistoryTable()
+	s.Assert().NoError(err)
+	s.Assert().False(exists)
+
+	err = s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+
+	exists, err = s.repository.CheckSchemaHistoryTable()
+	s.Assert().NoError(err)
+	s.Assert().True(exists)
+}
+
+func (s *MigrationTestSuite) TestGetLatestMigration() {
+	version, err := s.repository.GetLatestMigration()
+	s.Assert().NoError(err)
+	s.Assert().Equal(uint16(0), version)
+
+	err = s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+
+	version, err = s.repository.GetLatestMigration()
+	s.Assert().NoError(err)
+	s.Assert().Equal(uint16(0), version)
+
+	query := fmt.Sprintf(`
+		INSERT INTO %s (version, description, md5_checksum, success)
+		SELECT 1, 't', '0a52730597fb4ffa01fc117d9e71e3a9', 1 FROM dual UNION ALL
+		SELECT 40000, 't', '0a52730597fb4ffa01fc117d9e71e3a9', 1 FROM dual UNION ALL
+		SELECT 40001, 't', '0a52730597fb4ffa01fc117d9e71e3a9', 0 FROM dual
+	`, default_history_table)
+
+	_, err = s.suiteDb.Exec(query)
+	s.Assert().NoError(err)
+
+	version, err = s.repository.GetLatestMigration()
+	s.Assert().NoError(err)
+	s.Assert().Equal(uint16(40000), version)
+}
+
+func (s *MigrationTestSuite) TestValidateMigrations() {
+	checksums := []string{"0a52730597fb4ffa01fc117d9e71e3a9", "3d41c8443df34e73867adb149efbb2ea"}
+	contents := []string{"EXAMPLE CONTENT 1", "EXAMPLE CONTENT 2"}
+	migrations := []*migrations.Migration{
+		{
+			Version:     1,
+			Description: "abcd",
+			Type:        enums.MIGRATION_UP,
+			Checksum:    &checksums[0],
+			Content:     &contents[0],
+		},
+		{
+			Version:     2,
+			Description: "abcd",
+			Type:        enums.MIGRATION_UP,
+			Checksum:    &checksums[1],
+			Content:     &contents[1],
+		},
+	}
+
+	errs := s.repository.ValidateMigrations(migrations)
+	s.Assert().Nil(errs)
+
+	err := s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+
+	errs = s.repository.ValidateMigrations(migrations)
+	s.Assert().Nil(errs)
+
+	query := fmt.Sprintf(`
+		INSERT INTO %s (version, description, md5_checksum, success) VALUES (:1, :2, :3, 1)
+	`, default_history_table)
+
+	_, err = s.suiteDb.ExecContext(s.ctx, query, int(migrations[1].Version),
+		migrations[1].Description, *migrations[1].Checksum)
+	s.Assert().NoError(err)
+
+	errs = s.repository.ValidateMigrations(migrations)
+	s.Assert().Len(errs, 1)
+
+	_, err = s.suiteDb.ExecContext(s.ctx, query, int(migrations[0].Version),
+		migrations[0].Description, *migrations[0].Checksum)
+	s.Assert().NoError(err)
+
+	errs = s.repository.ValidateMigrations(migrations)
+	s.Assert().Nil(errs)
+}
+
+func (s *MigrationTestSuite) TestExecuteMigration() {
+	checksum := "0a52730597fb4ffa01fc117d9e71e3a9"
+	content := "INVALID SQL"
+	migration := &migrations.Migration{
+		Version:     1,
+		Description: "abcd",
+		Type:        enums.MIGRATION_UP,
+		Checksum:    &checksum,
+		Content:     &content,
+		Author:      "Jane Doe <jane@example.com>",
+		Ticket:      "OPS-123",
+	}
+
+	// Invalid SQL
+	errs := s.repository.ExecuteMigration(migration)
+	s.Assert().Len(errs, 2)
+
+	*migration.Content = "CREATE TABLE test (id NUMBER(10) NOT NULL PRIMARY KEY);"
+
+	// No schema table
+	errs = s.repository.ExecuteMigration(migration)
+	s.Assert().Len(errs, 1)
+
+	err := s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+
+	// PL/SQL blocks end with a slash line
+	*migration.Content = `
+CREATE TABLE test2 (id NUMBER(10) NOT NULL PRIMARY KEY);
+CREATE OR REPLACE PROCEDURE add_test2(p_id NUMBER) AS
+BEGIN
+	INSERT INTO test2 VALUES (p_id);
+END;
+/
+BEGIN
+	add_test2(1);
+END;
+/
+`
+
+	errs = s.repository.ExecuteMigration(migration)
+	s.Assert().Nil(errs)
+
+	s.checkObjectExists(default_history_table, true)
+	s.checkObjectExists("test2", true)
+	s.checkObjectExists("add_test2", true)
+
+	applied, err := s.repository.GetAppliedMigrations()
+	s.Assert().NoError(err)
+	s.Require().Len(applied, 1)
+	s.Assert().Equal(migration.Version, applied[0].Version)
+	s.Assert().Equal(migration.Description, applied[0].Description)
+	s.Assert().Equal(*migration.Checksum, applied[0].Checksum)
+	s.Assert().True(applied[0].Success)
+	s.Assert().Equal(migration.Author, applied[0].Author)
+	s.Assert().Equal(migration.Ticket, applied[0].Ticket)
+
+	// The statements executed before the failed one are committed, and the failed statement is reported
+	*migration.Content = "CREATE TABLE test3 (id NUMBER(10));\nINVALID SQL"
+
+	errs = s.repository.ExecuteMigration(migration)
+	s.Require().Len(errs, 1)
+
+	var statementErr *database.StatementError
+	s.Require().ErrorAs(errs[0], &statementErr)
+	s.Assert().Equal(2, statementErr.Index)
+
+	s.checkObjectExists("test3", true)
+
+	failing, err := s.repository.GetFailingMigrations()
+	s.Assert().NoError(err)
+	s.Assert().Len(failing, 1)
+}
+
+func (s *MigrationTestSuite) TestExecuteAssertion() {
+	content := "SELECT 1 FROM dual"
+	hook := &migrations.Hook{
+		Order:   1,
+		Content: &content,
+		Type:    enums.HOOK_ASSERTION,
+	}
+
+	err := s.repository.ExecuteAssertion(hook)
+	s.Assert().NoError(err)
+
+	*hook.Content = "SELECT CASE WHEN 1 = 2 THEN 1 ELSE 0 END FROM dual;"
+	err = s.repository.ExecuteAssertion(hook)
+	s.Assert().ErrorContains(err, "returned false")
+
+	*hook.Content = "SELECT 1 FROM user_tables WHERE 1 = 0"
+	err = s.repository.ExecuteAssertion(hook)
+	s.Assert().NoError(err)
+}
+
+func (s *MigrationTestSuite) TestRollbackMigration() {
+	content := "INVALID SQL"
+	migration := &migrations.Migration{
+		Version:     1,
+		Description: "abcd",
+		Type:        enums.MIGRATION_DOWN,
+		Content:     &content,
+	}
+
+	err := s.repository.RollbackMigration(migration)
+	s.Assert().Error(err)
+
+	*migration.Content = "DROP TABLE test4;"
+
+	err = s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+
+	// Versions not applied are not rolled back
+	err = s.repository.RollbackMigration(migration)
+	s.Assert().NoError(err)
+
+	_, err = s.suiteDb.ExecContext(s.ctx, "CREATE TABLE test4 (id NUMBER(10) NOT NULL PRIMARY KEY)")
+	s.Assert().NoError(err)
+	_, err = s.suiteDb.ExecContext(s.ctx, fmt.Sprintf(`
+		INSERT INTO %s (version, description, md5_checksum, success)
+		VALUES (1, 'abcd', '0a52730597fb4ffa01fc117d9e71e3a9', 1)
+	`, default_history_table))
+	s.Assert().NoError(err)
+
+	s.checkObjectExists("test4", true)
+
+	err = s.repository.RollbackMigration(migration)
+	s.Assert().NoError(err)
+
+	s.checkObjectExists("test4", false)
+
+	version, err := s.repository.GetLatestMigration()
+	s.Assert().NoError(err)
+	s.Assert().Equal(uint16(0), version)
+}
+
+func (s *MigrationTestSuite) TestDoInTransaction() {
+	// DDL is committed implicitly, so nothing is rolled back
+	err := s.repository.DoInTransaction(func() error {
+		_, err := s.repository.db.ExecContext(s.ctx, "CREATE TABLE test1 (id NUMBER(10) NOT NULL PRIMARY KEY)")
+		s.Assert().NoError(err)
+
+		return fmt.Errorf("example error")
+	})
+	s.Assert().Error(err)
+
+	s.checkObjectExists("test1", true)
+
+	s.Assert().False(s.repository.Capabilities().SupportsTransactions)
+}
+
+func (s *MigrationTestSuite) TestDoInLock() {
+	info, err := s.repository.GetLockInfo()
+	s.Assert().NoError(err)
+	s.Assert().False(info.Locked)
+
+	name, err := s.repository.lockName()
+	s.Require().NoError(err)
+
+	err = s.repository.DoInLock(func() error {
+		// Other sessions wait for the lock
+		status := 0
+		_, err := s.suiteDb.ExecContext(s.ctx, `
+			DECLARE
+				handle VARCHAR2(128);
+			BEGIN
+				DBMS_LOCK.ALLOCATE_UNIQUE(:1, handle);
+				:2 := DBMS_LOCK.REQUEST(handle, DBMS_LOCK.X_MODE, 0, FALSE);
+			END;
+		`, name, sql.Out{Dest: &status})
+		s.Assert().NoError(err)
+		s.Assert().Equal(1, status)
+
+		info, err := s.repository.GetLockInfo()
+		s.Assert().NoError(err)
+		s.Assert().True(info.Locked)
+		return nil
+	})
+	s.Assert().NoError(err)
+
+	info, err = s.repository.GetLockInfo()
+	s.Assert().NoError(err)
+	s.Assert().False(info.Locked)
+}
+
+func (s *MigrationTestSuite) TestReadOnly() {
+	repository := NewOracleRepository(s.ctx, database.ReadOnly(s.suiteDb), testUtils.ToPtr(default_history_table))
+
+	// Writes fail without reaching the server
+	err := repository.AssertSchemaHistoryTable()
+	s.Assert().ErrorIs(err, database.ErrReadOnly)
+	s.checkObjectExists(default_history_table, false)
+
+	// Queries and locks still run
+	exists, err := repository.CheckSchemaHistoryTable()
+	s.Assert().NoError(err)
+	s.Assert().False(exists)
+
+	info, err := repository.GetLockInfo()
+	s.Assert().NoError(err)
+	s.Assert().False(info.Locked)
+
+	err = s.repository.AssertSchemaHistoryTable()
+	s.Require().NoError(err)
+
+	content := "CREATE TABLE test1 (id INT);"
+	errs := repository.ExecuteMigration(&migrations.Migration{Version: 1, Description: "test", Type: enums.MIGRATION_UP,
+		Checksum: testUtils.ToPtr("0a52730597fb4ffa01fc117d9e71e3a9"), Content: &content})
+	s.Require().NotEmpty(errs)
+	s.Assert().ErrorIs(errs[0], database.ErrReadOnly)
+
+	version, err := repository.GetLatestMigration()
+	s.Assert().NoError(err)
+	s.Assert().Equal(uint16(0), version)
+}
+
+func (s *MigrationTestSuite) TestRepair() {
+	checksums := []string{"0a52730597fb4ffa01fc117d9e71e3a9", "3d41c8443df34e73867adb149efbb2ea"}
+	contents := []string{"EXAMPLE CONTENT 1", "EXAMPLE CONTENT 2"}
+	migrations := []*migrations.Migration{
+		{
+			Version:     1,
+			Description: "abcd",
+			Type:        enums.MIGRATION_UP,
+			Checksum:    &checksums[0],
+			Content:     &contents[0],
+		},
+		{
+			Version:     2,
+			Description: "abcd",
+			Type:        enums.MIGRATION_UP,
+			Checksum:    &checksums[1],
+			Content:     &contents[1],
+		},
+	}
+
+	err := s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+
+	// Simulate a checksum mismatch
+	query := fmt.Sprintf(`
+		INSERT INTO %s (version, description, md5_checksum, success)
+		VALUES (:1, :2, 'd41d8cd98f00b204e9800998ecf8427e', 0)
+	`, default_history_table)
+
+	_, err = s.suiteDb.ExecContext(s.ctx, query, int(migrations[0].Version), migrations[0].Description)
+	s.Assert().NoError(err)
+
+	errs := s.repository.Repair(migrations)
+	s.Assert().Nil(errs)
+
+	query = fmt.Sprintf(`
+		SELECT md5_checksum, CASE WHEN repaired_at IS NULL THEN 0 ELSE 1 END FROM %s
+		WHERE version = :1
+	`, default_history_table)
+
+	repairedChecksum, repaired := "", 0
+	err = s.suiteDb.QueryRowContext(s.ctx, query, int(migrations[0].Version)).Scan(&repairedChecksum, &repaired)
+	s.Assert().NoError(err)
+	s.Assert().Equal(*migrations[0].Checksum, repairedChecksum)
+	s.Assert().Equal(1, repaired)
+
+	// Missing migrations are inserted
+	err = s.suiteDb.QueryRowContext(s.ctx, query, int(migrations[1].Version)).Scan(&repairedChecksum, &repaired)
+	s.Assert().NoError(err)
+	s.Assert().Equal(*migrations[1].Checksum, repairedChecksum)
+}
+
+func (s *MigrationTestSuite) TestAnnotate() {
+	err := s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+
+	err = s.repository.Annotate(1, "note")
+	s.Assert().ErrorIs(err, database.ErrNotApplied)
+
+	_, err = s.suiteDb.ExecContext(s.ctx, fmt.Sprintf(`
+		INSERT INTO %s (version, description, md5_checksum, success)
+		VALUES (1, 'abcd', '0a52730597fb4ffa01fc117d9e71e3a9', 1)
+	`, default_history_table))
+	s.Assert().NoError(err)
+
+	err = s.repository.Annotate(1, "note")
+	s.Assert().NoError(err)
+
+	note := ""
+	err = s.suiteDb.QueryRowContext(s.ctx, fmt.Sprintf("SELECT notes FROM %s WHERE version = 1",
+		default_history_table)).Scan(&note)
+	s.Assert().NoError(err)
+	s.Assert().Equal("note", note)
+}
+
+func (s *MigrationTestSuite) TestGetFailingMigrations() {
+	err := s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+
+	query := fmt.Sprintf(`
+		INSERT INTO %s (version, description, md5_checksum, success)
+		SELECT 1, 't', '0a52730597fb4ffa01fc117d9e71e3a9', 0 FROM dual UNION ALL
+		SELECT 2, 't', '0a52730597fb4ffa01fc117d9e71e3a9', 1 FROM dual UNION ALL
+		SELECT 3, 't', '0a52730597fb4ffa01fc117d9e71e3a9', 0 FROM dual
+	`, default_history_table)
+
+	_, err = s.suiteDb.Exec(query)
+	s.Assert().NoError(err)
+
+	failingMigrations, err := s.repository.GetFailingMigrations()
+	s.Assert().NoError(err)
+	s.Assert().Len(failingMigrations, 2)
+}
+
+func (s *MigrationTestSuite) TestClean() {
+	err := s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+
+	hook := `
+CREATE SEQUENCE clean_seq;
+CREATE TABLE clean_parent (id NUMBER(10) GENERATED ALWAYS AS IDENTITY PRIMARY KEY);
+CREATE TABLE clean_child (id NUMBER(10) PRIMARY KEY, parent_id NUMBER(10) REFERENCES clean_parent (id));
+CREATE VIEW clean_view AS SELECT id FROM clean_child;
+CREATE FUNCTION clean_function RETURN NUMBER AS
+BEGIN
+	RETURN 1;
+END;
+/
+CREATE TYPE clean_type AS OBJECT (name VARCHAR2(10));
+/
+`
+	err = s.repository.ExecuteHook(&migrations.Hook{Content: &hook})
+	s.Require().NoError(err)
+
+	err = s.repository.DoInLock(func() error {
+		return s.repository.Clean()
+	})
+	s.Assert().NoError(err)
+
+	objects := 0
+	err = s.suiteDb.QueryRowContext(s.ctx, `
+		SELECT COUNT(*) FROM user_objects WHERE object_name NOT LIKE 'BIN$%'
+	`).Scan(&objects)
+	s.Assert().NoError(err)
+	s.Assert().Equal(0, objects)
+}
+
+func (s *MigrationTestSuite) TestRunConcurrent() {
+	maestrotest.RunConcurrent(s.T(), 4, &maestrotest.Config{
+		NewRepository: func(t testing.TB) database.Repository {
+			db, err := sql.Open("oracle", s.oracle.URI)
+			s.Require().NoError(err)
+			t.Cleanup(func() { db.Close() })
+
+			return NewOracleRepository(s.ctx, db, testUtils.ToPtr(default_history_table))
+		},
+		Migrations: []string{
+			"CREATE TABLE concurrent1 (id NUMBER(10) NOT NULL PRIMARY KEY);",
+			"CREATE TABLE concurrent2 (id NUMBER(10) NOT NULL PRIMARY KEY);",
+			"CREATE TABLE concurrent3 (id NUMBER(10) NOT NULL PRIMARY KEY);",
+		},
+	})
+}
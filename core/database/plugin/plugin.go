@@ -0,0 +1,359 @@
+// Package plugin implements the maestro repository for external drivers: binaries named maestro-driver-<name>
+// run as a subprocess, speaking JSON-RPC 2.0 on their standard input and output, one message per line.
+//
+// Each method of the Repository interface is a request of the protocol (see the METHOD_ constants). The
+// callbacks of DoInTransaction, DoOutsideTransaction and DoInLock run in maestro: the plugin is sent a request
+// at their beginning and at their end. Plugins written in Go implement the Repository interface, naming the
+// migrations and hooks passed to its methods with the database.Migration and database.Hook aliases, and call
+// Serve.
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/maestro-go/maestro/core/database"
+	"github.com/maestro-go/maestro/internal/conf"
+	"github.com/maestro-go/maestro/internal/migrations"
+)
+
+type PluginRepository struct {
+	ctx           context.Context
+	conn          io.ReadWriter
+	decoder       *json.Decoder
+	mu            sync.Mutex
+	nextID        uint64
+	history_table string
+	capabilities  *database.Capabilities // Cached, read once
+	run           *runInfoWire           // Run info not sent yet, sent before the next request
+	inTransaction bool
+}
+
+// NewPluginRepository returns a repository sending the requests of the protocol through the given connection,
+// e.g. the standard input and output of the plugin. Initialize must be called before any other method.
+func NewPluginRepository(ctx context.Context, conn io.ReadWriter, history_table *string) *PluginRepository {
+	repo := &PluginRepository{
+		ctx:           ctx,
+		conn:          conn,
+		decoder:       json.NewDecoder(conn),
+		history_table: "schema_history",
+	}
+
+	if history_table != nil {
+		repo.history_table = *history_table
+	}
+
+	return repo
+}
+
+// Initialize sends the connection settings to the plugin, which connects to the database, and checks that it
+// implements the version of the protocol of maestro.
+func (r *PluginRepository) Initialize(params InitializeParams) (*InitializeResult, error) {
+	params.ProtocolVersion = PROTOCOL_VERSION
+	params.MaestroVersion = conf.VERSION
+	params.HistoryTable = r.history_table
+
+	result := &InitializeResult{}
+	err := r.call(METHOD_INITIALIZE, params, result)
+	if err != nil {
+		return nil, err
+	}
+
+	if result.ProtocolVersion != PROTOCOL_VERSION {
+		return nil, fmt.Errorf("plugin %s implements protocol version %d, maestro %s requires version %d",
+			result.Name, result.ProtocolVersion, conf.VERSION, PROTOCOL_VERSION)
+	}
+
+	return result, nil
+}
+
+// Shutdown asks the plugin to close its connection to the database and exit.
+func (r *PluginRepository) Shutdown() error {
+	return r.call(METHOD_SHUTDOWN, nil, nil)
+}
+
+// call sends a request, after the run info set since the previous one, and decodes the result of its
+// response into out, if not nil.
+func (r *PluginRepository) call(method string, params any, out any) error {
+	if err := r.ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.run != nil && method != METHOD_INITIALIZE {
+		err := r.roundTrip(METHOD_SET_RUN_INFO, r.run, nil)
+		if err != nil {
+			return fmt.Errorf("error setting the run info: %w", err)
+		}
+		r.run = nil
+	}
+
+	return r.roundTrip(method, params, out)
+}
+
+// roundTrip sends a request and decodes the result of its response into out, if not nil.
+func (r *PluginRepository) roundTrip(method string, params any, out any) error {
+	r.nextID++
+	req := request{JSONRPC: "2.0", ID: r.nextID, Method: method}
+	if params != nil {
+		content, err := json.Marshal(params)
+		if err != nil {
+			return err
+		}
+		req.Params = content
+	}
+
+	content, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.conn.Write(append(content, '\n'))
+	if err != nil {
+		return fmt.Errorf("error sending %s to the plugin: %w", method, err)
+	}
+
+	resp := &response{}
+	err = r.decoder.Decode(resp)
+	if err != nil {
+		return fmt.Errorf("error reading the response of the plugin to %s: %w", method, err)
+	}
+
+	if resp.ID != req.ID {
+		return fmt.Errorf("response of the plugin to request %d received for request %d of %s", resp.ID, req.ID,
+			method)
+	}
+
+	if resp.Error != nil {
+		return resp.Error.repositoryError()
+	}
+
+	if out == nil || len(resp.Result) == 0 {
+		return nil
+	}
+
+	return json.Unmarshal(resp.Result, out)
+}
+
+// callErrors sends a request whose result is a list of errors.
+func (r *PluginRepository) callErrors(method string, params any) []error {
+	result := &errorsResult{}
+	err := r.call(method, params, result)
+	if err != nil {
+		return []error{err}
+	}
+	return repositoryErrors(result.Errors)
+}
+
+func (r *PluginRepository) Capabilities() database.Capabilities {
+	if r.capabilities != nil {
+		return *r.capabilities
+	}
+
+	wire := &capabilitiesWire{}
+	err := r.call(METHOD_CAPABILITIES, nil, wire)
+	if err != nil {
+		// Nothing is assumed of a plugin that can not tell
+		return database.Capabilities{}
+	}
+
+	r.capabilities = &database.Capabilities{
+		SupportsTransactions:   wire.SupportsTransactions,
+		SupportsAdvisoryLock:   wire.SupportsAdvisoryLock,
+		SupportsMultiStatement: wire.SupportsMultiStatement,
+		MaxIdentifierLength:    wire.MaxIdentifierLength,
+	}
+	return *r.capabilities
+}
+
+func (r *PluginRepository) ServerInfo() (*database.ServerInfo, error) {
+	wire := &serverInfoWire{}
+	err := r.call(METHOD_SERVER_INFO, nil, wire)
+	if err != nil {
+		return nil, err
+	}
+
+	return &database.ServerInfo{
+		Version:            wire.Version,
+		Schema:             wire.Schema,
+		HistoryTable:       wire.HistoryTable,
+		HistoryTableExists: wire.HistoryTableExists,
+		HistoryRows:        wire.HistoryRows,
+	}, nil
+}
+
+func (r *PluginRepository) GetLockInfo() (*database.LockInfo, error) {
+	wire := &lockInfoWire{}
+	err := r.call(METHOD_GET_LOCK_INFO, nil, wire)
+	if err != nil {
+		return nil, err
+	}
+
+	return &database.LockInfo{Locked: wire.Locked, Owner: wire.Owner, LockedAt: wire.LockedAt}, nil
+}
+
+func (r *PluginRepository) GetLatestMigration() (uint16, error) {
+	var version uint16
+	err := r.call(METHOD_GET_LATEST_MIGRATION, nil, &version)
+	return version, err
+}
+
+func (r *PluginRepository) GetAppliedMigrations() ([]*database.AppliedMigration, error) {
+	wires := make([]*appliedMigrationWire, 0)
+	err := r.call(METHOD_GET_APPLIED_MIGRATIONS, nil, &wires)
+	if err != nil {
+		return nil, err
+	}
+
+	applied := make([]*database.AppliedMigration, 0, len(wires))
+	for _, wire := range wires {
+		migration, err := wire.appliedMigration()
+		if err != nil {
+			return nil, err
+		}
+		applied = append(applied, migration)
+	}
+
+	return applied, nil
+}
+
+func (r *PluginRepository) AssertSchemaHistoryTable() error {
+	return r.call(METHOD_ASSERT_SCHEMA_HISTORY, nil, nil)
+}
+
+func (r *PluginRepository) CheckSchemaHistoryTable() (bool, error) {
+	exists := false
+	err := r.call(METHOD_CHECK_SCHEMA_HISTORY, nil, &exists)
+	return exists, err
+}
+
+func (r *PluginRepository) ValidateMigrations(migrations []*migrations.Migration) []error {
+	return r.callErrors(METHOD_VALIDATE_MIGRATIONS, toMigrationWires(migrations))
+}
+
+func (r *PluginRepository) SetRunInfo(info database.RunInfo) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Sent with the next request, as the method can not fail
+	r.run = &runInfoWire{ID: info.ID, MaestroVersion: info.MaestroVersion, Holder: info.Holder()}
+}
+
+func (r *PluginRepository) ExecuteMigration(migration *migrations.Migration) []error {
+	return r.callErrors(METHOD_EXECUTE_MIGRATION, toMigrationWire(migration))
+}
+
+func (r *PluginRepository) SkipMigration(migration *migrations.Migration) error {
+	return r.call(METHOD_SKIP_MIGRATION, toMigrationWire(migration), nil)
+}
+
+func (r *PluginRepository) ExecuteHook(hook *migrations.Hook) error {
+	return r.call(METHOD_EXECUTE_HOOK, toHookWire(hook), nil)
+}
+
+func (r *PluginRepository) ExecuteAssertion(hook *migrations.Hook) error {
+	return r.call(METHOD_EXECUTE_ASSERTION, toHookWire(hook), nil)
+}
+
+func (r *PluginRepository) RollbackMigration(migration *migrations.Migration) error {
+	return r.call(METHOD_ROLLBACK_MIGRATION, toMigrationWire(migration), nil)
+}
+
+func (r *PluginRepository) Repair(migrations []*migrations.Migration) []error {
+	return r.callErrors(METHOD_REPAIR, toMigrationWires(migrations))
+}
+
+func (r *PluginRepository) Annotate(version uint16, note string) error {
+	return r.call(METHOD_ANNOTATE, &annotateParams{Version: version, Note: note}, nil)
+}
+
+func (r *PluginRepository) GetFailingMigrations() ([]*migrations.Migration, error) {
+	wires := make([]*migrationWire, 0)
+	err := r.call(METHOD_GET_FAILING_MIGRATIONS, nil, &wires)
+	if err != nil {
+		return nil, err
+	}
+
+	failing := make([]*migrations.Migration, 0, len(wires))
+	for _, wire := range wires {
+		migration, err := wire.migration()
+		if err != nil {
+			return nil, err
+		}
+		failing = append(failing, migration)
+	}
+
+	return failing, nil
+}
+
+func (r *PluginRepository) Clean() error {
+	return r.call(METHOD_CLEAN, nil, nil)
+}
+
+func (r *PluginRepository) DoInTransaction(fn func() error) error {
+	if !r.Capabilities().SupportsTransactions {
+		return fn()
+	}
+
+	err := r.call(METHOD_BEGIN_TRANSACTION, nil, nil)
+	if err != nil {
+		return err
+	}
+	r.inTransaction = true
+	defer func() {
+		r.inTransaction = false
+	}()
+
+	err = fn()
+	if err != nil {
+		rollbackErr := r.call(METHOD_ROLLBACK_TRANSACTION, nil, nil)
+		if rollbackErr != nil {
+			return errors.Join(err, fmt.Errorf("error rolling back the transaction: %w", rollbackErr))
+		}
+		return err
+	}
+
+	return r.call(METHOD_COMMIT_TRANSACTION, nil, nil)
+}
+
+func (r *PluginRepository) DoOutsideTransaction(fn func() error) error {
+	if !r.inTransaction {
+		return fn()
+	}
+
+	err := r.call(METHOD_BEGIN_OUTSIDE_TRANSACTION, nil, nil)
+	if err != nil {
+		return err
+	}
+
+	err = fn()
+
+	endErr := r.call(METHOD_END_OUTSIDE_TRANSACTION, nil, nil)
+	if endErr != nil {
+		return errors.Join(err, endErr)
+	}
+
+	return err
+}
+
+func (r *PluginRepository) DoInLock(fn func() error) error {
+	err := r.call(METHOD_ACQUIRE_LOCK, nil, nil)
+	if err != nil {
+		return err
+	}
+
+	err = fn()
+
+	releaseErr := r.call(METHOD_RELEASE_LOCK, nil, nil)
+	if releaseErr != nil {
+		return errors.Join(err, fmt.Errorf("failed to release the lock: %w", releaseErr))
+	}
+
+	return err
+}
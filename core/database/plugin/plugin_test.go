@@ -0,0 +1,211 @@
+package plugin
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/maestro-go/maestro/core/conf"
+	"github.com/maestro-go/maestro/core/database"
+	"github.com/maestro-go/maestro/core/database/sqlite"
+	"github.com/maestro-go/maestro/core/enums"
+	"github.com/maestro-go/maestro/core/migrator"
+	"github.com/maestro-go/maestro/internal/migrations"
+	testUtils "github.com/maestro-go/maestro/internal/utils/testing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	_ "modernc.org/sqlite"
+)
+
+// pipeConn is one end of the connection between maestro and a plugin served in the same process.
+type pipeConn struct {
+	io.Reader
+	io.Writer
+}
+
+// servePlugin serves a SQLite repository of a new database through the protocol, and returns the repository
+// of maestro connected to it.
+func servePlugin(t *testing.T) (*PluginRepository, *InitializeParams) {
+	return serveWrappedPlugin(t, func(repo database.Repository) database.Repository { return repo })
+}
+
+// serveWrappedPlugin serves the SQLite repository like servePlugin, wrapped by the given function.
+func serveWrappedPlugin(t *testing.T, wrap func(database.Repository) database.Repository) (*PluginRepository, *InitializeParams) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "plugin.db")
+
+	toPlugin, fromMaestro := io.Pipe()
+	toMaestro, fromPlugin := io.Pipe()
+
+	received := &InitializeParams{}
+	done := make(chan error, 1)
+	go func() {
+		done <- Serve(toPlugin, fromPlugin, "sqlite-test", "0.1.0", func(params *InitializeParams) (database.Repository, func(), error) {
+			*received = *params
+
+			db, err := sql.Open("sqlite", "file:"+params.DSN+"?_pragma=busy_timeout(5000)")
+			if err != nil {
+				return nil, nil, err
+			}
+			return wrap(sqlite.NewSQLiteRepository(ctx, db, &params.HistoryTable)), func() { db.Close() }, nil
+		})
+		fromPlugin.Close()
+	}()
+
+	repo := NewPluginRepository(ctx, &pipeConn{Reader: toMaestro, Writer: fromMaestro}, testUtils.ToPtr("history"))
+	t.Cleanup(func() {
+		assert.NoError(t, repo.Shutdown())
+		assert.NoError(t, <-done)
+	})
+
+	result, err := repo.Initialize(InitializeParams{DSN: path, Options: map[string]string{"mode": "test"}})
+	require.NoError(t, err)
+	assert.Equal(t, "sqlite-test", result.Name)
+
+	return repo, received
+}
+
+func writeMigrations(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), os.ModePerm))
+	}
+}
+
+func TestPluginMigrate(t *testing.T) {
+	repo, received := servePlugin(t)
+
+	assert.Equal(t, PROTOCOL_VERSION, received.ProtocolVersion)
+	assert.Equal(t, "history", received.HistoryTable)
+	assert.Equal(t, "test", received.Options["mode"])
+	assert.True(t, repo.Capabilities().SupportsTransactions)
+
+	dir := t.TempDir()
+	writeMigrations(t, dir, map[string]string{
+		"V001_users.sql":      "CREATE TABLE users (id INTEGER);",
+		"V001_users.down.sql": "DROP TABLE users;",
+		"V002_posts.sql":      "CREATE TABLE posts (id INTEGER);",
+		"V002_posts.down.sql": "DROP TABLE posts;",
+		"B001_before.sql":     "CREATE TABLE IF NOT EXISTS runs (id INTEGER);",
+	})
+
+	result, err := migrator.NewMigrator(zap.NewNop(), repo, &conf.MigrationConfig{Locations: []string{dir},
+		UseBefore: true}).Migrate()
+	require.NoError(t, err)
+	assert.Equal(t, uint16(2), result.FinalVersion)
+
+	applied, err := repo.GetAppliedMigrations()
+	require.NoError(t, err)
+	require.Len(t, applied, 2)
+	assert.Equal(t, "posts", applied[1].Description)
+	assert.True(t, applied[1].Success)
+	assert.False(t, applied[1].ExecutedAt.IsZero())
+
+	info, err := repo.ServerInfo()
+	require.NoError(t, err)
+	assert.True(t, info.HistoryTableExists)
+	assert.Equal(t, int64(2), info.HistoryRows)
+
+	// Rolled back through the protocol
+	destination := uint16(1)
+	_, err = migrator.NewMigrator(zap.NewNop(), repo, &conf.MigrationConfig{Locations: []string{dir}, Down: true,
+		Destination: &destination}).Migrate()
+	require.NoError(t, err)
+
+	latest, err := repo.GetLatestMigration()
+	require.NoError(t, err)
+	assert.Equal(t, uint16(1), latest)
+
+	err = repo.Annotate(9, "missing")
+	assert.ErrorIs(t, err, database.ErrNotApplied)
+	assert.NoError(t, repo.Annotate(1, "created by the plugin"))
+}
+
+// externalRepository is a repository written outside of this module, naming the types of the internal
+// migrations package with the aliases of the database package.
+type externalRepository struct {
+	database.Repository
+	executed []uint16
+	hooks    int
+}
+
+func (r *externalRepository) ExecuteMigration(migration *database.Migration) []error {
+	r.executed = append(r.executed, migration.Version)
+	return r.Repository.ExecuteMigration(migration)
+}
+
+func (r *externalRepository) ExecuteHook(hook *database.Hook) error {
+	r.hooks++
+	return r.Repository.ExecuteHook(hook)
+}
+
+func TestPluginExternalRepository(t *testing.T) {
+	external := &externalRepository{}
+	repo, _ := serveWrappedPlugin(t, func(repo database.Repository) database.Repository {
+		external.Repository = repo
+		return external
+	})
+
+	dir := t.TempDir()
+	writeMigrations(t, dir, map[string]string{
+		"V001_users.sql":  "CREATE TABLE users (id INTEGER);",
+		"V002_posts.sql":  "CREATE TABLE posts (id INTEGER);",
+		"B001_before.sql": "CREATE TABLE IF NOT EXISTS runs (id INTEGER);",
+	})
+
+	_, err := migrator.NewMigrator(zap.NewNop(), repo, &conf.MigrationConfig{Locations: []string{dir},
+		UseBefore: true}).Migrate()
+	require.NoError(t, err)
+
+	assert.Equal(t, []uint16{1, 2}, external.executed)
+	assert.Equal(t, 1, external.hooks)
+}
+
+func TestPluginErrors(t *testing.T) {
+	repo, _ := servePlugin(t)
+
+	require.NoError(t, repo.AssertSchemaHistoryTable())
+
+	// The transaction of a failed callback is rolled back by the plugin
+	err := repo.DoInTransaction(func() error {
+		errs := repo.ExecuteMigration(&migrations.Migration{Version: 1, Description: "t", Type: enums.MIGRATION_UP,
+			Checksum: testUtils.ToPtr("c1"), Content: testUtils.ToPtr("CREATE TABLE t (id INTEGER);")})
+		assert.Empty(t, errs)
+		return errors.New("failed")
+	})
+	assert.EqualError(t, err, "failed")
+
+	latest, err := repo.GetLatestMigration()
+	require.NoError(t, err)
+	assert.Equal(t, uint16(0), latest)
+
+	require.NoError(t, repo.DoInLock(func() error {
+		errs := repo.ExecuteMigration(&migrations.Migration{Version: 1, Description: "t", Type: enums.MIGRATION_UP,
+			Checksum: testUtils.ToPtr("c1"), Content: testUtils.ToPtr("CREATE TABLE t (id INTEGER);")})
+		assert.Empty(t, errs)
+		return nil
+	}))
+
+	// The errors of the database package are kept
+	errs := repo.ValidateMigrations([]*migrations.Migration{{Version: 1, Description: "t", Type: enums.MIGRATION_UP,
+		Checksum: testUtils.ToPtr("changed")}})
+	require.Len(t, errs, 1)
+	mismatch := &database.MismatchError{}
+	require.ErrorAs(t, errs[0], &mismatch)
+	assert.Equal(t, uint16(1), mismatch.Version)
+	assert.Equal(t, "c1", mismatch.Checksum)
+
+	err = repo.ExecuteHook(&migrations.Hook{Type: enums.HOOK_BEFORE, Content: testUtils.ToPtr("INVALID SQL;")})
+	assert.Error(t, err)
+
+	// Unknown methods are reported
+	err = repo.call("unknown", nil, nil)
+	protocolErr := &Error{}
+	require.ErrorAs(t, err, &protocolErr)
+	assert.Equal(t, code_method_not_found, protocolErr.Code)
+}
@@ -0,0 +1,405 @@
+package plugin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/maestro-go/maestro/core/database"
+	"github.com/maestro-go/maestro/core/enums"
+	"github.com/maestro-go/maestro/internal/migrations"
+)
+
+// PROTOCOL_VERSION is the version of the protocol, sent by maestro in the initialize request. Plugins reply
+// with the version they implement, and maestro refuses the plugins of another version.
+const PROTOCOL_VERSION = 1
+
+// BINARY_PREFIX is the prefix of the name of the binaries of the plugins, searched in the PATH: the plugin
+// "cassandra" is the binary maestro-driver-cassandra.
+const BINARY_PREFIX = "maestro-driver-"
+
+// Methods of the protocol. Every method of the Repository interface has its request, except the callbacks of
+// DoInTransaction, DoOutsideTransaction and DoInLock, whose beginning and end are requests of their own:
+// the requests sent in between are run in the transaction, outside of it, or holding the lock.
+const (
+	METHOD_INITIALIZE = "initialize"
+	METHOD_SHUTDOWN   = "shutdown"
+
+	METHOD_CAPABILITIES              = "capabilities"
+	METHOD_SERVER_INFO               = "serverInfo"
+	METHOD_GET_LOCK_INFO             = "getLockInfo"
+	METHOD_GET_LATEST_MIGRATION      = "getLatestMigration"
+	METHOD_GET_APPLIED_MIGRATIONS    = "getAppliedMigrations"
+	METHOD_ASSERT_SCHEMA_HISTORY     = "assertSchemaHistoryTable"
+	METHOD_CHECK_SCHEMA_HISTORY      = "checkSchemaHistoryTable"
+	METHOD_VALIDATE_MIGRATIONS       = "validateMigrations"
+	METHOD_SET_RUN_INFO              = "setRunInfo"
+	METHOD_EXECUTE_MIGRATION         = "executeMigration"
+	METHOD_SKIP_MIGRATION            = "skipMigration"
+	METHOD_EXECUTE_HOOK              = "executeHook"
+	METHOD_EXECUTE_ASSERTION         = "executeAssertion"
+	METHOD_ROLLBACK_MIGRATION        = "rollbackMigration"
+	METHOD_REPAIR                    = "repair"
+	METHOD_ANNOTATE                  = "annotate"
+	METHOD_GET_FAILING_MIGRATIONS    = "getFailingMigrations"
+	METHOD_CLEAN                     = "clean"
+	METHOD_BEGIN_TRANSACTION         = "beginTransaction"
+	METHOD_COMMIT_TRANSACTION        = "commitTransaction"
+	METHOD_ROLLBACK_TRANSACTION      = "rollbackTransaction"
+	METHOD_BEGIN_OUTSIDE_TRANSACTION = "beginOutsideTransaction"
+	METHOD_END_OUTSIDE_TRANSACTION   = "endOutsideTransaction"
+	METHOD_ACQUIRE_LOCK              = "acquireLock"
+	METHOD_RELEASE_LOCK              = "releaseLock"
+)
+
+// Kinds of the errors of the repository, kept through the protocol so maestro handles them as the errors of
+// the built-in drivers
+const (
+	ERROR_MISMATCH        = "mismatch"        // database.MismatchError
+	ERROR_MISSING_VERSION = "missing_version" // database.MissingVersionError
+	ERROR_STATEMENT       = "statement"       // database.StatementError
+	ERROR_NOT_APPLIED     = "not_applied"     // database.ErrNotApplied
+)
+
+// Codes of the JSON-RPC errors
+const (
+	code_method_not_found = -32601
+	code_invalid_params   = -32602
+	code_repository       = 1 // Error returned by the repository
+)
+
+// request is a JSON-RPC 2.0 request, one per line.
+type request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      uint64          `json:"id"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// response is a JSON-RPC 2.0 response, one per line, with the ID of its request.
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      uint64          `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+// Error is the error of a response, and of the lists of errors of ValidateMigrations, ExecuteMigration and
+// Repair.
+type Error struct {
+	Code    int        `json:"code"`
+	Message string     `json:"message"`
+	Data    *ErrorData `json:"data,omitempty"`
+}
+
+// ErrorData is the kind of an error of the repository and its fields.
+type ErrorData struct {
+	Kind        string `json:"kind"`
+	Version     uint16 `json:"version,omitempty"`     // ERROR_MISMATCH and ERROR_MISSING_VERSION
+	Description string `json:"description,omitempty"` // ERROR_MISMATCH
+	Checksum    string `json:"checksum,omitempty"`    // ERROR_MISMATCH
+	Statement   int    `json:"statement,omitempty"`   // ERROR_STATEMENT: 1-based index of the failed statement
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// InitializeParams are the parameters of the initialize request, the first one sent to the plugin: the
+// connection settings of the configuration, or the data source name the database is given with.
+type InitializeParams struct {
+	ProtocolVersion int               `json:"protocolVersion"`
+	MaestroVersion  string            `json:"maestroVersion"`
+	DSN             string            `json:"dsn,omitempty"`
+	Host            string            `json:"host,omitempty"`
+	Port            uint16            `json:"port,omitempty"`
+	Database        string            `json:"database,omitempty"`
+	User            string            `json:"user,omitempty"`
+	Password        string            `json:"password,omitempty"`
+	Schema          string            `json:"schema,omitempty"`
+	HistoryTable    string            `json:"historyTable"`
+	SSLMode         string            `json:"sslMode,omitempty"`
+	SSLRootCert     string            `json:"sslRootCert,omitempty"`
+	CreateDatabase  bool              `json:"createDatabase,omitempty"` // Creates the database if missing
+	ReadOnly        bool              `json:"readOnly,omitempty"`       // The command only reads the database
+	Options         map[string]string `json:"options,omitempty"`        // plugin-options of the configuration
+}
+
+// InitializeResult is the result of the initialize request.
+type InitializeResult struct {
+	ProtocolVersion int    `json:"protocolVersion"`
+	Name            string `json:"name,omitempty"`
+	Version         string `json:"version,omitempty"`
+}
+
+type capabilitiesWire struct {
+	SupportsTransactions   bool `json:"supportsTransactions"`
+	SupportsAdvisoryLock   bool `json:"supportsAdvisoryLock"`
+	SupportsMultiStatement bool `json:"supportsMultiStatement"`
+	MaxIdentifierLength    int  `json:"maxIdentifierLength,omitempty"`
+}
+
+type serverInfoWire struct {
+	Version            string `json:"version"`
+	Schema             string `json:"schema"`
+	HistoryTable       string `json:"historyTable"`
+	HistoryTableExists bool   `json:"historyTableExists"`
+	HistoryRows        int64  `json:"historyRows"`
+}
+
+type lockInfoWire struct {
+	Locked   bool       `json:"locked"`
+	Owner    string     `json:"owner,omitempty"`
+	LockedAt *time.Time `json:"lockedAt,omitempty"`
+}
+
+type appliedMigrationWire struct {
+	Version       uint16 `json:"version"`
+	Description   string `json:"description"`
+	Checksum      string `json:"checksum"`
+	Success       bool   `json:"success"`
+	Author        string `json:"author,omitempty"`
+	Ticket        string `json:"ticket,omitempty"`
+	Skipped       bool   `json:"skipped,omitempty"`
+	InstalledRank int64  `json:"installedRank,omitempty"`
+	ExecutedAt    string `json:"executedAt,omitempty"` // EXECUTED_AT_LAYOUT, in the time zone of the database
+}
+
+type migrationWire struct {
+	Version        uint16  `json:"version"`
+	Description    string  `json:"description"`
+	Type           string  `json:"type"` // UP or DOWN
+	Checksum       *string `json:"checksum,omitempty"`
+	Content        *string `json:"content,omitempty"`
+	SkipStatements int     `json:"skipStatements,omitempty"`
+	SkipValidation bool    `json:"skipValidation,omitempty"`
+	Destructive    bool    `json:"destructive,omitempty"`
+	Author         string  `json:"author,omitempty"`
+	Ticket         string  `json:"ticket,omitempty"`
+}
+
+type hookWire struct {
+	Type               string  `json:"type"` // e.g. BEFORE_EACH
+	Order              uint8   `json:"order,omitempty"`
+	Version            uint16  `json:"version,omitempty"`
+	Content            *string `json:"content,omitempty"`
+	FileName           string  `json:"fileName,omitempty"`
+	OutsideTransaction bool    `json:"outsideTransaction,omitempty"`
+}
+
+type runInfoWire struct {
+	ID             string `json:"id"`
+	MaestroVersion string `json:"maestroVersion"`
+	Holder         string `json:"holder"` // Lock identity of the run, or else the host name
+}
+
+type annotateParams struct {
+	Version uint16 `json:"version"`
+	Note    string `json:"note"`
+}
+
+// errorsResult is the result of the methods returning a list of errors.
+type errorsResult struct {
+	Errors []*Error `json:"errors"`
+}
+
+func toMigrationWire(migration *migrations.Migration) *migrationWire {
+	return &migrationWire{
+		Version:        migration.Version,
+		Description:    migration.Description,
+		Type:           migration.Type.Name(),
+		Checksum:       migration.Checksum,
+		Content:        migration.Content,
+		SkipStatements: migration.SkipStatements,
+		SkipValidation: migration.SkipValidation,
+		Destructive:    migration.Destructive,
+		Author:         migration.Author,
+		Ticket:         migration.Ticket,
+	}
+}
+
+func toMigrationWires(list []*migrations.Migration) []*migrationWire {
+	wires := make([]*migrationWire, 0, len(list))
+	for _, migration := range list {
+		wires = append(wires, toMigrationWire(migration))
+	}
+	return wires
+}
+
+func (w *migrationWire) migration() (*migrations.Migration, error) {
+	up, down := enums.MIGRATION_UP, enums.MIGRATION_DOWN
+
+	migrationType := up
+	switch w.Type {
+	case up.Name():
+	case down.Name():
+		migrationType = down
+	default:
+		return nil, fmt.Errorf("invalid migration type %q", w.Type)
+	}
+
+	return &migrations.Migration{
+		Version:        w.Version,
+		Description:    w.Description,
+		Type:           migrationType,
+		Checksum:       w.Checksum,
+		Content:        w.Content,
+		SkipStatements: w.SkipStatements,
+		SkipValidation: w.SkipValidation,
+		Destructive:    w.Destructive,
+		Author:         w.Author,
+		Ticket:         w.Ticket,
+	}, nil
+}
+
+func toHookWire(hook *migrations.Hook) *hookWire {
+	return &hookWire{
+		Type:               hook.Type.Name(),
+		Order:              hook.Order,
+		Version:            hook.Version,
+		Content:            hook.Content,
+		FileName:           hook.FileName,
+		OutsideTransaction: hook.OutsideTransaction,
+	}
+}
+
+func (w *hookWire) hook() (*migrations.Hook, error) {
+	for hookType := range enums.MapHookTypeToRegex {
+		if hookType.Name() == w.Type {
+			return &migrations.Hook{
+				Type:               hookType,
+				Order:              w.Order,
+				Version:            w.Version,
+				Content:            w.Content,
+				FileName:           w.FileName,
+				OutsideTransaction: w.OutsideTransaction,
+			}, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid hook type %q", w.Type)
+}
+
+func toAppliedMigrationWire(applied *database.AppliedMigration) *appliedMigrationWire {
+	wire := &appliedMigrationWire{
+		Version:       applied.Version,
+		Description:   applied.Description,
+		Checksum:      applied.Checksum,
+		Success:       applied.Success,
+		Author:        applied.Author,
+		Ticket:        applied.Ticket,
+		Skipped:       applied.Skipped,
+		InstalledRank: applied.InstalledRank,
+	}
+	if !applied.ExecutedAt.IsZero() {
+		wire.ExecutedAt = applied.ExecutedAt.Format(database.EXECUTED_AT_LAYOUT)
+	}
+	return wire
+}
+
+func (w *appliedMigrationWire) appliedMigration() (*database.AppliedMigration, error) {
+	executedAt, err := database.ParseExecutedAt(w.ExecutedAt)
+	if err != nil {
+		return nil, fmt.Errorf("invalid execution time of version %d: %w", w.Version, err)
+	}
+
+	return &database.AppliedMigration{
+		Version:       w.Version,
+		Description:   w.Description,
+		Checksum:      w.Checksum,
+		Success:       w.Success,
+		Author:        w.Author,
+		Ticket:        w.Ticket,
+		Skipped:       w.Skipped,
+		InstalledRank: w.InstalledRank,
+		ExecutedAt:    executedAt,
+	}, nil
+}
+
+// toError returns the error of the protocol of an error of a repository, with the kind of the errors of the
+// database package.
+func toError(err error) *Error {
+	protocolErr := &Error{}
+	if errors.As(err, &protocolErr) {
+		return protocolErr
+	}
+
+	wire := &Error{Code: code_repository, Message: err.Error()}
+
+	mismatch := &database.MismatchError{}
+	missing := &database.MissingVersionError{}
+	statement := &database.StatementError{}
+	switch {
+	case errors.As(err, &mismatch):
+		wire.Data = &ErrorData{Kind: ERROR_MISMATCH, Version: mismatch.Version, Description: mismatch.Description,
+			Checksum: mismatch.Checksum}
+	case errors.As(err, &missing):
+		wire.Data = &ErrorData{Kind: ERROR_MISSING_VERSION, Version: missing.Version}
+	case errors.As(err, &statement):
+		wire.Data = &ErrorData{Kind: ERROR_STATEMENT, Statement: statement.Index}
+	case errors.Is(err, database.ErrNotApplied):
+		wire.Data = &ErrorData{Kind: ERROR_NOT_APPLIED}
+	}
+
+	return wire
+}
+
+// toErrors returns the errors of the protocol of a list of errors, nil if empty.
+func toErrors(errs []error) []*Error {
+	if len(errs) == 0 {
+		return nil
+	}
+
+	wires := make([]*Error, 0, len(errs))
+	for _, err := range errs {
+		wires = append(wires, toError(err))
+	}
+	return wires
+}
+
+// repositoryError returns the error of the database package of an error of the protocol, or the error itself.
+func (e *Error) repositoryError() error {
+	if e.Data == nil {
+		return e
+	}
+
+	switch e.Data.Kind {
+	case ERROR_MISMATCH:
+		return &database.MismatchError{Version: e.Data.Version, Description: e.Data.Description,
+			Checksum: e.Data.Checksum}
+	case ERROR_MISSING_VERSION:
+		return &database.MissingVersionError{Version: e.Data.Version}
+	case ERROR_STATEMENT:
+		return &database.StatementError{Index: e.Data.Statement, Err: errors.New(e.Message)}
+	case ERROR_NOT_APPLIED:
+		return &wrapError{message: e.Message, err: database.ErrNotApplied}
+	}
+	return e
+}
+
+// wrapError is an error with the message of the plugin, wrapping an error of the database package.
+type wrapError struct {
+	message string
+	err     error
+}
+
+func (e *wrapError) Error() string {
+	return e.message
+}
+
+func (e *wrapError) Unwrap() error {
+	return e.err
+}
+
+// repositoryErrors returns the errors of the database package of a list of errors of the protocol, nil if empty.
+func repositoryErrors(wires []*Error) []error {
+	if len(wires) == 0 {
+		return nil
+	}
+
+	errs := make([]error, 0, len(wires))
+	for _, wire := range wires {
+		errs = append(errs, wire.repositoryError())
+	}
+	return errs
+}
@@ -0,0 +1,333 @@
+package plugin
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/maestro-go/maestro/core/database"
+	"github.com/maestro-go/maestro/internal/migrations"
+)
+
+// ConnectFunc connects to the database of the settings of the initialize request, and returns its repository
+// and a function closing the connection. Repositories declared outside of this module take the
+// database.Migration and database.Hook aliases in their methods.
+type ConnectFunc func(params *InitializeParams) (database.Repository, func(), error)
+
+// scope is a callback of DoInTransaction, DoOutsideTransaction or DoInLock of the served repository, waiting
+// for the request ending it.
+type scope struct {
+	end    chan error // Returned by the callback
+	result chan error // Returned by the method of the repository
+}
+
+// server dispatches the requests of maestro to a repository.
+type server struct {
+	name    string
+	version string
+	connect ConnectFunc
+	repo    database.Repository
+	close   func()
+	scopes  []*scope // Callbacks in progress, innermost last
+}
+
+// Serve answers the requests of maestro read from in, usually the standard input, on out, usually the standard
+// output, with the repository returned by connect for the initialize request, until the shutdown request or
+// the end of the input. The name and version of the plugin are reported to maestro.
+//
+// The callbacks of DoInTransaction, DoOutsideTransaction and DoInLock wait for the request ending them, while
+// the requests in between are answered, so the repository must keep its transaction and lock state in itself
+// rather than in the goroutine calling it, as the repositories of maestro do.
+func Serve(in io.Reader, out io.Writer, name string, version string, connect ConnectFunc) error {
+	s := &server{name: name, version: version, connect: connect}
+	defer s.shutdown()
+
+	decoder := json.NewDecoder(bufio.NewReader(in))
+	encoder := json.NewEncoder(out)
+
+	for {
+		req := &request{}
+		err := decoder.Decode(req)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error reading request: %w", err)
+		}
+
+		resp := &response{JSONRPC: "2.0", ID: req.ID}
+
+		result, err := s.dispatch(req)
+		if err != nil {
+			resp.Error = toError(err)
+		} else if result != nil {
+			resp.Result, err = json.Marshal(result)
+			if err != nil {
+				resp.Error = toError(err)
+			}
+		}
+
+		err = encoder.Encode(resp)
+		if err != nil {
+			return fmt.Errorf("error writing response: %w", err)
+		}
+
+		if req.Method == METHOD_SHUTDOWN {
+			return nil
+		}
+	}
+}
+
+// dispatch runs the method of the request on the repository and returns its result.
+func (s *server) dispatch(req *request) (any, error) {
+	if req.Method == METHOD_INITIALIZE {
+		params := &InitializeParams{}
+		err := decodeParams(req, params)
+		if err != nil {
+			return nil, err
+		}
+
+		if s.repo != nil {
+			return nil, errors.New("already initialized")
+		}
+
+		s.repo, s.close, err = s.connect(params)
+		if err != nil {
+			return nil, err
+		}
+
+		return &InitializeResult{ProtocolVersion: PROTOCOL_VERSION, Name: s.name, Version: s.version}, nil
+	}
+
+	if req.Method == METHOD_SHUTDOWN {
+		s.shutdown()
+		return nil, nil
+	}
+
+	if s.repo == nil {
+		return nil, errors.New("not initialized")
+	}
+
+	switch req.Method {
+	case METHOD_CAPABILITIES:
+		capabilities := s.repo.Capabilities()
+		return &capabilitiesWire{
+			SupportsTransactions:   capabilities.SupportsTransactions,
+			SupportsAdvisoryLock:   capabilities.SupportsAdvisoryLock,
+			SupportsMultiStatement: capabilities.SupportsMultiStatement,
+			MaxIdentifierLength:    capabilities.MaxIdentifierLength,
+		}, nil
+
+	case METHOD_SERVER_INFO:
+		info, err := s.repo.ServerInfo()
+		if err != nil {
+			return nil, err
+		}
+		return &serverInfoWire{Version: info.Version, Schema: info.Schema, HistoryTable: info.HistoryTable,
+			HistoryTableExists: info.HistoryTableExists, HistoryRows: info.HistoryRows}, nil
+
+	case METHOD_GET_LOCK_INFO:
+		info, err := s.repo.GetLockInfo()
+		if err != nil {
+			return nil, err
+		}
+		return &lockInfoWire{Locked: info.Locked, Owner: info.Owner, LockedAt: info.LockedAt}, nil
+
+	case METHOD_GET_LATEST_MIGRATION:
+		return s.repo.GetLatestMigration()
+
+	case METHOD_GET_APPLIED_MIGRATIONS:
+		applied, err := s.repo.GetAppliedMigrations()
+		if err != nil {
+			return nil, err
+		}
+
+		wires := make([]*appliedMigrationWire, 0, len(applied))
+		for _, migration := range applied {
+			wires = append(wires, toAppliedMigrationWire(migration))
+		}
+		return wires, nil
+
+	case METHOD_ASSERT_SCHEMA_HISTORY:
+		return nil, s.repo.AssertSchemaHistoryTable()
+
+	case METHOD_CHECK_SCHEMA_HISTORY:
+		return s.repo.CheckSchemaHistoryTable()
+
+	case METHOD_VALIDATE_MIGRATIONS, METHOD_REPAIR:
+		list, err := decodeMigrations(req)
+		if err != nil {
+			return nil, err
+		}
+
+		if req.Method == METHOD_REPAIR {
+			return &errorsResult{Errors: toErrors(s.repo.Repair(list))}, nil
+		}
+		return &errorsResult{Errors: toErrors(s.repo.ValidateMigrations(list))}, nil
+
+	case METHOD_SET_RUN_INFO:
+		wire := &runInfoWire{}
+		err := decodeParams(req, wire)
+		if err != nil {
+			return nil, err
+		}
+
+		s.repo.SetRunInfo(database.RunInfo{ID: wire.ID, MaestroVersion: wire.MaestroVersion, LockIdentity: wire.Holder})
+		return nil, nil
+
+	case METHOD_EXECUTE_MIGRATION, METHOD_SKIP_MIGRATION, METHOD_ROLLBACK_MIGRATION:
+		wire := &migrationWire{}
+		err := decodeParams(req, wire)
+		if err != nil {
+			return nil, err
+		}
+
+		migration, err := wire.migration()
+		if err != nil {
+			return nil, invalidParams(err)
+		}
+
+		switch req.Method {
+		case METHOD_EXECUTE_MIGRATION:
+			return &errorsResult{Errors: toErrors(s.repo.ExecuteMigration(migration))}, nil
+		case METHOD_SKIP_MIGRATION:
+			return nil, s.repo.SkipMigration(migration)
+		}
+		return nil, s.repo.RollbackMigration(migration)
+
+	case METHOD_EXECUTE_HOOK, METHOD_EXECUTE_ASSERTION:
+		wire := &hookWire{}
+		err := decodeParams(req, wire)
+		if err != nil {
+			return nil, err
+		}
+
+		hook, err := wire.hook()
+		if err != nil {
+			return nil, invalidParams(err)
+		}
+
+		if req.Method == METHOD_EXECUTE_ASSERTION {
+			return nil, s.repo.ExecuteAssertion(hook)
+		}
+		return nil, s.repo.ExecuteHook(hook)
+
+	case METHOD_ANNOTATE:
+		params := &annotateParams{}
+		err := decodeParams(req, params)
+		if err != nil {
+			return nil, err
+		}
+		return nil, s.repo.Annotate(params.Version, params.Note)
+
+	case METHOD_GET_FAILING_MIGRATIONS:
+		failing, err := s.repo.GetFailingMigrations()
+		if err != nil {
+			return nil, err
+		}
+		return toMigrationWires(failing), nil
+
+	case METHOD_CLEAN:
+		return nil, s.repo.Clean()
+
+	case METHOD_BEGIN_TRANSACTION:
+		return nil, s.begin(s.repo.DoInTransaction)
+	case METHOD_BEGIN_OUTSIDE_TRANSACTION:
+		return nil, s.begin(s.repo.DoOutsideTransaction)
+	case METHOD_ACQUIRE_LOCK:
+		return nil, s.begin(s.repo.DoInLock)
+
+	case METHOD_COMMIT_TRANSACTION, METHOD_END_OUTSIDE_TRANSACTION, METHOD_RELEASE_LOCK:
+		return nil, s.end(nil)
+	case METHOD_ROLLBACK_TRANSACTION:
+		err := s.end(errRollback)
+		if errors.Is(err, errRollback) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return nil, &Error{Code: code_method_not_found, Message: fmt.Sprintf("method %s not found", req.Method)}
+}
+
+// errRollback fails the callback of DoInTransaction so the transaction is rolled back.
+var errRollback = errors.New("transaction rolled back")
+
+// begin calls the method of the repository in a goroutine, with a callback waiting for the request ending it,
+// and returns once the callback started, or with the error of the method if it failed before.
+func (s *server) begin(method func(fn func() error) error) error {
+	started := make(chan struct{})
+	current := &scope{end: make(chan error), result: make(chan error, 1)}
+
+	go func() {
+		current.result <- method(func() error {
+			close(started)
+			return <-current.end
+		})
+	}()
+
+	select {
+	case <-started:
+		s.scopes = append(s.scopes, current)
+		return nil
+	case err := <-current.result:
+		return err
+	}
+}
+
+// end ends the innermost callback in progress with the given error, and returns the error of its method.
+func (s *server) end(err error) error {
+	if len(s.scopes) == 0 {
+		return errors.New("no transaction or lock in progress")
+	}
+
+	current := s.scopes[len(s.scopes)-1]
+	s.scopes = s.scopes[:len(s.scopes)-1]
+
+	current.end <- err
+	return <-current.result
+}
+
+// shutdown ends the callbacks in progress, rolling back their transactions, and closes the connection.
+func (s *server) shutdown() {
+	for len(s.scopes) > 0 {
+		s.end(errRollback)
+	}
+
+	if s.close != nil {
+		s.close()
+		s.close = nil
+	}
+}
+
+func decodeParams(req *request, params any) error {
+	err := json.Unmarshal(req.Params, params)
+	if err != nil {
+		return invalidParams(err)
+	}
+	return nil
+}
+
+func decodeMigrations(req *request) ([]*migrations.Migration, error) {
+	wires := make([]*migrationWire, 0)
+	err := decodeParams(req, &wires)
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]*migrations.Migration, 0, len(wires))
+	for _, wire := range wires {
+		migration, err := wire.migration()
+		if err != nil {
+			return nil, invalidParams(err)
+		}
+		list = append(list, migration)
+	}
+	return list, nil
+}
+
+func invalidParams(err error) *Error {
+	return &Error{Code: code_invalid_params, Message: err.Error()}
+}
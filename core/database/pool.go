@@ -0,0 +1,21 @@
+package database
+
+import "database/sql"
+
+// SingleConnection reports whether the pool of db allows a single open connection, in which case no
+// other connection can be opened while a transaction holds it.
+func SingleConnection(db Database) bool {
+	pool, ok := Pool(db)
+	return ok && pool.Stats().MaxOpenConnections == 1
+}
+
+// Pool returns the connection pool of db, if it is a pool or a read-only database running on one.
+func Pool(db Queriable) (*sql.DB, bool) {
+	switch db := db.(type) {
+	case *sql.DB:
+		return db, true
+	case *ReadOnlyDatabase:
+		return db.Pool(), true
+	}
+	return nil, false
+}
@@ -2,23 +2,53 @@ package postgres
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"hash/fnv"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/maestro-go/maestro/core/database"
 	"github.com/maestro-go/maestro/core/enums"
+	"github.com/maestro-go/maestro/internal/conf"
 	"github.com/maestro-go/maestro/internal/migrations"
 )
 
 const default_history_table = "schema_history"
 const lock_num = 5691374
 
+// batch_size is the number of migrations per statement of Repair and ValidateMigrations, keeping
+// the parameters of a statement below the limit of 65535.
+const batch_size = 1000
+
+// history_schema are the columns of the history table. The optional ones were added after its first release,
+// and are added by upgradeHistoryTable to the tables created by previous versions.
+var history_schema = []*database.HistoryColumn{
+	{Name: "version", Family: database.COLUMN_INTEGER, Type: "SMALLINT", Definition: "SMALLINT NOT NULL"},
+	{Name: "description", Family: database.COLUMN_TEXT, Type: "VARCHAR(255)", Definition: "VARCHAR(255) NOT NULL DEFAULT ''"},
+	{Name: "md5_checksum", Family: database.COLUMN_TEXT, Type: "CHAR(32)", Definition: "CHAR(32) NOT NULL DEFAULT ''"},
+	{Name: "success", Family: database.COLUMN_BOOLEAN, Type: "BOOLEAN", Definition: "BOOLEAN NOT NULL DEFAULT false"},
+	{Name: "executed_at", Family: database.COLUMN_TIMESTAMP, Type: "TIMESTAMP", Definition: "TIMESTAMP NOT NULL DEFAULT NOW()"},
+	{Name: "repaired_at", Family: database.COLUMN_TIMESTAMP, Type: "TIMESTAMP", Definition: "TIMESTAMP"},
+	{Name: "notes", Family: database.COLUMN_TEXT, Type: "TEXT", Definition: "TEXT", Optional: true},
+	{Name: "run_id", Family: database.COLUMN_TEXT, Type: "VARCHAR(64)", Definition: "VARCHAR(64)", Optional: true},
+	{Name: "author", Family: database.COLUMN_TEXT, Type: "VARCHAR(255)", Definition: "VARCHAR(255)", Optional: true},
+	{Name: "ticket", Family: database.COLUMN_TEXT, Type: "VARCHAR(64)", Definition: "VARCHAR(64)", Optional: true},
+	{Name: "installed_rank", Family: database.COLUMN_INTEGER, Type: "BIGINT", Definition: "BIGINT", Optional: true},
+	{Name: "skipped", Family: database.COLUMN_BOOLEAN, Type: "BOOLEAN", Definition: "BOOLEAN NOT NULL DEFAULT false", Optional: true},
+}
+
 type PostgresRepository struct {
 	database.Repository
 	ctx           context.Context
 	queriable     database.Queriable
 	db            database.Database
 	history_table string
+	run           database.RunInfo
+	pid           int // Backend process of the transaction of DoInTransaction, 0 outside of it
 }
 
 func NewPostgresRepository(ctx context.Context, db database.Database, history_table *string) *PostgresRepository {
@@ -26,6 +56,7 @@ func NewPostgresRepository(ctx context.Context, db database.Database, history_ta
 		ctx:       ctx,
 		queriable: db,
 		db:        db,
+		run:       database.RunInfo{MaestroVersion: conf.VERSION},
 	}
 
 	if history_table != nil {
@@ -62,23 +93,48 @@ func (r *PostgresRepository) GetLatestMigration() (uint16, error) {
 }
 
 func (r *PostgresRepository) AssertSchemaHistoryTable() error {
+	// Audit tables are also created for history tables of previous versions
+	query := fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			id SERIAL PRIMARY KEY,
+			run_id VARCHAR(64) NOT NULL,
+			maestro_version VARCHAR(32) NOT NULL,
+			direction VARCHAR(4) NOT NULL,
+			version SMALLINT NOT NULL,
+			description VARCHAR(255) NOT NULL,
+			success BOOLEAN NOT NULL,
+			executed_at TIMESTAMP NOT NULL DEFAULT NOW()
+		);
+	`, r.auditTable())
+
+	_, err := r.queriable.ExecContext(r.ctx, query)
+	if err != nil {
+		return err
+	}
+
 	exists, err := r.CheckSchemaHistoryTable()
 	if err != nil {
 		return err
 	}
 
 	if exists {
-		return nil
+		return r.upgradeHistoryTable()
 	}
 
-	query := fmt.Sprintf(`
+	query = fmt.Sprintf(`
 		CREATE TABLE IF NOT EXISTS %s (
 			version SMALLINT NOT NULL PRIMARY KEY,
 			description VARCHAR(255) NOT NULL,
 			md5_checksum CHAR(32) NOT NULL,
 			success BOOLEAN NOT NULL DEFAULT false,
 			executed_at TIMESTAMP NOT NULL DEFAULT NOW(),
-			repaired_at TIMESTAMP
+			repaired_at TIMESTAMP,
+			notes TEXT,
+			run_id VARCHAR(64),
+			author VARCHAR(255),
+			ticket VARCHAR(64),
+			installed_rank BIGINT,
+			skipped BOOLEAN NOT NULL DEFAULT false
 		);
 	`, r.history_table)
 
@@ -90,6 +146,160 @@ func (r *PostgresRepository) AssertSchemaHistoryTable() error {
 	return nil
 }
 
+// upgradeHistoryTable adds the columns missing in history tables created by previous versions.
+// The catalog is checked first, as ALTER TABLE locks the table even when the column exists.
+// The installed ranks of the rows are set in the order of their executions.
+func (r *PostgresRepository) upgradeHistoryTable() error {
+	columns, err := r.historyColumns()
+	if err != nil {
+		return err
+	}
+
+	for _, column := range history_schema {
+		if _, ok := columns[column.Name]; ok || !column.Optional {
+			continue
+		}
+
+		_, err = r.queriable.ExecContext(r.ctx, fmt.Sprintf(`
+			ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s %s;
+		`, r.history_table, column.Name, column.Definition))
+		if err != nil {
+			return err
+		}
+
+		if column.Name == "installed_rank" {
+			_, err = r.queriable.ExecContext(r.ctx, fmt.Sprintf(`
+				UPDATE %s AS history SET installed_rank = ranks.installed_rank
+				FROM (
+					SELECT version, ROW_NUMBER() OVER (ORDER BY executed_at, version) AS installed_rank
+					FROM %s
+				) AS ranks
+				WHERE history.version = ranks.version;
+			`, r.history_table, r.history_table))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// historyColumns returns the lowercased types of the columns of the history table, by lowercased name.
+func (r *PostgresRepository) historyColumns() (map[string]string, error) {
+	return r.tableColumns(r.history_table)
+}
+
+// tableColumns returns the lowercased types of the columns of the table, by lowercased name. Returns no
+// column if the table does not exist.
+func (r *PostgresRepository) tableColumns(table string) (map[string]string, error) {
+	query := `
+		SELECT column_name, data_type FROM information_schema.columns
+		WHERE table_name = $1 AND table_schema = current_schema();
+	`
+
+	rows, err := r.queriable.QueryContext(r.ctx, query, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := map[string]string{}
+	for rows.Next() {
+		var column, columnType string
+		err = rows.Scan(&column, &columnType)
+		if err != nil {
+			return nil, err
+		}
+		columns[strings.ToLower(column)] = strings.ToLower(columnType)
+	}
+
+	return columns, rows.Err()
+}
+
+// CopyHistoryFrom replaces the rows of the history table with the rows of the table.
+func (r *PostgresRepository) CopyHistoryFrom(table string) (int64, error) {
+	return r.copyHistory(table, r.history_table)
+}
+
+// CopyHistoryTo replaces the rows of the table with the rows of the history table.
+func (r *PostgresRepository) CopyHistoryTo(table string) (int64, error) {
+	return r.copyHistory(r.history_table, table)
+}
+
+// copyHistory replaces the rows of the history table to with the rows of the history table from, in a
+// transaction.
+func (r *PostgresRepository) copyHistory(from string, to string) (int64, error) {
+	if from == to {
+		return 0, fmt.Errorf("can not copy history table %s to itself", from)
+	}
+
+	fromColumns, err := r.tableColumns(from)
+	if err != nil {
+		return 0, err
+	}
+	if len(fromColumns) == 0 {
+		return 0, fmt.Errorf("history table %s does not exist", from)
+	}
+
+	toColumns, err := r.tableColumns(to)
+	if err != nil {
+		return 0, err
+	}
+	if len(toColumns) == 0 {
+		return 0, fmt.Errorf("history table %s does not exist", to)
+	}
+
+	columns, values := database.HistoryCopyColumns(history_schema, fromColumns, toColumns)
+
+	copied := int64(0)
+	err = r.inTransaction(func() error {
+		_, err := r.queriable.ExecContext(r.ctx, fmt.Sprintf("DELETE FROM %s;", to))
+		if err != nil {
+			return err
+		}
+
+		result, err := r.queriable.ExecContext(r.ctx, fmt.Sprintf(`
+			INSERT INTO %s (%s)
+			SELECT %s FROM %s;
+		`, to, strings.Join(columns, ", "), strings.Join(values, ", "), from))
+		if err != nil {
+			return err
+		}
+
+		copied, err = result.RowsAffected()
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return copied, nil
+}
+
+// CheckHistorySchema compares the columns of the history table with the ones of history_schema, before
+// anything is recorded in it.
+func (r *PostgresRepository) CheckHistorySchema() error {
+	exists, err := r.CheckSchemaHistoryTable()
+	if err != nil || !exists {
+		return err
+	}
+
+	columns, err := r.historyColumns()
+	if err != nil {
+		return err
+	}
+
+	return database.CompareHistoryColumns(r.history_table, columns, history_schema,
+		func(column *database.HistoryColumn, missing bool) string {
+			if missing {
+				return fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s;", r.history_table, column.Name, column.Definition)
+			}
+			return fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s TYPE %s USING %s::%s;", r.history_table, column.Name,
+				column.Type, column.Name, column.Type)
+		})
+}
+
 func (r *PostgresRepository) CheckSchemaHistoryTable() (bool, error) {
 	query := `
 		SELECT EXISTS (
@@ -121,22 +331,17 @@ func (r *PostgresRepository) ValidateMigrations(migrations []*migrations.Migrati
 		return nil
 	}
 
-	tuples := make([]string, 0, len(migrations))
-	params := make([]any, 0, len(migrations)*3)
-	for i, migration := range migrations {
-
+	local := make(map[uint16]bool, len(migrations))
+	for _, migration := range migrations {
 		if migration.Type != enums.MIGRATION_UP {
 			return []error{fmt.Errorf("invalid migration type: %s", migration.Type.Name())}
 		}
-
-		offset := i * 3
-		tuples = append(tuples, fmt.Sprintf("($%d, $%d, $%d)", offset+1, offset+2, offset+3))
-		params = append(params, migration.Version, migration.Description, *migration.Checksum)
+		local[migration.Version] = true
 	}
 
 	// Check gaps
 	query := fmt.Sprintf(`
-		SELECT version FROM %s ORDER BY version ASC;
+		SELECT version, description, md5_checksum, success FROM %s ORDER BY version ASC;
 	`, r.history_table)
 
 	versionsRows, err := r.queriable.QueryContext(r.ctx, query)
@@ -146,50 +351,76 @@ func (r *PostgresRepository) ValidateMigrations(migrations []*migrations.Migrati
 	defer versionsRows.Close()
 
 	errs := make([]error, 0)
+	mismatches := make([]*database.MismatchError, 0)
 	expectedVersion := uint16(1)
-	actualVersion := uint16(0)
 
 	for versionsRows.Next() {
-		err = versionsRows.Scan(&actualVersion)
+		applied, success := new(database.MismatchError), false
+		err = versionsRows.Scan(&applied.Version, &applied.Description, &applied.Checksum, &success)
 		if err != nil {
 			return []error{err}
 		}
 
-		if expectedVersion != actualVersion {
-			errs = append(errs, fmt.Errorf("missing version %d", expectedVersion))
+		if expectedVersion != applied.Version {
+			errs = append(errs, &database.MissingVersionError{Version: expectedVersion})
 		}
 
-		expectedVersion = actualVersion + 1
-	}
+		expectedVersion = applied.Version + 1
 
-	// Check description or checksum mismatch
-	query = fmt.Sprintf(`
-		SELECT version, description, md5_checksum
-		FROM %s
-		WHERE success = true AND (version, description, md5_checksum) NOT IN (%s);
-	`, r.history_table, strings.Join(tuples, ", "))
+		// Applied migrations missing locally mismatch
+		if success && !local[applied.Version] {
+			mismatches = append(mismatches, applied)
+		}
+	}
 
-	rows, err := r.queriable.QueryContext(r.ctx, query, params...)
-	if err != nil {
+	if err := versionsRows.Err(); err != nil {
 		return []error{err}
 	}
-	defer rows.Close()
 
-	type resStruct struct {
-		version      uint16
-		description  string
-		md5_checksum string
-	}
+	// Check description or checksum mismatch, joining the local migrations in batches
+	for _, batch := range database.Batches(migrations, batch_size) {
+		values := make([]string, 0, len(batch))
+		params := make([]any, 0, len(batch)*3)
+		for i, migration := range batch {
+			values = append(values, fmt.Sprintf("($%d::SMALLINT, $%d::TEXT, $%d::TEXT)", i*3+1, i*3+2, i*3+3))
+			params = append(params, migration.Version, migration.Description, *migration.Checksum)
+		}
 
-	for rows.Next() {
-		res := new(resStruct)
-		err := rows.Scan(&res.version, &res.description, &res.md5_checksum)
+		query = fmt.Sprintf(`
+			SELECT h.version, h.description, h.md5_checksum
+			FROM %s h
+			JOIN (VALUES %s) AS l (version, description, md5_checksum) ON l.version = h.version
+			WHERE h.success = true AND (h.description <> l.description OR h.md5_checksum <> l.md5_checksum);
+		`, r.history_table, strings.Join(values, ", "))
+
+		rows, err := r.queriable.QueryContext(r.ctx, query, params...)
+		if err != nil {
+			return []error{err}
+		}
+
+		for rows.Next() {
+			mismatch := new(database.MismatchError)
+			err := rows.Scan(&mismatch.Version, &mismatch.Description, &mismatch.Checksum)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+
+			mismatches = append(mismatches, mismatch)
+		}
+
+		err = rows.Err()
+		rows.Close()
 		if err != nil {
-			errs = append(errs, err)
+			return []error{err}
 		}
+	}
 
-		errs = append(errs, fmt.Errorf("invalid migration found: version: %d, description: %s, md5_checksum: %s."+
-			" Please check your local migration and changes", res.version, res.description, res.md5_checksum))
+	sort.Slice(mismatches, func(i, j int) bool {
+		return mismatches[i].Version < mismatches[j].Version
+	})
+	for _, mismatch := range mismatches {
+		errs = append(errs, mismatch)
 	}
 
 	if len(errs) > 0 {
@@ -205,23 +436,21 @@ func (r *PostgresRepository) ExecuteMigration(migration *migrations.Migration) [
 
 	errs := make([]error, 0)
 
-	_, err := r.queriable.ExecContext(r.ctx, *migration.Content)
+	err := r.execScript(*migration.Content)
 	if err != nil {
 		errs = append(errs, err)
 	}
 
-	query := fmt.Sprintf(`
-		INSERT INTO %s (version, description, md5_checksum, success)
-		VALUES ($1, $2, $3, $4)
-		ON CONFLICT (version)
-		DO UPDATE SET description = $2, md5_checksum = $3, success = $4, executed_at = NOW();
-	`, r.history_table)
-
-	_, err = r.queriable.ExecContext(r.ctx, query, migration.Version, migration.Description,
-		migration.Checksum, err == nil)
+	success := err == nil
 
+	err = r.saveHistory(migration, success, false)
 	if err != nil {
 		errs = append(errs, fmt.Errorf("migration %d: %w", migration.Version, err))
+	} else {
+		err = r.audit(migration, database.AUDIT_UP, success)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("migration %d: %w", migration.Version, err))
+		}
 	}
 
 	if len(errs) > 0 {
@@ -231,8 +460,40 @@ func (r *PostgresRepository) ExecuteMigration(migration *migrations.Migration) [
 	return nil
 }
 
+// saveHistory records the execution of the migration, or its skip without being executed, in the history table.
+func (r *PostgresRepository) saveHistory(migration *migrations.Migration, success bool, skipped bool) error {
+	query := fmt.Sprintf(`
+		INSERT INTO %s (version, description, md5_checksum, success, run_id, author, ticket, installed_rank, skipped)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, ''), NULLIF($7, ''),
+			(SELECT COALESCE(MAX(installed_rank), 0) + 1 FROM %s), $8)
+		ON CONFLICT (version)
+		DO UPDATE SET description = $2, md5_checksum = $3, success = $4, run_id = NULLIF($5, ''),
+			author = NULLIF($6, ''), ticket = NULLIF($7, ''), installed_rank = EXCLUDED.installed_rank,
+			skipped = $8, executed_at = NOW();
+	`, r.history_table, r.history_table)
+
+	_, err := r.queriable.ExecContext(r.ctx, query, migration.Version, migration.Description,
+		migration.Checksum, success, r.run.ID, migration.Author, migration.Ticket, skipped)
+	return err
+}
+
+// SkipMigration records the migration as applied and skipped in the history table without executing it, and
+// records the skip in the audit table.
+func (r *PostgresRepository) SkipMigration(migration *migrations.Migration) error {
+	if migration.Type != enums.MIGRATION_UP {
+		return fmt.Errorf("invalid migration type: %s", migration.Type.Name())
+	}
+
+	err := r.saveHistory(migration, true, true)
+	if err != nil {
+		return fmt.Errorf("migration %d: %w", migration.Version, err)
+	}
+
+	return r.audit(migration, database.AUDIT_SKIP, true)
+}
+
 func (r *PostgresRepository) ExecuteHook(hook *migrations.Hook) error {
-	_, err := r.queriable.ExecContext(r.ctx, *hook.Content)
+	err := r.execScript(*hook.Content)
 	if err != nil {
 		return err
 	}
@@ -240,6 +501,46 @@ func (r *PostgresRepository) ExecuteHook(hook *migrations.Hook) error {
 	return nil
 }
 
+func (r *PostgresRepository) ExecuteAssertion(hook *migrations.Hook) error {
+	rows, err := r.queriable.QueryContext(r.ctx, *hook.Content)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+
+	rowsCount := 0
+	isBool, isTrue := false, false
+	for rows.Next() {
+		rowsCount++
+		if rowsCount == 1 && len(columns) == 1 {
+			var value any
+			if err := rows.Scan(&value); err != nil {
+				return err
+			}
+			isTrue, isBool = value.(bool)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if rowsCount == 0 || (rowsCount == 1 && isTrue) {
+		return nil
+	}
+
+	if rowsCount == 1 && isBool {
+		return fmt.Errorf("assertion failed: query returned false")
+	}
+
+	return fmt.Errorf("assertion failed: query returned %d rows", rowsCount)
+}
+
 func (r *PostgresRepository) RollbackMigration(migration *migrations.Migration) error {
 	if migration.Type != enums.MIGRATION_DOWN {
 		return fmt.Errorf("invalid migration type: %s", migration.Type.Name())
@@ -261,7 +562,7 @@ func (r *PostgresRepository) RollbackMigration(migration *migrations.Migration)
 		return nil
 	}
 
-	_, err = r.queriable.ExecContext(r.ctx, *migration.Content)
+	err = r.execScript(*migration.Content)
 	if err != nil {
 		return err
 	}
@@ -285,6 +586,63 @@ func (r *PostgresRepository) RollbackMigration(migration *migrations.Migration)
 		return fmt.Errorf("version was not deleted from \"%s\" table", r.history_table)
 	}
 
+	return r.audit(migration, database.AUDIT_DOWN, true)
+}
+
+func (r *PostgresRepository) ServerInfo() (*database.ServerInfo, error) {
+	info := &database.ServerInfo{HistoryTable: r.history_table}
+
+	err := r.queriable.QueryRowContext(r.ctx, `
+		SELECT current_setting('server_version'), COALESCE(current_schema(), '');
+	`).Scan(&info.Version, &info.Schema)
+	if err != nil {
+		return nil, err
+	}
+
+	info.HistoryTableExists, err = r.CheckSchemaHistoryTable()
+	if err != nil || !info.HistoryTableExists {
+		return info, err
+	}
+
+	query := fmt.Sprintf("SELECT COUNT(*) FROM %s;", r.history_table)
+	err = r.queriable.QueryRowContext(r.ctx, query).Scan(&info.HistoryRows)
+	if err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
+
+func (r *PostgresRepository) Capabilities() database.Capabilities {
+	return database.Capabilities{
+		SupportsTransactions:   true,
+		SupportsAdvisoryLock:   true,
+		SupportsMultiStatement: true,
+		MaxIdentifierLength:    63,
+	}
+}
+
+func (r *PostgresRepository) SetRunInfo(info database.RunInfo) {
+	r.run = info
+}
+
+func (r *PostgresRepository) auditTable() string {
+	return r.history_table + "_audit"
+}
+
+// audit records the execution of the migration in the audit table.
+func (r *PostgresRepository) audit(migration *migrations.Migration, direction string, success bool) error {
+	query := fmt.Sprintf(`
+		INSERT INTO %s (run_id, maestro_version, direction, version, description, success)
+		VALUES ($1, $2, $3, $4, $5, $6);
+	`, r.auditTable())
+
+	_, err := r.queriable.ExecContext(r.ctx, query, r.run.ID, r.run.MaestroVersion, direction,
+		migration.Version, migration.Description, success)
+	if err != nil {
+		return fmt.Errorf("error recording audit: %w", err)
+	}
+
 	return nil
 }
 
@@ -296,37 +654,287 @@ func (r *PostgresRepository) DoInTransaction(fn func() error) error {
 	defer func() {
 		tx.Rollback()
 		r.queriable = r.db // Always reset queriable to db
+		r.pid = 0
 	}()
 
 	r.queriable = tx
 
+	// The backend of the transaction is looked up by TransactionActivity, on another connection
+	err = tx.QueryRowContext(r.ctx, "SELECT pg_backend_pid();").Scan(&r.pid)
+	if err != nil {
+		return err
+	}
+
 	err = fn()
 	if err != nil {
 		return err
 	}
 
-	tx.Commit()
+	return tx.Commit()
+}
 
-	return nil
+func (r *PostgresRepository) DoOutsideTransaction(fn func() error) error {
+	if _, ok := r.queriable.(*sql.Tx); ok && database.SingleConnection(r.db) {
+		return errors.New("cannot run outside of the transaction with a single connection")
+	}
+
+	queriable := r.queriable
+	defer func() {
+		r.queriable = queriable
+	}()
+
+	r.queriable = r.db
+
+	return fn()
+}
+
+// Session returns a repository sharing the connections of this one, with its own transaction and run info.
+func (r *PostgresRepository) Session() database.Repository {
+	session := *r
+	session.queriable = r.db // Outside of the transaction of this repository
+	session.pid = 0
+	return &session
+}
+
+// GetLockInfo reports whether a session holds the advisory lock, and the process ID, user and application name
+// (the lock identity of the run holding it, if set) of the session.
+func (r *PostgresRepository) GetLockInfo() (*database.LockInfo, error) {
+	// Advisory locks on a bigint key are stored with its high and low halves in classid and objid
+	query := `
+		SELECT a.pid, COALESCE(a.usename, ''), COALESCE(a.application_name, '')
+		FROM pg_locks l JOIN pg_stat_activity a ON a.pid = l.pid
+		WHERE l.locktype = 'advisory' AND l.granted AND l.classid = 0 AND l.objid = $1 AND l.objsubid = 1
+			AND l.database = (SELECT oid FROM pg_database WHERE datname = current_database());
+	`
+
+	rows, err := r.queriable.QueryContext(r.ctx, query, r.lockKey())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	info := &database.LockInfo{}
+	for rows.Next() {
+		pid, user, application := 0, "", ""
+		if err := rows.Scan(&pid, &user, &application); err != nil {
+			return nil, err
+		}
+
+		info.Locked = true
+		info.Owner = fmt.Sprintf("pid %d, user %s", pid, user)
+		if application != "" {
+			info.Owner += ", application " + application
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
+
+// lockKey returns the advisory lock key of the history table, so the migrations of several history tables of
+// the same database do not block each other. The default history table keeps the key of previous versions.
+func (r *PostgresRepository) lockKey() int64 {
+	if r.history_table == default_history_table {
+		return lock_num
+	}
+
+	// Within 32 bits, as GetLockInfo looks the key up in the objid column of pg_locks
+	hash := fnv.New32a()
+	hash.Write([]byte(r.history_table))
+	return int64(hash.Sum32())
 }
 
+// DoInLock takes the advisory lock of the history table, waiting for the session holding it. With a lock identity,
+// it is set as the application name of the session taking the lock, reported by GetLockInfo. Advisory locks are
+// re-entrant and belong to the session taking them, so the lock is taken and released on a connection reserved
+// while the callback runs: two sessions of a repository never share the backend holding the lock.
 func (r *PostgresRepository) DoInLock(fn func() error) error {
-	_, err := r.db.ExecContext(r.ctx, "select pg_advisory_lock($1)", lock_num)
+	return r.onConnection(func(conn connection) error {
+		var err error
+		if r.run.LockIdentity != "" {
+			// In one statement, so the application name is set on the session holding the lock
+			_, err = conn.ExecContext(r.ctx, "select set_config('application_name', $2, false), pg_advisory_lock($1)",
+				r.lockKey(), r.run.LockIdentity)
+		} else {
+			_, err = conn.ExecContext(r.ctx, "select pg_advisory_lock($1)", r.lockKey())
+		}
+		if err != nil {
+			return fmt.Errorf("failed to acquire advisory lock: %w", err)
+		}
+		defer func() {
+			_, err = conn.ExecContext(r.ctx, "select pg_advisory_unlock($1)", r.lockKey())
+			if err != nil {
+				panic(fmt.Errorf("failed to release advisory lock: %w", err))
+			}
+		}()
+
+		return fn()
+	})
+}
+
+// connection is the part of a database connection used by the statements depending on the state of their session.
+type connection interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// onConnection runs the callback on a connection of the pool reserved until it returns. With a single
+// connection, the callback runs on the connection of the repository.
+func (r *PostgresRepository) onConnection(fn func(conn connection) error) error {
+	pool, ok := r.db.(*sql.DB)
+	if !ok || database.SingleConnection(pool) {
+		return fn(r.db)
+	}
+
+	conn, err := pool.Conn(r.ctx)
 	if err != nil {
-		return fmt.Errorf("failed to acquire advisory lock: %w", err)
+		return err
 	}
-	defer func() {
-		_, err = r.db.ExecContext(r.ctx, "select pg_advisory_unlock($1)", lock_num)
+	defer conn.Close()
+
+	return fn(conn)
+}
+
+// activity_columns are the columns of pg_stat_activity scanned by scanActivity.
+const activity_columns = `
+	a.pid, COALESCE(a.usename, ''), COALESCE(a.state, ''),
+	COALESCE(EXTRACT(EPOCH FROM clock_timestamp() - a.xact_start), 0)::float8, COALESCE(a.query, '')
+`
+
+// TransactionActivity reports, from pg_stat_activity and pg_locks, the activity of the backend of the
+// transaction of DoInTransaction, the sessions blocking it (pg_blocking_pids, PostgreSQL 9.6 or later) and
+// the tables it holds ACCESS EXCLUSIVE locks on. The queries run on another connection of the pool.
+func (r *PostgresRepository) TransactionActivity() (*database.TransactionActivity, error) {
+	if r.pid == 0 {
+		return nil, nil
+	}
+
+	if database.SingleConnection(r.db) {
+		return nil, errors.New("cannot monitor the transaction with a single connection")
+	}
+
+	// PostgreSQL does not record when a wait for a lock started, so it is counted from the start of the statement
+	sessions, err := r.scanActivity(fmt.Sprintf(`
+		SELECT %s,
+			CASE WHEN a.wait_event_type = 'Lock'
+				THEN EXTRACT(EPOCH FROM clock_timestamp() - a.query_start)::float8 ELSE 0 END
+		FROM pg_stat_activity a
+		WHERE a.pid = $1;
+	`, activity_columns), r.pid)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sessions) == 0 {
+		return nil, fmt.Errorf("backend %d of the transaction not found in pg_stat_activity", r.pid)
+	}
+
+	activity := &database.TransactionActivity{
+		SessionActivity: *sessions[0].SessionActivity,
+		LockWait:        sessions[0].lockWait,
+	}
+
+	if activity.LockWait > 0 {
+		blockers, err := r.scanActivity(fmt.Sprintf(`
+			SELECT %s, 0::float8
+			FROM pg_stat_activity a
+			WHERE a.pid = ANY(pg_blocking_pids($1))
+			ORDER BY a.pid;
+		`, activity_columns), r.pid)
 		if err != nil {
-			panic(fmt.Errorf("failed to release advisory lock: %w", err))
+			return nil, err
 		}
-	}()
 
-	err = fn()
+		for _, blocker := range blockers {
+			activity.Blockers = append(activity.Blockers, blocker.SessionActivity)
+		}
+	}
+
+	rows, err := r.db.QueryContext(r.ctx, `
+		SELECT l.relation::regclass::text
+		FROM pg_locks l
+		WHERE l.pid = $1 AND l.locktype = 'relation' AND l.mode = 'AccessExclusiveLock' AND l.granted
+			AND l.database = (SELECT oid FROM pg_database WHERE datname = current_database())
+		ORDER BY 1;
+	`, r.pid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		table := ""
+		if err := rows.Scan(&table); err != nil {
+			return nil, err
+		}
+		activity.ExclusiveLocks = append(activity.ExclusiveLocks, table)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return activity, nil
+}
+
+// backendActivity is the activity of a backend with the time its statement has been waiting for a lock.
+type backendActivity struct {
+	*database.SessionActivity
+	lockWait time.Duration
+}
+
+// scanActivity returns the backends of a query selecting the activity_columns followed by the seconds of the
+// wait for a lock.
+func (r *PostgresRepository) scanActivity(query string, args ...any) ([]*backendActivity, error) {
+	rows, err := r.db.QueryContext(r.ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	backends := make([]*backendActivity, 0)
+	for rows.Next() {
+		session := &database.SessionActivity{}
+		transactionSeconds, lockWaitSeconds := 0.0, 0.0
+		err := rows.Scan(&session.ID, &session.User, &session.State, &transactionSeconds, &session.Query,
+			&lockWaitSeconds)
+		if err != nil {
+			return nil, err
+		}
+
+		session.TransactionDuration = time.Duration(transactionSeconds * float64(time.Second))
+		backends = append(backends, &backendActivity{
+			SessionActivity: session,
+			lockWait:        time.Duration(lockWaitSeconds * float64(time.Second)),
+		})
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return backends, nil
+}
+
+// CancelTransaction cancels the statement running on the backend of the transaction of DoInTransaction
+// (pg_cancel_backend), which aborts the transaction.
+func (r *PostgresRepository) CancelTransaction() error {
+	if r.pid == 0 {
+		return errors.New("no transaction to cancel")
+	}
+
+	cancelled := false
+	err := r.db.QueryRowContext(r.ctx, "SELECT pg_cancel_backend($1);", r.pid).Scan(&cancelled)
 	if err != nil {
 		return err
 	}
 
+	if !cancelled {
+		return fmt.Errorf("backend %d of the transaction could not be cancelled", r.pid)
+	}
+
 	return nil
 }
 
@@ -340,33 +948,135 @@ func (r *PostgresRepository) Repair(migrations []*migrations.Migration) []error
 		return nil
 	}
 
-	errs := make([]error, 0)
-
-	for _, migration := range migrations {
-		query := fmt.Sprintf(`
-			INSERT INTO %s (version, description, md5_checksum, success, repaired_at)
-			VALUES ($1, $2, $3, true, NOW())
-			ON CONFLICT (version) DO UPDATE
-			SET description = EXCLUDED.description, md5_checksum = EXCLUDED.md5_checksum, success = true,
-				repaired_at = CASE
-					WHEN EXCLUDED.description <> %s.description OR EXCLUDED.md5_checksum <> %s.md5_checksum
-					THEN NOW()
-					ELSE %s.repaired_at
-				END;
-		`, r.history_table, r.history_table, r.history_table, r.history_table)
-
-		_, err := r.queriable.ExecContext(r.ctx, query, migration.Version, migration.Description, *migration.Checksum)
+	err = r.inTransaction(func() error {
+		// The migrations missing from the history are ranked after the executions already recorded
+		rank, recorded, err := database.HistoryRanks(r.ctx, r.queriable, r.history_table)
 		if err != nil {
-			errs = append(errs, err)
+			return err
+		}
+
+		for _, batch := range database.Batches(migrations, batch_size) {
+			values := make([]string, 0, len(batch))
+			args := make([]any, 0, len(batch)*4)
+			for i, migration := range batch {
+				migrationRank := sql.NullInt64{}
+				if !recorded[migration.Version] {
+					rank++
+					migrationRank = sql.NullInt64{Int64: rank, Valid: true}
+				}
+				values = append(values, fmt.Sprintf("($%d, $%d, $%d, true, NOW(), $%d)", i*4+1, i*4+2, i*4+3, i*4+4))
+				args = append(args, migration.Version, migration.Description, *migration.Checksum, migrationRank)
+			}
+
+			// Recorded migrations keep their rank
+			query := fmt.Sprintf(`
+				INSERT INTO %s (version, description, md5_checksum, success, repaired_at, installed_rank)
+				VALUES %s
+				ON CONFLICT (version) DO UPDATE
+				SET description = EXCLUDED.description, md5_checksum = EXCLUDED.md5_checksum, success = true,
+					repaired_at = CASE
+						WHEN EXCLUDED.description <> %s.description OR EXCLUDED.md5_checksum <> %s.md5_checksum
+						THEN NOW()
+						ELSE %s.repaired_at
+					END;
+			`, r.history_table, strings.Join(values, ", "), r.history_table, r.history_table, r.history_table)
+
+			_, err := r.queriable.ExecContext(r.ctx, query, args...)
+			if err != nil {
+				return err
+			}
 		}
+		return nil
+	})
+	if err != nil {
+		return []error{err}
 	}
 
-	if len(errs) > 0 {
-		return errs
+	return nil
+}
+
+// inTransaction runs the callback in the transaction started by DoInTransaction, or in a new one.
+func (r *PostgresRepository) inTransaction(fn func() error) error {
+	if _, ok := r.queriable.(*sql.Tx); ok {
+		return fn()
+	}
+	return r.DoInTransaction(fn)
+}
+
+// Annotate sets the note of the version in the notes column of the history table, added if missing.
+func (r *PostgresRepository) Annotate(version uint16, note string) error {
+	exists, err := r.CheckSchemaHistoryTable()
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return fmt.Errorf("version %d: %w", version, database.ErrNotApplied)
 	}
+
+	// History tables created by previous versions have no notes column
+	err = r.upgradeHistoryTable()
+	if err != nil {
+		return err
+	}
+
+	query := fmt.Sprintf(`
+		UPDATE %s SET notes = NULLIF($1, '') WHERE version = $2;
+	`, r.history_table)
+
+	res, err := r.queriable.ExecContext(r.ctx, query, note, version)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected < 1 {
+		return fmt.Errorf("version %d: %w", version, database.ErrNotApplied)
+	}
+
 	return nil
 }
 
+// PruneHistory deletes the history rows of the versions above latest, e.g. once the database was restored from a
+// backup taken before they were applied.
+func (r *PostgresRepository) PruneHistory(latest uint16) ([]uint16, error) {
+	exists, err := r.CheckSchemaHistoryTable()
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		return nil, nil
+	}
+
+	query := fmt.Sprintf(`
+		DELETE FROM %s WHERE version > $1 RETURNING version;
+	`, r.history_table)
+
+	rows, err := r.queriable.QueryContext(r.ctx, query, latest)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := make([]uint16, 0)
+	for rows.Next() {
+		version := uint16(0)
+		err = rows.Scan(&version)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, version)
+	}
+
+	sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
+	return versions, rows.Err()
+}
+
 func (r *PostgresRepository) GetFailingMigrations() ([]*migrations.Migration, error) {
 	exists, err := r.CheckSchemaHistoryTable()
 	if err != nil {
@@ -404,3 +1114,314 @@ func (r *PostgresRepository) GetFailingMigrations() ([]*migrations.Migration, er
 
 	return failingMigrations, nil
 }
+
+func (r *PostgresRepository) GetAppliedMigrations() ([]*database.AppliedMigration, error) {
+	exists, err := r.CheckSchemaHistoryTable()
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		return nil, nil
+	}
+
+	// History tables created by previous versions have no author, ticket, installed_rank and skipped columns
+	// until the next run
+	columns, err := r.historyColumns()
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := "'', ''"
+	_, author := columns["author"]
+	_, ticket := columns["ticket"]
+	if author && ticket {
+		metadata = "COALESCE(author, ''), COALESCE(ticket, '')"
+	}
+
+	rank := "0"
+	if _, ok := columns["installed_rank"]; ok {
+		rank = "COALESCE(installed_rank, 0)"
+	}
+
+	skipped := "false"
+	if _, ok := columns["skipped"]; ok {
+		skipped = "skipped"
+	}
+
+	// Execution times are formatted with database.EXECUTED_AT_LAYOUT, as drivers scan timestamps differently
+	query := fmt.Sprintf(`
+		SELECT version, description, md5_checksum, success, %s, %s, %s,
+			COALESCE(TO_CHAR(executed_at, 'YYYY-MM-DD HH24:MI:SS'), '')
+		FROM %s
+		ORDER BY version ASC;
+	`, metadata, rank, skipped, r.history_table)
+
+	rows, err := r.queriable.QueryContext(r.ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make([]*database.AppliedMigration, 0)
+	for rows.Next() {
+		migration, executedAt := new(database.AppliedMigration), ""
+		err := rows.Scan(&migration.Version, &migration.Description, &migration.Checksum, &migration.Success,
+			&migration.Author, &migration.Ticket, &migration.InstalledRank, &migration.Skipped, &executedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		migration.ExecutedAt, err = database.ParseExecutedAt(executedAt)
+		if err != nil {
+			return nil, err
+		}
+		applied = append(applied, migration)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return applied, nil
+}
+
+func (r *PostgresRepository) Clean() error {
+	query := `
+		SELECT 'DROP MATERIALIZED VIEW IF EXISTS ' || quote_ident(matviewname) || ' CASCADE'
+		FROM pg_matviews WHERE schemaname = current_schema()
+		UNION ALL
+		SELECT 'DROP VIEW IF EXISTS ' || quote_ident(viewname) || ' CASCADE'
+		FROM pg_views WHERE schemaname = current_schema()
+		UNION ALL
+		SELECT 'DROP TABLE IF EXISTS ' || quote_ident(tablename) || ' CASCADE'
+		FROM pg_tables WHERE schemaname = current_schema()
+		UNION ALL
+		SELECT 'DROP SEQUENCE IF EXISTS ' || quote_ident(sequence_name) || ' CASCADE'
+		FROM information_schema.sequences WHERE sequence_schema = current_schema()
+		UNION ALL
+		SELECT 'DROP ROUTINE IF EXISTS ' || p.oid::regprocedure || ' CASCADE'
+		FROM pg_proc p JOIN pg_namespace n ON n.oid = p.pronamespace
+		WHERE n.nspname = current_schema() AND p.prokind IN ('f', 'p')
+			AND NOT EXISTS (SELECT 1 FROM pg_depend d WHERE d.objid = p.oid AND d.deptype = 'e')
+		UNION ALL
+		SELECT 'DROP TYPE IF EXISTS ' || quote_ident(t.typname) || ' CASCADE'
+		FROM pg_type t JOIN pg_namespace n ON n.oid = t.typnamespace
+		WHERE n.nspname = current_schema() AND t.typtype IN ('e', 'd', 'r')
+			AND NOT EXISTS (SELECT 1 FROM pg_depend d WHERE d.objid = t.oid AND d.deptype = 'e');
+	`
+
+	rows, err := r.queriable.QueryContext(r.ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	statements := make([]string, 0)
+	for rows.Next() {
+		statement := ""
+		if err := rows.Scan(&statement); err != nil {
+			return err
+		}
+		statements = append(statements, statement)
+	}
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	for _, statement := range statements {
+		_, err = r.queriable.ExecContext(r.ctx, statement)
+		if err != nil {
+			return fmt.Errorf("error executing %q: %w", statement, err)
+		}
+	}
+
+	return nil
+}
+
+// planNode is a node of the plan output by EXPLAIN (FORMAT JSON, VERBOSE).
+type planNode struct {
+	NodeType     string      `json:"Node Type"`
+	Schema       string      `json:"Schema"`
+	RelationName string      `json:"Relation Name"`
+	TotalCost    float64     `json:"Total Cost"`
+	PlanRows     float64     `json:"Plan Rows"`
+	Plans        []*planNode `json:"Plans"`
+}
+
+// parsePlan returns the root node of the output of EXPLAIN (FORMAT JSON) for a statement.
+func parsePlan(output string) (*planNode, error) {
+	plans := make([]struct {
+		Plan *planNode `json:"Plan"`
+	}, 0)
+	if err := json.Unmarshal([]byte(output), &plans); err != nil {
+		return nil, fmt.Errorf("error parsing plan: %w", err)
+	}
+
+	if len(plans) != 1 || plans[0].Plan == nil {
+		return nil, fmt.Errorf("error parsing plan: expected one plan, got %d", len(plans))
+	}
+
+	return plans[0].Plan, nil
+}
+
+// seqScans returns the sequential scans of the node and its children.
+func (n *planNode) seqScans() []*planNode {
+	scans := make([]*planNode, 0)
+	if n.NodeType == "Seq Scan" && n.RelationName != "" {
+		scans = append(scans, n)
+	}
+
+	for _, child := range n.Plans {
+		scans = append(scans, child.seqScans()...)
+	}
+
+	return scans
+}
+
+// ExplainScript returns the plans of the DML statements of the script estimated by EXPLAIN, which does not
+// execute them. The scans are the sequential scans of the plans, with the rows of their tables from the
+// statistics of pg_class, unknown (0) for tables never analyzed.
+func (r *PostgresRepository) ExplainScript(script string) ([]*database.StatementPlan, error) {
+	statements, err := splitScript(script)
+	if err != nil {
+		return nil, err
+	}
+
+	plans := make([]*database.StatementPlan, 0)
+	for i, statement := range statements {
+		if !migrations.IsDMLStatement(statement) {
+			continue
+		}
+
+		plan := &database.StatementPlan{Index: i + 1, Statement: statement}
+		plans = append(plans, plan)
+
+		output := ""
+		err := r.queriable.QueryRowContext(r.ctx, "EXPLAIN (FORMAT JSON, VERBOSE) "+statement).Scan(&output)
+		if err != nil {
+			plan.Err = err
+			continue
+		}
+
+		root, err := parsePlan(output)
+		if err != nil {
+			return nil, err
+		}
+		plan.Cost, plan.Rows = root.TotalCost, root.PlanRows
+
+		for _, node := range root.seqScans() {
+			scan := &database.TableScan{Table: node.RelationName}
+			if node.Schema != "" {
+				scan.Table = node.Schema + "." + node.RelationName
+			}
+
+			err = r.queriable.QueryRowContext(r.ctx, `
+				SELECT GREATEST(c.reltuples, 0)::float8
+				FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace
+				WHERE n.nspname = COALESCE(NULLIF($1, ''), current_schema()) AND c.relname = $2;
+			`, node.Schema, node.RelationName).Scan(&scan.Rows)
+			if err != nil && !errors.Is(err, sql.ErrNoRows) {
+				return nil, err
+			}
+
+			plan.Scans = append(plan.Scans, scan)
+		}
+	}
+
+	return plans, nil
+}
+
+// splitScript splits a migration script into its statements, keeping each COPY ... FROM STDIN statement
+// with its inline data.
+func splitScript(script string) ([]string, error) {
+	if !migrations.HasCopyFromStdin(script) {
+		return migrations.SplitPostgresStatements(script), nil
+	}
+
+	parts, err := migrations.SplitCopyStatements(script)
+	if err != nil {
+		return nil, err
+	}
+
+	statements := make([]string, 0)
+	for _, part := range parts {
+		if part.Copy {
+			statements = append(statements, part.SQL)
+			continue
+		}
+		statements = append(statements, migrations.SplitPostgresStatements(part.SQL)...)
+	}
+
+	return statements, nil
+}
+
+// execScript executes a migration or hook script. COPY ... FROM STDIN statements followed by inline data
+// are executed through the copy protocol, which requires a transaction: if the script is not already
+// running inside one, the whole script is executed in its own transaction.
+func (r *PostgresRepository) execScript(script string) error {
+	if !migrations.HasCopyFromStdin(script) {
+		_, err := r.queriable.ExecContext(r.ctx, script)
+		return err
+	}
+
+	parts, err := migrations.SplitCopyStatements(script)
+	if err != nil {
+		return err
+	}
+
+	tx, inTransaction := r.queriable.(*sql.Tx)
+	if !inTransaction {
+		tx, err = r.db.BeginTx(r.ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+	}
+
+	for _, part := range parts {
+		if !part.Copy {
+			_, err = tx.ExecContext(r.ctx, part.SQL)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		err = copyRows(r.ctx, tx, part)
+		if err != nil {
+			return err
+		}
+	}
+
+	if !inTransaction {
+		return tx.Commit()
+	}
+
+	return nil
+}
+
+func copyRows(ctx context.Context, tx *sql.Tx, part *migrations.ScriptPart) error {
+	stmt, err := tx.PrepareContext(ctx, part.SQL)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, row := range part.Rows {
+		_, err = stmt.ExecContext(ctx, row...)
+		if err != nil {
+			return fmt.Errorf("error copying rows: %w", err)
+		}
+	}
+
+	// Flushes the copy stream and reports pending errors
+	_, err = stmt.ExecContext(ctx)
+	if err != nil {
+		return fmt.Errorf("error copying rows: %w", err)
+	}
+
+	return nil
+}
@@ -3,12 +3,18 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"testing"
+	"time"
 
+	"github.com/maestro-go/maestro/core/database"
 	"github.com/maestro-go/maestro/core/enums"
+	"github.com/maestro-go/maestro/core/maestrotest"
 	"github.com/maestro-go/maestro/internal/migrations"
 	testUtils "github.com/maestro-go/maestro/internal/utils/testing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 
 	_ "github.com/lib/pq"
@@ -193,6 +199,37 @@ func (s *MigrationTestSuite) TestValidateMigrations() {
 	s.Assert().Len(errs, 1)
 }
 
+func (s *MigrationTestSuite) TestValidateMigrationsBatches() {
+	checksum := "0a52730597fb4ffa01fc117d9e71e3a9"
+	toValidate := make([]*migrations.Migration, 0, batch_size*2+1)
+	for version := 1; version <= batch_size*2+1; version++ {
+		toValidate = append(toValidate, &migrations.Migration{
+			Version:     uint16(version),
+			Description: "abcd",
+			Type:        enums.MIGRATION_UP,
+			Checksum:    &checksum,
+		})
+	}
+
+	err := s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+
+	errs := s.repository.Repair(toValidate)
+	s.Assert().Nil(errs)
+
+	errs = s.repository.ValidateMigrations(toValidate)
+	s.Assert().Nil(errs)
+
+	_, err = s.suiteDb.ExecContext(s.ctx, fmt.Sprintf(`
+		UPDATE %s SET description = 'changed' WHERE version IN (1, $1);
+	`, default_history_table), batch_size*2+1)
+	s.Assert().NoError(err)
+
+	errs = s.repository.ValidateMigrations(toValidate)
+	s.Assert().Len(errs, 2)
+	s.Assert().ErrorContains(errs[0], "version: 1,")
+}
+
 func (s *MigrationTestSuite) TestExecuteMigration() {
 	checksum := "0a52730597fb4ffa01fc117d9e71e3a9"
 	content := "INVALID SQL"
@@ -249,6 +286,347 @@ func (s *MigrationTestSuite) TestExecuteMigration() {
 	s.Assert().Equal(*migration.Checksum, md5Checksum)
 }
 
+func (s *MigrationTestSuite) TestExecuteMigrationWithCopy() {
+	checksum := "0a52730597fb4ffa01fc117d9e71e3a9"
+	content := "CREATE TABLE countries (code CHAR(2) PRIMARY KEY, name TEXT);\n" +
+		"COPY countries (code, name) FROM STDIN;\n" +
+		"BR\tBrazil\n" +
+		"PT\t\\N\n" +
+		"\\.\n" +
+		"UPDATE countries SET name = 'Portugal' WHERE name IS NULL;\n"
+	migration := &migrations.Migration{
+		Version:     1,
+		Description: "countries",
+		Type:        enums.MIGRATION_UP,
+		Checksum:    &checksum,
+		Content:     &content,
+	}
+
+	err := s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+
+	errs := s.repository.ExecuteMigration(migration)
+	s.Assert().Nil(errs)
+
+	count := 0
+	err = s.suiteDb.QueryRowContext(s.ctx, "SELECT COUNT(*) FROM countries WHERE name IS NOT NULL;").Scan(&count)
+	s.Assert().NoError(err)
+	s.Assert().Equal(2, count)
+
+	// Inside a transaction
+	*migration.Content = "COPY countries (code, name) FROM STDIN;\nAR\tArgentina\n\\.\n"
+	migration.Version = 2
+
+	err = s.repository.DoInTransaction(func() error {
+		errs := s.repository.ExecuteMigration(migration)
+		return errors.Join(errs...)
+	})
+	s.Assert().NoError(err)
+
+	err = s.suiteDb.QueryRowContext(s.ctx, "SELECT COUNT(*) FROM countries;").Scan(&count)
+	s.Assert().NoError(err)
+	s.Assert().Equal(3, count)
+}
+
+func (s *MigrationTestSuite) TestAudit() {
+	checksum := "0a52730597fb4ffa01fc117d9e71e3a9"
+	upContent := "CREATE TABLE test (id INT NOT NULL PRIMARY KEY);"
+	downContent := "DROP TABLE test;"
+	up := &migrations.Migration{
+		Version:     1,
+		Description: "abcd",
+		Type:        enums.MIGRATION_UP,
+		Checksum:    &checksum,
+		Content:     &upContent,
+	}
+	down := &migrations.Migration{
+		Version:     1,
+		Description: "abcd",
+		Type:        enums.MIGRATION_DOWN,
+		Content:     &downContent,
+	}
+
+	err := s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+
+	s.repository.SetRunInfo(database.RunInfo{ID: "run1", MaestroVersion: "v0.0.1"})
+
+	errs := s.repository.ExecuteMigration(up)
+	s.Assert().Nil(errs)
+
+	err = s.repository.RollbackMigration(down)
+	s.Assert().NoError(err)
+
+	rows, err := s.suiteDb.QueryContext(s.ctx, fmt.Sprintf(`
+		SELECT run_id, maestro_version, direction, version, success FROM %s_audit ORDER BY id;
+	`, default_history_table))
+	s.Require().NoError(err)
+	defer rows.Close()
+
+	directions := make([]string, 0)
+	for rows.Next() {
+		runID, maestroVersion, direction := "", "", ""
+		version := uint16(0)
+		success := false
+		s.Require().NoError(rows.Scan(&runID, &maestroVersion, &direction, &version, &success))
+
+		s.Assert().Equal("run1", runID)
+		s.Assert().Equal("v0.0.1", maestroVersion)
+		s.Assert().Equal(uint16(1), version)
+		s.Assert().True(success)
+		directions = append(directions, direction)
+	}
+	s.Assert().Equal([]string{"up", "down"}, directions)
+}
+
+func (s *MigrationTestSuite) TestHistoryRunID() {
+	// History table of a previous version, without the run_id column
+	_, err := s.suiteDb.ExecContext(s.ctx, fmt.Sprintf(`
+		CREATE TABLE %s (
+			version SMALLINT NOT NULL PRIMARY KEY,
+			description VARCHAR(255) NOT NULL,
+			md5_checksum CHAR(32) NOT NULL,
+			success BOOLEAN NOT NULL DEFAULT false,
+			executed_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			repaired_at TIMESTAMP
+		);
+	`, default_history_table))
+	s.Require().NoError(err)
+
+	err = s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+
+	s.repository.SetRunInfo(database.RunInfo{ID: "run1", MaestroVersion: "v0.0.1"})
+
+	checksum := "0a52730597fb4ffa01fc117d9e71e3a9"
+	content := "CREATE TABLE test (id INT NOT NULL PRIMARY KEY);"
+	errs := s.repository.ExecuteMigration(&migrations.Migration{
+		Version:     1,
+		Description: "abcd",
+		Type:        enums.MIGRATION_UP,
+		Checksum:    &checksum,
+		Content:     &content,
+	})
+	s.Assert().Nil(errs)
+
+	runID := ""
+	err = s.suiteDb.QueryRowContext(s.ctx, fmt.Sprintf(`
+		SELECT run_id FROM %s WHERE version = 1;
+	`, default_history_table)).Scan(&runID)
+	s.Assert().NoError(err)
+	s.Assert().Equal("run1", runID)
+}
+
+func (s *MigrationTestSuite) TestHistoryAuthorAndTicket() {
+	// History table of a previous version, without the author and ticket columns
+	_, err := s.suiteDb.ExecContext(s.ctx, fmt.Sprintf(`
+		CREATE TABLE %s (
+			version SMALLINT NOT NULL PRIMARY KEY,
+			description VARCHAR(255) NOT NULL,
+			md5_checksum CHAR(32) NOT NULL,
+			success BOOLEAN NOT NULL DEFAULT false,
+			executed_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			repaired_at TIMESTAMP
+		);
+		INSERT INTO %s (version, description, md5_checksum, success) VALUES (1, 'abcd', 'checksum', true);
+	`, default_history_table, default_history_table))
+	s.Require().NoError(err)
+
+	// The history is read before the table is upgraded, e.g. by status
+	applied, err := s.repository.GetAppliedMigrations()
+	s.Require().NoError(err)
+	s.Require().Len(applied, 1)
+	s.Assert().Empty(applied[0].Author)
+
+	err = s.repository.AssertSchemaHistoryTable()
+	s.Require().NoError(err)
+
+	checksum := "0a52730597fb4ffa01fc117d9e71e3a9"
+	content := "CREATE TABLE test (id INT NOT NULL PRIMARY KEY);"
+	errs := s.repository.ExecuteMigration(&migrations.Migration{
+		Version:     2,
+		Description: "efgh",
+		Type:        enums.MIGRATION_UP,
+		Checksum:    &checksum,
+		Content:     &content,
+		Author:      "Jane Doe <jane@example.com>",
+		Ticket:      "OPS-123",
+	})
+	s.Assert().Nil(errs)
+
+	applied, err = s.repository.GetAppliedMigrations()
+	s.Require().NoError(err)
+	s.Require().Len(applied, 2)
+	s.Assert().Empty(applied[0].Author)
+	s.Assert().Equal("Jane Doe <jane@example.com>", applied[1].Author)
+	s.Assert().Equal("OPS-123", applied[1].Ticket)
+}
+
+func (s *MigrationTestSuite) TestHistoryInstalledRank() {
+	// History table of a previous version, without the installed_rank column, with versions applied out of order
+	_, err := s.suiteDb.ExecContext(s.ctx, fmt.Sprintf(`
+		CREATE TABLE %[1]s (
+			version SMALLINT NOT NULL PRIMARY KEY,
+			description VARCHAR(255) NOT NULL,
+			md5_checksum CHAR(32) NOT NULL,
+			success BOOLEAN NOT NULL DEFAULT false,
+			executed_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			repaired_at TIMESTAMP
+		);
+	`, default_history_table))
+	s.Require().NoError(err)
+
+	_, err = s.suiteDb.ExecContext(s.ctx, fmt.Sprintf(`
+		INSERT INTO %[1]s (version, description, md5_checksum, success, executed_at) VALUES
+			(1, 'abcd', 'checksum', true, '2024-01-02 00:00:00'), (2, 'efgh', 'checksum', true, '2024-01-01 00:00:00');
+	`, default_history_table))
+	s.Require().NoError(err)
+
+	ranks := func() []int64 {
+		applied, err := s.repository.GetAppliedMigrations()
+		s.Require().NoError(err)
+
+		ranks := make([]int64, 0, len(applied))
+		for _, migration := range applied {
+			ranks = append(ranks, migration.InstalledRank)
+		}
+		return ranks
+	}
+
+	// The history is read before the table is upgraded, e.g. by status
+	s.Assert().Equal([]int64{0, 0}, ranks())
+
+	// The rows are ranked in the order of their executions
+	err = s.repository.AssertSchemaHistoryTable()
+	s.Require().NoError(err)
+	s.Assert().Equal([]int64{2, 1}, ranks())
+
+	checksum := "0a52730597fb4ffa01fc117d9e71e3a9"
+	content := "SELECT 1;"
+	migration := &migrations.Migration{
+		Version:     1,
+		Description: "abcd",
+		Type:        enums.MIGRATION_UP,
+		Checksum:    &checksum,
+		Content:     &content,
+	}
+
+	// Repaired versions keep their rank, executed ones are ranked last
+	errs := s.repository.Repair([]*migrations.Migration{migration})
+	s.Require().Nil(errs)
+	s.Assert().Equal([]int64{2, 1}, ranks())
+
+	migration.Version = 3
+	errs = s.repository.ExecuteMigration(migration)
+	s.Require().Nil(errs)
+	s.Assert().Equal([]int64{2, 1, 3}, ranks())
+
+	migration.Version = 2
+	errs = s.repository.ExecuteMigration(migration)
+	s.Require().Nil(errs)
+	s.Assert().Equal([]int64{2, 4, 3}, ranks())
+
+	// Missing versions inserted by the repair are ranked last
+	migration.Version = 4
+	errs = s.repository.Repair([]*migrations.Migration{migration})
+	s.Require().Nil(errs)
+	s.Assert().Equal([]int64{2, 4, 3, 5}, ranks())
+}
+
+func (s *MigrationTestSuite) TestCopyHistory() {
+	// History table of a previous version, without the optional columns
+	_, err := s.suiteDb.ExecContext(s.ctx, `
+		CREATE TABLE old_history (
+			version SMALLINT NOT NULL PRIMARY KEY,
+			description VARCHAR(255) NOT NULL,
+			md5_checksum CHAR(32) NOT NULL,
+			success BOOLEAN NOT NULL DEFAULT false,
+			executed_at TIMESTAMP NOT NULL DEFAULT NOW()
+		);
+	`)
+	s.Require().NoError(err)
+
+	_, err = s.suiteDb.ExecContext(s.ctx, `
+		INSERT INTO old_history (version, description, md5_checksum, success, executed_at) VALUES
+			(1, 'abcd', 'checksum', true, '2024-01-02 00:00:00'), (2, 'efgh', 'checksum', false, '2024-01-01 00:00:00');
+	`)
+	s.Require().NoError(err)
+
+	err = s.repository.AssertSchemaHistoryTable()
+	s.Require().NoError(err)
+
+	copied, err := s.repository.CopyHistoryFrom("old_history")
+	s.Require().NoError(err)
+	s.Assert().Equal(int64(2), copied)
+
+	applied, err := s.repository.GetAppliedMigrations()
+	s.Require().NoError(err)
+	s.Assert().Equal([]*database.AppliedMigration{
+		{Version: 1, Description: "abcd", Checksum: "checksum", Success: true, InstalledRank: 2,
+			ExecutedAt: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{Version: 2, Description: "efgh", Checksum: "checksum", Success: false, InstalledRank: 1,
+			ExecutedAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}, applied)
+
+	// The previous table is kept in sync, replacing its rows
+	_, err = s.suiteDb.ExecContext(s.ctx, fmt.Sprintf("DELETE FROM %s WHERE version = 2;", default_history_table))
+	s.Require().NoError(err)
+
+	copied, err = s.repository.CopyHistoryTo("old_history")
+	s.Require().NoError(err)
+	s.Assert().Equal(int64(1), copied)
+}
+
+func (s *MigrationTestSuite) TestSkipMigration() {
+	checksum := "0a52730597fb4ffa01fc117d9e71e3a9"
+	content := "CREATE TABLE test (id INT NOT NULL PRIMARY KEY);"
+	migration := &migrations.Migration{
+		Version:     1,
+		Description: "abcd",
+		Type:        enums.MIGRATION_UP,
+		Checksum:    &checksum,
+		Content:     &content,
+	}
+
+	err := s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+
+	err = s.repository.SkipMigration(migration)
+	s.Assert().NoError(err)
+
+	// The migration is recorded as applied without being executed
+	s.checkTableExists("test", false)
+
+	latest, err := s.repository.GetLatestMigration()
+	s.Assert().NoError(err)
+	s.Assert().Equal(uint16(1), latest)
+
+	errs := s.repository.ValidateMigrations([]*migrations.Migration{migration})
+	s.Assert().Empty(errs)
+
+	direction := ""
+	err = s.suiteDb.QueryRowContext(s.ctx, fmt.Sprintf(`
+		SELECT direction FROM %s_audit WHERE version = 1;
+	`, default_history_table)).Scan(&direction)
+	s.Assert().NoError(err)
+	s.Assert().Equal(database.AUDIT_SKIP, direction)
+
+	// The history records the skip, until the version is executed
+	applied, err := s.repository.GetAppliedMigrations()
+	s.Assert().NoError(err)
+	s.Require().Len(applied, 1)
+	s.Assert().True(applied[0].Success)
+	s.Assert().True(applied[0].Skipped)
+
+	errs = s.repository.ExecuteMigration(migration)
+	s.Assert().Nil(errs)
+
+	applied, err = s.repository.GetAppliedMigrations()
+	s.Assert().NoError(err)
+	s.Require().Len(applied, 1)
+	s.Assert().False(applied[0].Skipped)
+}
+
 func (s *MigrationTestSuite) TestExecuteHook() {
 	content := "INVALID SQL"
 	hook := &migrations.Hook{
@@ -278,6 +656,34 @@ func (s *MigrationTestSuite) TestExecuteHook() {
 	s.Assert().True(exists)
 }
 
+func (s *MigrationTestSuite) TestExecuteAssertion() {
+	content := "SELECT 1 WHERE false;"
+	hook := &migrations.Hook{
+		Type:    enums.HOOK_ASSERTION,
+		Order:   1,
+		Content: &content,
+	}
+
+	err := s.repository.ExecuteAssertion(hook)
+	s.Assert().NoError(err)
+
+	*hook.Content = "SELECT true;"
+	err = s.repository.ExecuteAssertion(hook)
+	s.Assert().NoError(err)
+
+	*hook.Content = "SELECT false;"
+	err = s.repository.ExecuteAssertion(hook)
+	s.Assert().Error(err)
+
+	*hook.Content = "SELECT * FROM (VALUES (1), (2)) AS t(id);"
+	err = s.repository.ExecuteAssertion(hook)
+	s.Assert().ErrorContains(err, "2 rows")
+
+	*hook.Content = "INVALID SQL"
+	err = s.repository.ExecuteAssertion(hook)
+	s.Assert().Error(err)
+}
+
 func (s *MigrationTestSuite) TestRollbackMigration() {
 	content := "INVALID SQL"
 	migration := &migrations.Migration{
@@ -365,6 +771,75 @@ func (s *MigrationTestSuite) TestDoInTransaction() {
 	s.checkTableExists("test1", false)
 }
 
+func (s *MigrationTestSuite) TestDoOutsideTransaction() {
+	content := "CREATE TABLE test1 (id INT NOT NULL PRIMARY KEY);"
+	hook := &migrations.Hook{
+		Order:   1,
+		Type:    enums.HOOK_AFTER,
+		Content: &content,
+	}
+
+	err := s.repository.DoInTransaction(func() error {
+		err := s.repository.DoOutsideTransaction(func() error {
+			return s.repository.ExecuteHook(hook)
+		})
+		s.Assert().NoError(err)
+
+		return fmt.Errorf("example error")
+	})
+	s.Assert().Error(err)
+
+	s.checkTableExists("test1", true)
+}
+
+func (s *MigrationTestSuite) TestTransactionActivity() {
+	activity, err := s.repository.TransactionActivity()
+	s.Assert().NoError(err)
+	s.Assert().Nil(activity)
+
+	_, err = s.suiteDb.ExecContext(s.ctx, "CREATE TABLE blocked (id INT); CREATE TABLE guarded (id INT);")
+	s.Require().NoError(err)
+
+	// Another session holds the lock of the blocked table, idle in its transaction
+	blocker, err := s.suiteDb.BeginTx(s.ctx, nil)
+	s.Require().NoError(err)
+	defer blocker.Rollback()
+
+	_, err = blocker.ExecContext(s.ctx, "LOCK TABLE blocked IN ACCESS EXCLUSIVE MODE;")
+	s.Require().NoError(err)
+
+	err = s.repository.DoInTransaction(func() error {
+		err := s.repository.ExecuteHook(&migrations.Hook{Content: testUtils.ToPtr("LOCK TABLE guarded;")})
+		s.Require().NoError(err)
+
+		activity, err := s.repository.TransactionActivity()
+		s.Require().NoError(err)
+		s.Require().NotNil(activity)
+		s.Assert().Equal(s.repository.pid, activity.ID)
+		s.Assert().Equal([]string{"guarded"}, activity.ExclusiveLocks)
+		s.Assert().Zero(activity.LockWait)
+
+		waiting := make(chan error)
+		go func() {
+			waiting <- s.repository.ExecuteHook(&migrations.Hook{Content: testUtils.ToPtr("LOCK TABLE blocked;")})
+		}()
+
+		s.Require().Eventually(func() bool {
+			activity, err = s.repository.TransactionActivity()
+			return err == nil && activity.LockWait > 0
+		}, 10*time.Second, 100*time.Millisecond)
+
+		s.Require().Len(activity.Blockers, 1)
+		s.Assert().Equal("idle in transaction", activity.Blockers[0].State)
+
+		err = s.repository.CancelTransaction()
+		s.Assert().NoError(err)
+
+		return <-waiting
+	})
+	s.Assert().ErrorContains(err, "canceling statement")
+}
+
 func (s *MigrationTestSuite) TestDoInLock() {
 	err := s.repository.AssertSchemaHistoryTable()
 	s.Assert().NoError(err)
@@ -385,6 +860,54 @@ func (s *MigrationTestSuite) TestDoInLock() {
 	s.Assert().NoError(err)
 }
 
+func (s *MigrationTestSuite) TestDoInLockSessions() {
+	db, err := sql.Open("postgres", s.postgres.URI)
+	s.Require().NoError(err)
+	defer db.Close()
+
+	// Advisory locks are re-entrant, the sessions must not take the lock on the same backend
+	db.SetMaxOpenConns(2)
+	repository := NewPostgresRepository(s.ctx, db, testUtils.ToPtr(default_history_table))
+	first, second := repository.Session(), repository.Session()
+
+	locked := make(chan struct{})
+	err = first.DoInLock(func() error {
+		go func() {
+			_ = second.DoInLock(func() error { return nil })
+			close(locked)
+		}()
+
+		select {
+		case <-locked:
+			return errors.New("the lock was taken by both sessions")
+		case <-time.After(500 * time.Millisecond):
+			return nil
+		}
+	})
+	s.Assert().NoError(err)
+
+	// Released by the first session
+	select {
+	case <-locked:
+	case <-time.After(10 * time.Second):
+		s.Fail("the lock was not released")
+	}
+}
+
+func (s *MigrationTestSuite) TestDoInLockIdentity() {
+	s.repository.SetRunInfo(database.RunInfo{ID: "run", LockIdentity: "migrate-job-x7k2p"})
+	defer s.repository.SetRunInfo(database.RunInfo{})
+
+	err := s.repository.DoInLock(func() error {
+		info, err := s.repository.GetLockInfo()
+		s.Assert().NoError(err)
+		s.Assert().True(info.Locked)
+		s.Assert().Contains(info.Owner, "application migrate-job-x7k2p")
+		return nil
+	})
+	s.Assert().NoError(err)
+}
+
 func (s *MigrationTestSuite) TestRepair() {
 	checksums := []string{"0a52730597fb4ffa01fc117d9e71e3a9", "3d41c8443df34e73867adb149efbb2ea"}
 	contents := []string{"EXAMPLE CONTENT 1", "EXAMPLE CONTENT 2"}
@@ -436,6 +959,120 @@ func (s *MigrationTestSuite) TestRepair() {
 	s.Assert().Equal(*migrations[0].Checksum, repairedChecksum)
 }
 
+func (s *MigrationTestSuite) TestRepairBatches() {
+	checksum := "0a52730597fb4ffa01fc117d9e71e3a9"
+	toRepair := make([]*migrations.Migration, 0, batch_size*2+1)
+	for version := 1; version <= batch_size*2+1; version++ {
+		toRepair = append(toRepair, &migrations.Migration{
+			Version:     uint16(version),
+			Description: "abcd",
+			Type:        enums.MIGRATION_UP,
+			Checksum:    &checksum,
+		})
+	}
+
+	err := s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+
+	errs := s.repository.Repair(toRepair)
+	s.Assert().Nil(errs)
+
+	var count int
+	err = s.suiteDb.QueryRowContext(s.ctx, fmt.Sprintf("SELECT COUNT(*) FROM %s;", default_history_table)).Scan(&count)
+	s.Assert().NoError(err)
+	s.Assert().Equal(len(toRepair), count)
+}
+
+func (s *MigrationTestSuite) TestPruneHistory() {
+	versions, err := s.repository.PruneHistory(1)
+	s.Assert().NoError(err)
+	s.Assert().Empty(versions)
+
+	err = s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+
+	_, err = s.suiteDb.ExecContext(s.ctx, fmt.Sprintf(`
+		INSERT INTO %s (version, description, md5_checksum, success)
+		VALUES (1, 'a', '0a52730597fb4ffa01fc117d9e71e3a9', true), (2, 'b', '0a52730597fb4ffa01fc117d9e71e3a9', true),
+			(3, 'c', '0a52730597fb4ffa01fc117d9e71e3a9', false);
+	`, default_history_table))
+	s.Require().NoError(err)
+
+	versions, err = s.repository.PruneHistory(1)
+	s.Assert().NoError(err)
+	s.Assert().Equal([]uint16{2, 3}, versions)
+
+	latest, err := s.repository.GetLatestMigration()
+	s.Assert().NoError(err)
+	s.Assert().Equal(uint16(1), latest)
+}
+
+func (s *MigrationTestSuite) TestCheckHistorySchema() {
+	err := s.repository.CheckHistorySchema()
+	s.Assert().NoError(err)
+
+	err = s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+
+	err = s.repository.CheckHistorySchema()
+	s.Assert().NoError(err)
+
+	// Incompatible columns are reported with the statements upgrading them
+	_, err = s.suiteDb.ExecContext(s.ctx, fmt.Sprintf(`
+		ALTER TABLE %[1]s DROP COLUMN md5_checksum;
+		ALTER TABLE %[1]s ALTER COLUMN repaired_at TYPE VARCHAR(32);
+	`, default_history_table))
+	s.Require().NoError(err)
+
+	err = s.repository.CheckHistorySchema()
+	s.Assert().ErrorContains(err, "column md5_checksum is missing, column repaired_at has type character varying "+
+		"instead of a timestamp type. Upgrade it with: ALTER TABLE schema_history ADD COLUMN md5_checksum CHAR(32) "+
+		"NOT NULL DEFAULT ''; ALTER TABLE schema_history ALTER COLUMN repaired_at TYPE TIMESTAMP USING "+
+		"repaired_at::TIMESTAMP;")
+
+	var schemaErr *database.HistorySchemaError
+	s.Require().ErrorAs(err, &schemaErr)
+
+	for _, statement := range schemaErr.Upgrade {
+		_, err = s.suiteDb.ExecContext(s.ctx, statement)
+		s.Require().NoError(err)
+	}
+
+	err = s.repository.CheckHistorySchema()
+	s.Assert().NoError(err)
+}
+
+func (s *MigrationTestSuite) TestAnnotate() {
+	checksum := "0a52730597fb4ffa01fc117d9e71e3a9"
+	content := "SELECT 1;"
+	migration := &migrations.Migration{
+		Version:     1,
+		Description: "abcd",
+		Type:        enums.MIGRATION_UP,
+		Checksum:    &checksum,
+		Content:     &content,
+	}
+
+	err := s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+
+	errs := s.repository.ExecuteMigration(migration)
+	s.Assert().Nil(errs)
+
+	err = s.repository.Annotate(1, "applied manually by DBA, ticket OPS-123")
+	s.Assert().NoError(err)
+
+	notes := ""
+	err = s.suiteDb.QueryRowContext(s.ctx, fmt.Sprintf(`
+		SELECT notes FROM %s WHERE version = 1;
+	`, default_history_table)).Scan(&notes)
+	s.Assert().NoError(err)
+	s.Assert().Equal("applied manually by DBA, ticket OPS-123", notes)
+
+	err = s.repository.Annotate(2, "missing")
+	s.Assert().ErrorIs(err, database.ErrNotApplied)
+}
+
 func (s *MigrationTestSuite) TestGetFailingMigrations() {
 	err := s.repository.AssertSchemaHistoryTable()
 	s.Assert().NoError(err)
@@ -456,3 +1093,157 @@ func (s *MigrationTestSuite) TestGetFailingMigrations() {
 	s.Assert().Equal(uint16(1), failingMigrations[0].Version)
 	s.Assert().Equal(uint16(3), failingMigrations[1].Version)
 }
+
+func (s *MigrationTestSuite) TestGetAppliedMigrations() {
+	applied, err := s.repository.GetAppliedMigrations()
+	s.Assert().NoError(err)
+	s.Assert().Empty(applied)
+
+	err = s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+
+	query := fmt.Sprintf(`
+		INSERT INTO %s (version, description, md5_checksum, success, executed_at) VALUES
+			(2, 't', '0a52730597fb4ffa01fc117d9e71e3a9', false, '2024-05-01 10:30:00'),
+			(1, 't', '0a52730597fb4ffa01fc117d9e71e3a9', true, '2024-05-01 10:00:00');
+	`, default_history_table)
+
+	_, err = s.suiteDb.Exec(query)
+	s.Assert().NoError(err)
+
+	applied, err = s.repository.GetAppliedMigrations()
+	s.Assert().NoError(err)
+	s.Assert().Equal([]*database.AppliedMigration{
+		{Version: 1, Description: "t", Checksum: "0a52730597fb4ffa01fc117d9e71e3a9", Success: true,
+			ExecutedAt: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)},
+		{Version: 2, Description: "t", Checksum: "0a52730597fb4ffa01fc117d9e71e3a9", Success: false,
+			ExecutedAt: time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC)},
+	}, applied)
+	s.Assert().Equal(uint16(1), database.LatestAppliedVersion(applied))
+}
+
+func (s *MigrationTestSuite) TestClean() {
+	err := s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+
+	_, err = s.suiteDb.ExecContext(s.ctx, `
+		CREATE TYPE clean_status AS ENUM ('a', 'b');
+		CREATE SEQUENCE clean_seq;
+		CREATE TABLE clean_table (id SERIAL PRIMARY KEY, status clean_status);
+		CREATE VIEW clean_view AS SELECT id FROM clean_table;
+		CREATE FUNCTION clean_fn() RETURNS INT AS 'SELECT 1' LANGUAGE SQL;
+	`)
+	s.Require().NoError(err)
+
+	err = s.repository.Clean()
+	s.Assert().NoError(err)
+
+	s.checkTableExists(default_history_table, false)
+	s.checkTableExists("clean_table", false)
+	s.checkTableExists("clean_view", false)
+
+	count := 0
+	err = s.suiteDb.QueryRowContext(s.ctx, `
+		SELECT
+			(SELECT COUNT(*) FROM pg_type WHERE typname = 'clean_status') +
+			(SELECT COUNT(*) FROM pg_class WHERE relname = 'clean_seq') +
+			(SELECT COUNT(*) FROM pg_proc WHERE proname = 'clean_fn');
+	`).Scan(&count)
+	s.Assert().NoError(err)
+	s.Assert().Equal(0, count)
+}
+
+func (s *MigrationTestSuite) TestExplainScript() {
+	_, err := s.suiteDb.ExecContext(s.ctx, `
+		CREATE TABLE explain_orders (id SERIAL PRIMARY KEY, status TEXT);
+		INSERT INTO explain_orders (status) SELECT 'new' FROM generate_series(1, 5000);
+		ANALYZE explain_orders;
+	`)
+	s.Require().NoError(err)
+
+	plans, err := s.repository.ExplainScript(`
+		CREATE TABLE explain_items (id INT);
+		-- Backfill
+		UPDATE explain_orders SET status = 'old' WHERE status = 'new';
+		DELETE FROM explain_orders WHERE id = 1;
+		INSERT INTO explain_items SELECT 1;
+	`)
+	s.Require().NoError(err)
+	s.Require().Len(plans, 3)
+
+	s.Assert().Equal(2, plans[0].Index)
+	s.Assert().NoError(plans[0].Err)
+	s.Assert().Greater(plans[0].Cost, 0.0)
+	s.Require().Len(plans[0].Scans, 1)
+	s.Assert().Equal("public.explain_orders", plans[0].Scans[0].Table)
+	s.Assert().Equal(5000.0, plans[0].Scans[0].Rows)
+
+	// The primary key avoids the full scan
+	s.Assert().NoError(plans[1].Err)
+	s.Assert().Empty(plans[1].Scans)
+
+	// The table is created by the script, which is not executed
+	s.Assert().Error(plans[2].Err)
+
+	// Nothing was executed
+	s.checkTableExists("explain_items", false)
+	count := 0
+	err = s.suiteDb.QueryRowContext(s.ctx, "SELECT COUNT(*) FROM explain_orders WHERE status = 'new';").Scan(&count)
+	s.Assert().NoError(err)
+	s.Assert().Equal(5000, count)
+}
+
+func TestParsePlan(t *testing.T) {
+	plan, err := parsePlan(`[{"Plan": {"Node Type": "ModifyTable", "Total Cost": 120.5, "Plan Rows": 0, "Plans": [
+		{"Node Type": "Hash Join", "Total Cost": 100, "Plan Rows": 10, "Plans": [
+			{"Node Type": "Seq Scan", "Schema": "public", "Relation Name": "orders", "Plan Rows": 10},
+			{"Node Type": "Index Scan", "Schema": "public", "Relation Name": "users", "Plan Rows": 1}
+		]}
+	]}}]`)
+	require.NoError(t, err)
+	assert.Equal(t, 120.5, plan.TotalCost)
+
+	scans := plan.seqScans()
+	require.Len(t, scans, 1)
+	assert.Equal(t, "orders", scans[0].RelationName)
+
+	_, err = parsePlan(`[]`)
+	assert.Error(t, err)
+}
+
+func (s *MigrationTestSuite) TestRunConcurrent() {
+	maestrotest.RunConcurrent(s.T(), 4, &maestrotest.Config{
+		NewRepository: func(t testing.TB) database.Repository {
+			db, err := sql.Open("postgres", s.postgres.URI)
+			s.Require().NoError(err)
+			t.Cleanup(func() { db.Close() })
+
+			return NewPostgresRepository(s.ctx, db, testUtils.ToPtr(default_history_table))
+		},
+		Migrations: []string{
+			"CREATE TABLE concurrent1 (id INT PRIMARY KEY);",
+			"CREATE TABLE concurrent2 (id INT PRIMARY KEY);",
+			"CREATE TABLE concurrent3 (id INT PRIMARY KEY);",
+		},
+	})
+}
+
+func (s *MigrationTestSuite) TestRunConcurrentSharedRepository() {
+	db, err := sql.Open("postgres", s.postgres.URI)
+	s.Require().NoError(err)
+	defer db.Close()
+
+	// The migrators use sessions of the same repository, sharing its pool of connections
+	repository := NewPostgresRepository(s.ctx, db, testUtils.ToPtr(default_history_table))
+
+	maestrotest.RunConcurrent(s.T(), 4, &maestrotest.Config{
+		NewRepository: func(t testing.TB) database.Repository {
+			return repository
+		},
+		Migrations: []string{
+			"CREATE TABLE concurrent1 (id INT PRIMARY KEY);",
+			"CREATE TABLE concurrent2 (id INT PRIMARY KEY);",
+			"CREATE TABLE concurrent3 (id INT PRIMARY KEY);",
+		},
+	})
+}
@@ -0,0 +1,69 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// ErrReadOnly is returned by the connections of ReadOnly for the statements that may change the database.
+var ErrReadOnly = errors.New("the connection is read-only")
+
+// ReadOnlyDatabase runs the queries of a repository on a connection pool, and rejects every other statement
+// and transactions, for databases whose sessions cannot be made read-only by the server.
+type ReadOnlyDatabase struct {
+	pool *sql.DB
+}
+
+// ReadOnly returns the pool as a database only running queries. The statements run by Exec or Prepare, and
+// transactions, fail with ErrReadOnly. Queries are not parsed, so they must not change the database
+// themselves: repositories only read through them.
+func ReadOnly(pool *sql.DB) *ReadOnlyDatabase {
+	return &ReadOnlyDatabase{pool: pool}
+}
+
+// Pool returns the connection pool of the database, for the locks taken on a connection reserved from it,
+// which do not change the database.
+func (db *ReadOnlyDatabase) Pool() *sql.DB {
+	return db.pool
+}
+
+func (db *ReadOnlyDatabase) Exec(query string, args ...any) (sql.Result, error) {
+	return nil, ErrReadOnly
+}
+
+func (db *ReadOnlyDatabase) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return nil, ErrReadOnly
+}
+
+func (db *ReadOnlyDatabase) Prepare(query string) (*sql.Stmt, error) {
+	return nil, ErrReadOnly
+}
+
+func (db *ReadOnlyDatabase) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return nil, ErrReadOnly
+}
+
+func (db *ReadOnlyDatabase) Query(query string, args ...any) (*sql.Rows, error) {
+	return db.pool.Query(query, args...)
+}
+
+func (db *ReadOnlyDatabase) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return db.pool.QueryContext(ctx, query, args...)
+}
+
+func (db *ReadOnlyDatabase) QueryRow(query string, args ...any) *sql.Row {
+	return db.pool.QueryRow(query, args...)
+}
+
+func (db *ReadOnlyDatabase) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return db.pool.QueryRowContext(ctx, query, args...)
+}
+
+func (db *ReadOnlyDatabase) Begin() (*sql.Tx, error) {
+	return nil, ErrReadOnly
+}
+
+func (db *ReadOnlyDatabase) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	return nil, ErrReadOnly
+}
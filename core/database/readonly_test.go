@@ -0,0 +1,59 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadOnly(t *testing.T) {
+	pool, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer pool.Close()
+
+	ctx := context.Background()
+	db := ReadOnly(pool)
+
+	// Queries run on the pool
+	mock.ExpectQuery("SELECT COUNT").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+
+	count := 0
+	err = db.QueryRowContext(ctx, "SELECT COUNT(*) FROM schema_history").Scan(&count)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, count)
+
+	// Writes and transactions never reach the pool
+	_, err = db.ExecContext(ctx, "INSERT INTO schema_history (version) VALUES (1)")
+	assert.ErrorIs(t, err, ErrReadOnly)
+
+	_, err = db.Exec("DROP TABLE schema_history")
+	assert.ErrorIs(t, err, ErrReadOnly)
+
+	_, err = db.PrepareContext(ctx, "DELETE FROM schema_history")
+	assert.ErrorIs(t, err, ErrReadOnly)
+
+	_, err = db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	assert.ErrorIs(t, err, ErrReadOnly)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPool(t *testing.T) {
+	pool, _, err := sqlmock.New()
+	require.NoError(t, err)
+	defer pool.Close()
+
+	unwrapped, ok := Pool(ReadOnly(pool))
+	assert.True(t, ok)
+	assert.Same(t, pool, unwrapped)
+
+	pool.SetMaxOpenConns(1)
+	assert.True(t, SingleConnection(ReadOnly(pool)))
+
+	_, ok = Pool(&sql.Tx{})
+	assert.False(t, ok)
+}
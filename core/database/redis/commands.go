@@ -0,0 +1,105 @@
+package redis
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParseCommands parses the commands of a migration or hook file, one per line, with the quoting
+// rules of redis-cli: arguments are separated by spaces, double quoted arguments accept escape
+// sequences (\n, \r, \t, \", \\ and \xHH) and single quoted arguments accept \'.
+// Empty lines and lines starting with "#" are ignored.
+func ParseCommands(content string) ([][]string, error) {
+	commands := make([][]string, 0)
+
+	for i, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		args, err := splitArgs(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+
+		commands = append(commands, args)
+	}
+
+	return commands, nil
+}
+
+func splitArgs(line string) ([]string, error) {
+	args := make([]string, 0)
+
+	for i := 0; i < len(line); {
+		if line[i] == ' ' || line[i] == '\t' {
+			i++
+			continue
+		}
+
+		arg := strings.Builder{}
+		switch line[i] {
+		case '"':
+			i++
+			for ; i < len(line) && line[i] != '"'; i++ {
+				if line[i] != '\\' || i+1 >= len(line) {
+					arg.WriteByte(line[i])
+					continue
+				}
+
+				i++
+				switch line[i] {
+				case 'n':
+					arg.WriteByte('\n')
+				case 'r':
+					arg.WriteByte('\r')
+				case 't':
+					arg.WriteByte('\t')
+				case 'x':
+					if i+2 >= len(line) {
+						return nil, fmt.Errorf("invalid hex escape")
+					}
+					b, err := strconv.ParseUint(line[i+1:i+3], 16, 8)
+					if err != nil {
+						return nil, fmt.Errorf("invalid hex escape: %w", err)
+					}
+					arg.WriteByte(byte(b))
+					i += 2
+				default:
+					arg.WriteByte(line[i])
+				}
+			}
+			if i >= len(line) {
+				return nil, fmt.Errorf("unbalanced quotes")
+			}
+			i++
+		case '\'':
+			i++
+			for ; i < len(line) && line[i] != '\''; i++ {
+				if line[i] == '\\' && i+1 < len(line) && line[i+1] == '\'' {
+					i++
+				}
+				arg.WriteByte(line[i])
+			}
+			if i >= len(line) {
+				return nil, fmt.Errorf("unbalanced quotes")
+			}
+			i++
+		default:
+			for ; i < len(line) && line[i] != ' ' && line[i] != '\t'; i++ {
+				arg.WriteByte(line[i])
+			}
+			args = append(args, arg.String())
+			continue
+		}
+
+		if i < len(line) && line[i] != ' ' && line[i] != '\t' {
+			return nil, fmt.Errorf("closing quote must be followed by a space")
+		}
+		args = append(args, arg.String())
+	}
+
+	return args, nil
+}
@@ -0,0 +1,33 @@
+package redis
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCommands(t *testing.T) {
+	content := "# ACL setup\n" +
+		"ACL SETUSER app on >secret ~app:* +@read\n" +
+		"\n" +
+		"SET app:greeting \"hello\\tworld\\x21\"\n" +
+		"SET app:quote 'it\\'s' \"\"\n" +
+		"FT.CREATE idx ON HASH PREFIX 1 doc: SCHEMA title TEXT\r\n"
+
+	commands, err := ParseCommands(content)
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{
+		{"ACL", "SETUSER", "app", "on", ">secret", "~app:*", "+@read"},
+		{"SET", "app:greeting", "hello\tworld!"},
+		{"SET", "app:quote", "it's", ""},
+		{"FT.CREATE", "idx", "ON", "HASH", "PREFIX", "1", "doc:", "SCHEMA", "title", "TEXT"},
+	}, commands)
+}
+
+func TestParseCommandsErrors(t *testing.T) {
+	_, err := ParseCommands("SET key \"unterminated")
+	assert.ErrorContains(t, err, "line 1: unbalanced quotes")
+
+	_, err = ParseCommands("PING\nSET key \"value\"suffix")
+	assert.ErrorContains(t, err, "line 2: closing quote")
+}
@@ -0,0 +1,713 @@
+// Package redis implements the maestro repository for Redis and Valkey, executing migrations of
+// commands (see ParseCommands) through the RESP protocol.
+//
+// The schema history is stored in a hash, with a field per version, and a key set with NX
+// coordinates concurrent executions. The lock key expires after lock_ttl unless refreshed, which is done
+// between the commands of the migrations, so the lock of a killed process does not block later runs. Commands are executed one at a time without transactions:
+// failed migrations are recorded in the history and must be fixed and repaired manually.
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/maestro-go/maestro/core/database"
+	"github.com/maestro-go/maestro/core/enums"
+	"github.com/maestro-go/maestro/internal/conf"
+	"github.com/maestro-go/maestro/internal/migrations"
+)
+
+const default_history_key = "schema_history"
+const lock_key = "schema_lock"
+
+// lock_ttl is the time the lock key is kept without being refreshed. A single command running longer than it
+// lets another process take the lock.
+const lock_ttl = 2 * time.Minute
+
+// clean_batch_size is the number of keys scanned and deleted at a time by Clean.
+const clean_batch_size = 1000
+
+type historyEntry struct {
+	Version     uint16  `json:"version"`
+	Description string  `json:"description"`
+	Checksum    string  `json:"md5_checksum"`
+	Success     bool    `json:"success"`
+	ExecutedAt  string  `json:"executed_at"`
+	RepairedAt  *string `json:"repaired_at,omitempty"`
+	Notes       string  `json:"notes,omitempty"`
+	RunID       string  `json:"run_id,omitempty"`
+	Author      string  `json:"author,omitempty"`
+	Ticket      string  `json:"ticket,omitempty"`
+	Skipped     bool    `json:"skipped,omitempty"`
+}
+
+type RedisRepository struct {
+	database.Repository
+	ctx         context.Context
+	client      *client
+	history_key string
+	run         database.RunInfo
+
+	locked        bool      // Whether the lock key was set by the repository
+	lockRefreshed time.Time // Last time the expiry of the lock key was set
+}
+
+// NewRedisRepository returns a repository sending commands through the given connection, which must be
+// already authenticated and on the selected database. The connection must not be shared.
+func NewRedisRepository(ctx context.Context, conn io.ReadWriter, history_key *string) *RedisRepository {
+	repo := &RedisRepository{
+		ctx:    ctx,
+		client: newClient(conn),
+		run:    database.RunInfo{MaestroVersion: conf.VERSION},
+	}
+
+	if history_key != nil {
+		repo.history_key = *history_key
+	} else {
+		repo.history_key = default_history_key
+	}
+
+	return repo
+}
+
+// Do sends a command and returns its reply, e.g. to authenticate and select the database of the connection.
+func (r *RedisRepository) Do(args ...string) (any, error) {
+	if err := r.ctx.Err(); err != nil {
+		return nil, err
+	}
+	return r.client.do(args...)
+}
+
+func (r *RedisRepository) GetLatestMigration() (uint16, error) {
+	entries, err := r.history()
+	if err != nil {
+		return 0, err
+	}
+
+	latest := uint16(0)
+	for _, entry := range entries {
+		if entry.Success && entry.Version > latest {
+			latest = entry.Version
+		}
+	}
+
+	return latest, nil
+}
+
+// AssertSchemaHistoryTable does nothing: the history hash and the audit list are created with their first entry.
+func (r *RedisRepository) AssertSchemaHistoryTable() error {
+	return nil
+}
+
+func (r *RedisRepository) CheckSchemaHistoryTable() (bool, error) {
+	reply, err := r.Do("EXISTS", r.history_key)
+	if err != nil {
+		return false, err
+	}
+
+	return reply == int64(1), nil
+}
+
+func (r *RedisRepository) ValidateMigrations(localMigrations []*migrations.Migration) []error {
+	if len(localMigrations) < 1 {
+		return nil
+	}
+
+	byVersion := make(map[uint16]*migrations.Migration, len(localMigrations))
+	for _, migration := range localMigrations {
+		if migration.Type != enums.MIGRATION_UP {
+			return []error{fmt.Errorf("invalid migration type: %s", migration.Type.Name())}
+		}
+		byVersion[migration.Version] = migration
+	}
+
+	entries, err := r.history()
+	if err != nil {
+		return []error{err}
+	}
+
+	errs := make([]error, 0)
+	expectedVersion := uint16(1)
+
+	for _, entry := range entries {
+		// Check gaps
+		if expectedVersion != entry.Version {
+			errs = append(errs, &database.MissingVersionError{Version: expectedVersion})
+		}
+		expectedVersion = entry.Version + 1
+
+		// Check description or checksum mismatch
+		local, ok := byVersion[entry.Version]
+		if entry.Success && (!ok || local.Description != entry.Description || *local.Checksum != entry.Checksum) {
+			errs = append(errs, &database.MismatchError{Version: entry.Version, Description: entry.Description, Checksum: entry.Checksum})
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (r *RedisRepository) ExecuteMigration(migration *migrations.Migration) []error {
+	if migration.Type != enums.MIGRATION_UP {
+		return []error{fmt.Errorf("invalid migration type: %s", migration.Type.Name())}
+	}
+
+	errs := make([]error, 0)
+
+	err := r.execCommands(*migration.Content, migration.SkipStatements)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	success := err == nil
+
+	err = r.saveHistory(migration, success, false)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("migration %d: %w", migration.Version, err))
+	} else {
+		err = r.audit(migration, database.AUDIT_UP, success)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("migration %d: %w", migration.Version, err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// saveHistory upserts the migration in the history hash with the given status, and whether it was skipped
+// without being executed.
+func (r *RedisRepository) saveHistory(migration *migrations.Migration, success bool, skipped bool) error {
+	// Keeps the repaired_at field of existing versions
+	entry, err := r.historyEntry(migration.Version)
+	if err != nil {
+		return err
+	}
+
+	if entry == nil {
+		entry = &historyEntry{Version: migration.Version}
+	}
+
+	entry.Description = migration.Description
+	entry.Checksum = *migration.Checksum
+	entry.Success = success
+	entry.ExecutedAt = now()
+	entry.RunID = r.run.ID
+	entry.Author = migration.Author
+	entry.Ticket = migration.Ticket
+	entry.Skipped = skipped
+
+	return r.saveHistoryEntry(entry)
+}
+
+// SkipMigration records the migration as applied and skipped in the history hash without executing it, and
+// records the skip in the audit list.
+func (r *RedisRepository) SkipMigration(migration *migrations.Migration) error {
+	if migration.Type != enums.MIGRATION_UP {
+		return fmt.Errorf("invalid migration type: %s", migration.Type.Name())
+	}
+
+	err := r.saveHistory(migration, true, true)
+	if err != nil {
+		return fmt.Errorf("migration %d: %w", migration.Version, err)
+	}
+
+	return r.audit(migration, database.AUDIT_SKIP, true)
+}
+
+func (r *RedisRepository) ExecuteHook(hook *migrations.Hook) error {
+	return r.execCommands(*hook.Content, 0)
+}
+
+// ExecuteAssertion executes the single command of the assertion hook. The assertion passes if the
+// reply is empty: a null, an empty array or the integer 0 (e.g. SCARD or EXISTS of keys expected to be missing).
+func (r *RedisRepository) ExecuteAssertion(hook *migrations.Hook) error {
+	commands, err := ParseCommands(*hook.Content)
+	if err != nil {
+		return err
+	}
+
+	if len(commands) != 1 {
+		return fmt.Errorf("assertion must contain a single command, found %d", len(commands))
+	}
+
+	reply, err := r.Do(commands[0]...)
+	if err != nil {
+		return err
+	}
+
+	switch value := reply.(type) {
+	case nil:
+		return nil
+	case int64:
+		if value == 0 {
+			return nil
+		}
+		return fmt.Errorf("assertion failed: command returned %d", value)
+	case []any:
+		if len(value) == 0 {
+			return nil
+		}
+		return fmt.Errorf("assertion failed: command returned %d items", len(value))
+	}
+
+	return fmt.Errorf("assertion failed: command returned %q", reply)
+}
+
+func (r *RedisRepository) RollbackMigration(migration *migrations.Migration) error {
+	if migration.Type != enums.MIGRATION_DOWN {
+		return fmt.Errorf("invalid migration type: %s", migration.Type.Name())
+	}
+
+	field := strconv.Itoa(int(migration.Version))
+
+	reply, err := r.Do("HEXISTS", r.history_key, field)
+	if err != nil {
+		return err
+	}
+
+	if reply != int64(1) {
+		return nil
+	}
+
+	err = r.execCommands(*migration.Content, 0)
+	if err != nil {
+		return err
+	}
+
+	reply, err = r.Do("HDEL", r.history_key, field)
+	if err != nil {
+		return err
+	}
+
+	if reply != int64(1) {
+		return fmt.Errorf("version was not deleted from \"%s\" hash", r.history_key)
+	}
+
+	return r.audit(migration, database.AUDIT_DOWN, true)
+}
+
+// ServerInfo returns the version of the server (Redis or Valkey). The history rows are the fields
+// of the history hash.
+func (r *RedisRepository) ServerInfo() (*database.ServerInfo, error) {
+	reply, err := r.Do("INFO", "server")
+	if err != nil {
+		return nil, err
+	}
+
+	info := &database.ServerInfo{HistoryTable: r.history_key}
+
+	// Valkey reports both versions, the Redis one being the compatible version
+	for _, line := range strings.Split(fmt.Sprint(reply), "\n") {
+		key, value, _ := strings.Cut(strings.TrimSpace(line), ":")
+		if key == "valkey_version" || (key == "redis_version" && info.Version == "") {
+			info.Version = value
+		}
+	}
+
+	info.HistoryTableExists, err = r.CheckSchemaHistoryTable()
+	if err != nil || !info.HistoryTableExists {
+		return info, err
+	}
+
+	reply, err = r.Do("HLEN", r.history_key)
+	if err != nil {
+		return nil, err
+	}
+	info.HistoryRows, _ = reply.(int64)
+
+	return info, nil
+}
+
+func (r *RedisRepository) Capabilities() database.Capabilities {
+	return database.Capabilities{
+		SupportsTransactions:   false,
+		SupportsAdvisoryLock:   false,
+		SupportsMultiStatement: false,
+		MaxIdentifierLength:    0,
+	}
+}
+
+func (r *RedisRepository) SetRunInfo(info database.RunInfo) {
+	r.run = info
+}
+
+func (r *RedisRepository) auditKey() string {
+	return r.history_key + "_audit"
+}
+
+// audit records the execution of the migration at the end of the audit list.
+func (r *RedisRepository) audit(migration *migrations.Migration, direction string, success bool) error {
+	content, err := json.Marshal(map[string]any{
+		"run_id":          r.run.ID,
+		"maestro_version": r.run.MaestroVersion,
+		"direction":       direction,
+		"version":         migration.Version,
+		"description":     migration.Description,
+		"success":         success,
+		"executed_at":     now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = r.Do("RPUSH", r.auditKey(), string(content))
+	if err != nil {
+		return fmt.Errorf("error recording audit: %w", err)
+	}
+
+	return nil
+}
+
+// DoInTransaction runs the callback: MULTI does not return the replies of the commands before EXEC,
+// so commands are executed one at a time.
+func (r *RedisRepository) DoInTransaction(fn func() error) error {
+	return fn()
+}
+
+// DoOutsideTransaction runs the callback, as DoInTransaction does not start a transaction.
+func (r *RedisRepository) DoOutsideTransaction(fn func() error) error {
+	return fn()
+}
+
+// Session returns a repository sharing the connection of this one, with its own run info.
+func (r *RedisRepository) Session() database.Repository {
+	session := *r
+	return &session
+}
+
+// GetLockInfo reports whether the lock key exists, with the run and holder it was set to.
+func (r *RedisRepository) GetLockInfo() (*database.LockInfo, error) {
+	reply, err := r.Do("GET", r.lockKey())
+	if err != nil {
+		return nil, err
+	}
+
+	if reply == nil {
+		return &database.LockInfo{}, nil
+	}
+
+	return &database.LockInfo{Locked: true, Owner: fmt.Sprint(reply)}, nil
+}
+
+// lockKey returns the lock key of the history key, so the migrations of several history keys of the same
+// database do not block each other. The default history key keeps the lock key of previous versions.
+func (r *RedisRepository) lockKey() string {
+	if r.history_key == default_history_key {
+		return lock_key
+	}
+	return r.history_key + "_lock"
+}
+
+func (r *RedisRepository) DoInLock(fn func() error) error {
+	err := r.lock()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = r.unlock()
+		if err != nil {
+			panic(fmt.Errorf("failed to delete lock key: %w", err))
+		}
+	}()
+
+	err = fn()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// This function ensures that only one instance of the application can perform schema migrations at a time.
+// It achieves this by setting a lock key only if it does not exist, expiring after lock_ttl. If the key exists,
+// it waits for up to 1 minute for the key to be deleted by another instance, indicating that the migration
+// process has completed, or to expire.
+func (r *RedisRepository) lock() error {
+	for range 12 {
+		reply, err := r.Do("SET", r.lockKey(), fmt.Sprintf("run %s on %s", r.run.ID, r.run.Holder()), "NX",
+			"PX", strconv.FormatInt(lock_ttl.Milliseconds(), 10))
+		if err != nil {
+			return err
+		}
+
+		if reply != nil {
+			r.locked, r.lockRefreshed = true, time.Now()
+			return nil
+		}
+
+		time.Sleep(time.Second * 5) // Delays 5 seconds
+	}
+
+	return fmt.Errorf("timeout while waiting for %s deletion", r.lockKey())
+}
+
+// refreshLock sets the expiry of the lock key back to lock_ttl, at most every quarter of it, while the lock is
+// held. It returns an error if the key expired, as another process may have taken the lock since.
+func (r *RedisRepository) refreshLock() error {
+	if !r.locked || time.Since(r.lockRefreshed) < lock_ttl/4 {
+		return nil
+	}
+
+	reply, err := r.Do("PEXPIRE", r.lockKey(), strconv.FormatInt(lock_ttl.Milliseconds(), 10))
+	if err != nil {
+		return fmt.Errorf("failed to refresh lock key: %w", err)
+	}
+
+	if reply != int64(1) {
+		return fmt.Errorf("lock key %s expired", r.lockKey())
+	}
+
+	r.lockRefreshed = time.Now()
+	return nil
+}
+
+func (r *RedisRepository) unlock() error {
+	r.locked = false
+	_, err := r.Do("DEL", r.lockKey())
+	return err
+}
+
+func (r *RedisRepository) Repair(migrations []*migrations.Migration) []error {
+	exists, err := r.CheckSchemaHistoryTable()
+	if err != nil {
+		return []error{err}
+	}
+
+	if !exists {
+		return nil
+	}
+
+	if len(migrations) == 0 {
+		return nil
+	}
+
+	history, err := r.history()
+	if err != nil {
+		return []error{err}
+	}
+
+	byVersion := make(map[uint16]*historyEntry, len(history))
+	for _, entry := range history {
+		byVersion[entry.Version] = entry
+	}
+
+	// Every entry is written by a single HSET, which Redis applies atomically.
+	args := []string{"HSET", r.history_key}
+	for _, migration := range migrations {
+		repairedAt := now()
+		entry, ok := byVersion[migration.Version]
+		if !ok {
+			entry = &historyEntry{Version: migration.Version, ExecutedAt: repairedAt, RepairedAt: &repairedAt}
+		} else if entry.Description != migration.Description || entry.Checksum != *migration.Checksum {
+			entry.RepairedAt = &repairedAt
+		}
+
+		entry.Description = migration.Description
+		entry.Checksum = *migration.Checksum
+		entry.Success = true
+
+		content, err := json.Marshal(entry)
+		if err != nil {
+			return []error{err}
+		}
+		args = append(args, strconv.Itoa(int(migration.Version)), string(content))
+	}
+
+	_, err = r.Do(args...)
+	if err != nil {
+		return []error{err}
+	}
+
+	return nil
+}
+
+// Annotate sets the note of the version in the notes field of its history entry.
+func (r *RedisRepository) Annotate(version uint16, note string) error {
+	entry, err := r.historyEntry(version)
+	if err != nil {
+		return err
+	}
+
+	if entry == nil {
+		return fmt.Errorf("version %d: %w", version, database.ErrNotApplied)
+	}
+
+	entry.Notes = note
+	return r.saveHistoryEntry(entry)
+}
+
+func (r *RedisRepository) GetFailingMigrations() ([]*migrations.Migration, error) {
+	entries, err := r.history()
+	if err != nil {
+		return nil, err
+	}
+
+	var failingMigrations []*migrations.Migration
+	for _, entry := range entries {
+		if entry.Success {
+			continue
+		}
+
+		checksum := entry.Checksum
+		failingMigrations = append(failingMigrations, &migrations.Migration{
+			Version:     entry.Version,
+			Description: entry.Description,
+			Checksum:    &checksum,
+		})
+	}
+
+	return failingMigrations, nil
+}
+
+func (r *RedisRepository) GetAppliedMigrations() ([]*database.AppliedMigration, error) {
+	entries, err := r.history()
+	if err != nil {
+		return nil, err
+	}
+
+	applied := make([]*database.AppliedMigration, 0, len(entries))
+	for _, entry := range entries {
+		applied = append(applied, &database.AppliedMigration{
+			Version:     entry.Version,
+			Description: entry.Description,
+			Checksum:    entry.Checksum,
+			Success:     entry.Success,
+			Author:      entry.Author,
+			Ticket:      entry.Ticket,
+			Skipped:     entry.Skipped,
+		})
+	}
+
+	return applied, nil
+}
+
+// Clean deletes every key of the selected database, except the lock key, so cleaning inside
+// DoInLock does not release the lock. Functions and search indexes are not deleted.
+func (r *RedisRepository) Clean() error {
+	cursor := "0"
+	for {
+		reply, err := r.Do("SCAN", cursor, "COUNT", strconv.Itoa(clean_batch_size))
+		if err != nil {
+			return err
+		}
+
+		items, ok := reply.([]any)
+		if !ok || len(items) != 2 {
+			return fmt.Errorf("invalid SCAN reply")
+		}
+
+		cursor, _ = items[0].(string)
+		keys, _ := items[1].([]any)
+
+		args := []string{"DEL"}
+		for _, key := range keys {
+			if key != r.lockKey() {
+				args = append(args, fmt.Sprint(key))
+			}
+		}
+
+		if len(args) > 1 {
+			_, err = r.Do(args...)
+			if err != nil {
+				return err
+			}
+		}
+
+		if cursor == "0" || cursor == "" {
+			return nil
+		}
+	}
+}
+
+// execCommands executes the commands of a migration or hook file in order.
+func (r *RedisRepository) execCommands(content string, skip int) error {
+	commands, err := ParseCommands(content)
+	if err != nil {
+		return err
+	}
+
+	for i, command := range commands {
+		if i < skip {
+			continue
+		}
+
+		err = r.refreshLock()
+		if err != nil {
+			return err
+		}
+
+		_, err = r.Do(command...)
+		if err != nil {
+			return &database.StatementError{Index: i + 1, Err: fmt.Errorf("command %d (%s): %w", i+1, strings.ToUpper(command[0]), err)}
+		}
+	}
+
+	return nil
+}
+
+// history returns the entries of the history hash, ordered by version.
+func (r *RedisRepository) history() ([]*historyEntry, error) {
+	reply, err := r.Do("HVALS", r.history_key)
+	if err != nil {
+		return nil, err
+	}
+
+	values, _ := reply.([]any)
+	entries := make([]*historyEntry, 0, len(values))
+	for _, value := range values {
+		entry := new(historyEntry)
+		err = json.Unmarshal([]byte(fmt.Sprint(value)), entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid history entry: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Version < entries[j].Version
+	})
+
+	return entries, nil
+}
+
+// historyEntry returns the history entry of the version, nil if it does not exist.
+func (r *RedisRepository) historyEntry(version uint16) (*historyEntry, error) {
+	reply, err := r.Do("HGET", r.history_key, strconv.Itoa(int(version)))
+	if err != nil || reply == nil {
+		return nil, err
+	}
+
+	entry := new(historyEntry)
+	err = json.Unmarshal([]byte(fmt.Sprint(reply)), entry)
+	if err != nil {
+		return nil, fmt.Errorf("invalid history entry: %w", err)
+	}
+
+	return entry, nil
+}
+
+func (r *RedisRepository) saveHistoryEntry(entry *historyEntry) error {
+	content, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.Do("HSET", r.history_key, strconv.Itoa(int(entry.Version)), string(content))
+	return err
+}
+
+func now() string {
+	return time.Now().UTC().Format(time.RFC3339Nano)
+}
@@ -0,0 +1,435 @@
+package redis
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/maestro-go/maestro/core/database"
+	"github.com/maestro-go/maestro/core/enums"
+	"github.com/maestro-go/maestro/internal/migrations"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeServer implements the commands used by the tests on in-memory keys.
+type fakeServer struct {
+	strings  map[string]string
+	hashes   map[string]map[string]string
+	lists    map[string][]string
+	expiries map[string]time.Time
+}
+
+func newFakeServer(t *testing.T) net.Conn {
+	server := &fakeServer{
+		strings:  map[string]string{},
+		hashes:   map[string]map[string]string{},
+		lists:    map[string][]string{},
+		expiries: map[string]time.Time{},
+	}
+
+	clientConn, serverConn := net.Pipe()
+	t.Cleanup(func() { clientConn.Close() })
+
+	go func() {
+		reader := bufio.NewReader(serverConn)
+		for {
+			args, err := readCommand(reader)
+			if err != nil {
+				serverConn.Close()
+				return
+			}
+			serverConn.Write([]byte(server.exec(args)))
+		}
+	}()
+
+	return clientConn
+}
+
+func readCommand(reader *bufio.Reader) ([]string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+
+	count, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+	args := make([]string, 0, count)
+	for range count {
+		line, err = reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		length, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+
+		data := make([]byte, length+2)
+		_, err = io.ReadFull(reader, data)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, string(data[:length]))
+	}
+
+	return args, nil
+}
+
+func bulk(value string) string {
+	return "$" + strconv.Itoa(len(value)) + "\r\n" + value + "\r\n"
+}
+
+func (s *fakeServer) exec(args []string) string {
+	for key, expiry := range s.expiries {
+		if time.Now().After(expiry) {
+			delete(s.strings, key)
+			delete(s.expiries, key)
+		}
+	}
+
+	switch strings.ToUpper(args[0]) {
+	case "SET":
+		var expiry time.Time
+		for i := 3; i < len(args); i++ {
+			switch strings.ToUpper(args[i]) {
+			case "NX":
+				if _, ok := s.strings[args[1]]; ok {
+					return "$-1\r\n"
+				}
+			case "PX":
+				milliseconds, _ := strconv.Atoi(args[i+1])
+				expiry = time.Now().Add(time.Duration(milliseconds) * time.Millisecond)
+				i++
+			}
+		}
+		s.strings[args[1]] = args[2]
+		delete(s.expiries, args[1])
+		if !expiry.IsZero() {
+			s.expiries[args[1]] = expiry
+		}
+		return "+OK\r\n"
+	case "PEXPIRE":
+		if _, ok := s.strings[args[1]]; !ok {
+			return ":0\r\n"
+		}
+		milliseconds, _ := strconv.Atoi(args[2])
+		s.expiries[args[1]] = time.Now().Add(time.Duration(milliseconds) * time.Millisecond)
+		return ":1\r\n"
+	case "PTTL":
+		expiry, ok := s.expiries[args[1]]
+		if !ok {
+			return ":-1\r\n"
+		}
+		return ":" + strconv.FormatInt(time.Until(expiry).Milliseconds(), 10) + "\r\n"
+	case "GET":
+		value, ok := s.strings[args[1]]
+		if !ok {
+			return "$-1\r\n"
+		}
+		return bulk(value)
+	case "DEL":
+		deleted := 0
+		for _, key := range args[1:] {
+			if _, ok := s.strings[key]; ok {
+				deleted++
+			}
+			delete(s.strings, key)
+			delete(s.expiries, key)
+			delete(s.hashes, key)
+			delete(s.lists, key)
+		}
+		return ":" + strconv.Itoa(deleted) + "\r\n"
+	case "EXISTS":
+		if _, ok := s.hashes[args[1]]; ok {
+			return ":1\r\n"
+		}
+		if _, ok := s.strings[args[1]]; ok {
+			return ":1\r\n"
+		}
+		return ":0\r\n"
+	case "HSET":
+		if s.hashes[args[1]] == nil {
+			s.hashes[args[1]] = map[string]string{}
+		}
+		for i := 2; i+1 < len(args); i += 2 {
+			s.hashes[args[1]][args[i]] = args[i+1]
+		}
+		return ":" + strconv.Itoa((len(args)-2)/2) + "\r\n"
+	case "HGET":
+		value, ok := s.hashes[args[1]][args[2]]
+		if !ok {
+			return "$-1\r\n"
+		}
+		return bulk(value)
+	case "HEXISTS":
+		if _, ok := s.hashes[args[1]][args[2]]; ok {
+			return ":1\r\n"
+		}
+		return ":0\r\n"
+	case "HDEL":
+		if _, ok := s.hashes[args[1]][args[2]]; !ok {
+			return ":0\r\n"
+		}
+		delete(s.hashes[args[1]], args[2])
+		if len(s.hashes[args[1]]) == 0 {
+			delete(s.hashes, args[1])
+		}
+		return ":1\r\n"
+	case "HVALS":
+		reply := "*" + strconv.Itoa(len(s.hashes[args[1]])) + "\r\n"
+		for _, value := range s.hashes[args[1]] {
+			reply += bulk(value)
+		}
+		return reply
+	case "RPUSH":
+		s.lists[args[1]] = append(s.lists[args[1]], args[2:]...)
+		return ":" + strconv.Itoa(len(s.lists[args[1]])) + "\r\n"
+	case "LLEN":
+		return ":" + strconv.Itoa(len(s.lists[args[1]])) + "\r\n"
+	case "SCAN":
+		keys := make([]string, 0)
+		for key := range s.strings {
+			keys = append(keys, key)
+		}
+		for key := range s.hashes {
+			keys = append(keys, key)
+		}
+		for key := range s.lists {
+			keys = append(keys, key)
+		}
+		reply := "*2\r\n" + bulk("0") + "*" + strconv.Itoa(len(keys)) + "\r\n"
+		for _, key := range keys {
+			reply += bulk(key)
+		}
+		return reply
+	}
+
+	return "-ERR unknown command '" + args[0] + "'\r\n"
+}
+
+func newMigration(version uint16, migrationType enums.MigrationType, content string) *migrations.Migration {
+	checksum := "checksum" + strconv.Itoa(int(version))
+	return &migrations.Migration{
+		Version:     version,
+		Description: "migration" + strconv.Itoa(int(version)),
+		Type:        migrationType,
+		Content:     &content,
+		Checksum:    &checksum,
+	}
+}
+
+func TestMigrations(t *testing.T) {
+	repo := NewRedisRepository(context.Background(), newFakeServer(t), nil)
+	run := database.NewRunInfo()
+	run.LockIdentity = "migrate-job-x7k2p"
+	repo.SetRunInfo(run)
+
+	exists, err := repo.CheckSchemaHistoryTable()
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	lockInfo, err := repo.GetLockInfo()
+	assert.NoError(t, err)
+	assert.False(t, lockInfo.Locked)
+
+	err = repo.DoInLock(func() error {
+		errs := repo.ExecuteMigration(newMigration(1, enums.MIGRATION_UP, "SET app:version 1\nSET app:name 'maestro'"))
+		assert.Empty(t, errs)
+
+		errs = repo.ExecuteMigration(newMigration(2, enums.MIGRATION_UP, "INVALID command"))
+		assert.Len(t, errs, 1)
+		assert.ErrorContains(t, errs[0], "command 1 (INVALID): ERR unknown command")
+
+		// The lock is held
+		reply, err := repo.Do("SET", lock_key, "other", "NX")
+		assert.NoError(t, err)
+		assert.Nil(t, reply)
+
+		lockInfo, err := repo.GetLockInfo()
+		assert.NoError(t, err)
+		assert.True(t, lockInfo.Locked)
+		assert.Equal(t, "run "+run.ID+" on migrate-job-x7k2p", lockInfo.Owner)
+		return nil
+	})
+	assert.NoError(t, err)
+
+	latest, err := repo.GetLatestMigration()
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(1), latest)
+
+	failing, err := repo.GetFailingMigrations()
+	assert.NoError(t, err)
+	assert.Len(t, failing, 1)
+	assert.Equal(t, uint16(2), failing[0].Version)
+
+	applied, err := repo.GetAppliedMigrations()
+	assert.NoError(t, err)
+	assert.Len(t, applied, 2)
+	assert.True(t, applied[0].Success)
+	assert.False(t, applied[1].Success)
+
+	errs := repo.ValidateMigrations([]*migrations.Migration{newMigration(1, enums.MIGRATION_UP, "")})
+	assert.Empty(t, errs)
+
+	changed := newMigration(1, enums.MIGRATION_UP, "")
+	*changed.Checksum = "changed"
+	errs = repo.ValidateMigrations([]*migrations.Migration{changed})
+	assert.Len(t, errs, 1)
+
+	errs = repo.Repair([]*migrations.Migration{changed, newMigration(2, enums.MIGRATION_UP, "")})
+	assert.Empty(t, errs)
+	assert.Empty(t, repo.ValidateMigrations([]*migrations.Migration{changed, newMigration(2, enums.MIGRATION_UP, "")}))
+
+	err = repo.RollbackMigration(newMigration(2, enums.MIGRATION_DOWN, "DEL app:name"))
+	assert.NoError(t, err)
+
+	latest, err = repo.GetLatestMigration()
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(1), latest)
+
+	audit, err := repo.Do("LLEN", repo.auditKey())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), audit)
+
+	err = repo.Annotate(1, "applied manually by DBA")
+	assert.NoError(t, err)
+
+	entry, err := repo.historyEntry(1)
+	assert.NoError(t, err)
+	assert.Equal(t, "applied manually by DBA", entry.Notes)
+	assert.Equal(t, run.ID, entry.RunID)
+
+	err = repo.Annotate(9, "missing")
+	assert.ErrorIs(t, err, database.ErrNotApplied)
+
+	err = repo.Clean()
+	assert.NoError(t, err)
+
+	exists, err = repo.CheckSchemaHistoryTable()
+	assert.NoError(t, err)
+	assert.False(t, exists)
+}
+
+func TestSession(t *testing.T) {
+	repo := NewRedisRepository(context.Background(), newFakeServer(t), nil)
+	repo.SetRunInfo(database.RunInfo{ID: "run1"})
+
+	session := repo.Session()
+	session.SetRunInfo(database.RunInfo{ID: "run2"})
+
+	errs := repo.ExecuteMigration(newMigration(1, enums.MIGRATION_UP, "SET app:version 1"))
+	assert.Empty(t, errs)
+
+	errs = session.ExecuteMigration(newMigration(2, enums.MIGRATION_UP, "SET app:version 2"))
+	assert.Empty(t, errs)
+
+	// The session shares the connection, with its own run info
+	entry, err := repo.historyEntry(1)
+	assert.NoError(t, err)
+	assert.Equal(t, "run1", entry.RunID)
+
+	entry, err = repo.historyEntry(2)
+	assert.NoError(t, err)
+	assert.Equal(t, "run2", entry.RunID)
+}
+
+func TestHistoryAuthorAndTicket(t *testing.T) {
+	repo := NewRedisRepository(context.Background(), newFakeServer(t), nil)
+
+	migration := newMigration(1, enums.MIGRATION_UP, "SET app:version 1")
+	migration.Author = "Jane Doe <jane@example.com>"
+	migration.Ticket = "OPS-123"
+
+	errs := repo.ExecuteMigration(migration)
+	assert.Empty(t, errs)
+
+	errs = repo.ExecuteMigration(newMigration(2, enums.MIGRATION_UP, "SET app:version 2"))
+	assert.Empty(t, errs)
+
+	applied, err := repo.GetAppliedMigrations()
+	assert.NoError(t, err)
+	assert.Equal(t, "Jane Doe <jane@example.com>", applied[0].Author)
+	assert.Equal(t, "OPS-123", applied[0].Ticket)
+	assert.Empty(t, applied[1].Author)
+}
+
+func TestLockPerHistoryKey(t *testing.T) {
+	server := newFakeServer(t)
+	historyKey := "analytics_history"
+	app := NewRedisRepository(context.Background(), server, nil)
+	analytics := NewRedisRepository(context.Background(), server, &historyKey)
+
+	// The lock of each history key is independent
+	err := app.DoInLock(func() error {
+		return analytics.DoInLock(func() error {
+			lockInfo, err := app.GetLockInfo()
+			assert.NoError(t, err)
+			assert.True(t, lockInfo.Locked)
+
+			reply, err := app.Do("EXISTS", "analytics_history_lock")
+			assert.NoError(t, err)
+			assert.Equal(t, int64(1), reply)
+			return nil
+		})
+	})
+	assert.NoError(t, err)
+
+	lockInfo, err := analytics.GetLockInfo()
+	assert.NoError(t, err)
+	assert.False(t, lockInfo.Locked)
+}
+
+func TestExecuteAssertion(t *testing.T) {
+	repo := NewRedisRepository(context.Background(), newFakeServer(t), nil)
+
+	content := "EXISTS legacy:key"
+	assertion := &migrations.Hook{Content: &content}
+	assert.NoError(t, repo.ExecuteAssertion(assertion))
+
+	_, err := repo.Do("SET", "legacy:key", "1")
+	assert.NoError(t, err)
+	assert.ErrorContains(t, repo.ExecuteAssertion(assertion), "command returned 1")
+
+	content = "PING\nPING"
+	assert.ErrorContains(t, repo.ExecuteAssertion(assertion), "single command")
+}
+
+func TestLockExpiry(t *testing.T) {
+	repo := NewRedisRepository(context.Background(), newFakeServer(t), nil)
+
+	err := repo.DoInLock(func() error {
+		// The lock key expires, so a killed process does not keep the lock
+		ttl, err := repo.Do("PTTL", lock_key)
+		assert.NoError(t, err)
+		assert.Greater(t, ttl, int64(0))
+		assert.LessOrEqual(t, ttl, lock_ttl.Milliseconds())
+
+		// The expiry is refreshed while the commands of the migrations are executed
+		_, err = repo.Do("PEXPIRE", lock_key, "1000")
+		assert.NoError(t, err)
+		repo.lockRefreshed = time.Now().Add(-lock_ttl / 2)
+
+		errs := repo.ExecuteMigration(newMigration(1, enums.MIGRATION_UP, "SET app:version 1"))
+		assert.Empty(t, errs)
+
+		ttl, err = repo.Do("PTTL", lock_key)
+		assert.NoError(t, err)
+		assert.Greater(t, ttl, int64(1000))
+
+		// The migrations stop once the lock key expired, as another process may have taken the lock
+		_, err = repo.Do("DEL", lock_key)
+		assert.NoError(t, err)
+		repo.lockRefreshed = time.Now().Add(-lock_ttl / 2)
+
+		errs = repo.ExecuteMigration(newMigration(2, enums.MIGRATION_UP, "SET app:version 2"))
+		assert.Len(t, errs, 1)
+		assert.ErrorContains(t, errs[0], "lock key schema_lock expired")
+
+		value, err := repo.Do("GET", "app:version")
+		assert.NoError(t, err)
+		assert.Equal(t, "1", value)
+		return nil
+	})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,109 @@
+package redis
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// redisError is an error reply of the server.
+type redisError struct {
+	message string
+}
+
+func (e *redisError) Error() string {
+	return e.message
+}
+
+// client sends commands with the RESP2 protocol. Replies are returned as string (simple and bulk
+// strings), int64 (integers), nil (null bulk strings and arrays) or []any (arrays).
+type client struct {
+	mu     sync.Mutex
+	conn   io.ReadWriter
+	reader *bufio.Reader
+}
+
+func newClient(conn io.ReadWriter) *client {
+	return &client{conn: conn, reader: bufio.NewReader(conn)}
+}
+
+func (c *client) do(args ...string) (any, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	builder := strings.Builder{}
+	builder.WriteString("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, arg := range args {
+		builder.WriteString("$" + strconv.Itoa(len(arg)) + "\r\n" + arg + "\r\n")
+	}
+
+	_, err := io.WriteString(c.conn, builder.String())
+	if err != nil {
+		return nil, err
+	}
+
+	return c.readReply()
+}
+
+func (c *client) readReply() (any, error) {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+
+	line = strings.TrimSuffix(line, "\r\n")
+	if len(line) < 1 {
+		return nil, fmt.Errorf("invalid reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, &redisError{message: line[1:]}
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		length, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if length < 0 {
+			return nil, nil
+		}
+
+		data := make([]byte, length+2) // Data and \r\n
+		_, err = io.ReadFull(c.reader, data)
+		if err != nil {
+			return nil, err
+		}
+		return string(data[:length]), nil
+	case '*':
+		length, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if length < 0 {
+			return nil, nil
+		}
+
+		items := make([]any, 0, length)
+		for range length {
+			item, err := c.readReply()
+			if err != nil {
+				// Errors inside arrays (e.g. EXEC results) are returned as items
+				if _, ok := err.(*redisError); !ok {
+					return nil, err
+				}
+				item = err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	}
+
+	return nil, fmt.Errorf("invalid reply %q", line)
+}
@@ -7,6 +7,13 @@ import (
 	"github.com/maestro-go/maestro/internal/migrations"
 )
 
+// Migration is a migration file passed to the methods of Repository. The type is declared in an internal
+// package, so repositories outside of this module, e.g. external drivers, name it with this alias.
+type Migration = migrations.Migration
+
+// Hook is a hook file passed to the methods of Repository, named with this alias outside of this module.
+type Hook = migrations.Hook
+
 // Queriable abstract the either database or transaction
 type Queriable interface {
 	Exec(query string, args ...any) (sql.Result, error)
@@ -28,14 +35,32 @@ type Database interface {
 
 type Repository interface {
 
+	// Capabilities returns the features supported by the database of the repository.
+	Capabilities() Capabilities
+
+	// ServerInfo returns the version of the server, the current schema and the state of the
+	// schema history table. It is a cheap check that the database is reachable.
+	// Returns an error if there is an issue querying the database.
+	ServerInfo() (*ServerInfo, error)
+
+	// GetLockInfo reports whether the lock taken by DoInLock is currently held, by this or another
+	// process, and by whom and since when where the database can tell.
+	// Returns an error if there is an issue querying the database.
+	GetLockInfo() (*LockInfo, error)
+
 	// GetLatestMigration retrieves the highest successfully executed migration version
 	// from the schema history table. If the schema history table does not exist, it returns 0.
 	// Returns an error if there is an issue querying the database.
 	GetLatestMigration() (uint16, error)
 
-	// AssertSchemaHistoryTable ensures that the schema history table exists.
-	// If it does not exist, the method creates it.
-	// Returns an error if there is an issue creating the table.
+	// GetAppliedMigrations retrieves every row of the schema history table, successful or not, ordered
+	// by version. If the schema history table does not exist, it returns no rows.
+	// Returns an error if there is an issue querying the database.
+	GetAppliedMigrations() ([]*AppliedMigration, error)
+
+	// AssertSchemaHistoryTable ensures that the schema history table and its audit table exist.
+	// If they do not exist, the method creates them.
+	// Returns an error if there is an issue creating the tables.
 	AssertSchemaHistoryTable() error
 
 	// CheckSchemaHistoryTable verifies whether the schema history table exists in the database.
@@ -47,33 +72,60 @@ type Repository interface {
 	// checksums stored in the schema history table. If a mismatch is found or if a migration
 	// version is missing from the table, an error is returned.
 	// Returns a slice of errors if there are validation issues.
-	ValidateMigrations(migrations []*migrations.Migration) []error
+	ValidateMigrations(migrations []*Migration) []error
+
+	// SetRunInfo sets the run metadata recorded in the audit table by the following executions
+	// and rollbacks of migrations.
+	SetRunInfo(info RunInfo)
 
 	// ExecuteMigration applies the specified UP migration to the database.
 	// If the migration is already recorded in the schema history table, its status is updated.
 	// If the migration fails, it is marked as unsuccessful in the schema history table.
+	// The execution is recorded in the audit table.
 	// Returns a slice of errors if there are issues executing the migration.
-	ExecuteMigration(migration *migrations.Migration) []error
+	ExecuteMigration(migration *Migration) []error
+
+	// SkipMigration records the specified UP migration as successfully applied in the schema history
+	// table without executing it, so the next migrations and the validation go on, and records the skip
+	// in the audit table.
+	// Returns an error if there is an issue recording the migration.
+	SkipMigration(migration *Migration) error
 
 	// ExecuteHook runs the specified hook script. This method is used for executing hooks such
 	// as before/after migration scripts.
 	// Returns an error if there is an issue executing the hook.
-	ExecuteHook(hook *migrations.Hook) error
+	ExecuteHook(hook *Hook) error
+
+	// ExecuteAssertion runs the specified assertion hook query. The assertion passes if the query
+	// returns no rows, or a single row with a single true value.
+	// Returns an error if there is an issue executing the query or if the assertion fails.
+	ExecuteAssertion(hook *Hook) error
 
 	// RollbackMigration executes the specified DOWN migration to revert changes made by a previous
 	// migration. After successful execution, the corresponding version is removed from the schema
-	// history table.
+	// history table and the rollback is recorded in the audit table.
 	// Returns an error if there is an issue executing the rollback.
-	RollbackMigration(migration *migrations.Migration) error
+	RollbackMigration(migration *Migration) error
 
 	// Repair updates the md5 checksums, descriptions, or versions of migrations that mismatch
 	// the stored values in the schema history table. Updates the repaired_at timestamp to now.
+	// The migrations are upserted in batches, within a single transaction where the database has them.
 	// Returns a list of errors for any failed repairs.
-	Repair(migrations []*migrations.Migration) []error
+	Repair(migrations []*Migration) []error
+
+	// Annotate sets the note of the version in the notes column of the schema history table, adding the
+	// column to tables created by previous versions. An empty note clears it.
+	// Returns ErrNotApplied if the version is not in the schema history table.
+	Annotate(version uint16, note string) error
 
 	// GetFailingMigrations retrieves migrations that have failed (success = false).
 	// Returns a slice of migrations and an error if there is an issue querying the database.
-	GetFailingMigrations() ([]*migrations.Migration, error)
+	GetFailingMigrations() ([]*Migration, error)
+
+	// Clean drops every object (tables, views, sequences, routines and types) of the current schema,
+	// including the schema history table. Objects owned by extensions are left untouched.
+	// Returns an error if there is an issue dropping the objects.
+	Clean() error
 
 	// DoInTransaction initializes a database transaction. All queries executed within the callback
 	// function are performed within this transaction. If the callback function returns an error,
@@ -81,8 +133,49 @@ type Repository interface {
 	// Returns an error if there is an issue starting the transaction or if the callback returns an error.
 	DoInTransaction(fn func() error) error
 
+	// DoOutsideTransaction runs the callback outside of the transaction started by DoInTransaction, on a
+	// separate connection, so its queries are committed even if the transaction is rolled back.
+	// Repositories without transactions only run the callback.
+	DoOutsideTransaction(fn func() error) error
+
 	// DoInLock acquires a lock on the database to prevent concurrent execution of
 	// migrations. This ensures that migrations are applied sequentially and avoids duplication.
 	// Returns an error if there is an issue acquiring or releasing the lock, or if the callback returns an error.
 	DoInLock(fn func() error) error
 }
+
+// SessionRepository is a repository whose state (the transaction of DoInTransaction, the run info and the
+// lock held by DoInLock) can be split into sessions sharing its connections, so several migrators of the
+// same process can use the database concurrently.
+type SessionRepository interface {
+	Repository
+
+	// Session returns a repository on the same database and history table, with its own transaction, run
+	// info and lock state. It is outside of any transaction of this repository.
+	Session() Repository
+}
+
+// HistoryPruner is a repository able to remove versions from the schema history table without executing
+// their down migrations, e.g. once the database was restored from a backup taken before they were applied.
+type HistoryPruner interface {
+	Repository
+
+	// PruneHistory deletes the rows of the versions above latest from the schema history table, and returns
+	// their versions. Returns no version if the history table does not exist.
+	PruneHistory(latest uint16) ([]uint16, error)
+}
+
+// HistoryCopier is a repository able to copy rows between schema history tables, so the history table can be
+// renamed without losing the applied migrations, and the previous table kept in sync while it is still read.
+type HistoryCopier interface {
+	Repository
+
+	// CopyHistoryFrom replaces the rows of the schema history table with the rows of the history table of a
+	// previous name, in a transaction, and returns the number of copied rows. Both tables must exist. The
+	// columns missing in the previous table are left empty.
+	CopyHistoryFrom(table string) (int64, error)
+
+	// CopyHistoryTo replaces the rows of the history table of a previous name with the rows of the schema
+	// history table, like CopyHistoryFrom. The columns missing in the previous table are not copied.
+	CopyHistoryTo(table string) (int64, error)
+}
@@ -0,0 +1,46 @@
+package database
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+
+	"github.com/maestro-go/maestro/internal/conf"
+)
+
+// Directions of the migrations recorded in the audit table
+const (
+	AUDIT_UP   = "up"
+	AUDIT_DOWN = "down"
+	AUDIT_SKIP = "skip" // Recorded as applied without being executed
+)
+
+// RunInfo identifies the execution applying or rolling back migrations. It is recorded in the
+// audit table of the history table for every migration executed.
+type RunInfo struct {
+	ID             string
+	MaestroVersion string
+	LockIdentity   string // Recorded with the lock as its holder (e.g. the name of the pod), the host name if empty
+}
+
+// NewRunInfo returns the metadata of a new run, with a random ID and the current maestro version.
+func NewRunInfo() RunInfo {
+	id := make([]byte, 16)
+	rand.Read(id)
+
+	return RunInfo{
+		ID:             hex.EncodeToString(id),
+		MaestroVersion: conf.VERSION,
+	}
+}
+
+// Holder returns the name of the process recorded with the lock taken by the run: its lock identity, or else
+// the host name.
+func (r RunInfo) Holder() string {
+	if r.LockIdentity != "" {
+		return r.LockIdentity
+	}
+
+	host, _ := os.Hostname()
+	return host
+}
@@ -0,0 +1,10 @@
+package database
+
+// ServerInfo describes the server behind a repository and the state of its schema history table.
+type ServerInfo struct {
+	Version            string // Version reported by the server
+	Schema             string // Schema (or database, catalog...) holding the schema history table
+	HistoryTable       string
+	HistoryTableExists bool
+	HistoryRows        int64 // Rows of the schema history table, including failed migrations
+}
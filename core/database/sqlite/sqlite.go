@@ -0,0 +1,1101 @@
+// Package sqlite implements the maestro repository for SQLite databases.
+//
+// The package does not import a database driver: open the database file with a SQLite driver
+// (e.g. modernc.org/sqlite or github.com/mattn/go-sqlite3) and pass it to NewSQLiteRepository.
+// Migration scripts are executed at once, so the driver must execute every statement of a query.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/maestro-go/maestro/core/database"
+	"github.com/maestro-go/maestro/core/enums"
+	"github.com/maestro-go/maestro/internal/conf"
+	"github.com/maestro-go/maestro/internal/migrations"
+)
+
+const default_history_table = "schema_history"
+const lock_file_suffix = "schema_lock"
+
+// batch_size is the number of migrations per statement of Repair and ValidateMigrations, keeping
+// the parameters of a statement below the limit of 32766.
+const batch_size = 1000
+
+// history_schema are the columns of the history table. The optional ones were added after its first release,
+// and are added by upgradeHistoryTable to the tables created by previous versions.
+var history_schema = []*database.HistoryColumn{
+	{Name: "version", Family: database.COLUMN_INTEGER, Type: "INTEGER", Definition: "INTEGER NOT NULL"},
+	{Name: "description", Family: database.COLUMN_TEXT, Type: "TEXT", Definition: "TEXT NOT NULL DEFAULT ''"},
+	{Name: "md5_checksum", Family: database.COLUMN_TEXT, Type: "TEXT", Definition: "TEXT NOT NULL DEFAULT ''"},
+	{Name: "success", Family: database.COLUMN_BOOLEAN, Type: "BOOLEAN", Definition: "BOOLEAN NOT NULL DEFAULT false"},
+	{Name: "executed_at", Family: database.COLUMN_TIMESTAMP, Type: "TIMESTAMP", Definition: "TIMESTAMP"},
+	{Name: "repaired_at", Family: database.COLUMN_TIMESTAMP, Type: "TIMESTAMP", Definition: "TIMESTAMP"},
+	{Name: "notes", Family: database.COLUMN_TEXT, Type: "TEXT", Definition: "TEXT", Optional: true},
+	{Name: "run_id", Family: database.COLUMN_TEXT, Type: "TEXT", Definition: "TEXT", Optional: true},
+	{Name: "author", Family: database.COLUMN_TEXT, Type: "TEXT", Definition: "TEXT", Optional: true},
+	{Name: "ticket", Family: database.COLUMN_TEXT, Type: "TEXT", Definition: "TEXT", Optional: true},
+	{Name: "installed_rank", Family: database.COLUMN_INTEGER, Type: "INTEGER", Definition: "INTEGER", Optional: true},
+	{Name: "skipped", Family: database.COLUMN_BOOLEAN, Type: "BOOLEAN", Definition: "BOOLEAN NOT NULL DEFAULT false", Optional: true},
+}
+
+// SQLiteRepository manages the migrations of a SQLite database. The lock of DoInLock is a file created next
+// to the database file, so the processes sharing the file do not migrate it concurrently.
+type SQLiteRepository struct {
+	database.Repository
+	ctx           context.Context
+	queriable     database.Queriable
+	db            database.Database
+	history_table string
+	run           database.RunInfo
+}
+
+func NewSQLiteRepository(ctx context.Context, db database.Database, history_table *string) *SQLiteRepository {
+	repo := &SQLiteRepository{
+		ctx:       ctx,
+		queriable: db,
+		db:        db,
+		run:       database.RunInfo{MaestroVersion: conf.VERSION},
+	}
+
+	if history_table != nil {
+		repo.history_table = *history_table
+	} else {
+		repo.history_table = default_history_table
+	}
+
+	return repo
+}
+
+func (r *SQLiteRepository) GetLatestMigration() (uint16, error) {
+	tableExists, err := r.CheckSchemaHistoryTable()
+	if err != nil {
+		return 0, err
+	}
+
+	if !tableExists {
+		return 0, nil
+	}
+
+	query := fmt.Sprintf(`
+		SELECT COALESCE(MAX(version), 0)
+		FROM %s
+		WHERE success = true;
+	`, r.history_table)
+
+	version := uint16(0)
+	err = r.queriable.QueryRowContext(r.ctx, query).Scan(&version)
+	if err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+func (r *SQLiteRepository) AssertSchemaHistoryTable() error {
+	// Audit tables are also created for history tables of previous versions
+	query := fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			run_id TEXT NOT NULL,
+			maestro_version TEXT NOT NULL,
+			direction TEXT NOT NULL,
+			version INTEGER NOT NULL,
+			description TEXT NOT NULL,
+			success BOOLEAN NOT NULL,
+			executed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		);
+	`, r.auditTable())
+
+	_, err := r.queriable.ExecContext(r.ctx, query)
+	if err != nil {
+		return err
+	}
+
+	exists, err := r.CheckSchemaHistoryTable()
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		return r.upgradeHistoryTable()
+	}
+
+	query = fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			version INTEGER NOT NULL PRIMARY KEY,
+			description TEXT NOT NULL,
+			md5_checksum TEXT NOT NULL,
+			success BOOLEAN NOT NULL DEFAULT false,
+			executed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			repaired_at TIMESTAMP,
+			notes TEXT,
+			run_id TEXT,
+			author TEXT,
+			ticket TEXT,
+			installed_rank INTEGER,
+			skipped BOOLEAN NOT NULL DEFAULT false
+		);
+	`, r.history_table)
+
+	_, err = r.queriable.ExecContext(r.ctx, query)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// upgradeHistoryTable adds the columns missing in history tables created by previous versions. The installed
+// ranks of the rows are set in the order of their executions.
+func (r *SQLiteRepository) upgradeHistoryTable() error {
+	columns, err := r.historyColumns()
+	if err != nil {
+		return err
+	}
+
+	for _, column := range history_schema {
+		if _, ok := columns[column.Name]; ok || !column.Optional {
+			continue
+		}
+
+		_, err = r.queriable.ExecContext(r.ctx, fmt.Sprintf(`
+			ALTER TABLE %s ADD COLUMN %s %s;
+		`, r.history_table, column.Name, column.Definition))
+		if err != nil {
+			return err
+		}
+
+		if column.Name == "installed_rank" {
+			_, err = r.queriable.ExecContext(r.ctx, fmt.Sprintf(`
+				UPDATE %s SET installed_rank = ranks.installed_rank
+				FROM (
+					SELECT version, ROW_NUMBER() OVER (ORDER BY executed_at, version) AS installed_rank
+					FROM %s
+				) AS ranks
+				WHERE %s.version = ranks.version;
+			`, r.history_table, r.history_table, r.history_table))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// historyColumns returns the lowercased types of the columns of the history table, by lowercased name.
+func (r *SQLiteRepository) historyColumns() (map[string]string, error) {
+	return r.tableColumns(r.history_table)
+}
+
+// tableColumns returns the lowercased types of the columns of the table, by lowercased name. Returns no
+// column if the table does not exist.
+func (r *SQLiteRepository) tableColumns(table string) (map[string]string, error) {
+	rows, err := r.queriable.QueryContext(r.ctx, "SELECT name, type FROM pragma_table_info(?);", table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := map[string]string{}
+	for rows.Next() {
+		var column, columnType string
+		err = rows.Scan(&column, &columnType)
+		if err != nil {
+			return nil, err
+		}
+		columns[strings.ToLower(column)] = strings.ToLower(columnType)
+	}
+
+	return columns, rows.Err()
+}
+
+// CopyHistoryFrom replaces the rows of the history table with the rows of the table.
+func (r *SQLiteRepository) CopyHistoryFrom(table string) (int64, error) {
+	return r.copyHistory(table, r.history_table)
+}
+
+// CopyHistoryTo replaces the rows of the table with the rows of the history table.
+func (r *SQLiteRepository) CopyHistoryTo(table string) (int64, error) {
+	return r.copyHistory(r.history_table, table)
+}
+
+// copyHistory replaces the rows of the history table to with the rows of the history table from, in a
+// transaction.
+func (r *SQLiteRepository) copyHistory(from string, to string) (int64, error) {
+	if from == to {
+		return 0, fmt.Errorf("can not copy history table %s to itself", from)
+	}
+
+	fromColumns, err := r.tableColumns(from)
+	if err != nil {
+		return 0, err
+	}
+	if len(fromColumns) == 0 {
+		return 0, fmt.Errorf("history table %s does not exist", from)
+	}
+
+	toColumns, err := r.tableColumns(to)
+	if err != nil {
+		return 0, err
+	}
+	if len(toColumns) == 0 {
+		return 0, fmt.Errorf("history table %s does not exist", to)
+	}
+
+	columns, values := database.HistoryCopyColumns(history_schema, fromColumns, toColumns)
+
+	copied := int64(0)
+	err = r.inTransaction(func() error {
+		_, err := r.queriable.ExecContext(r.ctx, fmt.Sprintf("DELETE FROM %s;", to))
+		if err != nil {
+			return err
+		}
+
+		result, err := r.queriable.ExecContext(r.ctx, fmt.Sprintf(`
+			INSERT INTO %s (%s)
+			SELECT %s FROM %s;
+		`, to, strings.Join(columns, ", "), strings.Join(values, ", "), from))
+		if err != nil {
+			return err
+		}
+
+		copied, err = result.RowsAffected()
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return copied, nil
+}
+
+// CheckHistorySchema compares the columns of the history table with the ones of history_schema, before
+// anything is recorded in it.
+func (r *SQLiteRepository) CheckHistorySchema() error {
+	exists, err := r.CheckSchemaHistoryTable()
+	if err != nil || !exists {
+		return err
+	}
+
+	columns, err := r.historyColumns()
+	if err != nil {
+		return err
+	}
+
+	return database.CompareHistoryColumns(r.history_table, columns, history_schema,
+		func(column *database.HistoryColumn, missing bool) string {
+			if missing {
+				return fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s;", r.history_table, column.Name, column.Definition)
+			}
+			return "" // The types of the columns can not be altered
+		})
+}
+
+func (r *SQLiteRepository) CheckSchemaHistoryTable() (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM sqlite_master
+			WHERE type = 'table' AND name = ?
+		);
+	`
+
+	exists := false
+	err := r.queriable.QueryRowContext(r.ctx, query, r.history_table).Scan(&exists)
+	if err != nil {
+		return false, err
+	}
+
+	return exists, nil
+}
+
+func (r *SQLiteRepository) ValidateMigrations(migrations []*migrations.Migration) []error {
+	if len(migrations) < 1 {
+		return nil
+	}
+
+	tableExists, err := r.CheckSchemaHistoryTable()
+	if err != nil {
+		return []error{err}
+	}
+
+	if !tableExists {
+		return nil
+	}
+
+	local := make(map[uint16]bool, len(migrations))
+	for _, migration := range migrations {
+		if migration.Type != enums.MIGRATION_UP {
+			return []error{fmt.Errorf("invalid migration type: %s", migration.Type.Name())}
+		}
+		local[migration.Version] = true
+	}
+
+	// Check gaps
+	query := fmt.Sprintf(`
+		SELECT version, description, md5_checksum, success FROM %s ORDER BY version ASC;
+	`, r.history_table)
+
+	versionsRows, err := r.queriable.QueryContext(r.ctx, query)
+	if err != nil {
+		return []error{err}
+	}
+	defer versionsRows.Close()
+
+	errs := make([]error, 0)
+	mismatches := make([]*database.MismatchError, 0)
+	expectedVersion := uint16(1)
+
+	for versionsRows.Next() {
+		applied, success := new(database.MismatchError), false
+		err = versionsRows.Scan(&applied.Version, &applied.Description, &applied.Checksum, &success)
+		if err != nil {
+			return []error{err}
+		}
+
+		if expectedVersion != applied.Version {
+			errs = append(errs, &database.MissingVersionError{Version: expectedVersion})
+		}
+
+		expectedVersion = applied.Version + 1
+
+		// Applied migrations missing locally mismatch
+		if success && !local[applied.Version] {
+			mismatches = append(mismatches, applied)
+		}
+	}
+
+	if err := versionsRows.Err(); err != nil {
+		return []error{err}
+	}
+	versionsRows.Close() // A connection runs a single query at a time, e.g. in a transaction
+
+	// Check description or checksum mismatch, joining the local migrations in batches
+	for _, batch := range database.Batches(migrations, batch_size) {
+		values := make([]string, 0, len(batch))
+		params := make([]any, 0, len(batch)*3)
+		for _, migration := range batch {
+			values = append(values, "(?, ?, ?)")
+			params = append(params, migration.Version, migration.Description, *migration.Checksum)
+		}
+
+		query = fmt.Sprintf(`
+			WITH l (version, description, md5_checksum) AS (VALUES %s)
+			SELECT h.version, h.description, h.md5_checksum
+			FROM %s h
+			JOIN l ON l.version = h.version
+			WHERE h.success = true AND (h.description <> l.description OR h.md5_checksum <> l.md5_checksum);
+		`, strings.Join(values, ", "), r.history_table)
+
+		rows, err := r.queriable.QueryContext(r.ctx, query, params...)
+		if err != nil {
+			return []error{err}
+		}
+
+		for rows.Next() {
+			mismatch := new(database.MismatchError)
+			err := rows.Scan(&mismatch.Version, &mismatch.Description, &mismatch.Checksum)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+
+			mismatches = append(mismatches, mismatch)
+		}
+
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return []error{err}
+		}
+	}
+
+	sort.Slice(mismatches, func(i, j int) bool {
+		return mismatches[i].Version < mismatches[j].Version
+	})
+	for _, mismatch := range mismatches {
+		errs = append(errs, mismatch)
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (r *SQLiteRepository) ExecuteMigration(migration *migrations.Migration) []error {
+	if migration.Type != enums.MIGRATION_UP {
+		return []error{fmt.Errorf("invalid migration type: %s", migration.Type.Name())}
+	}
+
+	errs := make([]error, 0)
+
+	_, err := r.queriable.ExecContext(r.ctx, *migration.Content)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	success := err == nil
+
+	err = r.saveHistory(migration, success, false)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("migration %d: %w", migration.Version, err))
+	} else {
+		err = r.audit(migration, database.AUDIT_UP, success)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("migration %d: %w", migration.Version, err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// saveHistory upserts the migration in the history table with the given status, and whether it was skipped
+// without being executed, ranked after the executions already recorded.
+func (r *SQLiteRepository) saveHistory(migration *migrations.Migration, success bool, skipped bool) error {
+	query := fmt.Sprintf(`
+		INSERT INTO %s (version, description, md5_checksum, success, run_id, author, ticket, installed_rank, skipped)
+		VALUES (?, ?, ?, ?, NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''),
+			(SELECT COALESCE(MAX(installed_rank), 0) + 1 FROM %s), ?)
+		ON CONFLICT (version)
+		DO UPDATE SET description = excluded.description, md5_checksum = excluded.md5_checksum,
+			success = excluded.success, run_id = excluded.run_id, author = excluded.author,
+			ticket = excluded.ticket, installed_rank = excluded.installed_rank, skipped = excluded.skipped,
+			executed_at = CURRENT_TIMESTAMP;
+	`, r.history_table, r.history_table)
+
+	_, err := r.queriable.ExecContext(r.ctx, query, migration.Version, migration.Description,
+		migration.Checksum, success, r.run.ID, migration.Author, migration.Ticket, skipped)
+	return err
+}
+
+// SkipMigration records the migration as applied and skipped in the history table without executing it, and
+// records the skip in the audit table.
+func (r *SQLiteRepository) SkipMigration(migration *migrations.Migration) error {
+	if migration.Type != enums.MIGRATION_UP {
+		return fmt.Errorf("invalid migration type: %s", migration.Type.Name())
+	}
+
+	err := r.saveHistory(migration, true, true)
+	if err != nil {
+		return fmt.Errorf("migration %d: %w", migration.Version, err)
+	}
+
+	return r.audit(migration, database.AUDIT_SKIP, true)
+}
+
+func (r *SQLiteRepository) ExecuteHook(hook *migrations.Hook) error {
+	_, err := r.queriable.ExecContext(r.ctx, *hook.Content)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *SQLiteRepository) ExecuteAssertion(hook *migrations.Hook) error {
+	rows, err := r.queriable.QueryContext(r.ctx, *hook.Content)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+
+	rowsCount := 0
+	isBool, isTrue := false, false
+	for rows.Next() {
+		rowsCount++
+		if rowsCount == 1 && len(columns) == 1 {
+			var value any
+			if err := rows.Scan(&value); err != nil {
+				return err
+			}
+			isTrue, isBool = boolValue(value)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if rowsCount == 0 || (rowsCount == 1 && isTrue) {
+		return nil
+	}
+
+	if rowsCount == 1 && isBool {
+		return fmt.Errorf("assertion failed: query returned false")
+	}
+
+	return fmt.Errorf("assertion failed: query returned %d rows", rowsCount)
+}
+
+// boolValue returns the boolean of a value returned by the database. SQLite has no boolean type, and
+// comparisons return the integers 1 (true) and 0 (false).
+func boolValue(value any) (isTrue bool, isBool bool) {
+	switch v := value.(type) {
+	case bool:
+		return v, true
+	case int64:
+		return v == 1, v == 0 || v == 1
+	}
+	return false, false
+}
+
+func (r *SQLiteRepository) RollbackMigration(migration *migrations.Migration) error {
+	if migration.Type != enums.MIGRATION_DOWN {
+		return fmt.Errorf("invalid migration type: %s", migration.Type.Name())
+	}
+
+	query := fmt.Sprintf(`
+		SELECT EXISTS (
+			SELECT version FROM %s WHERE version = ?
+		);
+	`, r.history_table)
+
+	exists := false
+	err := r.queriable.QueryRowContext(r.ctx, query, migration.Version).Scan(&exists)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return nil
+	}
+
+	_, err = r.queriable.ExecContext(r.ctx, *migration.Content)
+	if err != nil {
+		return err
+	}
+
+	query = fmt.Sprintf(`
+		DELETE FROM %s
+		WHERE version = ?;
+	`, r.history_table)
+
+	res, err := r.queriable.ExecContext(r.ctx, query, migration.Version)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected < 1 {
+		return fmt.Errorf("version was not deleted from \"%s\" table", r.history_table)
+	}
+
+	return r.audit(migration, database.AUDIT_DOWN, true)
+}
+
+// ServerInfo returns the version of the SQLite library and the path of the database file as schema.
+func (r *SQLiteRepository) ServerInfo() (*database.ServerInfo, error) {
+	info := &database.ServerInfo{HistoryTable: r.history_table}
+
+	err := r.queriable.QueryRowContext(r.ctx, "SELECT 'SQLite ' || sqlite_version();").Scan(&info.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	info.Schema, err = r.databaseFile()
+	if err != nil {
+		return nil, err
+	}
+	if info.Schema == "" {
+		info.Schema = "main" // In-memory database
+	}
+
+	info.HistoryTableExists, err = r.CheckSchemaHistoryTable()
+	if err != nil || !info.HistoryTableExists {
+		return info, err
+	}
+
+	query := fmt.Sprintf("SELECT COUNT(*) FROM %s;", r.history_table)
+	err = r.queriable.QueryRowContext(r.ctx, query).Scan(&info.HistoryRows)
+	if err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
+
+// databaseFile returns the path of the file of the main database, empty for in-memory databases.
+func (r *SQLiteRepository) databaseFile() (string, error) {
+	file := ""
+	err := r.queriable.QueryRowContext(r.ctx, `
+		SELECT file FROM pragma_database_list WHERE name = 'main';
+	`).Scan(&file)
+	return file, err
+}
+
+func (r *SQLiteRepository) Capabilities() database.Capabilities {
+	return database.Capabilities{
+		SupportsTransactions:   true,
+		SupportsAdvisoryLock:   false,
+		SupportsMultiStatement: true,
+		MaxIdentifierLength:    0,
+	}
+}
+
+func (r *SQLiteRepository) SetRunInfo(info database.RunInfo) {
+	r.run = info
+}
+
+func (r *SQLiteRepository) auditTable() string {
+	return r.history_table + "_audit"
+}
+
+// audit records the execution of the migration in the audit table.
+func (r *SQLiteRepository) audit(migration *migrations.Migration, direction string, success bool) error {
+	query := fmt.Sprintf(`
+		INSERT INTO %s (run_id, maestro_version, direction, version, description, success)
+		VALUES (?, ?, ?, ?, ?, ?);
+	`, r.auditTable())
+
+	_, err := r.queriable.ExecContext(r.ctx, query, r.run.ID, r.run.MaestroVersion, direction,
+		migration.Version, migration.Description, success)
+	if err != nil {
+		return fmt.Errorf("error recording audit: %w", err)
+	}
+
+	return nil
+}
+
+func (r *SQLiteRepository) DoInTransaction(fn func() error) error {
+	tx, err := r.db.BeginTx(r.ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		tx.Rollback()
+		r.queriable = r.db // Always reset queriable to db
+	}()
+
+	r.queriable = tx
+
+	err = fn()
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *SQLiteRepository) DoOutsideTransaction(fn func() error) error {
+	if _, ok := r.queriable.(*sql.Tx); ok && database.SingleConnection(r.db) {
+		return errors.New("cannot run outside of the transaction with a single connection")
+	}
+
+	queriable := r.queriable
+	defer func() {
+		r.queriable = queriable
+	}()
+
+	r.queriable = r.db
+
+	return fn()
+}
+
+// Session returns a repository sharing the connections of this one, with its own transaction and run info.
+func (r *SQLiteRepository) Session() database.Repository {
+	session := *r
+	session.queriable = r.db // Outside of the transaction of this repository
+	return &session
+}
+
+// lockContent is the content of the lock file, describing its holder.
+type lockContent struct {
+	RunID    string    `json:"run_id"`
+	PID      int       `json:"pid"`
+	Host     string    `json:"host"` // Lock identity of the run, or host name
+	LockedAt time.Time `json:"locked_at"`
+}
+
+// lockFile returns the path of the lock file of the history table, next to the database file, so the
+// migrations of several history tables of the same database do not block each other. It is empty for
+// in-memory databases, which are only reachable from this process.
+func (r *SQLiteRepository) lockFile() (string, error) {
+	file, err := r.databaseFile()
+	if err != nil || file == "" {
+		return "", err
+	}
+
+	if r.history_table == default_history_table {
+		return file + "." + lock_file_suffix, nil
+	}
+	return file + "." + r.history_table + "_lock", nil
+}
+
+// GetLockInfo reports whether the lock file exists, and the run, process and host holding it.
+func (r *SQLiteRepository) GetLockInfo() (*database.LockInfo, error) {
+	path, err := r.lockFile()
+	if err != nil || path == "" {
+		return &database.LockInfo{}, err
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &database.LockInfo{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	info := &database.LockInfo{Locked: true}
+
+	// The holder is unknown while it writes the file
+	content := lockContent{}
+	if json.Unmarshal(data, &content) == nil {
+		info.Owner = fmt.Sprintf("run %s, pid %d on %s", content.RunID, content.PID, content.Host)
+		info.LockedAt = &content.LockedAt
+	}
+
+	return info, nil
+}
+
+func (r *SQLiteRepository) DoInLock(fn func() error) error {
+	path, err := r.lockFile()
+	if err != nil {
+		return err
+	}
+
+	if path == "" {
+		return fn()
+	}
+
+	err = r.lock(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = os.Remove(path)
+		if err != nil {
+			panic(fmt.Errorf("failed to delete lock file: %w", err))
+		}
+	}()
+
+	err = fn()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// lock creates the lock file, which fails if it exists. If it exists, it waits for up to 1 minute for the
+// file to be deleted by another process, indicating that the migration process has completed.
+func (r *SQLiteRepository) lock(path string) error {
+	content, err := json.Marshal(&lockContent{RunID: r.run.ID, PID: os.Getpid(), Host: r.run.Holder(),
+		LockedAt: time.Now()})
+	if err != nil {
+		return err
+	}
+
+	for range 12 {
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if errors.Is(err, fs.ErrExist) {
+			time.Sleep(time.Second * 5) // Delays 5 seconds
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		_, err = file.Write(content)
+		closeErr := file.Close()
+		if err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(path)
+			return err
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("timeout while waiting for %s deletion", path)
+}
+
+func (r *SQLiteRepository) Repair(migrations []*migrations.Migration) []error {
+	tableExists, err := r.CheckSchemaHistoryTable()
+	if err != nil {
+		return []error{err}
+	}
+
+	if !tableExists {
+		return nil
+	}
+
+	err = r.inTransaction(func() error {
+		// The migrations missing from the history are ranked after the executions already recorded
+		rank, recorded, err := database.HistoryRanks(r.ctx, r.queriable, r.history_table)
+		if err != nil {
+			return err
+		}
+
+		for _, batch := range database.Batches(migrations, batch_size) {
+			values := make([]string, 0, len(batch))
+			args := make([]any, 0, len(batch)*4)
+			for range batch {
+				values = append(values, "(?, ?, ?, true, CURRENT_TIMESTAMP, ?)")
+			}
+			for _, migration := range batch {
+				migrationRank := sql.NullInt64{}
+				if !recorded[migration.Version] {
+					rank++
+					migrationRank = sql.NullInt64{Int64: rank, Valid: true}
+				}
+				args = append(args, migration.Version, migration.Description, *migration.Checksum, migrationRank)
+			}
+
+			// The WHERE clause of the VALUES select resolves the ambiguity of ON CONFLICT with VALUES.
+			// Recorded migrations keep their rank.
+			query := fmt.Sprintf(`
+				INSERT INTO %s (version, description, md5_checksum, success, repaired_at, installed_rank)
+				SELECT * FROM (VALUES %s) WHERE true
+				ON CONFLICT (version) DO UPDATE
+				SET description = excluded.description, md5_checksum = excluded.md5_checksum,
+					repaired_at = CASE
+						WHEN excluded.description <> %s.description OR excluded.md5_checksum <> %s.md5_checksum
+						THEN CURRENT_TIMESTAMP
+						ELSE %s.repaired_at
+					END;
+			`, r.history_table, strings.Join(values, ", "), r.history_table, r.history_table, r.history_table)
+
+			_, err := r.queriable.ExecContext(r.ctx, query, args...)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return []error{err}
+	}
+
+	return nil
+}
+
+// inTransaction runs the callback in the transaction started by DoInTransaction, or in a new one.
+func (r *SQLiteRepository) inTransaction(fn func() error) error {
+	if _, ok := r.queriable.(*sql.Tx); ok {
+		return fn()
+	}
+	return r.DoInTransaction(fn)
+}
+
+// Annotate sets the note of the version in the notes column of the history table, added if missing.
+func (r *SQLiteRepository) Annotate(version uint16, note string) error {
+	exists, err := r.CheckSchemaHistoryTable()
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return fmt.Errorf("version %d: %w", version, database.ErrNotApplied)
+	}
+
+	// History tables created by previous versions have no notes column
+	err = r.upgradeHistoryTable()
+	if err != nil {
+		return err
+	}
+
+	query := fmt.Sprintf(`
+		UPDATE %s SET notes = NULLIF(?, '') WHERE version = ?;
+	`, r.history_table)
+
+	res, err := r.queriable.ExecContext(r.ctx, query, note, version)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected < 1 {
+		return fmt.Errorf("version %d: %w", version, database.ErrNotApplied)
+	}
+
+	return nil
+}
+
+func (r *SQLiteRepository) GetFailingMigrations() ([]*migrations.Migration, error) {
+	exists, err := r.CheckSchemaHistoryTable()
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		return nil, nil
+	}
+
+	query := fmt.Sprintf(`
+		SELECT version, description, md5_checksum
+		FROM %s
+		WHERE success = false
+		ORDER BY version ASC;
+	`, r.history_table)
+
+	rows, err := r.queriable.QueryContext(r.ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var failingMigrations []*migrations.Migration
+	for rows.Next() {
+		var migration migrations.Migration
+		if err := rows.Scan(&migration.Version, &migration.Description, &migration.Checksum); err != nil {
+			return nil, err
+		}
+		failingMigrations = append(failingMigrations, &migration)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return failingMigrations, nil
+}
+
+func (r *SQLiteRepository) GetAppliedMigrations() ([]*database.AppliedMigration, error) {
+	exists, err := r.CheckSchemaHistoryTable()
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		return nil, nil
+	}
+
+	// History tables created by previous versions have no author, ticket, installed_rank and skipped columns
+	// until the next run
+	columns, err := r.historyColumns()
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := "'', ''"
+	_, author := columns["author"]
+	_, ticket := columns["ticket"]
+	if author && ticket {
+		metadata = "COALESCE(author, ''), COALESCE(ticket, '')"
+	}
+
+	rank := "0"
+	if _, ok := columns["installed_rank"]; ok {
+		rank = "COALESCE(installed_rank, 0)"
+	}
+
+	skipped := "false"
+	if _, ok := columns["skipped"]; ok {
+		skipped = "skipped"
+	}
+
+	// Execution times are formatted with database.EXECUTED_AT_LAYOUT, as drivers scan timestamps differently
+	query := fmt.Sprintf(`
+		SELECT version, description, md5_checksum, success, %s, %s, %s,
+			COALESCE(strftime('%%Y-%%m-%%d %%H:%%M:%%S', executed_at), '')
+		FROM %s
+		ORDER BY version ASC;
+	`, metadata, rank, skipped, r.history_table)
+
+	rows, err := r.queriable.QueryContext(r.ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make([]*database.AppliedMigration, 0)
+	for rows.Next() {
+		migration, executedAt := new(database.AppliedMigration), ""
+		err := rows.Scan(&migration.Version, &migration.Description, &migration.Checksum, &migration.Success,
+			&migration.Author, &migration.Ticket, &migration.InstalledRank, &migration.Skipped, &executedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		migration.ExecutedAt, err = database.ParseExecutedAt(executedAt)
+		if err != nil {
+			return nil, err
+		}
+		applied = append(applied, migration)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return applied, nil
+}
+
+// Clean drops the views, triggers and tables of the main database. The foreign keys are not checked while
+// the tables are dropped, so they are dropped in any order.
+func (r *SQLiteRepository) Clean() error {
+	query := `
+		SELECT type, name FROM sqlite_master
+		WHERE type IN ('view', 'trigger', 'table') AND name NOT LIKE 'sqlite\_%' ESCAPE '\'
+		ORDER BY CASE type WHEN 'view' THEN 0 WHEN 'trigger' THEN 1 ELSE 2 END;
+	`
+
+	rows, err := r.queriable.QueryContext(r.ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	statements := make([]string, 0)
+	for rows.Next() {
+		kind, name := "", ""
+		if err := rows.Scan(&kind, &name); err != nil {
+			return err
+		}
+		statements = append(statements, fmt.Sprintf("DROP %s IF EXISTS %s;", strings.ToUpper(kind),
+			quoteIdentifier(name)))
+	}
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	if len(statements) == 0 {
+		return nil
+	}
+
+	// The foreign keys pragma has no effect in a transaction, where the checks are deferred to the commit
+	script := "PRAGMA defer_foreign_keys = ON;\n" + strings.Join(statements, "\n")
+
+	return r.inTransaction(func() error {
+		_, err := r.queriable.ExecContext(r.ctx, script)
+		if err != nil {
+			return fmt.Errorf("error dropping the objects of the database: %w", err)
+		}
+		return nil
+	})
+}
+
+func quoteIdentifier(identifier string) string {
+	return `"` + strings.ReplaceAll(identifier, `"`, `""`) + `"`
+}
@@ -0,0 +1,693 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/maestro-go/maestro/core/database"
+	"github.com/maestro-go/maestro/core/enums"
+	"github.com/maestro-go/maestro/internal/conf"
+	"github.com/maestro-go/maestro/internal/migrations"
+	testUtils "github.com/maestro-go/maestro/internal/utils/testing"
+	"github.com/stretchr/testify/suite"
+
+	_ "modernc.org/sqlite"
+)
+
+type MigrationTestSuite struct {
+	suite.Suite
+	path    string
+	suiteDb *sql.DB
+
+	ctx context.Context
+
+	repository *SQLiteRepository
+}
+
+func (s *MigrationTestSuite) SetupSuite() {
+	s.ctx = context.Background()
+
+	s.path = filepath.Join(s.T().TempDir(), "test.db")
+
+	db, err := sql.Open("sqlite", "file:"+s.path+"?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)")
+	s.Require().NoError(err)
+
+	s.suiteDb = db
+
+	s.repository = NewSQLiteRepository(s.ctx, db, testUtils.ToPtr(default_history_table))
+}
+
+func (s *MigrationTestSuite) TearDownSuite() {
+	s.suiteDb.Close()
+}
+
+func (s *MigrationTestSuite) TearDownTest() {
+	err := s.repository.Clean()
+	s.Assert().NoError(err)
+}
+
+func (s *MigrationTestSuite) checkTableExists(table string, shouldExist bool) {
+	s.T().Helper()
+
+	query := `
+		SELECT EXISTS (
+			SELECT name FROM sqlite_master
+			WHERE type IN ('table', 'view') AND name = ?
+		);
+	`
+
+	exists := false
+	err := s.suiteDb.QueryRowContext(s.ctx, query, table).Scan(&exists)
+	s.Assert().NoError(err)
+	s.Assert().Equal(shouldExist, exists)
+}
+
+func TestMigrationSuite(t *testing.T) {
+	suite.Run(t, new(MigrationTestSuite))
+}
+
+func (s *MigrationTestSuite) TestAssertSchemaHistoryTable() {
+	err := s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+
+	s.checkTableExists(default_history_table, true)
+
+	// Existing tables are kept
+	err = s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+}
+
+func (s *MigrationTestSuite) TestCheckSchemaHistoryTable() {
+	exists, err := s.repository.CheckSchemaHistoryTable()
+	s.Assert().NoError(err)
+	s.Assert().False(exists)
+
+	err = s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+
+	exists, err = s.repository.CheckSchemaHistoryTable()
+	s.Assert().NoError(err)
+	s.Assert().True(exists)
+}
+
+func (s *MigrationTestSuite) TestCheckHistorySchema() {
+	// Missing tables are created by AssertSchemaHistoryTable
+	err := s.repository.CheckHistorySchema()
+	s.Assert().NoError(err)
+
+	err = s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+
+	err = s.repository.CheckHistorySchema()
+	s.Assert().NoError(err)
+
+	// Tables of previous versions lack optional columns only
+	_, err = s.suiteDb.ExecContext(s.ctx, fmt.Sprintf("ALTER TABLE %s DROP COLUMN ticket;", default_history_table))
+	s.Require().NoError(err)
+
+	err = s.repository.CheckHistorySchema()
+	s.Assert().NoError(err)
+
+	// Missing columns are reported with the statements adding them
+	_, err = s.suiteDb.ExecContext(s.ctx, fmt.Sprintf("ALTER TABLE %s DROP COLUMN md5_checksum;", default_history_table))
+	s.Require().NoError(err)
+
+	err = s.repository.CheckHistorySchema()
+	s.Assert().EqualError(err, "schema history table schema_history is not compatible with maestro "+conf.VERSION+
+		": column md5_checksum is missing. Upgrade it with: ALTER TABLE schema_history ADD COLUMN md5_checksum "+
+		"TEXT NOT NULL DEFAULT '';")
+
+	// Columns of incompatible types can not be altered
+	_, err = s.suiteDb.ExecContext(s.ctx, fmt.Sprintf(`
+		DROP TABLE %[1]s;
+		CREATE TABLE %[1]s (version TEXT PRIMARY KEY, description TEXT, md5_checksum TEXT, success BOOLEAN,
+			executed_at TIMESTAMP, repaired_at TIMESTAMP);
+	`, default_history_table))
+	s.Require().NoError(err)
+
+	err = s.repository.CheckHistorySchema()
+	s.Assert().EqualError(err, "schema history table schema_history is not compatible with maestro "+conf.VERSION+
+		": column version has type text instead of an integer type. Recreate it with the expected columns, or "+
+		"configure another history-table")
+
+	var schemaErr *database.HistorySchemaError
+	s.Assert().ErrorAs(err, &schemaErr)
+}
+
+func (s *MigrationTestSuite) TestGetLatestMigration() {
+	version, err := s.repository.GetLatestMigration()
+	s.Assert().NoError(err)
+	s.Assert().Equal(uint16(0), version)
+
+	err = s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+
+	version, err = s.repository.GetLatestMigration()
+	s.Assert().NoError(err)
+	s.Assert().Equal(uint16(0), version)
+
+	query := fmt.Sprintf(`
+		INSERT INTO %s (version, description, md5_checksum, success) VALUES
+			(1, 't', '0a52730597fb4ffa01fc117d9e71e3a9', true),
+			(5, 't', '0a52730597fb4ffa01fc117d9e71e3a9', true),
+			(7, 't', '0a52730597fb4ffa01fc117d9e71e3a9', false);
+	`, default_history_table)
+
+	_, err = s.suiteDb.Exec(query)
+	s.Assert().NoError(err)
+
+	version, err = s.repository.GetLatestMigration()
+	s.Assert().NoError(err)
+	s.Assert().Equal(uint16(5), version)
+}
+
+func (s *MigrationTestSuite) TestValidateMigrations() {
+	checksums := []string{"0a52730597fb4ffa01fc117d9e71e3a9", "3d41c8443df34e73867adb149efbb2ea"}
+	contents := []string{"EXAMPLE CONTENT 1", "EXAMPLE CONTENT 2"}
+	migrations := []*migrations.Migration{
+		{
+			Version:     1,
+			Description: "abcd",
+			Type:        enums.MIGRATION_UP,
+			Checksum:    &checksums[0],
+			Content:     &contents[0],
+		},
+		{
+			Version:     2,
+			Description: "abcd",
+			Type:        enums.MIGRATION_UP,
+			Checksum:    &checksums[1],
+			Content:     &contents[1],
+		},
+	}
+
+	errs := s.repository.ValidateMigrations(migrations)
+	s.Assert().Nil(errs)
+
+	err := s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+
+	errs = s.repository.ValidateMigrations(migrations)
+	s.Assert().Nil(errs)
+
+	query := fmt.Sprintf(`
+		INSERT INTO %s (version, description, md5_checksum, success) VALUES
+			(?, ?, ?, true);
+	`, default_history_table)
+
+	_, err = s.suiteDb.ExecContext(s.ctx, query, migrations[1].Version,
+		migrations[1].Description, migrations[1].Checksum)
+	s.Assert().NoError(err)
+
+	errs = s.repository.ValidateMigrations(migrations)
+	s.Assert().Len(errs, 1)
+
+	_, err = s.suiteDb.ExecContext(s.ctx, query, migrations[0].Version,
+		migrations[0].Description, migrations[0].Checksum)
+	s.Assert().NoError(err)
+
+	errs = s.repository.ValidateMigrations(migrations)
+	s.Assert().Nil(errs)
+
+	query = fmt.Sprintf(`
+		UPDATE %s SET md5_checksum = ? WHERE version = ?;
+	`, default_history_table)
+
+	_, err = s.suiteDb.ExecContext(s.ctx, query, checksums[0], migrations[1].Version)
+	s.Assert().NoError(err)
+
+	errs = s.repository.ValidateMigrations(migrations)
+	s.Assert().Len(errs, 1)
+}
+
+func (s *MigrationTestSuite) TestExecuteMigration() {
+	checksum := "0a52730597fb4ffa01fc117d9e71e3a9"
+	content := "INVALID SQL"
+	migration := &migrations.Migration{
+		Version:     1,
+		Description: "abcd",
+		Type:        enums.MIGRATION_UP,
+		Checksum:    &checksum,
+		Content:     &content,
+		Author:      "Jane Doe <jane@example.com>",
+		Ticket:      "OPS-123",
+	}
+
+	// Invalid SQL
+	errs := s.repository.ExecuteMigration(migration)
+	s.Assert().Len(errs, 2)
+
+	*migration.Content = "CREATE TABLE test (id INT NOT NULL PRIMARY KEY);"
+
+	// No schema table
+	errs = s.repository.ExecuteMigration(migration)
+	s.Assert().Len(errs, 1)
+
+	err := s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+
+	// Several statements, with a trigger, are sent at once
+	*migration.Content = `
+		CREATE TABLE test2 (id INT NOT NULL PRIMARY KEY);
+		CREATE TABLE test2_log (id INT NOT NULL);
+		CREATE TRIGGER test2_insert AFTER INSERT ON test2
+		BEGIN
+			INSERT INTO test2_log VALUES (new.id);
+		END;
+		INSERT INTO test2 VALUES (1);
+	`
+
+	errs = s.repository.ExecuteMigration(migration)
+	s.Assert().Nil(errs)
+
+	s.checkTableExists(default_history_table, true)
+	s.checkTableExists("test2", true)
+
+	logged := 0
+	err = s.suiteDb.QueryRowContext(s.ctx, "SELECT COUNT(*) FROM test2_log;").Scan(&logged)
+	s.Assert().NoError(err)
+	s.Assert().Equal(1, logged)
+
+	applied, err := s.repository.GetAppliedMigrations()
+	s.Assert().NoError(err)
+	s.Require().Len(applied, 1)
+	s.Assert().Equal(migration.Version, applied[0].Version)
+	s.Assert().Equal(migration.Description, applied[0].Description)
+	s.Assert().Equal(*migration.Checksum, applied[0].Checksum)
+	s.Assert().True(applied[0].Success)
+	s.Assert().Equal(migration.Author, applied[0].Author)
+	s.Assert().Equal(migration.Ticket, applied[0].Ticket)
+}
+
+func (s *MigrationTestSuite) TestSkipMigration() {
+	checksum := "0a52730597fb4ffa01fc117d9e71e3a9"
+	content := "CREATE TABLE test (id INT NOT NULL PRIMARY KEY);"
+	migration := &migrations.Migration{
+		Version:     1,
+		Description: "abcd",
+		Type:        enums.MIGRATION_UP,
+		Checksum:    &checksum,
+		Content:     &content,
+	}
+
+	err := s.repository.AssertSchemaHistoryTable()
+	s.Require().NoError(err)
+
+	err = s.repository.SkipMigration(migration)
+	s.Assert().NoError(err)
+
+	// The migration is recorded as applied and skipped, without being executed
+	s.checkTableExists("test", false)
+
+	applied, err := s.repository.GetAppliedMigrations()
+	s.Assert().NoError(err)
+	s.Require().Len(applied, 1)
+	s.Assert().True(applied[0].Success)
+	s.Assert().True(applied[0].Skipped)
+
+	errs := s.repository.ExecuteMigration(migration)
+	s.Assert().Nil(errs)
+
+	applied, err = s.repository.GetAppliedMigrations()
+	s.Assert().NoError(err)
+	s.Require().Len(applied, 1)
+	s.Assert().False(applied[0].Skipped)
+
+	// Tables of previous versions have no skipped migrations
+	_, err = s.suiteDb.ExecContext(s.ctx, fmt.Sprintf("ALTER TABLE %s DROP COLUMN skipped;", default_history_table))
+	s.Require().NoError(err)
+
+	applied, err = s.repository.GetAppliedMigrations()
+	s.Assert().NoError(err)
+	s.Require().Len(applied, 1)
+	s.Assert().False(applied[0].Skipped)
+
+	err = s.repository.AssertSchemaHistoryTable()
+	s.Require().NoError(err)
+
+	err = s.repository.SkipMigration(migration)
+	s.Assert().NoError(err)
+
+	applied, err = s.repository.GetAppliedMigrations()
+	s.Assert().NoError(err)
+	s.Require().Len(applied, 1)
+	s.Assert().True(applied[0].Skipped)
+}
+
+func (s *MigrationTestSuite) TestInstalledRank() {
+	checksums := []string{"0a52730597fb4ffa01fc117d9e71e3a9", "3d41c8443df34e73867adb149efbb2ea"}
+	contents := []string{"SELECT 1;", "SELECT 2;"}
+	migrations := []*migrations.Migration{
+		{Version: 1, Description: "abcd", Type: enums.MIGRATION_UP, Checksum: &checksums[0], Content: &contents[0]},
+		{Version: 2, Description: "abcd", Type: enums.MIGRATION_UP, Checksum: &checksums[1], Content: &contents[1]},
+	}
+
+	err := s.repository.AssertSchemaHistoryTable()
+	s.Require().NoError(err)
+
+	ranks := func() map[uint16]int64 {
+		applied, err := s.repository.GetAppliedMigrations()
+		s.Require().NoError(err)
+
+		ranks := map[uint16]int64{}
+		for _, migration := range applied {
+			ranks[migration.Version] = migration.InstalledRank
+		}
+		return ranks
+	}
+
+	// Out of order executions keep their order
+	errs := s.repository.ExecuteMigration(migrations[1])
+	s.Require().Nil(errs)
+	errs = s.repository.ExecuteMigration(migrations[0])
+	s.Require().Nil(errs)
+	s.Assert().Equal(map[uint16]int64{1: 2, 2: 1}, ranks())
+
+	// Repaired versions keep their rank
+	*migrations[1].Checksum = "d41d8cd98f00b204e9800998ecf8427e"
+	errs = s.repository.Repair(migrations)
+	s.Require().Nil(errs)
+	s.Assert().Equal(map[uint16]int64{1: 2, 2: 1}, ranks())
+
+	// Executed again, versions are ranked last
+	errs = s.repository.ExecuteMigration(migrations[1])
+	s.Require().Nil(errs)
+	s.Assert().Equal(map[uint16]int64{1: 2, 2: 3}, ranks())
+
+	// Missing versions inserted by the repair are ranked last
+	missing := *migrations[0]
+	missing.Version = 3
+	errs = s.repository.Repair(append(migrations, &missing))
+	s.Require().Nil(errs)
+	s.Assert().Equal(map[uint16]int64{1: 2, 2: 3, 3: 4}, ranks())
+
+	// Tables of previous versions are ranked in the order of the executions
+	_, err = s.suiteDb.ExecContext(s.ctx, fmt.Sprintf(`
+		ALTER TABLE %[1]s DROP COLUMN installed_rank;
+		UPDATE %[1]s SET executed_at = '2024-01-01 00:00:00' WHERE version = 2;
+	`, default_history_table))
+	s.Require().NoError(err)
+	s.Assert().Equal(map[uint16]int64{1: 0, 2: 0, 3: 0}, ranks())
+
+	err = s.repository.AssertSchemaHistoryTable()
+	s.Require().NoError(err)
+	s.Assert().Equal(map[uint16]int64{1: 2, 2: 1, 3: 3}, ranks())
+}
+
+func (s *MigrationTestSuite) TestCopyHistory() {
+	// History table of a previous version, without the optional columns
+	_, err := s.suiteDb.ExecContext(s.ctx, `
+		CREATE TABLE old_history (
+			version INTEGER NOT NULL PRIMARY KEY,
+			description TEXT NOT NULL,
+			md5_checksum TEXT NOT NULL,
+			success BOOLEAN NOT NULL DEFAULT false,
+			executed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			repaired_at TIMESTAMP
+		);
+		INSERT INTO old_history (version, description, md5_checksum, success, executed_at) VALUES
+			(1, 'abcd', 'checksum', true, '2024-01-02 00:00:00'), (2, 'efgh', 'checksum', false, '2024-01-01 00:00:00');
+	`)
+	s.Require().NoError(err)
+
+	_, err = s.repository.CopyHistoryFrom("old_history")
+	s.Assert().EqualError(err, "history table schema_history does not exist")
+
+	err = s.repository.AssertSchemaHistoryTable()
+	s.Require().NoError(err)
+
+	copied, err := s.repository.CopyHistoryFrom("old_history")
+	s.Require().NoError(err)
+	s.Assert().Equal(int64(2), copied)
+
+	applied, err := s.repository.GetAppliedMigrations()
+	s.Require().NoError(err)
+	s.Assert().Equal([]*database.AppliedMigration{
+		{Version: 1, Description: "abcd", Checksum: "checksum", Success: true, InstalledRank: 2,
+			ExecutedAt: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{Version: 2, Description: "efgh", Checksum: "checksum", Success: false, InstalledRank: 1,
+			ExecutedAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}, applied)
+
+	// The previous table is kept in sync, replacing its rows
+	_, err = s.suiteDb.ExecContext(s.ctx, fmt.Sprintf("DELETE FROM %s WHERE version = 2;", default_history_table))
+	s.Require().NoError(err)
+
+	copied, err = s.repository.CopyHistoryTo("old_history")
+	s.Require().NoError(err)
+	s.Assert().Equal(int64(1), copied)
+
+	rows := 0
+	err = s.suiteDb.QueryRowContext(s.ctx, "SELECT COUNT(*) FROM old_history;").Scan(&rows)
+	s.Assert().NoError(err)
+	s.Assert().Equal(1, rows)
+
+	_, err = s.repository.CopyHistoryTo(default_history_table)
+	s.Assert().EqualError(err, "can not copy history table schema_history to itself")
+}
+
+func (s *MigrationTestSuite) TestExecuteAssertion() {
+	content := "SELECT 1 = 1"
+	hook := &migrations.Hook{
+		Order:   1,
+		Content: &content,
+		Type:    enums.HOOK_ASSERTION,
+	}
+
+	err := s.repository.ExecuteAssertion(hook)
+	s.Assert().NoError(err)
+
+	*hook.Content = "SELECT 1 = 2"
+	err = s.repository.ExecuteAssertion(hook)
+	s.Assert().ErrorContains(err, "returned false")
+
+	*hook.Content = "SELECT 1 FROM sqlite_master WHERE false"
+	err = s.repository.ExecuteAssertion(hook)
+	s.Assert().NoError(err)
+}
+
+func (s *MigrationTestSuite) TestRollbackMigration() {
+	content := "INVALID SQL"
+	migration := &migrations.Migration{
+		Version:     1,
+		Description: "abcd",
+		Type:        enums.MIGRATION_DOWN,
+		Content:     &content,
+	}
+
+	err := s.repository.RollbackMigration(migration)
+	s.Assert().Error(err)
+
+	*migration.Content = "DROP TABLE IF EXISTS test4;"
+
+	err = s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+
+	// Versions not applied are not rolled back
+	err = s.repository.RollbackMigration(migration)
+	s.Assert().NoError(err)
+
+	_, err = s.suiteDb.ExecContext(s.ctx, "CREATE TABLE test4 (id INT NOT NULL PRIMARY KEY);")
+	s.Assert().NoError(err)
+	_, err = s.suiteDb.ExecContext(s.ctx, fmt.Sprintf(`
+		INSERT INTO %s (version, description, md5_checksum, success)
+		VALUES (1, 'abcd', '0a52730597fb4ffa01fc117d9e71e3a9', true);
+	`, default_history_table))
+	s.Assert().NoError(err)
+
+	s.checkTableExists("test4", true)
+
+	err = s.repository.RollbackMigration(migration)
+	s.Assert().NoError(err)
+
+	s.checkTableExists("test4", false)
+
+	version, err := s.repository.GetLatestMigration()
+	s.Assert().NoError(err)
+	s.Assert().Equal(uint16(0), version)
+}
+
+func (s *MigrationTestSuite) TestDoInTransaction() {
+	// DDL statements are rolled back too
+	err := s.repository.DoInTransaction(func() error {
+		_, err := s.repository.queriable.ExecContext(s.ctx, "CREATE TABLE test1 (id INT NOT NULL PRIMARY KEY);")
+		s.Assert().NoError(err)
+
+		return fmt.Errorf("example error")
+	})
+	s.Assert().Error(err)
+
+	s.checkTableExists("test1", false)
+
+	s.Assert().True(s.repository.Capabilities().SupportsTransactions)
+}
+
+func (s *MigrationTestSuite) TestDoInLock() {
+	info, err := s.repository.GetLockInfo()
+	s.Assert().NoError(err)
+	s.Assert().False(info.Locked)
+
+	// The lock identity is recorded instead of the host name
+	s.repository.SetRunInfo(database.RunInfo{ID: "run", LockIdentity: "migrate-job-x7k2p"})
+	defer s.repository.SetRunInfo(database.RunInfo{})
+
+	err = s.repository.DoInLock(func() error {
+		info, err := s.repository.GetLockInfo()
+		s.Assert().NoError(err)
+		s.Assert().True(info.Locked)
+		s.Assert().Equal(fmt.Sprintf("run run, pid %d on migrate-job-x7k2p", os.Getpid()), info.Owner)
+		s.Assert().NotNil(info.LockedAt)
+
+		// Other processes can not create the lock file
+		_, err = os.OpenFile(s.path+"."+lock_file_suffix, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		s.Assert().ErrorIs(err, os.ErrExist)
+		return nil
+	})
+	s.Assert().NoError(err)
+
+	info, err = s.repository.GetLockInfo()
+	s.Assert().NoError(err)
+	s.Assert().False(info.Locked)
+
+	s.Assert().NoFileExists(s.path + "." + lock_file_suffix)
+}
+
+func (s *MigrationTestSuite) TestRepair() {
+	checksums := []string{"0a52730597fb4ffa01fc117d9e71e3a9", "3d41c8443df34e73867adb149efbb2ea"}
+	contents := []string{"EXAMPLE CONTENT 1", "EXAMPLE CONTENT 2"}
+	migrations := []*migrations.Migration{
+		{
+			Version:     1,
+			Description: "abcd",
+			Type:        enums.MIGRATION_UP,
+			Checksum:    &checksums[0],
+			Content:     &contents[0],
+		},
+		{
+			Version:     2,
+			Description: "abcd",
+			Type:        enums.MIGRATION_UP,
+			Checksum:    &checksums[1],
+			Content:     &contents[1],
+		},
+	}
+
+	err := s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+
+	// Simulate a checksum mismatch
+	query := fmt.Sprintf(`
+		INSERT INTO %s (version, description, md5_checksum, success) VALUES
+			(?, ?, 'd41d8cd98f00b204e9800998ecf8427e', false);
+	`, default_history_table)
+
+	_, err = s.suiteDb.ExecContext(s.ctx, query, migrations[0].Version, migrations[0].Description)
+	s.Assert().NoError(err)
+
+	errs := s.repository.Repair(migrations)
+	s.Assert().Nil(errs)
+
+	query = fmt.Sprintf(`
+		SELECT md5_checksum, repaired_at IS NOT NULL FROM %s WHERE version = ?;
+	`, default_history_table)
+
+	repairedChecksum, repaired := "", false
+	err = s.suiteDb.QueryRowContext(s.ctx, query, migrations[0].Version).Scan(&repairedChecksum, &repaired)
+	s.Assert().NoError(err)
+	s.Assert().Equal(*migrations[0].Checksum, repairedChecksum)
+	s.Assert().True(repaired)
+
+	// Missing migrations are inserted
+	err = s.suiteDb.QueryRowContext(s.ctx, query, migrations[1].Version).Scan(&repairedChecksum, &repaired)
+	s.Assert().NoError(err)
+	s.Assert().Equal(*migrations[1].Checksum, repairedChecksum)
+}
+
+func (s *MigrationTestSuite) TestAnnotate() {
+	err := s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+
+	err = s.repository.Annotate(1, "note")
+	s.Assert().Error(err)
+
+	_, err = s.suiteDb.ExecContext(s.ctx, fmt.Sprintf(`
+		INSERT INTO %s (version, description, md5_checksum, success)
+		VALUES (1, 'abcd', '0a52730597fb4ffa01fc117d9e71e3a9', true);
+	`, default_history_table))
+	s.Assert().NoError(err)
+
+	err = s.repository.Annotate(1, "note")
+	s.Assert().NoError(err)
+
+	note := ""
+	err = s.suiteDb.QueryRowContext(s.ctx, fmt.Sprintf("SELECT notes FROM %s WHERE version = 1;",
+		default_history_table)).Scan(&note)
+	s.Assert().NoError(err)
+	s.Assert().Equal("note", note)
+}
+
+func (s *MigrationTestSuite) TestGetFailingMigrations() {
+	err := s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+
+	query := fmt.Sprintf(`
+		INSERT INTO %s (version, description, md5_checksum, success) VALUES
+			(1, 't', '0a52730597fb4ffa01fc117d9e71e3a9', false),
+			(2, 't', '0a52730597fb4ffa01fc117d9e71e3a9', true),
+			(3, 't', '0a52730597fb4ffa01fc117d9e71e3a9', false);
+	`, default_history_table)
+
+	_, err = s.suiteDb.Exec(query)
+	s.Assert().NoError(err)
+
+	failingMigrations, err := s.repository.GetFailingMigrations()
+	s.Assert().NoError(err)
+	s.Assert().Len(failingMigrations, 2)
+	s.Assert().Equal(uint16(1), failingMigrations[0].Version)
+	s.Assert().Equal(uint16(3), failingMigrations[1].Version)
+}
+
+func (s *MigrationTestSuite) TestServerInfo() {
+	info, err := s.repository.ServerInfo()
+	s.Assert().NoError(err)
+	s.Assert().Contains(info.Version, "SQLite")
+	s.Assert().Equal(s.path, info.Schema)
+	s.Assert().False(info.HistoryTableExists)
+}
+
+func (s *MigrationTestSuite) TestClean() {
+	err := s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+
+	_, err = s.suiteDb.ExecContext(s.ctx, `
+		CREATE TABLE clean_parent (id INT PRIMARY KEY);
+		CREATE TABLE clean_child (id INT PRIMARY KEY, parent_id INT REFERENCES clean_parent (id));
+		CREATE VIEW clean_view AS SELECT id FROM clean_child;
+		CREATE TRIGGER clean_trigger AFTER INSERT ON clean_parent BEGIN DELETE FROM clean_child; END;
+		INSERT INTO clean_parent VALUES (1);
+		INSERT INTO clean_child VALUES (1, 1);
+	`)
+	s.Require().NoError(err)
+
+	err = s.repository.DoInLock(func() error {
+		return s.repository.Clean()
+	})
+	s.Assert().NoError(err)
+
+	s.checkTableExists(default_history_table, false)
+	s.checkTableExists("clean_parent", false)
+	s.checkTableExists("clean_child", false)
+	s.checkTableExists("clean_view", false)
+
+	objects := 0
+	err = s.suiteDb.QueryRowContext(s.ctx, `
+		SELECT COUNT(*) FROM sqlite_master WHERE name NOT LIKE 'sqlite\_%' ESCAPE '\';
+	`).Scan(&objects)
+	s.Assert().NoError(err)
+	s.Assert().Equal(0, objects)
+}
@@ -0,0 +1,63 @@
+package sqlserver
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// transient_errors are the numbers of the errors raised while Azure SQL reconfigures, fails over or throttles
+// a database, after which the same request succeeds once retried.
+var transient_errors = map[int32]bool{
+	233:   true, // Connection closed by the server
+	4060:  true, // Database unavailable during a reconfiguration
+	4221:  true, // Login to a read secondary failed during a reconfiguration
+	10053: true, // Transport-level error
+	10054: true, // Connection reset by the server
+	10060: true, // Connection timed out
+	10928: true, // Resource limit reached
+	10929: true, // Resource limit reached, minimum guarantee unavailable
+	40143: true, // Request aborted by a failover
+	40197: true, // Service error, e.g. during an upgrade or a failover
+	40501: true, // Service busy
+	40540: true, // Service error processing the request
+	40613: true, // Database unavailable
+	49918: true, // Not enough resources to process the request
+	49919: true, // Too many create or update operations in progress
+	49920: true, // Too many operations in progress
+}
+
+// max_attempts is the number of attempts of a request failing with transient errors.
+const max_attempts = 5
+
+// retry_interval is the delay before the first retry of a request, doubled after each attempt.
+var retry_interval = time.Second
+
+// IsTransientError reports whether the error is an error of SQL Server or Azure SQL after which the same request
+// succeeds once retried.
+func IsTransientError(err error) bool {
+	var sqlErr interface{ SQLErrorNumber() int32 }
+	return errors.As(err, &sqlErr) && transient_errors[sqlErr.SQLErrorNumber()]
+}
+
+// Retry calls fn until it succeeds, fails with an error that is not transient, or failed max_attempts times,
+// waiting longer after each attempt. Only requests that can be repeated may be retried, e.g. opening a
+// connection or starting a transaction.
+func Retry(ctx context.Context, fn func() error) error {
+	interval := retry_interval
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = fn()
+		if err == nil || !IsTransientError(err) || attempt == max_attempts {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return errors.Join(err, ctx.Err())
+		case <-time.After(interval):
+		}
+		interval *= 2
+	}
+}
@@ -0,0 +1,1115 @@
+// Package sqlserver implements the maestro repository for Microsoft SQL Server and Azure SQL.
+//
+// Migration scripts are T-SQL scripts whose batches are separated by GO lines, as with sqlcmd and SSMS:
+// GO is a client command, so the repository sends each batch to the server on its own, in order. Routines,
+// views and triggers must be the first statement of their batch. The history table is created in the
+// default schema of the user (dbo unless configured otherwise), and the queries of the repository use
+// the @p1 parameters of github.com/microsoft/go-mssqldb.
+package sqlserver
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/maestro-go/maestro/core/database"
+	"github.com/maestro-go/maestro/core/enums"
+	"github.com/maestro-go/maestro/internal/conf"
+	"github.com/maestro-go/maestro/internal/migrations"
+)
+
+const default_history_table = "schema_history"
+
+// lock_timeout is the number of milliseconds DoInLock waits for the lock held by another session.
+const lock_timeout = 60000
+
+// lock_prefix is the prefix of the application lock of DoInLock, followed by the history table.
+// Application locks belong to the current database.
+const lock_prefix = "maestro:"
+
+// batch_size is the number of migrations per statement of Repair and ValidateMigrations, keeping
+// the parameters of a statement below the limit of 2100.
+const batch_size = 500
+
+// history_columns are the columns added to the history table after its first release, added by
+// upgradeHistoryTable to the tables created by previous versions.
+var history_columns = []struct{ name, definition string }{
+	{"notes", "NVARCHAR(MAX)"},
+	{"run_id", "VARCHAR(64)"},
+	{"author", "NVARCHAR(255)"},
+	{"ticket", "NVARCHAR(64)"},
+	{"skipped", "BIT NOT NULL DEFAULT 0"},
+}
+
+// SQLServerRepository executes the batches of migration scripts one at a time. DDL statements are
+// transactional, so DoInTransaction rolls back the whole callback if it fails.
+type SQLServerRepository struct {
+	database.Repository
+	ctx           context.Context
+	queriable     database.Queriable
+	db            database.Database
+	history_table string
+	run           database.RunInfo
+	session       int // Session of the transaction of DoInTransaction, 0 outside of it
+}
+
+func NewSQLServerRepository(ctx context.Context, db database.Database, history_table *string) *SQLServerRepository {
+	repo := &SQLServerRepository{
+		ctx:       ctx,
+		queriable: db,
+		db:        db,
+		run:       database.RunInfo{MaestroVersion: conf.VERSION},
+	}
+
+	if history_table != nil {
+		repo.history_table = *history_table
+	} else {
+		repo.history_table = default_history_table
+	}
+
+	return repo
+}
+
+func (r *SQLServerRepository) GetLatestMigration() (uint16, error) {
+	tableExists, err := r.CheckSchemaHistoryTable()
+	if err != nil {
+		return 0, err
+	}
+
+	if !tableExists {
+		return 0, nil
+	}
+
+	query := fmt.Sprintf(`
+		SELECT COALESCE(MAX(version), 0)
+		FROM %s
+		WHERE success = 1;
+	`, r.history_table)
+
+	version := uint16(0)
+	err = r.queriable.QueryRowContext(r.ctx, query).Scan(&version)
+	if err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+func (r *SQLServerRepository) AssertSchemaHistoryTable() error {
+	// Audit tables are also created for history tables of previous versions
+	query := fmt.Sprintf(`
+		IF OBJECT_ID(@p1, 'U') IS NULL
+		CREATE TABLE %s (
+			id BIGINT IDENTITY(1, 1) NOT NULL PRIMARY KEY,
+			run_id VARCHAR(64) NOT NULL,
+			maestro_version VARCHAR(32) NOT NULL,
+			direction VARCHAR(4) NOT NULL,
+			version INT NOT NULL,
+			description NVARCHAR(255) NOT NULL,
+			success BIT NOT NULL,
+			executed_at DATETIME2 NOT NULL DEFAULT SYSDATETIME()
+		);
+	`, r.auditTable())
+
+	_, err := r.queriable.ExecContext(r.ctx, query, r.auditTable())
+	if err != nil {
+		return err
+	}
+
+	exists, err := r.CheckSchemaHistoryTable()
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		return r.upgradeHistoryTable()
+	}
+
+	// Versions are INT, as SMALLINT is signed
+	query = fmt.Sprintf(`
+		CREATE TABLE %s (
+			version INT NOT NULL PRIMARY KEY,
+			description NVARCHAR(255) NOT NULL,
+			md5_checksum CHAR(32) NOT NULL,
+			success BIT NOT NULL DEFAULT 0,
+			executed_at DATETIME2 NOT NULL DEFAULT SYSDATETIME(),
+			repaired_at DATETIME2,
+			notes NVARCHAR(MAX),
+			run_id VARCHAR(64),
+			author NVARCHAR(255),
+			ticket NVARCHAR(64),
+			skipped BIT NOT NULL DEFAULT 0
+		);
+	`, r.history_table)
+
+	_, err = r.queriable.ExecContext(r.ctx, query)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// upgradeHistoryTable adds the columns missing in history tables created by previous versions.
+func (r *SQLServerRepository) upgradeHistoryTable() error {
+	columns, err := r.historyColumns()
+	if err != nil {
+		return err
+	}
+
+	for _, column := range history_columns {
+		if columns[column.name] {
+			continue
+		}
+
+		_, err = r.queriable.ExecContext(r.ctx, fmt.Sprintf(`
+			ALTER TABLE %s ADD %s %s;
+		`, r.history_table, column.name, column.definition))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// historyColumns returns the columns of the history table.
+func (r *SQLServerRepository) historyColumns() (map[string]bool, error) {
+	query := `
+		SELECT name FROM sys.columns WHERE object_id = OBJECT_ID(@p1, 'U');
+	`
+
+	rows, err := r.queriable.QueryContext(r.ctx, query, r.history_table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := map[string]bool{}
+	for rows.Next() {
+		var column string
+		err = rows.Scan(&column)
+		if err != nil {
+			return nil, err
+		}
+		columns[strings.ToLower(column)] = true
+	}
+
+	return columns, rows.Err()
+}
+
+func (r *SQLServerRepository) CheckSchemaHistoryTable() (bool, error) {
+	query := `
+		SELECT CAST(CASE WHEN OBJECT_ID(@p1, 'U') IS NULL THEN 0 ELSE 1 END AS BIT);
+	`
+
+	exists := false
+	err := r.queriable.QueryRowContext(r.ctx, query, r.history_table).Scan(&exists)
+	if err != nil {
+		return false, err
+	}
+
+	return exists, nil
+}
+
+func (r *SQLServerRepository) ValidateMigrations(migrations []*migrations.Migration) []error {
+	if len(migrations) < 1 {
+		return nil
+	}
+
+	tableExists, err := r.CheckSchemaHistoryTable()
+	if err != nil {
+		return []error{err}
+	}
+
+	if !tableExists {
+		return nil
+	}
+
+	local := make(map[uint16]bool, len(migrations))
+	for _, migration := range migrations {
+		if migration.Type != enums.MIGRATION_UP {
+			return []error{fmt.Errorf("invalid migration type: %s", migration.Type.Name())}
+		}
+		local[migration.Version] = true
+	}
+
+	// Check gaps
+	query := fmt.Sprintf(`
+		SELECT version, description, md5_checksum, success FROM %s ORDER BY version ASC;
+	`, r.history_table)
+
+	versionsRows, err := r.queriable.QueryContext(r.ctx, query)
+	if err != nil {
+		return []error{err}
+	}
+	defer versionsRows.Close()
+
+	errs := make([]error, 0)
+	mismatches := make([]*database.MismatchError, 0)
+	expectedVersion := uint16(1)
+
+	for versionsRows.Next() {
+		applied, success := new(database.MismatchError), false
+		err = versionsRows.Scan(&applied.Version, &applied.Description, &applied.Checksum, &success)
+		if err != nil {
+			return []error{err}
+		}
+
+		if expectedVersion != applied.Version {
+			errs = append(errs, &database.MissingVersionError{Version: expectedVersion})
+		}
+
+		expectedVersion = applied.Version + 1
+
+		// Applied migrations missing locally mismatch
+		if success && !local[applied.Version] {
+			mismatches = append(mismatches, applied)
+		}
+	}
+
+	if err := versionsRows.Err(); err != nil {
+		return []error{err}
+	}
+	versionsRows.Close() // A connection runs a single query at a time, e.g. in a transaction
+
+	// Check description or checksum mismatch, joining the local migrations in batches. Descriptions are
+	// compared with a binary collation, as the default collations ignore the case.
+	for _, batch := range database.Batches(migrations, batch_size) {
+		values := make([]string, 0, len(batch))
+		params := make([]any, 0, len(batch)*3)
+		for i, migration := range batch {
+			values = append(values, fmt.Sprintf("(@p%d, @p%d, @p%d)", i*3+1, i*3+2, i*3+3))
+			params = append(params, migration.Version, migration.Description, *migration.Checksum)
+		}
+
+		query = fmt.Sprintf(`
+			SELECT h.version, h.description, h.md5_checksum
+			FROM %s h
+			JOIN (VALUES %s) AS l (version, description, md5_checksum) ON l.version = h.version
+			WHERE h.success = 1 AND (h.description <> l.description COLLATE Latin1_General_BIN2
+				OR h.md5_checksum <> l.md5_checksum);
+		`, r.history_table, strings.Join(values, ", "))
+
+		rows, err := r.queriable.QueryContext(r.ctx, query, params...)
+		if err != nil {
+			return []error{err}
+		}
+
+		for rows.Next() {
+			mismatch := new(database.MismatchError)
+			err := rows.Scan(&mismatch.Version, &mismatch.Description, &mismatch.Checksum)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+
+			mismatches = append(mismatches, mismatch)
+		}
+
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return []error{err}
+		}
+	}
+
+	sort.Slice(mismatches, func(i, j int) bool {
+		return mismatches[i].Version < mismatches[j].Version
+	})
+	for _, mismatch := range mismatches {
+		errs = append(errs, mismatch)
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (r *SQLServerRepository) ExecuteMigration(migration *migrations.Migration) []error {
+	if migration.Type != enums.MIGRATION_UP {
+		return []error{fmt.Errorf("invalid migration type: %s", migration.Type.Name())}
+	}
+
+	errs := make([]error, 0)
+
+	err := r.execScript(*migration.Content, migration.SkipStatements)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	success := err == nil
+
+	err = r.saveHistory(migration, success, false)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("migration %d: %w", migration.Version, err))
+	} else {
+		err = r.audit(migration, database.AUDIT_UP, success)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("migration %d: %w", migration.Version, err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// saveHistory upserts the migration in the history table with the given status, skipped if it was recorded
+// without being executed.
+func (r *SQLServerRepository) saveHistory(migration *migrations.Migration, success bool, skipped bool) error {
+	query := fmt.Sprintf(`
+		UPDATE %[1]s SET description = @p2, md5_checksum = @p3, success = @p4, run_id = NULLIF(@p5, ''),
+			author = NULLIF(@p6, ''), ticket = NULLIF(@p7, ''), skipped = @p8, executed_at = SYSDATETIME()
+		WHERE version = @p1;
+
+		IF @@ROWCOUNT = 0
+		INSERT INTO %[1]s (version, description, md5_checksum, success, run_id, author, ticket, skipped)
+		VALUES (@p1, @p2, @p3, @p4, NULLIF(@p5, ''), NULLIF(@p6, ''), NULLIF(@p7, ''), @p8);
+	`, r.history_table)
+
+	_, err := r.queriable.ExecContext(r.ctx, query, migration.Version, migration.Description,
+		migration.Checksum, success, r.run.ID, migration.Author, migration.Ticket, skipped)
+	return err
+}
+
+// SkipMigration records the migration as applied and skipped in the history table without executing it, and
+// records the skip in the audit table.
+func (r *SQLServerRepository) SkipMigration(migration *migrations.Migration) error {
+	if migration.Type != enums.MIGRATION_UP {
+		return fmt.Errorf("invalid migration type: %s", migration.Type.Name())
+	}
+
+	err := r.saveHistory(migration, true, true)
+	if err != nil {
+		return fmt.Errorf("migration %d: %w", migration.Version, err)
+	}
+
+	return r.audit(migration, database.AUDIT_SKIP, true)
+}
+
+func (r *SQLServerRepository) ExecuteHook(hook *migrations.Hook) error {
+	return r.execScript(*hook.Content, 0)
+}
+
+// execScript executes the batches of a script one at a time, skipping the first ones. Batches are sent
+// without parameters, so their variables are the ones they declare.
+func (r *SQLServerRepository) execScript(script string, skip int) error {
+	for i, batch := range migrations.SplitBatches(script) {
+		if i < skip {
+			continue
+		}
+
+		_, err := r.queriable.ExecContext(r.ctx, batch)
+		if err != nil {
+			return &database.StatementError{Index: i + 1, Err: fmt.Errorf("batch %d (%s): %w", i+1, firstLine(batch), err)}
+		}
+	}
+
+	return nil
+}
+
+func (r *SQLServerRepository) ExecuteAssertion(hook *migrations.Hook) error {
+	rows, err := r.queriable.QueryContext(r.ctx, *hook.Content)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+
+	rowsCount := 0
+	isBool, isTrue := false, false
+	for rows.Next() {
+		rowsCount++
+		if rowsCount == 1 && len(columns) == 1 {
+			var value any
+			if err := rows.Scan(&value); err != nil {
+				return err
+			}
+			isTrue, isBool = boolValue(value)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if rowsCount == 0 || (rowsCount == 1 && isTrue) {
+		return nil
+	}
+
+	if rowsCount == 1 && isBool {
+		return fmt.Errorf("assertion failed: query returned false")
+	}
+
+	return fmt.Errorf("assertion failed: query returned %d rows", rowsCount)
+}
+
+// boolValue returns the boolean of a value returned by the server. T-SQL has no boolean expressions in
+// select lists, so BIT values and the numbers 1 and 0 (e.g. of CASE expressions) are booleans.
+func boolValue(value any) (isTrue bool, isBool bool) {
+	switch v := value.(type) {
+	case bool:
+		return v, true
+	case int64:
+		return v == 1, v == 0 || v == 1
+	}
+	return false, false
+}
+
+func (r *SQLServerRepository) RollbackMigration(migration *migrations.Migration) error {
+	if migration.Type != enums.MIGRATION_DOWN {
+		return fmt.Errorf("invalid migration type: %s", migration.Type.Name())
+	}
+
+	query := fmt.Sprintf(`
+		SELECT CAST(CASE WHEN EXISTS (SELECT version FROM %s WHERE version = @p1) THEN 1 ELSE 0 END AS BIT);
+	`, r.history_table)
+
+	exists := false
+	err := r.queriable.QueryRowContext(r.ctx, query, migration.Version).Scan(&exists)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return nil
+	}
+
+	err = r.execScript(*migration.Content, 0)
+	if err != nil {
+		return err
+	}
+
+	query = fmt.Sprintf(`
+		DELETE FROM %s
+		OUTPUT DELETED.version
+		WHERE version = @p1;
+	`, r.history_table)
+
+	deleted := uint16(0)
+	err = r.queriable.QueryRowContext(r.ctx, query, migration.Version).Scan(&deleted)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("version was not deleted from \"%s\" table", r.history_table)
+	}
+	if err != nil {
+		return err
+	}
+
+	return r.audit(migration, database.AUDIT_DOWN, true)
+}
+
+// ServerInfo returns the version and edition of the server, and the current database and default schema
+// of the user as schema.
+func (r *SQLServerRepository) ServerInfo() (*database.ServerInfo, error) {
+	info := &database.ServerInfo{HistoryTable: r.history_table}
+
+	err := r.queriable.QueryRowContext(r.ctx, `
+		SELECT 'SQL Server ' + CAST(SERVERPROPERTY('ProductVersion') AS NVARCHAR(128)) + ' ' +
+			CAST(SERVERPROPERTY('Edition') AS NVARCHAR(128)), DB_NAME() + '.' + COALESCE(SCHEMA_NAME(), 'dbo');
+	`).Scan(&info.Version, &info.Schema)
+	if err != nil {
+		return nil, err
+	}
+
+	info.HistoryTableExists, err = r.CheckSchemaHistoryTable()
+	if err != nil || !info.HistoryTableExists {
+		return info, err
+	}
+
+	query := fmt.Sprintf("SELECT COUNT_BIG(*) FROM %s;", r.history_table)
+	err = r.queriable.QueryRowContext(r.ctx, query).Scan(&info.HistoryRows)
+	if err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
+
+func (r *SQLServerRepository) Capabilities() database.Capabilities {
+	return database.Capabilities{
+		SupportsTransactions:   true,
+		SupportsAdvisoryLock:   true,
+		SupportsMultiStatement: true, // Each batch is sent at once
+		MaxIdentifierLength:    128,
+	}
+}
+
+func (r *SQLServerRepository) SetRunInfo(info database.RunInfo) {
+	r.run = info
+}
+
+func (r *SQLServerRepository) auditTable() string {
+	return r.history_table + "_audit"
+}
+
+// audit records the execution of the migration in the audit table.
+func (r *SQLServerRepository) audit(migration *migrations.Migration, direction string, success bool) error {
+	query := fmt.Sprintf(`
+		INSERT INTO %s (run_id, maestro_version, direction, version, description, success)
+		VALUES (@p1, @p2, @p3, @p4, @p5, @p6);
+	`, r.auditTable())
+
+	_, err := r.queriable.ExecContext(r.ctx, query, r.run.ID, r.run.MaestroVersion, direction,
+		migration.Version, migration.Description, success)
+	if err != nil {
+		return fmt.Errorf("error recording audit: %w", err)
+	}
+
+	return nil
+}
+
+// DoInTransaction runs the callback in a transaction. Starting the transaction is retried on transient errors,
+// e.g. while Azure SQL fails over, but the callback is never run twice.
+func (r *SQLServerRepository) DoInTransaction(fn func() error) error {
+	var tx *sql.Tx
+	err := Retry(r.ctx, func() error {
+		var err error
+		tx, err = r.db.BeginTx(r.ctx, nil)
+		if err != nil {
+			return err
+		}
+
+		// The session of the transaction is looked up by TransactionActivity, on another connection
+		err = tx.QueryRowContext(r.ctx, "SELECT @@SPID;").Scan(&r.session)
+		if err != nil {
+			tx.Rollback()
+		}
+		return err
+	})
+	if err != nil {
+		r.session = 0
+		return err
+	}
+	defer func() {
+		tx.Rollback()
+		r.queriable = r.db // Always reset queriable to db
+		r.session = 0
+	}()
+
+	r.queriable = tx
+
+	err = fn()
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *SQLServerRepository) DoOutsideTransaction(fn func() error) error {
+	if _, ok := r.queriable.(*sql.Tx); ok && database.SingleConnection(r.db) {
+		return errors.New("cannot run outside of the transaction with a single connection")
+	}
+
+	queriable := r.queriable
+	defer func() {
+		r.queriable = queriable
+	}()
+
+	r.queriable = r.db
+
+	return fn()
+}
+
+// Session returns a repository sharing the connections of this one, with its own transaction and run info.
+func (r *SQLServerRepository) Session() database.Repository {
+	session := *r
+	session.queriable = r.db // Outside of the transaction of this repository
+	session.session = 0
+	return &session
+}
+
+// GetLockInfo reports whether a session holds the application lock, and the session, login and host
+// holding it. The holder is only known with the VIEW SERVER STATE permission.
+func (r *SQLServerRepository) GetLockInfo() (*database.LockInfo, error) {
+	resource := lock_prefix + r.history_table
+
+	free := false
+	err := r.queriable.QueryRowContext(r.ctx, `
+		SELECT CAST(APPLOCK_TEST('public', @p1, 'Exclusive', 'Session') AS BIT);
+	`, resource).Scan(&free)
+	if err != nil {
+		return nil, err
+	}
+
+	if free {
+		return &database.LockInfo{}, nil
+	}
+
+	info := &database.LockInfo{Locked: true}
+
+	allowed := false
+	err = r.queriable.QueryRowContext(r.ctx, `
+		SELECT CAST(COALESCE(HAS_PERMS_BY_NAME(NULL, NULL, 'VIEW SERVER STATE'), 0) AS BIT);
+	`).Scan(&allowed)
+	if err != nil || !allowed {
+		return info, err
+	}
+
+	// Resource descriptions hold the first 32 characters of the name of application locks
+	session, login, host := int64(0), "", ""
+	err = r.queriable.QueryRowContext(r.ctx, `
+		SELECT TOP 1 l.request_session_id, COALESCE(s.login_name, ''), COALESCE(s.host_name, '')
+		FROM sys.dm_tran_locks l
+		LEFT JOIN sys.dm_exec_sessions s ON s.session_id = l.request_session_id
+		WHERE l.resource_type = 'APPLICATION' AND l.resource_database_id = DB_ID()
+			AND l.request_status = 'GRANT' AND CHARINDEX(LEFT(@p1, 32), l.resource_description) > 0;
+	`, resource).Scan(&session, &login, &host)
+	if errors.Is(err, sql.ErrNoRows) {
+		return info, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	info.Owner = fmt.Sprintf("session %d, login %s on %s", session, login, host)
+	return info, nil
+}
+
+// DoInLock takes an exclusive application lock of the session (sp_getapplock), released by the server if
+// the session ends, waiting up to lock_timeout milliseconds for another session to release it. The lock
+// belongs to the session taking it, so the callback runs while the connection taking the lock is reserved.
+// Taking the lock is retried on transient errors.
+func (r *SQLServerRepository) DoInLock(fn func() error) error {
+	resource := lock_prefix + r.history_table
+
+	return r.onConnection(func(conn connection) error {
+		// sp_getapplock returns 0 or 1 once the lock is taken, and a negative status otherwise
+		status := 0
+		err := Retry(r.ctx, func() error {
+			return conn.QueryRowContext(r.ctx, `
+				DECLARE @status INT;
+				EXEC @status = sp_getapplock @Resource = @p1, @LockMode = 'Exclusive', @LockOwner = 'Session',
+					@LockTimeout = @p2;
+				SELECT @status;
+			`, resource, lock_timeout).Scan(&status)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to acquire lock: %w", err)
+		}
+		if status == -1 {
+			return fmt.Errorf("timeout while waiting for the lock of %s", r.history_table)
+		}
+		if status < 0 {
+			return fmt.Errorf("failed to acquire lock: sp_getapplock returned %d", status)
+		}
+		defer func() {
+			_, err = conn.ExecContext(r.ctx, `
+				EXEC sp_releaseapplock @Resource = @p1, @LockOwner = 'Session';
+			`, resource)
+			if err != nil {
+				panic(fmt.Errorf("failed to release lock: %w", err))
+			}
+		}()
+
+		return fn()
+	})
+}
+
+// connection is the part of a database connection used by the statements depending on the state of their session.
+type connection interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// onConnection runs the callback on a connection of the pool reserved until it returns, retrying to reserve it
+// on transient errors. In a transaction, or with a single connection, the callback runs on the connection of
+// the repository. The pool of read-only databases is used too, as the callbacks only take and release locks.
+func (r *SQLServerRepository) onConnection(fn func(conn connection) error) error {
+	pool, ok := database.Pool(r.queriable)
+	if !ok {
+		return fn(r.queriable)
+	}
+	if database.SingleConnection(pool) {
+		return fn(pool)
+	}
+
+	var conn *sql.Conn
+	err := Retry(r.ctx, func() error {
+		var err error
+		conn, err = pool.Conn(r.ctx)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return fn(conn)
+}
+
+// TransactionActivity reports, from the dynamic management views, the activity of the session of the transaction
+// of DoInTransaction, the session blocking it and the tables it holds exclusive (X or Sch-M) locks on. The views
+// require the VIEW SERVER STATE permission, and the queries run on another connection of the pool.
+func (r *SQLServerRepository) TransactionActivity() (*database.TransactionActivity, error) {
+	if r.session == 0 {
+		return nil, nil
+	}
+
+	if database.SingleConnection(r.db) {
+		return nil, errors.New("cannot monitor the transaction with a single connection")
+	}
+
+	session, lockWait, blocker, err := r.sessionActivity(r.session)
+	if err != nil {
+		return nil, err
+	}
+
+	activity := &database.TransactionActivity{
+		SessionActivity: *session,
+		LockWait:        lockWait,
+	}
+
+	if lockWait > 0 && blocker > 0 {
+		blocking, _, _, err := r.sessionActivity(blocker)
+		if err != nil {
+			return nil, err
+		}
+		activity.Blockers = append(activity.Blockers, blocking)
+	}
+
+	rows, err := r.db.QueryContext(r.ctx, `
+		SELECT DISTINCT COALESCE(OBJECT_SCHEMA_NAME(l.resource_associated_entity_id) + '.' +
+			OBJECT_NAME(l.resource_associated_entity_id), CAST(l.resource_associated_entity_id AS NVARCHAR(20)))
+		FROM sys.dm_tran_locks l
+		WHERE l.request_session_id = @p1 AND l.resource_type = 'OBJECT' AND l.resource_database_id = DB_ID()
+			AND l.request_mode IN ('X', 'Sch-M') AND l.request_status = 'GRANT'
+		ORDER BY 1;
+	`, r.session)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		table := ""
+		if err := rows.Scan(&table); err != nil {
+			return nil, err
+		}
+		activity.ExclusiveLocks = append(activity.ExclusiveLocks, table)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return activity, nil
+}
+
+// sessionActivity returns the activity of the session, the time its request has been waiting for a lock, and
+// the session blocking it (0 if none).
+func (r *SQLServerRepository) sessionActivity(id int) (*database.SessionActivity, time.Duration, int, error) {
+	session := &database.SessionActivity{}
+	transactionMillis, lockWaitMillis, blocker := int64(0), int64(0), 0
+
+	// Sessions without request and with open transactions are idle in their transaction
+	err := r.db.QueryRowContext(r.ctx, `
+		SELECT s.session_id, COALESCE(s.login_name, ''),
+			CASE WHEN q.session_id IS NULL AND s.open_transaction_count > 0
+				THEN 'sleeping in transaction' ELSE COALESCE(q.status, s.status) END,
+			COALESCE(DATEDIFF_BIG(MILLISECOND, t.begin_time, SYSDATETIME()), 0),
+			COALESCE(sql_text.text, ''),
+			CASE WHEN q.wait_type LIKE 'LCK[_]%' THEN q.wait_time ELSE 0 END,
+			COALESCE(q.blocking_session_id, 0)
+		FROM sys.dm_exec_sessions s
+		LEFT JOIN sys.dm_exec_connections c ON c.session_id = s.session_id
+		LEFT JOIN sys.dm_exec_requests q ON q.session_id = s.session_id
+		OUTER APPLY (
+			SELECT MIN(a.transaction_begin_time) AS begin_time
+			FROM sys.dm_tran_session_transactions st
+			JOIN sys.dm_tran_active_transactions a ON a.transaction_id = st.transaction_id
+			WHERE st.session_id = s.session_id
+		) t
+		OUTER APPLY sys.dm_exec_sql_text(COALESCE(q.sql_handle, c.most_recent_sql_handle)) sql_text
+		WHERE s.session_id = @p1;
+	`, id).Scan(&session.ID, &session.User, &session.State, &transactionMillis, &session.Query, &lockWaitMillis,
+		&blocker)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, 0, 0, fmt.Errorf("session %d not found in sys.dm_exec_sessions", id)
+	}
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	session.TransactionDuration = time.Duration(transactionMillis) * time.Millisecond
+	return session, time.Duration(lockWaitMillis) * time.Millisecond, blocker, nil
+}
+
+// CancelTransaction kills the session of the transaction of DoInTransaction, as SQL Server can not cancel the
+// request of another session: the server rolls the transaction back and closes the connection.
+func (r *SQLServerRepository) CancelTransaction() error {
+	if r.session == 0 {
+		return errors.New("no transaction to cancel")
+	}
+
+	// KILL does not take parameters
+	_, err := r.db.ExecContext(r.ctx, fmt.Sprintf("KILL %d;", r.session))
+	return err
+}
+
+func (r *SQLServerRepository) Repair(migrations []*migrations.Migration) []error {
+	tableExists, err := r.CheckSchemaHistoryTable()
+	if err != nil {
+		return []error{err}
+	}
+
+	if !tableExists {
+		return nil
+	}
+
+	err = r.inTransaction(func() error {
+		for _, batch := range database.Batches(migrations, batch_size) {
+			values := make([]string, 0, len(batch))
+			args := make([]any, 0, len(batch)*3)
+			for i, migration := range batch {
+				values = append(values, fmt.Sprintf("(@p%d, @p%d, @p%d)", i*3+1, i*3+2, i*3+3))
+				args = append(args, migration.Version, migration.Description, *migration.Checksum)
+			}
+
+			query := fmt.Sprintf(`
+				MERGE %s AS h
+				USING (VALUES %s) AS l (version, description, md5_checksum) ON h.version = l.version
+				WHEN MATCHED AND (h.description <> l.description COLLATE Latin1_General_BIN2
+					OR h.md5_checksum <> l.md5_checksum) THEN
+					UPDATE SET description = l.description, md5_checksum = l.md5_checksum,
+						repaired_at = SYSDATETIME()
+				WHEN NOT MATCHED THEN
+					INSERT (version, description, md5_checksum, success, repaired_at)
+					VALUES (l.version, l.description, l.md5_checksum, 1, SYSDATETIME());
+			`, r.history_table, strings.Join(values, ", "))
+
+			_, err := r.queriable.ExecContext(r.ctx, query, args...)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return []error{err}
+	}
+
+	return nil
+}
+
+// inTransaction runs the callback in the transaction started by DoInTransaction, or in a new one.
+func (r *SQLServerRepository) inTransaction(fn func() error) error {
+	if _, ok := r.queriable.(*sql.Tx); ok {
+		return fn()
+	}
+	return r.DoInTransaction(fn)
+}
+
+// Annotate sets the note of the version in the notes column of the history table, added if missing.
+func (r *SQLServerRepository) Annotate(version uint16, note string) error {
+	exists, err := r.CheckSchemaHistoryTable()
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return fmt.Errorf("version %d: %w", version, database.ErrNotApplied)
+	}
+
+	// History tables created by previous versions have no notes column
+	err = r.upgradeHistoryTable()
+	if err != nil {
+		return err
+	}
+
+	query := fmt.Sprintf(`
+		UPDATE %s SET notes = NULLIF(@p1, '') WHERE version = @p2;
+	`, r.history_table)
+
+	result, err := r.queriable.ExecContext(r.ctx, query, note, version)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return fmt.Errorf("version %d: %w", version, database.ErrNotApplied)
+	}
+
+	return nil
+}
+
+func (r *SQLServerRepository) GetFailingMigrations() ([]*migrations.Migration, error) {
+	exists, err := r.CheckSchemaHistoryTable()
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		return nil, nil
+	}
+
+	query := fmt.Sprintf(`
+		SELECT version, description, md5_checksum
+		FROM %s
+		WHERE success = 0;
+	`, r.history_table)
+
+	rows, err := r.queriable.QueryContext(r.ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var failingMigrations []*migrations.Migration
+	for rows.Next() {
+		var migration migrations.Migration
+		if err := rows.Scan(&migration.Version, &migration.Description, &migration.Checksum); err != nil {
+			return nil, err
+		}
+		failingMigrations = append(failingMigrations, &migration)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return failingMigrations, nil
+}
+
+func (r *SQLServerRepository) GetAppliedMigrations() ([]*database.AppliedMigration, error) {
+	exists, err := r.CheckSchemaHistoryTable()
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		return nil, nil
+	}
+
+	// History tables created by previous versions have no author, ticket and skipped columns until the next
+	// run
+	columns, err := r.historyColumns()
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := "'', ''"
+	if columns["author"] && columns["ticket"] {
+		metadata = "COALESCE(author, ''), COALESCE(ticket, '')"
+	}
+
+	skipped := "CAST(0 AS BIT)"
+	if columns["skipped"] {
+		skipped = "skipped"
+	}
+
+	query := fmt.Sprintf(`
+		SELECT version, description, md5_checksum, success, %s, %s
+		FROM %s
+		ORDER BY version ASC;
+	`, metadata, skipped, r.history_table)
+
+	rows, err := r.queriable.QueryContext(r.ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make([]*database.AppliedMigration, 0)
+	for rows.Next() {
+		migration := new(database.AppliedMigration)
+		err := rows.Scan(&migration.Version, &migration.Description, &migration.Checksum, &migration.Success,
+			&migration.Author, &migration.Ticket, &migration.Skipped)
+		if err != nil {
+			return nil, err
+		}
+		applied = append(applied, migration)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return applied, nil
+}
+
+// Clean drops the foreign keys, views, procedures, tables, functions, sequences, synonyms and types of the
+// default schema of the user, in a single transaction. Foreign keys are dropped first, so tables are
+// dropped in any order.
+func (r *SQLServerRepository) Clean() error {
+	query := `
+		SELECT statement FROM (
+			SELECT 1 AS step, 'ALTER TABLE ' + QUOTENAME(SCHEMA_NAME()) + '.' + QUOTENAME(OBJECT_NAME(parent_object_id)) +
+				' DROP CONSTRAINT ' + QUOTENAME(name) AS statement
+			FROM sys.foreign_keys WHERE schema_id = SCHEMA_ID()
+			UNION ALL
+			SELECT 2, 'DROP VIEW ' + QUOTENAME(SCHEMA_NAME()) + '.' + QUOTENAME(name)
+			FROM sys.views WHERE schema_id = SCHEMA_ID() AND is_ms_shipped = 0
+			UNION ALL
+			SELECT 3, 'DROP PROCEDURE ' + QUOTENAME(SCHEMA_NAME()) + '.' + QUOTENAME(name)
+			FROM sys.procedures WHERE schema_id = SCHEMA_ID() AND is_ms_shipped = 0
+			UNION ALL
+			SELECT 4, 'DROP TABLE ' + QUOTENAME(SCHEMA_NAME()) + '.' + QUOTENAME(name)
+			FROM sys.tables WHERE schema_id = SCHEMA_ID() AND is_ms_shipped = 0
+			UNION ALL
+			SELECT 5, 'DROP FUNCTION ' + QUOTENAME(SCHEMA_NAME()) + '.' + QUOTENAME(name)
+			FROM sys.objects WHERE schema_id = SCHEMA_ID() AND type IN ('FN', 'IF', 'TF') AND is_ms_shipped = 0
+			UNION ALL
+			SELECT 5, 'DROP SEQUENCE ' + QUOTENAME(SCHEMA_NAME()) + '.' + QUOTENAME(name)
+			FROM sys.sequences WHERE schema_id = SCHEMA_ID()
+			UNION ALL
+			SELECT 5, 'DROP SYNONYM ' + QUOTENAME(SCHEMA_NAME()) + '.' + QUOTENAME(name)
+			FROM sys.synonyms WHERE schema_id = SCHEMA_ID()
+			UNION ALL
+			SELECT 6, 'DROP TYPE ' + QUOTENAME(SCHEMA_NAME()) + '.' + QUOTENAME(name)
+			FROM sys.types WHERE schema_id = SCHEMA_ID() AND is_user_defined = 1
+		) AS objects
+		ORDER BY step;
+	`
+
+	rows, err := r.queriable.QueryContext(r.ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	statements := make([]string, 0)
+	for rows.Next() {
+		statement := ""
+		if err := rows.Scan(&statement); err != nil {
+			return err
+		}
+		statements = append(statements, statement)
+	}
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	return r.inTransaction(func() error {
+		for _, statement := range statements {
+			_, err := r.queriable.ExecContext(r.ctx, statement)
+			if err != nil {
+				return fmt.Errorf("error executing %q: %w", statement, err)
+			}
+		}
+		return nil
+	})
+}
+
+func firstLine(statement string) string {
+	line, _, _ := strings.Cut(statement, "\n")
+	return line
+}
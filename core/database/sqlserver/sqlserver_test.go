@@ -0,0 +1,586 @@
+package sqlserver
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/maestro-go/maestro/core/database"
+	"github.com/maestro-go/maestro/core/enums"
+	"github.com/maestro-go/maestro/core/maestrotest"
+	"github.com/maestro-go/maestro/internal/migrations"
+	testUtils "github.com/maestro-go/maestro/internal/utils/testing"
+	mssql "github.com/microsoft/go-mssqldb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type MigrationTestSuite struct {
+	suite.Suite
+	sqlserver *testUtils.SQLServerContainer
+	suiteDb   *sql.DB
+
+	ctx context.Context
+
+	repository *SQLServerRepository
+}
+
+func (s *MigrationTestSuite) SetupSuite() {
+	s.ctx = context.Background()
+
+	s.sqlserver = testUtils.SetupSQLServer(s.T())
+
+	db, err := sql.Open("sqlserver", s.sqlserver.DSN)
+	s.Assert().NoError(err)
+
+	s.suiteDb = db
+
+	s.repository = NewSQLServerRepository(s.ctx, db, testUtils.ToPtr(default_history_table))
+}
+
+func (s *MigrationTestSuite) TearDownTest() {
+	if s.sqlserver != nil {
+		err := s.repository.Clean()
+		s.Assert().NoError(err)
+	}
+}
+
+func (s *MigrationTestSuite) checkTableExists(table string, shouldExist bool) {
+	s.T().Helper()
+
+	exists := false
+	err := s.suiteDb.QueryRowContext(s.ctx, `
+		SELECT CAST(CASE WHEN OBJECT_ID(@p1) IS NULL THEN 0 ELSE 1 END AS BIT);
+	`, table).Scan(&exists)
+	s.Assert().NoError(err)
+	s.Assert().Equal(shouldExist, exists)
+}
+
+func TestMigrationSuite(t *testing.T) {
+	suite.Run(t, new(MigrationTestSuite))
+}
+
+func (s *MigrationTestSuite) TestAssertSchemaHistoryTable() {
+	err := s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+
+	s.checkTableExists(default_history_table, true)
+	s.checkTableExists(default_history_table+"_audit", true)
+
+	// Existing tables are kept
+	err = s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+}
+
+func (s *MigrationTestSuite) TestCheckSchemaHistoryTable() {
+	exists, err := s.repository.CheckSchemaHistoryTable()
+	s.Assert().NoError(err)
+	s.Assert().False(exists)
+
+	err = s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+
+	exists, err = s.repository.CheckSchemaHistoryTable()
+	s.Assert().NoError(err)
+	s.Assert().True(exists)
+}
+
+func (s *MigrationTestSuite) TestGetLatestMigration() {
+	version, err := s.repository.GetLatestMigration()
+	s.Assert().NoError(err)
+	s.Assert().Equal(uint16(0), version)
+
+	err = s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+
+	version, err = s.repository.GetLatestMigration()
+	s.Assert().NoError(err)
+	s.Assert().Equal(uint16(0), version)
+
+	query := fmt.Sprintf(`
+		INSERT INTO %s (version, description, md5_checksum, success) VALUES
+			(1, 't', '0a52730597fb4ffa01fc117d9e71e3a9', 1),
+			(40000, 't', '0a52730597fb4ffa01fc117d9e71e3a9', 1),
+			(40001, 't', '0a52730597fb4ffa01fc117d9e71e3a9', 0);
+	`, default_history_table)
+
+	_, err = s.suiteDb.Exec(query)
+	s.Assert().NoError(err)
+
+	// Versions above the limit of SMALLINT are kept
+	version, err = s.repository.GetLatestMigration()
+	s.Assert().NoError(err)
+	s.Assert().Equal(uint16(40000), version)
+}
+
+func (s *MigrationTestSuite) TestValidateMigrations() {
+	checksums := []string{"0a52730597fb4ffa01fc117d9e71e3a9", "3d41c8443df34e73867adb149efbb2ea"}
+	contents := []string{"EXAMPLE CONTENT 1", "EXAMPLE CONTENT 2"}
+	migrations := []*migrations.Migration{
+		{
+			Version:     1,
+			Description: "abcd",
+			Type:        enums.MIGRATION_UP,
+			Checksum:    &checksums[0],
+			Content:     &contents[0],
+		},
+		{
+			Version:     2,
+			Description: "abcd",
+			Type:        enums.MIGRATION_UP,
+			Checksum:    &checksums[1],
+			Content:     &contents[1],
+		},
+	}
+
+	errs := s.repository.ValidateMigrations(migrations)
+	s.Assert().Nil(errs)
+
+	err := s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+
+	errs = s.repository.ValidateMigrations(migrations)
+	s.Assert().Nil(errs)
+
+	query := fmt.Sprintf(`
+		INSERT INTO %s (version, description, md5_checksum, success) VALUES
+			(@p1, @p2, @p3, 1);
+	`, default_history_table)
+
+	_, err = s.suiteDb.ExecContext(s.ctx, query, migrations[1].Version,
+		migrations[1].Description, migrations[1].Checksum)
+	s.Assert().NoError(err)
+
+	errs = s.repository.ValidateMigrations(migrations)
+	s.Assert().Len(errs, 1)
+
+	_, err = s.suiteDb.ExecContext(s.ctx, query, migrations[0].Version,
+		migrations[0].Description, migrations[0].Checksum)
+	s.Assert().NoError(err)
+
+	errs = s.repository.ValidateMigrations(migrations)
+	s.Assert().Nil(errs)
+
+	// Descriptions differing in case mismatch, whatever the collation
+	query = fmt.Sprintf(`
+		UPDATE %s SET description = 'ABCD' WHERE version = @p1;
+	`, default_history_table)
+
+	_, err = s.suiteDb.ExecContext(s.ctx, query, migrations[1].Version)
+	s.Assert().NoError(err)
+
+	errs = s.repository.ValidateMigrations(migrations)
+	s.Assert().Len(errs, 1)
+}
+
+func (s *MigrationTestSuite) TestExecuteMigration() {
+	checksum := "0a52730597fb4ffa01fc117d9e71e3a9"
+	content := "INVALID SQL"
+	migration := &migrations.Migration{
+		Version:     1,
+		Description: "abcd",
+		Type:        enums.MIGRATION_UP,
+		Checksum:    &checksum,
+		Content:     &content,
+		Author:      "Jane Doe <jane@example.com>",
+		Ticket:      "OPS-123",
+	}
+
+	// Invalid SQL
+	errs := s.repository.ExecuteMigration(migration)
+	s.Assert().Len(errs, 2)
+
+	*migration.Content = "CREATE TABLE test (id INT NOT NULL PRIMARY KEY);"
+
+	// No schema table
+	errs = s.repository.ExecuteMigration(migration)
+	s.Assert().Len(errs, 1)
+
+	err := s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+
+	// Batches are separated by GO lines, a procedure being the first statement of its batch
+	*migration.Content = `
+CREATE TABLE test2 (id INT NOT NULL PRIMARY KEY);
+GO
+CREATE PROCEDURE add_test2 @id INT AS
+BEGIN
+	INSERT INTO test2 VALUES (@id);
+END
+GO
+DECLARE @id INT = 1;
+EXEC add_test2 @id;
+`
+
+	errs = s.repository.ExecuteMigration(migration)
+	s.Assert().Nil(errs)
+
+	s.checkTableExists(default_history_table, true)
+	s.checkTableExists("test2", true)
+
+	applied, err := s.repository.GetAppliedMigrations()
+	s.Assert().NoError(err)
+	s.Require().Len(applied, 1)
+	s.Assert().Equal(migration.Version, applied[0].Version)
+	s.Assert().Equal(migration.Description, applied[0].Description)
+	s.Assert().Equal(*migration.Checksum, applied[0].Checksum)
+	s.Assert().True(applied[0].Success)
+	s.Assert().Equal(migration.Author, applied[0].Author)
+	s.Assert().Equal(migration.Ticket, applied[0].Ticket)
+
+	// The failed batch is reported
+	*migration.Content = "SELECT 1;\nGO\nINVALID SQL"
+
+	errs = s.repository.ExecuteMigration(migration)
+	s.Require().Len(errs, 1)
+
+	var statementErr *database.StatementError
+	s.Require().ErrorAs(errs[0], &statementErr)
+	s.Assert().Equal(2, statementErr.Index)
+}
+
+func (s *MigrationTestSuite) TestExecuteAssertion() {
+	content := "SELECT CAST(1 AS BIT)"
+	hook := &migrations.Hook{
+		Order:   1,
+		Content: &content,
+		Type:    enums.HOOK_ASSERTION,
+	}
+
+	err := s.repository.ExecuteAssertion(hook)
+	s.Assert().NoError(err)
+
+	*hook.Content = "SELECT CASE WHEN 1 = 2 THEN 1 ELSE 0 END"
+	err = s.repository.ExecuteAssertion(hook)
+	s.Assert().ErrorContains(err, "returned false")
+
+	*hook.Content = "SELECT 1 FROM sys.tables WHERE 1 = 0"
+	err = s.repository.ExecuteAssertion(hook)
+	s.Assert().NoError(err)
+}
+
+func (s *MigrationTestSuite) TestRollbackMigration() {
+	content := "INVALID SQL"
+	migration := &migrations.Migration{
+		Version:     1,
+		Description: "abcd",
+		Type:        enums.MIGRATION_DOWN,
+		Content:     &content,
+	}
+
+	err := s.repository.RollbackMigration(migration)
+	s.Assert().Error(err)
+
+	*migration.Content = "DROP TABLE IF EXISTS test4;"
+
+	err = s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+
+	// Versions not applied are not rolled back
+	err = s.repository.RollbackMigration(migration)
+	s.Assert().NoError(err)
+
+	_, err = s.suiteDb.ExecContext(s.ctx, "CREATE TABLE test4 (id INT NOT NULL PRIMARY KEY);")
+	s.Assert().NoError(err)
+	_, err = s.suiteDb.ExecContext(s.ctx, fmt.Sprintf(`
+		INSERT INTO %s (version, description, md5_checksum, success)
+		VALUES (1, 'abcd', '0a52730597fb4ffa01fc117d9e71e3a9', 1);
+	`, default_history_table))
+	s.Assert().NoError(err)
+
+	s.checkTableExists("test4", true)
+
+	err = s.repository.RollbackMigration(migration)
+	s.Assert().NoError(err)
+
+	s.checkTableExists("test4", false)
+
+	version, err := s.repository.GetLatestMigration()
+	s.Assert().NoError(err)
+	s.Assert().Equal(uint16(0), version)
+}
+
+func (s *MigrationTestSuite) TestDoInTransaction() {
+	// DDL statements are rolled back too
+	err := s.repository.DoInTransaction(func() error {
+		_, err := s.repository.queriable.ExecContext(s.ctx, "CREATE TABLE test1 (id INT NOT NULL PRIMARY KEY);")
+		s.Assert().NoError(err)
+
+		return fmt.Errorf("example error")
+	})
+	s.Assert().Error(err)
+
+	s.checkTableExists("test1", false)
+
+	s.Assert().True(s.repository.Capabilities().SupportsTransactions)
+}
+
+func (s *MigrationTestSuite) TestDoInLock() {
+	info, err := s.repository.GetLockInfo()
+	s.Assert().NoError(err)
+	s.Assert().False(info.Locked)
+
+	err = s.repository.DoInLock(func() error {
+		// Other sessions wait for the lock
+		status := 0
+		err := s.suiteDb.QueryRowContext(s.ctx, `
+			DECLARE @status INT;
+			EXEC @status = sp_getapplock @Resource = @p1, @LockMode = 'Exclusive', @LockOwner = 'Session',
+				@LockTimeout = 0;
+			SELECT @status;
+		`, lock_prefix+default_history_table).Scan(&status)
+		s.Assert().NoError(err)
+		s.Assert().Equal(-1, status)
+
+		info, err := s.repository.GetLockInfo()
+		s.Assert().NoError(err)
+		s.Assert().True(info.Locked)
+		s.Assert().Contains(info.Owner, "login sa on")
+		return nil
+	})
+	s.Assert().NoError(err)
+
+	info, err = s.repository.GetLockInfo()
+	s.Assert().NoError(err)
+	s.Assert().False(info.Locked)
+}
+
+func (s *MigrationTestSuite) TestReadOnly() {
+	repository := NewSQLServerRepository(s.ctx, database.ReadOnly(s.suiteDb), testUtils.ToPtr(default_history_table))
+
+	// Writes fail without reaching the server
+	err := repository.AssertSchemaHistoryTable()
+	s.Assert().ErrorIs(err, database.ErrReadOnly)
+	s.checkTableExists(default_history_table, false)
+
+	// Queries and locks still run
+	exists, err := repository.CheckSchemaHistoryTable()
+	s.Assert().NoError(err)
+	s.Assert().False(exists)
+
+	info, err := repository.GetLockInfo()
+	s.Assert().NoError(err)
+	s.Assert().False(info.Locked)
+
+	err = s.repository.AssertSchemaHistoryTable()
+	s.Require().NoError(err)
+
+	content := "CREATE TABLE test1 (id INT);"
+	errs := repository.ExecuteMigration(&migrations.Migration{Version: 1, Description: "test", Type: enums.MIGRATION_UP,
+		Checksum: testUtils.ToPtr("0a52730597fb4ffa01fc117d9e71e3a9"), Content: &content})
+	s.Require().NotEmpty(errs)
+	s.Assert().ErrorIs(errs[0], database.ErrReadOnly)
+
+	version, err := repository.GetLatestMigration()
+	s.Assert().NoError(err)
+	s.Assert().Equal(uint16(0), version)
+}
+
+func (s *MigrationTestSuite) TestRepair() {
+	checksums := []string{"0a52730597fb4ffa01fc117d9e71e3a9", "3d41c8443df34e73867adb149efbb2ea"}
+	contents := []string{"EXAMPLE CONTENT 1", "EXAMPLE CONTENT 2"}
+	migrations := []*migrations.Migration{
+		{
+			Version:     1,
+			Description: "abcd",
+			Type:        enums.MIGRATION_UP,
+			Checksum:    &checksums[0],
+			Content:     &contents[0],
+		},
+		{
+			Version:     2,
+			Description: "abcd",
+			Type:        enums.MIGRATION_UP,
+			Checksum:    &checksums[1],
+			Content:     &contents[1],
+		},
+	}
+
+	err := s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+
+	// Simulate a checksum mismatch
+	query := fmt.Sprintf(`
+		INSERT INTO %s (version, description, md5_checksum, success) VALUES
+			(@p1, @p2, 'd41d8cd98f00b204e9800998ecf8427e', 0);
+	`, default_history_table)
+
+	_, err = s.suiteDb.ExecContext(s.ctx, query, migrations[0].Version, migrations[0].Description)
+	s.Assert().NoError(err)
+
+	errs := s.repository.Repair(migrations)
+	s.Assert().Nil(errs)
+
+	query = fmt.Sprintf(`
+		SELECT md5_checksum, CAST(CASE WHEN repaired_at IS NULL THEN 0 ELSE 1 END AS BIT) FROM %s
+		WHERE version = @p1;
+	`, default_history_table)
+
+	repairedChecksum, repaired := "", false
+	err = s.suiteDb.QueryRowContext(s.ctx, query, migrations[0].Version).Scan(&repairedChecksum, &repaired)
+	s.Assert().NoError(err)
+	s.Assert().Equal(*migrations[0].Checksum, repairedChecksum)
+	s.Assert().True(repaired)
+
+	// Missing migrations are inserted
+	err = s.suiteDb.QueryRowContext(s.ctx, query, migrations[1].Version).Scan(&repairedChecksum, &repaired)
+	s.Assert().NoError(err)
+	s.Assert().Equal(*migrations[1].Checksum, repairedChecksum)
+}
+
+func (s *MigrationTestSuite) TestAnnotate() {
+	err := s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+
+	err = s.repository.Annotate(1, "note")
+	s.Assert().ErrorIs(err, database.ErrNotApplied)
+
+	_, err = s.suiteDb.ExecContext(s.ctx, fmt.Sprintf(`
+		INSERT INTO %s (version, description, md5_checksum, success)
+		VALUES (1, 'abcd', '0a52730597fb4ffa01fc117d9e71e3a9', 1);
+	`, default_history_table))
+	s.Assert().NoError(err)
+
+	err = s.repository.Annotate(1, "note")
+	s.Assert().NoError(err)
+
+	note := ""
+	err = s.suiteDb.QueryRowContext(s.ctx, fmt.Sprintf("SELECT notes FROM %s WHERE version = 1;",
+		default_history_table)).Scan(&note)
+	s.Assert().NoError(err)
+	s.Assert().Equal("note", note)
+}
+
+func (s *MigrationTestSuite) TestGetFailingMigrations() {
+	err := s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+
+	query := fmt.Sprintf(`
+		INSERT INTO %s (version, description, md5_checksum, success) VALUES
+			(1, 't', '0a52730597fb4ffa01fc117d9e71e3a9', 0),
+			(2, 't', '0a52730597fb4ffa01fc117d9e71e3a9', 1),
+			(3, 't', '0a52730597fb4ffa01fc117d9e71e3a9', 0);
+	`, default_history_table)
+
+	_, err = s.suiteDb.Exec(query)
+	s.Assert().NoError(err)
+
+	failingMigrations, err := s.repository.GetFailingMigrations()
+	s.Assert().NoError(err)
+	s.Assert().Len(failingMigrations, 2)
+	s.Assert().Equal(uint16(1), failingMigrations[0].Version)
+	s.Assert().Equal(uint16(3), failingMigrations[1].Version)
+}
+
+func (s *MigrationTestSuite) TestClean() {
+	err := s.repository.AssertSchemaHistoryTable()
+	s.Assert().NoError(err)
+
+	hook := `
+CREATE SEQUENCE clean_seq;
+CREATE TABLE clean_parent (id INT PRIMARY KEY);
+CREATE TABLE clean_child (id INT PRIMARY KEY, parent_id INT REFERENCES clean_parent (id));
+GO
+CREATE VIEW clean_view AS SELECT id FROM clean_child;
+GO
+CREATE FUNCTION clean_function() RETURNS INT AS BEGIN RETURN 1 END;
+GO
+CREATE TYPE clean_type FROM NVARCHAR(10);
+`
+	err = s.repository.ExecuteHook(&migrations.Hook{Content: &hook})
+	s.Require().NoError(err)
+
+	err = s.repository.DoInLock(func() error {
+		return s.repository.Clean()
+	})
+	s.Assert().NoError(err)
+
+	s.checkTableExists(default_history_table, false)
+	s.checkTableExists("clean_parent", false)
+	s.checkTableExists("clean_child", false)
+	s.checkTableExists("clean_view", false)
+	s.checkTableExists("clean_seq", false)
+	s.checkTableExists("clean_function", false)
+
+	types := 0
+	err = s.suiteDb.QueryRowContext(s.ctx, `
+		SELECT COUNT(*) FROM sys.types WHERE is_user_defined = 1 AND schema_id = SCHEMA_ID();
+	`).Scan(&types)
+	s.Assert().NoError(err)
+	s.Assert().Equal(0, types)
+}
+
+func (s *MigrationTestSuite) TestRunConcurrent() {
+	maestrotest.RunConcurrent(s.T(), 4, &maestrotest.Config{
+		NewRepository: func(t testing.TB) database.Repository {
+			db, err := sql.Open("sqlserver", s.sqlserver.DSN)
+			s.Require().NoError(err)
+			t.Cleanup(func() { db.Close() })
+
+			return NewSQLServerRepository(s.ctx, db, testUtils.ToPtr(default_history_table))
+		},
+		Migrations: []string{
+			"CREATE TABLE concurrent1 (id INT PRIMARY KEY);",
+			"CREATE TABLE concurrent2 (id INT PRIMARY KEY);",
+			"CREATE TABLE concurrent3 (id INT PRIMARY KEY);",
+		},
+	})
+}
+
+func TestIsTransientError(t *testing.T) {
+	assert.True(t, IsTransientError(mssql.Error{Number: 40613, Message: "Database is not currently available"}))
+	assert.True(t, IsTransientError(fmt.Errorf("failed to acquire lock: %w", mssql.Error{Number: 40501})))
+	assert.False(t, IsTransientError(mssql.Error{Number: 2714, Message: "There is already an object named"}))
+	assert.False(t, IsTransientError(errors.New("connection refused")))
+	assert.False(t, IsTransientError(nil))
+}
+
+func TestRetry(t *testing.T) {
+	interval := retry_interval
+	retry_interval = time.Millisecond
+	defer func() { retry_interval = interval }()
+
+	// Transient errors are retried until the request succeeds
+	attempts := 0
+	err := Retry(context.Background(), func() error {
+		attempts++
+		if attempts < 3 {
+			return mssql.Error{Number: 40613}
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, attempts)
+
+	// Other errors are not retried
+	attempts = 0
+	err = Retry(context.Background(), func() error {
+		attempts++
+		return mssql.Error{Number: 2714}
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 1, attempts)
+
+	// Transient errors fail after max_attempts
+	attempts = 0
+	err = Retry(context.Background(), func() error {
+		attempts++
+		return mssql.Error{Number: 40501}
+	})
+	assert.True(t, IsTransientError(err))
+	assert.Equal(t, max_attempts, attempts)
+
+	// Retries stop once the context is done
+	ctx, cancel := context.WithCancel(context.Background())
+	attempts = 0
+	err = Retry(ctx, func() error {
+		attempts++
+		cancel()
+		return mssql.Error{Number: 40501}
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 1, attempts)
+}
@@ -0,0 +1,16 @@
+package database
+
+// StatementError is the error of a script executed one statement at a time, e.g. by databases without
+// transactional DDL, reporting which statement failed.
+type StatementError struct {
+	Index int // 1-based index of the failed statement in the script
+	Err   error
+}
+
+func (e *StatementError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *StatementError) Unwrap() error {
+	return e.Err
+}
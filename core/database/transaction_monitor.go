@@ -0,0 +1,36 @@
+package database
+
+import "time"
+
+// SessionActivity is the activity of a session of the database, as reported by its activity views.
+type SessionActivity struct {
+	ID                  int // Process or session ID
+	User                string
+	State               string        // e.g. active, or idle in transaction
+	TransactionDuration time.Duration // Time since the transaction of the session started, 0 outside of a transaction
+	Query               string        // Running or last statement of the session
+}
+
+// TransactionActivity is the state of the transaction started by DoInTransaction, observed from another
+// connection while the migrations run.
+type TransactionActivity struct {
+	SessionActivity
+	LockWait       time.Duration      // Time the running statement has been waiting for a lock, 0 if it is not waiting
+	Blockers       []*SessionActivity // Sessions holding the locks the statement waits for
+	ExclusiveLocks []string           // Tables locked exclusively by the transaction, blocking their readers
+}
+
+// TransactionMonitor is a repository able to observe, on another connection, the transaction started by
+// DoInTransaction while its callback runs, and to cancel it.
+type TransactionMonitor interface {
+	Repository
+
+	// TransactionActivity returns the activity of the transaction started by DoInTransaction, nil outside of a
+	// transaction. It is called concurrently with the queries of the callback of DoInTransaction.
+	TransactionActivity() (*TransactionActivity, error)
+
+	// CancelTransaction cancels the statement running in the transaction started by DoInTransaction, so it
+	// fails and the transaction is rolled back. It is called concurrently with the queries of the callback of
+	// DoInTransaction.
+	CancelTransaction() error
+}
@@ -0,0 +1,222 @@
+package trino
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const statement_api = "/v1/statement"
+
+// retry_interval is the delay before retrying a request the coordinator could not serve (HTTP 502, 503 or 504),
+// as required by the client protocol.
+const retry_interval = 50 * time.Millisecond
+
+const max_retries = 100
+
+// queryResults is a page of the results of a statement of the client protocol. The statement is running while
+// NextURI is set.
+type queryResults struct {
+	ID      string `json:"id"`
+	NextURI string `json:"nextUri"`
+	Columns []struct {
+		Name string `json:"name"`
+		Type string `json:"type"`
+	} `json:"columns"`
+	Data  [][]any `json:"data"`
+	Stats struct {
+		State string `json:"state"`
+	} `json:"stats"`
+	Error *struct {
+		Message   string `json:"message"`
+		ErrorName string `json:"errorName"`
+		ErrorType string `json:"errorType"`
+	} `json:"error"`
+	UpdateType  string `json:"updateType"`
+	UpdateCount *int64 `json:"updateCount"`
+}
+
+// statementError is the error of a failed statement.
+type statementError struct {
+	name    string
+	message string
+}
+
+func (e *statementError) Error() string {
+	return fmt.Sprintf("%s: %s", e.name, e.message)
+}
+
+// client executes statements on a coordinator through the client REST protocol. Every statement is executed
+// and committed on its own, as the protocol has no transaction outside of explicit sessions.
+type client struct {
+	http     *http.Client
+	url      string
+	user     string
+	password string
+	catalog  string
+	schema   string
+
+	// headerPrefix is the prefix of the protocol headers: "X-Trino-" or, for Presto, "X-Presto-".
+	headerPrefix string
+}
+
+// query executes the statement and returns its rows, with NULL values as nil. Values are returned as strings,
+// and the column types of the result are returned in the same order as the values.
+func (c *client) query(ctx context.Context, statement string) ([][]*string, []string, error) {
+	rows, types, _, err := c.execute(ctx, statement)
+	return rows, types, err
+}
+
+// exec executes the statement and returns the number of rows it inserted, updated or deleted, 0 for the other
+// statements.
+func (c *client) exec(ctx context.Context, statement string) (int64, error) {
+	_, _, count, err := c.execute(ctx, statement)
+	return count, err
+}
+
+func (c *client) execute(ctx context.Context, statement string) ([][]*string, []string, int64, error) {
+	results, err := c.do(ctx, http.MethodPost, c.url+statement_api, statement)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	rows := make([][]*string, 0)
+	types := make([]string, 0)
+	count := int64(0)
+
+	for {
+		if len(types) == 0 {
+			for _, column := range results.Columns {
+				types = append(types, column.Type)
+			}
+		}
+
+		for _, values := range results.Data {
+			row, err := rowStrings(values)
+			if err != nil {
+				return nil, nil, 0, err
+			}
+			rows = append(rows, row)
+		}
+
+		if results.UpdateCount != nil {
+			count = *results.UpdateCount
+		}
+
+		if results.Error != nil {
+			return nil, nil, 0, &statementError{name: results.Error.ErrorName, message: results.Error.Message}
+		}
+
+		if results.NextURI == "" {
+			break
+		}
+
+		results, err = c.do(ctx, http.MethodGet, results.NextURI, "")
+		if err != nil {
+			return nil, nil, 0, err
+		}
+	}
+
+	return rows, types, count, nil
+}
+
+func (c *client) do(ctx context.Context, method string, url string, body string) (*queryResults, error) {
+	for range max_retries {
+		request, err := http.NewRequestWithContext(ctx, method, url, strings.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+
+		request.Header.Set(c.headerPrefix+"User", c.user)
+		request.Header.Set(c.headerPrefix+"Source", "maestro")
+		if c.catalog != "" {
+			request.Header.Set(c.headerPrefix+"Catalog", c.catalog)
+		}
+		if c.schema != "" {
+			request.Header.Set(c.headerPrefix+"Schema", c.schema)
+		}
+		if c.password != "" {
+			request.SetBasicAuth(c.user, c.password)
+		}
+
+		response, err := c.http.Do(request)
+		if err != nil {
+			return nil, err
+		}
+
+		content, err := io.ReadAll(response.Body)
+		response.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		switch response.StatusCode {
+		case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(retry_interval):
+			}
+			continue
+		}
+
+		if response.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("%s %s: %s: %s", method, request.URL.Path, http.StatusText(response.StatusCode),
+				strings.TrimSpace(string(content)))
+		}
+
+		// Numbers are kept as written, so BIGINT and DECIMAL values are not rounded
+		results := new(queryResults)
+		decoder := json.NewDecoder(bytes.NewReader(content))
+		decoder.UseNumber()
+		return results, decoder.Decode(results)
+	}
+
+	return nil, fmt.Errorf("%s %s: coordinator unavailable after %d attempts", method, url, max_retries)
+}
+
+// rowStrings returns the values of a row as strings, with NULL values as nil. Arrays, maps and rows are returned
+// as JSON.
+func rowStrings(values []any) ([]*string, error) {
+	row := make([]*string, 0, len(values))
+	for _, value := range values {
+		var text string
+		switch typed := value.(type) {
+		case nil:
+			row = append(row, nil)
+			continue
+		case string:
+			text = typed
+		case json.Number:
+			text = typed.String()
+		case bool:
+			text = fmt.Sprint(typed)
+		default:
+			content, err := json.Marshal(typed)
+			if err != nil {
+				return nil, err
+			}
+			text = string(content)
+		}
+		row = append(row, &text)
+	}
+	return row, nil
+}
+
+// literal returns the string as a SQL literal. Trino strings have no backslash escapes, only doubled quotes.
+func literal(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
+// nullableLiteral returns the string as a SQL literal, or NULL if it is empty.
+func nullableLiteral(value string) string {
+	if value == "" {
+		return "NULL"
+	}
+	return literal(value)
+}
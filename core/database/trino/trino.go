@@ -0,0 +1,787 @@
+// Package trino implements the maestro repository for Trino and Presto, executing migrations (e.g. the DDL of
+// lakehouse schemas) on the configured catalog through the client REST protocol.
+//
+// The schema history is stored in tables of a writable connector, supporting row updates and deletes (e.g.
+// Iceberg, Delta Lake or a PostgreSQL catalog): the configured catalog and schema, or the ones of a qualified
+// history table ("catalog.schema.table"). A lock table next to the history table coordinates concurrent
+// executions. Trino has no transactions across statements, so failed migrations are recorded in the history and
+// must be fixed and repaired manually.
+package trino
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/maestro-go/maestro/core/database"
+	"github.com/maestro-go/maestro/core/enums"
+	"github.com/maestro-go/maestro/internal/conf"
+	"github.com/maestro-go/maestro/internal/migrations"
+)
+
+const default_history_table = "schema_history"
+const lock_table = "schema_lock"
+
+// default_user is the user of the requests if none is configured, as the protocol requires one.
+const default_user = "maestro"
+
+// table_already_exists is the suffix of the error names of existing tables: TABLE_ALREADY_EXISTS with Trino,
+// ALREADY_EXISTS with Presto.
+const table_already_exists = "ALREADY_EXISTS"
+
+type TrinoRepository struct {
+	database.Repository
+	ctx     context.Context
+	client  *client
+	history tableName
+	run     database.RunInfo
+}
+
+// NewTrinoRepository returns a repository executing statements on the Trino coordinator of the given URL (e.g.
+// "http://localhost:8080") as the given user, authenticated with the password if not empty. Statements are
+// executed on the given catalog and schema. The history table may be qualified with its catalog and schema
+// ("catalog.schema.table") to store the history in another connector.
+func NewTrinoRepository(ctx context.Context, httpClient *http.Client, url string, user string, password string,
+	catalog string, schema string, history_table *string) *TrinoRepository {
+
+	return newRepository(ctx, httpClient, url, user, password, catalog, schema, history_table, "X-Trino-")
+}
+
+// NewPrestoRepository returns a repository like NewTrinoRepository for a Presto coordinator, which uses the
+// headers of the protocol before Trino.
+func NewPrestoRepository(ctx context.Context, httpClient *http.Client, url string, user string, password string,
+	catalog string, schema string, history_table *string) *TrinoRepository {
+
+	return newRepository(ctx, httpClient, url, user, password, catalog, schema, history_table, "X-Presto-")
+}
+
+func newRepository(ctx context.Context, httpClient *http.Client, url string, user string, password string,
+	catalog string, schema string, history_table *string, headerPrefix string) *TrinoRepository {
+
+	if user == "" {
+		user = default_user
+	}
+
+	repo := &TrinoRepository{
+		ctx: ctx,
+		client: &client{
+			http:         httpClient,
+			url:          strings.TrimSuffix(url, "/"),
+			user:         user,
+			password:     password,
+			catalog:      catalog,
+			schema:       schema,
+			headerPrefix: headerPrefix,
+		},
+		run: database.RunInfo{MaestroVersion: conf.VERSION},
+	}
+
+	if history_table != nil {
+		repo.history = parseTableName(*history_table, catalog, schema)
+	} else {
+		repo.history = parseTableName(default_history_table, catalog, schema)
+	}
+
+	return repo
+}
+
+// Ping checks that the coordinator is reachable and can execute statements.
+func (r *TrinoRepository) Ping() error {
+	_, err := r.client.exec(r.ctx, "SELECT 1")
+	return err
+}
+
+func (r *TrinoRepository) GetLatestMigration() (uint16, error) {
+	tableExists, err := r.CheckSchemaHistoryTable()
+	if err != nil {
+		return 0, err
+	}
+
+	if !tableExists {
+		return 0, nil
+	}
+
+	rows, _, err := r.client.query(r.ctx, fmt.Sprintf(`
+		SELECT COALESCE(MAX(version), 0)
+		FROM %s
+		WHERE success = true
+	`, r.history))
+	if err != nil {
+		return 0, err
+	}
+
+	return parseVersion(rows[0][0])
+}
+
+// AssertSchemaHistoryTable creates the history and audit tables if missing. Columns are nullable, as most
+// connectors do not support NOT NULL constraints.
+func (r *TrinoRepository) AssertSchemaHistoryTable() error {
+	// Audit tables are also created for history tables of previous versions
+	_, err := r.client.exec(r.ctx, fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			run_id VARCHAR,
+			maestro_version VARCHAR,
+			direction VARCHAR,
+			version SMALLINT,
+			description VARCHAR,
+			success BOOLEAN,
+			executed_at TIMESTAMP(3) WITH TIME ZONE
+		)
+	`, r.auditTable()))
+	if err != nil {
+		return err
+	}
+
+	_, err = r.client.exec(r.ctx, fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			version SMALLINT,
+			description VARCHAR,
+			md5_checksum VARCHAR,
+			success BOOLEAN,
+			executed_at TIMESTAMP(3) WITH TIME ZONE,
+			repaired_at TIMESTAMP(3) WITH TIME ZONE,
+			notes VARCHAR,
+			run_id VARCHAR,
+			author VARCHAR,
+			ticket VARCHAR,
+			skipped BOOLEAN
+		)
+	`, r.history))
+	return err
+}
+
+func (r *TrinoRepository) CheckSchemaHistoryTable() (bool, error) {
+	return r.tableExists(r.history)
+}
+
+func (r *TrinoRepository) ValidateMigrations(localMigrations []*migrations.Migration) []error {
+	if len(localMigrations) < 1 {
+		return nil
+	}
+
+	byVersion := make(map[uint16]*migrations.Migration, len(localMigrations))
+	for _, migration := range localMigrations {
+		if migration.Type != enums.MIGRATION_UP {
+			return []error{fmt.Errorf("invalid migration type: %s", migration.Type.Name())}
+		}
+		byVersion[migration.Version] = migration
+	}
+
+	tableExists, err := r.CheckSchemaHistoryTable()
+	if err != nil {
+		return []error{err}
+	}
+
+	if !tableExists {
+		return nil
+	}
+
+	history, err := r.appliedHistory("")
+	if err != nil {
+		return []error{err}
+	}
+
+	errs := make([]error, 0)
+	expectedVersion := uint16(1)
+
+	for _, applied := range history {
+		// Check gaps
+		if expectedVersion != applied.Version {
+			errs = append(errs, &database.MissingVersionError{Version: expectedVersion})
+		}
+		expectedVersion = applied.Version + 1
+
+		// Check description or checksum mismatch
+		local, ok := byVersion[applied.Version]
+		if applied.Success && (!ok || local.Description != applied.Description || *local.Checksum != applied.Checksum) {
+			errs = append(errs, &database.MismatchError{Version: applied.Version, Description: applied.Description, Checksum: applied.Checksum})
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (r *TrinoRepository) ExecuteMigration(migration *migrations.Migration) []error {
+	if migration.Type != enums.MIGRATION_UP {
+		return []error{fmt.Errorf("invalid migration type: %s", migration.Type.Name())}
+	}
+
+	errs := make([]error, 0)
+
+	err := r.execScript(*migration.Content, migration.SkipStatements)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	success := err == nil
+
+	err = r.saveHistory(migration, success, false)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("migration %d: %w", migration.Version, err))
+	} else {
+		err = r.audit(migration, database.AUDIT_UP, success)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("migration %d: %w", migration.Version, err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// saveHistory updates the migration in the history table with the given status, skipped if it was recorded
+// without being executed, or inserts it if missing. Connectors do not all support MERGE, so the upsert takes
+// two statements.
+func (r *TrinoRepository) saveHistory(migration *migrations.Migration, success bool, skipped bool) error {
+	updated, err := r.client.exec(r.ctx, fmt.Sprintf(`
+		UPDATE %s SET description = %s, md5_checksum = %s, success = %t, run_id = %s, author = %s, ticket = %s,
+			skipped = %t, executed_at = current_timestamp
+		WHERE version = %d
+	`, r.history, literal(migration.Description), literal(*migration.Checksum), success, nullableLiteral(r.run.ID),
+		nullableLiteral(migration.Author), nullableLiteral(migration.Ticket), skipped, migration.Version))
+	if err != nil || updated > 0 {
+		return err
+	}
+
+	_, err = r.client.exec(r.ctx, fmt.Sprintf(`
+		INSERT INTO %s (version, description, md5_checksum, success, run_id, author, ticket, skipped, executed_at)
+		VALUES (%d, %s, %s, %t, %s, %s, %s, %t, current_timestamp)
+	`, r.history, migration.Version, literal(migration.Description), literal(*migration.Checksum), success,
+		nullableLiteral(r.run.ID), nullableLiteral(migration.Author), nullableLiteral(migration.Ticket), skipped))
+	return err
+}
+
+// SkipMigration records the migration as applied and skipped in the history table without executing it, and
+// records the skip in the audit table.
+func (r *TrinoRepository) SkipMigration(migration *migrations.Migration) error {
+	if migration.Type != enums.MIGRATION_UP {
+		return fmt.Errorf("invalid migration type: %s", migration.Type.Name())
+	}
+
+	err := r.saveHistory(migration, true, true)
+	if err != nil {
+		return fmt.Errorf("migration %d: %w", migration.Version, err)
+	}
+
+	return r.audit(migration, database.AUDIT_SKIP, true)
+}
+
+func (r *TrinoRepository) ExecuteHook(hook *migrations.Hook) error {
+	return r.execScript(*hook.Content, 0)
+}
+
+func (r *TrinoRepository) ExecuteAssertion(hook *migrations.Hook) error {
+	rows, types, err := r.client.query(r.ctx, *hook.Content)
+	if err != nil {
+		return err
+	}
+
+	if len(rows) == 0 {
+		return nil
+	}
+
+	if len(rows) == 1 && len(rows[0]) == 1 && len(types) == 1 && types[0] == "boolean" {
+		if rows[0][0] != nil && *rows[0][0] == "true" {
+			return nil
+		}
+		return fmt.Errorf("assertion failed: query returned false")
+	}
+
+	return fmt.Errorf("assertion failed: query returned %d rows", len(rows))
+}
+
+func (r *TrinoRepository) RollbackMigration(migration *migrations.Migration) error {
+	if migration.Type != enums.MIGRATION_DOWN {
+		return fmt.Errorf("invalid migration type: %s", migration.Type.Name())
+	}
+
+	history, err := r.appliedHistory(fmt.Sprintf("WHERE version = %d", migration.Version))
+	if err != nil {
+		return err
+	}
+
+	if len(history) < 1 {
+		return nil
+	}
+
+	err = r.execScript(*migration.Content, 0)
+	if err != nil {
+		return err
+	}
+
+	deleted, err := r.client.exec(r.ctx, fmt.Sprintf("DELETE FROM %s WHERE version = %d", r.history,
+		migration.Version))
+	if err != nil {
+		return err
+	}
+
+	if deleted == 0 {
+		return fmt.Errorf("version was not deleted from \"%s\" table", r.history.name)
+	}
+
+	return r.audit(migration, database.AUDIT_DOWN, true)
+}
+
+// ServerInfo returns the version of the coordinator. The schema is the one of the history table, qualified with
+// its catalog.
+func (r *TrinoRepository) ServerInfo() (*database.ServerInfo, error) {
+	rows, _, err := r.client.query(r.ctx, "SELECT version()")
+	if err != nil {
+		return nil, err
+	}
+
+	info := &database.ServerInfo{HistoryTable: r.history.name, Schema: r.history.location()}
+	if rows[0][0] != nil {
+		info.Version = *rows[0][0]
+	}
+
+	info.HistoryTableExists, err = r.CheckSchemaHistoryTable()
+	if err != nil || !info.HistoryTableExists {
+		return info, err
+	}
+
+	rows, _, err = r.client.query(r.ctx, fmt.Sprintf("SELECT COUNT(*) FROM %s", r.history))
+	if err != nil {
+		return nil, err
+	}
+
+	if rows[0][0] != nil {
+		info.HistoryRows, err = strconv.ParseInt(*rows[0][0], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return info, nil
+}
+
+func (r *TrinoRepository) Capabilities() database.Capabilities {
+	return database.Capabilities{
+		SupportsTransactions:   false,
+		SupportsAdvisoryLock:   false,
+		SupportsMultiStatement: false,
+		MaxIdentifierLength:    0,
+	}
+}
+
+func (r *TrinoRepository) SetRunInfo(info database.RunInfo) {
+	r.run = info
+}
+
+func (r *TrinoRepository) auditTable() tableName {
+	return r.history.withName(r.history.name + "_audit")
+}
+
+// audit records the execution of the migration in the audit table.
+func (r *TrinoRepository) audit(migration *migrations.Migration, direction string, success bool) error {
+	_, err := r.client.exec(r.ctx, fmt.Sprintf(`
+		INSERT INTO %s (run_id, maestro_version, direction, version, description, success, executed_at)
+		VALUES (%s, %s, %s, %d, %s, %t, current_timestamp)
+	`, r.auditTable(), literal(r.run.ID), literal(r.run.MaestroVersion), literal(direction), migration.Version,
+		literal(migration.Description), success))
+	if err != nil {
+		return fmt.Errorf("error recording audit: %w", err)
+	}
+
+	return nil
+}
+
+// DoInTransaction runs the callback: Trino executes and commits statements one at a time.
+func (r *TrinoRepository) DoInTransaction(fn func() error) error {
+	return fn()
+}
+
+// DoOutsideTransaction runs the callback, as DoInTransaction does not start a transaction.
+func (r *TrinoRepository) DoOutsideTransaction(fn func() error) error {
+	return fn()
+}
+
+// Session returns a repository sharing the HTTP client of this one, with its own run info.
+func (r *TrinoRepository) Session() database.Repository {
+	session := *r
+	return &session
+}
+
+// GetLockInfo reports whether the lock table exists. The holder of the lock is not recorded.
+func (r *TrinoRepository) GetLockInfo() (*database.LockInfo, error) {
+	exists, err := r.tableExists(r.lockTable())
+	if err != nil {
+		return nil, err
+	}
+
+	return &database.LockInfo{Locked: exists}, nil
+}
+
+// lockTable returns the lock table of the history table, in the same catalog and schema, so the migrations of
+// several history tables do not block each other.
+func (r *TrinoRepository) lockTable() tableName {
+	if r.history.name == default_history_table {
+		return r.history.withName(lock_table)
+	}
+	return r.history.withName(r.history.name + "_lock")
+}
+
+func (r *TrinoRepository) DoInLock(fn func() error) error {
+	err := r.lock()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = r.unlock()
+		if err != nil {
+			panic(fmt.Errorf("failed to delete lock table: %w", err))
+		}
+	}()
+
+	err = fn()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// This function ensures that only one instance of the application can perform schema migrations at a time.
+// It achieves this by creating a lock table. If the table exists, it waits for up to 1 minute for the
+// table to be deleted by another instance, indicating that the migration process has completed.
+func (r *TrinoRepository) lock() error {
+	for range 12 {
+		_, err := r.client.exec(r.ctx, fmt.Sprintf("CREATE TABLE %s (unused INTEGER)", r.lockTable()))
+		if err == nil {
+			return nil
+		}
+
+		if !isAlreadyExists(err) {
+			return err
+		}
+
+		time.Sleep(time.Second * 5) // Delays 5 seconds
+	}
+
+	return fmt.Errorf("timeout while waiting for %s deletion", r.lockTable())
+}
+
+func (r *TrinoRepository) unlock() error {
+	_, err := r.client.exec(r.ctx, fmt.Sprintf("DROP TABLE IF EXISTS %s", r.lockTable()))
+	return err
+}
+
+// Repair updates or inserts every migration in the history table, one statement at a time, as Trino has no
+// transactions.
+func (r *TrinoRepository) Repair(migrations []*migrations.Migration) []error {
+	tableExists, err := r.CheckSchemaHistoryTable()
+	if err != nil {
+		return []error{err}
+	}
+
+	if !tableExists {
+		return nil
+	}
+
+	errs := make([]error, 0)
+	for _, migration := range migrations {
+		err = r.repair(migration)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("migration %d: %w", migration.Version, err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+func (r *TrinoRepository) repair(migration *migrations.Migration) error {
+	description, checksum := literal(migration.Description), literal(*migration.Checksum)
+
+	updated, err := r.client.exec(r.ctx, fmt.Sprintf(`
+		UPDATE %s SET
+			repaired_at = CASE
+				WHEN description <> %s OR md5_checksum <> %s THEN current_timestamp
+				ELSE repaired_at
+			END,
+			description = %s, md5_checksum = %s, success = true
+		WHERE version = %d
+	`, r.history, description, checksum, description, checksum, migration.Version))
+	if err != nil || updated > 0 {
+		return err
+	}
+
+	_, err = r.client.exec(r.ctx, fmt.Sprintf(`
+		INSERT INTO %s (version, description, md5_checksum, success, executed_at, repaired_at)
+		VALUES (%d, %s, %s, true, current_timestamp, current_timestamp)
+	`, r.history, migration.Version, description, checksum))
+	return err
+}
+
+// Annotate sets the note of the version in the notes column of the history table.
+func (r *TrinoRepository) Annotate(version uint16, note string) error {
+	exists, err := r.CheckSchemaHistoryTable()
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return fmt.Errorf("version %d: %w", version, database.ErrNotApplied)
+	}
+
+	updated, err := r.client.exec(r.ctx, fmt.Sprintf("UPDATE %s SET notes = %s WHERE version = %d", r.history,
+		nullableLiteral(note), version))
+	if err != nil {
+		return err
+	}
+
+	if updated == 0 {
+		return fmt.Errorf("version %d: %w", version, database.ErrNotApplied)
+	}
+
+	return nil
+}
+
+func (r *TrinoRepository) GetFailingMigrations() ([]*migrations.Migration, error) {
+	exists, err := r.CheckSchemaHistoryTable()
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		return nil, nil
+	}
+
+	history, err := r.appliedHistory("WHERE success = false")
+	if err != nil {
+		return nil, err
+	}
+
+	var failingMigrations []*migrations.Migration
+	for _, failing := range history {
+		checksum := failing.Checksum
+		failingMigrations = append(failingMigrations, &migrations.Migration{
+			Version:     failing.Version,
+			Description: failing.Description,
+			Checksum:    &checksum,
+		})
+	}
+
+	return failingMigrations, nil
+}
+
+func (r *TrinoRepository) GetAppliedMigrations() ([]*database.AppliedMigration, error) {
+	exists, err := r.CheckSchemaHistoryTable()
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		return nil, nil
+	}
+
+	return r.appliedHistory("")
+}
+
+// Clean drops every view and table of the configured catalog and schema, except the lock table, so cleaning
+// inside DoInLock does not release the lock. A history table of another catalog or schema is kept.
+func (r *TrinoRepository) Clean() error {
+	current := parseTableName("", r.client.catalog, r.client.schema)
+
+	rows, _, err := r.client.query(r.ctx, fmt.Sprintf(`
+		SELECT table_name, table_type
+		FROM %s
+		WHERE table_schema = %s
+		ORDER BY table_type DESC
+	`, current.withName("tables").informationSchema(), literal(current.schema)))
+	if err != nil {
+		return err
+	}
+
+	// Views are dropped first, as they may depend on the tables
+	lockTable := r.lockTable()
+	statements := make([]string, 0, len(rows))
+	for _, row := range rows {
+		if row[0] == nil {
+			continue
+		}
+
+		table := current.withName(*row[0])
+		if table == lockTable {
+			continue
+		}
+
+		if row[1] != nil && *row[1] == "VIEW" {
+			statements = append(statements, fmt.Sprintf("DROP VIEW IF EXISTS %s", table))
+		} else {
+			statements = append(statements, fmt.Sprintf("DROP TABLE IF EXISTS %s", table))
+		}
+	}
+
+	for _, statement := range statements {
+		_, err = r.client.exec(r.ctx, statement)
+		if err != nil {
+			return fmt.Errorf("error executing %q: %w", statement, err)
+		}
+	}
+
+	return nil
+}
+
+// appliedHistory returns the rows of the history table matching the filter, ordered by version. Execution times
+// are read in UTC.
+func (r *TrinoRepository) appliedHistory(filter string) ([]*database.AppliedMigration, error) {
+	rows, _, err := r.client.query(r.ctx, fmt.Sprintf(`
+		SELECT version, description, md5_checksum, success, author, ticket,
+			format_datetime(executed_at AT TIME ZONE 'UTC', 'yyyy-MM-dd HH:mm:ss'), skipped
+		FROM %s %s
+		ORDER BY version ASC
+	`, r.history, filter))
+	if err != nil {
+		return nil, err
+	}
+
+	history := make([]*database.AppliedMigration, 0, len(rows))
+	for _, row := range rows {
+		version, err := parseVersion(row[0])
+		if err != nil {
+			return nil, err
+		}
+
+		applied := &database.AppliedMigration{Version: version}
+		if row[1] != nil {
+			applied.Description = *row[1]
+		}
+		if row[2] != nil {
+			applied.Checksum = *row[2]
+		}
+		applied.Success = row[3] != nil && *row[3] == "true"
+		if row[4] != nil {
+			applied.Author = *row[4]
+		}
+		if row[5] != nil {
+			applied.Ticket = *row[5]
+		}
+		if row[6] != nil {
+			applied.ExecutedAt, err = database.ParseExecutedAt(*row[6])
+			if err != nil {
+				return nil, err
+			}
+		}
+		applied.Skipped = row[7] != nil && *row[7] == "true"
+
+		history = append(history, applied)
+	}
+
+	return history, nil
+}
+
+// tableExists reports whether the table exists, from the information schema of its catalog. Names are compared
+// in lower case, as connectors store them.
+func (r *TrinoRepository) tableExists(table tableName) (bool, error) {
+	rows, _, err := r.client.query(r.ctx, fmt.Sprintf(`
+		SELECT COUNT(*)
+		FROM %s
+		WHERE table_schema = %s AND table_name = %s
+	`, table.withName("tables").informationSchema(), literal(strings.ToLower(table.schema)),
+		literal(strings.ToLower(table.name))))
+	if err != nil {
+		return false, err
+	}
+
+	return len(rows) > 0 && rows[0][0] != nil && *rows[0][0] != "0", nil
+}
+
+// execScript executes a migration or hook script one statement at a time.
+func (r *TrinoRepository) execScript(script string, skip int) error {
+	for i, statement := range migrations.SplitStatements(script) {
+		if i < skip {
+			continue
+		}
+
+		_, err := r.client.exec(r.ctx, statement)
+		if err != nil {
+			line, _, _ := strings.Cut(strings.TrimSpace(statement), "\n")
+			return &database.StatementError{Index: i + 1, Err: fmt.Errorf("statement %d (%s): %w", i+1, line, err)}
+		}
+	}
+
+	return nil
+}
+
+// tableName is a table qualified with its catalog and schema, empty to use the ones of the session.
+type tableName struct {
+	catalog string
+	schema  string
+	name    string
+}
+
+// parseTableName parses a table name, qualified with its schema ("schema.table") or its catalog and schema
+// ("catalog.schema.table"). The missing parts are the given catalog and schema.
+func parseTableName(name string, catalog string, schema string) tableName {
+	parts := strings.Split(name, ".")
+	switch len(parts) {
+	case 2:
+		return tableName{catalog: catalog, schema: parts[0], name: parts[1]}
+	case 3:
+		return tableName{catalog: parts[0], schema: parts[1], name: parts[2]}
+	}
+	return tableName{catalog: catalog, schema: schema, name: name}
+}
+
+func (t tableName) withName(name string) tableName {
+	t.name = name
+	return t
+}
+
+// location returns the catalog and schema of the table ("catalog.schema").
+func (t tableName) location() string {
+	return strings.Trim(t.catalog+"."+t.schema, ".")
+}
+
+// informationSchema returns the table of the given name in the information schema of the catalog of the table.
+func (t tableName) informationSchema() string {
+	return tableName{catalog: t.catalog, schema: "information_schema", name: t.name}.String()
+}
+
+// String returns the table quoted with double quotes, qualified with its catalog and schema if set.
+func (t tableName) String() string {
+	parts := make([]string, 0, 3)
+	for _, part := range []string{t.catalog, t.schema, t.name} {
+		if part != "" {
+			parts = append(parts, quote(part))
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+func parseVersion(value *string) (uint16, error) {
+	if value == nil {
+		return 0, nil
+	}
+
+	version, err := strconv.ParseUint(*value, 10, 16)
+	if err != nil {
+		return 0, fmt.Errorf("invalid version %q: %w", *value, err)
+	}
+
+	return uint16(version), nil
+}
+
+func isAlreadyExists(err error) bool {
+	var statementErr *statementError
+	return errors.As(err, &statementErr) && strings.HasSuffix(statementErr.name, table_already_exists)
+}
+
+// quote returns the name quoted with double quotes, so any table name can be used.
+func quote(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
@@ -0,0 +1,180 @@
+package trino
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/maestro-go/maestro/core/enums"
+	"github.com/maestro-go/maestro/internal/migrations"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeServer answers the statements of the repository through the client protocol. Every statement is answered
+// in two pages, the second one at its next URI, and the first request is answered as unavailable, so the
+// repository has to retry it and to follow the next URIs.
+type fakeServer struct {
+	mu          sync.Mutex
+	url         string
+	pages       []string
+	unavailable bool
+	locked      bool
+	updated     int64
+	assertion   string
+	statements  []string
+}
+
+func (f *fakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.Header.Get("X-Trino-User") != "maestro" || r.Header.Get("X-Trino-Catalog") != "iceberg" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if f.unavailable {
+		f.unavailable = false
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	var page int
+	if _, err := fmt.Sscanf(r.URL.Path, "/v1/statement/executing/%d", &page); err == nil && r.Method == http.MethodGet {
+		w.Write([]byte(`{"id": "q", "stats": {"state": "FINISHED"}, ` + f.pages[page] + `}`))
+		return
+	}
+
+	if r.Method != http.MethodPost || r.URL.Path != statement_api {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	body, _ := io.ReadAll(r.Body)
+	statement := strings.TrimSpace(string(body))
+	f.statements = append(f.statements, statement)
+
+	results := `"updateType": "SELECT"`
+	switch {
+	case strings.HasPrefix(statement, `CREATE TABLE "iceberg"."ops"."schema_lock"`):
+		if f.locked {
+			results = `"error": {"message": "line 1:1: Table 'iceberg.ops.schema_lock' already exists",` +
+				` "errorName": "TABLE_ALREADY_EXISTS", "errorType": "USER_ERROR"}`
+			break
+		}
+		f.locked = true
+	case strings.HasPrefix(statement, `DROP TABLE IF EXISTS "iceberg"."ops"."schema_lock"`):
+		f.locked = false
+	case strings.HasPrefix(statement, "UPDATE"):
+		results = fmt.Sprintf(`"updateType": "UPDATE", "updateCount": %d`, f.updated)
+	case strings.HasPrefix(statement, "SELECT count(*)"):
+		results = f.assertion
+	}
+
+	// The results are in the page of the next URI
+	f.pages = append(f.pages, results)
+	w.Write([]byte(fmt.Sprintf(`{"id": "q", "nextUri": "%s/v1/statement/executing/%d", "stats": {"state": "QUEUED"}}`,
+		f.url, len(f.pages)-1)))
+}
+
+func newTestRepository(server *fakeServer) (*TrinoRepository, func()) {
+	httpServer := httptest.NewServer(server)
+	server.url = httpServer.URL
+	history := "ops.schema_history"
+	repo := NewTrinoRepository(context.Background(), httpServer.Client(), httpServer.URL, "", "", "iceberg",
+		"analytics", &history)
+	return repo, httpServer.Close
+}
+
+func TestParseTableName(t *testing.T) {
+	assert.Equal(t, `"iceberg"."analytics"."schema_history"`,
+		parseTableName("schema_history", "iceberg", "analytics").String())
+	assert.Equal(t, `"iceberg"."ops"."schema_history"`,
+		parseTableName("ops.schema_history", "iceberg", "analytics").String())
+	assert.Equal(t, `"postgresql"."ops"."schema_history"`,
+		parseTableName("postgresql.ops.schema_history", "iceberg", "analytics").String())
+	assert.Equal(t, `"weird""name"`, parseTableName(`weird"name`, "", "").String())
+
+	table := parseTableName("postgresql.ops.schema_history", "iceberg", "analytics")
+	assert.Equal(t, "postgresql.ops", table.location())
+	assert.Equal(t, `"postgresql"."information_schema"."tables"`, table.withName("tables").informationSchema())
+}
+
+func TestDoInLock(t *testing.T) {
+	server := &fakeServer{unavailable: true}
+	repo, cleanup := newTestRepository(server)
+	defer cleanup()
+
+	err := repo.DoInLock(func() error {
+		assert.True(t, server.locked)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.False(t, server.locked)
+}
+
+func TestLockAlreadyExists(t *testing.T) {
+	server := &fakeServer{locked: true}
+	repo, cleanup := newTestRepository(server)
+	defer cleanup()
+
+	_, err := repo.client.exec(repo.ctx, fmt.Sprintf("CREATE TABLE %s (unused INTEGER)", repo.lockTable()))
+	assert.True(t, isAlreadyExists(err))
+	assert.EqualError(t, err, "TABLE_ALREADY_EXISTS: line 1:1: Table 'iceberg.ops.schema_lock' already exists")
+}
+
+func TestSaveHistory(t *testing.T) {
+	server := &fakeServer{}
+	repo, cleanup := newTestRepository(server)
+	defer cleanup()
+
+	checksum := "0a52730597fb4ffa01fc117d9e71e3a9"
+	migration := &migrations.Migration{Version: 3, Description: "it's", Checksum: &checksum, Type: enums.MIGRATION_UP}
+
+	// Missing versions are inserted
+	err := repo.saveHistory(migration, true, false)
+	assert.NoError(t, err)
+	assert.Len(t, server.statements, 2)
+	assert.Contains(t, server.statements[1], `INSERT INTO "iceberg"."ops"."schema_history"`)
+	assert.Contains(t, server.statements[1],
+		"(3, 'it''s', '0a52730597fb4ffa01fc117d9e71e3a9', true, NULL, NULL, NULL, false")
+
+	// Existing versions are updated
+	server.statements, server.updated = nil, 1
+	err = repo.saveHistory(migration, false, false)
+	assert.NoError(t, err)
+	assert.Len(t, server.statements, 1)
+	assert.Contains(t, server.statements[0], "success = false")
+
+	// Skipped versions are recorded as such
+	server.statements, server.updated = nil, 1
+	err = repo.saveHistory(migration, true, true)
+	assert.NoError(t, err)
+	assert.Contains(t, server.statements[0], "skipped = true")
+}
+
+func TestExecuteAssertion(t *testing.T) {
+	server := &fakeServer{}
+	repo, cleanup := newTestRepository(server)
+	defer cleanup()
+
+	content := "SELECT count(*) = 0 FROM users WHERE email IS NULL"
+	hook := &migrations.Hook{Content: &content}
+
+	server.assertion = `"columns": [{"name": "ok", "type": "boolean"}], "data": [[true]]`
+	assert.NoError(t, repo.ExecuteAssertion(hook))
+
+	server.assertion = `"columns": [{"name": "ok", "type": "boolean"}], "data": [[false]]`
+	assert.EqualError(t, repo.ExecuteAssertion(hook), "assertion failed: query returned false")
+
+	server.assertion = `"columns": [{"name": "email", "type": "varchar"}], "data": [["a"], ["b"]]`
+	assert.EqualError(t, repo.ExecuteAssertion(hook), "assertion failed: query returned 2 rows")
+
+	server.assertion = `"columns": [{"name": "email", "type": "varchar"}]`
+	assert.NoError(t, repo.ExecuteAssertion(hook))
+}
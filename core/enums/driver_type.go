@@ -5,9 +5,39 @@ type DriverType int8
 const (
 	DRIVER_POSTGRES DriverType = iota
 	DRIVER_COCKROACHDB
+	DRIVER_GREENPLUM
+	DRIVER_INFORMIX // Connected through an ODBC driver linked in the binary, see the server setting
+	DRIVER_OPENSEARCH
+	DRIVER_NEO4J
+	DRIVER_REDIS
+	DRIVER_DATABRICKS
+	DRIVER_MARIADB
+	DRIVER_SQLITE
+	DRIVER_SQLSERVER
+	DRIVER_ORACLE
+	DRIVER_CLICKHOUSE
+	DRIVER_TRINO
+	DRIVER_MONGODB
+	DRIVER_PLUGIN // External driver run as a subprocess, see the plugin setting
 )
 
 var MapStringToDriverType = map[string]DriverType{
 	"postgres":    DRIVER_POSTGRES,
 	"cockroachdb": DRIVER_COCKROACHDB,
+	"greenplum":   DRIVER_GREENPLUM,
+	"informix":    DRIVER_INFORMIX,
+	"opensearch":  DRIVER_OPENSEARCH,
+	"neo4j":       DRIVER_NEO4J,
+	"redis":       DRIVER_REDIS,
+	"valkey":      DRIVER_REDIS,
+	"databricks":  DRIVER_DATABRICKS,
+	"mariadb":     DRIVER_MARIADB,
+	"sqlite":      DRIVER_SQLITE,
+	"sqlserver":   DRIVER_SQLSERVER,
+	"oracle":      DRIVER_ORACLE,
+	"clickhouse":  DRIVER_CLICKHOUSE,
+	"trino":       DRIVER_TRINO,
+	"presto":      DRIVER_TRINO,
+	"mongodb":     DRIVER_MONGODB,
+	"plugin":      DRIVER_PLUGIN,
 }
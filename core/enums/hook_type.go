@@ -15,10 +15,21 @@ const (
 	HOOK_AFTER
 	HOOK_AFTER_EACH
 	HOOK_AFTER_VERSION
+
+	HOOK_ASSERTION
+
+	HOOK_BEFORE_VALIDATE
+
+	HOOK_RUN_START
+	HOOK_RUN_END
+
+	HOOK_BEFORE_VERSION_DOWN
+	HOOK_AFTER_VERSION_DOWN
 )
 
 var hooksNames = []string{"REPEATABLE", "REPEATABLE_DOWN", "BEFORE", "BEFORE_EACH", "BEFORE_VERSION",
-	"AFTER", "AFTER_EACH", "AFTER_VERSION"}
+	"AFTER", "AFTER_EACH", "AFTER_VERSION", "ASSERTION", "BEFORE_VALIDATE",
+	"RUN_START", "RUN_END", "BEFORE_VERSION_DOWN", "AFTER_VERSION_DOWN"}
 
 func (h *HookType) Name() string {
 	return hooksNames[*h]
@@ -35,4 +46,14 @@ var MapHookTypeToRegex = map[HookType]string{
 	HOOK_AFTER:         conf.HOOK_AFTER_REGEX,
 	HOOK_AFTER_EACH:    conf.HOOK_AFTER_EACH_REGEX,
 	HOOK_AFTER_VERSION: conf.HOOK_AFTER_VERSION_REGEX,
+
+	HOOK_ASSERTION: conf.HOOK_ASSERTION_REGEX,
+
+	HOOK_BEFORE_VALIDATE: conf.HOOK_BEFORE_VALIDATE_REGEX,
+
+	HOOK_RUN_START: conf.HOOK_RUN_START_REGEX,
+	HOOK_RUN_END:   conf.HOOK_RUN_END_REGEX,
+
+	HOOK_BEFORE_VERSION_DOWN: conf.HOOK_BEFORE_VERSION_DOWN_REGEX,
+	HOOK_AFTER_VERSION_DOWN:  conf.HOOK_AFTER_VERSION_DOWN_REGEX,
 }
@@ -0,0 +1,29 @@
+package enums
+
+import "github.com/maestro-go/maestro/internal/conf"
+
+// MigrationTrack identifies an independent stream of migrations, tracked in its own history table.
+type MigrationTrack int8
+
+const (
+	TRACK_SCHEMA MigrationTrack = iota
+	TRACK_DATA
+)
+
+func (t *MigrationTrack) Name() string {
+	return []string{"schema", "data"}[*t]
+}
+
+var MapStringToMigrationTrack = map[string]MigrationTrack{
+	"":       TRACK_SCHEMA, // Default track
+	"schema": TRACK_SCHEMA,
+	"data":   TRACK_DATA,
+}
+
+var MapMigrationTrackToRegexes = map[MigrationTrack]map[MigrationType]string{
+	TRACK_SCHEMA: MapMigrationTypeToRegex,
+	TRACK_DATA: {
+		MIGRATION_UP:   conf.DATA_MIGRATION_REGEX,
+		MIGRATION_DOWN: conf.DATA_MIGRATION_DOWN_REGEX,
+	},
+}
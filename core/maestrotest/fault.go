@@ -0,0 +1,197 @@
+package maestrotest
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/maestro-go/maestro/core/database"
+	"github.com/maestro-go/maestro/internal/migrations"
+)
+
+// ErrInjected is the error of the failures injected by a FaultyRepository, except dropped connections which
+// fail with driver.ErrBadConn like real ones.
+var ErrInjected = errors.New("injected fault")
+
+// FaultPoint is a point of the execution of a migration where a fault can be injected.
+type FaultPoint int
+
+const (
+	BeforeMigration FaultPoint = iota // Before the script of the migration, nothing is executed
+	HistoryInsert                     // Once the script is executed, instead of recording it in the history
+	AfterMigration                    // Once the migration is executed and recorded in the history
+)
+
+// Fault decides the failures a FaultyRepository injects in the migrations it executes or rolls back.
+type Fault interface {
+	// Inject returns the error failing the migration of the version at the point, nil to go on.
+	Inject(point FaultPoint, version uint16) error
+}
+
+// FaultFunc is a Fault implemented by a function.
+type FaultFunc func(point FaultPoint, version uint16) error
+
+func (f FaultFunc) Inject(point FaultPoint, version uint16) error {
+	return f(point, version)
+}
+
+// FailAfterVersion returns the fault failing the first migration after the version, before its script, so
+// runs stop once the version is applied.
+func FailAfterVersion(version uint16) Fault {
+	failed := uint16(0)
+	return FaultFunc(func(point FaultPoint, v uint16) error {
+		if point != BeforeMigration || v <= version || (failed != 0 && v != failed) {
+			return nil
+		}
+		failed = v
+		return fmt.Errorf("%w: failing after version %d", ErrInjected, version)
+	})
+}
+
+// FailHistoryInsert returns the fault failing to record the migration of the version in the schema history
+// table, once its script is executed, e.g. like a lost connection or a full disk.
+func FailHistoryInsert(version uint16) Fault {
+	return FaultFunc(func(point FaultPoint, v uint16) error {
+		if point != HistoryInsert || v != version {
+			return nil
+		}
+		return fmt.Errorf("%w: history insert of version %d", ErrInjected, version)
+	})
+}
+
+// DropConnection returns the fault dropping the connection when the migration of the version starts: the
+// migration and all the migrations, hooks and assertions executed after it fail with driver.ErrBadConn, until
+// the fault is healed.
+func DropConnection(version uint16) Fault {
+	return &droppedConnection{version: version}
+}
+
+type droppedConnection struct {
+	version uint16
+	dropped bool
+}
+
+func (f *droppedConnection) Inject(point FaultPoint, version uint16) error {
+	if point == BeforeMigration && version == f.version {
+		f.dropped = true
+	}
+	if f.dropped {
+		return driver.ErrBadConn
+	}
+	return nil
+}
+
+// FaultyRepository is a repository injecting the failures of its fault in the migrations it executes or
+// rolls back, to test how runs fail, e.g. with force mode, resumes or transactions, without SQL tricks. The
+// other calls are forwarded to the wrapped repository. It is used as is by migrators, without sessions, and
+// does not implement the optional interfaces of the wrapped repository (e.g. database.TransactionMonitor).
+type FaultyRepository struct {
+	database.Repository
+
+	mu    sync.Mutex
+	fault Fault
+}
+
+// NewFaultyRepository returns the repository injecting the failures of the fault in the wrapped repository.
+// A nil fault injects no failure.
+func NewFaultyRepository(repository database.Repository, fault Fault) *FaultyRepository {
+	return &FaultyRepository{Repository: repository, fault: fault}
+}
+
+// SetFault replaces the fault of the repository, nil healing it.
+func (r *FaultyRepository) SetFault(fault Fault) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.fault = fault
+}
+
+// Heal stops injecting failures, e.g. before resuming a failed run.
+func (r *FaultyRepository) Heal() {
+	r.SetFault(nil)
+}
+
+func (r *FaultyRepository) inject(point FaultPoint, version uint16) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.fault == nil {
+		return nil
+	}
+	return r.fault.Inject(point, version)
+}
+
+// dropped returns driver.ErrBadConn if the connection of the repository was dropped by its fault.
+func (r *FaultyRepository) dropped() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if fault, ok := r.fault.(*droppedConnection); ok && fault.dropped {
+		return driver.ErrBadConn
+	}
+	return nil
+}
+
+func (r *FaultyRepository) ExecuteMigration(migration *migrations.Migration) []error {
+	err := r.inject(BeforeMigration, migration.Version)
+	if err != nil {
+		return []error{err}
+	}
+
+	err = r.inject(HistoryInsert, migration.Version)
+	if err != nil {
+		// The script is executed without being recorded
+		hookErr := r.Repository.ExecuteHook(&migrations.Hook{Version: migration.Version, Content: migration.Content})
+		return []error{errors.Join(hookErr, err)}
+	}
+
+	errs := r.Repository.ExecuteMigration(migration)
+	if len(errs) > 0 {
+		return errs
+	}
+
+	err = r.inject(AfterMigration, migration.Version)
+	if err != nil {
+		return []error{err}
+	}
+
+	return nil
+}
+
+func (r *FaultyRepository) RollbackMigration(migration *migrations.Migration) error {
+	err := r.inject(BeforeMigration, migration.Version)
+	if err != nil {
+		return err
+	}
+
+	err = r.Repository.RollbackMigration(migration)
+	if err != nil {
+		return err
+	}
+
+	return r.inject(AfterMigration, migration.Version)
+}
+
+func (r *FaultyRepository) SkipMigration(migration *migrations.Migration) error {
+	err := r.dropped()
+	if err != nil {
+		return err
+	}
+	return r.Repository.SkipMigration(migration)
+}
+
+func (r *FaultyRepository) ExecuteHook(hook *migrations.Hook) error {
+	err := r.dropped()
+	if err != nil {
+		return err
+	}
+	return r.Repository.ExecuteHook(hook)
+}
+
+func (r *FaultyRepository) ExecuteAssertion(hook *migrations.Hook) error {
+	err := r.dropped()
+	if err != nil {
+		return err
+	}
+	return r.Repository.ExecuteAssertion(hook)
+}
@@ -0,0 +1,140 @@
+package maestrotest
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"path/filepath"
+	"testing"
+
+	"github.com/maestro-go/maestro/core/conf"
+	"github.com/maestro-go/maestro/core/database/sqlite"
+	"github.com/maestro-go/maestro/core/migrator"
+	testUtils "github.com/maestro-go/maestro/internal/utils/testing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// newFaultyRepository returns a faulty repository on a new SQLite database, the location of three migrations
+// creating the tables t1, t2 and t3, and a function reporting whether a table exists.
+func newFaultyRepository(t *testing.T, fault Fault) (*FaultyRepository, string, func(table string) bool) {
+	db, err := sql.Open("sqlite", "file:"+filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	location := writeMigrations(t, []string{
+		"CREATE TABLE t1 (id INTEGER PRIMARY KEY);",
+		"CREATE TABLE t2 (id INTEGER PRIMARY KEY);",
+		"CREATE TABLE t3 (id INTEGER PRIMARY KEY);",
+	})
+
+	tableExists := func(table string) bool {
+		exists := false
+		err := db.QueryRow("SELECT EXISTS (SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = ?)",
+			table).Scan(&exists)
+		require.NoError(t, err)
+		return exists
+	}
+
+	repository := sqlite.NewSQLiteRepository(context.Background(), db, testUtils.ToPtr("schema_history"))
+	return NewFaultyRepository(repository, fault), location, tableExists
+}
+
+func TestFailAfterVersionInTransaction(t *testing.T) {
+	repository, location, tableExists := newFaultyRepository(t, FailAfterVersion(1))
+
+	m := migrator.NewMigrator(zap.NewNop(), repository, &conf.MigrationConfig{
+		Locations:     []string{location},
+		InTransaction: true,
+	})
+
+	result, err := m.Migrate()
+	assert.ErrorIs(t, err, ErrInjected)
+	assert.True(t, result.RolledBack)
+	assert.False(t, tableExists("t1"))
+
+	latest, err := repository.GetLatestMigration()
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(0), latest)
+}
+
+func TestFailAfterVersionResume(t *testing.T) {
+	repository, location, tableExists := newFaultyRepository(t, FailAfterVersion(1))
+	config := &conf.MigrationConfig{Locations: []string{location}}
+
+	result, err := migrator.NewMigrator(zap.NewNop(), repository, config).Migrate()
+	assert.ErrorIs(t, err, ErrInjected)
+	assert.Equal(t, []uint16{1}, result.Applied())
+	require.NotNil(t, result.Resume)
+	assert.Equal(t, uint16(2), result.Resume.Version)
+
+	repository.Heal()
+
+	result, err = migrator.NewMigrator(zap.NewNop(), repository, config).Resume(result.Resume)
+	assert.NoError(t, err)
+	assert.Equal(t, []uint16{2, 3}, result.Applied())
+	assert.True(t, tableExists("t3"))
+}
+
+func TestFailAfterVersionForce(t *testing.T) {
+	repository, location, tableExists := newFaultyRepository(t, FailAfterVersion(1))
+
+	m := migrator.NewMigrator(zap.NewNop(), repository, &conf.MigrationConfig{
+		Locations: []string{location},
+		Force:     true,
+	})
+
+	// The failed migration does not stop the run
+	result, err := m.Migrate()
+	assert.ErrorIs(t, err, ErrInjected)
+	assert.Equal(t, []uint16{1, 3}, result.Applied())
+	assert.False(t, tableExists("t2"))
+	assert.True(t, tableExists("t3"))
+}
+
+func TestFailHistoryInsert(t *testing.T) {
+	// In a transaction, the executed script is rolled back with the run
+	repository, location, tableExists := newFaultyRepository(t, FailHistoryInsert(2))
+
+	result, err := migrator.NewMigrator(zap.NewNop(), repository, &conf.MigrationConfig{
+		Locations:     []string{location},
+		InTransaction: true,
+	}).Migrate()
+	assert.ErrorIs(t, err, ErrInjected)
+	assert.True(t, result.RolledBack)
+	assert.False(t, tableExists("t2"))
+
+	// Without transaction, the script stays executed without being recorded
+	result, err = migrator.NewMigrator(zap.NewNop(), repository, &conf.MigrationConfig{
+		Locations: []string{location},
+	}).Migrate()
+	assert.ErrorIs(t, err, ErrInjected)
+	assert.Equal(t, []uint16{1}, result.Applied())
+	assert.True(t, tableExists("t2"))
+
+	latest, err := repository.GetLatestMigration()
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(1), latest)
+}
+
+func TestDropConnection(t *testing.T) {
+	repository, location, tableExists := newFaultyRepository(t, DropConnection(2))
+
+	// Forced runs can not go on once the connection is dropped
+	result, err := migrator.NewMigrator(zap.NewNop(), repository, &conf.MigrationConfig{
+		Locations: []string{location},
+		Force:     true,
+	}).Migrate()
+	assert.ErrorIs(t, err, driver.ErrBadConn)
+	assert.Equal(t, []uint16{1}, result.Applied())
+	assert.False(t, tableExists("t3"))
+
+	repository.Heal()
+
+	result, err = migrator.NewMigrator(zap.NewNop(), repository, &conf.MigrationConfig{
+		Locations: []string{location},
+	}).Migrate()
+	assert.NoError(t, err)
+	assert.Equal(t, []uint16{2, 3}, result.Applied())
+}
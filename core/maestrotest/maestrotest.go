@@ -0,0 +1,200 @@
+// Package maestrotest provides helpers testing maestro against real databases, e.g. test containers.
+package maestrotest
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/maestro-go/maestro/core/conf"
+	"github.com/maestro-go/maestro/core/database"
+	"github.com/maestro-go/maestro/core/enums"
+	"github.com/maestro-go/maestro/core/migrator"
+	"github.com/maestro-go/maestro/internal/filesystem"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest"
+)
+
+// Config is the configuration of RunConcurrent.
+type Config struct {
+	// NewRepository returns a repository on the tested database. It is called once per migrator, so each one
+	// can have its own connections, like concurrent maestro processes. Returning the same repository is
+	// supported too, its sessions being used concurrently.
+	NewRepository func(t testing.TB) database.Repository
+
+	// Migration is the configuration of the migrators, whose up migrations are applied.
+	Migration conf.MigrationConfig
+
+	// Migrations are the contents of up migrations written as versions 1, 2, ... to a temporary location
+	// added to the locations of Migration, so drivers can be tested without migration files.
+	Migrations []string
+}
+
+// RunConcurrent launches n migrators simultaneously against the database of the configuration, and fails the
+// test unless every pending up migration is applied exactly once: by a single migrator, and recorded once as
+// successful in the schema history table. It returns the results of the migrators, in launch order.
+func RunConcurrent(t testing.TB, n int, config *Config) []*migrator.MigrationResult {
+	t.Helper()
+
+	if n < 1 {
+		t.Fatalf("maestrotest: %d migrators, expected at least 1", n)
+	}
+
+	migrationConfig := config.Migration
+	migrationConfig.Locations = slices.Clone(migrationConfig.Locations)
+	if len(config.Migrations) > 0 {
+		migrationConfig.Locations = append(migrationConfig.Locations, writeMigrations(t, config.Migrations))
+	}
+
+	repositories := make([]database.Repository, n)
+	for i := range repositories {
+		repositories[i] = config.NewRepository(t)
+	}
+
+	before, err := repositories[0].GetAppliedMigrations()
+	if err != nil {
+		t.Fatalf("maestrotest: error getting the applied migrations: %v", err)
+	}
+
+	pending := pendingVersions(t, &migrationConfig, before)
+
+	logger := zaptest.NewLogger(t, zaptest.Level(zap.WarnLevel))
+
+	results := make([]*migrator.MigrationResult, n)
+	errs := make([]error, n)
+
+	start := make(chan struct{})
+	wg := sync.WaitGroup{}
+	for i, repository := range repositories {
+		// Each migrator resolves its own destination
+		migratorConfig := migrationConfig
+		m := migrator.NewMigrator(logger, repository, &migratorConfig)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			results[i], errs[i] = m.Migrate()
+		}()
+	}
+
+	// Released together, so the migrators compete for the lock
+	close(start)
+	wg.Wait()
+
+	applications := make(map[uint16]int)
+	for i, result := range results {
+		if errs[i] != nil {
+			t.Errorf("maestrotest: migrator %d failed: %v", i+1, errs[i])
+		}
+		if result == nil {
+			continue
+		}
+		for _, version := range append(result.Applied(), result.Bypassed...) {
+			applications[version]++
+		}
+	}
+
+	for _, version := range pending {
+		if applications[version] != 1 {
+			t.Errorf("maestrotest: version %d applied %d times by %d concurrent migrators, expected once",
+				version, applications[version], n)
+		}
+	}
+	for version, count := range applications {
+		if !slices.Contains(pending, version) {
+			t.Errorf("maestrotest: version %d applied %d times, but it was not pending", version, count)
+		}
+	}
+
+	checkHistory(t, repositories[0], before, pending)
+
+	return results
+}
+
+// writeMigrations writes the contents as up migrations of versions 1, 2, ... to a temporary directory, and
+// returns the directory.
+func writeMigrations(t testing.TB, contents []string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for i, content := range contents {
+		path := filepath.Join(dir, fmt.Sprintf("V%03d_concurrent.sql", i+1))
+		err := os.WriteFile(path, []byte(content), 0644)
+		if err != nil {
+			t.Fatalf("maestrotest: error writing migration: %v", err)
+		}
+	}
+
+	return dir
+}
+
+// pendingVersions returns the versions of the local up migrations not applied yet, up to the destination of
+// the configuration.
+func pendingVersions(t testing.TB, config *conf.MigrationConfig, applied []*database.AppliedMigration) []uint16 {
+	t.Helper()
+
+	migrationsMap, _, errs := filesystem.LoadObjectsFromFiles(config)
+	if len(errs) > 0 {
+		t.Fatalf("maestrotest: error loading migrations: %v", errs)
+	}
+
+	appliedVersions := make(map[uint16]bool, len(applied))
+	for _, migration := range applied {
+		appliedVersions[migration.Version] = true
+	}
+
+	pending := make([]uint16, 0)
+	for _, migration := range migrationsMap[enums.MIGRATION_UP] {
+		if appliedVersions[migration.Version] {
+			continue
+		}
+		if config.Destination != nil && migration.Version > *config.Destination {
+			continue
+		}
+		pending = append(pending, migration.Version)
+	}
+
+	if len(pending) == 0 {
+		t.Fatalf("maestrotest: no pending migration, the migrators would have nothing to compete for")
+	}
+
+	return pending
+}
+
+// checkHistory fails the test unless the schema history table records once, as successful, the versions
+// applied before the migrators and the pending ones.
+func checkHistory(t testing.TB, repository database.Repository, before []*database.AppliedMigration,
+	pending []uint16) {
+
+	t.Helper()
+
+	after, err := repository.GetAppliedMigrations()
+	if err != nil {
+		t.Errorf("maestrotest: error getting the applied migrations: %v", err)
+		return
+	}
+
+	recorded := make(map[uint16]int, len(after))
+	for _, migration := range after {
+		recorded[migration.Version]++
+		if !migration.Success {
+			t.Errorf("maestrotest: version %d recorded as failed in the schema history table", migration.Version)
+		}
+	}
+
+	expected := slices.Clone(pending)
+	for _, migration := range before {
+		expected = append(expected, migration.Version)
+	}
+
+	for _, version := range expected {
+		if recorded[version] != 1 {
+			t.Errorf("maestrotest: version %d recorded %d times in the schema history table, expected once",
+				version, recorded[version])
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package maestrotest
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/maestro-go/maestro/core/conf"
+	"github.com/maestro-go/maestro/core/database"
+	"github.com/maestro-go/maestro/core/database/sqlite"
+	testUtils "github.com/maestro-go/maestro/internal/utils/testing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	_ "modernc.org/sqlite"
+)
+
+func TestRunConcurrent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+
+	config := &Config{
+		NewRepository: func(t testing.TB) database.Repository {
+			db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)")
+			require.NoError(t, err)
+			t.Cleanup(func() { db.Close() })
+
+			return sqlite.NewSQLiteRepository(context.Background(), db, testUtils.ToPtr("schema_history"))
+		},
+		Migration: conf.MigrationConfig{InTransaction: true},
+		Migrations: []string{
+			"CREATE TABLE concurrent1 (id INTEGER PRIMARY KEY);",
+			"CREATE TABLE concurrent2 (id INTEGER PRIMARY KEY);",
+		},
+	}
+
+	results := RunConcurrent(t, 2, config)
+	require.Len(t, results, 2)
+
+	// A single migrator applied the migrations, the other one found them applied
+	applied := make([][]uint16, 0, len(results))
+	for _, result := range results {
+		applied = append(applied, result.Applied())
+	}
+	assert.ElementsMatch(t, [][]uint16{{1, 2}, {}}, applied)
+
+	// Later migrations are applied once too
+	config.Migrations = append(config.Migrations, "CREATE TABLE concurrent3 (id INTEGER PRIMARY KEY);")
+
+	results = RunConcurrent(t, 2, config)
+	require.Len(t, results, 2)
+}
@@ -0,0 +1,86 @@
+package migrator
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/maestro-go/maestro/core/database"
+	"github.com/maestro-go/maestro/core/enums"
+	"github.com/maestro-go/maestro/internal/filesystem"
+	"go.uber.org/zap"
+)
+
+// Baseline records the local up migrations up to the given version as applied, without executing them, so a
+// database created before maestro was adopted is migrated from this version on. It fails when the schema history
+// table already records migrations. It returns the recorded versions.
+func (m *Migrator) Baseline(version uint16) ([]uint16, error) {
+	if version == 0 {
+		return nil, errors.New("the baseline version must be greater than 0")
+	}
+
+	m.repository.SetRunInfo(m.run)
+
+	migrationsMap, _, errs := filesystem.LoadObjectsFromFiles(m.config)
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	baselined := make([]uint16, 0)
+
+	err := m.repository.DoInLock(func() error {
+		err := m.repository.AssertSchemaHistoryTable()
+		if err != nil {
+			return fmt.Errorf("error asserting schema history table: %w", err)
+		}
+
+		history, err := m.repository.GetAppliedMigrations()
+		if err != nil {
+			return fmt.Errorf("error getting applied migrations: %w", err)
+		}
+
+		if len(history) > 0 {
+			return fmt.Errorf("the schema history table already records migrations (latest version %d), only databases not migrated by maestro can be baselined",
+				database.LatestAppliedVersion(history))
+		}
+
+		record := func() error {
+			for _, migration := range migrationsMap[enums.MIGRATION_UP] {
+				if migration.Version > version {
+					break
+				}
+
+				err := m.repository.SkipMigration(migration)
+				if err != nil {
+					return fmt.Errorf("error recording migration %d: %w", migration.Version, err)
+				}
+				baselined = append(baselined, migration.Version)
+			}
+
+			if len(baselined) == 0 {
+				return fmt.Errorf("there are no local migrations up to version %d", version)
+			}
+			return nil
+		}
+
+		if m.config.InTransaction && m.repository.Capabilities().SupportsTransactions {
+			err = m.repository.DoInTransaction(record)
+		} else {
+			err = record()
+		}
+		if err != nil {
+			return err
+		}
+
+		if m.logger != nil {
+			m.logger.Info("Recorded the migrations as applied without executing them",
+				zap.Uint16s("versions", baselined))
+		}
+
+		return m.syncHistory()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return baselined, nil
+}
@@ -0,0 +1,84 @@
+package migrator
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/maestro-go/maestro/internal/migrations"
+)
+
+// destinationFileMatch matches the version and description of a migration file name, of any track, with or
+// without its extensions.
+var destinationFileMatch = regexp.MustCompile(`^[VD](\d+)__?([^.]+)`)
+
+// Symbolic destinations, resolved against the local migrations and the latest applied version
+const (
+	destination_latest   = "latest"   // Latest local migration
+	destination_next     = "next"     // First pending migration, or the latest applied one if none is pending
+	destination_previous = "previous" // Migration applied before the latest applied one, or 0
+)
+
+// resolveDestination returns the version of the migration designated by the name: a symbolic destination
+// (latest, next or previous), a migration file name (e.g. "V147_add_orders_table.sql") or description (e.g.
+// "add_orders_table"). A description shared by several migrations is ambiguous and must be given as a file
+// name or version instead.
+func resolveDestination(name string, upMigrations []*migrations.Migration, latestApplied uint16) (uint16, error) {
+	switch name {
+	case destination_latest:
+		if len(upMigrations) < 1 {
+			return latestApplied, nil
+		}
+		return upMigrations[len(upMigrations)-1].Version, nil
+	case destination_next:
+		for _, migration := range upMigrations {
+			if migration.Version > latestApplied {
+				return migration.Version, nil
+			}
+		}
+		return latestApplied, nil
+	case destination_previous:
+		previous := uint16(0)
+		for _, migration := range upMigrations {
+			if migration.Version < latestApplied {
+				previous = migration.Version
+			}
+		}
+		return previous, nil
+	}
+
+	fileName := filepath.Base(name)
+	if matches := destinationFileMatch.FindStringSubmatch(fileName); matches != nil {
+		version, err := strconv.ParseUint(matches[1], 10, 16)
+		if err == nil {
+			for _, migration := range upMigrations {
+				if migration.Version == uint16(version) && migration.Description == matches[2] {
+					return migration.Version, nil
+				}
+			}
+		}
+	}
+
+	matching := make([]*migrations.Migration, 0, 1)
+	for _, migration := range upMigrations {
+		if migration.Description == name {
+			matching = append(matching, migration)
+		}
+	}
+
+	switch len(matching) {
+	case 0:
+		return 0, fmt.Errorf("no local migration matches destination %q", name)
+	case 1:
+		return matching[0].Version, nil
+	}
+
+	versions := make([]string, 0, len(matching))
+	for _, migration := range matching {
+		versions = append(versions, strconv.Itoa(int(migration.Version)))
+	}
+	return 0, fmt.Errorf("destination %q matches the migrations %s, use a version instead",
+		name, strings.Join(versions, ", "))
+}
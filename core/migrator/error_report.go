@@ -0,0 +1,186 @@
+package migrator
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// ErrorReport groups the errors of a failed run by migration version and by the migration or hook that
+// raised them, with their counts, so runs failing with many errors stay readable. It can be written to the
+// console with String, or encoded to JSON.
+type ErrorReport struct {
+	Count    int              `json:"count"`
+	Owners   []string         `json:"owners,omitempty"` // Teams owning the failed versions, to page
+	Versions []*VersionErrors `json:"versions,omitempty"`
+	Other    []string         `json:"other,omitempty"` // Errors not raised by a migration or hook (e.g. validation)
+}
+
+// VersionErrors are the errors of a migration version and of the hooks executed for it.
+type VersionErrors struct {
+	Version uint16         `json:"version"`          // 0 for the hooks running once per run
+	Owners  []string       `json:"owners,omitempty"` // Teams owning the version (see conf.OwnersConfig)
+	Errors  []*SourceError `json:"errors"`
+}
+
+// SourceError is an error raised by a migration or a hook.
+type SourceError struct {
+	Source  string `json:"source"` // "migration" or the file name of the hook
+	Message string `json:"message"`
+}
+
+// NewErrorReport returns the report of the errors of the run. The errors of the migrations and hooks are
+// taken from the result, the other errors of err are reported on their own. The result may be nil.
+func NewErrorReport(result *MigrationResult, err error) *ErrorReport {
+	report := &ErrorReport{}
+	grouped := map[uint16]*VersionErrors{}
+	reported := make([]error, 0)
+
+	add := func(version uint16, source string, owners []string, err error) {
+		group, ok := grouped[version]
+		if !ok {
+			group = &VersionErrors{Version: version, Errors: make([]*SourceError, 0)}
+			grouped[version] = group
+			report.Versions = append(report.Versions, group)
+		}
+
+		group.Owners = appendOwners(group.Owners, owners)
+		report.Owners = appendOwners(report.Owners, owners)
+
+		for _, leaf := range leafErrors(err) {
+			group.Errors = append(group.Errors, &SourceError{Source: source, Message: leaf.Error()})
+			reported = append(reported, leaf)
+			report.Count++
+		}
+	}
+
+	if result != nil {
+		for _, migration := range result.Migrations {
+			if migration.Err != nil {
+				add(migration.Version, "migration", migration.Owners, migration.Err)
+			}
+		}
+		for _, hook := range result.Hooks {
+			if hook.Err != nil {
+				add(hook.Migration, hook.FileName, hook.Owners, hook.Err)
+			}
+		}
+	}
+
+	sort.SliceStable(report.Versions, func(i, j int) bool {
+		return report.Versions[i].Version < report.Versions[j].Version
+	})
+
+	// The run errors wrap the errors of the result, which are not reported twice
+	for _, leaf := range leafErrors(err) {
+		if !isReported(leaf, reported) {
+			report.Other = append(report.Other, leaf.Error())
+			report.Count++
+		}
+	}
+
+	return report
+}
+
+// String writes the report for the console, one indented line per error under its version.
+func (r *ErrorReport) String() string {
+	builder := strings.Builder{}
+	builder.WriteString(r.Summary())
+	builder.WriteString("\n")
+
+	for _, group := range r.Versions {
+		owners := ""
+		if len(group.Owners) > 0 {
+			owners = ", owned by " + strings.Join(group.Owners, ", ")
+		}
+
+		if group.Version == 0 {
+			fmt.Fprintf(&builder, "  run hooks (%s%s):\n", countErrors(len(group.Errors)), owners)
+		} else {
+			fmt.Fprintf(&builder, "  version %d (%s%s):\n", group.Version, countErrors(len(group.Errors)), owners)
+		}
+
+		for _, err := range group.Errors {
+			fmt.Fprintf(&builder, "    %s: %s\n", err.Source, indent(err.Message, "      "))
+		}
+	}
+
+	if len(r.Other) > 0 {
+		fmt.Fprintf(&builder, "  other (%s):\n", countErrors(len(r.Other)))
+		for _, message := range r.Other {
+			fmt.Fprintf(&builder, "    %s\n", indent(message, "      "))
+		}
+	}
+
+	return builder.String()
+}
+
+// Summary returns the number of errors and of failed versions.
+func (r *ErrorReport) Summary() string {
+	versions := 0
+	for _, group := range r.Versions {
+		if group.Version != 0 {
+			versions++
+		}
+	}
+
+	if versions == 0 {
+		return countErrors(r.Count)
+	}
+
+	if versions == 1 {
+		return fmt.Sprintf("%s in 1 version", countErrors(r.Count))
+	}
+
+	return fmt.Sprintf("%s in %d versions", countErrors(r.Count), versions)
+}
+
+// appendOwners appends the owners missing from the list.
+func appendOwners(list []string, owners []string) []string {
+	for _, owner := range owners {
+		if !slices.Contains(list, owner) {
+			list = append(list, owner)
+		}
+	}
+	return list
+}
+
+// leafErrors flattens the errors joined by errors.Join, keeping the wrapping of single errors.
+func leafErrors(err error) []error {
+	if err == nil {
+		return nil
+	}
+
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		return []error{err}
+	}
+
+	leaves := make([]error, 0)
+	for _, err := range joined.Unwrap() {
+		leaves = append(leaves, leafErrors(err)...)
+	}
+	return leaves
+}
+
+func isReported(err error, reported []error) bool {
+	for _, target := range reported {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func countErrors(count int) string {
+	if count == 1 {
+		return "1 error"
+	}
+	return fmt.Sprintf("%d errors", count)
+}
+
+func indent(message string, prefix string) string {
+	return strings.ReplaceAll(message, "\n", "\n"+prefix)
+}
@@ -0,0 +1,94 @@
+package migrator
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/maestro-go/maestro/core/database"
+	"github.com/maestro-go/maestro/core/enums"
+	"github.com/maestro-go/maestro/internal/filesystem"
+)
+
+// ExplainedStatement is a DML statement of a pending migration with the plan estimated by the database.
+type ExplainedStatement struct {
+	Version     uint16
+	Description string
+	*database.StatementPlan
+	Flags []string // Reasons the statement is above the thresholds of the configuration, empty if it is not
+}
+
+// Explain estimates, with the planner of the database and without executing anything, the DML statements
+// of the up migrations a run would apply, and flags the statements costing more than the explain-max-cost
+// of the configuration or scanning a table with more rows than its explain-max-scan-rows. Statements the
+// planner rejects, e.g. on a table created by a previous pending migration, are returned with their error
+// and are not flagged. It fails if the repository can not explain statements.
+func (m *Migrator) Explain() ([]*ExplainedStatement, error) {
+	explainer, ok := m.repository.(database.Explainer)
+	if !ok {
+		return nil, errors.New("the driver does not support explaining statements")
+	}
+
+	migrationsMap, _, errs := filesystem.LoadObjectsFromFiles(m.config)
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	history, err := m.appliedHistory()
+	if err != nil {
+		return nil, err
+	}
+
+	pending, err := m.pendingUpMigrations(migrationsMap[enums.MIGRATION_UP], history)
+	if err != nil {
+		return nil, err
+	}
+
+	explained := make([]*ExplainedStatement, 0)
+	for _, migration := range pending {
+		// Skipped versions are recorded without being executed
+		if slices.Contains(m.config.SkipVersions, migration.Version) {
+			continue
+		}
+
+		plans, err := explainer.ExplainScript(*migration.Content)
+		if err != nil {
+			return nil, fmt.Errorf("error explaining migration %d: %w", migration.Version, err)
+		}
+
+		for _, plan := range plans {
+			statement := &ExplainedStatement{
+				Version:       migration.Version,
+				Description:   migration.Description,
+				StatementPlan: plan,
+			}
+			statement.Flags = m.explainFlags(plan)
+			explained = append(explained, statement)
+		}
+	}
+
+	return explained, nil
+}
+
+// explainFlags returns the reasons the plan is above the thresholds of the configuration.
+func (m *Migrator) explainFlags(plan *database.StatementPlan) []string {
+	flags := make([]string, 0)
+	if plan.Err != nil {
+		return flags
+	}
+
+	if m.config.ExplainMaxCost > 0 && plan.Cost > m.config.ExplainMaxCost {
+		flags = append(flags, fmt.Sprintf("cost %.2f above the maximum of %.2f", plan.Cost, m.config.ExplainMaxCost))
+	}
+
+	if m.config.ExplainMaxScanRows > 0 {
+		for _, scan := range plan.Scans {
+			if scan.Rows > m.config.ExplainMaxScanRows {
+				flags = append(flags, fmt.Sprintf("full scan of %s (%.0f rows) above the maximum of %.0f rows",
+					scan.Table, scan.Rows, m.config.ExplainMaxScanRows))
+			}
+		}
+	}
+
+	return flags
+}
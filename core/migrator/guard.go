@@ -0,0 +1,199 @@
+package migrator
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/maestro-go/maestro/core/database"
+	"go.uber.org/zap"
+)
+
+// guard_interval is the delay between two checks of the transaction of the migrations by the transaction guard.
+var guard_interval = 5 * time.Second
+
+// transactionGuard checks, on another connection and every guard_interval, the transaction running the
+// migrations. It warns once the transaction lasts, or one of its statements waits for a lock, longer than the
+// warning thresholds of the configuration, and cancels the transaction once they reach the abort thresholds.
+type transactionGuard struct {
+	logger  *zap.Logger
+	monitor database.TransactionMonitor
+
+	transactionWarnAfter  time.Duration
+	transactionAbortAfter time.Duration
+	lockWaitWarnAfter     time.Duration
+	lockWaitAbortAfter    time.Duration
+
+	stop chan struct{}
+	done chan struct{}
+
+	// Written by the goroutine of the guard, read once it is done
+	warnings       []string
+	cancelled      error
+	warnedDuration bool
+	warnedLockWait bool
+}
+
+// guardEnabled reports whether a threshold of the transaction guard is configured.
+func (m *Migrator) guardEnabled() bool {
+	return m.config.TransactionWarnAfter > 0 || m.config.TransactionAbortAfter > 0 ||
+		m.config.LockWaitWarnAfter > 0 || m.config.LockWaitAbortAfter > 0
+}
+
+// startTransactionGuard starts guarding the transaction of DoInTransaction, from its callback. It returns nil if
+// no threshold is configured or the repository can not monitor its transactions.
+func (m *Migrator) startTransactionGuard() *transactionGuard {
+	if !m.guardEnabled() {
+		return nil
+	}
+
+	monitor, ok := m.repository.(database.TransactionMonitor)
+	if !ok {
+		m.warn("The driver does not support monitoring transactions, the transaction guard is disabled")
+		return nil
+	}
+
+	guard := &transactionGuard{
+		logger:                m.logger,
+		monitor:               monitor,
+		transactionWarnAfter:  m.config.TransactionWarnAfter,
+		transactionAbortAfter: m.config.TransactionAbortAfter,
+		lockWaitWarnAfter:     m.config.LockWaitWarnAfter,
+		lockWaitAbortAfter:    m.config.LockWaitAbortAfter,
+		stop:                  make(chan struct{}),
+		done:                  make(chan struct{}),
+	}
+	go guard.run()
+
+	return guard
+}
+
+// stopTransactionGuard stops the guard and adds its warnings to the result of the run. It returns the reason the
+// guard cancelled the transaction, nil if it did not.
+func (m *Migrator) stopTransactionGuard(guard *transactionGuard) error {
+	if guard == nil {
+		return nil
+	}
+
+	close(guard.stop)
+	<-guard.done
+
+	m.result.Warnings = append(m.result.Warnings, guard.warnings...)
+	return guard.cancelled
+}
+
+func (g *transactionGuard) run() {
+	defer close(g.done)
+
+	ticker := time.NewTicker(guard_interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-g.stop:
+			return
+		case <-ticker.C:
+			if !g.check() {
+				return
+			}
+		}
+	}
+}
+
+// check checks the transaction once, and reports whether the guard goes on checking it.
+func (g *transactionGuard) check() bool {
+	activity, err := g.monitor.TransactionActivity()
+	if err != nil {
+		g.warn(fmt.Sprintf("Transaction guard stopped, error monitoring the transaction: %v", err), nil)
+		return false
+	}
+
+	if activity == nil {
+		return true
+	}
+
+	duration := activity.TransactionDuration.Round(time.Second)
+	lockWait := activity.LockWait.Round(time.Second)
+
+	if g.transactionAbortAfter > 0 && activity.TransactionDuration >= g.transactionAbortAfter {
+		return g.cancel(fmt.Sprintf("transaction open for %s, above transaction-abort-after (%s)%s",
+			duration, g.transactionAbortAfter, exclusiveLocks(activity)), activity)
+	}
+
+	if g.lockWaitAbortAfter > 0 && activity.LockWait >= g.lockWaitAbortAfter {
+		return g.cancel(fmt.Sprintf("statement waiting for a lock for %s, above lock-wait-abort-after (%s)%s",
+			lockWait, g.lockWaitAbortAfter, blockers(activity)), activity)
+	}
+
+	if g.transactionWarnAfter > 0 && activity.TransactionDuration >= g.transactionWarnAfter && !g.warnedDuration {
+		g.warnedDuration = true
+		g.warn(fmt.Sprintf("Transaction of the migrations open for %s, above transaction-warn-after (%s)%s",
+			duration, g.transactionWarnAfter, exclusiveLocks(activity)), activity)
+	}
+
+	// Each wait for a lock is reported once
+	if activity.LockWait == 0 {
+		g.warnedLockWait = false
+	} else if g.lockWaitWarnAfter > 0 && activity.LockWait >= g.lockWaitWarnAfter && !g.warnedLockWait {
+		g.warnedLockWait = true
+		g.warn(fmt.Sprintf("Statement of the migrations waiting for a lock for %s, above lock-wait-warn-after (%s)%s",
+			lockWait, g.lockWaitWarnAfter, blockers(activity)), activity)
+	}
+
+	return true
+}
+
+// warn logs the warning, with the running statement of the transaction if known, and keeps it for the result.
+func (g *transactionGuard) warn(message string, activity *database.TransactionActivity) {
+	if g.logger != nil {
+		fields := make([]zap.Field, 0, 2)
+		if activity != nil {
+			fields = append(fields, zap.Int("session", activity.ID), zap.String("query", activity.Query))
+		}
+		g.logger.Warn(message, fields...)
+	}
+	g.warnings = append(g.warnings, message)
+}
+
+// cancel cancels the transaction for the reason, and stops the guard.
+func (g *transactionGuard) cancel(reason string, activity *database.TransactionActivity) bool {
+	if g.logger != nil {
+		g.logger.Error("Cancelling the transaction of the migrations", zap.String("reason", reason),
+			zap.Int("session", activity.ID), zap.String("query", activity.Query))
+	}
+
+	g.cancelled = fmt.Errorf("transaction cancelled by the transaction guard: %s", reason)
+
+	err := g.monitor.CancelTransaction()
+	if err != nil {
+		g.cancelled = fmt.Errorf("error cancelling the transaction (%s): %w", reason, err)
+	}
+
+	return false
+}
+
+// exclusiveLocks describes the tables locked exclusively by the transaction, empty if there are none.
+func exclusiveLocks(activity *database.TransactionActivity) string {
+	if len(activity.ExclusiveLocks) == 0 {
+		return ""
+	}
+	return ", holding exclusive locks on " + strings.Join(activity.ExclusiveLocks, ", ")
+}
+
+// blockers describes the sessions holding the locks the transaction waits for, empty if they are not known.
+func blockers(activity *database.TransactionActivity) string {
+	if len(activity.Blockers) == 0 {
+		return ""
+	}
+
+	descriptions := make([]string, 0, len(activity.Blockers))
+	for _, blocker := range activity.Blockers {
+		description := fmt.Sprintf("session %d (user %s, %s", blocker.ID, blocker.User, blocker.State)
+		if blocker.TransactionDuration > 0 {
+			description += fmt.Sprintf(", transaction open for %s", blocker.TransactionDuration.Round(time.Second))
+		}
+		descriptions = append(descriptions, description+")")
+	}
+
+	return ", blocked by " + strings.Join(descriptions, ", ")
+}
@@ -1,12 +1,18 @@
 package migrator
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
 
 	"github.com/maestro-go/maestro/core/conf"
 	"github.com/maestro-go/maestro/core/database"
 	"github.com/maestro-go/maestro/core/enums"
+	"github.com/maestro-go/maestro/core/remote"
 	"github.com/maestro-go/maestro/internal/filesystem"
 	"github.com/maestro-go/maestro/internal/migrations"
 	"go.uber.org/zap"
@@ -18,29 +24,145 @@ type Migrator struct {
 	repository database.Repository
 
 	config *conf.MigrationConfig
+
+	run database.RunInfo
+
+	result *MigrationResult // Result of the current Migrate call
+
+	resume *ResumePoint // Failure point the current Migrate call resumes from, nil if not resuming
+
+	backup BackupFunc // Backup taken before runs executing destructive migrations, nil if disabled
+
+	historySync string // Previous history table kept in sync with the history table, empty if disabled
+
+	owners  *migrations.Owners  // Teams owning the migrations of the current Migrate call, nil if none is configured
+	ownedBy map[uint16][]string // Teams owning the up migrations of the current Migrate call, by version
 }
 
+// BackupFunc backs up the database before a run executes destructive migrations, given the latest applied
+// version, the one of the database once the backup is restored (see Migrator.Restore), and the versions of the
+// destructive migrations. It returns the location of the backup.
+type BackupFunc func(latest uint16, versions []uint16) (string, error)
+
 func NewMigrator(logger *zap.Logger, repository database.Repository, config *conf.MigrationConfig) *Migrator {
+	run := database.NewRunInfo()
+	run.LockIdentity = config.LockIdentity
+
+	// Log lines carry the run ID recorded in the history and audit rows of the run
+	if logger != nil {
+		logger = logger.With(zap.String("run_id", run.ID))
+	}
+
+	// Migrators sharing a repository run concurrently on their own sessions
+	if sessions, ok := repository.(database.SessionRepository); ok {
+		repository = sessions.Session()
+	}
+
 	return &Migrator{
 		logger:     logger,
 		repository: repository,
 		config:     config,
+		run:        run,
+	}
+}
+
+// RunID returns the ID of the run, recorded in the history and audit rows of the executed migrations.
+func (m *Migrator) RunID() string {
+	return m.run.ID
+}
+
+// SetBackup sets the backup taken before the runs executing destructive migrations (see
+// migrations.Migration.Destructive), after the validation and before the first migration. The run fails
+// without executing anything if the backup fails. A nil backup disables it.
+func (m *Migrator) SetBackup(backup BackupFunc) {
+	m.backup = backup
+}
+
+// SetHistorySync sets the previous name of the schema history table, whose rows are replaced with the ones of
+// the history table at the end of each run, so the processes still reading it during the rename of the table
+// see the applied migrations. The repository must implement database.HistoryCopier. An empty table disables it.
+func (m *Migrator) SetHistorySync(table string) {
+	m.historySync = table
+}
+
+// FetchRemoteLocations replaces the bucket URLs of the configured locations, s3://bucket/prefix, gs://bucket/prefix
+// or az://account/container/prefix, by local copies verified by their signed manifest (see remote.Fetch). It must
+// be called before the migrations are loaded, and the returned function removes the copies once done.
+func (m *Migrator) FetchRemoteLocations(ctx context.Context) (func(), error) {
+	return remote.Fetch(ctx, m.logger, m.config)
+}
+
+// withConfig returns a migrator of the same run with another configuration.
+func (m *Migrator) withConfig(config *conf.MigrationConfig) *Migrator {
+	return &Migrator{
+		logger:      m.logger,
+		repository:  m.repository,
+		config:      config,
+		run:         m.run,
+		backup:      m.backup,
+		historySync: m.historySync,
 	}
 }
 
 // Migrate performs database migrations based on the configuration and current state of the database.
-func (m *Migrator) Migrate() error {
-	return m.repository.DoInLock(func() error {
+// The result describes the executed migrations and hooks, also when an error is returned.
+func (m *Migrator) Migrate() (*MigrationResult, error) {
+	return m.migrate(false)
+}
 
-		// Load migrations and hooks to memory
-		migrationsMap, hooksMap, errs := filesystem.LoadObjectsFromFiles(m.config)
-		if len(errs) > 0 {
-			if m.logger != nil {
-				for _, err := range errs {
-					m.logger.Error("Error loading migrations and hooks", zap.Error(err))
+// migrate performs the migrations of Migrate. If inLock is set, the migration lock is already held by the caller,
+// which executes the run-start and run-end hooks around it (see inOneLock).
+func (m *Migrator) migrate(inLock bool) (*MigrationResult, error) {
+	m.result = newMigrationResult(m.run.ID, m.config.Down)
+	start := time.Now()
+
+	defer func() {
+		m.result.Duration = time.Since(start)
+	}()
+
+	m.repository.SetRunInfo(m.run)
+
+	// Load migrations and hooks to memory
+	migrationsMap, hooksMap, errs := filesystem.LoadObjectsFromFiles(m.config)
+	if len(errs) > 0 {
+		if m.logger != nil {
+			for _, err := range errs {
+				m.logger.Error("Error loading migrations and hooks", zap.Error(err))
+			}
+		}
+		return m.result, errors.Join(errs...)
+	}
+
+	err := m.loadOwners(migrationsMap[enums.MIGRATION_UP])
+	if err != nil {
+		return m.result, err
+	}
+
+	// Run start hooks are executed before the lock is acquired
+	if !inLock {
+		hErrs := m.executeHooks(hooksMap[enums.HOOK_RUN_START], nil)
+		if len(hErrs) > 0 {
+			return m.result, errors.Join(hErrs...)
+		}
+	}
+
+	run := func() error {
+
+		// Prepare the session before anything is read from the database
+		hErrs := m.executeHooks(hooksMap[enums.HOOK_BEFORE_VALIDATE], nil)
+		if len(hErrs) > 0 {
+			return errors.Join(hErrs...)
+		}
+
+		// Incompatible history tables are reported before anything is recorded in them
+		if checker, ok := m.repository.(database.HistorySchemaChecker); ok {
+			err := checker.CheckHistorySchema()
+			if err != nil {
+				if m.logger != nil {
+					m.logger.Error("Incompatible schema history table", zap.Error(err))
 				}
+				return err
 			}
-			return errors.Join(errs...)
 		}
 
 		// Assert that schema history table exists
@@ -52,19 +174,40 @@ func (m *Migrator) Migrate() error {
 			return err
 		}
 
-		latestMigration, err := m.repository.GetLatestMigration()
+		history, err := m.repository.GetAppliedMigrations()
 		if err != nil {
-			return fmt.Errorf("error getting latest migration: %w", err)
+			return fmt.Errorf("error getting applied migrations: %w", err)
+		}
+
+		latestMigration := database.LatestAppliedVersion(history)
+
+		m.result.InitialVersion = latestMigration
+		m.result.FinalVersion = latestMigration
+
+		if m.resume != nil {
+			err = m.prepareResume(migrationsMap[enums.MIGRATION_UP], latestMigration)
+			if err != nil {
+				return err
+			}
 		}
 
 		if (!m.config.Down && len(migrationsMap[enums.MIGRATION_UP]) < 1) ||
 			(m.config.Down && len(migrationsMap[enums.MIGRATION_DOWN]) < 1) {
-			if m.logger != nil {
-				m.logger.Warn("No migrations found in the specified directories")
-			}
+			m.warn("No migrations found in the specified directories")
 			return nil
 		}
 
+		// Resolve a destination given by name to its version
+		if m.config.DestinationName != "" {
+			destination, err := resolveDestination(m.config.DestinationName, migrationsMap[enums.MIGRATION_UP],
+				latestMigration)
+			if err != nil {
+				return err
+			}
+			m.config.Destination = &destination
+			m.config.DestinationName = ""
+		}
+
 		// Fix up migration destination to latest local version
 		if !m.config.Down && m.config.Destination == nil {
 			m.config.Destination = &migrationsMap[enums.MIGRATION_UP][len(migrationsMap[enums.MIGRATION_UP])-1].Version
@@ -76,49 +219,34 @@ func (m *Migrator) Migrate() error {
 			m.config.Destination = &zero
 		}
 
-		if m.config.Validate {
-
-			// Assert that there are no unsucceeded migrations in database
-			failingMigrations, err := m.repository.GetFailingMigrations()
-			if err != nil {
-				return fmt.Errorf("error getting failing migrations: %w", err)
-			}
+		versionRanges, err := migrations.ParseVersionRanges(m.config.Locations, m.config.VersionRanges)
+		if err != nil {
+			return err
+		}
 
-			if len(failingMigrations) > 0 {
-				errs = make([]error, 0)
-				for _, failingMigration := range failingMigrations {
-					if m.logger != nil {
-						m.logger.Error("Found an unsucceeded migration", zap.Uint16("version", failingMigration.Version))
-					}
-					errs = append(errs, fmt.Errorf("found an unsucceeded migration: %d", failingMigration.Version))
-				}
-				return errors.Join(errs...)
-			}
+		locationDependencies, err := migrations.ParseLocationDependencies(m.config.Locations,
+			m.config.LocationDependencies)
+		if err != nil {
+			return err
+		}
 
-			// Validate local migrations
-			errs = migrations.ValidateMigrations(migrationsMap[enums.MIGRATION_UP])
-			if len(errs) > 0 {
-				if m.logger != nil {
-					for _, err := range errs {
-						m.logger.Error("Validate local migrations error", zap.Error(err))
-					}
-				}
-				return errors.Join(errs...)
+		if m.config.Validate {
+			err = m.validate(migrationsMap[enums.MIGRATION_UP], history, latestMigration, versionRanges)
+			if err != nil {
+				return err
 			}
+		}
 
-			// Validate local <-> remote migrations
-			errs = m.repository.ValidateMigrations(migrationsMap[enums.MIGRATION_UP])
-			if len(errs) > 0 {
-				if m.logger != nil {
-					for _, err := range errs {
-						m.logger.Error("Validate database migrations error", zap.Error(err))
-					}
-				}
-				return errors.Join(errs...)
-			}
+		// The blocks of versions of the version ranges are applied on their own, so versions below the latest
+		// applied one may be pending, e.g. a shared version created after a version of a range was applied
+		upMigrations, from := migrationsMap[enums.MIGRATION_UP], latestMigration+1
+		upToDate := latestMigration == *m.config.Destination
+		if len(versionRanges) > 0 && !m.config.Down {
+			upMigrations, from = pendingMigrations(upMigrations, history), 1
+			upToDate = len(upMigrations) == 0 || upMigrations[0].Version > *m.config.Destination
 		}
 
-		if latestMigration == *m.config.Destination {
+		if upToDate {
 			if m.logger != nil {
 				m.logger.Info("Database is up to date", zap.Uint16("version", latestMigration))
 			}
@@ -126,17 +254,26 @@ func (m *Migrator) Migrate() error {
 		}
 
 		if !m.config.Down && *m.config.Destination < latestMigration {
-			if m.logger != nil {
-				m.logger.Warn("Trying to up migrate to a previous version", zap.Uint16("current", latestMigration), zap.Uint16("target", *m.config.Destination))
-			}
-			return nil
+			return m.wrongDestination(fmt.Sprintf("Trying to up migrate to a previous version (current: %d, target: %d)",
+				latestMigration, *m.config.Destination))
 		}
 
 		if m.config.Down && *m.config.Destination > latestMigration {
-			if m.logger != nil {
-				m.logger.Warn("Trying to down migrate to a later version", zap.Uint16("current", latestMigration), zap.Uint16("target", *m.config.Destination))
+			return m.wrongDestination(fmt.Sprintf("Trying to down migrate to a later version (current: %d, target: %d)",
+				latestMigration, *m.config.Destination))
+		}
+
+		err = m.checkLocationDependencies(locationDependencies, migrationsMap, history, upMigrations, from,
+			latestMigration)
+		if err != nil {
+			return err
+		}
+
+		if m.backup != nil {
+			err = m.backUp(migrationsMap, upMigrations, from, latestMigration)
+			if err != nil {
+				return err
 			}
-			return nil
 		}
 
 		// Define the migrate function to handle the migration process, either within a transaction or not
@@ -144,35 +281,496 @@ func (m *Migrator) Migrate() error {
 			if m.config.Down {
 				errs := m.migrateDown(migrationsMap[enums.MIGRATION_DOWN], hooksMap, latestMigration, *m.config.Destination)
 				if len(errs) > 0 {
-					if m.logger != nil {
-						for _, err := range errs {
-							m.logger.Error("Error migrating down", zap.Error(err))
-						}
-					}
-					return errors.Join(errs...)
+					m.logErrors("Error migrating down", errs)
+					return m.joinRunErrors(errs)
 				}
 				return nil
 			}
 
-			errs := m.migrateUp(migrationsMap[enums.MIGRATION_UP], hooksMap, latestMigration+1, *m.config.Destination)
+			errs := m.migrateUp(upMigrations, hooksMap, from, *m.config.Destination)
 			if len(errs) > 0 {
-				if m.logger != nil {
-					for _, err := range errs {
-						m.logger.Error("Error migrating up", zap.Error(err))
-					}
-				}
-				return errors.Join(errs...)
+				m.logErrors("Error migrating up", errs)
+				return m.joinRunErrors(errs)
 			}
 			return nil
 		}
 
-		if m.config.InTransaction {
-			return m.repository.DoInTransaction(func() error {
-				return migrate()
+		inTransaction := m.config.InTransaction
+		if inTransaction && !m.repository.Capabilities().SupportsTransactions {
+			m.warn("The database does not support transactions, migrating without transaction: the statements " +
+				"executed before a failure stay applied")
+			inTransaction = false
+		}
+
+		if !inTransaction && m.guardEnabled() {
+			m.warn("The transaction guard only monitors migrations run in a transaction, it is disabled")
+		}
+
+		if inTransaction {
+			err = m.repository.DoInTransaction(func() error {
+				guard := m.startTransactionGuard()
+				err := migrate()
+				return errors.Join(err, m.stopTransactionGuard(guard))
 			})
+			if err != nil {
+				m.result.RolledBack = true
+				m.result.FinalVersion = latestMigration
+			}
+			return err
+		}
+
+		err = migrate()
+		if err != nil && !m.config.Force {
+			m.result.Resume = m.resumePoint()
+		}
+		return err
+	}
+
+	// The previous history table is also synced after failed runs, as their failures are recorded
+	if inLock {
+		return m.result, errors.Join(run(), m.syncHistory())
+	}
+
+	err = m.repository.DoInLock(func() error {
+		return errors.Join(run(), m.syncHistory())
+	})
+
+	// Run end hooks are executed after the lock is released, also when the run failed
+	hErrs := m.executeHooks(hooksMap[enums.HOOK_RUN_END], nil)
+	if len(hErrs) > 0 {
+		err = errors.Join(append([]error{err}, hErrs...)...)
+	}
+
+	return m.result, err
+}
+
+// syncHistory replaces the rows of the previous history table with the ones of the history table, if set.
+func (m *Migrator) syncHistory() error {
+	if m.historySync == "" {
+		return nil
+	}
+
+	copier, ok := m.repository.(database.HistoryCopier)
+	if !ok {
+		return fmt.Errorf("the repository can not keep history table %s in sync", m.historySync)
+	}
+
+	exists, err := m.repository.CheckSchemaHistoryTable()
+	if err != nil || !exists {
+		return err
+	}
+
+	copied, err := copier.CopyHistoryTo(m.historySync)
+	if err != nil {
+		if m.logger != nil {
+			m.logger.Error("Error syncing the previous history table", zap.String("table", m.historySync), zap.Error(err))
+		}
+		return fmt.Errorf("error syncing history table %s: %w", m.historySync, err)
+	}
+
+	if m.logger != nil {
+		m.logger.Info("Synced the previous history table", zap.String("table", m.historySync), zap.Int64("rows", copied))
+	}
+	return nil
+}
+
+// backUp takes the backup if the run executes destructive migrations: the pending up migrations from the given
+// version, or the down migrations rolled back, up to the destination, without the skipped versions.
+func (m *Migrator) backUp(migrationsMap map[enums.MigrationType][]*migrations.Migration,
+	upMigrations []*migrations.Migration, from uint16, latestMigration uint16) error {
+
+	versions := make([]uint16, 0)
+	if m.config.Down {
+		for _, migration := range migrationsMap[enums.MIGRATION_DOWN] {
+			if migration.Destructive && migration.Version <= latestMigration && migration.Version > *m.config.Destination {
+				versions = append(versions, migration.Version)
+			}
+		}
+	} else {
+		for _, migration := range upMigrations {
+			if migration.Destructive && migration.Version >= from && migration.Version <= *m.config.Destination &&
+				!slices.Contains(m.config.SkipVersions, migration.Version) {
+				versions = append(versions, migration.Version)
+			}
+		}
+	}
+
+	if len(versions) == 0 {
+		return nil
+	}
+
+	if m.logger != nil {
+		m.logger.Info("Backing up the database before destructive migrations", zap.Uint16s("versions", versions))
+	}
+
+	location, err := m.backup(latestMigration, versions)
+	if err != nil {
+		return fmt.Errorf("error backing up the database before destructive migrations %v: %w", versions, err)
+	}
+
+	if m.logger != nil {
+		m.logger.Info("Database backed up", zap.String("location", location))
+	}
+	m.result.Backup = location
+
+	return nil
+}
+
+// warn logs the warning and adds it to the result of the run.
+func (m *Migrator) warn(message string) {
+	if m.logger != nil {
+		m.logger.Warn(message)
+	}
+	m.result.Warnings = append(m.result.Warnings, message)
+}
+
+// wrongDestination reports a destination on the wrong side of the latest applied version, where nothing
+// can be migrated: an error with the strict destination option, a warning otherwise.
+func (m *Migrator) wrongDestination(message string) error {
+	if m.config.StrictDestination {
+		if m.logger != nil {
+			m.logger.Error(message)
+		}
+		return errors.New(message)
+	}
+
+	m.warn(message)
+	return nil
+}
+
+// hookVariables returns the context variables of the hooks executed for the migration, nil for hooks running
+// once per run, available as ${maestro.<name>} placeholders.
+func (m *Migrator) hookVariables(migration *migrations.Migration) map[string]string {
+	direction := "up"
+	if m.config.Down {
+		direction = "down"
+	}
+
+	variables := map[string]string{
+		"version":     "",
+		"description": "",
+		"direction":   direction,
+		"run_id":      m.run.ID,
+	}
+
+	if migration != nil {
+		variables["version"] = strconv.Itoa(int(migration.Version))
+		variables["description"] = migration.Description
+	}
+
+	return variables
+}
+
+// loadOwners resolves the teams owning the up migrations of the run, with the owners of the configuration.
+func (m *Migrator) loadOwners(upMigrations []*migrations.Migration) error {
+	owners, err := migrations.ParseOwners(m.config.Locations, m.config.Owners)
+	if err != nil {
+		return err
+	}
+
+	m.owners, m.ownedBy = owners, nil
+	if owners == nil {
+		return nil
+	}
+
+	m.ownedBy = make(map[uint16][]string, len(upMigrations))
+	for _, migration := range upMigrations {
+		m.ownedBy[migration.Version] = owners.Of(migration)
+	}
+	return nil
+}
+
+// ownersOf returns the teams owning the version, the ones of its up migration, or the default team for the
+// hooks running once per run (version 0). Down migrations are owned by the owners of their up migration.
+func (m *Migrator) ownersOf(version uint16) []string {
+	if teams, ok := m.ownedBy[version]; ok {
+		return teams
+	}
+	return m.owners.Of(nil)
+}
+
+// skipMigration records the migration as applied without executing it.
+func (m *Migrator) skipMigration(migration *migrations.Migration) error {
+	m.warn(fmt.Sprintf("Skipping migration %d (%s): it is recorded as applied without being executed",
+		migration.Version, migration.Description))
+
+	err := m.repository.SkipMigration(migration)
+	if err != nil {
+		return fmt.Errorf("error skipping migration %d: %w", migration.Version, err)
+	}
+
+	m.result.Bypassed = append(m.result.Bypassed, migration.Version)
+	m.result.FinalVersion = max(m.result.FinalVersion, migration.Version)
+	return nil
+}
+
+// executeMigration runs the execution (or rollback) of the migration, recording it in the result of the run.
+func (m *Migrator) executeMigration(migration *migrations.Migration, execute func() []error) []error {
+	start := time.Now()
+	errs := execute()
+
+	m.result.Migrations = append(m.result.Migrations, &MigrationExecution{
+		Version:     migration.Version,
+		Description: migration.Description,
+		Duration:    time.Since(start),
+		Owners:      m.ownersOf(migration.Version),
+		Err:         errors.Join(errs...),
+	})
+
+	if len(errs) == 0 {
+		// Pending versions of version ranges may be below the latest applied one
+		m.result.FinalVersion = max(m.result.FinalVersion, migration.Version)
+		if m.config.Down {
+			m.result.FinalVersion = migration.Version - 1
+		}
+	}
+
+	return errs
+}
+
+// executeHook runs the hook with the context variables of the migration (nil for hooks running once per run),
+// recording it in the result of the run.
+func (m *Migrator) executeHook(hook *migrations.Hook, migration *migrations.Migration,
+	execute func(hook *migrations.Hook) error) error {
+
+	start := time.Now()
+
+	variablesHook := hook.WithVariables(m.hookVariables(migration))
+	var err error
+	if hook.OutsideTransaction {
+		err = m.repository.DoOutsideTransaction(func() error {
+			return execute(variablesHook)
+		})
+	} else {
+		err = execute(variablesHook)
+	}
+
+	execution := &HookExecution{
+		Type:     hook.Type,
+		Order:    hook.Order,
+		Version:  hook.Version,
+		FileName: hook.FileName,
+		Duration: time.Since(start),
+		Err:      err,
+	}
+	if migration != nil {
+		execution.Migration = migration.Version
+	}
+	execution.Owners = m.ownersOf(execution.Migration)
+	m.result.Hooks = append(m.result.Hooks, execution)
+
+	return err
+}
+
+// stopOnError reports whether the run stops after a failed migration or hook: always without force,
+// and once max-errors migrations and hooks failed with force.
+func (m *Migrator) stopOnError() bool {
+	if !m.config.Force {
+		return true
+	}
+	return m.config.MaxErrors > 0 && m.result.Failures() >= m.config.MaxErrors
+}
+
+// joinRunErrors joins the errors of the run, reporting when a forced run was aborted by max-errors.
+func (m *Migrator) joinRunErrors(errs []error) error {
+	if m.config.Force && m.config.MaxErrors > 0 && m.result.Failures() >= m.config.MaxErrors {
+		errs = append(errs, fmt.Errorf("run aborted after %d failed migrations and hooks (max-errors)", m.result.Failures()))
+	}
+	return errors.Join(errs...)
+}
+
+// logErrors logs the errors of the run. With force, as many errors may have accumulated, they are
+// reported grouped by migration version.
+func (m *Migrator) logErrors(message string, errs []error) {
+	if m.logger == nil {
+		return
+	}
+
+	if !m.config.Force {
+		for _, err := range errs {
+			m.logger.Error(message, zap.Error(err))
+		}
+		return
+	}
+
+	grouped := m.result.ErrorsByVersion()
+	versions := make([]uint16, 0, len(grouped))
+	for version := range grouped {
+		versions = append(versions, version)
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i] < versions[j]
+	})
+
+	for _, version := range versions {
+		m.logger.Error(message, zap.Uint16("version", version), zap.Errors("errors", grouped[version]))
+	}
+}
+
+// Reset rolls back every applied migration and then applies all the migrations again.
+// The down and destination options of the configuration are ignored.
+func (m *Migrator) Reset() error {
+	return m.rollBackAndApply(func(latestMigration uint16) (uint16, *uint16, error) {
+		return 1, nil, nil // Every version, applied again up to the latest local one
+	})
+}
+
+// Redo rolls back the given migration version, or the latest applied one if version is nil, and applies it again.
+// Migrations applied after the given version are also rolled back and applied again.
+// The down and destination options of the configuration are ignored.
+func (m *Migrator) Redo(version *uint16) error {
+	return m.rollBackAndApply(func(latestMigration uint16) (uint16, *uint16, error) {
+		if latestMigration == 0 {
+			return 0, nil, errors.New("there are no applied migrations to redo")
+		}
+
+		target := latestMigration
+		if version != nil {
+			target = *version
+		}
+
+		if target == 0 || target > latestMigration {
+			return 0, nil, fmt.Errorf("version %d is not applied, latest applied version is %d", target,
+				latestMigration)
+		}
+
+		return target, &latestMigration, nil
+	})
+}
+
+// rollBackAndApply rolls back the applied migrations from a version and applies them again, holding the migration
+// lock from the reads of the history to the end of the new application (see inOneLock). The version and the
+// destination of the new application (nil for the latest local version) are given by versions, from the latest
+// applied version.
+func (m *Migrator) rollBackAndApply(versions func(latestMigration uint16) (uint16, *uint16, error)) error {
+	return m.inOneLock(func(upConfig *conf.MigrationConfig) error {
+		history, err := m.repository.GetAppliedMigrations()
+		if err != nil {
+			return fmt.Errorf("error getting applied migrations: %w", err)
+		}
+
+		from, destination, err := versions(database.LatestAppliedVersion(history))
+		if err != nil {
+			return err
+		}
+
+		err = m.checkDownMigrations(history, from)
+		if err != nil {
+			return err
+		}
+
+		previousVersion := from - 1
+
+		downConfig := *m.config
+		downConfig.Down = true
+		downConfig.Destination = &previousVersion
+
+		_, err = m.withConfig(&downConfig).migrate(true)
+		if err != nil {
+			return fmt.Errorf("error rolling back migrations: %w", err)
+		}
+
+		upConfig.Destination = destination
+
+		_, err = m.withConfig(upConfig).migrate(true)
+		if err != nil {
+			return fmt.Errorf("error applying migrations: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// inOneLock runs the steps of reset, redo and fresh holding the migration lock, so no other run migrates the
+// database in between them. The steps are given the up configuration, with the latest local version as
+// destination. The run-start and run-end hooks are executed once, before the lock is acquired and after it is
+// released.
+func (m *Migrator) inOneLock(steps func(upConfig *conf.MigrationConfig) error) error {
+	upConfig := *m.config
+	upConfig.Down = false
+	upConfig.Destination = nil
+
+	_, hooksMap, errs := filesystem.LoadObjectsFromFiles(&upConfig)
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	// The run hooks are recorded in a result of their own, the runs in the lock having theirs
+	m.result = newMigrationResult(m.run.ID, false)
+	m.repository.SetRunInfo(m.run)
+
+	hErrs := m.executeHooks(hooksMap[enums.HOOK_RUN_START], nil)
+	if len(hErrs) > 0 {
+		return errors.Join(hErrs...)
+	}
+
+	err := m.repository.DoInLock(func() error {
+		return steps(&upConfig)
+	})
+
+	// Run end hooks are executed after the lock is released, also when the run failed
+	hErrs = m.executeHooks(hooksMap[enums.HOOK_RUN_END], nil)
+	if len(hErrs) > 0 {
+		err = errors.Join(append([]error{err}, hErrs...)...)
+	}
+
+	return err
+}
+
+// checkDownMigrations returns an error if a version of the history from the given one has no down migration, as it
+// would be skipped silently by the rollback, leaving the database and its history half rolled back.
+func (m *Migrator) checkDownMigrations(applied []*database.AppliedMigration, from uint16) error {
+	downConfig := *m.config
+	downConfig.Down = true
+
+	migrationsMap, _, errs := filesystem.LoadObjectsFromFiles(&downConfig)
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	downVersions := make(map[uint16]bool, len(migrationsMap[enums.MIGRATION_DOWN]))
+	for _, migration := range migrationsMap[enums.MIGRATION_DOWN] {
+		downVersions[migration.Version] = true
+	}
+
+	for _, migration := range applied {
+		if migration.Success && migration.Version >= from && !downVersions[migration.Version] {
+			return fmt.Errorf("missing down migration for version %d", migration.Version)
 		}
+	}
 
-		return migrate()
+	return nil
+}
+
+// Clean drops every object of the current schema, including the schema history table.
+func (m *Migrator) Clean() error {
+	return m.repository.DoInLock(func() error {
+		if m.logger != nil {
+			m.logger.Info("Dropping all objects of the current schema")
+		}
+		return m.repository.Clean()
+	})
+}
+
+// Fresh drops every object of the current schema and then applies all the migrations.
+// The down and destination options of the configuration are ignored.
+func (m *Migrator) Fresh() error {
+	return m.inOneLock(func(upConfig *conf.MigrationConfig) error {
+		if m.logger != nil {
+			m.logger.Info("Dropping all objects of the current schema")
+		}
+
+		err := m.repository.Clean()
+		if err != nil {
+			return fmt.Errorf("error cleaning database: %w", err)
+		}
+
+		_, err = m.withConfig(upConfig).migrate(true)
+		if err != nil {
+			return fmt.Errorf("error applying migrations: %w", err)
+		}
+
+		return nil
 	})
 }
 
@@ -180,10 +778,10 @@ func (m *Migrator) migrateUp(migrations []*migrations.Migration, hooks map[enums
 	errs := make([]error, 0)
 
 	if m.config.UseBefore {
-		hErrs := m.executeHooks(hooks[enums.HOOK_BEFORE])
+		hErrs := m.executeHooks(hooks[enums.HOOK_BEFORE], nil)
 		if len(hErrs) > 0 {
 			errs = append(errs, hErrs...)
-			if !m.config.Force {
+			if m.stopOnError() {
 				return errs
 			}
 		}
@@ -191,35 +789,48 @@ func (m *Migrator) migrateUp(migrations []*migrations.Migration, hooks map[enums
 
 	for _, migration := range migrations {
 		if migration.Version < from || migration.Version > to {
+			m.result.OutOfRange = append(m.result.OutOfRange, migration.Version)
+			continue
+		}
+
+		// Skipped versions are recorded as applied, without executing them nor their hooks
+		if slices.Contains(m.config.SkipVersions, migration.Version) {
+			err := m.skipMigration(migration)
+			if err != nil {
+				errs = append(errs, err)
+				if m.stopOnError() {
+					return errs
+				}
+			}
 			continue
 		}
 
 		// Do not execute repeatable before first migration
 		if m.config.UseRepeatable && migration.Version > 1 {
-			hErrs := m.executeHooks(hooks[enums.HOOK_REPEATABLE])
+			hErrs := m.executeHooks(hooks[enums.HOOK_REPEATABLE], migration)
 			if len(hErrs) > 0 {
 				errs = append(errs, hErrs...)
-				if !m.config.Force {
+				if m.stopOnError() {
 					return errs
 				}
 			}
 		}
 
 		if m.config.UseBeforeEach {
-			hErrs := m.executeHooks(hooks[enums.HOOK_BEFORE_EACH])
+			hErrs := m.executeHooks(hooks[enums.HOOK_BEFORE_EACH], migration)
 			if hErrs != nil {
 				errs = append(errs, hErrs...)
-				if !m.config.Force {
+				if m.stopOnError() {
 					return errs
 				}
 			}
 		}
 
 		if m.config.UseBeforeVersion {
-			hErrs := m.executeVersionedHooks(migration.Version, hooks[enums.HOOK_BEFORE_VERSION])
+			hErrs := m.executeVersionedHooks(migration, hooks[enums.HOOK_BEFORE_VERSION])
 			if len(hErrs) > 0 {
 				errs = append(errs, hErrs...)
-				if !m.config.Force {
+				if m.stopOnError() {
 					return errs
 				}
 			}
@@ -229,29 +840,31 @@ func (m *Migrator) migrateUp(migrations []*migrations.Migration, hooks map[enums
 			m.logger.Info("Migrating up", zap.Uint16("version", migration.Version),
 				zap.String("description", migration.Description))
 		}
-		mErrs := m.repository.ExecuteMigration(migration)
+		mErrs := m.executeMigration(migration, func() []error {
+			return m.repository.ExecuteMigration(migration)
+		})
 		if len(mErrs) > 0 {
 			errs = append(errs, mErrs...)
-			if !m.config.Force {
+			if m.stopOnError() {
 				return errs
 			}
 		}
 
 		if m.config.UseAfterVersion {
-			hErrs := m.executeVersionedHooks(migration.Version, hooks[enums.HOOK_AFTER_VERSION])
+			hErrs := m.executeVersionedHooks(migration, hooks[enums.HOOK_AFTER_VERSION])
 			if len(hErrs) > 0 {
 				errs = append(errs, hErrs...)
-				if !m.config.Force {
+				if m.stopOnError() {
 					return errs
 				}
 			}
 		}
 
 		if m.config.UseAfterEach {
-			hErrs := m.executeHooks(hooks[enums.HOOK_AFTER_EACH])
+			hErrs := m.executeHooks(hooks[enums.HOOK_AFTER_EACH], migration)
 			if hErrs != nil {
 				errs = append(errs, hErrs...)
-				if !m.config.Force {
+				if m.stopOnError() {
 					return errs
 				}
 			}
@@ -259,10 +872,21 @@ func (m *Migrator) migrateUp(migrations []*migrations.Migration, hooks map[enums
 	}
 
 	if m.config.UseAfter {
-		hErrs := m.executeHooks(hooks[enums.HOOK_AFTER])
+		hErrs := m.executeHooks(hooks[enums.HOOK_AFTER], nil)
 		if len(hErrs) > 0 {
 			errs = append(errs, hErrs...)
-			if !m.config.Force {
+			if m.stopOnError() {
+				return errs
+			}
+		}
+	}
+
+	// Assertions fail the run even if the migrations succeeded
+	if m.config.UseAssertions {
+		aErrs := m.executeAssertions(hooks[enums.HOOK_ASSERTION])
+		if len(aErrs) > 0 {
+			errs = append(errs, aErrs...)
+			if m.stopOnError() {
 				return errs
 			}
 		}
@@ -279,27 +903,54 @@ func (m *Migrator) migrateDown(migrations []*migrations.Migration, hooks map[enu
 
 	for _, migration := range migrations {
 		if from < migration.Version || to >= migration.Version {
+			m.result.OutOfRange = append(m.result.OutOfRange, migration.Version)
 			continue
 		}
 
+		if m.config.UseBeforeVersion {
+			hErrs := m.executeVersionedHooks(migration, hooks[enums.HOOK_BEFORE_VERSION_DOWN])
+			if len(hErrs) > 0 {
+				errs = append(errs, hErrs...)
+				if m.stopOnError() {
+					return errs
+				}
+			}
+		}
+
 		if m.logger != nil {
 			m.logger.Info("Rolling back", zap.Uint16("version", migration.Version),
 				zap.String("description", migration.Description))
 		}
-		err := m.repository.RollbackMigration(migration)
-		if err != nil {
-			errs = append(errs, fmt.Errorf("error rolling back migration %d: %w", migration.Version, err))
-			if !m.config.Force {
+		mErrs := m.executeMigration(migration, func() []error {
+			err := m.repository.RollbackMigration(migration)
+			if err != nil {
+				return []error{fmt.Errorf("error rolling back migration %d: %w", migration.Version, err)}
+			}
+			return nil
+		})
+		if len(mErrs) > 0 {
+			errs = append(errs, mErrs...)
+			if m.stopOnError() {
 				return errs
 			}
 		}
 
+		if m.config.UseAfterVersion {
+			hErrs := m.executeVersionedHooks(migration, hooks[enums.HOOK_AFTER_VERSION_DOWN])
+			if len(hErrs) > 0 {
+				errs = append(errs, hErrs...)
+				if m.stopOnError() {
+					return errs
+				}
+			}
+		}
+
 		// Do not execute repeatable after last migration
 		if m.config.UseRepeatable && migration.Version > to+1 {
-			hErrs := m.executeHooks(hooks[enums.HOOK_REPEATABLE_DOWN])
+			hErrs := m.executeHooks(hooks[enums.HOOK_REPEATABLE_DOWN], migration)
 			if len(hErrs) > 0 {
 				errs = append(errs, hErrs...)
-				if !m.config.Force {
+				if m.stopOnError() {
 					return errs
 				}
 			}
@@ -312,16 +963,37 @@ func (m *Migrator) migrateDown(migrations []*migrations.Migration, hooks map[enu
 	return nil
 }
 
-func (m *Migrator) executeHooks(hooks []*migrations.Hook) []error {
+func (m *Migrator) executeHooks(hooks []*migrations.Hook, migration *migrations.Migration) []error {
 	errs := make([]error, 0)
 	for _, hook := range hooks {
 		if m.logger != nil {
 			m.logger.Info("Executing hook", zap.Uint8("order", hook.Order), zap.String("type", hook.Type.Name()))
 		}
-		err := m.repository.ExecuteHook(hook)
+		err := m.executeHook(hook, migration, m.repository.ExecuteHook)
 		if err != nil {
 			errs = append(errs, fmt.Errorf("error executing hook %d_%s: %w", hook.Order, hook.Type.Name(), err))
-			if !m.config.Force {
+			if m.stopOnError() {
+				return errs
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (m *Migrator) executeAssertions(hooks []*migrations.Hook) []error {
+	errs := make([]error, 0)
+	for _, hook := range hooks {
+		if m.logger != nil {
+			m.logger.Info("Executing assertion", zap.Uint8("order", hook.Order), zap.String("file", hook.FileName))
+		}
+		err := m.executeHook(hook, nil, m.repository.ExecuteAssertion)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("error executing assertion %d (%s): %w", hook.Order, hook.FileName, err))
+			if m.stopOnError() {
 				return errs
 			}
 		}
@@ -333,19 +1005,19 @@ func (m *Migrator) executeHooks(hooks []*migrations.Hook) []error {
 	return nil
 }
 
-func (m *Migrator) executeVersionedHooks(version uint16, hooks []*migrations.Hook) []error {
+func (m *Migrator) executeVersionedHooks(migration *migrations.Migration, hooks []*migrations.Hook) []error {
 	errs := make([]error, 0)
 	for _, hook := range hooks {
-		if version == hook.Version {
+		if migration.Version == hook.Version {
 			if m.logger != nil {
 				m.logger.Info("Executing versioned hook", zap.Uint8("order", hook.Order), zap.Uint16("version", hook.Version),
 					zap.String("type", hook.Type.Name()))
 			}
-			err := m.repository.ExecuteHook(hook)
+			err := m.executeHook(hook, migration, m.repository.ExecuteHook)
 			if err != nil {
 				errs = append(errs, fmt.Errorf("error executing versioned hook %d_%d_%s: %w", hook.Order,
 					hook.Version, hook.Type.Name(), err))
-				if !m.config.Force {
+				if m.stopOnError() {
 					return errs
 				}
 			}
@@ -2,20 +2,35 @@ package migrator
 
 import (
 	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
 	"database/sql"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 
 	_ "github.com/lib/pq"
 	"github.com/maestro-go/maestro/core/conf"
 	"github.com/maestro-go/maestro/core/database"
 	"github.com/maestro-go/maestro/core/database/postgres"
 	"github.com/maestro-go/maestro/core/enums"
+	"github.com/maestro-go/maestro/core/remote"
+	"github.com/maestro-go/maestro/internal/filesystem"
+	"github.com/maestro-go/maestro/internal/migrations"
 	testUtils "github.com/maestro-go/maestro/internal/utils/testing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
 )
 
 type MigrationTestSuite struct {
@@ -124,6 +139,8 @@ func (s *MigrationTestSuite) insertHook(dir string, order uint16, version uint16
 		migrationName = fmt.Sprintf("R%.3d_%s.sql", order, name)
 	case enums.HOOK_REPEATABLE_DOWN:
 		migrationName = fmt.Sprintf("R%.3d_%s.down.sql", order, name)
+	case enums.HOOK_ASSERTION:
+		migrationName = fmt.Sprintf("T%.3d_%s.sql", order, name)
 	}
 
 	err := os.WriteFile(filepath.Join(dir, migrationName), []byte(*content), os.ModePerm)
@@ -141,7 +158,7 @@ func (s *MigrationTestSuite) TestMigrateFailingWithInvalidDir() {
 		Down:      false,
 	})
 
-	err := migrator.Migrate()
+	_, err := migrator.Migrate()
 	s.Assert().Error(err)
 }
 
@@ -154,7 +171,7 @@ func (s *MigrationTestSuite) TestMigrateWithoutMigrations() {
 		Down:      false,
 	})
 
-	err := migrator.Migrate()
+	_, err := migrator.Migrate()
 	s.Assert().NoError(err)
 }
 
@@ -199,7 +216,7 @@ func (s *MigrationTestSuite) TestMigrateUp() {
 		UseAfterVersion:  true,
 	})
 
-	err := migrator.Migrate()
+	_, err := migrator.Migrate()
 	s.Assert().NoError(err)
 
 	s.checkTableExists("test1", true)
@@ -243,7 +260,7 @@ func (s *MigrationTestSuite) TestMigrateDown() {
 		UseRepeatable: true,
 	})
 
-	err := migrator.Migrate()
+	_, err := migrator.Migrate()
 	s.Assert().NoError(err)
 
 	s.checkTableExists("test1", true)
@@ -252,7 +269,7 @@ func (s *MigrationTestSuite) TestMigrateDown() {
 
 	migrator.config.Down = true
 	migrator.config.Destination = testUtils.ToPtr(uint16(0)) // Reset destination
-	err = migrator.Migrate()
+	_, err = migrator.Migrate()
 	s.Assert().NoError(err)
 
 	s.checkTableExists("test1", false)
@@ -294,7 +311,7 @@ func (s *MigrationTestSuite) TestErrors() {
 		UseAfterVersion:  true,
 	})
 
-	err := migrator.Migrate()
+	_, err := migrator.Migrate()
 	s.Assert().Error(err)
 }
 
@@ -314,7 +331,7 @@ func (s *MigrationTestSuite) TestInvalidMigrationsDestination() {
 		InTransaction: true,
 	})
 
-	err := migrator.Migrate()
+	_, err := migrator.Migrate()
 	s.Assert().NoError(err)
 
 	s.checkTableExists("test1", true)
@@ -328,7 +345,7 @@ func (s *MigrationTestSuite) TestInvalidMigrationsDestination() {
 		Destination:   testUtils.ToPtr(uint16(1)),
 	})
 
-	err = migrator.Migrate()
+	_, err = migrator.Migrate()
 	s.Assert().NoError(err)
 
 	migrator = NewMigrator(zap.NewNop(), s.repository, &conf.MigrationConfig{
@@ -339,7 +356,7 @@ func (s *MigrationTestSuite) TestInvalidMigrationsDestination() {
 		Destination:   testUtils.ToPtr(uint16(3)),
 	})
 
-	err = migrator.Migrate()
+	_, err = migrator.Migrate()
 	s.Assert().NoError(err)
 }
 
@@ -358,12 +375,12 @@ func (s *MigrationTestSuite) TestMigrateFailWithFailingMigrations() {
 		Force:         true,
 	})
 
-	err := migrator.Migrate()
+	_, err := migrator.Migrate()
 	s.Assert().Error(err)
 
 	s.checkTableRecordsCount("schema_history", 1)
 
-	err = migrator.Migrate()
+	_, err = migrator.Migrate()
 	s.Assert().Error(err)
 }
 
@@ -383,7 +400,7 @@ func (s *MigrationTestSuite) TestMigrateFailWithLocalMigrationsGap() {
 		InTransaction: true,
 	})
 
-	err := migrator.Migrate()
+	_, err := migrator.Migrate()
 	s.Assert().Error(err)
 }
 
@@ -403,12 +420,1822 @@ func (s *MigrationTestSuite) TestMigrateWithInvalidChecksums() {
 		InTransaction: true,
 	})
 
-	err := migrator.Migrate()
+	_, err := migrator.Migrate()
 	s.Assert().NoError(err)
 
 	upContent2 = "CREATE TABLE test3 (id SERIAL PRIMARY KEY);"
 	s.insertMigration(migrationsDir, 2, "test2", &upContent2, false)
 
-	err = migrator.Migrate()
+	_, err = migrator.Migrate()
 	s.Assert().Error(err)
 }
+
+func (s *MigrationTestSuite) TestMigrateDataTrack() {
+	migrationsDir := s.T().TempDir()
+
+	upContent1 := "CREATE TABLE test1 (id SERIAL PRIMARY KEY);"
+	dataContent1 := "INSERT INTO test1 DEFAULT VALUES;"
+
+	s.insertMigration(migrationsDir, 1, "test1", &upContent1, false)
+	err := os.WriteFile(filepath.Join(migrationsDir, "D001__backfill.sql"), []byte(dataContent1), os.ModePerm)
+	s.Require().NoError(err)
+
+	migrator := NewMigrator(zap.NewNop(), s.repository, &conf.MigrationConfig{
+		Locations:     []string{migrationsDir},
+		Validate:      true,
+		InTransaction: true,
+	})
+
+	_, err = migrator.Migrate()
+	s.Assert().NoError(err)
+
+	dataRepository := postgres.NewPostgresRepository(s.ctx, s.suiteDb, testUtils.ToPtr("data_history"))
+	dataMigrator := NewMigrator(zap.NewNop(), dataRepository, &conf.MigrationConfig{
+		Locations:     []string{migrationsDir},
+		Track:         "data",
+		Validate:      true,
+		InTransaction: true,
+	})
+
+	_, err = dataMigrator.Migrate()
+	s.Assert().NoError(err)
+
+	s.checkTableRecordsCount("schema_history", 1)
+	s.checkTableRecordsCount("data_history", 1)
+	s.checkTableRecordsCount("test1", 1)
+}
+
+func (s *MigrationTestSuite) TestReset() {
+	migrationsDir := s.T().TempDir()
+
+	upContent1 := "CREATE TABLE test1 (id SERIAL PRIMARY KEY);"
+	upContent2 := "CREATE TABLE test2 (id SERIAL PRIMARY KEY);"
+	downContent1 := "DROP TABLE test1;"
+	downContent2 := "DROP TABLE test2;"
+
+	s.insertMigration(migrationsDir, 1, "test1", &upContent1, false)
+	s.insertMigration(migrationsDir, 2, "test2", &upContent2, false)
+	s.insertMigration(migrationsDir, 1, "test1", &downContent1, true)
+	s.insertMigration(migrationsDir, 2, "test2", &downContent2, true)
+
+	migrator := NewMigrator(zap.NewNop(), s.repository, &conf.MigrationConfig{
+		Locations:     []string{migrationsDir},
+		Validate:      true,
+		InTransaction: true,
+	})
+
+	_, err := migrator.Migrate()
+	s.Assert().NoError(err)
+
+	_, err = s.suiteDb.Exec("INSERT INTO test1 DEFAULT VALUES;")
+	s.Require().NoError(err)
+
+	err = migrator.Reset()
+	s.Assert().NoError(err)
+
+	s.checkTableExists("test1", true)
+	s.checkTableExists("test2", true)
+	s.checkTableRecordsCount("test1", 0)
+	s.checkTableRecordsCount("schema_history", 2)
+
+	// Both steps of the reset belong to the same run
+	s.checkTableRecordsCount("schema_history_audit", 6)
+
+	runs := 0
+	err = s.suiteDb.QueryRow("SELECT COUNT(DISTINCT run_id) FROM schema_history_audit WHERE run_id = $1;", migrator.run.ID).Scan(&runs)
+	s.Assert().NoError(err)
+	s.Assert().Equal(1, runs)
+}
+
+func (s *MigrationTestSuite) TestFresh() {
+	migrationsDir := s.T().TempDir()
+
+	upContent1 := "CREATE TABLE test1 (id SERIAL PRIMARY KEY);"
+	upContent2 := "CREATE TABLE test2 (id SERIAL PRIMARY KEY);"
+
+	s.insertMigration(migrationsDir, 1, "test1", &upContent1, false)
+	s.insertMigration(migrationsDir, 2, "test2", &upContent2, false)
+
+	// Leftovers from a previous run, without a matching history
+	_, err := s.suiteDb.Exec("CREATE TABLE leftover (id SERIAL PRIMARY KEY); CREATE TABLE test1 (id SERIAL PRIMARY KEY);")
+	s.Require().NoError(err)
+
+	migrator := NewMigrator(zap.NewNop(), s.repository, &conf.MigrationConfig{
+		Locations:     []string{migrationsDir},
+		Validate:      true,
+		InTransaction: true,
+	})
+
+	err = migrator.Fresh()
+	s.Assert().NoError(err)
+
+	s.checkTableExists("leftover", false)
+	s.checkTableExists("test1", true)
+	s.checkTableExists("test2", true)
+	s.checkTableRecordsCount("schema_history", 2)
+}
+
+func (s *MigrationTestSuite) TestRedo() {
+	migrationsDir := s.T().TempDir()
+
+	upContent1 := "CREATE TABLE test1 (id SERIAL PRIMARY KEY);"
+	upContent2 := "CREATE TABLE test2 (id SERIAL PRIMARY KEY);"
+	downContent1 := "DROP TABLE test1;"
+	downContent2 := "DROP TABLE test2;"
+
+	s.insertMigration(migrationsDir, 1, "test1", &upContent1, false)
+	s.insertMigration(migrationsDir, 2, "test2", &upContent2, false)
+	s.insertMigration(migrationsDir, 2, "test2", &downContent2, true)
+
+	migrator := NewMigrator(zap.NewNop(), s.repository, &conf.MigrationConfig{
+		Locations:     []string{migrationsDir},
+		Validate:      true,
+		InTransaction: true,
+	})
+
+	_, err := migrator.Migrate()
+	s.Assert().NoError(err)
+
+	_, err = s.suiteDb.Exec("INSERT INTO test1 DEFAULT VALUES; INSERT INTO test2 DEFAULT VALUES;")
+	s.Require().NoError(err)
+
+	// Latest migration
+	err = migrator.Redo(nil)
+	s.Assert().NoError(err)
+
+	s.checkTableRecordsCount("test1", 1)
+	s.checkTableRecordsCount("test2", 0)
+	s.checkTableRecordsCount("schema_history", 2)
+
+	// Version 1 has no down migration
+	version := uint16(1)
+	err = migrator.Redo(&version)
+	s.Assert().ErrorContains(err, "missing down migration for version 1")
+
+	s.insertMigration(migrationsDir, 1, "test1", &downContent1, true)
+
+	err = migrator.Redo(&version)
+	s.Assert().NoError(err)
+
+	s.checkTableRecordsCount("test1", 0)
+	s.checkTableExists("test2", true)
+	s.checkTableRecordsCount("schema_history", 2)
+
+	// Not applied version
+	version = 3
+	err = migrator.Redo(&version)
+	s.Assert().Error(err)
+}
+
+func (s *MigrationTestSuite) TestMigrateWithAssertions() {
+	migrationsDir := s.T().TempDir()
+
+	upContent1 := "CREATE TABLE test1 (id SERIAL PRIMARY KEY, name VARCHAR(255));"
+	upContent2 := "INSERT INTO test1 (name) VALUES (NULL);"
+	assertionContent1 := "SELECT COUNT(*) = 1 FROM test1;"
+	assertionContent2 := "SELECT id FROM test1 WHERE name IS NULL;"
+
+	s.insertMigration(migrationsDir, 1, "test1", &upContent1, false)
+	s.insertHook(migrationsDir, 1, 0, "count", &assertionContent1, enums.HOOK_ASSERTION)
+
+	migrator := NewMigrator(zap.NewNop(), s.repository, &conf.MigrationConfig{
+		Locations:     []string{migrationsDir},
+		Validate:      true,
+		InTransaction: true,
+		UseAssertions: true,
+	})
+
+	// The boolean assertion fails, rolling back the whole run
+	_, err := migrator.Migrate()
+	s.Assert().ErrorContains(err, "query returned false")
+
+	s.checkTableExists("test1", false)
+
+	s.insertMigration(migrationsDir, 2, "test2", &upContent2, false)
+	s.insertHook(migrationsDir, 2, 0, "names", &assertionContent2, enums.HOOK_ASSERTION)
+
+	// The rows assertion fails
+	migrator.config.Destination = nil
+	_, err = migrator.Migrate()
+	s.Assert().ErrorContains(err, "query returned 1 rows")
+
+	s.checkTableExists("test1", false)
+
+	// Assertions disabled
+	migrator.config.Destination = nil
+	migrator.config.UseAssertions = false
+	_, err = migrator.Migrate()
+	s.Assert().NoError(err)
+
+	s.checkTableRecordsCount("test1", 1)
+}
+
+// nonTransactionalRepository is a repository of a database without transactions, recording the executed migrations.
+type nonTransactionalRepository struct {
+	database.Repository
+	executed      []uint16
+	inTransaction bool
+}
+
+func (r *nonTransactionalRepository) Capabilities() database.Capabilities {
+	return database.Capabilities{}
+}
+
+func (r *nonTransactionalRepository) SetRunInfo(database.RunInfo)     {}
+func (r *nonTransactionalRepository) DoInLock(fn func() error) error  { return fn() }
+func (r *nonTransactionalRepository) AssertSchemaHistoryTable() error { return nil }
+
+func (r *nonTransactionalRepository) GetAppliedMigrations() ([]*database.AppliedMigration, error) {
+	return nil, nil
+}
+
+// appliedUpTo returns the history of a database where the migrations up to latest were successfully applied.
+func appliedUpTo(latest uint16) []*database.AppliedMigration {
+	applied := make([]*database.AppliedMigration, 0, latest)
+	for version := uint16(1); version <= latest; version++ {
+		applied = append(applied, &database.AppliedMigration{Version: version, Success: true})
+	}
+	return applied
+}
+
+func (r *nonTransactionalRepository) DoInTransaction(fn func() error) error {
+	r.inTransaction = true
+	return fn()
+}
+
+func (r *nonTransactionalRepository) ExecuteMigration(migration *migrations.Migration) []error {
+	r.executed = append(r.executed, migration.Version)
+	return nil
+}
+
+func TestMigrateWithoutTransactionSupport(t *testing.T) {
+	migrationsDir := t.TempDir()
+	err := os.WriteFile(filepath.Join(migrationsDir, "V001_test.sql"), []byte("SELECT 1;"), os.ModePerm)
+	assert.NoError(t, err)
+
+	repository := &nonTransactionalRepository{}
+	migrator := NewMigrator(zap.NewNop(), repository, &conf.MigrationConfig{
+		Locations:     []string{migrationsDir},
+		InTransaction: true,
+	})
+
+	result, err := migrator.Migrate()
+	assert.NoError(t, err)
+
+	assert.False(t, repository.inTransaction)
+	assert.Equal(t, []uint16{1}, repository.executed)
+
+	assert.Equal(t, []uint16{1}, result.Applied())
+	assert.Equal(t, uint16(0), result.InitialVersion)
+	assert.Equal(t, uint16(1), result.FinalVersion)
+	assert.Len(t, result.Warnings, 1)
+	assert.False(t, result.RolledBack)
+}
+
+// lockRecordingRepository records the executed hooks and whether the lock was held when they were executed.
+type lockRecordingRepository struct {
+	nonTransactionalRepository
+	locked  bool
+	outside bool
+	hooks   []string
+}
+
+func (r *lockRecordingRepository) DoOutsideTransaction(fn func() error) error {
+	r.outside = true
+	defer func() { r.outside = false }()
+	return fn()
+}
+
+func (r *lockRecordingRepository) DoInLock(fn func() error) error {
+	r.locked = true
+	defer func() { r.locked = false }()
+	return fn()
+}
+
+func (r *lockRecordingRepository) ExecuteHook(hook *migrations.Hook) error {
+	r.hooks = append(r.hooks, fmt.Sprintf("%s locked=%t outside=%t", hook.Type.Name(), r.locked, r.outside))
+	return nil
+}
+
+func TestMigrateRunHooksOutsideLock(t *testing.T) {
+	migrationsDir := t.TempDir()
+	files := map[string]string{
+		"V001_test.sql":       "SELECT 1;",
+		"RS001_start.sql":     "SELECT 1;",
+		"RE001_end.sql":       "SELECT 1;",
+		"BVAL001_prepare.sql": "SELECT 1;",
+	}
+	for name, content := range files {
+		err := os.WriteFile(filepath.Join(migrationsDir, name), []byte(content), os.ModePerm)
+		assert.NoError(t, err)
+	}
+
+	repository := &lockRecordingRepository{}
+	migrator := NewMigrator(zap.NewNop(), repository, &conf.MigrationConfig{
+		Locations:         []string{migrationsDir},
+		UseBeforeValidate: true,
+		UseRunStart:       true,
+		UseRunEnd:         true,
+	})
+
+	result, err := migrator.Migrate()
+	assert.NoError(t, err)
+	assert.Equal(t, []uint16{1}, result.Applied())
+
+	assert.Equal(t, []string{
+		"RUN_START locked=false outside=false",
+		"BEFORE_VALIDATE locked=true outside=false",
+		"RUN_END locked=false outside=false",
+	}, repository.hooks)
+	assert.Len(t, result.Hooks, 3)
+}
+
+func TestMigrateHooksOutsideTransaction(t *testing.T) {
+	migrationsDir := t.TempDir()
+	files := map[string]string{
+		"V001_test.sql":     "SELECT 1;",
+		"B001_before.sql":   "SELECT 1;",
+		"A001_notify.sql":   "-- maestro:no-transaction\nNOTIFY migrated;",
+		"AE001_analyze.sql": "SELECT 1;",
+	}
+	for name, content := range files {
+		err := os.WriteFile(filepath.Join(migrationsDir, name), []byte(content), os.ModePerm)
+		assert.NoError(t, err)
+	}
+
+	repository := &lockRecordingRepository{}
+	migrator := NewMigrator(zap.NewNop(), repository, &conf.MigrationConfig{
+		Locations:    []string{migrationsDir},
+		UseBefore:    true,
+		UseAfter:     true,
+		UseAfterEach: true,
+	})
+
+	_, err := migrator.Migrate()
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{
+		"BEFORE locked=true outside=false",
+		"AFTER_EACH locked=true outside=false",
+		"AFTER locked=true outside=true",
+	}, repository.hooks)
+}
+
+// rollbackRecordingRepository records the rolled back migrations and the executed hooks, in order.
+type rollbackRecordingRepository struct {
+	nonTransactionalRepository
+	latest uint16
+	events []string
+}
+
+func (r *rollbackRecordingRepository) GetAppliedMigrations() ([]*database.AppliedMigration, error) {
+	return appliedUpTo(r.latest), nil
+}
+
+func (r *rollbackRecordingRepository) RollbackMigration(migration *migrations.Migration) error {
+	r.events = append(r.events, fmt.Sprintf("rollback %d", migration.Version))
+	return nil
+}
+
+func (r *rollbackRecordingRepository) ExecuteHook(hook *migrations.Hook) error {
+	r.events = append(r.events, fmt.Sprintf("%s %s", hook.Type.Name(), *hook.Content))
+	return nil
+}
+
+func TestMigrateDownVersionedHooks(t *testing.T) {
+	migrationsDir := t.TempDir()
+	files := map[string]string{
+		"V001_test.down.sql":         "DROP TABLE test1;",
+		"V002_test.down.sql":         "DROP TABLE test2;",
+		"BV001_002_export.down.sql":  "${maestro.version}",
+		"AV001_002_restore.down.sql": "${maestro.direction}",
+		"BV001_002_up_only.sql":      "UP ONLY",
+	}
+	for name, content := range files {
+		err := os.WriteFile(filepath.Join(migrationsDir, name), []byte(content), os.ModePerm)
+		assert.NoError(t, err)
+	}
+
+	repository := &rollbackRecordingRepository{latest: 2}
+	migrator := NewMigrator(zap.NewNop(), repository, &conf.MigrationConfig{
+		Locations:        []string{migrationsDir},
+		Down:             true,
+		UseBeforeVersion: true,
+		UseAfterVersion:  true,
+	})
+
+	result, err := migrator.Migrate()
+	assert.NoError(t, err)
+	assert.Equal(t, []uint16{2, 1}, result.Applied())
+
+	assert.Equal(t, []string{
+		"BEFORE_VERSION_DOWN 2",
+		"rollback 2",
+		"AFTER_VERSION_DOWN down",
+		"rollback 1",
+	}, repository.events)
+}
+
+func TestResetMissingDownMigration(t *testing.T) {
+	migrationsDir := t.TempDir()
+	files := map[string]string{
+		"V001_a.sql":      "CREATE TABLE a (id INT);",
+		"V001_a.down.sql": "DROP TABLE a;",
+		"V002_b.sql":      "CREATE TABLE b (id INT);",
+		"V003_c.sql":      "CREATE TABLE c (id INT);",
+		"V003_c.down.sql": "DROP TABLE c;",
+	}
+	for name, content := range files {
+		err := os.WriteFile(filepath.Join(migrationsDir, name), []byte(content), os.ModePerm)
+		assert.NoError(t, err)
+	}
+
+	// Nothing is rolled back when an applied version has no down migration
+	repository := &rollbackRecordingRepository{latest: 3}
+	migrator := NewMigrator(zap.NewNop(), repository, &conf.MigrationConfig{Locations: []string{migrationsDir}})
+
+	err := migrator.Reset()
+	assert.ErrorContains(t, err, "missing down migration for version 2")
+	assert.Empty(t, repository.events)
+	assert.Empty(t, repository.executed)
+
+	err = os.WriteFile(filepath.Join(migrationsDir, "V002_b.down.sql"), []byte("DROP TABLE b;"), os.ModePerm)
+	assert.NoError(t, err)
+
+	err = migrator.Reset()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"rollback 3", "rollback 2", "rollback 1"}, repository.events)
+}
+
+// lockEventsRepository records the acquisitions of the lock, the rolled back and executed migrations and the
+// executed hooks, in order, and counts the reads of the history without the lock.
+type lockEventsRepository struct {
+	rollbackRecordingRepository
+	locked        bool
+	unlockedReads int
+}
+
+func (r *lockEventsRepository) DoInLock(fn func() error) error {
+	r.events = append(r.events, "lock")
+	r.locked = true
+	defer func() {
+		r.locked = false
+		r.events = append(r.events, "unlock")
+	}()
+	return fn()
+}
+
+func (r *lockEventsRepository) GetAppliedMigrations() ([]*database.AppliedMigration, error) {
+	if !r.locked {
+		r.unlockedReads++
+	}
+	return appliedUpTo(r.latest), nil
+}
+
+func (r *lockEventsRepository) RollbackMigration(migration *migrations.Migration) error {
+	r.latest = migration.Version - 1
+	return r.rollbackRecordingRepository.RollbackMigration(migration)
+}
+
+func (r *lockEventsRepository) Clean() error {
+	r.latest = 0
+	r.events = append(r.events, "clean")
+	return nil
+}
+
+func (r *lockEventsRepository) ExecuteMigration(migration *migrations.Migration) []error {
+	r.latest = migration.Version
+	r.events = append(r.events, fmt.Sprintf("execute %d", migration.Version))
+	return nil
+}
+
+func TestResetInOneLock(t *testing.T) {
+	migrationsDir := t.TempDir()
+	files := map[string]string{
+		"V001_a.sql":      "CREATE TABLE a (id INT);",
+		"V001_a.down.sql": "DROP TABLE a;",
+		"V002_b.sql":      "CREATE TABLE b (id INT);",
+		"V002_b.down.sql": "DROP TABLE b;",
+		"RS001_start.sql": "start",
+		"RE001_end.sql":   "end",
+	}
+	for name, content := range files {
+		err := os.WriteFile(filepath.Join(migrationsDir, name), []byte(content), os.ModePerm)
+		assert.NoError(t, err)
+	}
+
+	repository := &lockEventsRepository{rollbackRecordingRepository: rollbackRecordingRepository{latest: 2}}
+	migrator := NewMigrator(zap.NewNop(), repository, &conf.MigrationConfig{
+		Locations:   []string{migrationsDir},
+		UseRunStart: true,
+		UseRunEnd:   true,
+	})
+
+	// The history is read, rolled back and applied again in a single lock, the run hooks are executed once
+	err := migrator.Reset()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"RUN_START start", "lock", "rollback 2", "rollback 1", "execute 1", "execute 2",
+		"unlock", "RUN_END end"}, repository.events)
+
+	assert.Zero(t, repository.unlockedReads)
+	assert.Equal(t, uint16(2), repository.latest)
+}
+
+func TestFreshInOneLock(t *testing.T) {
+	migrationsDir := t.TempDir()
+	files := map[string]string{
+		"V001_a.sql":      "CREATE TABLE a (id INT);",
+		"V002_b.sql":      "CREATE TABLE b (id INT);",
+		"RS001_start.sql": "start",
+		"RE001_end.sql":   "end",
+	}
+	for name, content := range files {
+		err := os.WriteFile(filepath.Join(migrationsDir, name), []byte(content), os.ModePerm)
+		assert.NoError(t, err)
+	}
+
+	repository := &lockEventsRepository{rollbackRecordingRepository: rollbackRecordingRepository{latest: 2}}
+	migrator := NewMigrator(zap.NewNop(), repository, &conf.MigrationConfig{
+		Locations:   []string{migrationsDir},
+		UseRunStart: true,
+		UseRunEnd:   true,
+	})
+
+	// The schema is dropped and migrated again in a single lock, the run hooks are executed once
+	err := migrator.Fresh()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"RUN_START start", "lock", "clean", "execute 1", "execute 2", "unlock", "RUN_END end"},
+		repository.events)
+
+	assert.Zero(t, repository.unlockedReads)
+	assert.Equal(t, uint16(2), repository.latest)
+}
+
+func TestRedoInOneLock(t *testing.T) {
+	migrationsDir := t.TempDir()
+	files := map[string]string{
+		"V001_a.sql":      "CREATE TABLE a (id INT);",
+		"V002_b.sql":      "CREATE TABLE b (id INT);",
+		"V002_b.down.sql": "DROP TABLE b;",
+		"RS001_start.sql": "start",
+		"RE001_end.sql":   "end",
+	}
+	for name, content := range files {
+		err := os.WriteFile(filepath.Join(migrationsDir, name), []byte(content), os.ModePerm)
+		assert.NoError(t, err)
+	}
+
+	repository := &lockEventsRepository{rollbackRecordingRepository: rollbackRecordingRepository{latest: 2}}
+	migrator := NewMigrator(zap.NewNop(), repository, &conf.MigrationConfig{
+		Locations:   []string{migrationsDir},
+		UseRunStart: true,
+		UseRunEnd:   true,
+	})
+
+	// The latest version is read, rolled back and applied again in a single lock, the run hooks are executed once
+	err := migrator.Redo(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"RUN_START start", "lock", "rollback 2", "execute 2", "unlock", "RUN_END end"},
+		repository.events)
+
+	assert.Zero(t, repository.unlockedReads)
+	assert.Equal(t, uint16(2), repository.latest)
+}
+
+func TestMigrateStrictDestination(t *testing.T) {
+	migrationsDir := t.TempDir()
+	for _, name := range []string{"V001_test.sql", "V002_test.sql", "V003_test.sql"} {
+		err := os.WriteFile(filepath.Join(migrationsDir, name), []byte("SELECT 1;"), os.ModePerm)
+		assert.NoError(t, err)
+	}
+
+	destination := uint16(1)
+	config := &conf.MigrationConfig{
+		Locations:   []string{migrationsDir},
+		Destination: &destination,
+	}
+
+	// Nothing can be applied up to a previous version, only a warning by default
+	repository := &rollbackRecordingRepository{latest: 3}
+	result, err := NewMigrator(zap.NewNop(), repository, config).Migrate()
+	assert.NoError(t, err)
+	assert.Empty(t, result.Applied())
+	assert.Len(t, result.Warnings, 1)
+
+	config.StrictDestination = true
+
+	result, err = NewMigrator(zap.NewNop(), repository, config).Migrate()
+	assert.ErrorContains(t, err, "Trying to up migrate to a previous version (current: 3, target: 1)")
+	assert.Empty(t, result.Applied())
+	assert.Empty(t, repository.executed)
+
+	// The latest applied version is a valid destination
+	destination = 3
+	_, err = NewMigrator(zap.NewNop(), repository, config).Migrate()
+	assert.NoError(t, err)
+}
+
+// failingRepository is a repository failing every migration.
+type failingRepository struct {
+	nonTransactionalRepository
+}
+
+func (r *failingRepository) ExecuteMigration(migration *migrations.Migration) []error {
+	r.executed = append(r.executed, migration.Version)
+	return []error{fmt.Errorf("example error")}
+}
+
+func TestMigrateForceMaxErrors(t *testing.T) {
+	migrationsDir := t.TempDir()
+	for _, name := range []string{"V001_test.sql", "V002_test.sql", "V003_test.sql", "V004_test.sql"} {
+		err := os.WriteFile(filepath.Join(migrationsDir, name), []byte("SELECT 1;"), os.ModePerm)
+		assert.NoError(t, err)
+	}
+
+	repository := &failingRepository{}
+	migrator := NewMigrator(zap.NewNop(), repository, &conf.MigrationConfig{
+		Locations: []string{migrationsDir},
+		Force:     true,
+		MaxErrors: 2,
+	})
+
+	result, err := migrator.Migrate()
+	assert.ErrorContains(t, err, "max-errors")
+
+	assert.Equal(t, []uint16{1, 2}, repository.executed)
+	assert.Equal(t, 2, result.Failures())
+	assert.Len(t, result.ErrorsByVersion(), 2)
+	assert.Len(t, result.ErrorsByVersion()[1], 1)
+
+	// Without a maximum, every migration is executed
+	repository = &failingRepository{}
+	migrator = NewMigrator(zap.NewNop(), repository, &conf.MigrationConfig{
+		Locations: []string{migrationsDir},
+		Force:     true,
+	})
+
+	result, err = migrator.Migrate()
+	assert.Error(t, err)
+	assert.NotContains(t, err.Error(), "max-errors")
+
+	assert.Equal(t, []uint16{1, 2, 3, 4}, repository.executed)
+	assert.Equal(t, 4, result.Failures())
+}
+
+func TestErrorReport(t *testing.T) {
+	migrationsDir := t.TempDir()
+	for _, name := range []string{"V001_test.sql", "V002_test.sql", "V003_test.sql"} {
+		err := os.WriteFile(filepath.Join(migrationsDir, name), []byte("SELECT 1;"), os.ModePerm)
+		assert.NoError(t, err)
+	}
+
+	migrator := NewMigrator(zap.NewNop(), &failingRepository{}, &conf.MigrationConfig{
+		Locations: []string{migrationsDir},
+		Force:     true,
+		MaxErrors: 2,
+	})
+
+	result, err := migrator.Migrate()
+	assert.Error(t, err)
+
+	report := NewErrorReport(result, err)
+	assert.Equal(t, 3, report.Count)
+	assert.Len(t, report.Versions, 2)
+	assert.Equal(t, uint16(1), report.Versions[0].Version)
+	assert.Equal(t, []*SourceError{{Source: "migration", Message: "example error"}}, report.Versions[0].Errors)
+	assert.Equal(t, []string{"run aborted after 2 failed migrations and hooks (max-errors)"}, report.Other)
+
+	assert.Equal(t, `3 errors in 2 versions
+  version 1 (1 error):
+    migration: example error
+  version 2 (1 error):
+    migration: example error
+  other (1 error):
+    run aborted after 2 failed migrations and hooks (max-errors)
+`, report.String())
+
+	// Errors without result
+	report = NewErrorReport(nil, errors.Join(errors.New("first"), errors.New("second\nline")))
+	assert.Equal(t, "2 errors\n  other (2 errors):\n    first\n    second\n      line\n", report.String())
+}
+
+func TestErrorReportOwners(t *testing.T) {
+	migrationsDir := t.TempDir()
+	files := map[string]string{
+		"V001_test.sql": "-- maestro:tags pii\nSELECT 1;",
+		"V002_test.sql": "SELECT 2;",
+	}
+	for name, content := range files {
+		err := os.WriteFile(filepath.Join(migrationsDir, name), []byte(content), os.ModePerm)
+		assert.NoError(t, err)
+	}
+
+	config := &conf.MigrationConfig{
+		Locations: []string{migrationsDir},
+		Force:     true,
+		Owners: conf.OwnersConfig{
+			Tags:    map[string]string{"pii": "@acme/privacy"},
+			Default: "@acme/platform",
+		},
+	}
+
+	result, err := NewMigrator(zap.NewNop(), &failingRepository{}, config).Migrate()
+	assert.Error(t, err)
+	assert.Equal(t, []string{"@acme/privacy"}, result.Migrations[0].Owners)
+
+	report := NewErrorReport(result, err)
+	assert.Equal(t, []string{"@acme/privacy", "@acme/platform"}, report.Owners)
+	assert.Equal(t, []string{"@acme/platform"}, report.Versions[1].Owners)
+	assert.Contains(t, report.String(), "  version 1 (1 error, owned by @acme/privacy):\n")
+
+	// Owned locations must be migration locations
+	config.Owners.Locations = map[string]string{"./other": "@acme/other"}
+	_, err = NewMigrator(zap.NewNop(), &failingRepository{}, config).Migrate()
+	assert.ErrorContains(t, err, "owner of ./other: not a migrations location")
+}
+
+// resumableRepository fails the second statement of a migration once, recording the skipped statements.
+type resumableRepository struct {
+	nonTransactionalRepository
+	latest   uint16
+	failOnce uint16
+	skipped  map[uint16]int
+}
+
+func (r *resumableRepository) GetAppliedMigrations() ([]*database.AppliedMigration, error) {
+	return appliedUpTo(r.latest), nil
+}
+
+func (r *resumableRepository) ExecuteMigration(migration *migrations.Migration) []error {
+	r.skipped[migration.Version] = migration.SkipStatements
+	if migration.Version == r.failOnce {
+		r.failOnce = 0
+		return []error{&database.StatementError{Index: 2, Err: fmt.Errorf("statement 2: example error")}}
+	}
+	r.latest = migration.Version
+	return nil
+}
+
+func TestMigrateResume(t *testing.T) {
+	migrationsDir := t.TempDir()
+	for _, name := range []string{"V001_test.sql", "V002_test.sql", "V003_test.sql"} {
+		err := os.WriteFile(filepath.Join(migrationsDir, name), []byte("SELECT 1; SELECT 2;"), os.ModePerm)
+		assert.NoError(t, err)
+	}
+
+	repository := &resumableRepository{failOnce: 2, skipped: make(map[uint16]int)}
+	migrator := NewMigrator(zap.NewNop(), repository, &conf.MigrationConfig{
+		Locations: []string{migrationsDir},
+	})
+
+	result, err := migrator.Migrate()
+	assert.Error(t, err)
+	assert.Equal(t, &ResumePoint{RunID: result.RunID, Version: 2, Statement: 2}, result.Resume)
+
+	// The database changed since the failure
+	_, err = migrator.Resume(&ResumePoint{Version: 3, Statement: 2})
+	assert.Error(t, err)
+
+	result, err = migrator.Resume(result.Resume)
+	assert.NoError(t, err)
+	assert.Nil(t, result.Resume)
+	assert.Equal(t, []uint16{2, 3}, result.Applied())
+
+	assert.Equal(t, 1, repository.skipped[2])
+	assert.Equal(t, 0, repository.skipped[3])
+}
+
+// archivedRepository is a repository whose first applied migrations were archived out of the local migrations.
+type archivedRepository struct {
+	nonTransactionalRepository
+	latest   uint16
+	archived []uint16
+}
+
+func (r *archivedRepository) GetAppliedMigrations() ([]*database.AppliedMigration, error) {
+	return appliedUpTo(r.latest), nil
+}
+
+func (r *archivedRepository) ValidateMigrations(localMigrations []*migrations.Migration) []error {
+	errs := make([]error, 0)
+	for _, version := range r.archived {
+		errs = append(errs, &database.MismatchError{Version: version, Description: "archived"})
+	}
+	return errs
+}
+
+func TestMigrateValidateAllowMissing(t *testing.T) {
+	migrationsDir := t.TempDir()
+	for _, name := range []string{"V003_test.sql", "V004_test.sql", "V006_test.sql"} {
+		err := os.WriteFile(filepath.Join(migrationsDir, name), []byte("SELECT 1;"), os.ModePerm)
+		assert.NoError(t, err)
+	}
+
+	config := &conf.MigrationConfig{
+		Locations: []string{migrationsDir},
+		Validate:  true,
+	}
+	newRepository := func() *archivedRepository {
+		return &archivedRepository{latest: 3, archived: []uint16{1, 2}}
+	}
+
+	// The local migrations do not start at version 1
+	_, err := NewMigrator(zap.NewNop(), newRepository(), config).Migrate()
+	assert.Error(t, err)
+
+	// The gap between the local versions 4 and 6 is still reported
+	config.ValidateAllowMissing = true
+	_, err = NewMigrator(zap.NewNop(), newRepository(), config).Migrate()
+	assert.ErrorContains(t, err, "expected version 5 got 6")
+
+	// Pending migrations are not validated
+	config.ValidateAppliedOnly = true
+	repository := newRepository()
+	result, err := NewMigrator(zap.NewNop(), repository, config).Migrate()
+	assert.NoError(t, err)
+	assert.Equal(t, []uint16{4, 6}, result.Applied())
+	assert.Len(t, result.Warnings, 2)
+}
+
+// rangesRepository is a repository whose history has the given versions, reporting the missing ones as the
+// history gaps of the repositories.
+type rangesRepository struct {
+	nonTransactionalRepository
+	applied []uint16
+}
+
+func (r *rangesRepository) GetAppliedMigrations() ([]*database.AppliedMigration, error) {
+	applied := make([]*database.AppliedMigration, 0, len(r.applied))
+	for _, version := range r.applied {
+		applied = append(applied, &database.AppliedMigration{Version: version, Success: true})
+	}
+	return applied, nil
+}
+
+func (r *rangesRepository) ValidateMigrations(localMigrations []*migrations.Migration) []error {
+	errs := make([]error, 0)
+	expected := uint16(1)
+	for _, version := range r.applied {
+		if version != expected {
+			errs = append(errs, &database.MissingVersionError{Version: expected})
+		}
+		expected = version + 1
+	}
+	return errs
+}
+
+func TestMigrateVersionRanges(t *testing.T) {
+	sharedDir := t.TempDir()
+	authDir := t.TempDir()
+	files := map[string]string{
+		filepath.Join(sharedDir, "V001_test.sql"): "SELECT 1;",
+		filepath.Join(sharedDir, "V002_test.sql"): "SELECT 2;",
+		filepath.Join(authDir, "V1000_test.sql"):  "SELECT 1000;",
+		filepath.Join(authDir, "V1001_test.sql"):  "SELECT 1001;",
+	}
+	for path, content := range files {
+		err := os.WriteFile(path, []byte(content), os.ModePerm)
+		assert.NoError(t, err)
+	}
+
+	config := &conf.MigrationConfig{
+		Locations:     []string{sharedDir, authDir},
+		VersionRanges: map[string]string{authDir: "1000-1999"},
+		Validate:      true,
+	}
+
+	// The shared version created after a version of the range was applied is pending
+	repository := &rangesRepository{applied: []uint16{1, 1000}}
+	result, err := NewMigrator(zap.NewNop(), repository, config).Migrate()
+	assert.NoError(t, err)
+	assert.Equal(t, []uint16{2, 1001}, repository.executed)
+	assert.Equal(t, uint16(1001), result.FinalVersion)
+
+	// The versions of each block are still contiguous
+	err = os.Remove(filepath.Join(authDir, "V1000_test.sql"))
+	assert.NoError(t, err)
+
+	repository = &rangesRepository{applied: []uint16{1}}
+	_, err = NewMigrator(zap.NewNop(), repository, config).Migrate()
+	assert.ErrorContains(t, err, "expected version 1000 got 1001")
+
+	// Without ranges, the versions are applied in order
+	err = os.WriteFile(filepath.Join(authDir, "V1000_test.sql"), []byte("SELECT 1000;"), os.ModePerm)
+	assert.NoError(t, err)
+
+	config.VersionRanges = nil
+	repository = &rangesRepository{applied: []uint16{1, 1000}}
+	_, err = NewMigrator(zap.NewNop(), repository, config).Migrate()
+	assert.ErrorContains(t, err, "expected version 3 got 1000")
+}
+
+func TestMigrateLocationDependencies(t *testing.T) {
+	coreDir := t.TempDir()
+	billingDir := t.TempDir()
+	files := map[string]string{
+		filepath.Join(coreDir, "V1000_test.sql"):   "SELECT 1000;",
+		filepath.Join(coreDir, "V1001_test.sql"):   "SELECT 1001;",
+		filepath.Join(billingDir, "V500_test.sql"): "SELECT 500;",
+	}
+	for path, content := range files {
+		err := os.WriteFile(path, []byte(content), os.ModePerm)
+		assert.NoError(t, err)
+	}
+
+	config := &conf.MigrationConfig{
+		Locations:            []string{coreDir, billingDir},
+		VersionRanges:        map[string]string{coreDir: "1000-1999", billingDir: "500-999"},
+		LocationDependencies: map[string]map[string]uint16{billingDir: {coreDir: 1001}},
+		Validate:             true,
+	}
+
+	// The migration of billing would run before the version of core it requires, nothing is executed
+	repository := &rangesRepository{applied: []uint16{1000}}
+	_, err := NewMigrator(zap.NewNop(), repository, config).Migrate()
+	assert.ErrorContains(t, err, "migration 500 of "+billingDir+" requires version 1001 of "+coreDir)
+	assert.Empty(t, repository.executed)
+
+	repository = &rangesRepository{applied: []uint16{1000, 1001}}
+	_, err = NewMigrator(zap.NewNop(), repository, config).Migrate()
+	assert.NoError(t, err)
+	assert.Equal(t, []uint16{500}, repository.executed)
+}
+
+func TestMigrateValidationIgnore(t *testing.T) {
+	migrationsDir := t.TempDir()
+	files := map[string]string{
+		"V001_test.sql": "SELECT 1;",
+		"V002_test.sql": "-- maestro:skip-validation\nSELECT 2;",
+		"V003_test.sql": "SELECT 3;",
+	}
+	for name, content := range files {
+		err := os.WriteFile(filepath.Join(migrationsDir, name), []byte(content), os.ModePerm)
+		assert.NoError(t, err)
+	}
+
+	config := &conf.MigrationConfig{
+		Locations:        []string{migrationsDir},
+		Validate:         true,
+		ValidationIgnore: []uint16{1},
+	}
+
+	repository := &archivedRepository{latest: 2, archived: []uint16{1, 2}}
+	result, err := NewMigrator(zap.NewNop(), repository, config).Migrate()
+	assert.NoError(t, err)
+	assert.Equal(t, []uint16{3}, result.Applied())
+
+	// Mismatches of other versions still fail the run
+	repository = &archivedRepository{latest: 2, archived: []uint16{1, 2, 3}}
+	_, err = NewMigrator(zap.NewNop(), repository, config).Migrate()
+	assert.ErrorContains(t, err, "version: 3")
+}
+
+func TestMigrateDestinationName(t *testing.T) {
+	migrationsDir := t.TempDir()
+	files := map[string]string{
+		"V001_create_users.sql":       "SELECT 1;",
+		"V002_add_orders_table.sql":   "SELECT 2;",
+		"V003_add_index.sql":          "SELECT 3;",
+		"V004_add_index.sql":          "SELECT 4;",
+		"V005_add_invoices_table.sql": "SELECT 5;",
+	}
+	for name, content := range files {
+		err := os.WriteFile(filepath.Join(migrationsDir, name), []byte(content), os.ModePerm)
+		assert.NoError(t, err)
+	}
+
+	migrate := func(name string) (*nonTransactionalRepository, error) {
+		repository := &nonTransactionalRepository{}
+		migrator := NewMigrator(zap.NewNop(), repository, &conf.MigrationConfig{
+			Locations:       []string{migrationsDir},
+			DestinationName: name,
+		})
+		_, err := migrator.Migrate()
+		return repository, err
+	}
+
+	repository, err := migrate("add_orders_table")
+	assert.NoError(t, err)
+	assert.Equal(t, []uint16{1, 2}, repository.executed)
+
+	repository, err = migrate("migrations/V004_add_index.sql")
+	assert.NoError(t, err)
+	assert.Equal(t, []uint16{1, 2, 3, 4}, repository.executed)
+
+	_, err = migrate("add_index")
+	assert.ErrorContains(t, err, "matches the migrations 3, 4")
+
+	_, err = migrate("drop_everything")
+	assert.ErrorContains(t, err, "no local migration matches")
+}
+
+func TestResolveSymbolicDestination(t *testing.T) {
+	upMigrations := []*migrations.Migration{{Version: 1}, {Version: 2}, {Version: 4}, {Version: 7}}
+
+	testCases := []struct {
+		name          string
+		latestApplied uint16
+		expected      uint16
+	}{
+		{name: "latest", latestApplied: 2, expected: 7},
+		{name: "next", latestApplied: 0, expected: 1},
+		{name: "next", latestApplied: 2, expected: 4},
+		{name: "next", latestApplied: 7, expected: 7},
+		{name: "previous", latestApplied: 4, expected: 2},
+		{name: "previous", latestApplied: 1, expected: 0},
+		{name: "previous", latestApplied: 0, expected: 0},
+	}
+
+	for _, testCase := range testCases {
+		destination, err := resolveDestination(testCase.name, upMigrations, testCase.latestApplied)
+		assert.NoError(t, err)
+		assert.Equal(t, testCase.expected, destination, "%s from %d", testCase.name, testCase.latestApplied)
+	}
+}
+
+// skippingRepository records the skipped migrations and the executed hooks.
+type skippingRepository struct {
+	nonTransactionalRepository
+	skipped []uint16
+	hooks   []uint16
+}
+
+func (r *skippingRepository) SkipMigration(migration *migrations.Migration) error {
+	r.skipped = append(r.skipped, migration.Version)
+	return nil
+}
+
+func (r *skippingRepository) ExecuteHook(hook *migrations.Hook) error {
+	r.hooks = append(r.hooks, hook.Version)
+	return nil
+}
+
+func TestMigrateSkipVersions(t *testing.T) {
+	migrationsDir := t.TempDir()
+	files := map[string]string{
+		"V001_test.sql":       "SELECT 1;",
+		"V002_broken.sql":     "SELECT broken;",
+		"V003_test.sql":       "SELECT 3;",
+		"BV01_002_before.sql": "SELECT 2;",
+		"AV01_003_after.sql":  "SELECT 3;",
+	}
+	for name, content := range files {
+		err := os.WriteFile(filepath.Join(migrationsDir, name), []byte(content), os.ModePerm)
+		assert.NoError(t, err)
+	}
+
+	repository := &skippingRepository{}
+	migrator := NewMigrator(zap.NewNop(), repository, &conf.MigrationConfig{
+		Locations:        []string{migrationsDir},
+		UseBeforeVersion: true,
+		UseAfterVersion:  true,
+		SkipVersions:     []uint16{2},
+	})
+
+	result, err := migrator.Migrate()
+	assert.NoError(t, err)
+
+	assert.Equal(t, []uint16{1, 3}, repository.executed)
+	assert.Equal(t, []uint16{2}, repository.skipped)
+	assert.Equal(t, []uint16{3}, repository.hooks) // The hooks of the skipped version are not executed
+
+	assert.Equal(t, []uint16{1, 3}, result.Applied())
+	assert.Equal(t, []uint16{2}, result.Bypassed)
+	assert.Empty(t, result.OutOfRange) // Bypassed versions are in the range of the run
+	assert.Equal(t, uint16(3), result.FinalVersion)
+}
+
+// sessionRepository records the sessions opened by the migrators, each with its own run info and executed migrations.
+type sessionRepository struct {
+	nonTransactionalRepository
+	run      database.RunInfo
+	mu       *sync.Mutex
+	sessions *[]*sessionRepository
+}
+
+func (r *sessionRepository) Session() database.Repository {
+	session := &sessionRepository{mu: r.mu, sessions: r.sessions}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	*r.sessions = append(*r.sessions, session)
+
+	return session
+}
+
+func (r *sessionRepository) SetRunInfo(info database.RunInfo) {
+	r.run = info
+}
+
+func TestMigrateConcurrentSessions(t *testing.T) {
+	migrationsDir := t.TempDir()
+	for _, name := range []string{"V001_test.sql", "V002_test.sql"} {
+		err := os.WriteFile(filepath.Join(migrationsDir, name), []byte("SELECT 1;"), os.ModePerm)
+		assert.NoError(t, err)
+	}
+
+	repository := &sessionRepository{mu: &sync.Mutex{}, sessions: &[]*sessionRepository{}}
+
+	migrators := make([]*Migrator, 4)
+	for i := range migrators {
+		migrators[i] = NewMigrator(zap.NewNop(), repository, &conf.MigrationConfig{Locations: []string{migrationsDir}})
+	}
+
+	group := errgroup.Group{}
+	for _, migrator := range migrators {
+		group.Go(func() error {
+			_, err := migrator.Migrate()
+			return err
+		})
+	}
+	assert.NoError(t, group.Wait())
+
+	// Every migrator ran on its own session
+	assert.Len(t, *repository.sessions, len(migrators))
+	for i, session := range *repository.sessions {
+		assert.Equal(t, migrators[i].RunID(), session.run.ID)
+		assert.Equal(t, []uint16{1, 2}, session.executed)
+	}
+	assert.Empty(t, repository.executed)
+}
+
+func TestOrder(t *testing.T) {
+	migrationsDir := t.TempDir()
+	for _, name := range []string{"V001_create.sql", "V002_users.sql", "V003_orders.sql", "RS01_start.sql",
+		"B01_setup.sql", "BE01_prepare.sql", "AV01_002_index.sql", "T01_check.sql"} {
+		err := os.WriteFile(filepath.Join(migrationsDir, name), []byte("SELECT 1;"), os.ModePerm)
+		assert.NoError(t, err)
+	}
+
+	steps, err := Order(&conf.MigrationConfig{
+		Locations:       []string{migrationsDir},
+		UseRunStart:     true,
+		UseBeforeEach:   true,
+		UseAfterVersion: true,
+		UseAssertions:   true,
+	}, 1)
+	assert.NoError(t, err)
+
+	// Disabled hooks (B01_setup) and applied migrations are left out
+	lines := make([]string, 0, len(steps))
+	for _, step := range steps {
+		lines = append(lines, step.String())
+	}
+	assert.Equal(t, []string{
+		"hook RS01_start.sql",
+		"hook BE01_prepare.sql (version 2)",
+		"migrate 2 users",
+		"hook AV01_002_index.sql (version 2)",
+		"hook BE01_prepare.sql (version 3)",
+		"migrate 3 orders",
+		"assertion T01_check.sql",
+	}, lines)
+}
+
+// explainingRepository estimates every statement of a script with the cost and scanned rows of its script.
+type explainingRepository struct {
+	nonTransactionalRepository
+	latest uint16
+	plans  map[string]*database.StatementPlan
+}
+
+func (r *explainingRepository) CheckSchemaHistoryTable() (bool, error) { return true, nil }
+
+func (r *explainingRepository) GetAppliedMigrations() ([]*database.AppliedMigration, error) {
+	return appliedUpTo(r.latest), nil
+}
+
+func (r *explainingRepository) ExplainScript(script string) ([]*database.StatementPlan, error) {
+	plan := *r.plans[script]
+	return []*database.StatementPlan{&plan}, nil
+}
+
+func TestExplain(t *testing.T) {
+	migrationsDir := t.TempDir()
+	files := map[string]string{
+		"V001_applied.sql":  "UPDATE a SET x = 1;",
+		"V002_cheap.sql":    "UPDATE b SET x = 1 WHERE id = 1;",
+		"V003_backfill.sql": "UPDATE c SET x = 1;",
+		"V004_missing.sql":  "INSERT INTO d SELECT 1;",
+		"V005_skipped.sql":  "DELETE FROM e;",
+	}
+	for name, content := range files {
+		err := os.WriteFile(filepath.Join(migrationsDir, name), []byte(content), os.ModePerm)
+		assert.NoError(t, err)
+	}
+
+	repository := &explainingRepository{latest: 1, plans: map[string]*database.StatementPlan{
+		"UPDATE b SET x = 1 WHERE id = 1;": {Index: 1, Cost: 8},
+		"UPDATE c SET x = 1;": {Index: 1, Cost: 25000,
+			Scans: []*database.TableScan{{Table: "public.c", Rows: 2000000}}},
+		"INSERT INTO d SELECT 1;": {Index: 1, Err: errors.New(`relation "d" does not exist`)},
+	}}
+	migrator := NewMigrator(zap.NewNop(), repository, &conf.MigrationConfig{
+		Locations:          []string{migrationsDir},
+		SkipVersions:       []uint16{5},
+		ExplainMaxCost:     10000,
+		ExplainMaxScanRows: 1000000,
+	})
+
+	explained, err := migrator.Explain()
+	assert.NoError(t, err)
+	if assert.Len(t, explained, 3) {
+		assert.Equal(t, uint16(2), explained[0].Version)
+		assert.Empty(t, explained[0].Flags)
+		assert.Equal(t, uint16(3), explained[1].Version)
+		assert.Equal(t, []string{
+			"cost 25000.00 above the maximum of 10000.00",
+			"full scan of public.c (2000000 rows) above the maximum of 1000000 rows",
+		}, explained[1].Flags)
+		assert.Error(t, explained[2].Err)
+		assert.Empty(t, explained[2].Flags)
+	}
+
+	_, err = NewMigrator(zap.NewNop(), &nonTransactionalRepository{}, &conf.MigrationConfig{
+		Locations: []string{migrationsDir},
+	}).Explain()
+	assert.ErrorContains(t, err, "does not support explaining")
+}
+
+func TestPending(t *testing.T) {
+	migrationsDir := t.TempDir()
+	for _, name := range []string{"V001_applied.sql", "V002_pending.sql", "V003_skipped.sql", "V004_later.sql"} {
+		err := os.WriteFile(filepath.Join(migrationsDir, name), []byte("SELECT 1;"), os.ModePerm)
+		assert.NoError(t, err)
+	}
+
+	destination := uint16(3)
+	config := &conf.MigrationConfig{Locations: []string{migrationsDir}, SkipVersions: []uint16{3},
+		Destination: &destination}
+
+	pending, latest, err := NewMigrator(zap.NewNop(), &explainingRepository{latest: 1}, config).Pending()
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(1), latest)
+	versions := make([]uint16, 0, len(pending))
+	for _, migration := range pending {
+		versions = append(versions, migration.Version)
+	}
+	assert.Equal(t, []uint16{2, 3}, versions)
+
+	pending, latest, err = NewMigrator(zap.NewNop(), &explainingRepository{latest: 3}, config).Pending()
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(3), latest)
+	assert.Empty(t, pending)
+
+	config.Down = true
+	_, _, err = NewMigrator(zap.NewNop(), &explainingRepository{latest: 3}, config).Pending()
+	assert.ErrorContains(t, err, "only listed for up runs")
+}
+
+// historyRepository reads the given schema history.
+type historyRepository struct {
+	nonTransactionalRepository
+	history []*database.AppliedMigration
+}
+
+func (r *historyRepository) CheckSchemaHistoryTable() (bool, error) { return true, nil }
+
+func (r *historyRepository) GetAppliedMigrations() ([]*database.AppliedMigration, error) {
+	return r.history, nil
+}
+
+func TestPlan(t *testing.T) {
+	migrationsDir := t.TempDir()
+	files := map[string]string{
+		"V001_users.sql":         "CREATE TABLE users (id INT);",
+		"V001_users.down.sql":    "DROP TABLE users;",
+		"V002_posts.sql":         "CREATE TABLE posts (id INT);",
+		"V002_posts.down.sql":    "DROP TABLE posts;",
+		"V003_skipped.sql":       "SELECT 1;",
+		"V004_drop_old.sql":      "-- maestro:ticket OPS-7\nDROP TABLE old;",
+		"V004_drop_old.down.sql": "CREATE TABLE old (id INT);",
+	}
+	for name, content := range files {
+		err := os.WriteFile(filepath.Join(migrationsDir, name), []byte(content), os.ModePerm)
+		assert.NoError(t, err)
+	}
+
+	loaded, _, errs := filesystem.LoadObjectsFromFiles(&conf.MigrationConfig{Locations: []string{migrationsDir}})
+	assert.Empty(t, errs)
+	checksums := map[uint16]string{}
+	for _, migration := range loaded[enums.MIGRATION_UP] {
+		checksums[migration.Version] = *migration.Checksum
+	}
+
+	repository := &historyRepository{history: []*database.AppliedMigration{
+		{Version: 1, Description: "users", Checksum: "changed", Success: true},
+		{Version: 2, Description: "posts", Checksum: checksums[2], Success: true, Author: "ada"},
+	}}
+
+	plan, err := NewMigrator(zap.NewNop(), repository, &conf.MigrationConfig{Locations: []string{migrationsDir},
+		SkipVersions: []uint16{3}}).Plan()
+	assert.NoError(t, err)
+
+	assert.Equal(t, PLAN_FORMAT_VERSION, plan.FormatVersion)
+	assert.Equal(t, "up", plan.Direction)
+	assert.Equal(t, uint16(2), plan.CurrentVersion)
+	assert.Equal(t, uint16(4), plan.TargetVersion)
+	assert.Equal(t, []*PlanAction{
+		{Action: PLAN_ACTION_SKIP, Version: 3, Description: "skipped", Checksum: checksums[3]},
+		{Action: PLAN_ACTION_APPLY, Version: 4, Description: "drop_old", Checksum: checksums[4], Destructive: true,
+			Ticket: "OPS-7"},
+	}, plan.Actions)
+	assert.Equal(t, []*PlanDrift{{Version: 1, Description: "users", AppliedChecksum: "changed",
+		LocalChecksum: checksums[1]}}, plan.Drift)
+	assert.Equal(t, PlanSummary{Apply: 1, Skip: 1, Destructive: 1, Drift: 1}, plan.Summary)
+
+	// Rollbacks in execution order, with the applied checksums
+	plan, err = NewMigrator(zap.NewNop(), repository, &conf.MigrationConfig{Locations: []string{migrationsDir},
+		Down: true}).Plan()
+	assert.NoError(t, err)
+
+	assert.Equal(t, "down", plan.Direction)
+	assert.Equal(t, uint16(0), plan.TargetVersion)
+	assert.Equal(t, []*PlanAction{
+		{Action: PLAN_ACTION_ROLLBACK, Version: 2, Description: "posts", Checksum: checksums[2], Destructive: true,
+			Author: "ada"},
+		{Action: PLAN_ACTION_ROLLBACK, Version: 1, Description: "users", Checksum: "changed", Destructive: true},
+	}, plan.Actions)
+	assert.Equal(t, PlanSummary{Rollback: 2, Destructive: 2, Drift: 1}, plan.Summary)
+
+	// Up to date
+	repository.history = append(repository.history,
+		&database.AppliedMigration{Version: 3, Checksum: checksums[3], Success: true},
+		&database.AppliedMigration{Version: 4, Checksum: checksums[4], Success: true})
+	plan, err = NewMigrator(zap.NewNop(), repository, &conf.MigrationConfig{Locations: []string{migrationsDir}}).Plan()
+	assert.NoError(t, err)
+	assert.Empty(t, plan.Actions)
+	assert.NotNil(t, plan.Actions)
+}
+
+// baselinedRepository is a repository recording the skipped migrations, with the given schema history.
+type baselinedRepository struct {
+	skippingRepository
+	history []*database.AppliedMigration
+}
+
+func (r *baselinedRepository) GetAppliedMigrations() ([]*database.AppliedMigration, error) {
+	return r.history, nil
+}
+
+func TestBaseline(t *testing.T) {
+	migrationsDir := t.TempDir()
+	files := map[string]string{
+		"V001_users.sql": "CREATE TABLE users (id INT);",
+		"V002_posts.sql": "CREATE TABLE posts (id INT);",
+		"V004_tags.sql":  "CREATE TABLE tags (id INT);",
+	}
+	for name, content := range files {
+		err := os.WriteFile(filepath.Join(migrationsDir, name), []byte(content), os.ModePerm)
+		assert.NoError(t, err)
+	}
+
+	config := &conf.MigrationConfig{Locations: []string{migrationsDir}, InTransaction: true}
+
+	// The migrations up to the version are recorded, without being executed
+	repository := &baselinedRepository{}
+	baselined, err := NewMigrator(zap.NewNop(), repository, config).Baseline(3)
+	assert.NoError(t, err)
+	assert.Equal(t, []uint16{1, 2}, baselined)
+	assert.Equal(t, []uint16{1, 2}, repository.skipped)
+	assert.Empty(t, repository.executed)
+
+	// Databases already migrated by maestro are refused
+	repository = &baselinedRepository{history: appliedUpTo(1)}
+	_, err = NewMigrator(zap.NewNop(), repository, config).Baseline(2)
+	assert.ErrorContains(t, err, "already records migrations (latest version 1)")
+	assert.Empty(t, repository.skipped)
+
+	_, err = NewMigrator(zap.NewNop(), &baselinedRepository{}, config).Baseline(0)
+	assert.ErrorContains(t, err, "must be greater than 0")
+}
+
+// checksumRepository validates the checksums of the local migrations against the given schema history.
+type checksumRepository struct {
+	historyRepository
+	missing   bool // The schema history table does not exist
+	validated bool
+}
+
+func (r *checksumRepository) CheckSchemaHistoryTable() (bool, error) { return !r.missing, nil }
+
+func (r *checksumRepository) ValidateMigrations(localMigrations []*migrations.Migration) []error {
+	r.validated = true
+
+	errs := make([]error, 0)
+	for _, migration := range localMigrations {
+		for _, applied := range r.history {
+			if applied.Version == migration.Version && applied.Checksum != *migration.Checksum {
+				errs = append(errs, &database.MismatchError{Version: applied.Version,
+					Description: applied.Description, Checksum: applied.Checksum})
+			}
+		}
+	}
+	return errs
+}
+
+func TestValidate(t *testing.T) {
+	migrationsDir := t.TempDir()
+	files := map[string]string{
+		"V001_users.sql": "CREATE TABLE users (id INT);",
+		"V002_posts.sql": "CREATE TABLE posts (id INT);",
+	}
+	for name, content := range files {
+		err := os.WriteFile(filepath.Join(migrationsDir, name), []byte(content), os.ModePerm)
+		assert.NoError(t, err)
+	}
+
+	loaded, _, errs := filesystem.LoadObjectsFromFiles(&conf.MigrationConfig{Locations: []string{migrationsDir}})
+	assert.Empty(t, errs)
+	checksum := *loaded[enums.MIGRATION_UP][0].Checksum
+
+	// Validated also when validation is disabled, without migrating
+	config := &conf.MigrationConfig{Locations: []string{migrationsDir}, Validate: false}
+	repository := &checksumRepository{historyRepository: historyRepository{history: []*database.AppliedMigration{
+		{Version: 1, Description: "users", Checksum: checksum, Success: true}}}}
+	assert.NoError(t, NewMigrator(zap.NewNop(), repository, config).Validate())
+	assert.True(t, repository.validated)
+	assert.Empty(t, repository.executed)
+
+	repository.history[0].Checksum = "changed"
+	mismatch := &database.MismatchError{}
+	assert.ErrorAs(t, NewMigrator(zap.NewNop(), repository, config).Validate(), &mismatch)
+	assert.Equal(t, uint16(1), mismatch.Version)
+
+	repository.history[0].Checksum, repository.history[0].Success = checksum, false
+	err := NewMigrator(zap.NewNop(), repository, config).Validate()
+	assert.ErrorContains(t, err, "found an unsucceeded migration: 1")
+
+	// Only the local migrations are validated without schema history table
+	repository = &checksumRepository{missing: true}
+	assert.NoError(t, NewMigrator(zap.NewNop(), repository, config).Validate())
+	assert.False(t, repository.validated)
+
+	err = os.WriteFile(filepath.Join(migrationsDir, "V004_tags.sql"), []byte("SELECT 1;"), os.ModePerm)
+	assert.NoError(t, err)
+	err = NewMigrator(zap.NewNop(), repository, config).Validate()
+	assert.ErrorContains(t, err, "expected version 3 got 4")
+}
+
+// monitoredRepository is a transactional repository reporting the same activity for its transactions. Its
+// migrations run until the transaction guard checked their transaction a few times, or cancelled it.
+type monitoredRepository struct {
+	nonTransactionalRepository
+	activity  database.TransactionActivity
+	checks    chan struct{}
+	cancelled chan struct{}
+}
+
+func newMonitoredRepository(activity database.TransactionActivity) *monitoredRepository {
+	return &monitoredRepository{
+		activity:  activity,
+		checks:    make(chan struct{}),
+		cancelled: make(chan struct{}),
+	}
+}
+
+func (r *monitoredRepository) Capabilities() database.Capabilities {
+	return database.Capabilities{SupportsTransactions: true}
+}
+
+func (r *monitoredRepository) TransactionActivity() (*database.TransactionActivity, error) {
+	select {
+	case r.checks <- struct{}{}:
+	default:
+	}
+
+	activity := r.activity
+	return &activity, nil
+}
+
+func (r *monitoredRepository) CancelTransaction() error {
+	close(r.cancelled)
+	return nil
+}
+
+func (r *monitoredRepository) ExecuteMigration(migration *migrations.Migration) []error {
+	r.executed = append(r.executed, migration.Version)
+	for i := 0; i < 3; i++ {
+		select {
+		case <-r.checks:
+		case <-r.cancelled:
+			return []error{errors.New("canceling statement due to user request")}
+		}
+	}
+	return nil
+}
+
+func TestMigrateTransactionGuard(t *testing.T) {
+	interval := guard_interval
+	guard_interval = time.Millisecond
+	defer func() {
+		guard_interval = interval
+	}()
+
+	migrationsDir := t.TempDir()
+	err := os.WriteFile(filepath.Join(migrationsDir, "V001_test.sql"), []byte("UPDATE a SET x = 1;"), os.ModePerm)
+	assert.NoError(t, err)
+
+	activity := database.TransactionActivity{
+		SessionActivity: database.SessionActivity{ID: 10, TransactionDuration: 2 * time.Minute},
+		LockWait:        45 * time.Second,
+		Blockers: []*database.SessionActivity{
+			{ID: 20, User: "app", State: "idle in transaction", TransactionDuration: 40 * time.Minute},
+		},
+		ExclusiveLocks: []string{"public.a"},
+	}
+
+	// Thresholds above the warning thresholds are reported once
+	repository := newMonitoredRepository(activity)
+	result, err := NewMigrator(zap.NewNop(), repository, &conf.MigrationConfig{
+		Locations:            []string{migrationsDir},
+		InTransaction:        true,
+		TransactionWarnAfter: time.Minute,
+		LockWaitWarnAfter:    30 * time.Second,
+	}).Migrate()
+	assert.NoError(t, err)
+	assert.Equal(t, []uint16{1}, result.Applied())
+	assert.Equal(t, []string{
+		"Transaction of the migrations open for 2m0s, above transaction-warn-after (1m0s), holding exclusive locks on public.a",
+		"Statement of the migrations waiting for a lock for 45s, above lock-wait-warn-after (30s), blocked by session 20 (user app, idle in transaction, transaction open for 40m0s)",
+	}, result.Warnings)
+
+	// Thresholds above the abort thresholds cancel the transaction
+	repository = newMonitoredRepository(activity)
+	result, err = NewMigrator(zap.NewNop(), repository, &conf.MigrationConfig{
+		Locations:          []string{migrationsDir},
+		InTransaction:      true,
+		LockWaitWarnAfter:  30 * time.Second,
+		LockWaitAbortAfter: 40 * time.Second,
+	}).Migrate()
+	assert.ErrorContains(t, err, "canceling statement")
+	assert.ErrorContains(t, err, "above lock-wait-abort-after (40s), blocked by session 20")
+	assert.True(t, result.RolledBack)
+	assert.Empty(t, result.Warnings)
+
+	// Without transaction, the guard is disabled
+	result, err = NewMigrator(zap.NewNop(), &nonTransactionalRepository{}, &conf.MigrationConfig{
+		Locations:            []string{migrationsDir},
+		InTransaction:        true,
+		TransactionWarnAfter: time.Minute,
+	}).Migrate()
+	assert.NoError(t, err)
+	assert.Contains(t, result.Warnings, "The transaction guard only monitors migrations run in a transaction, it is disabled")
+}
+
+func TestMigrateBackup(t *testing.T) {
+	migrationsDir := t.TempDir()
+	files := map[string]string{
+		"V001_create.sql": "CREATE TABLE a (id INT);",
+		"V002_drop.sql":   "DROP TABLE a;",
+		"V003_flag.sql":   "-- maestro:destructive\nUPDATE b SET x = NULL;",
+		"V004_create.sql": "CREATE TABLE c (id INT);",
+	}
+	for name, content := range files {
+		err := os.WriteFile(filepath.Join(migrationsDir, name), []byte(content), os.ModePerm)
+		assert.NoError(t, err)
+	}
+
+	backedUp := make([][]uint16, 0)
+	backedUpLatest := uint16(0)
+	backup := func(latest uint16, versions []uint16) (string, error) {
+		backedUpLatest = latest
+		backedUp = append(backedUp, versions)
+		return "/backups/example.dump", nil
+	}
+
+	// Only the destructive migrations executed by the run are backed up
+	skipping := &skippingRepository{}
+	migrator := NewMigrator(zap.NewNop(), skipping, &conf.MigrationConfig{
+		Locations:    []string{migrationsDir},
+		SkipVersions: []uint16{3},
+	})
+	migrator.SetBackup(backup)
+
+	result, err := migrator.Migrate()
+	assert.NoError(t, err)
+	assert.Equal(t, [][]uint16{{2}}, backedUp)
+	assert.Equal(t, uint16(0), backedUpLatest)
+	assert.Equal(t, "/backups/example.dump", result.Backup)
+	assert.Equal(t, []uint16{1, 2, 4}, skipping.executed)
+
+	// Runs without destructive migrations are not backed up
+	backedUp = make([][]uint16, 0)
+	destination := uint16(1)
+	migrator = NewMigrator(zap.NewNop(), &nonTransactionalRepository{}, &conf.MigrationConfig{
+		Locations:   []string{migrationsDir},
+		Destination: &destination,
+	})
+	migrator.SetBackup(backup)
+
+	result, err = migrator.Migrate()
+	assert.NoError(t, err)
+	assert.Empty(t, backedUp)
+	assert.Empty(t, result.Backup)
+
+	// Nothing is executed if the backup fails
+	repository := &nonTransactionalRepository{}
+	migrator = NewMigrator(zap.NewNop(), repository, &conf.MigrationConfig{
+		Locations: []string{migrationsDir},
+	})
+	migrator.SetBackup(func(latest uint16, versions []uint16) (string, error) {
+		return "", errors.New("pg_dump: command not found")
+	})
+
+	_, err = migrator.Migrate()
+	assert.ErrorContains(t, err, "destructive migrations [2 3]: pg_dump: command not found")
+	assert.Empty(t, repository.executed)
+}
+
+// pruningRepository is a repository whose history records the given versions, able to prune them.
+type pruningRepository struct {
+	nonTransactionalRepository
+	history []uint16
+}
+
+func (r *pruningRepository) PruneHistory(latest uint16) ([]uint16, error) {
+	kept := make([]uint16, 0)
+	removed := make([]uint16, 0)
+	for _, version := range r.history {
+		if version > latest {
+			removed = append(removed, version)
+		} else {
+			kept = append(kept, version)
+		}
+	}
+	r.history = kept
+	return removed, nil
+}
+
+// latestRepository is a repository whose latest applied version is the given one, unable to prune its history.
+type latestRepository struct {
+	nonTransactionalRepository
+	latest uint16
+}
+
+func (r *latestRepository) GetLatestMigration() (uint16, error) {
+	return r.latest, nil
+}
+
+func TestRestore(t *testing.T) {
+	restored := false
+	restore := func() error {
+		restored = true
+		return nil
+	}
+
+	// The versions applied after the backup are removed from the history
+	repository := &pruningRepository{history: []uint16{1, 2, 3, 4}}
+	migrator := NewMigrator(zap.NewNop(), repository, &conf.MigrationConfig{})
+
+	removed, err := migrator.Restore(restore, 2)
+	assert.NoError(t, err)
+	assert.True(t, restored)
+	assert.Equal(t, []uint16{3, 4}, removed)
+	assert.Equal(t, []uint16{1, 2}, repository.history)
+
+	// The history is not reconciled if the restore fails
+	repository = &pruningRepository{history: []uint16{1, 2, 3}}
+	migrator = NewMigrator(zap.NewNop(), repository, &conf.MigrationConfig{})
+
+	_, err = migrator.Restore(func() error { return errors.New("pg_restore: connection refused") }, 1)
+	assert.ErrorContains(t, err, "error restoring the backup: pg_restore: connection refused")
+	assert.Equal(t, []uint16{1, 2, 3}, repository.history)
+
+	// Repositories unable to prune their history fail if it does not match the backup
+	migrator = NewMigrator(zap.NewNop(), &latestRepository{latest: 2}, &conf.MigrationConfig{})
+
+	removed, err = migrator.Restore(restore, 2)
+	assert.NoError(t, err)
+	assert.Empty(t, removed)
+
+	migrator = NewMigrator(zap.NewNop(), &latestRepository{latest: 3}, &conf.MigrationConfig{})
+
+	_, err = migrator.Restore(restore, 2)
+	assert.ErrorContains(t, err, "records version 3, applied after the backup of version 2")
+}
+
+// incompatibleRepository is a repository whose schema history table is incompatible.
+type incompatibleRepository struct {
+	nonTransactionalRepository
+	asserted bool
+}
+
+func (r *incompatibleRepository) CheckHistorySchema() error {
+	return &database.HistorySchemaError{Table: "schema_history", Problems: []string{"column md5_checksum is missing"}}
+}
+
+func (r *incompatibleRepository) AssertSchemaHistoryTable() error {
+	r.asserted = true
+	return nil
+}
+
+func TestMigrateIncompatibleHistoryTable(t *testing.T) {
+	migrationsDir := t.TempDir()
+	err := os.WriteFile(filepath.Join(migrationsDir, "V001_create.sql"), []byte("CREATE TABLE a (id INT);"), os.ModePerm)
+	assert.NoError(t, err)
+
+	// Nothing is recorded in incompatible history tables
+	repository := &incompatibleRepository{}
+	migrator := NewMigrator(zap.NewNop(), repository, &conf.MigrationConfig{Locations: []string{migrationsDir}})
+
+	_, err = migrator.Migrate()
+	var schemaErr *database.HistorySchemaError
+	assert.ErrorAs(t, err, &schemaErr)
+	assert.False(t, repository.asserted)
+	assert.Empty(t, repository.executed)
+}
+
+// syncedRepository is a repository copying its history to a previous history table.
+type syncedRepository struct {
+	nonTransactionalRepository
+	synced []string // Executed versions when the history was copied
+}
+
+func (r *syncedRepository) CheckSchemaHistoryTable() (bool, error) {
+	return true, nil
+}
+
+func (r *syncedRepository) CopyHistoryFrom(table string) (int64, error) {
+	return 0, errors.New("unexpected copy")
+}
+
+func (r *syncedRepository) CopyHistoryTo(table string) (int64, error) {
+	r.synced = append(r.synced, fmt.Sprintf("%s %v", table, r.executed))
+	return int64(len(r.executed)), nil
+}
+
+func TestMigrateHistorySync(t *testing.T) {
+	migrationsDir := t.TempDir()
+	err := os.WriteFile(filepath.Join(migrationsDir, "V001_create.sql"), []byte("CREATE TABLE a (id INT);"), os.ModePerm)
+	assert.NoError(t, err)
+
+	// The previous history table is synced once the migrations are recorded
+	repository := &syncedRepository{}
+	migrator := NewMigrator(zap.NewNop(), repository, &conf.MigrationConfig{Locations: []string{migrationsDir}})
+	migrator.SetHistorySync("old_history")
+
+	_, err = migrator.Migrate()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"old_history [1]"}, repository.synced)
+
+	// Without previous history table, nothing is synced
+	repository = &syncedRepository{}
+	_, err = NewMigrator(zap.NewNop(), repository, &conf.MigrationConfig{Locations: []string{migrationsDir}}).Migrate()
+	assert.NoError(t, err)
+	assert.Empty(t, repository.synced)
+
+	// Repositories unable to copy their history fail
+	migrator = NewMigrator(zap.NewNop(), &nonTransactionalRepository{}, &conf.MigrationConfig{Locations: []string{migrationsDir}})
+	migrator.SetHistorySync("old_history")
+
+	_, err = migrator.Migrate()
+	assert.EqualError(t, err, "the repository can not keep history table old_history in sync")
+}
+
+// signedLoader writes a location of one migration with its manifest signed by the key, for every location URL.
+type signedLoader struct {
+	key ed25519.PrivateKey
+}
+
+func (l *signedLoader) Download(ctx context.Context, location *remote.Location, dir string) error {
+	content := "CREATE TABLE " + location.Prefix + " (id INT);"
+	sum := sha256.Sum256([]byte(content))
+	manifest := hex.EncodeToString(sum[:]) + "  V001_init.sql\n"
+
+	return errors.Join(
+		os.WriteFile(filepath.Join(dir, "V001_init.sql"), []byte(content), 0644),
+		os.WriteFile(filepath.Join(dir, "maestro.sha256"), []byte(manifest), 0644),
+		os.WriteFile(filepath.Join(dir, "maestro.sha256.sig"), ed25519.Sign(l.key, []byte(manifest)), 0644),
+	)
+}
+
+func TestFetchRemoteLocations(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	der, err := x509.MarshalPKIXPublicKey(public)
+	require.NoError(t, err)
+
+	keyFile := filepath.Join(t.TempDir(), "remote.pub")
+	err = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0644)
+	require.NoError(t, err)
+
+	remote.RegisterLoader("migratortest", &signedLoader{key: private})
+
+	config := &conf.MigrationConfig{Track: "schema", Locations: []string{"migratortest://bucket/users"},
+		RemoteKey: keyFile}
+	m := NewMigrator(zap.NewNop(), nil, config)
+
+	cleanup, err := m.FetchRemoteLocations(context.Background())
+	require.NoError(t, err)
+
+	// The migrations are loaded from the local copy
+	loaded, _, errs := filesystem.LoadObjectsFromFiles(config)
+	require.Empty(t, errs)
+	require.Len(t, loaded[enums.MIGRATION_UP], 1)
+	assert.Equal(t, "CREATE TABLE users (id INT);", *loaded[enums.MIGRATION_UP][0].Content)
+
+	cleanup()
+	assert.NoDirExists(t, config.Locations[0])
+}
@@ -0,0 +1,119 @@
+package migrator
+
+import (
+	"fmt"
+
+	"github.com/maestro-go/maestro/core/conf"
+	"github.com/maestro-go/maestro/core/database"
+	"github.com/maestro-go/maestro/internal/migrations"
+)
+
+const (
+	ORDER_STEP_MIGRATE   = "migrate"
+	ORDER_STEP_ROLLBACK  = "rollback"
+	ORDER_STEP_SKIP      = "skip"
+	ORDER_STEP_HOOK      = "hook"
+	ORDER_STEP_ASSERTION = "assertion"
+)
+
+// OrderStep is a migration or hook that a run would execute, in the order of the run.
+type OrderStep struct {
+	Kind        string // One of the ORDER_STEP_* kinds
+	Version     uint16 // Version of the migration, or of the migration of the hook (0 for hooks running once per run)
+	Description string // Description of the migration, or file name of the hook
+}
+
+// String returns the step as printed by the order command.
+func (s *OrderStep) String() string {
+	if s.Kind == ORDER_STEP_HOOK || s.Kind == ORDER_STEP_ASSERTION {
+		if s.Version == 0 {
+			return fmt.Sprintf("%s %s", s.Kind, s.Description)
+		}
+		return fmt.Sprintf("%s %s (version %d)", s.Kind, s.Description, s.Version)
+	}
+	return fmt.Sprintf("%s %d %s", s.Kind, s.Version, s.Description)
+}
+
+// Order returns the migrations and hooks that Migrate would execute with the configuration, in execution order,
+// on a database whose latest applied version is from. The files are loaded, sorted and filtered as in a run,
+// but nothing is executed and the database is not accessed: every step is assumed to succeed.
+func Order(config *conf.MigrationConfig, from uint16) ([]*OrderStep, error) {
+	orderConfig := *config
+
+	repository := &orderRepository{latest: from, steps: make([]*OrderStep, 0)}
+	result, err := NewMigrator(nil, repository, &orderConfig).Migrate()
+	if err != nil {
+		return nil, err
+	}
+
+	// The migration a hook is executed for is only known by the result, which lists the hooks in the same order
+	hooks := 0
+	for _, step := range repository.steps {
+		if step.Kind != ORDER_STEP_HOOK && step.Kind != ORDER_STEP_ASSERTION {
+			continue
+		}
+		if hooks < len(result.Hooks) {
+			step.Version = result.Hooks[hooks].Migration
+		}
+		hooks++
+	}
+
+	return repository.steps, nil
+}
+
+// orderRepository is a repository recording the migrations and hooks it is asked to execute, with the
+// migrations up to latest applied.
+type orderRepository struct {
+	database.Repository
+
+	latest uint16
+	steps  []*OrderStep
+}
+
+func (r *orderRepository) Capabilities() database.Capabilities {
+	return database.Capabilities{SupportsTransactions: true}
+}
+
+func (r *orderRepository) SetRunInfo(database.RunInfo)                        {}
+func (r *orderRepository) AssertSchemaHistoryTable() error                    { return nil }
+func (r *orderRepository) DoInLock(fn func() error) error                     { return fn() }
+func (r *orderRepository) DoInTransaction(fn func() error) error              { return fn() }
+func (r *orderRepository) DoOutsideTransaction(fn func() error) error         { return fn() }
+func (r *orderRepository) ValidateMigrations([]*migrations.Migration) []error { return nil }
+
+func (r *orderRepository) GetAppliedMigrations() ([]*database.AppliedMigration, error) {
+	history := make([]*database.AppliedMigration, 0, r.latest)
+	for version := uint16(1); version <= r.latest; version++ {
+		history = append(history, &database.AppliedMigration{Version: version, Success: true})
+	}
+	return history, nil
+}
+
+func (r *orderRepository) ExecuteMigration(migration *migrations.Migration) []error {
+	r.addMigration(ORDER_STEP_MIGRATE, migration)
+	return nil
+}
+
+func (r *orderRepository) RollbackMigration(migration *migrations.Migration) error {
+	r.addMigration(ORDER_STEP_ROLLBACK, migration)
+	return nil
+}
+
+func (r *orderRepository) SkipMigration(migration *migrations.Migration) error {
+	r.addMigration(ORDER_STEP_SKIP, migration)
+	return nil
+}
+
+func (r *orderRepository) ExecuteHook(hook *migrations.Hook) error {
+	r.steps = append(r.steps, &OrderStep{Kind: ORDER_STEP_HOOK, Description: hook.FileName})
+	return nil
+}
+
+func (r *orderRepository) ExecuteAssertion(hook *migrations.Hook) error {
+	r.steps = append(r.steps, &OrderStep{Kind: ORDER_STEP_ASSERTION, Description: hook.FileName})
+	return nil
+}
+
+func (r *orderRepository) addMigration(kind string, migration *migrations.Migration) {
+	r.steps = append(r.steps, &OrderStep{Kind: kind, Version: migration.Version, Description: migration.Description})
+}
@@ -0,0 +1,108 @@
+package migrator
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/maestro-go/maestro/core/database"
+	"github.com/maestro-go/maestro/core/enums"
+	"github.com/maestro-go/maestro/internal/filesystem"
+	"github.com/maestro-go/maestro/internal/migrations"
+)
+
+// Pending returns the up migrations a run would apply or record as skipped with the configuration, the pending
+// ones up to the destination, and the latest applied version. The database is only read: the lock is not taken,
+// no hook is executed and the migrations are not validated. It fails for down runs.
+func (m *Migrator) Pending() ([]*migrations.Migration, uint16, error) {
+	if m.config.Down {
+		return nil, 0, errors.New("the pending migrations are only listed for up runs")
+	}
+
+	migrationsMap, _, errs := filesystem.LoadObjectsFromFiles(m.config)
+	if len(errs) > 0 {
+		return nil, 0, errors.Join(errs...)
+	}
+
+	history, err := m.appliedHistory()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	pending, err := m.pendingUpMigrations(migrationsMap[enums.MIGRATION_UP], history)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return pending, database.LatestAppliedVersion(history), nil
+}
+
+// appliedHistory returns the rows of the schema history table, empty if the table does not exist.
+func (m *Migrator) appliedHistory() ([]*database.AppliedMigration, error) {
+	exists, err := m.repository.CheckSchemaHistoryTable()
+	if err != nil {
+		return nil, fmt.Errorf("error checking schema history table: %w", err)
+	}
+
+	if !exists {
+		return make([]*database.AppliedMigration, 0), nil
+	}
+
+	history, err := m.repository.GetAppliedMigrations()
+	if err != nil {
+		return nil, fmt.Errorf("error getting applied migrations: %w", err)
+	}
+
+	return history, nil
+}
+
+// pendingUpMigrations returns the up migrations a run would apply with the configuration, or record as
+// skipped: the pending ones up to the destination.
+func (m *Migrator) pendingUpMigrations(upMigrations []*migrations.Migration,
+	history []*database.AppliedMigration) ([]*migrations.Migration, error) {
+
+	if len(upMigrations) == 0 {
+		return nil, nil
+	}
+
+	latestMigration := database.LatestAppliedVersion(history)
+
+	destination, err := m.destination(upMigrations, latestMigration)
+	if err != nil {
+		return nil, err
+	}
+
+	versionRanges, err := migrations.ParseVersionRanges(m.config.Locations, m.config.VersionRanges)
+	if err != nil {
+		return nil, err
+	}
+
+	// As in Migrate, versions below the latest applied one are pending with version ranges
+	from := latestMigration + 1
+	if len(versionRanges) > 0 {
+		upMigrations, from = pendingMigrations(upMigrations, history), 1
+	}
+
+	pending := make([]*migrations.Migration, 0)
+	for _, migration := range upMigrations {
+		if migration.Version < from || migration.Version > destination {
+			continue
+		}
+		pending = append(pending, migration)
+	}
+
+	return pending, nil
+}
+
+// destination returns the version a run would stop at: the destination given by name or by version, or else
+// the latest local version for up runs and 0 for down runs.
+func (m *Migrator) destination(upMigrations []*migrations.Migration, latestMigration uint16) (uint16, error) {
+	switch {
+	case m.config.DestinationName != "":
+		return resolveDestination(m.config.DestinationName, upMigrations, latestMigration)
+	case m.config.Destination != nil:
+		return *m.config.Destination, nil
+	case m.config.Down || len(upMigrations) == 0:
+		return 0, nil
+	}
+	return upMigrations[len(upMigrations)-1].Version, nil
+}
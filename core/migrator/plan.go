@@ -0,0 +1,176 @@
+package migrator
+
+import (
+	"cmp"
+	"errors"
+	"slices"
+
+	"github.com/maestro-go/maestro/core/database"
+	"github.com/maestro-go/maestro/core/enums"
+	"github.com/maestro-go/maestro/internal/conf"
+	"github.com/maestro-go/maestro/internal/filesystem"
+	"github.com/maestro-go/maestro/internal/migrations"
+)
+
+// PLAN_FORMAT_VERSION is the version of the JSON schema of Plan, for the tools consuming it. Fields may be added
+// within a version; it changes when a field is removed, renamed or changes meaning.
+const PLAN_FORMAT_VERSION = 1
+
+// Actions of a plan
+const (
+	PLAN_ACTION_APPLY    = "apply"
+	PLAN_ACTION_SKIP     = "skip" // Recorded as applied without being executed (skip-versions)
+	PLAN_ACTION_ROLLBACK = "rollback"
+)
+
+// Plan is what a run would do with the configuration, computed without changing the database. Serialized as
+// JSON, it is a stable schema for external tools (e.g. Terraform providers or review bots) to consume and diff:
+// it has no time, and its lists are always present and ordered.
+type Plan struct {
+	FormatVersion  int    `json:"format_version"`
+	MaestroVersion string `json:"maestro_version"`
+	Direction      string `json:"direction"`       // up or down
+	CurrentVersion uint16 `json:"current_version"` // Latest applied version
+	TargetVersion  uint16 `json:"target_version"`  // Destination of the run
+
+	Actions []*PlanAction `json:"actions"` // In execution order, empty if the database is up to date
+	Drift   []*PlanDrift  `json:"drift"`   // Applied migrations whose local file changed, by version
+
+	Summary PlanSummary `json:"summary"`
+}
+
+// PlanAction is a migration a run would apply, record as applied without executing it, or roll back.
+type PlanAction struct {
+	Action      string `json:"action"`
+	Version     uint16 `json:"version"`
+	Description string `json:"description"`
+	Checksum    string `json:"checksum"` // Of the up migration: the local one, or the applied one for rollbacks
+	Destructive bool   `json:"destructive"`
+	Author      string `json:"author,omitempty"`
+	Ticket      string `json:"ticket,omitempty"`
+}
+
+// PlanDrift is an applied migration whose local up migration has another checksum.
+type PlanDrift struct {
+	Version         uint16 `json:"version"`
+	Description     string `json:"description"`
+	AppliedChecksum string `json:"applied_checksum"`
+	LocalChecksum   string `json:"local_checksum"`
+}
+
+// PlanSummary counts the actions of a plan.
+type PlanSummary struct {
+	Apply       int `json:"apply"`
+	Skip        int `json:"skip"`
+	Rollback    int `json:"rollback"`
+	Destructive int `json:"destructive"`
+	Drift       int `json:"drift"`
+}
+
+// Plan returns what a run would do with the configuration: the migrations it would apply, record as skipped or
+// roll back, in execution order, and the applied migrations whose local file changed. The database is only
+// read: the lock is not taken, no hook is executed and the migrations are not validated.
+func (m *Migrator) Plan() (*Plan, error) {
+	migrationsMap, _, errs := filesystem.LoadObjectsFromFiles(m.config)
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	history, err := m.appliedHistory()
+	if err != nil {
+		return nil, err
+	}
+
+	upMigrations := migrationsMap[enums.MIGRATION_UP]
+	latestMigration := database.LatestAppliedVersion(history)
+
+	target, err := m.destination(upMigrations, latestMigration)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &Plan{
+		FormatVersion:  PLAN_FORMAT_VERSION,
+		MaestroVersion: conf.VERSION,
+		Direction:      database.AUDIT_UP,
+		CurrentVersion: latestMigration,
+		TargetVersion:  target,
+		Actions:        make([]*PlanAction, 0),
+		Drift:          make([]*PlanDrift, 0),
+	}
+
+	applied := make(map[uint16]*database.AppliedMigration, len(history))
+	for _, migration := range history {
+		applied[migration.Version] = migration
+	}
+
+	if m.config.Down {
+		plan.Direction = database.AUDIT_DOWN
+
+		downMigrations := slices.Clone(migrationsMap[enums.MIGRATION_DOWN])
+		slices.SortFunc(downMigrations, func(a, b *migrations.Migration) int {
+			return cmp.Compare(b.Version, a.Version)
+		})
+
+		for _, migration := range downMigrations {
+			if migration.Version > latestMigration || migration.Version <= target {
+				continue
+			}
+
+			action := &PlanAction{Action: PLAN_ACTION_ROLLBACK, Version: migration.Version,
+				Description: migration.Description, Destructive: migration.Destructive}
+			if appliedMigration, ok := applied[migration.Version]; ok {
+				action.Checksum = appliedMigration.Checksum
+				action.Author, action.Ticket = appliedMigration.Author, appliedMigration.Ticket
+			}
+			plan.Actions = append(plan.Actions, action)
+		}
+	} else {
+		pending, err := m.pendingUpMigrations(upMigrations, history)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, migration := range pending {
+			action := &PlanAction{Action: PLAN_ACTION_APPLY, Version: migration.Version,
+				Description: migration.Description, Destructive: migration.Destructive,
+				Author: migration.Author, Ticket: migration.Ticket}
+			if migration.Checksum != nil {
+				action.Checksum = *migration.Checksum
+			}
+			if slices.Contains(m.config.SkipVersions, migration.Version) {
+				action.Action = PLAN_ACTION_SKIP
+			}
+			plan.Actions = append(plan.Actions, action)
+		}
+	}
+
+	for _, migration := range upMigrations {
+		appliedMigration, ok := applied[migration.Version]
+		if !ok || !appliedMigration.Success || migration.Checksum == nil ||
+			*migration.Checksum == appliedMigration.Checksum {
+			continue
+		}
+
+		plan.Drift = append(plan.Drift, &PlanDrift{Version: migration.Version, Description: migration.Description,
+			AppliedChecksum: appliedMigration.Checksum, LocalChecksum: *migration.Checksum})
+	}
+
+	for _, action := range plan.Actions {
+		switch action.Action {
+		case PLAN_ACTION_APPLY:
+			plan.Summary.Apply++
+		case PLAN_ACTION_SKIP:
+			plan.Summary.Skip++
+		case PLAN_ACTION_ROLLBACK:
+			plan.Summary.Rollback++
+		}
+
+		if action.Destructive && action.Action != PLAN_ACTION_SKIP {
+			plan.Summary.Destructive++
+		}
+	}
+	plan.Summary.Drift = len(plan.Drift)
+
+	return plan, nil
+}
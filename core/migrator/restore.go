@@ -0,0 +1,56 @@
+package migrator
+
+import (
+	"fmt"
+
+	"github.com/maestro-go/maestro/core/database"
+	"go.uber.org/zap"
+)
+
+// Restore restores the database with the given function, holding the migration lock, from a backup taken when
+// latest was the latest applied version (see BackupFunc). It then reconciles the schema history table with the
+// restored database: the versions applied after the backup, still recorded when the history table was not part
+// of the backup, are removed from it. It returns the removed versions.
+func (m *Migrator) Restore(restore func() error, latest uint16) ([]uint16, error) {
+	removed := make([]uint16, 0)
+
+	err := m.repository.DoInLock(func() error {
+		if m.logger != nil {
+			m.logger.Info("Restoring the database", zap.Uint16("version", latest))
+		}
+
+		err := restore()
+		if err != nil {
+			return fmt.Errorf("error restoring the backup: %w", err)
+		}
+
+		pruner, ok := m.repository.(database.HistoryPruner)
+		if ok {
+			removed, err = pruner.PruneHistory(latest)
+			if err != nil {
+				return fmt.Errorf("error reconciling the schema history table: %w", err)
+			}
+		} else {
+			latestMigration, err := m.repository.GetLatestMigration()
+			if err != nil {
+				return fmt.Errorf("error reconciling the schema history table: %w", err)
+			}
+			if latestMigration > latest {
+				return fmt.Errorf("the schema history table records version %d, applied after the backup of version %d, and the driver can not remove it",
+					latestMigration, latest)
+			}
+		}
+
+		if len(removed) > 0 && m.logger != nil {
+			m.logger.Warn("Removed the versions applied after the backup from the schema history table",
+				zap.Uint16s("versions", removed))
+		}
+
+		return m.syncHistory()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return removed, nil
+}
@@ -0,0 +1,117 @@
+package migrator
+
+import (
+	"time"
+
+	"github.com/maestro-go/maestro/core/enums"
+)
+
+// MigrationResult describes what a call to Migrate did, so embedding applications can log and expose it.
+// It is returned even if the run fails, describing what was executed until the failure.
+type MigrationResult struct {
+	RunID     string
+	Direction enums.MigrationType
+
+	InitialVersion uint16 // Latest applied version before the run
+	FinalVersion   uint16 // Latest applied version after the run
+
+	Migrations []*MigrationExecution // Executed (up) or rolled back (down) migrations, in execution order
+	OutOfRange []uint16              // Versions of local migrations outside of the range of the run
+	Bypassed   []uint16              // Versions recorded as skipped in the history, without being executed (SkipVersions)
+	Hooks      []*HookExecution      // Executed hooks and assertions, in execution order
+	Warnings   []string
+
+	// Backup is the location of the backup taken before the destructive migrations of the run, empty if none.
+	Backup string
+
+	// RolledBack reports that the run failed inside a transaction, which undid the executed migrations and hooks.
+	RolledBack bool
+
+	// Resume is where a run that failed without transaction can be resumed from, nil otherwise.
+	Resume *ResumePoint
+
+	Duration time.Duration
+}
+
+// MigrationExecution is the execution of a migration during a run.
+type MigrationExecution struct {
+	Version     uint16
+	Description string
+	Duration    time.Duration
+	Owners      []string // Teams owning the migration (see conf.OwnersConfig), nil if none
+	Err         error    // nil if the migration succeeded
+}
+
+// HookExecution is the execution of a hook or an assertion during a run.
+type HookExecution struct {
+	Type      enums.HookType
+	Order     uint8
+	Version   uint16 // Only set for versioned hooks
+	Migration uint16 // Version of the migration the hook was executed for, 0 for hooks running once per run
+	FileName  string
+	Duration  time.Duration
+	Owners    []string // Teams owning the migration of the hook, or the default team, nil if none
+	Err       error    // nil if the hook succeeded
+}
+
+// Applied returns the versions of the migrations executed (or rolled back) successfully.
+func (r *MigrationResult) Applied() []uint16 {
+	versions := make([]uint16, 0, len(r.Migrations))
+	for _, migration := range r.Migrations {
+		if migration.Err == nil {
+			versions = append(versions, migration.Version)
+		}
+	}
+	return versions
+}
+
+// Failures returns the number of migrations and hooks that failed.
+func (r *MigrationResult) Failures() int {
+	failures := 0
+	for _, migration := range r.Migrations {
+		if migration.Err != nil {
+			failures++
+		}
+	}
+	for _, hook := range r.Hooks {
+		if hook.Err != nil {
+			failures++
+		}
+	}
+	return failures
+}
+
+// ErrorsByVersion returns the errors of the failed migrations and hooks, grouped by the version of the
+// migration they were executed for. Errors of hooks running once per run are grouped under version 0.
+func (r *MigrationResult) ErrorsByVersion() map[uint16][]error {
+	errs := make(map[uint16][]error)
+	for _, migration := range r.Migrations {
+		if migration.Err != nil {
+			errs[migration.Version] = append(errs[migration.Version], migration.Err)
+		}
+	}
+	for _, hook := range r.Hooks {
+		if hook.Err != nil {
+			errs[hook.Migration] = append(errs[hook.Migration], hook.Err)
+		}
+	}
+	return errs
+}
+
+func newMigrationResult(runID string, down bool) *MigrationResult {
+	result := &MigrationResult{
+		RunID:      runID,
+		Direction:  enums.MIGRATION_UP,
+		Migrations: make([]*MigrationExecution, 0),
+		OutOfRange: make([]uint16, 0),
+		Bypassed:   make([]uint16, 0),
+		Hooks:      make([]*HookExecution, 0),
+		Warnings:   make([]string, 0),
+	}
+
+	if down {
+		result.Direction = enums.MIGRATION_DOWN
+	}
+
+	return result
+}
@@ -0,0 +1,86 @@
+package migrator
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/maestro-go/maestro/core/database"
+	"github.com/maestro-go/maestro/internal/migrations"
+	"go.uber.org/zap"
+)
+
+// ResumePoint is where a run that failed without transaction stopped, so it can be resumed once the
+// issue is fixed instead of being evaluated from scratch.
+type ResumePoint struct {
+	RunID     string `json:"run_id"`
+	Version   uint16 `json:"version"`   // Version of the failed migration
+	Statement int    `json:"statement"` // 1-based index of the failed statement, 0 if the repository can not tell
+}
+
+// Resume migrates up from the failure point of a previous run: the failed migration is executed again,
+// starting at the failed statement when it is known, and the following migrations are executed as usual.
+// The latest applied version must still be the one before the failed migration.
+func (m *Migrator) Resume(point *ResumePoint) (*MigrationResult, error) {
+	if point == nil {
+		return nil, errors.New("no resume point")
+	}
+	if m.config.Down {
+		return nil, errors.New("only up runs can be resumed")
+	}
+
+	m.resume = point
+	defer func() {
+		m.resume = nil
+	}()
+
+	return m.Migrate()
+}
+
+// prepareResume checks that the database did not change since the failure, and skips the statements
+// of the failed migration that were executed before the failed one.
+func (m *Migrator) prepareResume(upMigrations []*migrations.Migration, latestMigration uint16) error {
+	if latestMigration+1 != m.resume.Version {
+		return fmt.Errorf("cannot resume from version %d: the latest applied version is %d",
+			m.resume.Version, latestMigration)
+	}
+
+	for _, migration := range upMigrations {
+		if migration.Version == m.resume.Version {
+			if m.resume.Statement > 1 {
+				migration.SkipStatements = m.resume.Statement - 1
+				if m.logger != nil {
+					m.logger.Info("Resuming migration", zap.Uint16("version", migration.Version),
+						zap.Int("statement", m.resume.Statement))
+				}
+			}
+			return nil
+		}
+	}
+
+	return fmt.Errorf("cannot resume from version %d: migration not found", m.resume.Version)
+}
+
+// resumePoint returns where the failed run can be resumed from: the first failed migration, and its
+// failed statement for repositories executing scripts one statement at a time. Nil if no migration failed.
+func (m *Migrator) resumePoint() *ResumePoint {
+	if m.config.Down {
+		return nil
+	}
+
+	for _, execution := range m.result.Migrations {
+		if execution.Err == nil {
+			continue
+		}
+
+		point := &ResumePoint{RunID: m.run.ID, Version: execution.Version}
+
+		var statementErr *database.StatementError
+		if errors.As(execution.Err, &statementErr) {
+			point.Statement = statementErr.Index
+		}
+
+		return point
+	}
+
+	return nil
+}
@@ -0,0 +1,298 @@
+package migrator
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/maestro-go/maestro/core/database"
+	"github.com/maestro-go/maestro/core/enums"
+	"github.com/maestro-go/maestro/internal/filesystem"
+	"github.com/maestro-go/maestro/internal/migrations"
+	"go.uber.org/zap"
+)
+
+// Validate validates the local migrations and the schema history table as a run does before migrating, also when
+// validation is disabled in the configuration: no unsucceeded migration is recorded, the local versions have no
+// gap, and the checksums of the applied migrations match the local ones. The database is only read: the lock is
+// not taken and no hook is executed. A missing schema history table has no applied migration.
+func (m *Migrator) Validate() error {
+	m.result = newMigrationResult(m.run.ID, false)
+
+	migrationsMap, _, errs := filesystem.LoadObjectsFromFiles(m.config)
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	versionRanges, err := migrations.ParseVersionRanges(m.config.Locations, m.config.VersionRanges)
+	if err != nil {
+		return err
+	}
+
+	exists, err := m.repository.CheckSchemaHistoryTable()
+	if err != nil {
+		return fmt.Errorf("error checking schema history table: %w", err)
+	}
+
+	if !exists {
+		return m.validateLocal(migrationsMap[enums.MIGRATION_UP], 0, versionRanges)
+	}
+
+	history, err := m.repository.GetAppliedMigrations()
+	if err != nil {
+		return fmt.Errorf("error getting applied migrations: %w", err)
+	}
+
+	return m.validate(migrationsMap[enums.MIGRATION_UP], history, database.LatestAppliedVersion(history),
+		versionRanges)
+}
+
+// validate checks that there are no unsucceeded migrations in the schema history table, and validates the local
+// migrations and their checksums against the applied ones.
+func (m *Migrator) validate(upMigrations []*migrations.Migration, history []*database.AppliedMigration,
+	latestMigration uint16, versionRanges migrations.VersionRanges) error {
+
+	// Assert that there are no unsucceeded migrations in database
+	failingMigrations := database.FailingAppliedMigrations(history)
+
+	ignoredVersions := m.validationIgnoredVersions(upMigrations)
+
+	errs := make([]error, 0)
+	for _, failingMigration := range failingMigrations {
+		// The failed migration of a resumed run is executed again
+		if m.resume != nil && failingMigration.Version == m.resume.Version {
+			continue
+		}
+
+		if ignoredVersions[failingMigration.Version] {
+			m.warn(fmt.Sprintf("Ignoring unsucceeded migration %d, excluded from validation", failingMigration.Version))
+			continue
+		}
+
+		if m.logger != nil {
+			m.logger.Error("Found an unsucceeded migration", zap.Uint16("version", failingMigration.Version))
+		}
+		errs = append(errs, fmt.Errorf("found an unsucceeded migration: %d", failingMigration.Version))
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	toValidate := upMigrations
+	if m.config.ValidateAppliedOnly {
+		toValidate = appliedMigrations(toValidate, latestMigration)
+	}
+
+	err := m.validateLocal(toValidate, latestMigration, versionRanges)
+	if err != nil {
+		return err
+	}
+
+	// Validate local <-> remote migrations
+	errs = m.repository.ValidateMigrations(toValidate)
+	errs = m.ignoreValidationErrors(errs, ignoredVersions)
+	if len(versionRanges) > 0 {
+		errs = ignoreMissingVersions(errs)
+	}
+	if m.config.ValidateAllowMissing {
+		errs = m.allowMissingLocalMigrations(errs, toValidate)
+	}
+	if len(errs) > 0 {
+		if m.logger != nil {
+			for _, err := range errs {
+				m.logger.Error("Validate database migrations error", zap.Error(err))
+			}
+		}
+		return errors.Join(errs...)
+	}
+
+	return nil
+}
+
+// validateLocal checks that the versions of the local migrations have no gap, each version range on its own.
+func (m *Migrator) validateLocal(toValidate []*migrations.Migration, latestMigration uint16,
+	versionRanges migrations.VersionRanges) error {
+
+	var errs []error
+	switch {
+	case len(versionRanges) > 0:
+		errs = migrations.ValidateMigrationsInRanges(toValidate, versionRanges, m.config.ValidateAllowMissing)
+	case m.config.ValidateAllowMissing:
+		errs = migrations.ValidateMigrationsFrom(toValidate, firstLocalVersion(toValidate, latestMigration))
+	default:
+		errs = migrations.ValidateMigrations(toValidate)
+	}
+	if len(errs) > 0 {
+		if m.logger != nil {
+			for _, err := range errs {
+				m.logger.Error("Validate local migrations error", zap.Error(err))
+			}
+		}
+		return errors.Join(errs...)
+	}
+
+	return nil
+}
+
+// appliedMigrations returns the local migrations up to the latest applied version.
+func appliedMigrations(localMigrations []*migrations.Migration, latestMigration uint16) []*migrations.Migration {
+	applied := make([]*migrations.Migration, 0, len(localMigrations))
+	for _, migration := range localMigrations {
+		if migration.Version <= latestMigration {
+			applied = append(applied, migration)
+		}
+	}
+	return applied
+}
+
+// firstLocalVersion returns the version the local migrations are expected to start at when the oldest
+// applied migrations may be missing locally: the first local version, as long as it leaves no gap
+// with the latest applied version.
+func firstLocalVersion(localMigrations []*migrations.Migration, latestMigration uint16) uint16 {
+	if len(localMigrations) < 1 || localMigrations[0].Version > latestMigration+1 {
+		return latestMigration + 1
+	}
+	return localMigrations[0].Version
+}
+
+// allowMissingLocalMigrations turns the validation errors of applied migrations without local migration
+// into warnings, e.g. when old migrations were archived out of the repository after squashing.
+func (m *Migrator) allowMissingLocalMigrations(errs []error, localMigrations []*migrations.Migration) []error {
+	localVersions := make(map[uint16]bool, len(localMigrations))
+	for _, migration := range localMigrations {
+		localVersions[migration.Version] = true
+	}
+
+	remaining := make([]error, 0, len(errs))
+	for _, err := range errs {
+		var mismatch *database.MismatchError
+		if errors.As(err, &mismatch) && !localVersions[mismatch.Version] {
+			m.warn(fmt.Sprintf("Applied migration %d (%s) is missing locally", mismatch.Version, mismatch.Description))
+			continue
+		}
+		remaining = append(remaining, err)
+	}
+
+	if len(remaining) > 0 {
+		return remaining
+	}
+	return nil
+}
+
+// validationIgnoredVersions returns the versions excluded from validation, listed in validation-ignore or
+// marked with a "-- maestro:skip-validation" directive.
+func (m *Migrator) validationIgnoredVersions(localMigrations []*migrations.Migration) map[uint16]bool {
+	ignored := make(map[uint16]bool, len(m.config.ValidationIgnore))
+	for _, version := range m.config.ValidationIgnore {
+		ignored[version] = true
+	}
+	for _, migration := range localMigrations {
+		if migration.SkipValidation {
+			ignored[migration.Version] = true
+		}
+	}
+	return ignored
+}
+
+// ignoreValidationErrors drops the mismatches of the history entries excluded from validation.
+func (m *Migrator) ignoreValidationErrors(errs []error, ignoredVersions map[uint16]bool) []error {
+	if len(ignoredVersions) < 1 {
+		return errs
+	}
+
+	remaining := make([]error, 0, len(errs))
+	for _, err := range errs {
+		var mismatch *database.MismatchError
+		if errors.As(err, &mismatch) && ignoredVersions[mismatch.Version] {
+			if m.logger != nil {
+				m.logger.Info("Ignoring mismatch of migration excluded from validation", zap.Uint16("version", mismatch.Version))
+			}
+			continue
+		}
+		remaining = append(remaining, err)
+	}
+
+	if len(remaining) > 0 {
+		return remaining
+	}
+	return nil
+}
+
+// ignoreMissingVersions drops the versions missing in the schema history table, used with version ranges whose
+// blocks of versions are applied on their own: a missing version is either pending, or between two blocks.
+func ignoreMissingVersions(errs []error) []error {
+	remaining := make([]error, 0, len(errs))
+	for _, err := range errs {
+		var missing *database.MissingVersionError
+		if !errors.As(err, &missing) {
+			remaining = append(remaining, err)
+		}
+	}
+
+	if len(remaining) > 0 {
+		return remaining
+	}
+	return nil
+}
+
+// appliedVersions returns the versions with a successful row in the schema history table.
+func appliedVersions(history []*database.AppliedMigration) map[uint16]bool {
+	applied := make(map[uint16]bool, len(history))
+	for _, migration := range history {
+		applied[migration.Version] = migration.Success
+	}
+	return applied
+}
+
+// pendingMigrations returns the local migrations without successful row in the schema history table.
+func pendingMigrations(localMigrations []*migrations.Migration, history []*database.AppliedMigration) []*migrations.Migration {
+	applied := appliedVersions(history)
+
+	pending := make([]*migrations.Migration, 0)
+	for _, migration := range localMigrations {
+		if !applied[migration.Version] {
+			pending = append(pending, migration)
+		}
+	}
+	return pending
+}
+
+// checkLocationDependencies checks, before anything is executed, that the migrations of the run respect
+// the dependencies between locations: up migrations run once the locations they depend on are at their
+// minimum version, and down migrations do not roll back a version required by migrations staying applied.
+func (m *Migrator) checkLocationDependencies(dependencies migrations.LocationDependencies,
+	migrationsMap map[enums.MigrationType][]*migrations.Migration, history []*database.AppliedMigration,
+	upMigrations []*migrations.Migration, from uint16, latestMigration uint16) error {
+
+	if len(dependencies) == 0 {
+		return nil
+	}
+
+	var errs []error
+	if m.config.Down {
+		rolledBack := make([]*migrations.Migration, 0)
+		for _, migration := range migrationsMap[enums.MIGRATION_DOWN] {
+			if migration.Version > *m.config.Destination && migration.Version <= latestMigration {
+				rolledBack = append(rolledBack, migration)
+			}
+		}
+		errs = dependencies.CheckRollback(migrationsMap[enums.MIGRATION_UP], appliedVersions(history), rolledBack)
+	} else {
+		run := make([]*migrations.Migration, 0)
+		for _, migration := range upMigrations {
+			if migration.Version >= from && migration.Version <= *m.config.Destination {
+				run = append(run, migration)
+			}
+		}
+		errs = dependencies.Check(migrationsMap[enums.MIGRATION_UP], appliedVersions(history), run)
+	}
+
+	if len(errs) > 0 {
+		if m.logger != nil {
+			for _, err := range errs {
+				m.logger.Error("Location dependency error", zap.Error(err))
+			}
+		}
+		return errors.Join(errs...)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package parser
+
+import "strings"
+
+// NearMiss returns an *Error if the name, which ParseFileName does not parse as a file of maestro, looks like
+// one but does not match its pattern, e.g. V001_users.SQL, v001_users.sql or V_001_users.sql, as such files
+// would be silently ignored. Nil is returned for the other names.
+func NearMiss(name string, extension string) error {
+	dot := strings.LastIndexByte(name, '.')
+	if dot <= 0 {
+		return nil
+	}
+	stem, nameExtension := name[:dot], name[dot+1:]
+
+	what := looksLike(stem)
+	if what == "" {
+		return nil
+	}
+
+	if nameExtension != extension {
+		if !strings.EqualFold(nameExtension, extension) {
+			return nil
+		}
+		fileName, err := ParseFileName(stem+"."+extension, extension)
+		if fileName == nil && err == nil {
+			return nil
+		}
+		return newError(name, dot+1, "looks like a %s but does not match its pattern because the extension %q is not %q",
+			what, nameExtension, extension)
+	}
+
+	letters := prefixLength(stem)
+	if letters == len(stem) {
+		return nil
+	}
+	prefix := stem[:letters]
+
+	if upper := strings.ToUpper(prefix); prefix != upper && isDigit(stem[letters]) {
+		return newError(name, 0, "looks like a %s but does not match its pattern because the prefix %q is not %q",
+			what, prefix, upper)
+	}
+
+	// e.g. V_001_users.sql or V-001_users.sql
+	if !isDigit(stem[letters]) && letters+1 < len(stem) && isDigit(stem[letters+1]) {
+		return newError(name, letters, "looks like a %s but does not match its pattern because of the %q between "+
+			"the prefix %q and the number", what, stem[letters], prefix)
+	}
+
+	return nil
+}
+
+// looksLike returns the name of the kind of files the stem looks like, ignoring the case of its prefix, or an
+// empty string if it does not look like a file of maestro.
+func looksLike(stem string) string {
+	if strings.HasSuffix(stem, template_suffix) {
+		return "template"
+	}
+
+	letters := prefixLength(stem)
+	if letters == 0 || letters == len(stem) {
+		return ""
+	}
+
+	spec, ok := prefixes[strings.ToUpper(stem[:letters])]
+	if !ok {
+		return ""
+	}
+	return spec.name
+}
+
+// prefixLength returns the number of ASCII letters the stem starts with.
+func prefixLength(stem string) int {
+	letters := 0
+	for letters < len(stem) && (stem[letters] >= 'A' && stem[letters] <= 'Z' || stem[letters] >= 'a' && stem[letters] <= 'z') {
+		letters++
+	}
+	return letters
+}
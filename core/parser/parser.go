@@ -0,0 +1,215 @@
+// Package parser parses the names of the migration, hook, seed and template files, and the template
+// references of their contents. Malformed inputs are reported with the position and the reason of the error.
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Kind is the kind of file of a file name.
+type Kind int
+
+const (
+	KIND_MIGRATION      Kind = iota // V001_description.sql
+	KIND_DATA_MIGRATION             // D001_description.sql
+	KIND_HOOK                       // e.g. B01_description.sql or BV01_001_description.sql
+	KIND_SEED                       // S001_description.sql or S001_description.environment.sql
+	KIND_TEMPLATE                   // name.template.sql
+)
+
+// template_suffix ends the names of template files, before the extension.
+const template_suffix = ".template"
+
+// prefix describes the files of a prefix.
+type prefix struct {
+	kind      Kind
+	name      string // Name of the files in error messages
+	ordered   bool   // Hooks have an order instead of a version
+	versioned bool   // Versioned hooks have a version after their order
+	down      bool   // Down files end with ".down"
+}
+
+// prefixes are the file prefixes, followed by the version or order of the files.
+var prefixes = map[string]prefix{
+	"V":    {kind: KIND_MIGRATION, name: "migration", down: true},
+	"D":    {kind: KIND_DATA_MIGRATION, name: "data migration", down: true},
+	"S":    {kind: KIND_SEED, name: "seed"},
+	"R":    {kind: KIND_HOOK, name: "repeatable hook", ordered: true, down: true},
+	"B":    {kind: KIND_HOOK, name: "before hook", ordered: true},
+	"BE":   {kind: KIND_HOOK, name: "before each hook", ordered: true},
+	"BV":   {kind: KIND_HOOK, name: "before version hook", ordered: true, versioned: true, down: true},
+	"A":    {kind: KIND_HOOK, name: "after hook", ordered: true},
+	"AE":   {kind: KIND_HOOK, name: "after each hook", ordered: true},
+	"AV":   {kind: KIND_HOOK, name: "after version hook", ordered: true, versioned: true, down: true},
+	"T":    {kind: KIND_HOOK, name: "assertion hook", ordered: true},
+	"BVAL": {kind: KIND_HOOK, name: "before validate hook", ordered: true},
+	"RS":   {kind: KIND_HOOK, name: "run start hook", ordered: true},
+	"RE":   {kind: KIND_HOOK, name: "run end hook", ordered: true},
+}
+
+// FileName is a parsed file name.
+type FileName struct {
+	Kind        Kind
+	Prefix      string // Letters before the version or order, e.g. "V" or "BV", empty for templates
+	Version     uint16 // Version of migrations, seeds and versioned hooks
+	Order       uint8  // Order of hooks
+	Description string // Description, or name of templates
+	Environment string // Environment of seeds, empty if they apply to all of them
+	Down        bool   // Down migrations and hooks
+}
+
+// Error is an error at a position of a parsed input.
+type Error struct {
+	Offset int // Byte offset of the error in the input
+	Line   int // 1-based line of the offset
+	Column int // 1-based column of the offset, in bytes
+	Reason string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d:%d: %s", e.Line, e.Column, e.Reason)
+}
+
+// newError returns the error at the offset of the input.
+func newError(input string, offset int, format string, args ...any) *Error {
+	line := 1 + strings.Count(input[:offset], "\n")
+	column := offset - strings.LastIndexByte(input[:offset], '\n')
+	return &Error{Offset: offset, Line: line, Column: column, Reason: fmt.Sprintf(format, args...)}
+}
+
+// ParseFileName parses the name of a file with the extension (e.g. "sql"). Names starting with the prefix of
+// a kind of file followed by a digit, or ending with ".template" before the extension, are files of maestro,
+// and an *Error is returned if they are malformed. Nil is returned, without error, for other names.
+func ParseFileName(name string, extension string) (*FileName, error) {
+	stem, ok := strings.CutSuffix(name, "."+extension)
+	if !ok || stem == "" {
+		return nil, nil
+	}
+
+	if template, ok := strings.CutSuffix(stem, template_suffix); ok {
+		if template == "" {
+			return nil, newError(name, 0, "missing template name")
+		}
+		if i := strings.IndexByte(template, '.'); i >= 0 {
+			return nil, newError(name, i, "unexpected '.' in the template name")
+		}
+		return &FileName{Kind: KIND_TEMPLATE, Description: template}, nil
+	}
+
+	letters := 0
+	for letters < len(stem) && stem[letters] >= 'A' && stem[letters] <= 'Z' {
+		letters++
+	}
+	if letters == 0 || letters == len(stem) || !isDigit(stem[letters]) {
+		return nil, nil
+	}
+
+	spec, ok := prefixes[stem[:letters]]
+	if !ok {
+		return nil, nil
+	}
+
+	fileName := &FileName{Kind: spec.kind, Prefix: stem[:letters]}
+	offset := letters
+
+	if spec.ordered {
+		order, end, err := parseNumber(name, offset, "order", 8)
+		if err != nil {
+			return nil, err
+		}
+		fileName.Order = uint8(order)
+		offset = end
+
+		if spec.versioned {
+			if offset >= len(stem) || stem[offset] != '_' || offset+1 >= len(stem) || !isDigit(stem[offset+1]) {
+				return nil, newError(name, offset, "expected '_' and the version after the order of the %s", spec.name)
+			}
+			offset++
+		}
+	}
+
+	if !spec.ordered || spec.versioned {
+		version, end, err := parseNumber(name, offset, "version", 16)
+		if err != nil {
+			return nil, err
+		}
+		fileName.Version = uint16(version)
+		offset = end
+	}
+
+	number := "version"
+	if spec.ordered && !spec.versioned {
+		number = "order"
+	}
+
+	if offset >= len(stem) {
+		return nil, newError(name, offset, "missing '_' and description after the %s", number)
+	}
+	if stem[offset] != '_' {
+		return nil, newError(name, offset, "expected '_' after the %s, found %q", number, stem[offset])
+	}
+	offset++
+	if spec.kind == KIND_DATA_MIGRATION && offset+1 < len(stem) && stem[offset] == '_' && stem[offset+1] != '.' {
+		offset++ // D001__description.sql
+	}
+
+	description := stem[offset:]
+	if spec.kind == KIND_SEED {
+		if i := strings.IndexByte(description, '.'); i >= 0 {
+			fileName.Environment = description[i+1:]
+			if fileName.Environment == "" {
+				return nil, newError(name, offset+i+1, "missing environment after '.'")
+			}
+			if j := strings.IndexByte(fileName.Environment, '.'); j >= 0 {
+				return nil, newError(name, offset+i+1+j, "unexpected '.' in the environment")
+			}
+			description = description[:i]
+		}
+	} else if trimmed, ok := strings.CutSuffix(description, ".down"); ok {
+		if !spec.down {
+			return nil, newError(name, offset+len(trimmed), "down files are not supported for the %s", spec.name)
+		}
+		fileName.Down = true
+		description = trimmed
+	}
+
+	if description == "" {
+		return nil, newError(name, offset, "missing description")
+	}
+	if i := strings.IndexByte(description, '.'); i >= 0 {
+		return nil, newError(name, offset+i, "unexpected '.' in the description")
+	}
+	fileName.Description = description
+
+	return fileName, nil
+}
+
+// parseNumber parses the digits at the offset of the name as an unsigned number of the bit size, and returns
+// it with the offset after its digits.
+func parseNumber(name string, offset int, what string, bitSize int) (uint64, int, error) {
+	end := offset
+	for end < len(name) && isDigit(name[end]) {
+		end++
+	}
+	if end == offset {
+		return 0, offset, newError(name, offset, "missing %s", what)
+	}
+
+	number, err := strconv.ParseUint(name[offset:end], 10, bitSize)
+	if errors.Is(err, strconv.ErrRange) {
+		return 0, offset, newError(name, offset, "%s %s out of range, at most %d", what, name[offset:end],
+			uint64(1)<<bitSize-1)
+	}
+	if err != nil {
+		return 0, offset, newError(name, offset, "invalid %s: %v", what, err)
+	}
+
+	return number, end, nil
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
@@ -0,0 +1,256 @@
+package parser
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/maestro-go/maestro/internal/conf"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseFileName(t *testing.T) {
+	tests := []struct {
+		name      string
+		extension string
+		expected  *FileName
+	}{
+		{"V001_create_users.sql", "sql", &FileName{Kind: KIND_MIGRATION, Prefix: "V", Version: 1,
+			Description: "create_users"}},
+		{"V012_create_users.down.sql", "sql", &FileName{Kind: KIND_MIGRATION, Prefix: "V", Version: 12,
+			Description: "create_users", Down: true}},
+		{"V003_users.json", "json", &FileName{Kind: KIND_MIGRATION, Prefix: "V", Version: 3, Description: "users"}},
+		{"D002__backfill.sql", "sql", &FileName{Kind: KIND_DATA_MIGRATION, Prefix: "D", Version: 2,
+			Description: "backfill"}},
+		{"D002__.sql", "sql", &FileName{Kind: KIND_DATA_MIGRATION, Prefix: "D", Version: 2, Description: "_"}},
+		{"S001_users.sql", "sql", &FileName{Kind: KIND_SEED, Prefix: "S", Version: 1, Description: "users"}},
+		{"S001_users.dev.sql", "sql", &FileName{Kind: KIND_SEED, Prefix: "S", Version: 1, Description: "users",
+			Environment: "dev"}},
+		{"R01_views.down.sql", "sql", &FileName{Kind: KIND_HOOK, Prefix: "R", Order: 1, Description: "views",
+			Down: true}},
+		{"BE02_audit.sql", "sql", &FileName{Kind: KIND_HOOK, Prefix: "BE", Order: 2, Description: "audit"}},
+		{"AV01_012_refresh.sql", "sql", &FileName{Kind: KIND_HOOK, Prefix: "AV", Order: 1, Version: 12,
+			Description: "refresh"}},
+		{"BVAL01_check.sql", "sql", &FileName{Kind: KIND_HOOK, Prefix: "BVAL", Order: 1, Description: "check"}},
+		{"audit_columns.template.sql", "sql", &FileName{Kind: KIND_TEMPLATE, Description: "audit_columns"}},
+
+		// Not files of maestro
+		{"README.md", "sql", nil},
+		{"V001_users.sql", "json", nil},
+		{"VIEW_users.sql", "sql", nil},
+		{"X001_users.sql", "sql", nil},
+		{"v001_users.sql", "sql", nil},
+		{".sql", "sql", nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fileName, err := ParseFileName(test.name, test.extension)
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, fileName)
+		})
+	}
+}
+
+func TestParseFileNameErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"V001.sql", "1:5: missing '_' and description after the version"},
+		{"V001-users.sql", "1:5: expected '_' after the version, found '-'"},
+		{"V001_.sql", "1:6: missing description"},
+		{"V1.2_users.sql", "1:3: expected '_' after the version, found '.'"},
+		{"V001_create.users.sql", "1:12: unexpected '.' in the description"},
+		{"V70000_users.sql", "1:2: version 70000 out of range, at most 65535"},
+		{"B300_users.sql", "1:2: order 300 out of range, at most 255"},
+		{"BV01_users.sql", "1:5: expected '_' and the version after the order of the before version hook"},
+		{"B01_users.down.sql", "1:10: down files are not supported for the before hook"},
+		{"S001_users.dev.local.sql", "1:15: unexpected '.' in the environment"},
+		{"S001_users..sql", "1:12: missing environment after '.'"},
+		{".template.sql", "1:1: missing template name"},
+		{"audit.columns.template.sql", "1:6: unexpected '.' in the template name"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fileName, err := ParseFileName(test.name, "sql")
+			assert.Nil(t, fileName)
+			assert.EqualError(t, err, test.expected)
+
+			var parseErr *Error
+			assert.True(t, errors.As(err, &parseErr))
+		})
+	}
+}
+
+func TestNearMiss(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"V001_users.SQL", `1:12: looks like a migration but does not match its pattern because the extension "SQL" is not "sql"`},
+		{"audit.template.Sql", `1:16: looks like a template but does not match its pattern because the extension "Sql" is not "sql"`},
+		{"v001_users.sql", `1:1: looks like a migration but does not match its pattern because the prefix "v" is not "V"`},
+		{"Bv01_002_users.sql", `1:1: looks like a before version hook but does not match its pattern because the prefix "Bv" is not "BV"`},
+		{"V_001_users.sql", `1:2: looks like a migration but does not match its pattern because of the '_' between the prefix "V" and the number`},
+		{"R-01_views.sql", `1:2: looks like a repeatable hook but does not match its pattern because of the '-' between the prefix "R" and the number`},
+
+		// Not files of maestro
+		{"README.md", ""},
+		{"notes.SQL", ""},
+		{"V001_users.sql.bak", ""},
+		{"views.sql", ""},
+		{"a_notes.sql", ""},
+		{"V001_users.sql", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := NearMiss(test.name, "sql")
+			if test.expected == "" {
+				assert.NoError(t, err)
+				return
+			}
+
+			assert.EqualError(t, err, test.expected)
+		})
+	}
+}
+
+func TestParseReferences(t *testing.T) {
+	content := "CREATE TABLE users ({{ audit_columns }});\n{{updated_at_trigger, users, 'a b' }} {{x,}}"
+
+	references, err := ParseReferences(content)
+	assert.NoError(t, err)
+	assert.Equal(t, []*Reference{
+		{Name: "audit_columns", Arguments: []string{}, Offset: 20, End: 39},
+		{Name: "updated_at_trigger", Arguments: []string{"users", "'a b'"}, Offset: 42, End: 79},
+		{Name: "x", Arguments: []string{""}, Offset: 80, End: 86},
+	}, references)
+
+	// Braces of other syntaxes are not references
+	references, err = ParseReferences("SELECT '{{1,2},{3,4}}'::int[], '{}', '{{'")
+	assert.NoError(t, err)
+	assert.Empty(t, references)
+
+	_, err = ParseReferences("SELECT 1;\n  {{ , users}}")
+	assert.EqualError(t, err, `2:3: missing template name in "{{ , users}}"`)
+}
+
+// legacyFileNameRegexes are the regexes matching the file names before the parser, by kind and down flag.
+var legacyFileNameRegexes = []struct {
+	kind  Kind
+	down  bool
+	regex *regexp.Regexp
+}{
+	{KIND_MIGRATION, false, regexp.MustCompile(conf.MIGRATION_REGEX)},
+	{KIND_MIGRATION, true, regexp.MustCompile(conf.MIGRATION_DOWN_REGEX)},
+	{KIND_DATA_MIGRATION, false, regexp.MustCompile(conf.DATA_MIGRATION_REGEX)},
+	{KIND_DATA_MIGRATION, true, regexp.MustCompile(conf.DATA_MIGRATION_DOWN_REGEX)},
+	{KIND_SEED, false, regexp.MustCompile(conf.SEED_REGEX)},
+	{KIND_HOOK, false, regexp.MustCompile(conf.HOOK_REPEATABLE_REGEX)},
+	{KIND_HOOK, true, regexp.MustCompile(conf.HOOK_REPEATABLE_DOWN_REGEX)},
+	{KIND_HOOK, false, regexp.MustCompile(conf.HOOK_BEFORE_REGEX)},
+	{KIND_HOOK, false, regexp.MustCompile(conf.HOOK_BEFORE_EACH_REGEX)},
+	{KIND_HOOK, false, regexp.MustCompile(conf.HOOK_AFTER_REGEX)},
+	{KIND_HOOK, false, regexp.MustCompile(conf.HOOK_AFTER_EACH_REGEX)},
+	{KIND_HOOK, false, regexp.MustCompile(conf.HOOK_ASSERTION_REGEX)},
+	{KIND_HOOK, false, regexp.MustCompile(conf.HOOK_BEFORE_VALIDATE_REGEX)},
+	{KIND_HOOK, false, regexp.MustCompile(conf.HOOK_RUN_START_REGEX)},
+	{KIND_HOOK, false, regexp.MustCompile(conf.HOOK_RUN_END_REGEX)},
+	{KIND_HOOK, false, regexp.MustCompile(conf.HOOK_BEFORE_VERSION_REGEX)},
+	{KIND_HOOK, false, regexp.MustCompile(conf.HOOK_AFTER_VERSION_REGEX)},
+	{KIND_HOOK, true, regexp.MustCompile(conf.HOOK_BEFORE_VERSION_DOWN_REGEX)},
+	{KIND_HOOK, true, regexp.MustCompile(conf.HOOK_AFTER_VERSION_DOWN_REGEX)},
+	{KIND_TEMPLATE, false, regexp.MustCompile(conf.TEMPLATE_REGEX)},
+}
+
+func FuzzParseFileName(f *testing.F) {
+	for _, seed := range []string{"V001_users.sql", "V001_users.down.sql", "D01__x.sql", "S1_a.dev.sql",
+		"BV01_002_x.down.sql", "BVAL1_x.sql", "x.template.sql", "V1.2_x.sql", "B300_x.sql", "README.md", "v001_x.SQL", "V_1_x.sql"} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, name string) {
+		fileName, err := ParseFileName(name, "sql")
+		checkError(t, name, err)
+
+		if fileName == nil && err == nil {
+			checkError(t, name, NearMiss(name, "sql"))
+		}
+
+		var parseErr *Error
+		errors.As(err, &parseErr)
+
+		// The names matched by the legacy regexes are parsed the same way, unless their numbers are out of range
+		for _, legacy := range legacyFileNameRegexes {
+			matches := legacy.regex.FindStringSubmatch(name)
+			if matches == nil {
+				continue
+			}
+
+			if err != nil {
+				if !strings.Contains(parseErr.Reason, "out of range") {
+					t.Fatalf("%q: matched by %s, got error %v", name, legacy.regex, err)
+				}
+				return
+			}
+
+			if fileName == nil || fileName.Kind != legacy.kind || fileName.Down != legacy.down {
+				t.Fatalf("%q: matched by %s, got %+v", name, legacy.regex, fileName)
+			}
+			if description := matches[len(matches)-1]; legacy.kind != KIND_SEED && fileName.Description != description {
+				t.Fatalf("%q: description %q, expected %q", name, fileName.Description, description)
+			}
+			return
+		}
+	})
+}
+
+// checkError fails the test if the error of the name is not an *Error in the name.
+func checkError(t *testing.T, name string, err error) {
+	var parseErr *Error
+	if errors.As(err, &parseErr) {
+		if parseErr.Offset < 0 || parseErr.Offset > len(name) {
+			t.Fatalf("%q: error out of the name: %v", name, err)
+		}
+	} else if err != nil {
+		t.Fatalf("%q: unexpected error type %T", name, err)
+	}
+}
+
+func FuzzParseReferences(f *testing.F) {
+	for _, seed := range []string{"{{a}}", "{{ a, 1, 2 }}", "{{1,2},{3,4}}", "{{}}", "{{ }}", "{{{a}}}", "a\n{{,}}"} {
+		f.Add(seed)
+	}
+
+	legacy := regexp.MustCompile(`\{\{([^}]+)\}\}`)
+
+	f.Fuzz(func(t *testing.T, content string) {
+		references, err := ParseReferences(content)
+
+		var parseErr *Error
+		if errors.As(err, &parseErr) {
+			if parseErr.Offset < 0 || parseErr.Offset >= len(content) {
+				t.Fatalf("%q: error out of the content: %v", content, err)
+			}
+			return
+		} else if err != nil {
+			t.Fatalf("%q: unexpected error type %T", content, err)
+		}
+
+		// The references are the matches of the legacy regex
+		matches := legacy.FindAllStringIndex(content, -1)
+		if len(matches) != len(references) {
+			t.Fatalf("%q: %d references, expected %d", content, len(references), len(matches))
+		}
+		for i, match := range matches {
+			if references[i].Offset != match[0] || references[i].End != match[1] {
+				t.Fatalf("%q: reference %d at %d-%d, expected %d-%d", content, i, references[i].Offset,
+					references[i].End, match[0], match[1])
+			}
+		}
+	})
+}
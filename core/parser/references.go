@@ -0,0 +1,56 @@
+package parser
+
+import "strings"
+
+// Reference is a reference to a template in a content: {{name}}, or {{name, argument, ...}} for templates
+// with parameters.
+type Reference struct {
+	Name      string   // Name of the template, without surrounding spaces
+	Arguments []string // Arguments, without surrounding spaces
+	Offset    int      // Byte offset of the opening braces in the content
+	End       int      // Byte offset after the closing braces in the content
+}
+
+// ParseReferences returns the template references of the content, in order. A reference is made of the
+// characters between "{{" and the next "}}", none of them being "}", so other braces, e.g. the ones of
+// PostgreSQL array literals, are not references. Returns an *Error for references without template name.
+func ParseReferences(content string) ([]*Reference, error) {
+	references := make([]*Reference, 0)
+
+	for offset := 0; offset < len(content); {
+		start := strings.Index(content[offset:], "{{")
+		if start < 0 {
+			break
+		}
+		start += offset
+
+		end := start + 2
+		for end < len(content) && content[end] != '}' {
+			end++
+		}
+
+		if end == start+2 || !strings.HasPrefix(content[end:], "}}") {
+			offset = start + 1
+			continue
+		}
+
+		values := strings.Split(content[start+2:end], ",")
+		for i := range values {
+			values[i] = strings.TrimSpace(values[i])
+		}
+
+		if values[0] == "" {
+			return nil, newError(content, start, "missing template name in %q", content[start:end+2])
+		}
+
+		references = append(references, &Reference{
+			Name:      values[0],
+			Arguments: values[1:],
+			Offset:    start,
+			End:       end + 2,
+		})
+		offset = end + 2
+	}
+
+	return references, nil
+}
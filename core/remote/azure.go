@@ -0,0 +1,75 @@
+package remote
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+)
+
+// AzureLoader downloads the az:// locations with the Blob Storage client, authenticated by the default Azure
+// credential: environment variables, workload or managed identity, or the credentials of the az command line.
+type AzureLoader struct {
+	// Credential of the client, the default Azure credential if nil
+	Credential azcore.TokenCredential
+
+	// ServiceURL returns the URL of the blob service of the storage account, https://<account>.blob.core.windows.net/
+	// if nil
+	ServiceURL func(account string) string
+
+	// Options of the client
+	Options *azblob.ClientOptions
+}
+
+func (l *AzureLoader) Download(ctx context.Context, location *Location, dir string) error {
+	credential := l.Credential
+	if credential == nil {
+		var err error
+		credential, err = azidentity.NewDefaultAzureCredential(nil)
+		if err != nil {
+			return fmt.Errorf("failed to load Azure credential: %w", err)
+		}
+	}
+
+	serviceURL := fmt.Sprintf("https://%s.blob.core.windows.net/", location.Account)
+	if l.ServiceURL != nil {
+		serviceURL = l.ServiceURL(location.Account)
+	}
+
+	client, err := azblob.NewClient(serviceURL, credential, l.Options)
+	if err != nil {
+		return fmt.Errorf("failed to create Blob Storage client: %w", err)
+	}
+
+	prefix := objectsPrefix(location)
+
+	pager := client.NewListBlobsFlatPager(location.Bucket, &azblob.ListBlobsFlatOptions{Prefix: &prefix})
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list blobs: %w", err)
+		}
+
+		for _, item := range page.Segment.BlobItems {
+			name := *item.Name
+			if isFolderObject(name) {
+				continue
+			}
+
+			response, err := client.DownloadStream(ctx, location.Bucket, name, nil)
+			if err != nil {
+				return fmt.Errorf("failed to download %s: %w", name, err)
+			}
+
+			err = writeObject(dir, name[len(prefix):], response.Body)
+			response.Body.Close()
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,56 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+)
+
+// GCSLoader downloads the gs:// locations with the Cloud Storage client, authenticated by the application default
+// credentials: the GOOGLE_APPLICATION_CREDENTIALS file, the gcloud credentials or the service account of the
+// instance.
+type GCSLoader struct {
+	// Options of the client, e.g. the endpoint of an emulator
+	Options []option.ClientOption
+}
+
+func (l *GCSLoader) Download(ctx context.Context, location *Location, dir string) error {
+	client, err := storage.NewClient(ctx, l.Options...)
+	if err != nil {
+		return fmt.Errorf("failed to create Cloud Storage client: %w", err)
+	}
+	defer client.Close()
+
+	bucket := client.Bucket(location.Bucket)
+	prefix := objectsPrefix(location)
+
+	objects := bucket.Objects(ctx, &storage.Query{Prefix: prefix})
+	for {
+		attrs, err := objects.Next()
+		if errors.Is(err, iterator.Done) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to list objects: %w", err)
+		}
+
+		if isFolderObject(attrs.Name) {
+			continue
+		}
+
+		reader, err := bucket.Object(attrs.Name).NewReader(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to download %s: %w", attrs.Name, err)
+		}
+
+		err = writeObject(dir, attrs.Name[len(prefix):], reader)
+		reader.Close()
+		if err != nil {
+			return err
+		}
+	}
+}
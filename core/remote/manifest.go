@@ -0,0 +1,125 @@
+package remote
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// manifest_file is the file of a remote location listing the SHA-256 checksums of its files, in the format of
+// sha256sum, signed by the signature_file file.
+const manifest_file = "maestro.sha256"
+
+// signature_file is the file of a remote location with the Ed25519 signature of its manifest, raw or in base64.
+const signature_file = "maestro.sha256.sig"
+
+// VerifyManifest returns an error unless the manifest of the directory is signed by the key, and lists
+// every other file of the directory with its checksum.
+func VerifyManifest(dir string, key ed25519.PublicKey) error {
+	manifest, err := os.ReadFile(filepath.Join(dir, manifest_file))
+	if err != nil {
+		return fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	signature, err := os.ReadFile(filepath.Join(dir, signature_file))
+	if err != nil {
+		return fmt.Errorf("failed to read manifest signature: %w", err)
+	}
+
+	if len(signature) != ed25519.SignatureSize {
+		signature, err = base64.StdEncoding.DecodeString(string(bytes.TrimSpace(signature)))
+		if err != nil {
+			return fmt.Errorf("invalid manifest signature: %w", err)
+		}
+	}
+
+	if !ed25519.Verify(key, manifest, signature) {
+		return fmt.Errorf("%s is not signed by the remote key", manifest_file)
+	}
+
+	checksums, err := parseManifest(manifest)
+	if err != nil {
+		return err
+	}
+
+	err = filepath.WalkDir(dir, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+
+		name, err := filepath.Rel(dir, file)
+		if err != nil {
+			return err
+		}
+		name = filepath.ToSlash(name)
+
+		if name == manifest_file || name == signature_file {
+			return nil
+		}
+
+		checksum, ok := checksums[name]
+		if !ok {
+			return fmt.Errorf("%s is not listed in %s", name, manifest_file)
+		}
+		delete(checksums, name)
+
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+
+		sum := sha256.Sum256(content)
+		if hex.EncodeToString(sum[:]) != checksum {
+			return fmt.Errorf("%s does not match its checksum in %s", name, manifest_file)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for name := range checksums {
+		return fmt.Errorf("%s is listed in %s but missing", name, manifest_file)
+	}
+
+	return nil
+}
+
+// parseManifest returns the checksums of the files of the manifest, by relative path. The lines are the
+// ones of sha256sum: the hexadecimal checksum, a space, a space or '*', and the path.
+func parseManifest(manifest []byte) (map[string]string, error) {
+	checksums := make(map[string]string)
+
+	scanner := bufio.NewScanner(bytes.NewReader(manifest))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+
+		checksum, name, found := strings.Cut(text, " ")
+		name = strings.TrimPrefix(strings.TrimPrefix(name, " "), "*")
+		if _, err := hex.DecodeString(checksum); !found || err != nil || len(checksum) != sha256.Size*2 {
+			return nil, fmt.Errorf("%s: line %d: invalid checksum", manifest_file, line)
+		}
+
+		name = path.Clean(strings.TrimPrefix(name, "./"))
+		if name == "." || path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+			return nil, fmt.Errorf("%s: line %d: invalid path %q", manifest_file, line, name)
+		}
+
+		checksums[name] = strings.ToLower(checksum)
+	}
+
+	return checksums, scanner.Err()
+}
@@ -0,0 +1,234 @@
+// Package remote downloads the remote migration locations, s3://bucket/prefix, gs://bucket/prefix or
+// az://account/container/prefix, with the SDK of their cloud, and verifies them with their signed manifest.
+package remote
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/maestro-go/maestro/core/conf"
+	"go.uber.org/zap"
+)
+
+// Location is a parsed remote location.
+type Location struct {
+	Scheme  string // s3, gs or az
+	Account string // Storage account of az locations, empty otherwise
+	Bucket  string // Bucket, or container of az locations
+	Prefix  string // Prefix of the objects, without leading or trailing slash, empty for the whole bucket
+}
+
+// Loader downloads the objects of a remote location.
+type Loader interface {
+	// Download copies the objects under the prefix of the location to the directory, at their path relative
+	// to the prefix.
+	Download(ctx context.Context, location *Location, dir string) error
+}
+
+var (
+	loadersMutex sync.RWMutex
+	loaders      = map[string]Loader{
+		"s3": &S3Loader{},
+		"gs": &GCSLoader{},
+		"az": &AzureLoader{},
+	}
+)
+
+// RegisterLoader sets the loader of the locations of the URL scheme, e.g. to download s3:// locations from an
+// S3 compatible storage or to support another scheme.
+func RegisterLoader(scheme string, loader Loader) {
+	loadersMutex.Lock()
+	defer loadersMutex.Unlock()
+
+	loaders[scheme] = loader
+}
+
+func getLoader(scheme string) (Loader, bool) {
+	loadersMutex.RLock()
+	defer loadersMutex.RUnlock()
+
+	loader, ok := loaders[scheme]
+	return loader, ok
+}
+
+// IsBucketURL reports whether the location is the URL of a bucket rather than a directory.
+func IsBucketURL(location string) bool {
+	return strings.Contains(location, "://")
+}
+
+// ParseLocation parses the URL of a remote location of a registered scheme.
+func ParseLocation(url string) (*Location, error) {
+	scheme, path, found := strings.Cut(url, "://")
+	path = strings.Trim(path, "/")
+
+	if _, ok := getLoader(scheme); !found || !ok || path == "" {
+		return nil, fmt.Errorf("unsupported location %q, expected an s3://, gs:// or az:// URL", url)
+	}
+
+	location := &Location{Scheme: scheme}
+	if scheme == "az" {
+		location.Account, path, _ = strings.Cut(path, "/")
+		if location.Account == "" || path == "" {
+			return nil, fmt.Errorf("invalid location %q, expected az://account/container/prefix", url)
+		}
+	}
+
+	location.Bucket, location.Prefix, _ = strings.Cut(path, "/")
+	return location, nil
+}
+
+// Fetch replaces the bucket URLs of the migration locations by local copies of their objects, downloaded by the
+// loader of their scheme. The copies are temporary directories removed by the returned cleanup function, which
+// the caller must call once done with the migrations. The settings keyed by location follow their copies.
+//
+// The copies must have a manifest signed by the remote key of the configuration, listing every file with its
+// checksum, so files added or changed in the bucket are refused before anything is executed.
+func Fetch(ctx context.Context, logger *zap.Logger, config *conf.MigrationConfig) (func(), error) {
+	dirs := make([]string, 0)
+	cleanup := func() {
+		for _, dir := range dirs {
+			os.RemoveAll(dir)
+		}
+	}
+
+	var key ed25519.PublicKey
+	for i, url := range config.Locations {
+		if !IsBucketURL(url) {
+			continue
+		}
+
+		location, err := ParseLocation(url)
+		if err != nil {
+			cleanup()
+			return nil, err
+		}
+
+		if key == nil {
+			key, err = ReadKey(config.RemoteKey)
+			if err != nil {
+				cleanup()
+				return nil, err
+			}
+		}
+
+		dir, err := os.MkdirTemp("", "maestro-location-")
+		if err != nil {
+			cleanup()
+			return nil, err
+		}
+		dirs = append(dirs, dir)
+
+		loader, _ := getLoader(location.Scheme)
+		err = loader.Download(ctx, location, dir)
+		if err == nil {
+			err = VerifyManifest(dir, key)
+		}
+		if err != nil {
+			cleanup()
+			return nil, fmt.Errorf("%s: %w", url, err)
+		}
+
+		logger.Info("Downloaded remote migration location", zap.String("location", url))
+
+		renameLocationKey(config.VersionRanges, url, dir)
+		renameLocationKey(config.LocationDependencies, url, dir)
+		renameLocationKey(config.Owners.Locations, url, dir)
+		for _, dependencies := range config.LocationDependencies {
+			renameLocationKey(dependencies, url, dir)
+		}
+
+		config.Locations[i] = dir
+	}
+
+	return cleanup, nil
+}
+
+// renameLocationKey moves the value of the location in the map of settings keyed by location to its local copy.
+func renameLocationKey[V any](settings map[string]V, location string, local string) {
+	for key, value := range settings {
+		if filepath.Clean(key) == filepath.Clean(location) {
+			delete(settings, key)
+			settings[local] = value
+		}
+	}
+}
+
+// ReadKey reads the PEM Ed25519 public key of the file, verifying the manifests of the remote locations.
+func ReadKey(file string) (ed25519.PublicKey, error) {
+	if file == "" {
+		return nil, errors.New("remote locations need the remote-key setting, the public key verifying their " +
+			"signed manifest")
+	}
+
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read remote key: %w", err)
+	}
+
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return nil, fmt.Errorf("invalid remote key %s: no PEM block", file)
+	}
+
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid remote key %s: %w", file, err)
+	}
+
+	key, ok := parsed.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("invalid remote key %s: %T, expected an Ed25519 public key", file, parsed)
+	}
+
+	return key, nil
+}
+
+// objectsPrefix returns the prefix of the names of the objects of the location, ending with a slash so
+// s3://bucket/auth does not match the objects of s3://bucket/authz.
+func objectsPrefix(location *Location) string {
+	if location.Prefix == "" {
+		return ""
+	}
+	return location.Prefix + "/"
+}
+
+// isFolderObject reports whether the object is the empty object some consoles create for folders.
+func isFolderObject(name string) bool {
+	return strings.HasSuffix(name, "/")
+}
+
+// writeObject writes the content of the object to its path in the directory. Paths out of the directory are
+// refused, they can not be listed by the manifest.
+func writeObject(dir string, name string, content io.Reader) error {
+	if !filepath.IsLocal(filepath.FromSlash(name)) {
+		return fmt.Errorf("invalid object path %q", name)
+	}
+
+	file := filepath.Join(dir, filepath.FromSlash(name))
+	err := os.MkdirAll(filepath.Dir(file), os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	out, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, content)
+	if err != nil {
+		return fmt.Errorf("failed to download %s: %w", name, err)
+	}
+
+	return out.Close()
+}
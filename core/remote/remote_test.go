@@ -0,0 +1,268 @@
+package remote
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/maestro-go/maestro/core/conf"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// dirLoader copies the objects of the buckets from the directories of its root, e.g. s3://bucket/prefix from
+// <root>/bucket/prefix and az://account/container/prefix from <root>/account/container/prefix.
+type dirLoader struct {
+	root string
+}
+
+func (l *dirLoader) Download(ctx context.Context, location *Location, dir string) error {
+	source := filepath.Join(l.root, location.Account, location.Bucket, filepath.FromSlash(location.Prefix))
+	return filepath.WalkDir(source, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+
+		name, err := filepath.Rel(source, file)
+		if err != nil {
+			return err
+		}
+
+		content, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer content.Close()
+
+		return writeObject(dir, filepath.ToSlash(name), content)
+	})
+}
+
+// fakeLoaders registers a dirLoader for the s3, gs and az schemes until the end of the test, and returns its root.
+func fakeLoaders(t *testing.T) string {
+	root := t.TempDir()
+
+	loadersMutex.Lock()
+	previous := loaders
+	loaders = map[string]Loader{"s3": &dirLoader{root}, "gs": &dirLoader{root}, "az": &dirLoader{root}}
+	loadersMutex.Unlock()
+
+	t.Cleanup(func() {
+		loadersMutex.Lock()
+		loaders = previous
+		loadersMutex.Unlock()
+	})
+
+	return root
+}
+
+// newRemoteKey writes the public key of a new Ed25519 key pair to a PEM file, and returns the file and the
+// private key.
+func newRemoteKey(t *testing.T) (string, ed25519.PrivateKey) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	der, err := x509.MarshalPKIXPublicKey(public)
+	require.NoError(t, err)
+
+	file := filepath.Join(t.TempDir(), "remote.pub")
+	err = os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0644)
+	require.NoError(t, err)
+
+	return file, private
+}
+
+// writeRemoteLocation writes the files to the directory, with their manifest signed by the key.
+func writeRemoteLocation(t *testing.T, dir string, key ed25519.PrivateKey, files map[string]string) {
+	manifest := ""
+	for name, content := range files {
+		err := os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), os.ModePerm)
+		require.NoError(t, err)
+		err = os.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+		require.NoError(t, err)
+
+		sum := sha256.Sum256([]byte(content))
+		manifest += hex.EncodeToString(sum[:]) + "  ./" + name + "\n"
+	}
+
+	err := os.WriteFile(filepath.Join(dir, manifest_file), []byte(manifest), 0644)
+	require.NoError(t, err)
+	err = os.WriteFile(filepath.Join(dir, signature_file), ed25519.Sign(key, []byte(manifest)), 0644)
+	require.NoError(t, err)
+}
+
+func TestFetch(t *testing.T) {
+	root := fakeLoaders(t)
+	keyFile, key := newRemoteKey(t)
+
+	for _, dir := range []string{"bucket/auth", "bucket/billing", "account/container/shared"} {
+		writeRemoteLocation(t, filepath.Join(root, dir), key, map[string]string{"V001_init.sql": "-- " + dir})
+	}
+
+	local := t.TempDir()
+	config := &conf.MigrationConfig{
+		Locations:     []string{local, "s3://bucket/auth/", "gs://bucket/billing", "az://account/container/shared"},
+		VersionRanges: map[string]string{"s3://bucket/auth": "1-99"},
+		Owners:        conf.OwnersConfig{Locations: map[string]string{"gs://bucket/billing": "@acme/billing"}},
+		RemoteKey:     keyFile,
+	}
+
+	cleanup, err := Fetch(context.Background(), zap.NewNop(), config)
+	require.NoError(t, err)
+
+	// Local locations are kept
+	assert.Equal(t, local, config.Locations[0])
+
+	for i, dir := range []string{"bucket/auth", "bucket/billing", "account/container/shared"} {
+		location := config.Locations[i+1]
+		assert.False(t, IsBucketURL(location))
+
+		content, err := os.ReadFile(filepath.Join(location, "V001_init.sql"))
+		require.NoError(t, err)
+		assert.Equal(t, "-- "+dir, string(content))
+	}
+
+	// The settings of the locations follow their copies
+	assert.Equal(t, map[string]string{config.Locations[1]: "1-99"}, config.VersionRanges)
+	assert.Equal(t, map[string]string{config.Locations[2]: "@acme/billing"}, config.Owners.Locations)
+
+	// The copies are removed by the cleanup function
+	cleanup()
+	for _, location := range config.Locations[1:] {
+		assert.NoDirExists(t, location)
+	}
+}
+
+func TestFetchErrors(t *testing.T) {
+	fakeLoaders(t)
+	keyFile, _ := newRemoteKey(t)
+
+	for location, message := range map[string]string{
+		"ftp://bucket/prefix": "unsupported location",
+		"s3://":               "unsupported location",
+		"az://account":        "expected az://account/container/prefix",
+		"s3://missing/prefix": "no such file or directory",
+	} {
+		config := &conf.MigrationConfig{Locations: []string{location}, RemoteKey: keyFile}
+		_, err := Fetch(context.Background(), zap.NewNop(), config)
+		assert.ErrorContains(t, err, message, location)
+	}
+
+	// Remote locations are refused without a key to verify them
+	config := &conf.MigrationConfig{Locations: []string{"s3://bucket/prefix"}}
+	_, err := Fetch(context.Background(), zap.NewNop(), config)
+	assert.ErrorContains(t, err, "need the remote-key setting")
+}
+
+func TestParseLocation(t *testing.T) {
+	for url, expected := range map[string]*Location{
+		"s3://bucket":                        {Scheme: "s3", Bucket: "bucket"},
+		"s3://bucket/auth/":                  {Scheme: "s3", Bucket: "bucket", Prefix: "auth"},
+		"gs://bucket/billing/2024":           {Scheme: "gs", Bucket: "bucket", Prefix: "billing/2024"},
+		"az://account/container":             {Scheme: "az", Account: "account", Bucket: "container"},
+		"az://account/container/shared/sql/": {Scheme: "az", Account: "account", Bucket: "container", Prefix: "shared/sql"},
+	} {
+		location, err := ParseLocation(url)
+		assert.NoError(t, err, url)
+		assert.Equal(t, expected, location, url)
+	}
+
+	_, err := ParseLocation("ftp://bucket/prefix")
+	assert.ErrorContains(t, err, "unsupported location")
+
+	_, err = ParseLocation("az://account/")
+	assert.ErrorContains(t, err, "expected az://account/container/prefix")
+}
+
+func TestWriteObject(t *testing.T) {
+	dir := t.TempDir()
+
+	err := writeObject(dir, "sql/V001_init.sql", strings.NewReader("SELECT 1;"))
+	require.NoError(t, err)
+	assert.FileExists(t, filepath.Join(dir, "sql", "V001_init.sql"))
+
+	// Objects out of the directory are refused
+	err = writeObject(dir, "../V001_init.sql", strings.NewReader("SELECT 1;"))
+	assert.EqualError(t, err, `invalid object path "../V001_init.sql"`)
+}
+
+func TestVerifyManifest(t *testing.T) {
+	_, key := newRemoteKey(t)
+	files := map[string]string{"V001_init.sql": "SELECT 1;", "data/countries.csv": "fr,France"}
+
+	verify := func(change func(dir string)) error {
+		dir := t.TempDir()
+		writeRemoteLocation(t, dir, key, files)
+		change(dir)
+		return VerifyManifest(dir, key.Public().(ed25519.PublicKey))
+	}
+
+	err := verify(func(dir string) {})
+	assert.NoError(t, err)
+
+	// Signatures in base64 are accepted
+	err = verify(func(dir string) {
+		signature, _ := os.ReadFile(filepath.Join(dir, signature_file))
+		os.WriteFile(filepath.Join(dir, signature_file), []byte(base64.StdEncoding.EncodeToString(signature)+"\n"), 0644)
+	})
+	assert.NoError(t, err)
+
+	err = verify(func(dir string) {
+		os.WriteFile(filepath.Join(dir, "V002_inject.sql"), []byte("DROP TABLE users;"), 0644)
+	})
+	assert.EqualError(t, err, "V002_inject.sql is not listed in maestro.sha256")
+
+	err = verify(func(dir string) {
+		os.WriteFile(filepath.Join(dir, "data/countries.csv"), []byte("fr,France\nxx,Injected"), 0644)
+	})
+	assert.EqualError(t, err, "data/countries.csv does not match its checksum in maestro.sha256")
+
+	err = verify(func(dir string) {
+		os.Remove(filepath.Join(dir, "V001_init.sql"))
+	})
+	assert.EqualError(t, err, "V001_init.sql is listed in maestro.sha256 but missing")
+
+	// The manifest can not be changed without its signature
+	err = verify(func(dir string) {
+		os.WriteFile(filepath.Join(dir, manifest_file), []byte(""), 0644)
+	})
+	assert.EqualError(t, err, "maestro.sha256 is not signed by the remote key")
+
+	// Manifests signed by other keys are refused
+	_, otherKey := newRemoteKey(t)
+	err = verify(func(dir string) {
+		manifest, _ := os.ReadFile(filepath.Join(dir, manifest_file))
+		os.WriteFile(filepath.Join(dir, signature_file), ed25519.Sign(otherKey, manifest), 0644)
+	})
+	assert.EqualError(t, err, "maestro.sha256 is not signed by the remote key")
+
+	err = verify(func(dir string) {
+		os.Remove(filepath.Join(dir, signature_file))
+	})
+	assert.ErrorContains(t, err, "failed to read manifest signature")
+}
+
+func TestParseManifest(t *testing.T) {
+	checksum := "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+	checksums, err := parseManifest([]byte(checksum + "  ./V001_init.sql\n" + checksum + " *data/a.csv\r\n\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"V001_init.sql": checksum, "data/a.csv": checksum}, checksums)
+
+	_, err = parseManifest([]byte("1234  V001_init.sql\n"))
+	assert.EqualError(t, err, "maestro.sha256: line 1: invalid checksum")
+
+	_, err = parseManifest([]byte(checksum + "  ../V001_init.sql\n"))
+	assert.EqualError(t, err, `maestro.sha256: line 1: invalid path "../V001_init.sql"`)
+}
@@ -0,0 +1,58 @@
+package remote
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// S3Loader downloads the s3:// locations with the AWS SDK, authenticated by its default credential chain:
+// environment variables, shared configuration and credentials files, or the role of the container or instance.
+type S3Loader struct {
+	// Options of the client, e.g. the endpoint of an S3 compatible storage
+	Options []func(*s3.Options)
+}
+
+func (l *S3Loader) Download(ctx context.Context, location *Location, dir string) error {
+	awsConfig, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load AWS configuration: %w", err)
+	}
+
+	client := s3.NewFromConfig(awsConfig, l.Options...)
+	prefix := objectsPrefix(location)
+
+	paginator := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(location.Bucket),
+		Prefix: aws.String(prefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list objects: %w", err)
+		}
+
+		for _, object := range page.Contents {
+			key := aws.ToString(object.Key)
+			if isFolderObject(key) {
+				continue
+			}
+
+			output, err := client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(location.Bucket), Key: object.Key})
+			if err != nil {
+				return fmt.Errorf("failed to download %s: %w", key, err)
+			}
+
+			err = writeObject(dir, key[len(prefix):], output.Body)
+			output.Body.Close()
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
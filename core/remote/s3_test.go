@@ -0,0 +1,91 @@
+package remote
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeS3 serves the ListObjectsV2 and GetObject requests of the objects of a bucket, in path style.
+func fakeS3(t *testing.T, bucket string, objects map[string]string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := strings.TrimPrefix(r.URL.Path, "/"+bucket)
+		key = strings.TrimPrefix(key, "/")
+
+		if key == "" && r.URL.Query().Get("list-type") == "2" {
+			prefix := r.URL.Query().Get("prefix")
+			contents := ""
+			for name, content := range objects {
+				if strings.HasPrefix(name, prefix) {
+					contents += fmt.Sprintf("<Contents><Key>%s</Key><Size>%d</Size></Contents>", name, len(content))
+				}
+			}
+			fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?><ListBucketResult><Name>%s</Name>`+
+				`<Prefix>%s</Prefix><IsTruncated>false</IsTruncated>%s</ListBucketResult>`, bucket, prefix, contents)
+			return
+		}
+
+		content, ok := objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?><Error><Code>NoSuchKey</Code></Error>`)
+			return
+		}
+		fmt.Fprint(w, content)
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestS3LoaderDownload(t *testing.T) {
+	// Static credentials of the default chain, isolated from the files of the environment
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(t.TempDir(), "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(t.TempDir(), "credentials"))
+
+	server := fakeS3(t, "bucket", map[string]string{
+		"auth/V001_init.sql":      "SELECT 1;",
+		"auth/data/countries.csv": "fr,France",
+		"auth/":                   "",
+		"authz/V001_init.sql":     "SELECT 2;",
+	})
+
+	loader := &S3Loader{Options: []func(*s3.Options){func(options *s3.Options) {
+		options.BaseEndpoint = aws.String(server.URL)
+		options.UsePathStyle = true
+	}}}
+
+	dir := t.TempDir()
+	err := loader.Download(context.Background(), &Location{Scheme: "s3", Bucket: "bucket", Prefix: "auth"}, dir)
+	require.NoError(t, err)
+
+	// The objects are written at their path relative to the prefix, without the folder objects and the objects of
+	// other prefixes starting the same
+	content, err := os.ReadFile(filepath.Join(dir, "V001_init.sql"))
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT 1;", string(content))
+
+	content, err = os.ReadFile(filepath.Join(dir, "data", "countries.csv"))
+	require.NoError(t, err)
+	assert.Equal(t, "fr,France", string(content))
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+
+	err = loader.Download(context.Background(), &Location{Scheme: "s3", Bucket: "missing"}, t.TempDir())
+	assert.ErrorContains(t, err, "failed to")
+}
@@ -0,0 +1,162 @@
+package seeder
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/maestro-go/maestro/core/conf"
+	"github.com/maestro-go/maestro/core/database"
+	"github.com/maestro-go/maestro/internal/filesystem"
+	"github.com/maestro-go/maestro/internal/migrations"
+	"go.uber.org/zap"
+)
+
+// Seeder loads seed data files into the database.
+//
+// Seeds are tracked like migrations, but in their own history table. The repository given to the
+// seeder must be created with the seed history table name.
+type Seeder struct {
+	logger *zap.Logger
+
+	repository database.Repository
+
+	config *conf.MigrationConfig
+
+	run database.RunInfo
+}
+
+func NewSeeder(logger *zap.Logger, repository database.Repository, config *conf.MigrationConfig) *Seeder {
+	return &Seeder{
+		logger:     logger,
+		repository: repository,
+		config:     config,
+		run:        database.NewRunInfo(),
+	}
+}
+
+// Seed executes the seeds of the configured locations without a successful execution in the seed history table.
+// Seeds restricted to an environment are only executed when it matches the given environment.
+func (s *Seeder) Seed(env string) error {
+	s.repository.SetRunInfo(s.run)
+
+	return s.repository.DoInLock(func() error {
+
+		seeds, errs := filesystem.LoadSeedsFromFiles(s.config.Locations, env, s.config.Driver)
+		if len(errs) > 0 {
+			if s.logger != nil {
+				for _, err := range errs {
+					s.logger.Error("Error loading seeds", zap.Error(err))
+				}
+			}
+			return errors.Join(errs...)
+		}
+
+		if len(seeds) < 1 {
+			if s.logger != nil {
+				s.logger.Warn("No seeds found in the specified directories")
+			}
+			return nil
+		}
+
+		err := s.repository.AssertSchemaHistoryTable()
+		if err != nil {
+			if s.logger != nil {
+				s.logger.Error("Error asserting seed history table", zap.Error(err))
+			}
+			return err
+		}
+
+		if s.config.Validate {
+			failingSeeds, err := s.repository.GetFailingMigrations()
+			if err != nil {
+				return fmt.Errorf("error getting failing seeds: %w", err)
+			}
+
+			if len(failingSeeds) > 0 {
+				errs = make([]error, 0)
+				for _, failingSeed := range failingSeeds {
+					if s.logger != nil {
+						s.logger.Error("Found an unsucceeded seed", zap.Uint16("version", failingSeed.Version))
+					}
+					errs = append(errs, fmt.Errorf("found an unsucceeded seed: %d", failingSeed.Version))
+				}
+				return errors.Join(errs...)
+			}
+		}
+
+		applied, err := s.repository.GetAppliedMigrations()
+		if err != nil {
+			return fmt.Errorf("error getting applied seeds: %w", err)
+		}
+
+		// Seeds of an environment may be numbered below the ones already executed in another environment
+		pending := pendingSeeds(seeds, applied)
+		if len(pending) < 1 {
+			if s.logger != nil {
+				s.logger.Info("Seeds are up to date", zap.Uint16("version", database.LatestAppliedVersion(applied)))
+			}
+			return nil
+		}
+
+		seed := func() error {
+			errs := s.executeSeeds(pending)
+			if len(errs) > 0 {
+				if s.logger != nil {
+					for _, err := range errs {
+						s.logger.Error("Error executing seed", zap.Error(err))
+					}
+				}
+				return errors.Join(errs...)
+			}
+			return nil
+		}
+
+		if s.config.InTransaction {
+			return s.repository.DoInTransaction(seed)
+		}
+
+		return seed()
+	})
+}
+
+// pendingSeeds returns the seeds without a successful execution in the seed history table, in order.
+func pendingSeeds(seeds []*migrations.Migration, applied []*database.AppliedMigration) []*migrations.Migration {
+	succeeded := make(map[uint16]bool, len(applied))
+	for _, seed := range applied {
+		if seed.Success {
+			succeeded[seed.Version] = true
+		}
+	}
+
+	pending := make([]*migrations.Migration, 0, len(seeds))
+	for _, seed := range seeds {
+		if !succeeded[seed.Version] {
+			pending = append(pending, seed)
+		}
+	}
+
+	return pending
+}
+
+func (s *Seeder) executeSeeds(seeds []*migrations.Migration) []error {
+	errs := make([]error, 0)
+
+	for _, seed := range seeds {
+		if s.logger != nil {
+			s.logger.Info("Seeding", zap.Uint16("version", seed.Version),
+				zap.String("description", seed.Description))
+		}
+		sErrs := s.repository.ExecuteMigration(seed)
+		if len(sErrs) > 0 {
+			errs = append(errs, sErrs...)
+			if !s.config.Force {
+				return errs
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
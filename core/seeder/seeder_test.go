@@ -0,0 +1,153 @@
+package seeder
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/lib/pq"
+	"github.com/maestro-go/maestro/core/conf"
+	"github.com/maestro-go/maestro/core/database"
+	"github.com/maestro-go/maestro/core/database/postgres"
+	testUtils "github.com/maestro-go/maestro/internal/utils/testing"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+)
+
+type SeederTestSuite struct {
+	suite.Suite
+	postgres *testUtils.PostgresContainer
+	suiteDb  *sql.DB
+
+	ctx context.Context
+
+	repository database.Repository
+}
+
+func (s *SeederTestSuite) SetupSuite() {
+	s.ctx = context.Background()
+
+	s.postgres = testUtils.SetupPostgres(s.T())
+
+	db, err := sql.Open("postgres", s.postgres.URI)
+	s.Assert().NoError(err)
+
+	s.suiteDb = db
+
+	s.repository = postgres.NewPostgresRepository(s.ctx, db, testUtils.ToPtr("seed_history"))
+}
+
+func (s *SeederTestSuite) TearDownTest() {
+	_, err := s.suiteDb.Exec(`
+		DO $$ DECLARE
+			r RECORD;
+		BEGIN
+			FOR r IN (SELECT tablename FROM pg_tables WHERE schemaname = 'public') LOOP
+				EXECUTE 'DROP TABLE IF EXISTS ' || quote_ident(r.tablename) || ' CASCADE';
+			END LOOP;
+		END $$;
+	`)
+	s.Require().NoError(err)
+}
+
+func (s *SeederTestSuite) TearDownSuite() {
+	if s.suiteDb != nil {
+		s.suiteDb.Close()
+	}
+}
+
+func TestSeederSuite(t *testing.T) {
+	suite.Run(t, new(SeederTestSuite))
+}
+
+func (s *SeederTestSuite) checkTableRecordsCount(table string, count int) {
+	s.T().Helper()
+
+	var actualCount int
+	err := s.suiteDb.QueryRowContext(s.ctx, fmt.Sprintf("SELECT COUNT(*) FROM %s;", table)).Scan(&actualCount)
+	s.Assert().NoError(err)
+	s.Assert().Equal(count, actualCount)
+}
+
+func (s *SeederTestSuite) insertSeed(dir string, fileName string, content string) {
+	s.T().Helper()
+
+	err := os.WriteFile(filepath.Join(dir, fileName), []byte(content), os.ModePerm)
+	s.Require().NoError(err)
+}
+
+func (s *SeederTestSuite) TestSeed() {
+	seedsDir := s.T().TempDir()
+
+	_, err := s.suiteDb.Exec("CREATE TABLE countries (name VARCHAR(255));")
+	s.Require().NoError(err)
+
+	s.insertSeed(seedsDir, "S001_countries.sql", "INSERT INTO countries (name) VALUES ('Brazil');")
+	s.insertSeed(seedsDir, "S002_countries.dev.sql", "INSERT INTO countries (name) VALUES ('Devland');")
+	s.insertSeed(seedsDir, "S003_countries.prod.sql", "INSERT INTO countries (name) VALUES ('Prodland');")
+
+	seeder := NewSeeder(zap.NewNop(), s.repository, &conf.MigrationConfig{
+		Locations:     []string{seedsDir},
+		Validate:      true,
+		InTransaction: true,
+	})
+
+	err = seeder.Seed("dev")
+	s.Assert().NoError(err)
+
+	s.checkTableRecordsCount("countries", 2)
+	s.checkTableRecordsCount("seed_history", 2)
+
+	// Running again must not execute the seeds twice
+	err = seeder.Seed("dev")
+	s.Assert().NoError(err)
+
+	s.checkTableRecordsCount("countries", 2)
+}
+
+func (s *SeederTestSuite) TestSeedEnvBelowLatest() {
+	seedsDir := s.T().TempDir()
+
+	_, err := s.suiteDb.Exec("CREATE TABLE countries (name VARCHAR(255));")
+	s.Require().NoError(err)
+
+	s.insertSeed(seedsDir, "S001_countries.sql", "INSERT INTO countries (name) VALUES ('Brazil');")
+	s.insertSeed(seedsDir, "S002_countries.dev.sql", "INSERT INTO countries (name) VALUES ('Devland');")
+	s.insertSeed(seedsDir, "S003_countries.sql", "INSERT INTO countries (name) VALUES ('Chile');")
+
+	seeder := NewSeeder(zap.NewNop(), s.repository, &conf.MigrationConfig{
+		Locations:     []string{seedsDir},
+		Validate:      true,
+		InTransaction: true,
+	})
+
+	err = seeder.Seed("prod")
+	s.Assert().NoError(err)
+
+	s.checkTableRecordsCount("countries", 2)
+
+	// The dev seed is numbered below the latest executed seed, it is executed all the same
+	err = seeder.Seed("dev")
+	s.Assert().NoError(err)
+
+	s.checkTableRecordsCount("countries", 3)
+	s.checkTableRecordsCount("seed_history", 3)
+}
+
+func (s *SeederTestSuite) TestSeedWithErrors() {
+	seedsDir := s.T().TempDir()
+
+	s.insertSeed(seedsDir, "S001_invalid.sql", "INVALID SQL")
+
+	seeder := NewSeeder(zap.NewNop(), s.repository, &conf.MigrationConfig{
+		Locations:     []string{seedsDir},
+		Validate:      true,
+		InTransaction: true,
+	})
+
+	err := seeder.Seed("")
+	s.Assert().Error(err)
+}
@@ -0,0 +1,92 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/maestro-go/maestro/core/enums"
+	"github.com/maestro-go/maestro/internal/cli/conn"
+	"github.com/maestro-go/maestro/internal/cli/flags"
+	"github.com/maestro-go/maestro/internal/utils/logger"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+func SetupAnnotateCommand() *cobra.Command {
+	annotateCmd := &cobra.Command{
+		Use:   "annotate",
+		Short: "Write a note on a migration of the schema history table",
+		Long: `The annotate command writes a note in the notes column of the schema history table for an applied
+migration, so the knowledge about odd entries (e.g. a migration applied manually) lives next to the data.
+The note replaces the previous one, and an empty note clears it. The notes column is added to schema history
+tables created by previous versions of maestro.`,
+		RunE: runAnnotateCommand,
+	}
+
+	annotateCmd.Flags().SortFlags = false
+	annotateCmd.Flags().Uint16("version", 0, "Version of the applied migration to annotate.")
+	annotateCmd.Flags().String("note", "", "Note to write, e.g. \"applied manually by DBA, ticket OPS-123\".")
+	annotateCmd.MarkFlagRequired("version")
+	annotateCmd.MarkFlagRequired("note")
+	flags.SetupDBConfigFlags(annotateCmd)
+
+	return annotateCmd
+}
+
+func runAnnotateCommand(cmd *cobra.Command, args []string) error {
+	logger, err := logger.NewLogger()
+	if err != nil {
+		log.Fatal(err)
+		return err
+	}
+
+	ctx := context.Background()
+
+	version, err := cmd.Flags().GetUint16("version")
+	if err != nil {
+		logError(logger, ErrReadVersionFlag, err)
+		return genError(ErrReadVersionFlag, err)
+	}
+
+	note, err := cmd.Flags().GetString("note")
+	if err != nil {
+		logError(logger, ErrReadNoteFlag, err)
+		return genError(ErrReadNoteFlag, err)
+	}
+
+	projectConfig, removeLocations, err := loadProjectConfig(cmd, logger)
+	if err != nil {
+		return err
+	}
+	defer removeLocations()
+
+	driver, ok := enums.MapStringToDriverType[projectConfig.Driver]
+	if !ok {
+		logError(logger, ErrInvalidDriver, errors.New(projectConfig.Driver))
+		return genError(ErrInvalidDriver, errors.New(projectConfig.Driver))
+	}
+
+	repo, cleanup, err := conn.ConnectToDatabase(ctx, projectConfig, driver)
+	if err != nil {
+		logError(logger, ErrConnectToDatabase, err)
+		return genError(ErrConnectToDatabase, err)
+	}
+	defer cleanup()
+
+	err = repo.Annotate(version, note)
+	if err != nil {
+		logError(logger, ErrAnnotate, err)
+		return genError(ErrAnnotate, err)
+	}
+
+	err = syncHistoryTable(logger, repo, projectConfig)
+	if err != nil {
+		logError(logger, ErrSyncHistoryTable, err)
+		return genError(ErrSyncHistoryTable, err)
+	}
+
+	logger.Info("Migration annotated", zap.Uint16("version", version))
+
+	return nil
+}
@@ -0,0 +1,244 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/maestro-go/maestro/core/conf"
+	"github.com/maestro-go/maestro/core/enums"
+	"github.com/maestro-go/maestro/core/migrator"
+)
+
+// backup_time_format is the format of the time in the names of the backup files.
+const backup_time_format = "20060102T150405Z"
+
+// backupExtensions are the extensions of the dumps of the drivers able to back up the database: custom format
+// archives of pg_dump, restored with pg_restore, and SQL scripts of mysqldump.
+var backupExtensions = map[enums.DriverType]string{
+	enums.DRIVER_POSTGRES:  ".dump",
+	enums.DRIVER_GREENPLUM: ".dump",
+	enums.DRIVER_MARIADB:   ".sql",
+}
+
+// backup_manifest_extension is the extension added to the name of a dump for its manifest.
+const backup_manifest_extension = ".json"
+
+// bucketCopyCommands are the commands copying a file to or from the buckets of a URL scheme, given the source
+// and the destination.
+var bucketCopyCommands = map[string][]string{
+	"s3": {"aws", "s3", "cp"},
+	"gs": {"gcloud", "storage", "cp"},
+}
+
+// backupManifest describes a backup, written next to its dump so the restore command can reconcile the schema
+// history table with it.
+type backupManifest struct {
+	Driver        string    `json:"driver"`
+	Database      string    `json:"database"`
+	Schemas       []string  `json:"schemas"`
+	LatestVersion uint16    `json:"latest_version"` // Latest applied version of the backed up database
+	Versions      []uint16  `json:"versions"`       // Destructive migrations the backup was taken before
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// newBackup returns the backup of the migrate command, which dumps the configured schemas with the dump tool
+// of the driver, writes its manifest and uploads both to the configured bucket. It returns nil if no backup is configured.
+func newBackup(ctx context.Context, config *conf.ProjectConfig, driver enums.DriverType) (migrator.BackupFunc, error) {
+	if !config.Backup.Enabled() {
+		return nil, nil
+	}
+
+	extension, ok := backupExtensions[driver]
+	if !ok {
+		return nil, fmt.Errorf("backups are not supported by the %s driver", config.Driver)
+	}
+
+	if config.Backup.Bucket != "" {
+		if _, err := bucketCopyCommand(ctx, config.Backup.Bucket, "", config.Backup.Bucket); err != nil {
+			return nil, err
+		}
+	}
+
+	return func(latest uint16, versions []uint16) (string, error) {
+		dir := config.Backup.Path
+		if dir == "" {
+			// Only uploaded
+			tempDir, err := os.MkdirTemp("", "maestro-backup-")
+			if err != nil {
+				return "", err
+			}
+			defer os.RemoveAll(tempDir)
+			dir = tempDir
+		}
+
+		err := os.MkdirAll(dir, os.ModePerm)
+		if err != nil {
+			return "", err
+		}
+
+		createdAt := time.Now().UTC()
+		name := fmt.Sprintf("%s_%s_V%03d-V%03d%s", config.Database, createdAt.Format(backup_time_format),
+			versions[0], versions[len(versions)-1], extension)
+		file := filepath.Join(dir, name)
+
+		err = runBackupCommand(dumpCommand(ctx, config, driver, file))
+		if err != nil {
+			return "", err
+		}
+
+		err = writeBackupManifest(file+backup_manifest_extension, &backupManifest{
+			Driver:        config.Driver,
+			Database:      config.Database,
+			Schemas:       backupSchemas(config, driver),
+			LatestVersion: latest,
+			Versions:      versions,
+			CreatedAt:     createdAt,
+		})
+		if err != nil {
+			return "", err
+		}
+
+		if config.Backup.Bucket == "" {
+			return file, nil
+		}
+
+		object := strings.TrimSuffix(config.Backup.Bucket, "/") + "/" + name
+		for _, suffix := range []string{"", backup_manifest_extension} {
+			upload, err := bucketCopyCommand(ctx, object, file+suffix, object+suffix)
+			if err != nil {
+				return "", err
+			}
+
+			err = runBackupCommand(upload)
+			if err != nil {
+				return "", err
+			}
+		}
+
+		return object, nil
+	}, nil
+}
+
+// dumpCommand returns the command dumping the configured schemas of the database to the file, with the
+// password in its environment.
+func dumpCommand(ctx context.Context, config *conf.ProjectConfig, driver enums.DriverType, file string) *exec.Cmd {
+	schemas := backupSchemas(config, driver)
+	if driver == enums.DRIVER_MARIADB {
+		args := append(mariadbToolArgs(config), "--single-transaction", "--routines", "--triggers",
+			"--result-file="+file)
+		args = append(append(args, "--databases"), schemas...)
+
+		cmd := exec.CommandContext(ctx, "mysqldump", args...)
+		cmd.Env = append(os.Environ(), "MYSQL_PWD="+config.Password)
+		return cmd
+	}
+
+	args := append([]string{"--format=custom", "--file=" + file}, postgresToolArgs(config)...)
+	for _, schema := range schemas {
+		args = append(args, "--schema="+schema)
+	}
+
+	cmd := exec.CommandContext(ctx, "pg_dump", args...)
+	cmd.Env = postgresToolEnv(config)
+	return cmd
+}
+
+// postgresToolArgs returns the connection arguments of the PostgreSQL client tools.
+func postgresToolArgs(config *conf.ProjectConfig) []string {
+	return []string{"--host=" + config.Host, "--port=" + strconv.Itoa(int(config.Port)),
+		"--username=" + config.User, "--dbname=" + config.Database, "--no-password"}
+}
+
+// postgresToolEnv returns the environment of the PostgreSQL client tools, with the password and the SSL
+// configuration.
+func postgresToolEnv(config *conf.ProjectConfig) []string {
+	env := append(os.Environ(), "PGPASSWORD="+config.Password, "PGSSLMODE="+config.SSL.SSLMode)
+	if config.SSL.SSLRootCert != "" {
+		env = append(env, "PGSSLROOTCERT="+config.SSL.SSLRootCert)
+	}
+	return env
+}
+
+// mariadbToolArgs returns the connection arguments of the MariaDB client tools, whose password is given by
+// the MYSQL_PWD environment variable.
+func mariadbToolArgs(config *conf.ProjectConfig) []string {
+	args := []string{"--host=" + config.Host, "--port=" + strconv.Itoa(int(config.Port)), "--user=" + config.User}
+	if config.SSL.SSLMode != "disable" {
+		args = append(args, "--ssl")
+		if config.SSL.SSLRootCert != "" {
+			args = append(args, "--ssl-ca="+config.SSL.SSLRootCert)
+		}
+	}
+	return args
+}
+
+// backupSchemas returns the backed up schemas, or MariaDB databases: the configured ones, else the schema or
+// database of the configuration.
+func backupSchemas(config *conf.ProjectConfig, driver enums.DriverType) []string {
+	if len(config.Backup.Schemas) > 0 {
+		return config.Backup.Schemas
+	}
+	if driver == enums.DRIVER_MARIADB {
+		return []string{config.Database}
+	}
+	return []string{config.Schema}
+}
+
+// writeBackupManifest writes the manifest of a backup to the file.
+func writeBackupManifest(path string, manifest *backupManifest) error {
+	content, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, append(content, '\n'), 0644)
+}
+
+// readBackupManifest reads the manifest of a backup from the file.
+func readBackupManifest(path string) (*backupManifest, error) {
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("manifest of the backup %s not found", path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &backupManifest{}
+	err = json.Unmarshal(content, manifest)
+	if err != nil {
+		return nil, fmt.Errorf("invalid backup manifest %s: %w", path, err)
+	}
+
+	return manifest, nil
+}
+
+// bucketCopyCommand returns the command copying the source to the destination, one of them an object of the
+// bucket URL, with the command line tool of its cloud.
+func bucketCopyCommand(ctx context.Context, object string, source string, destination string) (*exec.Cmd, error) {
+	scheme, _, found := strings.Cut(object, "://")
+	command, ok := bucketCopyCommands[scheme]
+	if !found || !ok {
+		return nil, fmt.Errorf("unsupported backup bucket %q, expected an s3:// or gs:// URL", object)
+	}
+
+	args := append(append([]string{}, command[1:]...), source, destination)
+	return exec.CommandContext(ctx, command[0], args...), nil
+}
+
+// runBackupCommand runs the command, returning its output in the error if it fails.
+func runBackupCommand(cmd *exec.Cmd) error {
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s: %w: %s", cmd.Args[0], err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/maestro-go/maestro/core/enums"
+	"github.com/maestro-go/maestro/core/migrator"
+	"github.com/maestro-go/maestro/internal/cli/conn"
+	"github.com/maestro-go/maestro/internal/cli/flags"
+	"github.com/maestro-go/maestro/internal/utils/logger"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+func SetupBaselineCommand() *cobra.Command {
+	baselineCmd := &cobra.Command{
+		Use:   "baseline",
+		Short: "Record the migrations up to a version as applied without executing them",
+		Long: `The baseline command records the local migrations up to --version in the schema history table as applied,
+without executing them, to adopt maestro on an existing database whose schema already matches this version.
+The next migrate run applies the migrations after it.
+
+The command refuses databases whose schema history table already records migrations: use --skip-versions of
+migrate to skip single versions of a database migrated by maestro.`,
+		RunE: runBaselineCommand,
+	}
+
+	baselineCmd.Flags().SortFlags = false
+	baselineCmd.Flags().Uint16("version", 0, "Latest version of the migrations already applied to the database.")
+	baselineCmd.MarkFlagRequired("version")
+	flags.SetupDBConfigFlags(baselineCmd)
+
+	return baselineCmd
+}
+
+func runBaselineCommand(cmd *cobra.Command, args []string) error {
+	logger, err := logger.NewLogger()
+	if err != nil {
+		log.Fatal(err)
+		return err
+	}
+
+	ctx := context.Background()
+
+	version, err := cmd.Flags().GetUint16("version")
+	if err != nil {
+		logError(logger, ErrReadVersionFlag, err)
+		return genError(ErrReadVersionFlag, err)
+	}
+
+	projectConfig, removeLocations, err := loadProjectConfig(cmd, logger)
+	if err != nil {
+		return err
+	}
+	defer removeLocations()
+
+	driver, ok := enums.MapStringToDriverType[projectConfig.Driver]
+	if !ok {
+		logError(logger, ErrInvalidDriver, errors.New(projectConfig.Driver))
+		return genError(ErrInvalidDriver, errors.New(projectConfig.Driver))
+	}
+
+	repo, cleanup, err := conn.ConnectToDatabase(ctx, projectConfig, driver)
+	if err != nil {
+		logError(logger, ErrConnectToDatabase, err)
+		return genError(ErrConnectToDatabase, err)
+	}
+	defer cleanup()
+
+	migrator := migrator.NewMigrator(logger, repo, &projectConfig.Migration)
+	migrator.SetHistorySync(historySyncTable(logger, projectConfig))
+	logger = logger.With(zap.String("run_id", migrator.RunID()))
+	baselined, err := migrator.Baseline(version)
+	if err != nil {
+		logError(logger, ErrBaseline, err)
+		return genError(ErrBaseline, err)
+	}
+
+	logger.Info("Database baselined", zap.Uint16("version", baselined[len(baselined)-1]),
+		zap.Int("migrations", len(baselined)))
+
+	return nil
+}
@@ -0,0 +1,84 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/maestro-go/maestro/core/enums"
+	"github.com/maestro-go/maestro/internal/filesystem"
+	"github.com/maestro-go/maestro/internal/migrations"
+	"github.com/maestro-go/maestro/internal/utils/logger"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+func SetupChecksumCommand() *cobra.Command {
+	checksumCmd := &cobra.Command{
+		Use:   "checksum",
+		Short: "Print the checksums of local migrations",
+		Long: `The checksum command prints the checksums of the local migrations, computed like when they are applied
+(after templates and directives are expanded), to compare them with the schema history table when debugging
+a checksum mismatch. The database is not accessed.`,
+		RunE: runChecksumCommand,
+	}
+
+	checksumCmd.Flags().Uint16("version", 0, "Version of the migration to print the checksum of.")
+	checksumCmd.Flags().Bool("all", false, "Print the checksums of every migration (default).")
+	checksumCmd.MarkFlagsMutuallyExclusive("version", "all")
+
+	return checksumCmd
+}
+
+func runChecksumCommand(cmd *cobra.Command, args []string) error {
+	logger, err := logger.NewLogger()
+	if err != nil {
+		log.Fatal(err)
+		return err
+	}
+
+	var version *uint16
+	if cmd.Flags().Changed("version") {
+		v, err := cmd.Flags().GetUint16("version")
+		if err != nil {
+			logError(logger, ErrReadVersionFlag, err)
+			return genError(ErrReadVersionFlag, err)
+		}
+		version = &v
+	}
+
+	projectConfig, removeLocations, err := loadProjectConfig(cmd, logger)
+	if err != nil {
+		return err
+	}
+	defer removeLocations()
+
+	migrationsMap, _, errs := filesystem.LoadObjectsFromFiles(&projectConfig.Migration)
+	if len(errs) > 0 {
+		logErrors(logger, ErrLoadMigrations, errs)
+		return errors.Join(errs...)
+	}
+
+	found := false
+	for _, migration := range migrationsMap[enums.MIGRATION_UP] {
+		if version != nil && migration.Version != *version {
+			continue
+		}
+		found = true
+
+		logChecksum(logger, migration)
+	}
+
+	if version != nil && !found {
+		err = fmt.Errorf("version %d", *version)
+		logError(logger, ErrMigrationNotFound, err)
+		return genError(ErrMigrationNotFound, err)
+	}
+
+	return nil
+}
+
+func logChecksum(logger *zap.Logger, migration *migrations.Migration) {
+	logger.Info("Checksum", zap.Uint16("version", migration.Version), zap.String("description", migration.Description),
+		zap.String("md5_checksum", *migration.Checksum))
+}
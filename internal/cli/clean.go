@@ -0,0 +1,88 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	_ "github.com/lib/pq"
+	"github.com/maestro-go/maestro/core/enums"
+	"github.com/maestro-go/maestro/core/migrator"
+	"github.com/maestro-go/maestro/internal/cli/conn"
+	"github.com/maestro-go/maestro/internal/cli/flags"
+	"github.com/maestro-go/maestro/internal/utils/logger"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+func SetupCleanCommand() *cobra.Command {
+	cleanCmd := &cobra.Command{
+		Use:   "clean",
+		Short: "Drop all objects in the schema",
+		Long: `The clean command drops every table, view, sequence, routine and type of the current schema, including the schema history table.
+
+The command asks for confirmation unless --yes is given, and refuses to run against protected databases ("protected: true").`,
+		RunE: runCleanCommand,
+	}
+
+	cleanCmd.Flags().SortFlags = false
+	cleanCmd.Flags().BoolP("yes", "y", false, "Skip the confirmation prompt.")
+	flags.SetupDBConfigFlags(cleanCmd)
+
+	return cleanCmd
+}
+
+func runCleanCommand(cmd *cobra.Command, args []string) error {
+	logger, err := logger.NewLogger()
+	if err != nil {
+		log.Fatal(err)
+		return err
+	}
+
+	ctx := context.Background()
+
+	projectConfig, removeLocations, err := loadProjectConfig(cmd, logger)
+	if err != nil {
+		return err
+	}
+	defer removeLocations()
+
+	err = checkNotProtected(projectConfig, "clean")
+	if err != nil {
+		logError(logger, ErrProtectedDatabase, err)
+		return genError(ErrProtectedDatabase, err)
+	}
+
+	err = confirmAction(cmd, fmt.Sprintf("This will drop all objects in the schema of database %s.",
+		projectConfig.Database))
+	if err != nil {
+		logError(logger, ErrConfirmation, err)
+		return genError(ErrConfirmation, err)
+	}
+
+	driver, ok := enums.MapStringToDriverType[projectConfig.Driver]
+	if !ok {
+		logError(logger, ErrInvalidDriver, errors.New(projectConfig.Driver))
+		return genError(ErrInvalidDriver, errors.New(projectConfig.Driver))
+	}
+
+	repo, cleanup, err := conn.ConnectToDatabase(ctx, projectConfig, driver)
+	if err != nil {
+		logError(logger, ErrConnectToDatabase, err)
+		return genError(ErrConnectToDatabase, err)
+	}
+	defer cleanup()
+
+	migrator := migrator.NewMigrator(logger, repo, &projectConfig.Migration)
+	logger = logger.With(zap.String("run_id", migrator.RunID()))
+	err = migrator.Clean()
+	if err != nil {
+		logError(logger, ErrClean, err)
+		return genError(ErrClean, err)
+	}
+
+	logger.Info("Database cleaned successfully")
+
+	return nil
+}
@@ -1,12 +1,15 @@
 package cli
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/creasty/defaults"
@@ -15,6 +18,7 @@ import (
 	"github.com/maestro-go/maestro/core/database"
 	"github.com/maestro-go/maestro/core/database/postgres"
 	"github.com/maestro-go/maestro/core/enums"
+	"github.com/maestro-go/maestro/internal/filesystem"
 	testUtils "github.com/maestro-go/maestro/internal/utils/testing"
 	"github.com/stretchr/testify/suite"
 	"gopkg.in/yaml.v3"
@@ -186,6 +190,17 @@ func (s *CliTestSuite) TestEntirePipeline() {
 		s.checkFileExists(migrationsDir, "V002_test2.sql", true)
 	})
 
+	s.Run("test templates list command", func() {
+		err := os.WriteFile(filepath.Join(migrationsDir, "table.template.sql"), []byte("CREATE TABLE $1 ();"), os.ModePerm)
+		s.Require().NoError(err)
+		defer os.Remove(filepath.Join(migrationsDir, "table.template.sql"))
+
+		rootCmd := SetupRootCommand()
+		rootCmd.SetArgs([]string{"templates", "list", "-l", projectDir})
+		err = rootCmd.Execute()
+		s.Require().NoError(err)
+	})
+
 	s.Run("check error with invalid config file", func() {
 		rootCmd := SetupRootCommand()
 		rootCmd.SetArgs([]string{"status", "-l", projectDir, "-m", migrationsDir})
@@ -302,6 +317,18 @@ func (s *CliTestSuite) TestEntirePipeline() {
 		s.Require().NoError(err)
 	})
 
+	s.Run("test status command at a date", func() {
+		rootCmd := SetupRootCommand()
+		rootCmd.SetArgs([]string{"status", "-l", projectDir, "--at", "2024-05-01"})
+		err := rootCmd.Execute()
+		s.Require().NoError(err)
+
+		rootCmd = SetupRootCommand()
+		rootCmd.SetArgs([]string{"status", "-l", projectDir, "--at", "05/01/2024"})
+		err = rootCmd.Execute()
+		s.Require().Error(err)
+	})
+
 	// Reset file
 	s.insertMigration(enums.MIGRATION_UP, migrationsDir, 1, "example", "CREATE TABLE test1 (id SERIAL PRIMARY KEY, name varchar(255))")
 
@@ -366,4 +393,665 @@ func (s *CliTestSuite) TestEntirePipeline() {
 		err := rootCmd.Execute()
 		s.Assert().NoError(err)
 	})
+
+	s.Run("test reset command without confirmation", func() {
+		rootCmd := SetupRootCommand()
+		rootCmd.SetIn(strings.NewReader("n\n"))
+		rootCmd.SetArgs([]string{"reset", "-l", projectDir})
+		err := rootCmd.Execute()
+		s.Assert().Error(err)
+
+		s.checkRecordsInTable("schema_history", 3)
+	})
+
+	s.Run("test reset command", func() {
+		rootCmd := SetupRootCommand()
+		rootCmd.SetArgs([]string{"reset", "-l", projectDir, "--yes"})
+		err := rootCmd.Execute()
+		s.Require().NoError(err)
+
+		s.checkRecordsInTable("schema_history", 3)
+		s.checkTableExists("test3", true)
+	})
+
+	s.Run("test clean command", func() {
+		rootCmd := SetupRootCommand()
+		rootCmd.SetArgs([]string{"clean", "-l", projectDir, "--yes"})
+		err := rootCmd.Execute()
+		s.Require().NoError(err)
+
+		s.checkTableExists("schema_history", false)
+		s.checkTableExists("test3", false)
+	})
+
+	s.Run("test fresh command", func() {
+		rootCmd := SetupRootCommand()
+		rootCmd.SetArgs([]string{"fresh", "-l", projectDir, "--yes"})
+		err := rootCmd.Execute()
+		s.Require().NoError(err)
+
+		s.checkRecordsInTable("schema_history", 3)
+		s.checkTableExists("test3", true)
+	})
+
+	s.Run("test redo command", func() {
+		rootCmd := SetupRootCommand()
+		rootCmd.SetArgs([]string{"redo", "-l", projectDir, "--version", "2"})
+		err := rootCmd.Execute()
+		s.Require().NoError(err)
+
+		s.checkRecordsInTable("schema_history", 3)
+		s.checkTableExists("test3", true)
+	})
+
+	s.Run("test ui command", func() {
+		out := new(strings.Builder)
+
+		rootCmd := SetupRootCommand()
+		rootCmd.SetIn(strings.NewReader("v 3\nb 3\nn\nb 3\ny\nq\n"))
+		rootCmd.SetOut(out)
+		rootCmd.SetArgs([]string{"ui", "-l", projectDir})
+		err := rootCmd.Execute()
+		s.Require().NoError(err)
+
+		s.Assert().Contains(out.String(), "-- Version 3")
+		s.Assert().Contains(out.String(), "Cancelled")
+		s.Assert().Contains(out.String(), "Rolled back to version 2")
+
+		s.checkRecordsInTable("schema_history", 2)
+		s.checkTableExists("test3", false)
+	})
+}
+
+func (s *CliTestSuite) TestDBCreate() {
+	projectDir := s.T().TempDir()
+	database := "maestro_created"
+
+	dbFlags := []string{"-l", projectDir, "--user", s.postgres.Username, "--password", s.postgres.Password,
+		"--port", s.postgres.Port, "--database", database}
+
+	checkDatabaseExists := func(shouldExist bool) {
+		s.T().Helper()
+
+		exists := false
+		err := s.suiteDb.QueryRow("SELECT EXISTS (SELECT 1 FROM pg_database WHERE datname = $1);", database).Scan(&exists)
+		s.Require().NoError(err)
+		s.Assert().Equal(shouldExist, exists)
+	}
+
+	checkDatabaseExists(false)
+
+	rootCmd := SetupRootCommand()
+	rootCmd.SetArgs(append([]string{"db", "create"}, dbFlags...))
+	err := rootCmd.Execute()
+	s.Require().NoError(err)
+
+	checkDatabaseExists(true)
+
+	// Already exists
+	rootCmd = SetupRootCommand()
+	rootCmd.SetArgs(append([]string{"db", "create"}, dbFlags...))
+	err = rootCmd.Execute()
+	s.Require().NoError(err)
+
+	_, err = s.suiteDb.Exec(fmt.Sprintf("DROP DATABASE %s;", database))
+	s.Require().NoError(err)
+
+	// Created on connection
+	rootCmd = SetupRootCommand()
+	rootCmd.SetArgs(append([]string{"status", "--create-database"}, dbFlags...))
+	err = rootCmd.Execute()
+	s.Require().NoError(err)
+
+	checkDatabaseExists(true)
+
+	// Drop requires --force
+	rootCmd = SetupRootCommand()
+	rootCmd.SetArgs(append([]string{"db", "drop"}, dbFlags...))
+	err = rootCmd.Execute()
+	s.Assert().Error(err)
+
+	checkDatabaseExists(true)
+
+	rootCmd = SetupRootCommand()
+	rootCmd.SetArgs(append([]string{"db", "drop", "--force"}, dbFlags...))
+	err = rootCmd.Execute()
+	s.Require().NoError(err)
+
+	checkDatabaseExists(false)
+}
+
+func (s *CliTestSuite) TestMigrateKubernetesJob() {
+	projectDir := s.T().TempDir()
+	migrationsDir := filepath.Join(projectDir, "migrations")
+	os.Mkdir(migrationsDir, os.ModePerm)
+	defer s.resetDatabase()
+
+	terminationLog := filepath.Join(projectDir, "termination-log")
+	dbFlags := []string{"-l", projectDir, "-m", migrationsDir, "--user", s.postgres.Username, "--password",
+		s.postgres.Password, "--port", s.postgres.Port, "--database", s.postgres.Database,
+		"--exit-zero-on-no-pending", "--lock-identity", "migrate-job-x7k2p", "--termination-log", terminationLog}
+
+	readTerminationLog := func() map[string]any {
+		content, err := os.ReadFile(terminationLog)
+		s.Require().NoError(err)
+
+		message := map[string]any{}
+		s.Require().NoError(json.Unmarshal(content, &message))
+		return message
+	}
+
+	s.insertMigration(enums.MIGRATION_UP, migrationsDir, 1, "test", "CREATE TABLE test1 (id SERIAL PRIMARY KEY);")
+
+	rootCmd := SetupRootCommand()
+	rootCmd.SetArgs(append([]string{"migrate"}, dbFlags...))
+	err := rootCmd.Execute()
+	s.Require().NoError(err)
+
+	message := readTerminationLog()
+	s.Assert().Equal("succeeded", message["status"])
+	s.Assert().Equal([]any{float64(1)}, message["applied"])
+	s.Assert().NotEmpty(message["run_id"])
+
+	// Nothing is pending: the command exits before taking the lock and validating the applied migrations
+	s.insertMigration(enums.MIGRATION_UP, migrationsDir, 1, "test", "CREATE TABLE changed (id SERIAL PRIMARY KEY);")
+
+	rootCmd = SetupRootCommand()
+	rootCmd.SetArgs(append([]string{"migrate"}, dbFlags...))
+	err = rootCmd.Execute()
+	s.Require().NoError(err)
+
+	message = readTerminationLog()
+	s.Assert().Equal("up-to-date", message["status"])
+	s.Assert().Equal(float64(1), message["version"])
+
+	// With a pending migration, the changed migration fails the validation
+	s.insertMigration(enums.MIGRATION_UP, migrationsDir, 2, "test", "CREATE TABLE test2 (id SERIAL PRIMARY KEY);")
+
+	rootCmd = SetupRootCommand()
+	rootCmd.SetArgs(append([]string{"migrate"}, dbFlags...))
+	err = rootCmd.Execute()
+	s.Assert().Error(err)
+
+	message = readTerminationLog()
+	s.Assert().Equal("failed", message["status"])
+	s.Assert().NotEmpty(message["error"])
+	s.checkTableExists("test2", false)
+}
+
+func (s *CliTestSuite) TestMigrateCanary() {
+	projectDir := s.T().TempDir()
+	migrationsDir := filepath.Join(projectDir, "migrations")
+	os.Mkdir(migrationsDir, os.ModePerm)
+	defer s.resetDatabase()
+
+	_, err := s.suiteDb.Exec("CREATE DATABASE canary;")
+	s.Require().NoError(err)
+	defer s.suiteDb.Exec("DROP DATABASE canary;")
+
+	canaryURI := strings.Replace(s.postgres.URI, "/"+s.postgres.Database, "/canary", 1)
+	canaryDb, err := sql.Open("postgres", canaryURI)
+	s.Require().NoError(err)
+	defer canaryDb.Close()
+
+	dbFlags := []string{"-l", projectDir, "-m", migrationsDir, "--user", s.postgres.Username, "--password",
+		s.postgres.Password, "--port", s.postgres.Port, "--database", s.postgres.Database, "--canary", canaryURI}
+
+	// The canary run fails, so the target is not touched
+	s.insertMigration(enums.MIGRATION_UP, migrationsDir, 1, "test", "CREATE TABLE test1 (id SERIAL PRIMARY KEY);")
+	s.insertMigration(enums.MIGRATION_UP, migrationsDir, 2, "test", "INVALID SQL")
+
+	rootCmd := SetupRootCommand()
+	rootCmd.SetArgs(append([]string{"migrate"}, dbFlags...))
+	err = rootCmd.Execute()
+	s.Assert().Error(err)
+
+	s.checkTableExists("schema_history", false)
+	s.checkTableExists("test1", false)
+
+	_, err = canaryDb.Exec("DROP TABLE schema_history;")
+	s.Require().NoError(err)
+
+	// The canary run succeeds
+	s.insertMigration(enums.MIGRATION_UP, migrationsDir, 2, "test", "CREATE TABLE test2 (id SERIAL PRIMARY KEY);")
+
+	rootCmd = SetupRootCommand()
+	rootCmd.SetArgs(append([]string{"migrate"}, dbFlags...))
+	err = rootCmd.Execute()
+	s.Require().NoError(err)
+
+	s.checkTableExists("test2", true)
+	s.checkRecordsInTable("schema_history", 2)
+
+	count := 0
+	err = canaryDb.QueryRow("SELECT COUNT(*) FROM schema_history;").Scan(&count)
+	s.Require().NoError(err)
+	s.Assert().Equal(2, count)
+}
+
+func (s *CliTestSuite) TestMigrateBackup() {
+	projectDir := s.T().TempDir()
+	migrationsDir := filepath.Join(projectDir, "migrations")
+	os.Mkdir(migrationsDir, os.ModePerm)
+	backupDir := filepath.Join(projectDir, "backups")
+	defer s.resetDatabase()
+
+	// pg_dump writes its arguments to the dump file, or fails once the failure file exists
+	binDir := s.T().TempDir()
+	failure := filepath.Join(binDir, "fail")
+	script := fmt.Sprintf(`#!/bin/sh
+[ -f %s ] && echo "connection refused" && exit 1
+for arg in "$@"; do case "$arg" in --file=*) echo "$@" > "${arg#--file=}";; esac; done
+`, failure)
+	err := os.WriteFile(filepath.Join(binDir, "pg_dump"), []byte(script), 0755)
+	s.Require().NoError(err)
+	s.T().Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	err = os.WriteFile(filepath.Join(projectDir, "maestro.yaml"), []byte("backup:\n  path: "+backupDir+"\n"), os.ModePerm)
+	s.Require().NoError(err)
+
+	dbFlags := []string{"-l", projectDir, "-m", migrationsDir, "--user", s.postgres.Username, "--password",
+		s.postgres.Password, "--port", s.postgres.Port, "--database", s.postgres.Database}
+
+	// Runs without destructive migrations are not backed up
+	s.insertMigration(enums.MIGRATION_UP, migrationsDir, 1, "test", "CREATE TABLE test1 (id SERIAL PRIMARY KEY);")
+
+	rootCmd := SetupRootCommand()
+	rootCmd.SetArgs(append([]string{"migrate"}, dbFlags...))
+	err = rootCmd.Execute()
+	s.Require().NoError(err)
+
+	_, err = os.Stat(backupDir)
+	s.Assert().ErrorIs(err, os.ErrNotExist)
+
+	// The failed backup stops the run before the destructive migration
+	s.insertMigration(enums.MIGRATION_UP, migrationsDir, 2, "test", "DROP TABLE test1;")
+	err = os.WriteFile(failure, nil, os.ModePerm)
+	s.Require().NoError(err)
+
+	rootCmd = SetupRootCommand()
+	rootCmd.SetArgs(append([]string{"migrate"}, dbFlags...))
+	err = rootCmd.Execute()
+	s.Assert().Error(err)
+
+	s.checkTableExists("test1", true)
+
+	// The destructive migration is executed once backed up
+	err = os.Remove(failure)
+	s.Require().NoError(err)
+
+	rootCmd = SetupRootCommand()
+	rootCmd.SetArgs(append([]string{"migrate"}, dbFlags...))
+	err = rootCmd.Execute()
+	s.Require().NoError(err)
+
+	s.checkTableExists("test1", false)
+
+	dumps, err := filepath.Glob(filepath.Join(backupDir, s.postgres.Database+"_*_V002-V002.dump"))
+	s.Require().NoError(err)
+	s.Require().Len(dumps, 1)
+
+	content, err := os.ReadFile(dumps[0])
+	s.Require().NoError(err)
+	s.Assert().Contains(string(content), "--format=custom")
+	s.Assert().Contains(string(content), "--schema=public")
+
+	manifest, err := readBackupManifest(dumps[0] + backup_manifest_extension)
+	s.Require().NoError(err)
+	s.Assert().Equal(s.postgres.Database, manifest.Database)
+	s.Assert().Equal([]string{"public"}, manifest.Schemas)
+	s.Assert().Equal(uint16(1), manifest.LatestVersion)
+	s.Assert().Equal([]uint16{2}, manifest.Versions)
+}
+
+func (s *CliTestSuite) TestRestore() {
+	projectDir := s.T().TempDir()
+	migrationsDir := filepath.Join(projectDir, "migrations")
+	os.Mkdir(migrationsDir, os.ModePerm)
+	defer s.resetDatabase()
+
+	// pg_restore writes its arguments next to the dump
+	binDir := s.T().TempDir()
+	script := `#!/bin/sh
+for arg in "$@"; do last="$arg"; done
+echo "$@" > "$last.args"
+`
+	err := os.WriteFile(filepath.Join(binDir, "pg_restore"), []byte(script), 0755)
+	s.Require().NoError(err)
+	s.T().Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	dbFlags := []string{"-l", projectDir, "-m", migrationsDir, "--user", s.postgres.Username, "--password",
+		s.postgres.Password, "--port", s.postgres.Port, "--database", s.postgres.Database}
+
+	s.insertMigration(enums.MIGRATION_UP, migrationsDir, 1, "test", "CREATE TABLE test1 (id SERIAL PRIMARY KEY);")
+	s.insertMigration(enums.MIGRATION_UP, migrationsDir, 2, "test", "CREATE TABLE test2 (id SERIAL PRIMARY KEY);")
+
+	rootCmd := SetupRootCommand()
+	rootCmd.SetArgs(append([]string{"migrate"}, dbFlags...))
+	err = rootCmd.Execute()
+	s.Require().NoError(err)
+
+	// The backup of another schema keeps the current one, whose history is reconciled with the backup
+	dump := filepath.Join(projectDir, "backup.dump")
+	err = os.WriteFile(dump, nil, os.ModePerm)
+	s.Require().NoError(err)
+
+	err = writeBackupManifest(dump+backup_manifest_extension, &backupManifest{
+		Driver:        "postgres",
+		Database:      s.postgres.Database,
+		Schemas:       []string{"archive"},
+		LatestVersion: 1,
+		Versions:      []uint16{2},
+	})
+	s.Require().NoError(err)
+
+	// Restores are confirmed
+	rootCmd = SetupRootCommand()
+	rootCmd.SetIn(strings.NewReader("n\n"))
+	rootCmd.SetArgs(append([]string{"restore", "--backup", dump}, dbFlags...))
+	err = rootCmd.Execute()
+	s.Assert().Error(err)
+
+	s.checkRecordsInTable("schema_history", 2)
+
+	rootCmd = SetupRootCommand()
+	rootCmd.SetArgs(append([]string{"restore", "--backup", dump, "--yes"}, dbFlags...))
+	err = rootCmd.Execute()
+	s.Require().NoError(err)
+
+	args, err := os.ReadFile(dump + ".args")
+	s.Require().NoError(err)
+	s.Assert().Contains(string(args), "--clean --if-exists --single-transaction")
+	s.Assert().Contains(string(args), "--dbname="+s.postgres.Database)
+
+	s.checkTableExists("test1", true)
+	s.checkTableExists("test2", true)
+	s.checkRecordsInTable("schema_history", 1)
+
+	// Backups of other databases are refused
+	err = writeBackupManifest(dump+backup_manifest_extension, &backupManifest{
+		Driver:   "postgres",
+		Database: "other",
+		Schemas:  []string{"public"},
+	})
+	s.Require().NoError(err)
+
+	rootCmd = SetupRootCommand()
+	rootCmd.SetArgs(append([]string{"restore", "--backup", dump, "--yes"}, dbFlags...))
+	err = rootCmd.Execute()
+	s.Assert().ErrorContains(err, "not of the configured database")
+}
+
+func (s *CliTestSuite) TestHistoryTableMigrate() {
+	projectDir := s.T().TempDir()
+	migrationsDir := filepath.Join(projectDir, "migrations")
+	os.Mkdir(migrationsDir, os.ModePerm)
+	defer s.resetDatabase()
+
+	dbFlags := []string{"-l", projectDir, "-m", migrationsDir, "--user", s.postgres.Username, "--password",
+		s.postgres.Password, "--port", s.postgres.Port, "--database", s.postgres.Database}
+
+	s.insertMigration(enums.MIGRATION_UP, migrationsDir, 1, "test", "CREATE TABLE test1 (id SERIAL PRIMARY KEY);")
+
+	rootCmd := SetupRootCommand()
+	rootCmd.SetArgs(append([]string{"migrate"}, dbFlags...))
+	err := rootCmd.Execute()
+	s.Require().NoError(err)
+
+	// The history table is renamed, the previous one being kept in sync
+	err = os.WriteFile(filepath.Join(projectDir, "maestro.yaml"),
+		[]byte("history-table: app_history\nhistory-table-sync:\n  table: schema_history\n"), os.ModePerm)
+	s.Require().NoError(err)
+
+	rootCmd = SetupRootCommand()
+	rootCmd.SetArgs(append([]string{"history-table-migrate", "--from", "schema_history"}, dbFlags...))
+	err = rootCmd.Execute()
+	s.Require().NoError(err)
+
+	s.checkRecordsInTable("app_history", 1)
+
+	// Rows of the configured history table are only replaced on demand
+	rootCmd = SetupRootCommand()
+	rootCmd.SetArgs(append([]string{"history-table-migrate", "--from", "schema_history"}, dbFlags...))
+	err = rootCmd.Execute()
+	s.Assert().ErrorContains(err, "history table app_history already has 1 rows")
+
+	rootCmd = SetupRootCommand()
+	rootCmd.SetArgs(append([]string{"history-table-migrate", "--from", "schema_history", "--replace"}, dbFlags...))
+	err = rootCmd.Execute()
+	s.Require().NoError(err)
+
+	s.insertMigration(enums.MIGRATION_UP, migrationsDir, 2, "test", "CREATE TABLE test2 (id SERIAL PRIMARY KEY);")
+
+	rootCmd = SetupRootCommand()
+	rootCmd.SetArgs(append([]string{"migrate"}, dbFlags...))
+	err = rootCmd.Execute()
+	s.Require().NoError(err)
+
+	s.checkRecordsInTable("app_history", 2)
+	s.checkRecordsInTable("schema_history", 2)
+
+	// The previous table is no longer synced after the grace period
+	err = os.WriteFile(filepath.Join(projectDir, "maestro.yaml"),
+		[]byte("history-table: app_history\nhistory-table-sync:\n  table: schema_history\n  until: 2000-01-01\n"), os.ModePerm)
+	s.Require().NoError(err)
+
+	s.insertMigration(enums.MIGRATION_UP, migrationsDir, 3, "test", "CREATE TABLE test3 (id SERIAL PRIMARY KEY);")
+
+	rootCmd = SetupRootCommand()
+	rootCmd.SetArgs(append([]string{"migrate"}, dbFlags...))
+	err = rootCmd.Execute()
+	s.Require().NoError(err)
+
+	s.checkRecordsInTable("app_history", 3)
+	s.checkRecordsInTable("schema_history", 2)
+}
+
+// migrationBody returns the content of a created migration without its header.
+func migrationBody(content string) string {
+	_, body, found := strings.Cut(content, "\n\n")
+	if !found {
+		return content
+	}
+	return body
+}
+
+func (s *CliTestSuite) TestReproduce() {
+	projectDir := s.T().TempDir()
+	migrationsDir := filepath.Join(projectDir, "migrations")
+	archiveDir := filepath.Join(projectDir, "archive")
+	os.Mkdir(migrationsDir, os.ModePerm)
+	os.Mkdir(archiveDir, os.ModePerm)
+	defer s.resetDatabase()
+
+	_, err := s.suiteDb.Exec("CREATE DATABASE scratch;")
+	s.Require().NoError(err)
+	defer s.suiteDb.Exec("DROP DATABASE scratch;")
+
+	scratchURI := strings.Replace(s.postgres.URI, "/"+s.postgres.Database, "/scratch", 1)
+	scratchDb, err := sql.Open("postgres", scratchURI)
+	s.Require().NoError(err)
+	defer scratchDb.Close()
+
+	dbFlags := []string{"-l", projectDir, "-m", migrationsDir, "--user", s.postgres.Username, "--password",
+		s.postgres.Password, "--port", s.postgres.Port, "--database", s.postgres.Database}
+
+	s.insertMigration(enums.MIGRATION_UP, migrationsDir, 1, "test", "CREATE TABLE test1 (id SERIAL PRIMARY KEY);")
+	s.insertMigration(enums.MIGRATION_UP, migrationsDir, 2, "test", "CREATE TABLE test2 (id SERIAL PRIMARY KEY);")
+
+	rootCmd := SetupRootCommand()
+	rootCmd.SetArgs(append([]string{"migrate"}, dbFlags...))
+	err = rootCmd.Execute()
+	s.Require().NoError(err)
+
+	_, err = s.suiteDb.Exec(`
+		UPDATE schema_history SET executed_at = '2024-04-01 10:00:00' WHERE version = 1;
+		UPDATE schema_history SET executed_at = '2024-06-01 10:00:00' WHERE version = 2;
+	`)
+	s.Require().NoError(err)
+
+	// The first migration was archived out of the migration locations
+	err = os.Rename(filepath.Join(migrationsDir, "V001_test.sql"), filepath.Join(archiveDir, "V001_test.sql"))
+	s.Require().NoError(err)
+
+	rootCmd = SetupRootCommand()
+	rootCmd.SetArgs(append([]string{"reproduce", "--at", "2024-05-01", "--target", scratchURI}, dbFlags...))
+	err = rootCmd.Execute()
+	s.Assert().ErrorContains(err, "versions [1] were applied at that time but have no migration file")
+
+	rootCmd = SetupRootCommand()
+	rootCmd.SetArgs(append([]string{"reproduce", "--at", "2024-05-01", "--target", scratchURI, "--archive",
+		archiveDir}, dbFlags...))
+	err = rootCmd.Execute()
+	s.Require().NoError(err)
+
+	rows := 0
+	err = scratchDb.QueryRow("SELECT COUNT(*) FROM schema_history;").Scan(&rows)
+	s.Require().NoError(err)
+	s.Assert().Equal(1, rows)
+
+	// Only empty scratch databases are built
+	rootCmd = SetupRootCommand()
+	rootCmd.SetArgs(append([]string{"reproduce", "--at", "2", "--target", scratchURI, "--archive", archiveDir},
+		dbFlags...))
+	err = rootCmd.Execute()
+	s.Assert().ErrorContains(err, "already has 1 migrations")
+}
+
+func (s *CliTestSuite) TestCreateFromTemplate() {
+	projectDir := s.T().TempDir()
+	migrationsDir := filepath.Join(projectDir, "migrations")
+	os.Mkdir(migrationsDir, os.ModePerm)
+
+	err := os.WriteFile(filepath.Join(migrationsDir, "table.template.sql"),
+		[]byte("CREATE TABLE $1 (name VARCHAR($2:=10));"), os.ModePerm)
+	s.Require().NoError(err)
+
+	s.Run("test create command with template args", func() {
+		rootCmd := SetupRootCommand()
+		rootCmd.SetArgs([]string{"create", "add_orders", "-m", migrationsDir, "--from-template", "table",
+			"--template-arg", "orders"})
+		err := rootCmd.Execute()
+		s.Require().NoError(err)
+
+		content, err := os.ReadFile(filepath.Join(migrationsDir, "V001_add_orders.sql"))
+		s.Require().NoError(err)
+		s.Assert().Equal("CREATE TABLE orders (name VARCHAR(10));", migrationBody(string(content)))
+	})
+
+	s.Run("test create command with prompted template args", func() {
+		rootCmd := SetupRootCommand()
+		rootCmd.SetIn(strings.NewReader("items\n"))
+		rootCmd.SetArgs([]string{"create", "add_items", "-m", migrationsDir, "--from-template", "table"})
+		err := rootCmd.Execute()
+		s.Require().NoError(err)
+
+		content, err := os.ReadFile(filepath.Join(migrationsDir, "V002_add_items.sql"))
+		s.Require().NoError(err)
+		s.Assert().Equal("CREATE TABLE items (name VARCHAR(10));", migrationBody(string(content)))
+	})
+
+	s.Run("test create command with unknown template", func() {
+		rootCmd := SetupRootCommand()
+		rootCmd.SetArgs([]string{"create", "add_users", "-m", migrationsDir, "--from-template", "unknown"})
+		err := rootCmd.Execute()
+		s.Assert().Error(err)
+
+		s.checkFileExists(migrationsDir, "V003_add_users.sql", false)
+	})
+}
+
+func (s *CliTestSuite) TestCreateOutput() {
+	migrationsDir := filepath.Join(s.T().TempDir(), "migrations")
+	os.Mkdir(migrationsDir, os.ModePerm)
+
+	s.Run("test create command printing paths", func() {
+		out := &bytes.Buffer{}
+		rootCmd := SetupRootCommand()
+		rootCmd.SetOut(out)
+		rootCmd.SetArgs([]string{"create", "add_users", "-m", migrationsDir, "--with-down"})
+		err := rootCmd.Execute()
+		s.Require().NoError(err)
+
+		s.Assert().Equal(filepath.Join(migrationsDir, "V001_add_users.sql")+"\n"+
+			filepath.Join(migrationsDir, "V001_add_users.down.sql")+"\n", out.String())
+	})
+
+	s.Run("test create command printing json", func() {
+		out := &bytes.Buffer{}
+		rootCmd := SetupRootCommand()
+		rootCmd.SetOut(out)
+		rootCmd.SetArgs([]string{"create", "add_orders", "-m", migrationsDir, "--format", "json"})
+		err := rootCmd.Execute()
+		s.Require().NoError(err)
+
+		created := &createdMigration{}
+		s.Require().NoError(json.Unmarshal(out.Bytes(), created))
+		s.Assert().Equal(&createdMigration{
+			Version: 2,
+			Name:    "add_orders",
+			Path:    filepath.Join(migrationsDir, "V002_add_orders.sql"),
+		}, created)
+	})
+
+	s.Run("test create command with unknown format", func() {
+		rootCmd := SetupRootCommand()
+		rootCmd.SetArgs([]string{"create", "add_items", "-m", migrationsDir, "--format", "yaml"})
+		err := rootCmd.Execute()
+		s.Assert().Error(err)
+
+		s.checkFileExists(migrationsDir, "V003_add_items.sql", false)
+	})
+}
+
+func (s *CliTestSuite) TestCreateEdit() {
+	projectDir := s.T().TempDir()
+	migrationsDir := filepath.Join(projectDir, "migrations")
+	os.Mkdir(migrationsDir, os.ModePerm)
+
+	// The editor appends a statement to the files it is given
+	editor := filepath.Join(projectDir, "editor.sh")
+	err := os.WriteFile(editor, []byte("#!/bin/sh\nfor f in \"$@\"; do echo 'SELECT 1;' > \"$f\"; done\n"), 0o755)
+	s.Require().NoError(err)
+
+	s.T().Setenv("VISUAL", "")
+	s.T().Setenv("EDITOR", editor)
+
+	rootCmd := SetupRootCommand()
+	rootCmd.SetOut(&bytes.Buffer{})
+	rootCmd.SetArgs([]string{"create", "add_users", "-m", migrationsDir, "--with-down", "--edit"})
+	err = rootCmd.Execute()
+	s.Require().NoError(err)
+
+	for _, name := range []string{"V001_add_users.sql", "V001_add_users.down.sql"} {
+		content, err := os.ReadFile(filepath.Join(migrationsDir, name))
+		s.Require().NoError(err)
+		s.Assert().Equal("SELECT 1;\n", string(content))
+	}
+}
+
+func (s *CliTestSuite) TestCreateHeader() {
+	projectDir := s.T().TempDir()
+	migrationsDir := filepath.Join(projectDir, "migrations")
+	os.Mkdir(migrationsDir, os.ModePerm)
+
+	err := os.WriteFile(filepath.Join(projectDir, "maestro.yaml"), []byte("author: Jane Doe <jane@example.com>\n"), os.ModePerm)
+	s.Require().NoError(err)
+
+	rootCmd := SetupRootCommand()
+	rootCmd.SetOut(&bytes.Buffer{})
+	rootCmd.SetArgs([]string{"create", "add_users", "-l", projectDir, "-m", migrationsDir, "--ticket", "OPS-123"})
+	err = rootCmd.Execute()
+	s.Require().NoError(err)
+
+	content, err := os.ReadFile(filepath.Join(migrationsDir, "V001_add_users.sql"))
+	s.Require().NoError(err)
+	s.Assert().True(strings.HasPrefix(string(content), "-- maestro:author Jane Doe <jane@example.com>\n-- maestro:date "))
+	s.Assert().Contains(string(content), "\n-- maestro:ticket OPS-123\n\n")
+
+	// The author and the ticket are loaded from the header
+	migrationsMap, _, errs := filesystem.LoadObjectsFromFiles(&conf.MigrationConfig{Locations: []string{migrationsDir}})
+	s.Require().Empty(errs)
+	s.Assert().Equal("Jane Doe <jane@example.com>", migrationsMap[enums.MIGRATION_UP][0].Author)
+	s.Assert().Equal("OPS-123", migrationsMap[enums.MIGRATION_UP][0].Ticket)
 }
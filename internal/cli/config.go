@@ -0,0 +1,122 @@
+package cli
+
+import (
+	"path/filepath"
+
+	"github.com/creasty/defaults"
+	"github.com/maestro-go/maestro/core/conf"
+	"github.com/maestro-go/maestro/core/remote"
+	"github.com/maestro-go/maestro/internal/cli/flags"
+	internalConf "github.com/maestro-go/maestro/internal/conf"
+	"github.com/maestro-go/maestro/internal/filesystem"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// loadProjectConfig builds the project configuration for the given command.
+//
+// If the project file exists, it is loaded on top of the default configuration and the flags explicitly
+// set are merged into it. Otherwise, the configuration is extracted from the flags.
+// Only the flag groups registered in the command (database and migration flags) are taken into account.
+// The returned cleanup function removes the local copies of the remote migration locations, the caller
+// must call it once done with the configuration.
+func loadProjectConfig(cmd *cobra.Command, logger *zap.Logger) (*conf.ProjectConfig, func(), error) {
+	globalFlags, err := flags.ExtractGlobalFlags(cmd)
+	if err != nil {
+		logError(logger, ErrExtractGlobalFlags, err)
+		return nil, nil, genError(ErrExtractGlobalFlags, err)
+	}
+
+	configFilePath := filepath.Join(globalFlags.Location, internalConf.DEFAULT_PROJECT_FILE)
+	exists, err := filesystem.CheckFSObject(configFilePath)
+	if err != nil {
+		logError(logger, ErrCheckFile, err)
+		return nil, nil, genError(ErrCheckFile, err)
+	}
+
+	hasDBFlags := cmd.Flags().Lookup("driver") != nil
+	hasMigrationFlags := cmd.Flags().Lookup("validate") != nil
+
+	projectConfig := &conf.ProjectConfig{}
+	err = defaults.Set(projectConfig)
+	if err != nil {
+		logError(logger, ErrLoadConfigFromFile, err)
+		return nil, nil, genError(ErrLoadConfigFromFile, err)
+	}
+
+	if exists {
+		logger.Info("Located config file")
+
+		err = conf.LoadConfigFromFile(configFilePath, projectConfig)
+		if err != nil {
+			logError(logger, ErrLoadConfigFromFile, err)
+			return nil, nil, genError(ErrLoadConfigFromFile, err)
+		}
+
+		if hasDBFlags {
+			err = flags.MergeDBConfigFlags(cmd, projectConfig)
+			if err != nil {
+				logError(logger, ErrMergeDBConfigFlags, err)
+				return nil, nil, genError(ErrMergeDBConfigFlags, err)
+			}
+		}
+
+		if hasMigrationFlags {
+			err = flags.MergeMigrationsConfigFlags(cmd, &projectConfig.Migration)
+			if err != nil {
+				logError(logger, ErrMergeMigrationLocations, err)
+				return nil, nil, genError(ErrMergeMigrationLocations, err)
+			}
+		}
+
+		err = flags.MergeMigrationLocations(cmd, &projectConfig.Migration)
+		if err != nil {
+			logError(logger, ErrMergeMigrationLocations, err)
+			return nil, nil, genError(ErrMergeMigrationLocations, err)
+		}
+
+		cleanup, err := remote.Fetch(cmd.Context(), logger, &projectConfig.Migration)
+		if err != nil {
+			logError(logger, ErrFetchRemoteLocations, err)
+			return nil, nil, genError(ErrFetchRemoteLocations, err)
+		}
+
+		// Each migration track has its own history table
+		projectConfig.HistoryTable = projectConfig.TrackHistoryTable()
+		projectConfig.Migration.Extension = projectConfig.FileExtension()
+		projectConfig.Migration.Driver = projectConfig.Driver
+
+		return projectConfig, cleanup, nil
+	}
+
+	if hasDBFlags {
+		err = flags.ExtractDBConfigFlags(cmd, projectConfig)
+		if err != nil {
+			logError(logger, ErrExtractDBConfigFlags, err)
+			return nil, nil, genError(ErrExtractDBConfigFlags, err)
+		}
+	}
+
+	if hasMigrationFlags {
+		err = flags.ExtractMigrationConfigFlags(cmd, &projectConfig.Migration)
+		if err != nil {
+			logError(logger, ErrExtractConfigFromFile, err)
+			return nil, nil, genError(ErrExtractConfigFromFile, err)
+		}
+	}
+
+	projectConfig.Migration.Locations = globalFlags.MigrationLocations
+
+	cleanup, err := remote.Fetch(cmd.Context(), logger, &projectConfig.Migration)
+	if err != nil {
+		logError(logger, ErrFetchRemoteLocations, err)
+		return nil, nil, genError(ErrFetchRemoteLocations, err)
+	}
+
+	// Each migration track has its own history table
+	projectConfig.HistoryTable = projectConfig.TrackHistoryTable()
+	projectConfig.Migration.Extension = projectConfig.FileExtension()
+	projectConfig.Migration.Driver = projectConfig.Driver
+
+	return projectConfig, cleanup, nil
+}
@@ -0,0 +1,85 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/maestro-go/maestro/core/enums"
+	"github.com/maestro-go/maestro/internal/filesystem"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// writeDriverProject writes a project of the driver with two migrations of the extension, and a SQL file
+// ignored by the driver.
+func writeDriverProject(t *testing.T, driver string, extension string) string {
+	projectDir := t.TempDir()
+	migrationsDir := filepath.Join(projectDir, "migrations")
+	require.NoError(t, os.Mkdir(migrationsDir, os.ModePerm))
+
+	config := "driver: " + driver + "\nmigrations:\n  locations:\n    - " + migrationsDir + "\n"
+	err := os.WriteFile(filepath.Join(projectDir, "maestro.yaml"), []byte(config), os.ModePerm)
+	require.NoError(t, err)
+
+	for _, name := range []string{"V001_init." + extension, "V002_seed." + extension, "V003_ignored.sql"} {
+		err = os.WriteFile(filepath.Join(migrationsDir, name), []byte("{}"), os.ModePerm)
+		require.NoError(t, err)
+	}
+
+	return projectDir
+}
+
+// captureStderr returns what the function writes to stderr, where the logger of the commands writes.
+func captureStderr(t *testing.T, f func()) string {
+	file, err := os.CreateTemp(t.TempDir(), "stderr")
+	require.NoError(t, err)
+	defer file.Close()
+
+	stderr := os.Stderr
+	os.Stderr = file
+	defer func() { os.Stderr = stderr }()
+
+	f()
+
+	content, err := os.ReadFile(file.Name())
+	require.NoError(t, err)
+	return string(content)
+}
+
+func TestLoadProjectConfigDriverExtension(t *testing.T) {
+	for driver, extension := range map[string]string{
+		"opensearch": "json",
+		"neo4j":      "cypher",
+		"redis":      "redis",
+		"mongodb":    "json",
+	} {
+		projectDir := writeDriverProject(t, driver, extension)
+
+		// The commands loading migrations find the files of the driver
+		for _, command := range [][]string{{"migrate"}, {"status"}, {"repair"}, {"templates", "list"}} {
+			cmd, _, err := SetupRootCommand().Find(command)
+			require.NoError(t, err)
+			require.NoError(t, cmd.ParseFlags([]string{"-l", projectDir}))
+
+			projectConfig, removeLocations, err := loadProjectConfig(cmd, zap.NewNop())
+			require.NoError(t, err, command)
+			defer removeLocations()
+
+			assert.Equal(t, extension, projectConfig.Migration.Extension, command)
+			assert.Equal(t, driver, projectConfig.Migration.Driver, command)
+
+			migrations, _, errs := filesystem.LoadObjectsFromFiles(&projectConfig.Migration)
+			require.Empty(t, errs, command)
+			assert.Len(t, migrations[enums.MIGRATION_UP], 2, command)
+		}
+
+		output := captureStderr(t, func() {
+			rootCmd := SetupRootCommand()
+			rootCmd.SetArgs([]string{"status", "--local", "-l", projectDir})
+			require.NoError(t, rootCmd.Execute())
+		})
+		assert.Contains(t, output, `"migrations": 2`, driver)
+	}
+}
@@ -0,0 +1,48 @@
+package cli
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/maestro-go/maestro/core/conf"
+	"github.com/spf13/cobra"
+)
+
+var errNotConfirmed = errors.New("operation not confirmed")
+
+// confirmAction asks the user to confirm a destructive action, unless the --yes flag is set.
+// Returns errNotConfirmed if the user does not answer "y" or "yes".
+func confirmAction(cmd *cobra.Command, message string) error {
+	yes, err := cmd.Flags().GetBool("yes")
+	if err != nil {
+		return err
+	}
+
+	if yes {
+		return nil
+	}
+
+	fmt.Fprintf(cmd.OutOrStdout(), "%s Continue? [y/N]: ", message)
+
+	scanner := bufio.NewScanner(cmd.InOrStdin())
+	if !scanner.Scan() {
+		return errNotConfirmed
+	}
+
+	answer := strings.ToLower(strings.TrimSpace(scanner.Text()))
+	if answer != "y" && answer != "yes" {
+		return errNotConfirmed
+	}
+
+	return nil
+}
+
+// checkNotProtected returns an error if the configured database is protected against destructive commands.
+func checkNotProtected(config *conf.ProjectConfig, command string) error {
+	if config.Protected {
+		return fmt.Errorf("database %s is protected, %s is not allowed", config.Database, command)
+	}
+	return nil
+}
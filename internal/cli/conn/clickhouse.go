@@ -0,0 +1,41 @@
+package conn
+
+import (
+	"net"
+	"net/url"
+	"strconv"
+
+	_ "github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/maestro-go/maestro/core/conf"
+)
+
+// buildClickHouseURL returns the clickhouse:// URL of the given database of the server of the configuration,
+// on its native protocol port. The connection uses TLS unless SSL is disabled, and the certificate of the
+// server is only trusted without verification with the require mode, as with PostgreSQL. Read-only sessions
+// can not write, but can still change their settings as the driver does.
+func buildClickHouseURL(config *conf.ProjectConfig, database string, readOnly bool) string {
+	params := url.Values{}
+
+	switch config.SSL.SSLMode {
+	case "disable":
+	case "require":
+		params.Set("secure", "true")
+		params.Set("skip_verify", "true")
+	default:
+		params.Set("secure", "true")
+	}
+
+	if readOnly {
+		params.Set("readonly", "2")
+	}
+
+	serverURL := url.URL{
+		Scheme:   "clickhouse",
+		User:     url.UserPassword(config.User, config.Password),
+		Host:     net.JoinHostPort(config.Host, strconv.Itoa(int(config.Port))),
+		Path:     "/" + database,
+		RawQuery: params.Encode(),
+	}
+
+	return serverURL.String()
+}
@@ -8,39 +8,198 @@ import (
 
 	"github.com/maestro-go/maestro/core/conf"
 	"github.com/maestro-go/maestro/core/database"
+	"github.com/maestro-go/maestro/core/database/clickhouse"
 	"github.com/maestro-go/maestro/core/database/cockroachdb"
+	"github.com/maestro-go/maestro/core/database/greenplum"
+	"github.com/maestro-go/maestro/core/database/informix"
+	"github.com/maestro-go/maestro/core/database/mariadb"
+	"github.com/maestro-go/maestro/core/database/oracle"
 	"github.com/maestro-go/maestro/core/database/postgres"
+	"github.com/maestro-go/maestro/core/database/sqlite"
+	"github.com/maestro-go/maestro/core/database/sqlserver"
 	"github.com/maestro-go/maestro/core/enums"
 )
 
 // ConnectToDatabase establishes a connection to a database based on the provided configuration and driver type.
 // It returns a repository interface for database operations, a cleanup function to release resources, and an error if any.
 func ConnectToDatabase(ctx context.Context, config *conf.ProjectConfig, driver enums.DriverType) (database.Repository, func(), error) {
+	return connect(ctx, config, driver, false)
+}
+
+// ConnectToDatabaseReadOnly establishes a connection like ConnectToDatabase for commands only reading the database.
+// The sessions of the PostgreSQL family of drivers, of MariaDB and of ClickHouse, and SQLite files, are read-only, so a misconfigured command can never change the
+// database, and the database is not created even if create-database is set. SQL Server, Oracle and Informix repositories only run queries,
+// any other statement fails with database.ErrReadOnly.
+func ConnectToDatabaseReadOnly(ctx context.Context, config *conf.ProjectConfig, driver enums.DriverType) (database.Repository, func(), error) {
+	readOnlyConfig := *config
+	readOnlyConfig.CreateDatabase = false
+	return connect(ctx, &readOnlyConfig, driver, true)
+}
+
+func connect(ctx context.Context, config *conf.ProjectConfig, driver enums.DriverType, readOnly bool) (database.Repository, func(), error) {
 	repo := (database.Repository)(nil)
 	db := (*sql.DB)(nil)
 
+	// External drivers create the database themselves
+	if driver == enums.DRIVER_PLUGIN {
+		return connectToPlugin(ctx, config, "", readOnly)
+	}
+
+	if config.Auth != "" && driver != enums.DRIVER_SQLSERVER {
+		return nil, nil, fmt.Errorf("auth %s is only supported by the sqlserver driver", config.Auth)
+	}
+
+	if config.CreateDatabase {
+		_, err := CreateDatabase(ctx, config, driver)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create database: %w", err)
+		}
+	}
+
 	switch driver {
-	case enums.DRIVER_POSTGRES, enums.DRIVER_COCKROACHDB:
+	case enums.DRIVER_POSTGRES, enums.DRIVER_COCKROACHDB, enums.DRIVER_GREENPLUM:
 		var err error
-		db, err = connectToPostgres(config)
+		db, err = connectToPostgres(config, config.Database, readOnly)
 		if err != nil {
 			return nil, nil, err
 		}
 
-		db.SetMaxOpenConns(25)
-		db.SetMaxIdleConns(25)
-		db.SetConnMaxLifetime(5 * time.Minute)
+	case enums.DRIVER_MARIADB:
+		dsn, err := buildMariaDBDSN(config, config.Database)
+		if err != nil {
+			return nil, nil, err
+		}
 
-		if driver == enums.DRIVER_POSTGRES {
-			repo = postgres.NewPostgresRepository(ctx, db, &config.HistoryTable)
-		} else {
-			repo = cockroachdb.NewCockroachRepository(ctx, db, &config.HistoryTable)
+		db, err = connectToMariaDB(dsn, readOnly)
+		if err != nil {
+			return nil, nil, err
 		}
 
+	case enums.DRIVER_SQLITE:
+		var err error
+		db, err = connectToSQLite(config.Database, readOnly)
+		if err != nil {
+			return nil, nil, err
+		}
+
+	case enums.DRIVER_SQLSERVER:
+		var err error
+		db, err = connectToSQLServer(config, config.Database)
+		if err != nil {
+			return nil, nil, err
+		}
+
+	case enums.DRIVER_ORACLE:
+		var err error
+		db, err = openAndPing("oracle", buildOracleURL(config))
+		if err != nil {
+			return nil, nil, err
+		}
+
+	case enums.DRIVER_CLICKHOUSE:
+		var err error
+		db, err = openAndPing("clickhouse", buildClickHouseURL(config, config.Database, readOnly))
+		if err != nil {
+			return nil, nil, err
+		}
+
+	case enums.DRIVER_INFORMIX:
+		var err error
+		db, err = connectToInformix(buildInformixDSN(config))
+		if err != nil {
+			return nil, nil, err
+		}
+
+	case enums.DRIVER_OPENSEARCH:
+		return connectToOpenSearch(ctx, config, buildHTTPURL(config))
+
+	case enums.DRIVER_NEO4J:
+		return connectToNeo4j(ctx, config, buildHTTPURL(config))
+
+	case enums.DRIVER_REDIS:
+		return connectToRedis(ctx, config, buildRedisURL(config))
+
+	case enums.DRIVER_MONGODB:
+		return connectToMongoDB(ctx, config, buildMongoDBURL(config))
+
+	case enums.DRIVER_DATABRICKS:
+		return connectToDatabricks(ctx, config, buildDatabricksURL(config))
+
+	case enums.DRIVER_TRINO:
+		return connectToTrino(ctx, config, buildTrinoURL(config))
+
+	default:
+		return nil, nil, fmt.Errorf("unsupported driver type: %d", driver)
+	}
+
+	repo = newRepository(ctx, db, config, driver, readOnly)
+
+	cleanup := func() {
+		db.Close()
+	}
+
+	return repo, cleanup, nil
+}
+
+// ConnectToDSN establishes a connection to the database of the given data source name (URL or key/value
+// connection string of the driver, or file of SQLite), using the history table of the configuration.
+// It returns a repository interface for database operations, a cleanup function to release resources, and an error if any.
+func ConnectToDSN(ctx context.Context, dsn string, config *conf.ProjectConfig, driver enums.DriverType) (database.Repository, func(), error) {
+	open := func() (*sql.DB, error) {
+		return openAndPing("postgres", dsn)
+	}
+
+	switch driver {
+	case enums.DRIVER_POSTGRES, enums.DRIVER_COCKROACHDB, enums.DRIVER_GREENPLUM:
+	case enums.DRIVER_MARIADB:
+		open = func() (*sql.DB, error) {
+			return connectToMariaDB(dsn, false)
+		}
+	case enums.DRIVER_SQLITE:
+		open = func() (*sql.DB, error) {
+			return openAndPing("sqlite", dsn)
+		}
+	case enums.DRIVER_SQLSERVER:
+		open = func() (*sql.DB, error) {
+			return openAndPing("sqlserver", dsn)
+		}
+	case enums.DRIVER_ORACLE:
+		open = func() (*sql.DB, error) {
+			return openAndPing("oracle", dsn)
+		}
+	case enums.DRIVER_CLICKHOUSE:
+		open = func() (*sql.DB, error) {
+			return openAndPing("clickhouse", dsn)
+		}
+	case enums.DRIVER_INFORMIX:
+		open = func() (*sql.DB, error) {
+			return connectToInformix(dsn)
+		}
+	case enums.DRIVER_OPENSEARCH:
+		return connectToOpenSearch(ctx, config, dsn)
+	case enums.DRIVER_NEO4J:
+		return connectToNeo4j(ctx, config, dsn)
+	case enums.DRIVER_REDIS:
+		return connectToRedis(ctx, config, dsn)
+	case enums.DRIVER_MONGODB:
+		return connectToMongoDB(ctx, config, dsn)
+	case enums.DRIVER_DATABRICKS:
+		return connectToDatabricks(ctx, config, dsn)
+	case enums.DRIVER_TRINO:
+		return connectToTrino(ctx, config, dsn)
+	case enums.DRIVER_PLUGIN:
+		return connectToPlugin(ctx, config, dsn, false)
 	default:
 		return nil, nil, fmt.Errorf("unsupported driver type: %d", driver)
 	}
 
+	db, err := open()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	repo := newRepository(ctx, db, config, driver, false)
+
 	cleanup := func() {
 		db.Close()
 	}
@@ -48,18 +207,73 @@ func ConnectToDatabase(ctx context.Context, config *conf.ProjectConfig, driver e
 	return repo, cleanup, nil
 }
 
-func connectToPostgres(config *conf.ProjectConfig) (*sql.DB, error) {
+func newRepository(ctx context.Context, db *sql.DB, config *conf.ProjectConfig, driver enums.DriverType, readOnly bool) database.Repository {
+	if config.SingleConnection {
+		// Keep the only connection open, so session state such as advisory locks and temporary
+		// tables lasts for the whole command
+		db.SetMaxOpenConns(1)
+		db.SetMaxIdleConns(1)
+		db.SetConnMaxLifetime(0)
+	} else {
+		db.SetMaxOpenConns(25)
+		db.SetMaxIdleConns(25)
+		db.SetConnMaxLifetime(5 * time.Minute)
+	}
+
+	switch driver {
+	case enums.DRIVER_COCKROACHDB:
+		return cockroachdb.NewCockroachRepository(ctx, db, &config.HistoryTable)
+	case enums.DRIVER_GREENPLUM:
+		return greenplum.NewGreenplumRepository(ctx, db, &config.HistoryTable)
+	case enums.DRIVER_MARIADB:
+		return mariadb.NewMariaDBRepository(ctx, db, &config.HistoryTable)
+	case enums.DRIVER_SQLITE:
+		return sqlite.NewSQLiteRepository(ctx, db, &config.HistoryTable)
+	case enums.DRIVER_SQLSERVER:
+		if readOnly {
+			// SQL Server sessions cannot be made read-only, so the statements other than queries are rejected
+			return sqlserver.NewSQLServerRepository(ctx, database.ReadOnly(db), &config.HistoryTable)
+		}
+		return sqlserver.NewSQLServerRepository(ctx, db, &config.HistoryTable)
+	case enums.DRIVER_ORACLE:
+		if readOnly {
+			// Oracle sessions cannot be made read-only either
+			return oracle.NewOracleRepository(ctx, database.ReadOnly(db), &config.HistoryTable)
+		}
+		return oracle.NewOracleRepository(ctx, db, &config.HistoryTable)
+	case enums.DRIVER_CLICKHOUSE:
+		return clickhouse.NewClickHouseRepository(ctx, db, &config.HistoryTable)
+	case enums.DRIVER_INFORMIX:
+		if readOnly {
+			// Informix sessions cannot be made read-only either
+			return informix.NewInformixRepository(ctx, database.ReadOnly(db), &config.HistoryTable)
+		}
+		return informix.NewInformixRepository(ctx, db, &config.HistoryTable)
+	}
+	return postgres.NewPostgresRepository(ctx, db, &config.HistoryTable)
+}
+
+func connectToPostgres(config *conf.ProjectConfig, database string, readOnly bool) (*sql.DB, error) {
 	var connStr string
 
-	connStr = buildConnectionString(config, config.Host, config.Port)
+	connStr = buildConnectionString(config, config.Host, config.Port, database)
 
 	// Add SSL configuration if needed
 	if config.SSL.SSLRootCert != "" {
 		connStr += fmt.Sprintf(" sslrootcert=%s", config.SSL.SSLRootCert)
 	}
 
+	// Every transaction of the session is read-only
+	if readOnly {
+		connStr += " options='-c default_transaction_read_only=on'"
+	}
+
+	return openAndPing("postgres", connStr)
+}
+
+func openAndPing(driverName string, dsn string) (*sql.DB, error) {
 	// Establish database connection
-	db, err := sql.Open("postgres", connStr)
+	db, err := sql.Open(driverName, dsn)
 	if err != nil {
 		return nil, fmt.Errorf("database connection failed: %w", err)
 	}
@@ -75,12 +289,12 @@ func connectToPostgres(config *conf.ProjectConfig) (*sql.DB, error) {
 	return db, nil
 }
 
-func buildConnectionString(config *conf.ProjectConfig, host string, port uint16) string {
+func buildConnectionString(config *conf.ProjectConfig, host string, port uint16, database string) string {
 	return fmt.Sprintf(
 		"host=%s port=%d dbname=%s user=%s password=%s sslmode=%s search_path=%s",
 		host,
 		port,
-		config.Database,
+		database,
 		config.User,
 		config.Password,
 		config.SSL.SSLMode,
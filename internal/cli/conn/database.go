@@ -0,0 +1,170 @@
+package conn
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/maestro-go/maestro/core/conf"
+	"github.com/maestro-go/maestro/core/enums"
+)
+
+// maintenanceDatabases maps each driver to the database used to create or drop the configured one.
+var maintenanceDatabases = map[enums.DriverType]string{
+	enums.DRIVER_POSTGRES:    "postgres",
+	enums.DRIVER_COCKROACHDB: "defaultdb",
+	enums.DRIVER_GREENPLUM:   "postgres",
+	enums.DRIVER_MARIADB:     "information_schema", // Readable by every user
+	enums.DRIVER_SQLSERVER:   "master",
+	enums.DRIVER_CLICKHOUSE:  "default",
+}
+
+// CreateDatabase connects to the maintenance database of the driver and creates the configured database
+// if it does not exist. The database of SQLite is the file of the configured path. Returns true if the database was created.
+func CreateDatabase(ctx context.Context, config *conf.ProjectConfig, driver enums.DriverType) (bool, error) {
+	if driver == enums.DRIVER_SQLITE {
+		return createSQLiteDatabase(config.Database)
+	}
+
+	if maintenanceDatabases[driver] == config.Database {
+		return false, nil // Always exists
+	}
+
+	db, err := connectToMaintenance(config, driver)
+	if err != nil {
+		return false, err
+	}
+	defer db.Close()
+
+	exists, err := databaseExists(ctx, db, driver, config.Database)
+	if err != nil {
+		return false, err
+	}
+
+	if exists {
+		return false, nil
+	}
+
+	_, err = db.ExecContext(ctx, fmt.Sprintf("CREATE DATABASE %s;", quoteIdentifier(driver, config.Database)))
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// DropDatabase connects to the maintenance database of the driver and drops the configured database
+// if it exists. The database of SQLite is the file of the configured path. Returns true if the database was dropped.
+func DropDatabase(ctx context.Context, config *conf.ProjectConfig, driver enums.DriverType) (bool, error) {
+	if driver == enums.DRIVER_SQLITE {
+		return dropSQLiteDatabase(config.Database)
+	}
+
+	if maintenanceDatabases[driver] == config.Database {
+		return false, fmt.Errorf("database %s is the maintenance database and cannot be dropped", config.Database)
+	}
+
+	db, err := connectToMaintenance(config, driver)
+	if err != nil {
+		return false, err
+	}
+	defer db.Close()
+
+	exists, err := databaseExists(ctx, db, driver, config.Database)
+	if err != nil {
+		return false, err
+	}
+
+	if !exists {
+		return false, nil
+	}
+
+	_, err = db.ExecContext(ctx, fmt.Sprintf("DROP DATABASE %s;", quoteIdentifier(driver, config.Database)))
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func connectToMaintenance(config *conf.ProjectConfig, driver enums.DriverType) (*sql.DB, error) {
+	// Oracle databases are pluggable databases or schemas, provisioned by the DBA
+	if driver == enums.DRIVER_ORACLE {
+		return nil, fmt.Errorf("oracle databases can not be created or dropped by maestro")
+	}
+
+	// Informix databases are created with their dbspace and logging mode by the DBA
+	if driver == enums.DRIVER_INFORMIX {
+		return nil, fmt.Errorf("informix databases can not be created or dropped by maestro")
+	}
+
+	// Trino databases are catalogs, configured on the coordinator
+	if driver == enums.DRIVER_TRINO {
+		return nil, fmt.Errorf("trino catalogs can not be created or dropped by maestro")
+	}
+
+	// MongoDB databases exist once a collection is created in them
+	if driver == enums.DRIVER_MONGODB {
+		return nil, fmt.Errorf("mongodb databases are created by their first migration, create-database is not needed")
+	}
+
+	// External drivers create the database on connection with create-database
+	if driver == enums.DRIVER_PLUGIN {
+		return nil, fmt.Errorf("plugin databases can not be created or dropped by maestro, set create-database " +
+			"to let the external driver create it")
+	}
+
+	maintenance, ok := maintenanceDatabases[driver]
+	if !ok {
+		return nil, fmt.Errorf("unsupported driver type: %d", driver)
+	}
+
+	if driver == enums.DRIVER_MARIADB {
+		dsn, err := buildMariaDBDSN(config, maintenance)
+		if err != nil {
+			return nil, err
+		}
+		return connectToMariaDB(dsn, false)
+	}
+
+	if driver == enums.DRIVER_SQLSERVER {
+		return connectToSQLServer(config, maintenance)
+	}
+
+	if driver == enums.DRIVER_CLICKHOUSE {
+		return openAndPing("clickhouse", buildClickHouseURL(config, maintenance, false))
+	}
+
+	return connectToPostgres(config, maintenance, false)
+}
+
+func databaseExists(ctx context.Context, db *sql.DB, driver enums.DriverType, database string) (bool, error) {
+	query := "SELECT EXISTS (SELECT 1 FROM pg_database WHERE datname = $1);"
+	switch driver {
+	case enums.DRIVER_MARIADB:
+		query = "SELECT EXISTS (SELECT 1 FROM information_schema.schemata WHERE schema_name = ?);"
+	case enums.DRIVER_SQLSERVER:
+		query = "SELECT CAST(CASE WHEN DB_ID(@p1) IS NULL THEN 0 ELSE 1 END AS BIT);"
+	case enums.DRIVER_CLICKHOUSE:
+		query = "SELECT count() > 0 FROM system.databases WHERE name = ?;"
+	}
+
+	exists := false
+	err := db.QueryRowContext(ctx, query, database).Scan(&exists)
+	if err != nil {
+		return false, err
+	}
+
+	return exists, nil
+}
+
+func quoteIdentifier(driver enums.DriverType, identifier string) string {
+	switch driver {
+	case enums.DRIVER_MARIADB, enums.DRIVER_CLICKHOUSE:
+		return "`" + strings.ReplaceAll(identifier, "`", "``") + "`"
+	case enums.DRIVER_SQLSERVER:
+		return "[" + strings.ReplaceAll(identifier, "]", "]]") + "]"
+	}
+	return `"` + strings.ReplaceAll(identifier, `"`, `""`) + `"`
+}
@@ -0,0 +1,86 @@
+package conn
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/maestro-go/maestro/core/conf"
+	"github.com/maestro-go/maestro/core/database"
+	"github.com/maestro-go/maestro/core/database/databricks"
+)
+
+// connectToDatabricks creates a repository for the SQL warehouse of the given URL
+// ("https://token:<token>@host/sql/1.0/warehouses/<id>?catalog=<catalog>&schema=<schema>")
+// and checks that it is reachable.
+func connectToDatabricks(ctx context.Context, config *conf.ProjectConfig, warehouseURL string) (database.Repository, func(), error) {
+	parsedURL, err := url.Parse(warehouseURL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid databricks URL: %w", err)
+	}
+
+	warehouseID, err := databricks.WarehouseIDFromHTTPPath(parsedURL.Path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	token := ""
+	if parsedURL.User != nil {
+		token, _ = parsedURL.User.Password()
+	}
+	if token == "" {
+		return nil, nil, fmt.Errorf("missing databricks access token")
+	}
+
+	catalog := parsedURL.Query().Get("catalog")
+	schema := parsedURL.Query().Get("schema")
+	workspaceURL := (&url.URL{Scheme: parsedURL.Scheme, Host: parsedURL.Host}).String()
+
+	client, err := newHTTPClient(config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Stopped warehouses take a few minutes to start
+	pingCtx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+	err = databricks.NewDatabricksRepository(pingCtx, client, workspaceURL, token, warehouseID, catalog, schema,
+		nil).Ping()
+	if err != nil {
+		return nil, nil, fmt.Errorf("database ping failed: %w", err)
+	}
+
+	repo := databricks.NewDatabricksRepository(ctx, client, workspaceURL, token, warehouseID, catalog, schema,
+		&config.HistoryTable)
+
+	cleanup := func() {
+		client.CloseIdleConnections()
+	}
+
+	return repo, cleanup, nil
+}
+
+// buildDatabricksURL returns the URL of the SQL warehouse of the configuration: the password is the
+// personal access token, and the database and schema are the catalog and schema of the statements.
+func buildDatabricksURL(config *conf.ProjectConfig) string {
+	query := url.Values{}
+	if config.Database != "" {
+		query.Set("catalog", config.Database)
+	}
+	if config.Schema != "" {
+		query.Set("schema", config.Schema)
+	}
+
+	warehouseURL := url.URL{
+		Scheme:   "https",
+		Host:     net.JoinHostPort(config.Host, strconv.Itoa(int(config.Port))),
+		User:     url.UserPassword("token", config.Password),
+		Path:     config.HTTPPath,
+		RawQuery: query.Encode(),
+	}
+
+	return warehouseURL.String()
+}
@@ -0,0 +1,68 @@
+package conn
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/maestro-go/maestro/core/conf"
+)
+
+// newHTTPClient returns the client of the drivers using HTTP APIs, with the TLS configuration of newTLSConfig.
+func newHTTPClient(config *conf.ProjectConfig) (*http.Client, error) {
+	tlsConfig, err := newTLSConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	return &http.Client{Transport: transport, Timeout: 5 * time.Minute}, nil
+}
+
+// newTLSConfig returns the TLS configuration of the drivers not using libpq connection strings, following
+// the SSL configuration: "disable" is expected to be used with plain connections, "require" skips the
+// certificate verification, and the other modes verify it, using the configured root certificate if any.
+func newTLSConfig(config *conf.ProjectConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: config.SSL.SSLMode == "require"}
+
+	if config.SSL.SSLRootCert != "" {
+		rootCert, err := os.ReadFile(config.SSL.SSLRootCert)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read root certificate: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(rootCert) {
+			return nil, fmt.Errorf("invalid root certificate %s", config.SSL.SSLRootCert)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	return tlsConfig, nil
+}
+
+// buildHTTPURL returns the URL of the server of the configuration, using https unless SSL is disabled.
+func buildHTTPURL(config *conf.ProjectConfig) string {
+	serverURL := url.URL{
+		Scheme: "https",
+		Host:   net.JoinHostPort(config.Host, strconv.Itoa(int(config.Port))),
+	}
+
+	if config.SSL.SSLMode == "disable" {
+		serverURL.Scheme = "http"
+	}
+
+	if config.User != "" {
+		serverURL.User = url.UserPassword(config.User, config.Password)
+	}
+
+	return serverURL.String()
+}
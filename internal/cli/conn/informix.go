@@ -0,0 +1,56 @@
+package conn
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/maestro-go/maestro/core/conf"
+)
+
+// informix_odbc_driver is the name of the database/sql driver the Informix connections are opened with. No
+// Informix driver is pure Go, so maestro does not ship one: builds linking an ODBC driver registered under this
+// name, e.g. github.com/alexbrainman/odbc with the IBM Informix ODBC driver installed, connect to Informix.
+const informix_odbc_driver = "odbc"
+
+// buildInformixDSN returns the ODBC connection string of the IBM Informix ODBC driver for the server of the
+// configuration. The connection uses TLS (onsocssl) unless SSL is disabled.
+func buildInformixDSN(config *conf.ProjectConfig) string {
+	protocol := "onsocssl"
+	if config.SSL.SSLMode == "disable" {
+		protocol = "onsoctcp"
+	}
+
+	attributes := []string{
+		"DRIVER={IBM INFORMIX ODBC DRIVER}",
+		"HOST=" + config.Host,
+		fmt.Sprintf("SERVICE=%d", config.Port),
+		"SERVER=" + config.Server,
+		"PROTOCOL=" + protocol,
+		"DATABASE=" + config.Database,
+		"UID=" + config.User,
+		"PWD=" + odbcValue(config.Password),
+	}
+
+	return strings.Join(attributes, ";")
+}
+
+// odbcValue braces the value of an ODBC attribute containing separators, doubling its closing braces.
+func odbcValue(value string) string {
+	if !strings.ContainsAny(value, ";{}") {
+		return value
+	}
+	return "{" + strings.ReplaceAll(value, "}", "}}") + "}"
+}
+
+// connectToInformix opens the connection string with the ODBC driver of the binary, failing with the build
+// needed if it has none.
+func connectToInformix(dsn string) (*sql.DB, error) {
+	if !slices.Contains(sql.Drivers(), informix_odbc_driver) {
+		return nil, fmt.Errorf("the informix driver needs an ODBC database/sql driver registered as %q, "+
+			"build maestro with one (e.g. github.com/alexbrainman/odbc)", informix_odbc_driver)
+	}
+
+	return openAndPing(informix_odbc_driver, dsn)
+}
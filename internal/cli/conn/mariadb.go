@@ -0,0 +1,76 @@
+package conn
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/maestro-go/maestro/core/conf"
+)
+
+// connectToMariaDB opens a connection pool to the server of the given data source name
+// ("user:password@tcp(host:port)/database") and checks that it is reachable. Multiple statements are
+// always enabled, as migration scripts are sent at once. The sessions of read-only connections are read-only.
+func connectToMariaDB(dsn string, readOnly bool) (*sql.DB, error) {
+	mysqlConfig, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mariadb data source name: %w", err)
+	}
+
+	mysqlConfig.MultiStatements = true
+	mysqlConfig.ParseTime = true
+
+	if readOnly {
+		if mysqlConfig.Params == nil {
+			mysqlConfig.Params = map[string]string{}
+		}
+		mysqlConfig.Params["tx_read_only"] = "1"
+	}
+
+	connector, err := mysql.NewConnector(mysqlConfig)
+	if err != nil {
+		return nil, fmt.Errorf("database connection failed: %w", err)
+	}
+
+	db := sql.OpenDB(connector)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("database ping failed: %w", err)
+	}
+
+	return db, nil
+}
+
+// buildMariaDBDSN returns the data source name of the given database of the server of the configuration,
+// using TLS unless SSL is disabled.
+func buildMariaDBDSN(config *conf.ProjectConfig, database string) (string, error) {
+	mysqlConfig := mysql.NewConfig()
+	mysqlConfig.Net = "tcp"
+	mysqlConfig.Addr = net.JoinHostPort(config.Host, strconv.Itoa(int(config.Port)))
+	mysqlConfig.User = config.User
+	mysqlConfig.Passwd = config.Password
+	mysqlConfig.DBName = database
+
+	if config.SSL.SSLMode != "disable" {
+		tlsConfig, err := newTLSConfig(config)
+		if err != nil {
+			return "", err
+		}
+
+		// The TLS configuration is looked up by name when the data source name is parsed
+		err = mysql.RegisterTLSConfig("maestro", tlsConfig)
+		if err != nil {
+			return "", err
+		}
+		mysqlConfig.TLSConfig = "maestro"
+	}
+
+	return mysqlConfig.FormatDSN(), nil
+}
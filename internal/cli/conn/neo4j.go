@@ -0,0 +1,35 @@
+package conn
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/maestro-go/maestro/core/conf"
+	"github.com/maestro-go/maestro/core/database"
+	"github.com/maestro-go/maestro/core/database/neo4j"
+)
+
+// connectToNeo4j creates a repository for the configured database of the server of the given URL
+// and checks that it is reachable.
+func connectToNeo4j(ctx context.Context, config *conf.ProjectConfig, serverURL string) (database.Repository, func(), error) {
+	client, err := newHTTPClient(config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pingCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	err = neo4j.NewNeo4jRepository(pingCtx, client, serverURL, config.Database, nil).Ping()
+	if err != nil {
+		return nil, nil, fmt.Errorf("database ping failed: %w", err)
+	}
+
+	repo := neo4j.NewNeo4jRepository(ctx, client, serverURL, config.Database, &config.HistoryTable)
+
+	cleanup := func() {
+		client.CloseIdleConnections()
+	}
+
+	return repo, cleanup, nil
+}
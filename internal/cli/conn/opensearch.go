@@ -0,0 +1,34 @@
+package conn
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/maestro-go/maestro/core/conf"
+	"github.com/maestro-go/maestro/core/database"
+	"github.com/maestro-go/maestro/core/database/opensearch"
+)
+
+// connectToOpenSearch creates a repository for the cluster of the given URL and checks that it is reachable.
+func connectToOpenSearch(ctx context.Context, config *conf.ProjectConfig, clusterURL string) (database.Repository, func(), error) {
+	client, err := newHTTPClient(config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pingCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	err = opensearch.NewOpenSearchRepository(pingCtx, client, clusterURL, nil).Ping()
+	if err != nil {
+		return nil, nil, fmt.Errorf("database ping failed: %w", err)
+	}
+
+	repo := opensearch.NewOpenSearchRepository(ctx, client, clusterURL, &config.HistoryTable)
+
+	cleanup := func() {
+		client.CloseIdleConnections()
+	}
+
+	return repo, cleanup, nil
+}
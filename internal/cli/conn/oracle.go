@@ -0,0 +1,35 @@
+package conn
+
+import (
+	"github.com/maestro-go/maestro/core/conf"
+	go_ora "github.com/sijms/go-ora/v2"
+)
+
+// buildOracleURL returns the oracle:// URL of the server of the configuration. The database is the service
+// name, unless a SID is configured. The connection uses TLS unless SSL is disabled, and the certificate of
+// the server is only trusted without verification with the require mode, as with PostgreSQL.
+func buildOracleURL(config *conf.ProjectConfig) string {
+	options := map[string]string{}
+
+	service := config.Database
+	if config.SID != "" {
+		service = ""
+		options["SID"] = config.SID
+	}
+
+	switch config.SSL.SSLMode {
+	case "disable":
+	case "require":
+		options["SSL"] = "true"
+		options["SSL VERIFY"] = "false"
+	default:
+		options["SSL"] = "true"
+		options["SSL VERIFY"] = "true"
+	}
+
+	if len(options) == 0 {
+		options = nil
+	}
+
+	return go_ora.BuildUrl(config.Host, int(config.Port), service, config.User, config.Password, options)
+}
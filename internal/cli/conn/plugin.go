@@ -0,0 +1,98 @@
+package conn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/maestro-go/maestro/core/conf"
+	"github.com/maestro-go/maestro/core/database"
+	"github.com/maestro-go/maestro/core/database/plugin"
+)
+
+// plugin_shutdown_timeout is the time given to a plugin to exit after the shutdown request, before it is killed.
+const plugin_shutdown_timeout = 10 * time.Second
+
+// pluginConn is the standard output and input of a plugin.
+type pluginConn struct {
+	io.Reader
+	io.Writer
+}
+
+// connectToPlugin starts the binary maestro-driver-<plugin> of the PATH, with its standard error forwarded to
+// the one of maestro, and sends it the connection settings of the configuration, or the data source name if
+// not empty. The plugin creates the database if create-database is set.
+func connectToPlugin(ctx context.Context, config *conf.ProjectConfig, dsn string, readOnly bool) (database.Repository, func(), error) {
+	if config.Plugin == "" {
+		return nil, nil, errors.New("the plugin driver requires the name of the external driver in the plugin setting")
+	}
+
+	path, err := exec.LookPath(plugin.BINARY_PREFIX + config.Plugin)
+	if err != nil {
+		return nil, nil, fmt.Errorf("external driver %s not found: %w", config.Plugin, err)
+	}
+
+	cmd := exec.Command(path)
+	cmd.Stderr = os.Stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = cmd.Start()
+	if err != nil {
+		return nil, nil, fmt.Errorf("error starting external driver %s: %w", config.Plugin, err)
+	}
+
+	repo := plugin.NewPluginRepository(ctx, &pluginConn{Reader: stdout, Writer: stdin}, &config.HistoryTable)
+
+	cleanup := func() {
+		// The plugin exits on the shutdown request, or at the end of its input
+		repo.Shutdown()
+		stdin.Close()
+
+		exited := make(chan struct{})
+		go func() {
+			cmd.Wait()
+			close(exited)
+		}()
+
+		select {
+		case <-exited:
+		case <-time.After(plugin_shutdown_timeout):
+			cmd.Process.Kill()
+			<-exited
+		}
+	}
+
+	_, err = repo.Initialize(plugin.InitializeParams{
+		DSN:            dsn,
+		Host:           config.Host,
+		Port:           config.Port,
+		Database:       config.Database,
+		User:           config.User,
+		Password:       config.Password,
+		Schema:         config.Schema,
+		SSLMode:        config.SSL.SSLMode,
+		SSLRootCert:    config.SSL.SSLRootCert,
+		CreateDatabase: config.CreateDatabase,
+		ReadOnly:       readOnly,
+		Options:        config.PluginOptions,
+	})
+	if err != nil {
+		cleanup()
+		return nil, nil, fmt.Errorf("database connection failed: %w", err)
+	}
+
+	return repo, cleanup, nil
+}
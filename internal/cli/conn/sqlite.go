@@ -0,0 +1,76 @@
+package conn
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+
+	_ "modernc.org/sqlite"
+)
+
+// sqliteFiles are the suffixes of the files SQLite creates next to the database file while it is in use.
+var sqliteFiles = []string{"-journal", "-wal", "-shm"}
+
+// connectToSQLite opens the database file of the given path and checks that it is readable. The file must
+// exist, as it is created by CreateDatabase. Connections wait for up to 5 seconds for the locks of other
+// connections, and the foreign keys are enforced. Read-only connections open the file read-only.
+func connectToSQLite(path string, readOnly bool) (*sql.DB, error) {
+	// SQLite reports missing files as out of memory
+	_, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("database file %s does not exist, create it with db create or create-database", path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	mode := "rw"
+	if readOnly {
+		mode = "ro"
+	}
+
+	params := url.Values{}
+	params.Set("mode", mode)
+	params.Add("_pragma", "busy_timeout(5000)")
+	params.Add("_pragma", "foreign_keys(1)")
+
+	return openAndPing("sqlite", "file:"+path+"?"+params.Encode())
+}
+
+// createSQLiteDatabase creates the empty database file of the given path, a valid SQLite database, if it
+// does not exist. Returns true if the file was created.
+func createSQLiteDatabase(path string) (bool, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if errors.Is(err, fs.ErrExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, file.Close()
+}
+
+// dropSQLiteDatabase deletes the database file of the given path, and the journal files left next to it.
+// Returns true if the database file was deleted.
+func dropSQLiteDatabase(path string) (bool, error) {
+	err := os.Remove(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	for _, suffix := range sqliteFiles {
+		err = os.Remove(path + suffix)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return true, err
+		}
+	}
+
+	return true, nil
+}
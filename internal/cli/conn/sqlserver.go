@@ -0,0 +1,90 @@
+package conn
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/maestro-go/maestro/core/conf"
+	"github.com/maestro-go/maestro/core/database/sqlserver"
+	_ "github.com/microsoft/go-mssqldb"
+	"github.com/microsoft/go-mssqldb/azuread"
+)
+
+// auth_azure_ad is the auth setting authenticating with Azure AD tokens instead of the user and password.
+const auth_azure_ad = "azure-ad"
+
+// connectToSQLServer connects to the given database of the server of the configuration. Connecting is retried
+// on the transient errors of Azure SQL, e.g. while the database is resumed or fails over.
+func connectToSQLServer(config *conf.ProjectConfig, database string) (*sql.DB, error) {
+	driverName := "sqlserver"
+	switch config.Auth {
+	case "":
+	case auth_azure_ad:
+		driverName = azuread.DriverName
+	default:
+		return nil, fmt.Errorf("unsupported auth %q, expected %s", config.Auth, auth_azure_ad)
+	}
+
+	db, err := sql.Open(driverName, buildSQLServerURL(config, database))
+	if err != nil {
+		return nil, fmt.Errorf("database connection failed: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	err = sqlserver.Retry(ctx, func() error {
+		pingCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+		return db.PingContext(pingCtx)
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("database ping failed: %w", err)
+	}
+
+	return db, nil
+}
+
+// buildSQLServerURL returns the sqlserver:// URL of the given database of the server of the configuration.
+// The connection is encrypted unless SSL is disabled, and the certificate of the server is only trusted
+// without verification with the require mode, as with PostgreSQL. With Azure AD authentication, the token is
+// requested with the default credential chain of the Azure SDK (environment, workload identity, managed
+// identity or Azure CLI), and the user and password are not sent.
+func buildSQLServerURL(config *conf.ProjectConfig, database string) string {
+	params := url.Values{}
+	params.Set("database", database)
+	params.Set("app name", "maestro")
+
+	switch config.SSL.SSLMode {
+	case "disable":
+		params.Set("encrypt", "disable")
+	case "require":
+		params.Set("encrypt", "true")
+		params.Set("TrustServerCertificate", "true")
+	default:
+		params.Set("encrypt", "true")
+		if config.SSL.SSLRootCert != "" {
+			params.Set("certificate", config.SSL.SSLRootCert)
+		}
+	}
+
+	user := url.UserPassword(config.User, config.Password)
+	if config.Auth == auth_azure_ad {
+		params.Set("fedauth", azuread.ActiveDirectoryDefault)
+		user = nil
+	}
+
+	serverURL := url.URL{
+		Scheme:   "sqlserver",
+		User:     user,
+		Host:     net.JoinHostPort(config.Host, strconv.Itoa(int(config.Port))),
+		RawQuery: params.Encode(),
+	}
+
+	return serverURL.String()
+}
@@ -1,16 +1,25 @@
 package cli
 
 import (
+	"bufio"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/maestro-go/maestro/core/conf"
+	"github.com/maestro-go/maestro/core/remote"
 	"github.com/maestro-go/maestro/internal/cli/flags"
 	internalConf "github.com/maestro-go/maestro/internal/conf"
 	"github.com/maestro-go/maestro/internal/filesystem"
+	"github.com/maestro-go/maestro/internal/migrations"
 	"github.com/maestro-go/maestro/internal/utils/logger"
 	"github.com/spf13/cobra"
 	"go.uber.org/zap"
@@ -24,7 +33,24 @@ func SetupCreateCommand() *cobra.Command {
 
 This command performs the following:
 1. Determines the next version number by scanning existing migration files in the configured migration directories.
-2. Creates a new placeholder migration file, in the first given migration location, with the format "VXXX_migration_name.sql", where XXX is the next version number.`,
+2. Creates a new placeholder migration file, in the first given migration location (or the one given with --dir), with the format "VXXX_migration_name.sql", where XXX is the next version number.
+
+If the location has a version range (version-ranges), the next version is the one following the latest version of
+the range, and locations without range take the versions out of the ranges, so teams owning locations do not
+collide on the next number.
+
+When a template is given with --from-template, the migration is pre-filled with the rendered template instead of the placeholder.
+Template arguments are taken from --template-arg, in order, and missing required arguments are prompted.
+
+SQL migrations start with a header recording their author (the author of the project configuration, or the git
+user), the creation date and the ticket given with --ticket. The author and the ticket are recorded in the schema
+history table when the migration is applied.
+
+The paths of the created files are printed to stdout, one per line, or as a JSON object with --format json,
+so scripts and editor plugins can open them. Logs are written to stderr.
+
+With --edit, the created files are opened in the editor of the project configuration (editor), $VISUAL or $EDITOR,
+in this order, or vi, and the command returns once the editor exits.`,
 		Args: cobra.ExactArgs(1),
 		RunE: runCreateCommand,
 	}
@@ -32,10 +58,30 @@ This command performs the following:
 	createCmd.Flags().SortFlags = false
 
 	createCmd.Flags().BoolP("with-down", "d", false, "Generates a down migration too.")
+	createCmd.Flags().StringP("from-template", "t", "", "Template used to pre-fill the migration.")
+	createCmd.Flags().StringArrayP("template-arg", "a", []string{}, "Template argument, in parameter order.")
+	createCmd.Flags().String("ticket", "", "Ticket ID written in the header of the migration, e.g. OPS-123.")
+	createCmd.Flags().String("format", create_format_text, "Format of the created files printed to stdout (text or json).")
+	createCmd.Flags().BoolP("edit", "e", false, "Opens the created files in the editor.")
+	createCmd.Flags().String("dir", "", "Migration location of the created files, the first one if empty.")
 
 	return createCmd
 }
 
+// Formats of the files printed by the create command
+const (
+	create_format_text = "text"
+	create_format_json = "json"
+)
+
+// createdMigration describes the files written by the create command, printed as JSON with --format json.
+type createdMigration struct {
+	Version  uint16 `json:"version"`
+	Name     string `json:"name"`
+	Path     string `json:"path"`
+	DownPath string `json:"down_path,omitempty"`
+}
+
 func runCreateCommand(cmd *cobra.Command, args []string) error {
 	logger, err := logger.NewLogger()
 	if err != nil {
@@ -49,6 +95,21 @@ func runCreateCommand(cmd *cobra.Command, args []string) error {
 		return errors.New("migration name must not be empty")
 	}
 
+	format, err := cmd.Flags().GetString("format")
+	if err == nil && format != create_format_text && format != create_format_json {
+		err = fmt.Errorf("unknown format %s, expected %s or %s", format, create_format_text, create_format_json)
+	}
+	if err != nil {
+		logError(logger, ErrReadFormatFlag, err)
+		return genError(ErrReadFormatFlag, err)
+	}
+
+	edit, err := cmd.Flags().GetBool("edit")
+	if err != nil {
+		logError(logger, ErrReadEditFlag, err)
+		return genError(ErrReadEditFlag, err)
+	}
+
 	globalFlags, err := flags.ExtractGlobalFlags(cmd)
 	if err != nil {
 		logError(logger, ErrExtractGlobalFlags, err)
@@ -79,16 +140,74 @@ func runCreateCommand(cmd *cobra.Command, args []string) error {
 		projectConfig.Migration.Locations = globalFlags.MigrationLocations
 	}
 
-	latestVersion, err := filesystem.GetLatestVersionFromFiles(projectConfig.Migration.Locations)
+	extension := projectConfig.FileExtension()
+
+	location, err := cmd.Flags().GetString("dir")
+	if err == nil && location != "" && !slices.ContainsFunc(projectConfig.Migration.Locations, func(configured string) bool {
+		return filepath.Clean(configured) == filepath.Clean(location)
+	}) {
+		err = fmt.Errorf("%s is not a migration location", location)
+	}
+	if err != nil {
+		logError(logger, ErrReadDirFlag, err)
+		return genError(ErrReadDirFlag, err)
+	}
+
+	if location == "" {
+		location = projectConfig.Migration.Locations[0]
+	}
+
+	if remote.IsBucketURL(location) {
+		err = fmt.Errorf("%s is a remote location, migrations are created in local locations", location)
+		logError(logger, ErrReadDirFlag, err)
+		return genError(ErrReadDirFlag, err)
+	}
+
+	version, err := nextVersion(&projectConfig.Migration, location, extension)
 	if err != nil {
 		logError(logger, ErrGetLatestVersion, err)
 		return genError(ErrGetLatestVersion, err)
 	}
 
-	newMigrationPath := filepath.Join(projectConfig.Migration.Locations[0],
-		fmt.Sprintf("V%.3d_%s.sql", latestVersion+1, migrationName))
+	newMigrationPath := filepath.Join(location, fmt.Sprintf("V%.3d_%s.%s", version, migrationName, extension))
+
+	ticket, err := cmd.Flags().GetString("ticket")
+	if err != nil {
+		logError(logger, ErrReadTicketFlag, err)
+		return genError(ErrReadTicketFlag, err)
+	}
+
+	// The placeholder and the header are SQL comments, files of other languages are created empty
+	placeholder := ""
+	header := ""
+	if extension == "sql" {
+		placeholder = internalConf.NEW_MIGRATION_PLACEHOLDER
+		header = migrationHeader(migrationAuthor(projectConfig.Author, globalFlags.Location), time.Now(), ticket)
+	}
+
+	migrationContent := placeholder
+
+	fromTemplate, err := cmd.Flags().GetString("from-template")
+	if err != nil {
+		logError(logger, ErrReadFromTemplateFlag, err)
+		return genError(ErrReadFromTemplateFlag, err)
+	}
+
+	if fromTemplate != "" {
+		templateArgs, err := cmd.Flags().GetStringArray("template-arg")
+		if err != nil {
+			logError(logger, ErrReadFromTemplateFlag, err)
+			return genError(ErrReadFromTemplateFlag, err)
+		}
 
-	err = os.WriteFile(newMigrationPath, []byte(internalConf.NEW_MIGRATION_PLACEHOLDER), os.ModePerm)
+		migrationContent, err = renderMigrationTemplate(cmd, &projectConfig.Migration, fromTemplate, templateArgs)
+		if err != nil {
+			logError(logger, ErrRenderTemplate, err)
+			return genError(ErrRenderTemplate, err)
+		}
+	}
+
+	err = os.WriteFile(newMigrationPath, []byte(header+migrationContent), os.ModePerm)
 	if err != nil {
 		logError(logger, ErrWriteMigration, err)
 		return genError(ErrWriteMigration, err)
@@ -100,19 +219,196 @@ func runCreateCommand(cmd *cobra.Command, args []string) error {
 		return genError(ErrReadWithDownFlag, err)
 	}
 
+	created := &createdMigration{
+		Version: version,
+		Name:    migrationName,
+		Path:    newMigrationPath,
+	}
+
 	if withDown {
-		newDownMigrationPath := filepath.Join(projectConfig.Migration.Locations[0],
-			fmt.Sprintf("V%.3d_%s.down.sql", latestVersion+1, migrationName))
+		newDownMigrationPath := filepath.Join(location, fmt.Sprintf("V%.3d_%s.down.%s", version, migrationName, extension))
 
-		err = os.WriteFile(newDownMigrationPath, []byte(internalConf.NEW_MIGRATION_PLACEHOLDER), os.ModePerm)
+		err = os.WriteFile(newDownMigrationPath, []byte(header+placeholder), os.ModePerm)
 		if err != nil {
 			logError(logger, ErrWriteMigration, err)
 			return genError(ErrWriteMigration, err)
 		}
+
+		created.DownPath = newDownMigrationPath
 	}
 
-	logger.Info("migration created successfully", zap.Uint16("version", latestVersion+1),
+	logger.Info("migration created successfully", zap.Uint16("version", version),
 		zap.String("name", migrationName))
 
+	if edit {
+		paths := []string{created.Path}
+		if created.DownPath != "" {
+			paths = append(paths, created.DownPath)
+		}
+
+		err = openInEditor(cmd, editorCommand(projectConfig.Editor), paths)
+		if err != nil {
+			logError(logger, ErrOpenEditor, err)
+			return genError(ErrOpenEditor, err)
+		}
+	}
+
+	err = writeCreatedMigration(cmd.OutOrStdout(), created, format)
+	if err != nil {
+		logError(logger, ErrWriteOutput, err)
+		return genError(ErrWriteOutput, err)
+	}
+
+	return nil
+}
+
+// nextVersion returns the version of a migration created in the location: the one following the latest version
+// of its version range, or of the versions out of the ranges if it has none.
+func nextVersion(config *conf.MigrationConfig, location string, extension string) (uint16, error) {
+	versionRanges, err := migrations.ParseVersionRanges(config.Locations, config.VersionRanges)
+	if err != nil {
+		return 0, err
+	}
+
+	versions, err := filesystem.GetVersionsFromFiles(config.Locations, extension)
+	if err != nil {
+		return 0, err
+	}
+
+	return versionRanges.NextVersion(location, versions)
+}
+
+// writeCreatedMigration writes the paths of the created files, one per line, or as a JSON object.
+func writeCreatedMigration(out io.Writer, created *createdMigration, format string) error {
+	if format == create_format_json {
+		return json.NewEncoder(out).Encode(created)
+	}
+
+	_, err := fmt.Fprintln(out, created.Path)
+	if err != nil || created.DownPath == "" {
+		return err
+	}
+
+	_, err = fmt.Fprintln(out, created.DownPath)
+	return err
+}
+
+// migrationHeader returns the header lines of a created migration, with the author and the ticket if known.
+func migrationHeader(author string, date time.Time, ticket string) string {
+	header := strings.Builder{}
+	if author != "" {
+		fmt.Fprintf(&header, "-- maestro:author %s\n", author)
+	}
+	fmt.Fprintf(&header, "-- maestro:date %s\n", date.Format(time.DateOnly))
+	if ticket != "" {
+		fmt.Fprintf(&header, "-- maestro:ticket %s\n", ticket)
+	}
+	header.WriteString("\n")
+	return header.String()
+}
+
+// migrationAuthor returns the configured author, or the git user of the project directory as "name <email>".
+// It is empty if neither is known.
+func migrationAuthor(configured string, dir string) string {
+	if configured != "" {
+		return configured
+	}
+
+	gitConfig := func(key string) string {
+		gitCmd := exec.Command("git", "config", key)
+		gitCmd.Dir = dir
+		out, err := gitCmd.Output()
+		if err != nil {
+			return ""
+		}
+		return strings.TrimSpace(string(out))
+	}
+
+	name, email := gitConfig("user.name"), gitConfig("user.email")
+	switch {
+	case name == "":
+		return email
+	case email == "":
+		return name
+	default:
+		return fmt.Sprintf("%s <%s>", name, email)
+	}
+}
+
+// editorCommand returns the command of the editor opening the created files: the configured one, $VISUAL,
+// $EDITOR, or vi. The command may have arguments, e.g. "code --wait".
+func editorCommand(configured string) []string {
+	for _, editor := range []string{configured, os.Getenv("VISUAL"), os.Getenv("EDITOR")} {
+		if fields := strings.Fields(editor); len(fields) > 0 {
+			return fields
+		}
+	}
+	return []string{"vi"}
+}
+
+// openInEditor opens the files in the editor, on the terminal of the command, and waits for it to exit.
+func openInEditor(cmd *cobra.Command, editor []string, paths []string) error {
+	editorCmd := exec.Command(editor[0], append(editor[1:], paths...)...)
+	editorCmd.Stdin = cmd.InOrStdin()
+	editorCmd.Stdout = cmd.OutOrStdout()
+	editorCmd.Stderr = cmd.ErrOrStderr()
+
+	err := editorCmd.Run()
+	if err != nil {
+		return fmt.Errorf("editor %s: %w", editor[0], err)
+	}
 	return nil
 }
+
+// renderMigrationTemplate renders the given template with the given arguments.
+// Required template parameters without an argument are prompted from the command input, the parameters with a
+// default before them get an empty argument to use it.
+func renderMigrationTemplate(cmd *cobra.Command, config *conf.MigrationConfig, templateName string,
+	args []string) (string, error) {
+	templates, errs := filesystem.LoadTemplates(config.Locations)
+	if len(errs) > 0 {
+		return "", errors.Join(errs...)
+	}
+
+	templates = migrations.WithBuiltinTemplates(templates, config.Driver)
+
+	var template *migrations.Template
+	for _, t := range templates {
+		if t.Name == templateName {
+			template = t
+			break
+		}
+	}
+
+	if template == nil {
+		return "", fmt.Errorf("template %s not found", templateName)
+	}
+
+	scanner := bufio.NewScanner(cmd.InOrStdin())
+	for _, parameter := range template.Parameters() {
+		if parameter.Index <= len(args) || parameter.Default != nil {
+			continue
+		}
+
+		// Earlier positions are required parameters already given, or take their default from an empty argument
+		for len(args) < parameter.Index-1 {
+			args = append(args, "")
+		}
+
+		// Prompts go to stderr, stdout only has the created files
+		fmt.Fprintf(cmd.ErrOrStderr(), "Value for %s $%d: ", templateName, parameter.Index)
+		if !scanner.Scan() {
+			return "", fmt.Errorf("missing value for %s $%d", templateName, parameter.Index)
+		}
+		args = append(args, strings.TrimSpace(scanner.Text()))
+	}
+
+	content := fmt.Sprintf("{{%s}}", strings.Join(append([]string{templateName}, args...), ", "))
+
+	err := migrations.ParseTemplates(&content, templates)
+	if err != nil {
+		return "", err
+	}
+
+	return content, nil
+}
@@ -0,0 +1,38 @@
+package cli
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/maestro-go/maestro/core/conf"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderMigrationTemplatePromptsRequiredOnly(t *testing.T) {
+	migrationsDir := t.TempDir()
+	err := os.WriteFile(filepath.Join(migrationsDir, "table.template.sql"),
+		[]byte("CREATE TABLE $1 (name VARCHAR($2:=10), kind VARCHAR($3));"), os.ModePerm)
+	require.NoError(t, err)
+
+	config := &conf.MigrationConfig{Driver: "postgres", Locations: []string{migrationsDir}}
+
+	cmd := &cobra.Command{}
+	stderr := &bytes.Buffer{}
+	cmd.SetIn(strings.NewReader("16\n"))
+	cmd.SetErr(stderr)
+
+	// $2 has a default, only $3 is prompted
+	content, err := renderMigrationTemplate(cmd, config, "table", []string{"orders"})
+	require.NoError(t, err)
+	assert.Equal(t, "CREATE TABLE orders (name VARCHAR(10), kind VARCHAR(16));", content)
+	assert.Equal(t, "Value for table $3: ", stderr.String())
+
+	cmd.SetIn(strings.NewReader(""))
+	_, err = renderMigrationTemplate(cmd, config, "table", []string{"orders"})
+	assert.EqualError(t, err, "missing value for table $3")
+}
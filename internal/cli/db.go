@@ -0,0 +1,146 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	_ "github.com/lib/pq"
+	"github.com/maestro-go/maestro/core/enums"
+	"github.com/maestro-go/maestro/internal/cli/conn"
+	"github.com/maestro-go/maestro/internal/cli/flags"
+	"github.com/maestro-go/maestro/internal/utils/logger"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+func SetupDBCommand() *cobra.Command {
+	dbCmd := &cobra.Command{
+		Use:   "db",
+		Short: "Manage the configured database",
+		Long:  `Create or drop the configured database through the maintenance database of the driver.`,
+	}
+
+	createCmd := &cobra.Command{
+		Use:   "create",
+		Short: "Create the database if it does not exist",
+		Long: `Connect to the maintenance database of the driver ("postgres" for PostgreSQL, "defaultdb" for CockroachDB)
+and create the configured database if it does not exist.
+
+Set "create-database: true" in the project file to do this automatically before connecting.`,
+		RunE: runDBCreateCommand,
+	}
+
+	createCmd.Flags().SortFlags = false
+	flags.SetupDBConfigFlags(createCmd)
+
+	dropCmd := &cobra.Command{
+		Use:   "drop",
+		Short: "Drop the database",
+		Long: `Connect to the maintenance database of the driver and drop the configured database if it exists.
+
+The command requires --force, and refuses to run against protected databases ("protected: true").`,
+		RunE: runDBDropCommand,
+	}
+
+	dropCmd.Flags().SortFlags = false
+	dropCmd.Flags().Bool("force", false, "Confirm that the database should be dropped.")
+	flags.SetupDBConfigFlags(dropCmd)
+
+	dbCmd.AddCommand(createCmd, dropCmd)
+
+	return dbCmd
+}
+
+func runDBCreateCommand(cmd *cobra.Command, args []string) error {
+	logger, err := logger.NewLogger()
+	if err != nil {
+		log.Fatal(err)
+		return err
+	}
+
+	ctx := context.Background()
+
+	projectConfig, removeLocations, err := loadProjectConfig(cmd, logger)
+	if err != nil {
+		return err
+	}
+	defer removeLocations()
+
+	driver, ok := enums.MapStringToDriverType[projectConfig.Driver]
+	if !ok {
+		logError(logger, ErrInvalidDriver, errors.New(projectConfig.Driver))
+		return genError(ErrInvalidDriver, errors.New(projectConfig.Driver))
+	}
+
+	created, err := conn.CreateDatabase(ctx, projectConfig, driver)
+	if err != nil {
+		logError(logger, ErrCreateDatabase, err)
+		return genError(ErrCreateDatabase, err)
+	}
+
+	if !created {
+		logger.Info("Database already exists", zap.String("database", projectConfig.Database))
+		return nil
+	}
+
+	logger.Info("Database created successfully", zap.String("database", projectConfig.Database))
+
+	return nil
+}
+
+func runDBDropCommand(cmd *cobra.Command, args []string) error {
+	logger, err := logger.NewLogger()
+	if err != nil {
+		log.Fatal(err)
+		return err
+	}
+
+	ctx := context.Background()
+
+	projectConfig, removeLocations, err := loadProjectConfig(cmd, logger)
+	if err != nil {
+		return err
+	}
+	defer removeLocations()
+
+	err = checkNotProtected(projectConfig, "db drop")
+	if err != nil {
+		logError(logger, ErrProtectedDatabase, err)
+		return genError(ErrProtectedDatabase, err)
+	}
+
+	force, err := cmd.Flags().GetBool("force")
+	if err != nil {
+		logError(logger, ErrReadForceFlag, err)
+		return genError(ErrReadForceFlag, err)
+	}
+
+	if !force {
+		err = fmt.Errorf("dropping database %s requires --force", projectConfig.Database)
+		logError(logger, ErrConfirmation, err)
+		return genError(ErrConfirmation, err)
+	}
+
+	driver, ok := enums.MapStringToDriverType[projectConfig.Driver]
+	if !ok {
+		logError(logger, ErrInvalidDriver, errors.New(projectConfig.Driver))
+		return genError(ErrInvalidDriver, errors.New(projectConfig.Driver))
+	}
+
+	dropped, err := conn.DropDatabase(ctx, projectConfig, driver)
+	if err != nil {
+		logError(logger, ErrDropDatabase, err)
+		return genError(ErrDropDatabase, err)
+	}
+
+	if !dropped {
+		logger.Info("Database does not exist", zap.String("database", projectConfig.Database))
+		return nil
+	}
+
+	logger.Info("Database dropped successfully", zap.String("database", projectConfig.Database))
+
+	return nil
+}
@@ -0,0 +1,30 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/maestro-go/maestro/core/migrator"
+)
+
+// Formats of the error report of a failed run
+const (
+	error_format_text = "text"
+	error_format_json = "json"
+)
+
+// writeErrorReport writes the errors of a failed run grouped by migration version, as indented text or JSON,
+// and returns their report.
+func writeErrorReport(out io.Writer, result *migrator.MigrationResult, runErr error, format string) (*migrator.ErrorReport, error) {
+	report := migrator.NewErrorReport(result, runErr)
+
+	if format == error_format_json {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return report, encoder.Encode(report)
+	}
+
+	_, err := fmt.Fprint(out, report.String())
+	return report, err
+}
@@ -34,7 +34,81 @@ var (
 	ErrConnectToDatabase       = "Error connecting to the database"
 	ErrLoadMigrations          = "Error loading migrations"
 	ErrRepairMigration         = "Error repairing migration"
-	ErrGetFailingMigrations    = "Error getting failing migrations"
+	ErrGetAppliedMigrations    = "Error getting applied migrations"
 	ErrInvalidDriver           = "Invalid database driver"
 	ErrValidation              = "Validation error"
+	ErrLoadTemplates           = "Error loading templates"
+	ErrReadFromTemplateFlag    = "Error reading from-template flags"
+	ErrRenderTemplate          = "Error rendering template"
+	ErrReadEnvFlag             = "Error reading env flag"
+	ErrSeed                    = "Error executing seeds"
+	ErrProtectedDatabase       = "Protected database"
+	ErrConfirmation            = "Confirmation error"
+	ErrClean                   = "Error cleaning database"
+	ErrReadVersionFlag         = "Error reading version flag"
+	ErrRedo                    = "Error redoing migrations"
+	ErrUI                      = "Error running interactive interface"
+	ErrCreateDatabase          = "Error creating database"
+	ErrDropDatabase            = "Error dropping database"
+	ErrReadForceFlag           = "Error reading force flag"
+	ErrReadCanaryFlag          = "Error reading canary flag"
+	ErrCanary                  = "Canary migration error"
+	ErrServerInfo              = "Error getting server information"
+	ErrGetLockInfo             = "Error getting lock information"
+	ErrReadResumeFlag          = "Error reading resume flag"
+	ErrReadResumeFile          = "Error reading resume file"
+	ErrWriteResumeFile         = "Error writing resume file"
+	ErrMigrationNotFound       = "Migration not found"
+	ErrReadLocalFlag           = "Error reading local flag"
+	ErrReadDownFlag            = "Error reading down flag"
+	ErrRenderFile              = "Error rendering file"
+	ErrReadNoteFlag            = "Error reading note flag"
+	ErrAnnotate                = "Error annotating migration"
+	ErrReadErrorFormatFlag     = "Error reading error-format flag"
+	ErrReadExitZeroFlag        = "Error reading exit-zero-on-no-pending flag"
+	ErrReadTerminationLogFlag  = "Error reading termination-log flag"
+	ErrWriteTerminationLog     = "Error writing the termination log"
+	ErrCheckPending            = "Error checking the pending migrations"
+	ErrWriteErrorReport        = "Error writing error report"
+	ErrReadCompareFlag         = "Error reading compare flag"
+	ErrCompare                 = "Error comparing with the other database"
+	ErrReadHistoryFlag         = "Error reading history flag"
+	ErrReadAtFlag              = "Error reading at flag"
+	ErrSnapshot                = "Error finding the status at the given time"
+	ErrReadTargetFlag          = "Error reading target flag"
+	ErrReadArchiveFlag         = "Error reading archive flag"
+	ErrReproduce               = "Error reproducing the database"
+	ErrReadReplaceFlag         = "Error reading replace flag"
+	ErrCopyHistoryTable        = "Error copying the schema history table"
+	ErrSyncHistoryTable        = "Error syncing the previous history table"
+	ErrReadFromFlag            = "Error reading from flag"
+	ErrOrder                   = "Error computing the execution order"
+	ErrVersionHoles            = "Missing versions found"
+	ErrReadFormatFlag          = "Error reading format flag"
+	ErrWriteOutput             = "Error writing output"
+	ErrReadEditFlag            = "Error reading edit flag"
+	ErrOpenEditor              = "Error opening the editor"
+	ErrReadTicketFlag          = "Error reading ticket flag"
+	ErrReadDirFlag             = "Error reading dir flag"
+	ErrReadMaxCostFlag         = "Error reading max-cost flag"
+	ErrReadMaxScanRowsFlag     = "Error reading max-scan-rows flag"
+	ErrExplain                 = "Error explaining pending migrations"
+	ErrExplainThresholds       = "Statements above the explain thresholds"
+	ErrConfigureBackup         = "Error configuring the backup"
+	ErrReadBackupFlag          = "Error reading backup flag"
+	ErrReadBackup              = "Error reading the backup"
+	ErrRestore                 = "Error restoring the backup"
+	ErrReadNamespaceFlag       = "Error reading namespace flag"
+	ErrReadResourceFlag        = "Error reading resource flag"
+	ErrReadIntervalFlag        = "Error reading interval flag"
+	ErrReadOnceFlag            = "Error reading once flag"
+	ErrReadAPIServerFlag       = "Error reading api-server flag"
+	ErrStartOperator           = "Error starting the operator"
+	ErrReconcile               = "Error reconciling the resources"
+	ErrReadOutputFlag          = "Error reading output flag"
+	ErrPlan                    = "Error planning the migrations"
+	ErrBaseline                = "Error baselining the database"
+	ErrReadBaseFlag            = "Error reading base flag"
+	ErrChangedFiles            = "Error listing the changed files"
+	ErrFetchRemoteLocations    = "Error fetching the remote migration locations"
 )
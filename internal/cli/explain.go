@@ -0,0 +1,148 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+
+	"github.com/maestro-go/maestro/core/enums"
+	"github.com/maestro-go/maestro/core/migrator"
+	"github.com/maestro-go/maestro/internal/cli/conn"
+	"github.com/maestro-go/maestro/internal/cli/flags"
+	"github.com/maestro-go/maestro/internal/utils/logger"
+	"github.com/spf13/cobra"
+)
+
+// explain_excerpt_length is the number of characters of a statement printed by the explain command.
+const explain_excerpt_length = 60
+
+func SetupExplainCommand() *cobra.Command {
+	explainCmd := &cobra.Command{
+		Use:   "explain",
+		Short: "Estimate the cost of the DML statements of the pending migrations",
+		Long: `The explain command runs EXPLAIN, without executing anything, for the DML statements (INSERT, UPDATE,
+DELETE, MERGE) of the migrations the migrate command would apply, and prints the cost estimated by the planner
+and the full scans of tables of each statement. Statements costing more than --max-cost, or scanning a table
+with more rows than --max-scan-rows according to its statistics, are flagged and make the command fail, so
+expensive backfills are found before the deploy window starts. Statements the planner rejects, e.g. on a table
+created by a previous pending migration, are reported but not flagged. The database is only read.
+Only the PostgreSQL and Greenplum drivers can explain statements.`,
+		RunE: runExplainCommand,
+	}
+
+	explainCmd.Flags().SortFlags = false
+	flags.SetupDBConfigFlags(explainCmd)
+	flags.SetupMigrationConfigFlags(explainCmd)
+	explainCmd.Flags().Float64("max-cost", 0, "Planner cost above which a statement is flagged (0 to disable).")
+	explainCmd.Flags().Float64("max-scan-rows", 0, "Rows of a table above which its full scan is flagged (0 to disable).")
+
+	return explainCmd
+}
+
+func runExplainCommand(cmd *cobra.Command, args []string) error {
+	logger, err := logger.NewLogger()
+	if err != nil {
+		log.Fatal(err)
+		return err
+	}
+
+	ctx := context.Background()
+
+	projectConfig, removeLocations, err := loadProjectConfig(cmd, logger)
+	if err != nil {
+		return err
+	}
+	defer removeLocations()
+
+	if cmd.Flags().Changed("max-cost") {
+		projectConfig.Migration.ExplainMaxCost, err = cmd.Flags().GetFloat64("max-cost")
+		if err != nil {
+			logError(logger, ErrReadMaxCostFlag, err)
+			return genError(ErrReadMaxCostFlag, err)
+		}
+	}
+
+	if cmd.Flags().Changed("max-scan-rows") {
+		projectConfig.Migration.ExplainMaxScanRows, err = cmd.Flags().GetFloat64("max-scan-rows")
+		if err != nil {
+			logError(logger, ErrReadMaxScanRowsFlag, err)
+			return genError(ErrReadMaxScanRowsFlag, err)
+		}
+	}
+
+	driver, ok := enums.MapStringToDriverType[projectConfig.Driver]
+	if !ok {
+		logError(logger, ErrInvalidDriver, errors.New(projectConfig.Driver))
+		return genError(ErrInvalidDriver, errors.New(projectConfig.Driver))
+	}
+
+	repo, cleanup, err := conn.ConnectToDatabaseReadOnly(ctx, projectConfig, driver)
+	if err != nil {
+		logError(logger, ErrConnectToDatabase, err)
+		return genError(ErrConnectToDatabase, err)
+	}
+	defer cleanup()
+
+	explained, err := migrator.NewMigrator(logger, repo, &projectConfig.Migration).Explain()
+	if err != nil {
+		logError(logger, ErrExplain, err)
+		return genError(ErrExplain, err)
+	}
+
+	flagged := writeExplainedStatements(cmd.OutOrStdout(), explained)
+	if flagged > 0 {
+		err = fmt.Errorf("%d of %d statements flagged", flagged, len(explained))
+		logError(logger, ErrExplainThresholds, err)
+		return genError(ErrExplainThresholds, err)
+	}
+
+	return nil
+}
+
+// writeExplainedStatements writes the estimate of each statement with its flags, and returns the number of
+// flagged statements.
+func writeExplainedStatements(out io.Writer, explained []*migrator.ExplainedStatement) int {
+	if len(explained) == 0 {
+		fmt.Fprintln(out, "No DML statements in the pending migrations")
+		return 0
+	}
+
+	flagged := 0
+	for _, statement := range explained {
+		fmt.Fprintf(out, "Version %d %s, statement %d: %s\n", statement.Version, statement.Description,
+			statement.Index, statementExcerpt(statement.Statement))
+
+		if statement.Err != nil {
+			fmt.Fprintf(out, "  not explained: %v\n", statement.Err)
+			continue
+		}
+
+		fmt.Fprintf(out, "  cost %.2f, %.0f rows\n", statement.Cost, statement.Rows)
+		for _, scan := range statement.Scans {
+			fmt.Fprintf(out, "  full scan of %s (%.0f rows)\n", scan.Table, scan.Rows)
+		}
+
+		for _, flag := range statement.Flags {
+			fmt.Fprintf(out, "  FLAGGED: %s\n", flag)
+		}
+		if len(statement.Flags) > 0 {
+			flagged++
+		}
+	}
+
+	fmt.Fprintf(out, "%d statements explained, %d flagged\n", len(explained), flagged)
+
+	return flagged
+}
+
+// statementExcerpt returns the beginning of the statement on a single line.
+func statementExcerpt(statement string) string {
+	excerpt := strings.Join(strings.Fields(statement), " ")
+	if len(excerpt) > explain_excerpt_length {
+		return excerpt[:explain_excerpt_length] + "..."
+	}
+	return excerpt
+}
@@ -15,6 +15,15 @@ func SetupDBConfigFlags(cmd *cobra.Command) {
 	cmd.Flags().String("password", "postgres", "Database password.")
 	cmd.Flags().String("schema", "public", "Database schema.")
 	cmd.Flags().String("history-table", "schema_history", "Schema history table name")
+	cmd.Flags().String("seed-history-table", "seed_history", "Seed history table name")
+	cmd.Flags().String("data-history-table", "data_history", "Data migrations history table name")
+	cmd.Flags().Bool("create-database", false, "Create the database if it does not exist.")
+	cmd.Flags().Bool("single-connection", false, "Run the lock, validation and migrations on a single pinned connection.")
+	cmd.Flags().String("http-path", "", "HTTP path of the SQL warehouse (e.g., /sql/1.0/warehouses/<id>).")
+	cmd.Flags().String("sid", "", "Oracle system identifier (SID) to connect to, instead of the service name of --database.")
+	cmd.Flags().String("server", "", "Informix database server name (INFORMIXSERVER) of the instance.")
+	cmd.Flags().String("auth", "", "Authentication of the sqlserver driver: azure-ad for Azure AD tokens instead of the user and password.")
+	cmd.Flags().String("plugin", "", "External driver of the plugin driver, run as the binary maestro-driver-<plugin> of the PATH.")
 
 	// SSLConfig flags
 	cmd.Flags().String("sslmode", "disable", "SSL mode for the database connection.")
@@ -65,6 +74,51 @@ func ExtractDBConfigFlags(cmd *cobra.Command, config *conf.ProjectConfig) error
 		return err
 	}
 
+	config.SeedHistoryTable, err = cmd.Flags().GetString("seed-history-table")
+	if err != nil {
+		return err
+	}
+
+	config.DataHistoryTable, err = cmd.Flags().GetString("data-history-table")
+	if err != nil {
+		return err
+	}
+
+	config.CreateDatabase, err = cmd.Flags().GetBool("create-database")
+	if err != nil {
+		return err
+	}
+
+	config.SingleConnection, err = cmd.Flags().GetBool("single-connection")
+	if err != nil {
+		return err
+	}
+
+	config.HTTPPath, err = cmd.Flags().GetString("http-path")
+	if err != nil {
+		return err
+	}
+
+	config.SID, err = cmd.Flags().GetString("sid")
+	if err != nil {
+		return err
+	}
+
+	config.Server, err = cmd.Flags().GetString("server")
+	if err != nil {
+		return err
+	}
+
+	config.Auth, err = cmd.Flags().GetString("auth")
+	if err != nil {
+		return err
+	}
+
+	config.Plugin, err = cmd.Flags().GetString("plugin")
+	if err != nil {
+		return err
+	}
+
 	// Extract SSLConfig flags
 	config.SSL.SSLMode, err = cmd.Flags().GetString("sslmode")
 	if err != nil {
@@ -125,6 +179,60 @@ func MergeDBConfigFlags(cmd *cobra.Command, config *conf.ProjectConfig) error {
 			return err
 		}
 	}
+	if cmd.Flags().Changed("seed-history-table") {
+		config.SeedHistoryTable, err = cmd.Flags().GetString("seed-history-table")
+		if err != nil {
+			return err
+		}
+	}
+	if cmd.Flags().Changed("data-history-table") {
+		config.DataHistoryTable, err = cmd.Flags().GetString("data-history-table")
+		if err != nil {
+			return err
+		}
+	}
+	if cmd.Flags().Changed("create-database") {
+		config.CreateDatabase, err = cmd.Flags().GetBool("create-database")
+		if err != nil {
+			return err
+		}
+	}
+	if cmd.Flags().Changed("single-connection") {
+		config.SingleConnection, err = cmd.Flags().GetBool("single-connection")
+		if err != nil {
+			return err
+		}
+	}
+	if cmd.Flags().Changed("http-path") {
+		config.HTTPPath, err = cmd.Flags().GetString("http-path")
+		if err != nil {
+			return err
+		}
+	}
+	if cmd.Flags().Changed("sid") {
+		config.SID, err = cmd.Flags().GetString("sid")
+		if err != nil {
+			return err
+		}
+	}
+	if cmd.Flags().Changed("server") {
+		config.Server, err = cmd.Flags().GetString("server")
+		if err != nil {
+			return err
+		}
+	}
+	if cmd.Flags().Changed("auth") {
+		config.Auth, err = cmd.Flags().GetString("auth")
+		if err != nil {
+			return err
+		}
+	}
+	if cmd.Flags().Changed("plugin") {
+		config.Plugin, err = cmd.Flags().GetString("plugin")
+		if err != nil {
+			return err
+		}
+	}
 
 	// Extract and override SSL-related flags
 	if cmd.Flags().Changed("sslmode") {
@@ -12,7 +12,7 @@ type globalFlags struct {
 
 func SetupGlobalFlags(cmd *cobra.Command) {
 	cmd.PersistentFlags().StringP("location", "l", ".", "Project directory.")
-	cmd.PersistentFlags().StringArrayP("migrations", "m", []string{"./migrations"}, "Migrations directories.")
+	cmd.PersistentFlags().StringArrayP("migrations", "m", []string{"./migrations"}, "Migrations directories, or s3://, gs:// or az:// URLs of remote locations.")
 }
 
 func ExtractGlobalFlags(cmd *cobra.Command) (*globalFlags, error) {
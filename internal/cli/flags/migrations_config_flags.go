@@ -1,16 +1,28 @@
 package flags
 
 import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+
 	"github.com/maestro-go/maestro/core/conf"
 	"github.com/spf13/cobra"
 )
 
 func SetupMigrationConfigFlags(cmd *cobra.Command) {
+	cmd.Flags().String("track", "schema", "Migration track to run (schema or data).")
 	cmd.Flags().Bool("validate", true, "Validate migrations before executing.")
+	cmd.Flags().Bool("validate-applied-only", false, "Only validate the local migrations up to the latest applied version.")
+	cmd.Flags().Bool("validate-allow-missing", false, "Warn instead of failing when applied migrations are missing locally.")
+	cmd.Flags().UintSlice("validation-ignore", nil, "Versions whose history entries are not validated.")
 	cmd.Flags().Bool("down", false, "Run migrations in the down direction.")
 	cmd.Flags().Bool("in-transaction", true, "Run migrations within a transaction.")
-	cmd.Flags().Uint16("destination", 0, "Target migration version.")
+	cmd.Flags().String("destination", "", "Target migration version, file name, description, or latest, next or previous.")
+	cmd.Flags().Bool("strict-destination", false, "Fail when the destination is behind the latest applied version for up runs, or ahead of it for down runs.")
 	cmd.Flags().Bool("force", false, "Continue executing migrations even if errors occur.")
+	cmd.Flags().Int("max-errors", 0, "With force, abort the run after this number of failed migrations and hooks (0 for unlimited).")
+	cmd.Flags().UintSlice("skip-versions", nil, "Pending versions recorded as applied without being executed.")
 	cmd.Flags().Bool("use-repeatable", true, "Execute repeatable migrations.")
 	cmd.Flags().Bool("use-before", true, "Execute before-all hooks.")
 	cmd.Flags().Bool("use-after", true, "Execute after-all hooks.")
@@ -18,16 +30,48 @@ func SetupMigrationConfigFlags(cmd *cobra.Command) {
 	cmd.Flags().Bool("use-after-each", true, "Execute after-each hooks.")
 	cmd.Flags().Bool("use-before-version", true, "Execute before-version hooks.")
 	cmd.Flags().Bool("use-after-version", true, "Execute after-version hooks.")
+	cmd.Flags().Bool("use-assertions", true, "Execute assertion hooks after the migrations.")
+	cmd.Flags().Bool("use-before-validate", true, "Execute before-validate hooks before the schema history table is checked.")
+	cmd.Flags().Bool("use-run-start", true, "Execute run-start hooks before the lock is acquired.")
+	cmd.Flags().Bool("use-run-end", true, "Execute run-end hooks after the lock is released.")
+	cmd.Flags().Bool("disallow-duplicate-hooks", false, "Fail when the same hook file exists in more than one location.")
+	cmd.Flags().String("manifest", "", "Manifest file caching the unchanged migration and hook files (e.g. .maestro-manifest.json).")
+	cmd.Flags().String("lock-identity", "", "Identity recorded with the lock as its holder (e.g. the name of the pod), the host name by default.")
+	cmd.Flags().String("remote-key", "", "PEM Ed25519 public key verifying the signed manifests of the remote locations.")
+	cmd.Flags().Duration("transaction-warn-after", 0, "Warn when the transaction of the migrations is open for longer (e.g. 10m, 0 to disable).")
+	cmd.Flags().Duration("transaction-abort-after", 0, "Cancel the transaction of the migrations when it is open for longer (0 to disable).")
+	cmd.Flags().Duration("lock-wait-warn-after", 0, "Warn when a statement of the migrations waits for a lock for longer (e.g. 30s, 0 to disable).")
+	cmd.Flags().Duration("lock-wait-abort-after", 0, "Cancel the transaction of the migrations when a statement waits for a lock for longer (0 to disable).")
 }
 
 func ExtractMigrationConfigFlags(cmd *cobra.Command, config *conf.MigrationConfig) error {
 	var err error
 
+	config.Track, err = cmd.Flags().GetString("track")
+	if err != nil {
+		return err
+	}
+
 	config.Validate, err = cmd.Flags().GetBool("validate")
 	if err != nil {
 		return err
 	}
 
+	config.ValidateAppliedOnly, err = cmd.Flags().GetBool("validate-applied-only")
+	if err != nil {
+		return err
+	}
+
+	config.ValidateAllowMissing, err = cmd.Flags().GetBool("validate-allow-missing")
+	if err != nil {
+		return err
+	}
+
+	config.ValidationIgnore, err = getUint16Slice(cmd, "validation-ignore")
+	if err != nil {
+		return err
+	}
+
 	config.Down, err = cmd.Flags().GetBool("down")
 	if err != nil {
 		return err
@@ -38,19 +82,33 @@ func ExtractMigrationConfigFlags(cmd *cobra.Command, config *conf.MigrationConfi
 		return err
 	}
 
-	destination, err := cmd.Flags().GetUint16("destination")
+	if cmd.Flags().Changed("destination") { // Only set if the flag is explicitly provided
+		err = setDestination(cmd, config)
+		if err != nil {
+			return err
+		}
+	}
+
+	config.StrictDestination, err = cmd.Flags().GetBool("strict-destination")
 	if err != nil {
 		return err
 	}
-	if destination != 0 { // Only set if the flag is explicitly provided
-		config.Destination = &destination
-	}
 
 	config.Force, err = cmd.Flags().GetBool("force")
 	if err != nil {
 		return err
 	}
 
+	config.MaxErrors, err = cmd.Flags().GetInt("max-errors")
+	if err != nil {
+		return err
+	}
+
+	config.SkipVersions, err = getUint16Slice(cmd, "skip-versions")
+	if err != nil {
+		return err
+	}
+
 	config.UseRepeatable, err = cmd.Flags().GetBool("use-repeatable")
 	if err != nil {
 		return err
@@ -86,18 +144,103 @@ func ExtractMigrationConfigFlags(cmd *cobra.Command, config *conf.MigrationConfi
 		return err
 	}
 
+	config.UseAssertions, err = cmd.Flags().GetBool("use-assertions")
+	if err != nil {
+		return err
+	}
+
+	config.UseBeforeValidate, err = cmd.Flags().GetBool("use-before-validate")
+	if err != nil {
+		return err
+	}
+
+	config.UseRunStart, err = cmd.Flags().GetBool("use-run-start")
+	if err != nil {
+		return err
+	}
+
+	config.UseRunEnd, err = cmd.Flags().GetBool("use-run-end")
+	if err != nil {
+		return err
+	}
+
+	config.DisallowDuplicateHooks, err = cmd.Flags().GetBool("disallow-duplicate-hooks")
+	if err != nil {
+		return err
+	}
+
+	config.Manifest, err = cmd.Flags().GetString("manifest")
+	if err != nil {
+		return err
+	}
+
+	config.LockIdentity, err = cmd.Flags().GetString("lock-identity")
+	if err != nil {
+		return err
+	}
+
+	config.RemoteKey, err = cmd.Flags().GetString("remote-key")
+	if err != nil {
+		return err
+	}
+
+	config.TransactionWarnAfter, err = cmd.Flags().GetDuration("transaction-warn-after")
+	if err != nil {
+		return err
+	}
+
+	config.TransactionAbortAfter, err = cmd.Flags().GetDuration("transaction-abort-after")
+	if err != nil {
+		return err
+	}
+
+	config.LockWaitWarnAfter, err = cmd.Flags().GetDuration("lock-wait-warn-after")
+	if err != nil {
+		return err
+	}
+
+	config.LockWaitAbortAfter, err = cmd.Flags().GetDuration("lock-wait-abort-after")
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
 func MergeMigrationsConfigFlags(cmd *cobra.Command, config *conf.MigrationConfig) error {
 	var err error
 
+	if cmd.Flags().Changed("track") {
+		config.Track, err = cmd.Flags().GetString("track")
+		if err != nil {
+			return err
+		}
+	}
+
 	if cmd.Flags().Changed("validate") {
 		config.Validate, err = cmd.Flags().GetBool("validate")
 		if err != nil {
 			return err
 		}
 	}
+	if cmd.Flags().Changed("validate-applied-only") {
+		config.ValidateAppliedOnly, err = cmd.Flags().GetBool("validate-applied-only")
+		if err != nil {
+			return err
+		}
+	}
+	if cmd.Flags().Changed("validate-allow-missing") {
+		config.ValidateAllowMissing, err = cmd.Flags().GetBool("validate-allow-missing")
+		if err != nil {
+			return err
+		}
+	}
+	if cmd.Flags().Changed("validation-ignore") {
+		config.ValidationIgnore, err = getUint16Slice(cmd, "validation-ignore")
+		if err != nil {
+			return err
+		}
+	}
 	if cmd.Flags().Changed("down") {
 		config.Down, err = cmd.Flags().GetBool("down")
 		if err != nil {
@@ -111,11 +254,16 @@ func MergeMigrationsConfigFlags(cmd *cobra.Command, config *conf.MigrationConfig
 		}
 	}
 	if cmd.Flags().Changed("destination") {
-		destination, err := cmd.Flags().GetUint16("destination")
+		err = setDestination(cmd, config) // Only set if explicitly provided
+		if err != nil {
+			return err
+		}
+	}
+	if cmd.Flags().Changed("strict-destination") {
+		config.StrictDestination, err = cmd.Flags().GetBool("strict-destination")
 		if err != nil {
 			return err
 		}
-		config.Destination = &destination // Only set if explicitly provided
 	}
 	if cmd.Flags().Changed("force") {
 		config.Force, err = cmd.Flags().GetBool("force")
@@ -123,6 +271,18 @@ func MergeMigrationsConfigFlags(cmd *cobra.Command, config *conf.MigrationConfig
 			return err
 		}
 	}
+	if cmd.Flags().Changed("max-errors") {
+		config.MaxErrors, err = cmd.Flags().GetInt("max-errors")
+		if err != nil {
+			return err
+		}
+	}
+	if cmd.Flags().Changed("skip-versions") {
+		config.SkipVersions, err = getUint16Slice(cmd, "skip-versions")
+		if err != nil {
+			return err
+		}
+	}
 	if cmd.Flags().Changed("use-repeatable") {
 		config.UseRepeatable, err = cmd.Flags().GetBool("use-repeatable")
 		if err != nil {
@@ -165,6 +325,128 @@ func MergeMigrationsConfigFlags(cmd *cobra.Command, config *conf.MigrationConfig
 			return err
 		}
 	}
+	if cmd.Flags().Changed("use-assertions") {
+		config.UseAssertions, err = cmd.Flags().GetBool("use-assertions")
+		if err != nil {
+			return err
+		}
+	}
+	if cmd.Flags().Changed("use-before-validate") {
+		config.UseBeforeValidate, err = cmd.Flags().GetBool("use-before-validate")
+		if err != nil {
+			return err
+		}
+	}
+	if cmd.Flags().Changed("use-run-start") {
+		config.UseRunStart, err = cmd.Flags().GetBool("use-run-start")
+		if err != nil {
+			return err
+		}
+	}
+	if cmd.Flags().Changed("use-run-end") {
+		config.UseRunEnd, err = cmd.Flags().GetBool("use-run-end")
+		if err != nil {
+			return err
+		}
+	}
+	if cmd.Flags().Changed("disallow-duplicate-hooks") {
+		config.DisallowDuplicateHooks, err = cmd.Flags().GetBool("disallow-duplicate-hooks")
+		if err != nil {
+			return err
+		}
+	}
+	if cmd.Flags().Changed("manifest") {
+		config.Manifest, err = cmd.Flags().GetString("manifest")
+		if err != nil {
+			return err
+		}
+	}
+	if cmd.Flags().Changed("lock-identity") {
+		config.LockIdentity, err = cmd.Flags().GetString("lock-identity")
+		if err != nil {
+			return err
+		}
+	}
+	if cmd.Flags().Changed("remote-key") {
+		config.RemoteKey, err = cmd.Flags().GetString("remote-key")
+		if err != nil {
+			return err
+		}
+	}
+	if cmd.Flags().Changed("transaction-warn-after") {
+		config.TransactionWarnAfter, err = cmd.Flags().GetDuration("transaction-warn-after")
+		if err != nil {
+			return err
+		}
+	}
+	if cmd.Flags().Changed("transaction-abort-after") {
+		config.TransactionAbortAfter, err = cmd.Flags().GetDuration("transaction-abort-after")
+		if err != nil {
+			return err
+		}
+	}
+	if cmd.Flags().Changed("lock-wait-warn-after") {
+		config.LockWaitWarnAfter, err = cmd.Flags().GetDuration("lock-wait-warn-after")
+		if err != nil {
+			return err
+		}
+	}
+	if cmd.Flags().Changed("lock-wait-abort-after") {
+		config.LockWaitAbortAfter, err = cmd.Flags().GetDuration("lock-wait-abort-after")
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// getUint16Slice returns the values of an uint slice flag, checking that they are valid versions.
+func getUint16Slice(cmd *cobra.Command, name string) ([]uint16, error) {
+	values, err := cmd.Flags().GetUintSlice(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(values) < 1 {
+		return nil, nil
+	}
+
+	versions := make([]uint16, 0, len(values))
+	for _, value := range values {
+		if value > math.MaxUint16 {
+			return nil, fmt.Errorf("invalid %s value %d: versions range from 0 to %d", name, value, math.MaxUint16)
+		}
+		versions = append(versions, uint16(value))
+	}
+
+	return versions, nil
+}
+
+// setDestination sets the destination of the flag, a version or else the file name or description of a migration,
+// resolved to its version by the migrator.
+func setDestination(cmd *cobra.Command, config *conf.MigrationConfig) error {
+	value, err := cmd.Flags().GetString("destination")
+	if err != nil {
+		return err
+	}
+
+	if value == "" {
+		return fmt.Errorf("invalid destination: empty value")
+	}
+
+	version, err := strconv.ParseUint(value, 10, 16)
+	if errors.Is(err, strconv.ErrRange) {
+		return fmt.Errorf("invalid destination %s: versions range from 0 to %d", value, math.MaxUint16)
+	}
+	if err == nil {
+		destination := uint16(version)
+		config.Destination = &destination
+		config.DestinationName = ""
+		return nil
+	}
 
+	config.Destination = nil
+	config.DestinationName = value
 	return nil
 }
@@ -0,0 +1,89 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	_ "github.com/lib/pq"
+	"github.com/maestro-go/maestro/core/enums"
+	"github.com/maestro-go/maestro/core/migrator"
+	"github.com/maestro-go/maestro/internal/cli/conn"
+	"github.com/maestro-go/maestro/internal/cli/flags"
+	"github.com/maestro-go/maestro/internal/utils/logger"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+func SetupFreshCommand() *cobra.Command {
+	freshCmd := &cobra.Command{
+		Use:   "fresh",
+		Short: "Drop all objects in the schema and apply all migrations",
+		Long: `The fresh command drops every object of the current schema, like the clean command, and then applies all migrations.
+
+It is meant for CI jobs that need a pristine database regardless of the state left behind by previous runs.
+The command asks for confirmation unless --yes is given, and refuses to run against protected databases ("protected: true").`,
+		RunE: runFreshCommand,
+	}
+
+	freshCmd.Flags().SortFlags = false
+	freshCmd.Flags().BoolP("yes", "y", false, "Skip the confirmation prompt.")
+	flags.SetupDBConfigFlags(freshCmd)
+
+	return freshCmd
+}
+
+func runFreshCommand(cmd *cobra.Command, args []string) error {
+	logger, err := logger.NewLogger()
+	if err != nil {
+		log.Fatal(err)
+		return err
+	}
+
+	ctx := context.Background()
+
+	projectConfig, removeLocations, err := loadProjectConfig(cmd, logger)
+	if err != nil {
+		return err
+	}
+	defer removeLocations()
+
+	err = checkNotProtected(projectConfig, "fresh")
+	if err != nil {
+		logError(logger, ErrProtectedDatabase, err)
+		return genError(ErrProtectedDatabase, err)
+	}
+
+	err = confirmAction(cmd, fmt.Sprintf("This will drop all objects in the schema of database %s and apply all migrations.",
+		projectConfig.Database))
+	if err != nil {
+		logError(logger, ErrConfirmation, err)
+		return genError(ErrConfirmation, err)
+	}
+
+	driver, ok := enums.MapStringToDriverType[projectConfig.Driver]
+	if !ok {
+		logError(logger, ErrInvalidDriver, errors.New(projectConfig.Driver))
+		return genError(ErrInvalidDriver, errors.New(projectConfig.Driver))
+	}
+
+	repo, cleanup, err := conn.ConnectToDatabase(ctx, projectConfig, driver)
+	if err != nil {
+		logError(logger, ErrConnectToDatabase, err)
+		return genError(ErrConnectToDatabase, err)
+	}
+	defer cleanup()
+
+	migrator := migrator.NewMigrator(logger, repo, &projectConfig.Migration)
+	migrator.SetHistorySync(historySyncTable(logger, projectConfig))
+	logger = logger.With(zap.String("run_id", migrator.RunID()))
+	err = migrator.Fresh()
+	if err != nil {
+		return genError(ErrLoadMigrations, err)
+	}
+
+	logger.Info("Database recreated successfully")
+
+	return nil
+}
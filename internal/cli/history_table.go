@@ -0,0 +1,170 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/maestro-go/maestro/core/conf"
+	"github.com/maestro-go/maestro/core/database"
+	"github.com/maestro-go/maestro/core/enums"
+	"github.com/maestro-go/maestro/internal/cli/conn"
+	"github.com/maestro-go/maestro/internal/cli/flags"
+	"github.com/maestro-go/maestro/internal/utils/logger"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+func SetupHistoryTableMigrateCommand() *cobra.Command {
+	historyTableMigrateCmd := &cobra.Command{
+		Use:   "history-table-migrate",
+		Short: "Copy the schema history table of a previous name to the configured one",
+		Long: `The history-table-migrate command copies the rows of the schema history table of a previous name to the
+configured history table, created if missing, so renaming the history-table option does not orphan the
+applied migrations. The previous table is kept.
+
+While processes (e.g. deployments of a previous release) still read the previous table, set history-table-sync
+in the project file: the previous table is then kept in sync with the configured one after each run, until the
+end of the grace period.`,
+		RunE: runHistoryTableMigrateCommand,
+	}
+
+	historyTableMigrateCmd.Flags().SortFlags = false
+	historyTableMigrateCmd.Flags().String("from", "", "Previous name of the schema history table.")
+	historyTableMigrateCmd.Flags().Bool("replace", false, "Replace the rows of the configured history table if it already has some.")
+	historyTableMigrateCmd.MarkFlagRequired("from")
+	flags.SetupDBConfigFlags(historyTableMigrateCmd)
+
+	return historyTableMigrateCmd
+}
+
+func runHistoryTableMigrateCommand(cmd *cobra.Command, args []string) error {
+	logger, err := logger.NewLogger()
+	if err != nil {
+		log.Fatal(err)
+		return err
+	}
+
+	ctx := context.Background()
+
+	from, err := cmd.Flags().GetString("from")
+	if err != nil {
+		logError(logger, ErrReadFromFlag, err)
+		return genError(ErrReadFromFlag, err)
+	}
+
+	replace, err := cmd.Flags().GetBool("replace")
+	if err != nil {
+		logError(logger, ErrReadReplaceFlag, err)
+		return genError(ErrReadReplaceFlag, err)
+	}
+
+	projectConfig, removeLocations, err := loadProjectConfig(cmd, logger)
+	if err != nil {
+		return err
+	}
+	defer removeLocations()
+
+	if from == projectConfig.HistoryTable {
+		err = fmt.Errorf("%s is already the configured history table", from)
+		logError(logger, ErrCopyHistoryTable, err)
+		return genError(ErrCopyHistoryTable, err)
+	}
+
+	driver, ok := enums.MapStringToDriverType[projectConfig.Driver]
+	if !ok {
+		logError(logger, ErrInvalidDriver, errors.New(projectConfig.Driver))
+		return genError(ErrInvalidDriver, errors.New(projectConfig.Driver))
+	}
+
+	repo, cleanup, err := conn.ConnectToDatabase(ctx, projectConfig, driver)
+	if err != nil {
+		logError(logger, ErrConnectToDatabase, err)
+		return genError(ErrConnectToDatabase, err)
+	}
+	defer cleanup()
+
+	copier, ok := repo.(database.HistoryCopier)
+	if !ok {
+		err = fmt.Errorf("the %s driver can not copy schema history tables", projectConfig.Driver)
+		logError(logger, ErrCopyHistoryTable, err)
+		return genError(ErrCopyHistoryTable, err)
+	}
+
+	copied := int64(0)
+	err = repo.DoInLock(func() error {
+		err := repo.AssertSchemaHistoryTable()
+		if err != nil {
+			return err
+		}
+
+		// The rows recorded since the configured table was created would be lost
+		history, err := repo.GetAppliedMigrations()
+		if err != nil {
+			return err
+		}
+		if len(history) > 0 && !replace {
+			return fmt.Errorf("history table %s already has %d rows, use --replace to replace them with the rows of %s",
+				projectConfig.HistoryTable, len(history), from)
+		}
+
+		copied, err = copier.CopyHistoryFrom(from)
+		return err
+	})
+	if err != nil {
+		logError(logger, ErrCopyHistoryTable, err)
+		return genError(ErrCopyHistoryTable, err)
+	}
+
+	logger.Info("Schema history table copied", zap.String("from", from),
+		zap.String("to", projectConfig.HistoryTable), zap.Int64("rows", copied))
+
+	if projectConfig.HistoryTableSync.Table != from {
+		logger.Info("Set history-table-sync in the project file to keep the previous table in sync while it is read",
+			zap.String("table", from))
+	}
+
+	return nil
+}
+
+// historySyncTable returns the previous history table kept in sync with the history table by history-table-sync,
+// or an empty string if there is none or its grace period ended. Only the history table of the schema track is
+// kept in sync.
+func historySyncTable(logger *zap.Logger, config *conf.ProjectConfig) string {
+	sync := config.HistoryTableSync
+	if sync.Table == "" || config.Migration.Track == "data" {
+		return ""
+	}
+
+	if !sync.Active(time.Now()) {
+		logger.Warn("The grace period of history-table-sync ended, the previous history table is no longer kept in sync",
+			zap.String("table", sync.Table), zap.Time("until", sync.Until))
+		return ""
+	}
+
+	return sync.Table
+}
+
+// syncHistoryTable replaces the rows of the previous history table with the ones of the history table, while
+// history-table-sync keeps it in sync.
+func syncHistoryTable(logger *zap.Logger, repo database.Repository, config *conf.ProjectConfig) error {
+	table := historySyncTable(logger, config)
+	if table == "" {
+		return nil
+	}
+
+	copier, ok := repo.(database.HistoryCopier)
+	if !ok {
+		return fmt.Errorf("the %s driver can not keep history table %s in sync", config.Driver, table)
+	}
+
+	copied, err := copier.CopyHistoryTo(table)
+	if err != nil {
+		return fmt.Errorf("error syncing history table %s: %w", table, err)
+	}
+
+	logger.Info("Synced the previous history table", zap.String("table", table), zap.Int64("rows", copied))
+	return nil
+}
@@ -0,0 +1,123 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/maestro-go/maestro/core/database"
+	"github.com/maestro-go/maestro/core/enums"
+	"github.com/maestro-go/maestro/internal/cli/conn"
+	"github.com/maestro-go/maestro/internal/cli/flags"
+	"github.com/maestro-go/maestro/internal/filesystem"
+	"github.com/maestro-go/maestro/internal/migrations"
+	"github.com/maestro-go/maestro/internal/utils/logger"
+	"github.com/spf13/cobra"
+)
+
+func SetupHolesCommand() *cobra.Command {
+	holesCmd := &cobra.Command{
+		Use:   "holes",
+		Short: "Report the versions missing from the local files and from the schema history table",
+		Long: `The holes command reports the missing versions (holes) of the local migration files and of the schema
+history table separately, telling for each hole whether the other side has the version: a version applied to
+the database whose file was deleted, or a local migration that was never recorded in the schema history table.
+Only the versions below the highest version of each side are holes, pending migrations are not reported.
+The command fails if any hole is found, so it can be used as a check. The database is only read.`,
+		RunE: runHolesCommand,
+	}
+
+	holesCmd.Flags().SortFlags = false
+	flags.SetupDBConfigFlags(holesCmd)
+
+	return holesCmd
+}
+
+func runHolesCommand(cmd *cobra.Command, args []string) error {
+	logger, err := logger.NewLogger()
+	if err != nil {
+		log.Fatal(err)
+		return err
+	}
+
+	ctx := context.Background()
+
+	projectConfig, removeLocations, err := loadProjectConfig(cmd, logger)
+	if err != nil {
+		return err
+	}
+	defer removeLocations()
+
+	migrationsMap, _, errs := filesystem.LoadObjectsFromFiles(&projectConfig.Migration)
+	if len(errs) > 0 {
+		logErrors(logger, ErrLoadMigrations, errs)
+		return errors.Join(errs...)
+	}
+
+	driver, ok := enums.MapStringToDriverType[projectConfig.Driver]
+	if !ok {
+		logError(logger, ErrInvalidDriver, errors.New(projectConfig.Driver))
+		return genError(ErrInvalidDriver, errors.New(projectConfig.Driver))
+	}
+
+	repo, cleanup, err := conn.ConnectToDatabaseReadOnly(ctx, projectConfig, driver)
+	if err != nil {
+		logError(logger, ErrConnectToDatabase, err)
+		return genError(ErrConnectToDatabase, err)
+	}
+	defer cleanup()
+
+	history, err := repo.GetAppliedMigrations()
+	if err != nil {
+		logError(logger, ErrGetAppliedMigrations, err)
+		return genError(ErrGetAppliedMigrations, err)
+	}
+
+	versionRanges, err := migrations.ParseVersionRanges(projectConfig.Migration.Locations,
+		projectConfig.Migration.VersionRanges)
+	if err != nil {
+		logError(logger, ErrLoadMigrations, err)
+		return genError(ErrLoadMigrations, err)
+	}
+
+	holes := database.FindVersionHoles(migrationsMap[enums.MIGRATION_UP], history, versionRanges)
+	writeVersionHoles(cmd.OutOrStdout(), holes)
+
+	if !holes.Empty() {
+		err = fmt.Errorf("%d missing local files, %d missing history rows", len(holes.Files), len(holes.History))
+		logError(logger, ErrVersionHoles, err)
+		return genError(ErrVersionHoles, err)
+	}
+
+	return nil
+}
+
+// writeVersionHoles writes the holes of each side, with whether the other side has the version.
+func writeVersionHoles(out io.Writer, holes *database.VersionHoles) {
+	fmt.Fprintf(out, "Local files: %s\n", countHoles(len(holes.Files)))
+	for _, hole := range holes.Files {
+		other := "not in the schema history table either"
+		if hole.Applied {
+			other = "in the schema history table"
+		}
+		fmt.Fprintf(out, "  version %d: missing file, %s\n", hole.Version, other)
+	}
+
+	fmt.Fprintf(out, "Schema history table: %s\n", countHoles(len(holes.History)))
+	for _, hole := range holes.History {
+		other := "no local file either"
+		if hole.Local {
+			other = "local file exists"
+		}
+		fmt.Fprintf(out, "  version %d: missing row, %s\n", hole.Version, other)
+	}
+}
+
+func countHoles(count int) string {
+	if count == 1 {
+		return "1 hole"
+	}
+	return fmt.Sprintf("%d holes", count)
+}
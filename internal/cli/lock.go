@@ -0,0 +1,77 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	_ "github.com/lib/pq"
+	"github.com/maestro-go/maestro/core/enums"
+	"github.com/maestro-go/maestro/internal/cli/conn"
+	"github.com/maestro-go/maestro/internal/cli/flags"
+	"github.com/maestro-go/maestro/internal/utils/logger"
+	"github.com/spf13/cobra"
+)
+
+func SetupLockCommand() *cobra.Command {
+	lockCmd := &cobra.Command{
+		Use:   "lock",
+		Short: "Inspect the migration lock",
+		Long:  `Inspect the lock taken while migrating, which prevents concurrent maestro processes from migrating the same database.`,
+	}
+
+	statusCmd := &cobra.Command{
+		Use:   "status",
+		Short: "Show whether the migration lock is held",
+		Long: `Report whether the migration lock is currently held, and by whom and since when where the driver can tell:
+the session holding the advisory lock for PostgreSQL, the run ID and holder for OpenSearch, Neo4j and Redis.
+Drivers using a lock table only report whether the table exists.`,
+		RunE: runLockStatusCommand,
+	}
+
+	statusCmd.Flags().SortFlags = false
+	flags.SetupDBConfigFlags(statusCmd)
+
+	lockCmd.AddCommand(statusCmd)
+
+	return lockCmd
+}
+
+func runLockStatusCommand(cmd *cobra.Command, args []string) error {
+	logger, err := logger.NewLogger()
+	if err != nil {
+		log.Fatal(err)
+		return err
+	}
+
+	ctx := context.Background()
+
+	projectConfig, removeLocations, err := loadProjectConfig(cmd, logger)
+	if err != nil {
+		return err
+	}
+	defer removeLocations()
+
+	driver, ok := enums.MapStringToDriverType[projectConfig.Driver]
+	if !ok {
+		logError(logger, ErrInvalidDriver, errors.New(projectConfig.Driver))
+		return genError(ErrInvalidDriver, errors.New(projectConfig.Driver))
+	}
+
+	repo, cleanup, err := conn.ConnectToDatabaseReadOnly(ctx, projectConfig, driver)
+	if err != nil {
+		logError(logger, ErrConnectToDatabase, err)
+		return genError(ErrConnectToDatabase, err)
+	}
+	defer cleanup()
+
+	lockInfo, err := repo.GetLockInfo()
+	if err != nil {
+		logError(logger, ErrGetLockInfo, err)
+		return genError(ErrGetLockInfo, err)
+	}
+
+	logLockInfo(logger, lockInfo)
+
+	return nil
+}
@@ -3,6 +3,7 @@ package cli
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log"
 	"path/filepath"
 
@@ -13,9 +14,9 @@ import (
 	"github.com/maestro-go/maestro/internal/cli/conn"
 	"github.com/maestro-go/maestro/internal/cli/flags"
 	internalConf "github.com/maestro-go/maestro/internal/conf"
-	"github.com/maestro-go/maestro/internal/filesystem"
 	"github.com/maestro-go/maestro/internal/utils/logger"
 	"github.com/spf13/cobra"
+	"go.uber.org/zap"
 )
 
 func SetupMigrateCommand() *cobra.Command {
@@ -23,18 +24,42 @@ func SetupMigrateCommand() *cobra.Command {
 		Use:   "migrate",
 		Short: "Run database migrations",
 		Long: `The migrate command applies database migrations based on the configuration provided.
-It supports both "up" and "down" migrations, validates migrations if configured, and ensures the schema history table exists.`,
+It supports both "up" and "down" migrations, validates migrations if configured, and ensures the schema history table exists.
+
+With --canary, the pending migrations are first applied to a scratch database, and the target database is only
+migrated if the canary run succeeds.
+
+When a run without transaction fails, the failure point is written to the resume file of the project. Once the
+issue is fixed, --resume continues from the failed migration and statement.
+
+When the run fails, its errors are written to stderr grouped by migration version, as text or as JSON
+with --error-format json.
+
+With a backup configured, the database is dumped (pg_dump or mysqldump) before a run executes destructive
+migrations, flagged with a "-- maestro:destructive" line or dropping or truncating tables, and the run
+fails without executing anything if the backup fails.
+
+For Kubernetes Jobs and init containers: with --exit-zero-on-no-pending, the command exits with 0 as soon as
+no migration is pending, without taking the lock, running hooks or validating the applied migrations, so the
+replicas starting together do not wait for each other. --lock-identity records e.g. the name of the pod with
+the lock, reported by lock status, and --termination-log writes the outcome of the run as JSON to e.g.
+/dev/termination-log, the termination message of the container.`,
 		RunE: runMigrateCommand,
 	}
 
 	migrateCmd.Flags().SortFlags = false
 	flags.SetupDBConfigFlags(migrateCmd)
 	flags.SetupMigrationConfigFlags(migrateCmd)
+	migrateCmd.Flags().String("canary", "", "Data source name of a scratch database where migrations are applied first.")
+	migrateCmd.Flags().Bool("resume", false, "Resume the failed run recorded in the resume file from its failure point.")
+	migrateCmd.Flags().String("error-format", error_format_text, "Format of the errors of a failed run written to stderr (text or json).")
+	migrateCmd.Flags().Bool("exit-zero-on-no-pending", false, "Exit with 0 before taking the lock when no migration is pending.")
+	migrateCmd.Flags().String("termination-log", "", "File the outcome of the run is written to as JSON (e.g. /dev/termination-log).")
 
 	return migrateCmd
 }
 
-func runMigrateCommand(cmd *cobra.Command, args []string) error {
+func runMigrateCommand(cmd *cobra.Command, args []string) (err error) {
 	logger, err := logger.NewLogger()
 	if err != nil {
 		log.Fatal(err)
@@ -43,83 +68,207 @@ func runMigrateCommand(cmd *cobra.Command, args []string) error {
 
 	ctx := context.Background()
 
+	terminationLog, err := cmd.Flags().GetString("termination-log")
+	if err != nil {
+		logError(logger, ErrReadTerminationLogFlag, err)
+		return genError(ErrReadTerminationLogFlag, err)
+	}
+
+	// The outcome is written whatever the command returns
+	termination := &terminationMessage{}
+	if terminationLog != "" {
+		defer func() {
+			wErr := writeTerminationMessage(terminationLog, termination, err)
+			if wErr != nil {
+				logError(logger, ErrWriteTerminationLog, wErr)
+			}
+		}()
+	}
+
 	globalFlags, err := flags.ExtractGlobalFlags(cmd)
 	if err != nil {
 		logError(logger, ErrExtractGlobalFlags, err)
 		return genError(ErrExtractGlobalFlags, err)
 	}
 
-	configFilePath := filepath.Join(globalFlags.Location, internalConf.DEFAULT_PROJECT_FILE)
-	exists, err := filesystem.CheckFSObject(configFilePath)
+	projectConfig, removeLocations, err := loadProjectConfig(cmd, logger)
 	if err != nil {
-		logError(logger, ErrCheckFile, err)
-		return genError(ErrCheckFile, err)
+		return err
+	}
+	defer removeLocations()
+
+	driver, ok := enums.MapStringToDriverType[projectConfig.Driver]
+	if !ok {
+		logError(logger, ErrInvalidDriver, errors.New(projectConfig.Driver))
+		return genError(ErrInvalidDriver, errors.New(projectConfig.Driver))
 	}
 
-	projectConfig := &conf.ProjectConfig{}
-	if exists {
-		logger.Info("Located config file")
+	resume, err := cmd.Flags().GetBool("resume")
+	if err != nil {
+		logError(logger, ErrReadResumeFlag, err)
+		return genError(ErrReadResumeFlag, err)
+	}
 
-		err = conf.LoadConfigFromFile(configFilePath, projectConfig)
-		if err != nil {
-			logError(logger, ErrLoadConfigFromFile, err)
-			return genError(ErrLoadConfigFromFile, err)
+	errorFormat, err := cmd.Flags().GetString("error-format")
+	if err == nil && errorFormat != error_format_text && errorFormat != error_format_json {
+		err = fmt.Errorf("unknown format %q", errorFormat)
+	}
+	if err != nil {
+		logError(logger, ErrReadErrorFormatFlag, err)
+		return genError(ErrReadErrorFormatFlag, err)
+	}
+
+	canary, err := cmd.Flags().GetString("canary")
+	if err != nil {
+		logError(logger, ErrReadCanaryFlag, err)
+		return genError(ErrReadCanaryFlag, err)
+	}
+
+	exitZeroOnNoPending, err := cmd.Flags().GetBool("exit-zero-on-no-pending")
+	if err != nil {
+		logError(logger, ErrReadExitZeroFlag, err)
+		return genError(ErrReadExitZeroFlag, err)
+	}
+
+	if exitZeroOnNoPending {
+		if projectConfig.Migration.Down || resume {
+			err = errors.New("--exit-zero-on-no-pending can not be used with --down or --resume")
+			logError(logger, ErrCheckPending, err)
+			return genError(ErrCheckPending, err)
 		}
 
-		err = flags.MergeDBConfigFlags(cmd, projectConfig)
+		upToDate, version, err := checkNoPending(ctx, logger, projectConfig, driver)
 		if err != nil {
-			logError(logger, ErrMergeDBConfigFlags, err)
-			return genError(ErrMergeDBConfigFlags, err)
+			logError(logger, ErrCheckPending, err)
+			return genError(ErrCheckPending, err)
 		}
 
-		err = flags.MergeMigrationsConfigFlags(cmd, &projectConfig.Migration)
-		if err != nil {
-			logError(logger, ErrMergeMigrationLocations, err)
-			return genError(ErrMergeMigrationLocations, err)
+		if upToDate {
+			termination.Status, termination.Version = termination_up_to_date, &version
+			return nil
 		}
+	}
+
+	backup, err := newBackup(ctx, projectConfig, driver)
+	if err != nil {
+		logError(logger, ErrConfigureBackup, err)
+		return genError(ErrConfigureBackup, err)
+	}
 
-		err = flags.MergeMigrationLocations(cmd, &projectConfig.Migration)
+	if canary != "" {
+		err = runCanaryMigration(ctx, logger, canary, projectConfig, driver)
 		if err != nil {
-			logError(logger, ErrMergeMigrationLocations, err)
-			return genError(ErrMergeMigrationLocations, err)
+			logError(logger, ErrCanary, err)
+			return genError(ErrCanary, err)
+		}
+	}
+
+	repo, cleanup, err := conn.ConnectToDatabase(ctx, projectConfig, driver)
+	if err != nil {
+		logError(logger, ErrConnectToDatabase, err)
+		return genError(ErrConnectToDatabase, err)
+	}
+	defer cleanup()
+
+	resumeFilePath := filepath.Join(globalFlags.Location, internalConf.DEFAULT_RESUME_FILE)
+
+	var result *migrator.MigrationResult
+
+	migrator := migrator.NewMigrator(logger, repo, &projectConfig.Migration)
+	migrator.SetBackup(backup)
+	migrator.SetHistorySync(historySyncTable(logger, projectConfig))
+	logger = logger.With(zap.String("run_id", migrator.RunID()))
+	termination.RunID = migrator.RunID()
+	if resume {
+		point, readErr := readResumeFile(resumeFilePath)
+		if readErr != nil {
+			logError(logger, ErrReadResumeFile, readErr)
+			return genError(ErrReadResumeFile, readErr)
 		}
 
+		result, err = migrator.Resume(point)
 	} else {
-		err = flags.ExtractDBConfigFlags(cmd, projectConfig)
-		if err != nil {
-			logError(logger, ErrExtractDBConfigFlags, err)
-			return genError(ErrExtractDBConfigFlags, err)
+		result, err = migrator.Migrate()
+	}
+	if err != nil {
+		if result != nil && result.Resume != nil {
+			wErr := writeResumeFile(resumeFilePath, result.Resume)
+			if wErr != nil {
+				logError(logger, ErrWriteResumeFile, wErr)
+			} else {
+				logger.Info("Fix the issue and run migrate --resume to continue from the failure point",
+					zap.Uint16("version", result.Resume.Version), zap.Int("statement", result.Resume.Statement))
+			}
 		}
 
-		err = flags.ExtractMigrationConfigFlags(cmd, &projectConfig.Migration)
-		if err != nil {
-			logError(logger, ErrExtractConfigFromFile, err)
-			return genError(ErrExtractConfigFromFile, err)
+		if result != nil {
+			termination.Version, termination.Applied = &result.FinalVersion, result.Applied()
 		}
 
-		projectConfig.Migration.Locations = globalFlags.MigrationLocations
+		report, wErr := writeErrorReport(cmd.ErrOrStderr(), result, err, errorFormat)
+		if wErr != nil {
+			logError(logger, ErrWriteErrorReport, wErr)
+			return genError(ErrLoadMigrations, err)
+		}
+		termination.Owners = report.Owners
+		return genError(ErrLoadMigrations, errors.New(report.Summary()))
 	}
 
-	driver, ok := enums.MapStringToDriverType[projectConfig.Driver]
-	if !ok {
-		logError(logger, ErrInvalidDriver, errors.New(projectConfig.Driver))
-		return genError(ErrInvalidDriver, errors.New(projectConfig.Driver))
+	err = removeResumeFile(resumeFilePath)
+	if err != nil {
+		logError(logger, ErrWriteResumeFile, err)
+		return genError(ErrWriteResumeFile, err)
 	}
 
-	repo, cleanup, err := conn.ConnectToDatabase(ctx, projectConfig, driver)
+	termination.Version, termination.Applied = &result.FinalVersion, result.Applied()
+
+	logger.Info("Migrations executed successfully", zap.Uint16s("applied", result.Applied()),
+		zap.Uint16("version", result.FinalVersion), zap.Duration("duration", result.Duration))
+
+	return nil
+}
+
+// runCanaryMigration applies the migrations to the canary database, with a copy of the migration configuration.
+func runCanaryMigration(ctx context.Context, logger *zap.Logger, dsn string, config *conf.ProjectConfig, driver enums.DriverType) error {
+	logger.Info("Applying migrations to the canary database")
+
+	repo, cleanup, err := conn.ConnectToDSN(ctx, dsn, config, driver)
 	if err != nil {
-		logError(logger, ErrConnectToDatabase, err)
-		return genError(ErrConnectToDatabase, err)
+		return fmt.Errorf("error connecting to the canary database: %w", err)
 	}
 	defer cleanup()
 
-	migrator := migrator.NewMigrator(logger, repo, &projectConfig.Migration)
-	err = migrator.Migrate()
+	canaryConfig := config.Migration
+
+	_, err = migrator.NewMigrator(logger, repo, &canaryConfig).Migrate()
 	if err != nil {
-		return genError(ErrLoadMigrations, err)
+		return fmt.Errorf("canary run failed, the target database was not touched: %w", err)
 	}
 
-	logger.Info("Migrations executed successfully")
+	logger.Info("Canary run succeeded")
 
 	return nil
 }
+
+// checkNoPending reports whether no migration is pending in the database, and the latest applied version. The
+// database is read without taking the lock.
+func checkNoPending(ctx context.Context, logger *zap.Logger, config *conf.ProjectConfig, driver enums.DriverType) (bool, uint16, error) {
+	repo, cleanup, err := conn.ConnectToDatabase(ctx, config, driver)
+	if err != nil {
+		return false, 0, fmt.Errorf("error connecting to the database: %w", err)
+	}
+	defer cleanup()
+
+	pending, version, err := migrator.NewMigrator(logger, repo, &config.Migration).Pending()
+	if err != nil {
+		return false, 0, err
+	}
+
+	if len(pending) > 0 {
+		logger.Info("Pending migrations found", zap.Int("pending", len(pending)))
+		return false, version, nil
+	}
+
+	logger.Info("No pending migration, nothing to do", zap.Uint16("version", version))
+	return true, version, nil
+}
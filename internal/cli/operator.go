@@ -0,0 +1,103 @@
+package cli
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/maestro-go/maestro/internal/operator"
+	"github.com/maestro-go/maestro/internal/utils/logger"
+	"github.com/spf13/cobra"
+)
+
+func SetupOperatorCommand() *cobra.Command {
+	operatorCmd := &cobra.Command{
+		Use:   "operator",
+		Short: "Reconcile databases to the versions declared in Kubernetes resources",
+		Long: `The operator command runs in a Kubernetes pod, with the projects of the databases in its image, and
+reconciles each database to the version declared in a DatabaseMigration resource (see the CRD in
+.github/assets/k8s), or in a ConfigMap labelled maestro-go.github.io/migration=true, of its namespace.
+
+Each resource gives the directory of the maestro.yaml of its project, the declared version (the latest local
+migration if omitted), whether the versions above it are rolled back, and optionally the secret holding the
+data source name of the database. The phase, version, run ID and message of the outcome are written to the
+status of the resource (the maestro-go.github.io/status annotation of ConfigMaps). A failed run is not retried
+until the resource changes.
+
+The resources are watched, and all of them are reconciled again every interval. Outside of a pod, the API
+server is reached through kubectl proxy with --api-server.`,
+		RunE: runOperatorCommand,
+	}
+
+	operatorCmd.Flags().SortFlags = false
+	operatorCmd.Flags().String("namespace", "", "Namespace of the resources, the namespace of the pod if empty.")
+	operatorCmd.Flags().String("resource", operator.RESOURCE_DATABASE_MIGRATION,
+		"Kind of the resources: databasemigration or configmap.")
+	operatorCmd.Flags().Duration("interval", time.Minute, "Interval between the reconciliations of every resource.")
+	operatorCmd.Flags().Bool("once", false, "Reconciles every resource once, then exits.")
+	operatorCmd.Flags().String("api-server", "", "URL of the API server without authentication, e.g. http://127.0.0.1:8001 for kubectl proxy.")
+
+	return operatorCmd
+}
+
+func runOperatorCommand(cmd *cobra.Command, args []string) error {
+	logger, err := logger.NewLogger()
+	if err != nil {
+		log.Fatal(err)
+		return err
+	}
+
+	namespace, err := cmd.Flags().GetString("namespace")
+	if err != nil {
+		logError(logger, ErrReadNamespaceFlag, err)
+		return genError(ErrReadNamespaceFlag, err)
+	}
+
+	resource, err := cmd.Flags().GetString("resource")
+	if err != nil {
+		logError(logger, ErrReadResourceFlag, err)
+		return genError(ErrReadResourceFlag, err)
+	}
+
+	interval, err := cmd.Flags().GetDuration("interval")
+	if err != nil {
+		logError(logger, ErrReadIntervalFlag, err)
+		return genError(ErrReadIntervalFlag, err)
+	}
+
+	once, err := cmd.Flags().GetBool("once")
+	if err != nil {
+		logError(logger, ErrReadOnceFlag, err)
+		return genError(ErrReadOnceFlag, err)
+	}
+
+	apiServer, err := cmd.Flags().GetString("api-server")
+	if err != nil {
+		logError(logger, ErrReadAPIServerFlag, err)
+		return genError(ErrReadAPIServerFlag, err)
+	}
+
+	op, err := operator.NewOperator(logger, apiServer, namespace, resource, interval)
+	if err != nil {
+		logError(logger, ErrStartOperator, err)
+		return genError(ErrStartOperator, err)
+	}
+
+	// Stopped by Kubernetes with SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if once {
+		_, err = op.Resync(ctx)
+		if err != nil {
+			logError(logger, ErrReconcile, err)
+			return genError(ErrReconcile, err)
+		}
+		return nil
+	}
+
+	return op.Run(ctx)
+}
@@ -0,0 +1,66 @@
+package cli
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/maestro-go/maestro/core/migrator"
+	"github.com/maestro-go/maestro/internal/cli/flags"
+	"github.com/maestro-go/maestro/internal/utils/logger"
+	"github.com/spf13/cobra"
+)
+
+func SetupOrderCommand() *cobra.Command {
+	orderCmd := &cobra.Command{
+		Use:   "order",
+		Short: "Print the order in which migrations and hooks would be executed",
+		Long: `The order command prints the migrations and hooks that the migrate command would execute, in execution
+order, once the files are sorted and filtered and the hook options of the configuration are applied, so setups
+with many hooks can be reviewed without running anything. The database is not accessed: --from gives the latest
+applied version the run would start from, and every step is assumed to succeed.`,
+		RunE: runOrderCommand,
+	}
+
+	orderCmd.Flags().SortFlags = false
+	flags.SetupMigrationConfigFlags(orderCmd)
+	orderCmd.Flags().Uint16("from", 0, "Latest applied version the run would start from.")
+
+	return orderCmd
+}
+
+func runOrderCommand(cmd *cobra.Command, args []string) error {
+	logger, err := logger.NewLogger()
+	if err != nil {
+		log.Fatal(err)
+		return err
+	}
+
+	from, err := cmd.Flags().GetUint16("from")
+	if err != nil {
+		logError(logger, ErrReadFromFlag, err)
+		return genError(ErrReadFromFlag, err)
+	}
+
+	projectConfig, removeLocations, err := loadProjectConfig(cmd, logger)
+	if err != nil {
+		return err
+	}
+	defer removeLocations()
+
+	steps, err := migrator.Order(&projectConfig.Migration, from)
+	if err != nil {
+		logError(logger, ErrOrder, err)
+		return genError(ErrOrder, err)
+	}
+
+	if len(steps) == 0 {
+		fmt.Fprintln(cmd.OutOrStdout(), "Nothing to execute")
+		return nil
+	}
+
+	for i, step := range steps {
+		fmt.Fprintf(cmd.OutOrStdout(), "%3d. %s\n", i+1, step)
+	}
+
+	return nil
+}
@@ -0,0 +1,81 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	_ "github.com/lib/pq"
+	"github.com/maestro-go/maestro/core/enums"
+	"github.com/maestro-go/maestro/internal/cli/conn"
+	"github.com/maestro-go/maestro/internal/cli/flags"
+	"github.com/maestro-go/maestro/internal/utils/logger"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+func SetupPingCommand() *cobra.Command {
+	pingCmd := &cobra.Command{
+		Use:   "ping",
+		Short: "Check the connection to the database",
+		Long: `The ping command connects to the database with the configured settings and reports the server version,
+the current schema, whether the schema history table exists and its number of rows.
+
+The command exits with a non-zero status if the database can not be reached, which makes it a cheap smoke test
+for deploy pipelines. It does not read migration files nor change the database.`,
+		RunE: runPingCommand,
+	}
+
+	pingCmd.Flags().SortFlags = false
+	flags.SetupDBConfigFlags(pingCmd)
+
+	return pingCmd
+}
+
+func runPingCommand(cmd *cobra.Command, args []string) error {
+	logger, err := logger.NewLogger()
+	if err != nil {
+		log.Fatal(err)
+		return err
+	}
+
+	ctx := context.Background()
+
+	projectConfig, removeLocations, err := loadProjectConfig(cmd, logger)
+	if err != nil {
+		return err
+	}
+	defer removeLocations()
+
+	driver, ok := enums.MapStringToDriverType[projectConfig.Driver]
+	if !ok {
+		logError(logger, ErrInvalidDriver, errors.New(projectConfig.Driver))
+		return genError(ErrInvalidDriver, errors.New(projectConfig.Driver))
+	}
+
+	repo, cleanup, err := conn.ConnectToDatabaseReadOnly(ctx, projectConfig, driver)
+	if err != nil {
+		logError(logger, ErrConnectToDatabase, err)
+		return genError(ErrConnectToDatabase, err)
+	}
+	defer cleanup()
+
+	info, err := repo.ServerInfo()
+	if err != nil {
+		logError(logger, ErrServerInfo, err)
+		return genError(ErrServerInfo, err)
+	}
+
+	logger.Info("Database is reachable", zap.String("driver", projectConfig.Driver),
+		zap.String("server version", info.Version), zap.String("schema", info.Schema))
+
+	if !info.HistoryTableExists {
+		logger.Info("Schema history table does not exist", zap.String("history table", info.HistoryTable))
+		return nil
+	}
+
+	logger.Info("Schema history table exists", zap.String("history table", info.HistoryTable),
+		zap.Int64("rows", info.HistoryRows))
+
+	return nil
+}
@@ -0,0 +1,137 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/maestro-go/maestro/core/enums"
+	"github.com/maestro-go/maestro/core/migrator"
+	"github.com/maestro-go/maestro/internal/cli/conn"
+	"github.com/maestro-go/maestro/internal/cli/flags"
+	"github.com/maestro-go/maestro/internal/utils/logger"
+	"github.com/spf13/cobra"
+)
+
+// Outputs of the plan command
+const (
+	plan_output_text = "text"
+	plan_output_json = "json"
+)
+
+func SetupPlanCommand() *cobra.Command {
+	planCmd := &cobra.Command{
+		Use:   "plan",
+		Short: "Print the migrations the migrate command would apply or roll back",
+		Long: `The plan command prints what the migrate command would do with the same flags: the migrations it would
+apply, record as applied without executing them (--skip-versions) or roll back (--down), in execution order,
+with their checksums and whether they are destructive, and the applied migrations whose local file changed.
+The database is only read: the lock is not taken, no hook is executed and the migrations are not validated.
+
+With --output json, the plan is printed as a JSON document with a versioned schema (format_version), for
+external tools such as Terraform providers or review bots to consume and diff. The document has no time, and
+its lists are always present and ordered, so the plans of the same state are identical. Logs are written to
+stderr.`,
+		RunE: runPlanCommand,
+	}
+
+	planCmd.Flags().SortFlags = false
+	flags.SetupDBConfigFlags(planCmd)
+	flags.SetupMigrationConfigFlags(planCmd)
+	planCmd.Flags().String("output", plan_output_text, "Format of the plan printed to stdout (text or json).")
+
+	return planCmd
+}
+
+func runPlanCommand(cmd *cobra.Command, args []string) error {
+	logger, err := logger.NewLogger()
+	if err != nil {
+		log.Fatal(err)
+		return err
+	}
+
+	ctx := context.Background()
+
+	output, err := cmd.Flags().GetString("output")
+	if err == nil && output != plan_output_text && output != plan_output_json {
+		err = fmt.Errorf("unknown output %s, expected %s or %s", output, plan_output_text, plan_output_json)
+	}
+	if err != nil {
+		logError(logger, ErrReadOutputFlag, err)
+		return genError(ErrReadOutputFlag, err)
+	}
+
+	projectConfig, removeLocations, err := loadProjectConfig(cmd, logger)
+	if err != nil {
+		return err
+	}
+	defer removeLocations()
+
+	driver, ok := enums.MapStringToDriverType[projectConfig.Driver]
+	if !ok {
+		logError(logger, ErrInvalidDriver, errors.New(projectConfig.Driver))
+		return genError(ErrInvalidDriver, errors.New(projectConfig.Driver))
+	}
+
+	repo, cleanup, err := conn.ConnectToDatabaseReadOnly(ctx, projectConfig, driver)
+	if err != nil {
+		logError(logger, ErrConnectToDatabase, err)
+		return genError(ErrConnectToDatabase, err)
+	}
+	defer cleanup()
+
+	plan, err := migrator.NewMigrator(logger, repo, &projectConfig.Migration).Plan()
+	if err != nil {
+		logError(logger, ErrPlan, err)
+		return genError(ErrPlan, err)
+	}
+
+	if output == plan_output_json {
+		err = writePlanJSON(cmd.OutOrStdout(), plan)
+	} else {
+		err = writePlan(cmd.OutOrStdout(), plan)
+	}
+	if err != nil {
+		logError(logger, ErrWriteOutput, err)
+		return genError(ErrWriteOutput, err)
+	}
+
+	return nil
+}
+
+// writePlanJSON writes the plan as an indented JSON document, so the plans can be diffed line by line.
+func writePlanJSON(out io.Writer, plan *migrator.Plan) error {
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(plan)
+}
+
+// writePlan writes the actions of the plan, one per line, the drift and the summary.
+func writePlan(out io.Writer, plan *migrator.Plan) error {
+	fmt.Fprintf(out, "Current version %d, target version %d (%s)\n", plan.CurrentVersion, plan.TargetVersion,
+		plan.Direction)
+
+	if len(plan.Actions) == 0 {
+		fmt.Fprintln(out, "Nothing to execute")
+	}
+
+	for _, action := range plan.Actions {
+		line := fmt.Sprintf("  %-8s %d %s (%s)", action.Action, action.Version, action.Description, action.Checksum)
+		if action.Destructive {
+			line += " DESTRUCTIVE"
+		}
+		fmt.Fprintln(out, line)
+	}
+
+	for _, drift := range plan.Drift {
+		fmt.Fprintf(out, "  changed  %d %s (applied %s, local %s)\n", drift.Version, drift.Description,
+			drift.AppliedChecksum, drift.LocalChecksum)
+	}
+
+	_, err := fmt.Fprintf(out, "%d to apply, %d to skip, %d to roll back, %d destructive, %d changed\n",
+		plan.Summary.Apply, plan.Summary.Skip, plan.Summary.Rollback, plan.Summary.Destructive, plan.Summary.Drift)
+	return err
+}
@@ -0,0 +1,92 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	_ "github.com/lib/pq"
+	"github.com/maestro-go/maestro/core/enums"
+	"github.com/maestro-go/maestro/core/migrator"
+	"github.com/maestro-go/maestro/internal/cli/conn"
+	"github.com/maestro-go/maestro/internal/cli/flags"
+	"github.com/maestro-go/maestro/internal/utils/logger"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+func SetupRedoCommand() *cobra.Command {
+	redoCmd := &cobra.Command{
+		Use:   "redo",
+		Short: "Roll back and re-apply the latest migration",
+		Long: `The redo command rolls back the latest applied migration and immediately applies it again.
+
+Use --version to redo a specific migration. Migrations applied after it are also rolled back and applied again.
+The command refuses to run against protected databases ("protected: true").`,
+		RunE: runRedoCommand,
+	}
+
+	redoCmd.Flags().SortFlags = false
+	redoCmd.Flags().Uint16("version", 0, "Migration version to redo. Defaults to the latest applied migration.")
+	flags.SetupDBConfigFlags(redoCmd)
+
+	return redoCmd
+}
+
+func runRedoCommand(cmd *cobra.Command, args []string) error {
+	logger, err := logger.NewLogger()
+	if err != nil {
+		log.Fatal(err)
+		return err
+	}
+
+	ctx := context.Background()
+
+	var version *uint16
+	if cmd.Flags().Changed("version") {
+		v, err := cmd.Flags().GetUint16("version")
+		if err != nil {
+			logError(logger, ErrReadVersionFlag, err)
+			return genError(ErrReadVersionFlag, err)
+		}
+		version = &v
+	}
+
+	projectConfig, removeLocations, err := loadProjectConfig(cmd, logger)
+	if err != nil {
+		return err
+	}
+	defer removeLocations()
+
+	err = checkNotProtected(projectConfig, "redo")
+	if err != nil {
+		logError(logger, ErrProtectedDatabase, err)
+		return genError(ErrProtectedDatabase, err)
+	}
+
+	driver, ok := enums.MapStringToDriverType[projectConfig.Driver]
+	if !ok {
+		logError(logger, ErrInvalidDriver, errors.New(projectConfig.Driver))
+		return genError(ErrInvalidDriver, errors.New(projectConfig.Driver))
+	}
+
+	repo, cleanup, err := conn.ConnectToDatabase(ctx, projectConfig, driver)
+	if err != nil {
+		logError(logger, ErrConnectToDatabase, err)
+		return genError(ErrConnectToDatabase, err)
+	}
+	defer cleanup()
+
+	migrator := migrator.NewMigrator(logger, repo, &projectConfig.Migration)
+	migrator.SetHistorySync(historySyncTable(logger, projectConfig))
+	logger = logger.With(zap.String("run_id", migrator.RunID()))
+	err = migrator.Redo(version)
+	if err != nil {
+		logError(logger, ErrRedo, err)
+		return genError(ErrRedo, err)
+	}
+
+	logger.Info("Migrations redone successfully")
+
+	return nil
+}
@@ -0,0 +1,133 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/maestro-go/maestro/core/enums"
+	"github.com/maestro-go/maestro/internal/filesystem"
+	"github.com/maestro-go/maestro/internal/migrations"
+	"github.com/maestro-go/maestro/internal/utils/logger"
+	"github.com/spf13/cobra"
+)
+
+func SetupRenderCommand() *cobra.Command {
+	renderCmd := &cobra.Command{
+		Use:   "render [version|file]",
+		Short: "Print the rendered content of a migration or hook",
+		Long: `The render command prints the content of a migration or hook as it is executed, with the templates
+replaced and the directives expanded, to review it before running it. Given a version, the up migration of
+this version is printed (or its down migration with --down). Given a file, the migration or hook file is
+printed; the context variables of hooks known before the run are replaced too. The database is not accessed.`,
+		Args: cobra.ExactArgs(1),
+		RunE: runRenderCommand,
+	}
+
+	renderCmd.Flags().Bool("down", false, "Print the down migration of the version.")
+
+	return renderCmd
+}
+
+func runRenderCommand(cmd *cobra.Command, args []string) error {
+	logger, err := logger.NewLogger()
+	if err != nil {
+		log.Fatal(err)
+		return err
+	}
+
+	down, err := cmd.Flags().GetBool("down")
+	if err != nil {
+		logError(logger, ErrReadDownFlag, err)
+		return genError(ErrReadDownFlag, err)
+	}
+
+	projectConfig, removeLocations, err := loadProjectConfig(cmd, logger)
+	if err != nil {
+		return err
+	}
+	defer removeLocations()
+
+	// Down migrations are loaded too, to print them and to resolve the description of down hooks
+	localConfig := projectConfig.Migration
+	localConfig.Down = true
+
+	migrationsMap, _, errs := filesystem.LoadObjectsFromFiles(&localConfig)
+	if len(errs) > 0 {
+		logErrors(logger, ErrLoadMigrations, errs)
+		return errors.Join(errs...)
+	}
+
+	version, err := strconv.ParseUint(args[0], 10, 16)
+	if err == nil {
+		migrationType := enums.MIGRATION_UP
+		if down {
+			migrationType = enums.MIGRATION_DOWN
+		}
+
+		migration := findMigration(migrationsMap[migrationType], uint16(version))
+		if migration == nil {
+			err = fmt.Errorf("version %d", version)
+			logError(logger, ErrMigrationNotFound, err)
+			return genError(ErrMigrationNotFound, err)
+		}
+
+		fmt.Fprintln(cmd.OutOrStdout(), *migration.Content)
+		return nil
+	}
+
+	migration, hook, err := filesystem.LoadFile(&projectConfig.Migration, args[0])
+	if err != nil {
+		logError(logger, ErrRenderFile, err)
+		return genError(ErrRenderFile, err)
+	}
+
+	if migration != nil {
+		fmt.Fprintln(cmd.OutOrStdout(), *migration.Content)
+		return nil
+	}
+
+	hook = hook.WithVariables(renderHookVariables(hook, migrationsMap))
+	fmt.Fprintln(cmd.OutOrStdout(), *hook.Content)
+	return nil
+}
+
+// renderHookVariables returns the context variables of the hook known before the run: the direction, and the
+// version and description of the migration of versioned hooks. The run ID is left as a placeholder.
+func renderHookVariables(hook *migrations.Hook,
+	migrationsMap map[enums.MigrationType][]*migrations.Migration) map[string]string {
+
+	variables := map[string]string{
+		"version":     "",
+		"description": "",
+		"direction":   "up",
+	}
+
+	migrationType := enums.MIGRATION_UP
+	switch hook.Type {
+	case enums.HOOK_REPEATABLE_DOWN, enums.HOOK_BEFORE_VERSION_DOWN, enums.HOOK_AFTER_VERSION_DOWN:
+		variables["direction"] = "down"
+		migrationType = enums.MIGRATION_DOWN
+	}
+
+	switch hook.Type {
+	case enums.HOOK_BEFORE_VERSION, enums.HOOK_AFTER_VERSION,
+		enums.HOOK_BEFORE_VERSION_DOWN, enums.HOOK_AFTER_VERSION_DOWN:
+		variables["version"] = strconv.Itoa(int(hook.Version))
+		if migration := findMigration(migrationsMap[migrationType], hook.Version); migration != nil {
+			variables["description"] = migration.Description
+		}
+	}
+
+	return variables
+}
+
+func findMigration(migrationsSlice []*migrations.Migration, version uint16) *migrations.Migration {
+	for _, migration := range migrationsSlice {
+		if migration.Version == version {
+			return migration
+		}
+	}
+	return nil
+}
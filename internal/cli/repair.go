@@ -4,14 +4,11 @@ import (
 	"context"
 	"errors"
 	"log"
-	"path/filepath"
 
 	_ "github.com/lib/pq"
-	"github.com/maestro-go/maestro/core/conf"
 	"github.com/maestro-go/maestro/core/enums"
 	"github.com/maestro-go/maestro/internal/cli/conn"
 	"github.com/maestro-go/maestro/internal/cli/flags"
-	internalConf "github.com/maestro-go/maestro/internal/conf"
 	"github.com/maestro-go/maestro/internal/filesystem"
 	"github.com/maestro-go/maestro/internal/utils/logger"
 	"github.com/spf13/cobra"
@@ -40,44 +37,11 @@ func runRepairCommand(cmd *cobra.Command, args []string) error {
 
 	ctx := context.Background()
 
-	globalFlags, err := flags.ExtractGlobalFlags(cmd)
+	projectConfig, removeLocations, err := loadProjectConfig(cmd, logger)
 	if err != nil {
-		logError(logger, ErrExtractGlobalFlags, err)
-		return genError(ErrExtractGlobalFlags, err)
-	}
-
-	configFilePath := filepath.Join(globalFlags.Location, internalConf.DEFAULT_PROJECT_FILE)
-	exists, err := filesystem.CheckFSObject(configFilePath)
-	if err != nil {
-		logError(logger, ErrCheckFile, err)
-		return genError(ErrCheckFile, err)
-	}
-
-	projectConfig := &conf.ProjectConfig{}
-	if exists {
-		logger.Info("Located config file")
-
-		err = conf.LoadConfigFromFile(configFilePath, projectConfig)
-		if err != nil {
-			logError(logger, ErrLoadConfigFromFile, err)
-			return genError(ErrLoadConfigFromFile, err)
-		}
-
-		err = flags.MergeDBConfigFlags(cmd, projectConfig)
-		if err != nil {
-			logError(logger, ErrMergeDBConfigFlags, err)
-			return genError(ErrMergeDBConfigFlags, err)
-		}
-
-	} else {
-		err = flags.ExtractDBConfigFlags(cmd, projectConfig)
-		if err != nil {
-			logError(logger, ErrExtractDBConfigFlags, err)
-			return genError(ErrExtractDBConfigFlags, err)
-		}
-
-		projectConfig.Migration.Locations = globalFlags.MigrationLocations
+		return err
 	}
+	defer removeLocations()
 
 	driver, ok := enums.MapStringToDriverType[projectConfig.Driver]
 	if !ok {
@@ -104,6 +68,12 @@ func runRepairCommand(cmd *cobra.Command, args []string) error {
 		return errors.Join(errs...)
 	}
 
+	err = syncHistoryTable(logger, repo, projectConfig)
+	if err != nil {
+		logError(logger, ErrSyncHistoryTable, err)
+		return genError(ErrSyncHistoryTable, err)
+	}
+
 	logger.Info("Migrations repaired successfully")
 
 	return nil
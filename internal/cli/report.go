@@ -0,0 +1,77 @@
+package cli
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/maestro-go/maestro/internal/cli/flags"
+	"github.com/maestro-go/maestro/internal/report"
+	"github.com/maestro-go/maestro/internal/utils/logger"
+	"github.com/spf13/cobra"
+)
+
+func SetupReportCommand() *cobra.Command {
+	reportCmd := &cobra.Command{
+		Use:   "report",
+		Short: "Generate reports of the migrations",
+		Long:  `Generate reports of the migrations, e.g. for the pull requests of a branch.`,
+	}
+
+	prCmd := &cobra.Command{
+		Use:   "pr",
+		Short: "Print a markdown report of the migrations changed by the branch",
+		Long: `The pr command compares the migrations of the branch (HEAD) with the merge base of --base, as git diff does,
+and prints a markdown report for bots to post as a comment of the pull request, on GitHub, GitLab or elsewhere:
+the added migrations, pending once the branch is merged, and the warnings about destructive migrations, missing
+down migrations, migrations out of order, and migrations modified or deleted while they may be applied. The local
+migrations are loaded and validated as in a run, and their errors reported.
+
+The report starts with the "<!-- maestro-report -->" line, so bots find their previous comment to update it.
+The command fails only when the report can not be generated, so the comment is posted when problems are found.
+The database is not accessed.`,
+		RunE: runReportPRCommand,
+	}
+
+	prCmd.Flags().SortFlags = false
+	prCmd.Flags().String("base", "", "Git ref the branch is merged into, e.g. origin/main.")
+	prCmd.MarkFlagRequired("base")
+	flags.SetupMigrationConfigFlags(prCmd)
+
+	reportCmd.AddCommand(prCmd)
+
+	return reportCmd
+}
+
+func runReportPRCommand(cmd *cobra.Command, args []string) error {
+	logger, err := logger.NewLogger()
+	if err != nil {
+		log.Fatal(err)
+		return err
+	}
+
+	base, err := cmd.Flags().GetString("base")
+	if err != nil {
+		logError(logger, ErrReadBaseFlag, err)
+		return genError(ErrReadBaseFlag, err)
+	}
+
+	projectConfig, removeLocations, err := loadProjectConfig(cmd, logger)
+	if err != nil {
+		return err
+	}
+	defer removeLocations()
+
+	changes, err := report.ChangedFiles(base, projectConfig.Migration.Locations)
+	if err != nil {
+		logError(logger, ErrChangedFiles, err)
+		return genError(ErrChangedFiles, err)
+	}
+
+	_, err = fmt.Fprint(cmd.OutOrStdout(), report.NewPullRequest(&projectConfig.Migration, base, changes).Markdown())
+	if err != nil {
+		logError(logger, ErrWriteOutput, err)
+		return genError(ErrWriteOutput, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,237 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+
+	"github.com/maestro-go/maestro/core/conf"
+	"github.com/maestro-go/maestro/core/database"
+	"github.com/maestro-go/maestro/core/enums"
+	"github.com/maestro-go/maestro/core/migrator"
+	"github.com/maestro-go/maestro/internal/cli/conn"
+	"github.com/maestro-go/maestro/internal/cli/flags"
+	"github.com/maestro-go/maestro/internal/filesystem"
+	"github.com/maestro-go/maestro/internal/migrations"
+	"github.com/maestro-go/maestro/internal/utils/logger"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+func SetupReproduceCommand() *cobra.Command {
+	reproduceCmd := &cobra.Command{
+		Use:   "reproduce",
+		Short: "Build a scratch database at a historical version",
+		Long: `The reproduce command builds a scratch database at the schema a database had at a given version or time,
+e.g. to debug a bug reported against an older schema. The local migrations up to that version are applied
+to the empty scratch database of the target data source name.
+
+With a time (a date, meaning the end of that day, or a date and time, in the time zone of the database), the
+version is read from the execution times of the schema history table of the configured database, which is
+only read. The migrations applied at that time must have a file: the migrations archived out of the project
+are loaded from the directories given with --archive. The files changed since they were applied, and the
+versions whose state at that time is unknown, as they were executed again or rolled back since then, are
+reported.`,
+		RunE: runReproduceCommand,
+	}
+
+	reproduceCmd.Flags().SortFlags = false
+	reproduceCmd.Flags().String("at", "", "Version, date or time (e.g. 42, 2024-05-01 or \"2024-05-01 14:30\") to reproduce.")
+	reproduceCmd.Flags().String("target", "", "Data source name of the empty scratch database to build.")
+	reproduceCmd.Flags().StringSlice("archive", nil, "Directories of the migrations archived out of the migration locations.")
+	reproduceCmd.MarkFlagRequired("at")
+	reproduceCmd.MarkFlagRequired("target")
+	flags.SetupDBConfigFlags(reproduceCmd)
+
+	return reproduceCmd
+}
+
+func runReproduceCommand(cmd *cobra.Command, args []string) error {
+	logger, err := logger.NewLogger()
+	if err != nil {
+		log.Fatal(err)
+		return err
+	}
+
+	ctx := context.Background()
+
+	at, err := cmd.Flags().GetString("at")
+	if err != nil {
+		logError(logger, ErrReadAtFlag, err)
+		return genError(ErrReadAtFlag, err)
+	}
+
+	target, err := cmd.Flags().GetString("target")
+	if err != nil {
+		logError(logger, ErrReadTargetFlag, err)
+		return genError(ErrReadTargetFlag, err)
+	}
+
+	archives, err := cmd.Flags().GetStringSlice("archive")
+	if err != nil {
+		logError(logger, ErrReadArchiveFlag, err)
+		return genError(ErrReadArchiveFlag, err)
+	}
+
+	projectConfig, removeLocations, err := loadProjectConfig(cmd, logger)
+	if err != nil {
+		return err
+	}
+	defer removeLocations()
+
+	driver, ok := enums.MapStringToDriverType[projectConfig.Driver]
+	if !ok {
+		logError(logger, ErrInvalidDriver, errors.New(projectConfig.Driver))
+		return genError(ErrInvalidDriver, errors.New(projectConfig.Driver))
+	}
+
+	// The archived migrations are loaded with the ones of the locations
+	reproduceConfig := projectConfig.Migration
+	reproduceConfig.Locations = append(slices.Clone(reproduceConfig.Locations), archives...)
+	reproduceConfig.Down = false
+	reproduceConfig.DestinationName = ""
+	reproduceConfig.SkipVersions = nil
+
+	migrationsMap, _, errs := filesystem.LoadObjectsFromFiles(&reproduceConfig)
+	if len(errs) > 0 {
+		logErrors(logger, ErrLoadMigrations, errs)
+		return errors.Join(errs...)
+	}
+
+	version, err := reproducedVersion(ctx, logger, at, projectConfig, driver, migrationsMap[enums.MIGRATION_UP])
+	if err != nil {
+		logError(logger, ErrReproduce, err)
+		return genError(ErrReproduce, err)
+	}
+
+	repo, cleanup, err := conn.ConnectToDSN(ctx, target, projectConfig, driver)
+	if err != nil {
+		logError(logger, ErrConnectToDatabase, err)
+		return genError(ErrConnectToDatabase, err)
+	}
+	defer cleanup()
+
+	// Migrations applied to the target would be mixed with the reproduced ones
+	applied, err := repo.GetAppliedMigrations()
+	if err != nil {
+		logError(logger, ErrGetAppliedMigrations, err)
+		return genError(ErrGetAppliedMigrations, err)
+	}
+
+	if len(applied) > 0 {
+		err = fmt.Errorf("the target database already has %d migrations in its schema history table, "+
+			"reproduce builds an empty scratch database", len(applied))
+		logError(logger, ErrReproduce, err)
+		return genError(ErrReproduce, err)
+	}
+
+	if version == 0 {
+		logger.Info("No migration was applied at that time, the target database is left empty")
+		return nil
+	}
+
+	reproduceConfig.Destination = &version
+
+	result, err := migrator.NewMigrator(logger, repo, &reproduceConfig).Migrate()
+	if err != nil {
+		logError(logger, ErrReproduce, err)
+		return genError(ErrReproduce, err)
+	}
+
+	logger.Info("Target database reproduced", zap.String("at", at), zap.Uint16("version", result.FinalVersion),
+		zap.Uint16s("applied", result.Applied()))
+
+	return nil
+}
+
+// reproducedVersion returns the version to reproduce: the version of the at flag, or the version the configured
+// database was at on the time of the at flag. With a time, the migrations applied at that time without local
+// file fail the command, and the changed files and the versions whose state at that time is unknown are
+// reported.
+func reproducedVersion(ctx context.Context, logger *zap.Logger, at string, config *conf.ProjectConfig,
+	driver enums.DriverType, local []*migrations.Migration) (uint16, error) {
+
+	head := uint16(0)
+	byVersion := make(map[uint16]*migrations.Migration, len(local))
+	for _, migration := range local {
+		byVersion[migration.Version] = migration
+		head = max(head, migration.Version)
+	}
+
+	if version, err := strconv.ParseUint(at, 10, 16); err == nil {
+		if uint16(version) > head {
+			return 0, fmt.Errorf("version %d is above the latest local migration %d", version, head)
+		}
+		return uint16(version), nil
+	}
+
+	atTime, err := parseHistoryTime(at)
+	if err != nil {
+		return 0, err
+	}
+
+	repo, cleanup, err := conn.ConnectToDatabaseReadOnly(ctx, config, driver)
+	if err != nil {
+		return 0, fmt.Errorf("error connecting to the database: %w", err)
+	}
+	defer cleanup()
+
+	history, err := repo.GetAppliedMigrations()
+	if err != nil {
+		return 0, err
+	}
+
+	snapshot, err := database.SnapshotAt(history, atTime)
+	if err != nil {
+		return 0, err
+	}
+
+	logger.Info("Version at that time", zap.Time("at", atTime), zap.Uint16("version", snapshot.Version),
+		zap.Int("applied migrations", len(snapshot.Applied)))
+
+	missing := make([]uint16, 0)
+	for _, applied := range snapshot.Applied {
+		migration, ok := byVersion[applied.Version]
+		if !ok {
+			missing = append(missing, applied.Version)
+			continue
+		}
+
+		if *migration.Checksum != applied.Checksum {
+			logger.Warn("The migration file changed since it was applied, the current file is applied",
+				appliedMigrationFields(applied)...)
+		}
+	}
+
+	if len(missing) > 0 {
+		return 0, fmt.Errorf("versions %v were applied at that time but have no migration file, "+
+			"give the directories of the archived migrations with --archive", missing)
+	}
+
+	// Only the latest execution of each version is recorded
+	inSnapshot := make(map[uint16]bool, len(snapshot.Applied))
+	for _, applied := range snapshot.Applied {
+		inSnapshot[applied.Version] = true
+	}
+
+	for _, later := range snapshot.Later {
+		if later.Version < snapshot.Version && byVersion[later.Version] != nil {
+			inSnapshot[later.Version] = true
+			logger.Warn("Executed again or out of order after that time, its state at that time is unknown, "+
+				"the migration is applied", appliedMigrationFields(later)...)
+		}
+	}
+
+	for _, migration := range local {
+		if migration.Version < snapshot.Version && !inSnapshot[migration.Version] {
+			logger.Warn("Not in the schema history table, rolled back since then or never applied, "+
+				"the migration is applied", zap.Uint16("version", migration.Version),
+				zap.String("description", migration.Description))
+		}
+	}
+
+	return snapshot.Version, nil
+}
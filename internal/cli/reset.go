@@ -0,0 +1,89 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	_ "github.com/lib/pq"
+	"github.com/maestro-go/maestro/core/enums"
+	"github.com/maestro-go/maestro/core/migrator"
+	"github.com/maestro-go/maestro/internal/cli/conn"
+	"github.com/maestro-go/maestro/internal/cli/flags"
+	"github.com/maestro-go/maestro/internal/utils/logger"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+func SetupResetCommand() *cobra.Command {
+	resetCmd := &cobra.Command{
+		Use:   "reset",
+		Short: "Roll back all migrations and apply them again",
+		Long: `The reset command rolls back every applied migration, down to version 0, and then applies all migrations again.
+
+Every up migration must have a corresponding down migration.
+The command asks for confirmation unless --yes is given, and refuses to run against protected databases ("protected: true").`,
+		RunE: runResetCommand,
+	}
+
+	resetCmd.Flags().SortFlags = false
+	resetCmd.Flags().BoolP("yes", "y", false, "Skip the confirmation prompt.")
+	flags.SetupDBConfigFlags(resetCmd)
+
+	return resetCmd
+}
+
+func runResetCommand(cmd *cobra.Command, args []string) error {
+	logger, err := logger.NewLogger()
+	if err != nil {
+		log.Fatal(err)
+		return err
+	}
+
+	ctx := context.Background()
+
+	projectConfig, removeLocations, err := loadProjectConfig(cmd, logger)
+	if err != nil {
+		return err
+	}
+	defer removeLocations()
+
+	err = checkNotProtected(projectConfig, "reset")
+	if err != nil {
+		logError(logger, ErrProtectedDatabase, err)
+		return genError(ErrProtectedDatabase, err)
+	}
+
+	err = confirmAction(cmd, fmt.Sprintf("This will roll back all migrations of database %s and apply them again.",
+		projectConfig.Database))
+	if err != nil {
+		logError(logger, ErrConfirmation, err)
+		return genError(ErrConfirmation, err)
+	}
+
+	driver, ok := enums.MapStringToDriverType[projectConfig.Driver]
+	if !ok {
+		logError(logger, ErrInvalidDriver, errors.New(projectConfig.Driver))
+		return genError(ErrInvalidDriver, errors.New(projectConfig.Driver))
+	}
+
+	repo, cleanup, err := conn.ConnectToDatabase(ctx, projectConfig, driver)
+	if err != nil {
+		logError(logger, ErrConnectToDatabase, err)
+		return genError(ErrConnectToDatabase, err)
+	}
+	defer cleanup()
+
+	migrator := migrator.NewMigrator(logger, repo, &projectConfig.Migration)
+	migrator.SetHistorySync(historySyncTable(logger, projectConfig))
+	logger = logger.With(zap.String("run_id", migrator.RunID()))
+	err = migrator.Reset()
+	if err != nil {
+		return genError(ErrLoadMigrations, err)
+	}
+
+	logger.Info("Database reset successfully")
+
+	return nil
+}
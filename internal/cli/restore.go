@@ -0,0 +1,234 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/maestro-go/maestro/core/conf"
+	"github.com/maestro-go/maestro/core/enums"
+	"github.com/maestro-go/maestro/core/migrator"
+	"github.com/maestro-go/maestro/core/remote"
+	"github.com/maestro-go/maestro/internal/cli/conn"
+	"github.com/maestro-go/maestro/internal/cli/flags"
+	"github.com/maestro-go/maestro/internal/utils/logger"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+func SetupRestoreCommand() *cobra.Command {
+	restoreCmd := &cobra.Command{
+		Use:   "restore",
+		Short: "Restore a backup taken before destructive migrations",
+		Long: `The restore command restores a backup taken by the migrate command before destructive migrations
+("backup" configuration), given the file or the bucket URL of its dump, and reconciles the schema history
+table with it: the versions applied after the backup are removed from the history, so the next migrate
+applies them again.
+
+PostgreSQL and Greenplum dumps are restored with pg_restore, replacing the objects they contain, and MariaDB
+dumps with the mysql client. When the backup contains the current schema, its objects created after the
+backup are dropped first, like the clean command does. The manifest written next to the dump (<dump>.json)
+is required, and the backup must be one of the configured database.
+
+The command asks for confirmation unless --yes is given, and refuses to run against protected databases ("protected: true").`,
+		RunE: runRestoreCommand,
+	}
+
+	restoreCmd.Flags().SortFlags = false
+	restoreCmd.Flags().String("backup", "", "File or s3:// or gs:// URL of the dump to restore.")
+	restoreCmd.Flags().BoolP("yes", "y", false, "Skip the confirmation prompt.")
+	restoreCmd.MarkFlagRequired("backup")
+	flags.SetupDBConfigFlags(restoreCmd)
+
+	return restoreCmd
+}
+
+func runRestoreCommand(cmd *cobra.Command, args []string) error {
+	logger, err := logger.NewLogger()
+	if err != nil {
+		log.Fatal(err)
+		return err
+	}
+
+	ctx := context.Background()
+
+	location, err := cmd.Flags().GetString("backup")
+	if err != nil {
+		logError(logger, ErrReadBackupFlag, err)
+		return genError(ErrReadBackupFlag, err)
+	}
+
+	projectConfig, removeLocations, err := loadProjectConfig(cmd, logger)
+	if err != nil {
+		return err
+	}
+	defer removeLocations()
+
+	err = checkNotProtected(projectConfig, "restore")
+	if err != nil {
+		logError(logger, ErrProtectedDatabase, err)
+		return genError(ErrProtectedDatabase, err)
+	}
+
+	driver, ok := enums.MapStringToDriverType[projectConfig.Driver]
+	if !ok {
+		logError(logger, ErrInvalidDriver, errors.New(projectConfig.Driver))
+		return genError(ErrInvalidDriver, errors.New(projectConfig.Driver))
+	}
+
+	file, manifest, removeDownload, err := fetchBackup(ctx, location)
+	if err != nil {
+		logError(logger, ErrReadBackup, err)
+		return genError(ErrReadBackup, err)
+	}
+	defer removeDownload()
+
+	err = checkBackup(projectConfig, driver, manifest)
+	if err != nil {
+		logError(logger, ErrReadBackup, err)
+		return genError(ErrReadBackup, err)
+	}
+
+	err = confirmAction(cmd, fmt.Sprintf("This will replace %s of database %s with the backup taken at %s, at version %d.",
+		strings.Join(manifest.Schemas, ", "), projectConfig.Database, manifest.CreatedAt.Format("2006-01-02 15:04:05 MST"),
+		manifest.LatestVersion))
+	if err != nil {
+		logError(logger, ErrConfirmation, err)
+		return genError(ErrConfirmation, err)
+	}
+
+	repo, cleanup, err := conn.ConnectToDatabase(ctx, projectConfig, driver)
+	if err != nil {
+		logError(logger, ErrConnectToDatabase, err)
+		return genError(ErrConnectToDatabase, err)
+	}
+	defer cleanup()
+
+	// The objects of the current schema created after the backup are not replaced by the restore
+	current := projectConfig.Schema
+	if driver == enums.DRIVER_MARIADB {
+		current = projectConfig.Database
+	}
+	clean := slices.Contains(manifest.Schemas, current)
+
+	migrator := migrator.NewMigrator(logger, repo, &projectConfig.Migration)
+	migrator.SetHistorySync(historySyncTable(logger, projectConfig))
+	logger = logger.With(zap.String("run_id", migrator.RunID()))
+	removed, err := migrator.Restore(func() error {
+		if clean {
+			err := repo.Clean()
+			if err != nil {
+				return fmt.Errorf("error cleaning database: %w", err)
+			}
+		}
+		return restoreBackup(ctx, projectConfig, driver, file)
+	}, manifest.LatestVersion)
+	if err != nil {
+		logError(logger, ErrRestore, err)
+		return genError(ErrRestore, err)
+	}
+
+	logger.Info("Database restored", zap.String("backup", location), zap.Uint16("version", manifest.LatestVersion),
+		zap.Uint16s("removed_versions", removed))
+
+	return nil
+}
+
+// fetchBackup returns the dump and the manifest of the backup at the location, downloaded to a temporary
+// directory if it is a bucket URL, and the function removing the downloaded files.
+func fetchBackup(ctx context.Context, location string) (string, *backupManifest, func(), error) {
+	if !remote.IsBucketURL(location) {
+		if _, err := os.Stat(location); err != nil {
+			return "", nil, nil, err
+		}
+
+		manifest, err := readBackupManifest(location + backup_manifest_extension)
+		if err != nil {
+			return "", nil, nil, err
+		}
+		return location, manifest, func() {}, nil
+	}
+
+	dir, err := os.MkdirTemp("", "maestro-restore-")
+	if err != nil {
+		return "", nil, nil, err
+	}
+	removeDownload := func() { os.RemoveAll(dir) }
+
+	file := filepath.Join(dir, path.Base(location))
+	for _, suffix := range []string{"", backup_manifest_extension} {
+		download, err := bucketCopyCommand(ctx, location, location+suffix, file+suffix)
+		if err == nil {
+			err = runBackupCommand(download)
+		}
+		if err != nil {
+			removeDownload()
+			return "", nil, nil, err
+		}
+	}
+
+	manifest, err := readBackupManifest(file + backup_manifest_extension)
+	if err != nil {
+		removeDownload()
+		return "", nil, nil, err
+	}
+
+	return file, manifest, removeDownload, nil
+}
+
+// checkBackup returns an error if the backup can not be restored to the configured database.
+func checkBackup(config *conf.ProjectConfig, driver enums.DriverType, manifest *backupManifest) error {
+	if _, ok := backupExtensions[driver]; !ok {
+		return fmt.Errorf("backups are not supported by the %s driver", config.Driver)
+	}
+
+	if manifest.Driver != config.Driver {
+		return fmt.Errorf("backup taken with the %s driver, not the configured %s driver", manifest.Driver, config.Driver)
+	}
+
+	if manifest.Database != config.Database {
+		return fmt.Errorf("backup of database %s, not of the configured database %s", manifest.Database,
+			config.Database)
+	}
+
+	return nil
+}
+
+// restoreBackup restores the dump to the database with the client tool of the driver.
+func restoreBackup(ctx context.Context, config *conf.ProjectConfig, driver enums.DriverType, file string) error {
+	cmd := restoreCommand(ctx, config, driver, file)
+	if driver == enums.DRIVER_MARIADB {
+		dump, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer dump.Close()
+		cmd.Stdin = dump
+	}
+
+	return runBackupCommand(cmd)
+}
+
+// restoreCommand returns the command restoring the dump to the database, with the password in its
+// environment. The mysql client reads MariaDB dumps from its standard input.
+func restoreCommand(ctx context.Context, config *conf.ProjectConfig, driver enums.DriverType, file string) *exec.Cmd {
+	if driver == enums.DRIVER_MARIADB {
+		// The dump creates and selects its databases, and drops its tables before creating them
+		cmd := exec.CommandContext(ctx, "mysql", mariadbToolArgs(config)...)
+		cmd.Env = append(os.Environ(), "MYSQL_PWD="+config.Password)
+		return cmd
+	}
+
+	args := append([]string{"--clean", "--if-exists", "--single-transaction"}, postgresToolArgs(config)...)
+
+	cmd := exec.CommandContext(ctx, "pg_restore", append(args, file)...)
+	cmd.Env = postgresToolEnv(config)
+	return cmd
+}
@@ -0,0 +1,48 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/maestro-go/maestro/core/migrator"
+)
+
+// readResumeFile reads the failure point written by a failed run.
+func readResumeFile(path string) (*migrator.ResumePoint, error) {
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("no failed run to resume, %s not found", path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	point := &migrator.ResumePoint{}
+	err = json.Unmarshal(content, point)
+	if err != nil {
+		return nil, fmt.Errorf("invalid resume file %s: %w", path, err)
+	}
+
+	return point, nil
+}
+
+// writeResumeFile writes the failure point of the run, replacing the one of a previous run.
+func writeResumeFile(path string, point *migrator.ResumePoint) error {
+	content, err := json.MarshalIndent(point, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, append(content, '\n'), 0644)
+}
+
+// removeResumeFile removes the failure point once the migrations succeeded.
+func removeResumeFile(path string) error {
+	err := os.Remove(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
@@ -32,8 +32,32 @@ With Maestro, you can ensure your database schema evolves smoothly and consisten
 	migrateCmd := SetupMigrateCommand()
 	repairCmd := SetupRepairCommand()
 	statusCmd := SetupStatusCommand()
+	templatesCmd := SetupTemplatesCommand()
+	seedCmd := SetupSeedCommand()
+	resetCmd := SetupResetCommand()
+	cleanCmd := SetupCleanCommand()
+	freshCmd := SetupFreshCommand()
+	redoCmd := SetupRedoCommand()
+	uiCmd := SetupUICommand()
+	dbCmd := SetupDBCommand()
+	pingCmd := SetupPingCommand()
+	lockCmd := SetupLockCommand()
+	checksumCmd := SetupChecksumCommand()
+	renderCmd := SetupRenderCommand()
+	annotateCmd := SetupAnnotateCommand()
+	orderCmd := SetupOrderCommand()
+	holesCmd := SetupHolesCommand()
+	explainCmd := SetupExplainCommand()
+	restoreCmd := SetupRestoreCommand()
+	historyTableMigrateCmd := SetupHistoryTableMigrateCommand()
+	reproduceCmd := SetupReproduceCommand()
+	operatorCmd := SetupOperatorCommand()
+	planCmd := SetupPlanCommand()
+	baselineCmd := SetupBaselineCommand()
+	reportCmd := SetupReportCommand()
+	validateCmd := SetupValidateCommand()
 
-	rootCmd.AddCommand(initCmd, createCmd, migrateCmd, repairCmd, statusCmd)
+	rootCmd.AddCommand(initCmd, createCmd, migrateCmd, repairCmd, statusCmd, templatesCmd, seedCmd, resetCmd, cleanCmd, freshCmd, redoCmd, uiCmd, dbCmd, pingCmd, lockCmd, checksumCmd, renderCmd, annotateCmd, orderCmd, holesCmd, explainCmd, restoreCmd, historyTableMigrateCmd, reproduceCmd, operatorCmd, planCmd, baselineCmd, reportCmd, validateCmd)
 
 	return rootCmd
 }
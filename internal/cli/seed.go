@@ -0,0 +1,82 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	_ "github.com/lib/pq"
+	"github.com/maestro-go/maestro/core/enums"
+	"github.com/maestro-go/maestro/core/seeder"
+	"github.com/maestro-go/maestro/internal/cli/conn"
+	"github.com/maestro-go/maestro/internal/cli/flags"
+	"github.com/maestro-go/maestro/internal/utils/logger"
+	"github.com/spf13/cobra"
+)
+
+func SetupSeedCommand() *cobra.Command {
+	seedCmd := &cobra.Command{
+		Use:   "seed",
+		Short: "Load seed data",
+		Long: `The seed command executes the seed files ("SXXX_description.sql") found in the migration directories.
+
+Seeds are tracked in their own history table (seed-history-table), separately from the schema migrations.
+Seeds named "SXXX_description.env.sql" are only executed when the --env flag matches their environment.`,
+		RunE: runSeedCommand,
+	}
+
+	seedCmd.Flags().SortFlags = false
+	seedCmd.Flags().String("env", "", "Environment of the seeds to execute, along with the seeds without environment.")
+	flags.SetupDBConfigFlags(seedCmd)
+
+	return seedCmd
+}
+
+func runSeedCommand(cmd *cobra.Command, args []string) error {
+	logger, err := logger.NewLogger()
+	if err != nil {
+		log.Fatal(err)
+		return err
+	}
+
+	ctx := context.Background()
+
+	projectConfig, removeLocations, err := loadProjectConfig(cmd, logger)
+	if err != nil {
+		return err
+	}
+	defer removeLocations()
+
+	env, err := cmd.Flags().GetString("env")
+	if err != nil {
+		logError(logger, ErrReadEnvFlag, err)
+		return genError(ErrReadEnvFlag, err)
+	}
+
+	driver, ok := enums.MapStringToDriverType[projectConfig.Driver]
+	if !ok {
+		logError(logger, ErrInvalidDriver, errors.New(projectConfig.Driver))
+		return genError(ErrInvalidDriver, errors.New(projectConfig.Driver))
+	}
+
+	// Seeds are tracked in their own history table
+	seedConfig := *projectConfig
+	seedConfig.HistoryTable = projectConfig.SeedHistoryTable
+
+	repo, cleanup, err := conn.ConnectToDatabase(ctx, &seedConfig, driver)
+	if err != nil {
+		logError(logger, ErrConnectToDatabase, err)
+		return genError(ErrConnectToDatabase, err)
+	}
+	defer cleanup()
+
+	seeder := seeder.NewSeeder(logger, repo, &projectConfig.Migration)
+	err = seeder.Seed(env)
+	if err != nil {
+		return genError(ErrSeed, err)
+	}
+
+	logger.Info("Seeds executed successfully")
+
+	return nil
+}
@@ -3,16 +3,18 @@ package cli
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log"
-	"path/filepath"
+	"slices"
+	"time"
 
 	_ "github.com/lib/pq"
-	"github.com/maestro-go/maestro/core/conf"
+	"github.com/maestro-go/maestro/core/database"
 	"github.com/maestro-go/maestro/core/enums"
 	"github.com/maestro-go/maestro/internal/cli/conn"
 	"github.com/maestro-go/maestro/internal/cli/flags"
-	internalConf "github.com/maestro-go/maestro/internal/conf"
 	"github.com/maestro-go/maestro/internal/filesystem"
+	"github.com/maestro-go/maestro/internal/migrations"
 	"github.com/maestro-go/maestro/internal/utils/logger"
 	"github.com/spf13/cobra"
 	"go.uber.org/zap"
@@ -22,11 +24,33 @@ func SetupStatusCommand() *cobra.Command {
 	statusCmd := &cobra.Command{
 		Use:   "status",
 		Short: "Show the status of migrations",
-		Long:  `Show the status of migrations including the latest migration, validation errors, and failing migrations.`,
-		RunE:  runStatusCommand,
+		Long: `Show the status of migrations including the latest migration, validation errors, and failing migrations.
+
+The server version, the location of the schema history table and the state of the migration lock are shown first,
+which helps to find out whether another maestro process is currently migrating the database.
+
+The local migrations (their number, head version, gaps and missing down migrations) are shown before connecting.
+With --local, the database is not accessed, e.g. to check the migration files when it is not reachable.
+
+With --compare, the schema history table is compared with the one of another database, e.g. staging with
+production, reporting the versions applied to only one of them and the versions applied with different checksums.
+
+With --history, every version of the schema history table is listed in the order it was applied, by installed
+rank, which differs from the order of the versions after out-of-order migrations or repairs.
+
+With --at, the version the database was at on a given date or time is reported from the execution times of the
+schema history table, e.g. for incident forensics or to reproduce a historical environment. A date means the end
+of that day, in the time zone of the database (UTC with SQLite and Trino). As the schema history table only records the
+latest execution of each version, the versions executed again since then are listed as executed after that time
+and the versions rolled back since then are missing; the audit table keeps the full record.`,
+		RunE: runStatusCommand,
 	}
 
 	statusCmd.Flags().SortFlags = false
+	statusCmd.Flags().Bool("local", false, "Only show the status of the local migrations, without connecting to the database.")
+	statusCmd.Flags().String("compare", "", "Data source name of another database whose schema history table is compared.")
+	statusCmd.Flags().Bool("history", false, "List the versions of the schema history table in the order they were applied.")
+	statusCmd.Flags().String("at", "", "Report the version of the database at a date or time (e.g. 2024-05-01 or \"2024-05-01 14:30\").")
 	flags.SetupDBConfigFlags(statusCmd)
 
 	return statusCmd
@@ -41,49 +65,84 @@ func runStatusCommand(cmd *cobra.Command, args []string) error {
 
 	ctx := context.Background()
 
-	globalFlags, err := flags.ExtractGlobalFlags(cmd)
+	projectConfig, removeLocations, err := loadProjectConfig(cmd, logger)
 	if err != nil {
-		logError(logger, ErrExtractGlobalFlags, err)
-		return genError(ErrExtractGlobalFlags, err)
+		return err
 	}
+	defer removeLocations()
 
-	configFilePath := filepath.Join(globalFlags.Location, internalConf.DEFAULT_PROJECT_FILE)
-	exists, err := filesystem.CheckFSObject(configFilePath)
+	local, err := cmd.Flags().GetBool("local")
 	if err != nil {
-		logError(logger, ErrCheckFile, err)
-		return genError(ErrCheckFile, err)
+		logError(logger, ErrReadLocalFlag, err)
+		return genError(ErrReadLocalFlag, err)
 	}
 
-	projectConfig := &conf.ProjectConfig{}
-	if exists {
-		logger.Info("Located config file")
+	compare, err := cmd.Flags().GetString("compare")
+	if err != nil {
+		logError(logger, ErrReadCompareFlag, err)
+		return genError(ErrReadCompareFlag, err)
+	}
 
-		err = conf.LoadConfigFromFile(configFilePath, projectConfig)
-		if err != nil {
-			logError(logger, ErrExtractConfigFromFile, err)
-			return genError(ErrExtractConfigFromFile, err)
-		}
+	if local && compare != "" {
+		err = errors.New("--compare needs the database, it cannot be used with --local")
+		logError(logger, ErrReadCompareFlag, err)
+		return genError(ErrReadCompareFlag, err)
+	}
 
-		err = flags.MergeDBConfigFlags(cmd, projectConfig)
-		if err != nil {
-			logError(logger, ErrMergeDBConfigFlags, err)
-			return genError(ErrMergeDBConfigFlags, err)
-		}
+	showHistory, err := cmd.Flags().GetBool("history")
+	if err != nil {
+		logError(logger, ErrReadHistoryFlag, err)
+		return genError(ErrReadHistoryFlag, err)
+	}
 
-		err = flags.MergeMigrationLocations(cmd, &projectConfig.Migration)
-		if err != nil {
-			logError(logger, ErrMergeMigrationLocations, err)
-			return genError(ErrMergeMigrationLocations, err)
-		}
+	if local && showHistory {
+		err = errors.New("--history needs the database, it cannot be used with --local")
+		logError(logger, ErrReadHistoryFlag, err)
+		return genError(ErrReadHistoryFlag, err)
+	}
+
+	atFlag, err := cmd.Flags().GetString("at")
+	if err != nil {
+		logError(logger, ErrReadAtFlag, err)
+		return genError(ErrReadAtFlag, err)
+	}
+
+	if local && atFlag != "" {
+		err = errors.New("--at needs the database, it cannot be used with --local")
+		logError(logger, ErrReadAtFlag, err)
+		return genError(ErrReadAtFlag, err)
+	}
 
-	} else {
-		err = flags.ExtractDBConfigFlags(cmd, projectConfig)
+	var at time.Time
+	if atFlag != "" {
+		at, err = parseHistoryTime(atFlag)
 		if err != nil {
-			logError(logger, ErrExtractDBConfigFlags, err)
-			return genError(ErrExtractDBConfigFlags, err)
+			logError(logger, ErrReadAtFlag, err)
+			return genError(ErrReadAtFlag, err)
 		}
+	}
+
+	// Load migrations, with the down migrations to report the missing ones
+	localConfig := projectConfig.Migration
+	localConfig.Down = true
+
+	migrationsMap, _, errs := filesystem.LoadObjectsFromFiles(&localConfig)
+	if len(errs) > 0 {
+		logErrors(logger, ErrLoadMigrations, errs)
+		return errors.Join(errs...)
+	}
+
+	versionRanges, err := migrations.ParseVersionRanges(projectConfig.Migration.Locations,
+		projectConfig.Migration.VersionRanges)
+	if err != nil {
+		logError(logger, ErrLoadMigrations, err)
+		return genError(ErrLoadMigrations, err)
+	}
+
+	logLocalStatus(logger, migrationsMap, versionRanges)
 
-		projectConfig.Migration.Locations = globalFlags.MigrationLocations
+	if local {
+		return nil
 	}
 
 	driver, ok := enums.MapStringToDriverType[projectConfig.Driver]
@@ -92,47 +151,265 @@ func runStatusCommand(cmd *cobra.Command, args []string) error {
 		return genError(ErrInvalidDriver, errors.New(projectConfig.Driver))
 	}
 
-	repo, cleanup, err := conn.ConnectToDatabase(ctx, projectConfig, driver)
+	repo, cleanup, err := conn.ConnectToDatabaseReadOnly(ctx, projectConfig, driver)
 	if err != nil {
 		logError(logger, ErrConnectToDatabase, err)
 		return genError(ErrConnectToDatabase, err)
 	}
 	defer cleanup()
 
-	// Log the latest migration
-	latestMigration, err := repo.GetLatestMigration()
+	// Log the server, history table and lock
+	info, err := repo.ServerInfo()
 	if err != nil {
-		logError(logger, ErrGetFailingMigrations, err)
-		return genError(ErrGetFailingMigrations, err)
+		logError(logger, ErrServerInfo, err)
+		return genError(ErrServerInfo, err)
 	}
 
-	// Load migrations
-	migrations, _, errs := filesystem.LoadObjectsFromFiles(&projectConfig.Migration)
-	if len(errs) > 0 {
-		logErrors(logger, ErrLoadMigrations, errs)
-		return errors.Join(errs...)
+	lockInfo, err := repo.GetLockInfo()
+	if err != nil {
+		logError(logger, ErrGetLockInfo, err)
+		return genError(ErrGetLockInfo, err)
 	}
 
-	// Validate migrations
-	validationErrors := repo.ValidateMigrations(migrations[enums.MIGRATION_UP])
+	logger.Info("Server:", zap.String("driver", projectConfig.Driver), zap.String("server version", info.Version),
+		zap.String("schema", info.Schema))
 
-	// Log failing migrations
-	failingMigrations, err := repo.GetFailingMigrations()
+	logger.Info("Schema history table:", zap.String("history table", historyTableLocation(info)),
+		zap.Bool("exists", info.HistoryTableExists), zap.Int64("rows", info.HistoryRows))
+
+	logLockInfo(logger, lockInfo)
+
+	// Log the latest migration
+	history, err := repo.GetAppliedMigrations()
 	if err != nil {
-		logError(logger, ErrGetFailingMigrations, err)
-		return genError(ErrGetFailingMigrations, err)
+		logError(logger, ErrGetAppliedMigrations, err)
+		return genError(ErrGetAppliedMigrations, err)
+	}
+
+	latestMigration := database.LatestAppliedVersion(history)
+
+	// Validate migrations
+	validationErrors := repo.ValidateMigrations(migrationsMap[enums.MIGRATION_UP])
+
+	// With version ranges, the versions missing in the history are pending or between blocks of versions
+	if len(versionRanges) > 0 {
+		validationErrors = slices.DeleteFunc(validationErrors, func(err error) bool {
+			var missing *database.MissingVersionError
+			return errors.As(err, &missing)
+		})
 	}
 
+	// Log failing migrations
+	failingMigrations := database.FailingAppliedMigrations(history)
+
 	for _, validationError := range validationErrors {
 		logger.Info("validation error: ", zap.String("error", validationError.Error()))
 	}
 
 	for _, migration := range failingMigrations {
-		logger.Info("Failing migration", zap.Uint16("version", migration.Version), zap.String("description", migration.Description))
+		logger.Info("Failing migration", appliedMigrationFields(migration)...)
+	}
+
+	for _, migration := range history {
+		if migration.Version == latestMigration && migration.Success {
+			logger.Info("Latest migration", appliedMigrationFields(migration)...)
+			break
+		}
+	}
+
+	skippedMigrations := 0
+	for _, migration := range history {
+		if migration.Skipped {
+			skippedMigrations++
+		}
 	}
 
 	logger.Info("Migrations status:", zap.Uint16("latest migration", latestMigration), zap.Int("migrations mismatches",
-		len(validationErrors)), zap.Int("failing migrations", len(failingMigrations)))
+		len(validationErrors)), zap.Int("failing migrations", len(failingMigrations)),
+		zap.Int("skipped migrations", skippedMigrations))
+
+	if showHistory {
+		for _, migration := range database.SortByInstalledRank(history) {
+			logger.Info("Applied migration", append(appliedMigrationFields(migration),
+				zap.Bool("success", migration.Success))...)
+		}
+	}
+
+	if atFlag != "" {
+		snapshot, err := database.SnapshotAt(history, at)
+		if err != nil {
+			logError(logger, ErrSnapshot, err)
+			return genError(ErrSnapshot, err)
+		}
+		logHistorySnapshot(logger, snapshot)
+	}
+
+	if compare == "" {
+		return nil
+	}
+
+	otherRepo, otherCleanup, err := conn.ConnectToDSN(ctx, compare, projectConfig, driver)
+	if err != nil {
+		logError(logger, ErrCompare, err)
+		return genError(ErrCompare, err)
+	}
+	defer otherCleanup()
+
+	otherHistory, err := otherRepo.GetAppliedMigrations()
+	if err != nil {
+		logError(logger, ErrCompare, err)
+		return genError(ErrCompare, err)
+	}
+
+	logHistoryComparison(logger, database.CompareAppliedMigrations(history, otherHistory))
 
 	return nil
 }
+
+// logHistoryComparison logs the versions applied to only one of the compared databases, and the versions
+// applied to both with different checksums.
+func logHistoryComparison(logger *zap.Logger, comparison *database.HistoryComparison) {
+	for _, migration := range comparison.OnlyInFirst {
+		logger.Info("Only applied to this database", appliedMigrationFields(migration)...)
+	}
+
+	for _, migration := range comparison.OnlyInSecond {
+		logger.Info("Only applied to the compared database", appliedMigrationFields(migration)...)
+	}
+
+	for _, version := range comparison.ChecksumMismatches {
+		logger.Warn("Applied with different checksums", zap.Uint16("version", version))
+	}
+
+	if comparison.Equal() {
+		logger.Info("Both databases have the same migrations applied")
+		return
+	}
+
+	logger.Info("Comparison:", zap.Int("only in this database", len(comparison.OnlyInFirst)),
+		zap.Int("only in the compared database", len(comparison.OnlyInSecond)),
+		zap.Int("checksum mismatches", len(comparison.ChecksumMismatches)))
+}
+
+// historyTimeLayouts are the layouts of the times of the schema history accepted by the at flags, in the time
+// zone of the database.
+var historyTimeLayouts = []string{time.DateTime, "2006-01-02T15:04:05", "2006-01-02 15:04", "2006-01-02T15:04"}
+
+// parseHistoryTime parses a time of the schema history given to an at flag. A date means the end of that day.
+func parseHistoryTime(value string) (time.Time, error) {
+	if date, err := time.Parse(time.DateOnly, value); err == nil {
+		return date.Add(24*time.Hour - time.Second), nil
+	}
+
+	for _, layout := range historyTimeLayouts {
+		if at, err := time.Parse(layout, value); err == nil {
+			return at, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("invalid time %q, expected a date (2006-01-02) or a date and time (2006-01-02 15:04:05)",
+		value)
+}
+
+// logHistorySnapshot logs the version the database was at on the time of the snapshot, and the migrations executed
+// after that time.
+func logHistorySnapshot(logger *zap.Logger, snapshot *database.HistorySnapshot) {
+	for _, migration := range snapshot.Later {
+		logger.Info("Executed after", append(appliedMigrationFields(migration),
+			zap.String("executed at", migration.ExecutedAt.Format(database.EXECUTED_AT_LAYOUT)),
+			zap.Bool("success", migration.Success))...)
+	}
+
+	logger.Info("Status at:", zap.String("at", snapshot.At.Format(database.EXECUTED_AT_LAYOUT)),
+		zap.Uint16("version", snapshot.Version), zap.Int("applied migrations", len(snapshot.Applied)),
+		zap.Int("executed after", len(snapshot.Later)))
+}
+
+// logLocalStatus logs the inventory of the local migrations: their number, the head version, the missing versions
+// and the versions without down migration. With version ranges, the missing versions are the ones below the highest
+// version of their range, or of the shared versions.
+func logLocalStatus(logger *zap.Logger, migrationsMap map[enums.MigrationType][]*migrations.Migration,
+	versionRanges migrations.VersionRanges) {
+	upMigrations := migrationsMap[enums.MIGRATION_UP]
+
+	head := uint16(0)
+	if len(upMigrations) > 0 {
+		head = upMigrations[len(upMigrations)-1].Version
+	}
+
+	versions := make(map[uint16]bool, len(upMigrations))
+	versionList := make([]uint16, 0, len(upMigrations))
+	for _, migration := range upMigrations {
+		versions[migration.Version] = true
+		versionList = append(versionList, migration.Version)
+	}
+
+	downVersions := make(map[uint16]bool, len(migrationsMap[enums.MIGRATION_DOWN]))
+	for _, migration := range migrationsMap[enums.MIGRATION_DOWN] {
+		downVersions[migration.Version] = true
+	}
+
+	belowHead := versionRanges.Heads(versionList)
+
+	gaps := make([]uint16, 0)
+	for version := uint16(1); version < head; version++ {
+		if !versions[version] && belowHead(version) {
+			gaps = append(gaps, version)
+		}
+	}
+
+	missingDowns := make([]uint16, 0)
+	for _, migration := range upMigrations {
+		if !downVersions[migration.Version] {
+			missingDowns = append(missingDowns, migration.Version)
+		}
+	}
+
+	logger.Info("Local migrations:", zap.Int("migrations", len(upMigrations)), zap.Uint16("head version", head),
+		zap.Uint16s("gaps", gaps), zap.Uint16s("missing down migrations", missingDowns))
+}
+
+// historyTableLocation returns the name of the history table, qualified with its schema if known.
+func historyTableLocation(info *database.ServerInfo) string {
+	if info.Schema == "" {
+		return info.HistoryTable
+	}
+	return info.Schema + "." + info.HistoryTable
+}
+
+// logLockInfo logs whether the migration lock is held, and by whom and since when if known.
+func logLockInfo(logger *zap.Logger, info *database.LockInfo) {
+	if !info.Locked {
+		logger.Info("Migration lock is free")
+		return
+	}
+
+	fields := make([]zap.Field, 0, 2)
+	if info.Owner != "" {
+		fields = append(fields, zap.String("owner", info.Owner))
+	}
+	if info.LockedAt != nil {
+		fields = append(fields, zap.Time("locked at", *info.LockedAt))
+	}
+
+	logger.Warn("Migration lock is held", fields...)
+}
+
+// appliedMigrationFields returns the log fields of an applied migration, with its installed rank, author and ticket
+// if recorded.
+func appliedMigrationFields(migration *database.AppliedMigration) []zap.Field {
+	fields := []zap.Field{zap.Uint16("version", migration.Version), zap.String("description", migration.Description)}
+	if migration.InstalledRank != 0 {
+		fields = append(fields, zap.Int64("installed rank", migration.InstalledRank))
+	}
+	if migration.Author != "" {
+		fields = append(fields, zap.String("author", migration.Author))
+	}
+	if migration.Ticket != "" {
+		fields = append(fields, zap.String("ticket", migration.Ticket))
+	}
+	if migration.Skipped {
+		fields = append(fields, zap.Bool("skipped", true))
+	}
+	return fields
+}
@@ -0,0 +1,92 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/maestro-go/maestro/internal/filesystem"
+	"github.com/maestro-go/maestro/internal/migrations"
+	"github.com/maestro-go/maestro/internal/utils/logger"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+func SetupTemplatesCommand() *cobra.Command {
+	templatesCmd := &cobra.Command{
+		Use:   "templates",
+		Short: "Manage migration templates",
+		Long:  `Inspect the migration templates available in the configured migration directories.`,
+	}
+
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List available templates",
+		Long: `List the templates found in the configured migration directories.
+
+For each template, this command shows:
+1. The template name, and whether it is a built-in template.
+2. The template parameters, with their default values when declared.
+3. The migration and hook files referencing the template.`,
+		RunE: runTemplatesListCommand,
+	}
+
+	templatesCmd.AddCommand(listCmd)
+
+	return templatesCmd
+}
+
+func runTemplatesListCommand(cmd *cobra.Command, args []string) error {
+	logger, err := logger.NewLogger()
+	if err != nil {
+		log.Fatal(err)
+		return err
+	}
+
+	projectConfig, removeLocations, err := loadProjectConfig(cmd, logger)
+	if err != nil {
+		return err
+	}
+	defer removeLocations()
+
+	templates, errs := filesystem.LoadTemplates(projectConfig.Migration.Locations)
+	if len(errs) > 0 {
+		logErrors(logger, ErrLoadTemplates, errs)
+		return errors.Join(errs...)
+	}
+
+	templates = migrations.WithBuiltinTemplates(templates, projectConfig.Migration.Driver)
+
+	usage, err := filesystem.GetTemplatesUsage(projectConfig.Migration.Locations)
+	if err != nil {
+		logError(logger, ErrLoadTemplates, err)
+		return genError(ErrLoadTemplates, err)
+	}
+
+	sort.Slice(templates, func(i, j int) bool {
+		return templates[i].Name < templates[j].Name
+	})
+
+	for _, template := range templates {
+		logger.Info("Template", zap.String("name", template.Name), zap.Bool("builtin", template.Builtin),
+			zap.Strings("parameters", formatTemplateParameters(template.Parameters())),
+			zap.Strings("used by", usage[template.Name]))
+	}
+
+	logger.Info("Templates found", zap.Int("count", len(templates)))
+
+	return nil
+}
+
+func formatTemplateParameters(parameters []*migrations.TemplateParameter) []string {
+	formatted := make([]string, 0, len(parameters))
+	for _, parameter := range parameters {
+		if parameter.Default != nil {
+			formatted = append(formatted, fmt.Sprintf("$%d:=%s", parameter.Index, *parameter.Default))
+			continue
+		}
+		formatted = append(formatted, fmt.Sprintf("$%d", parameter.Index))
+	}
+	return formatted
+}
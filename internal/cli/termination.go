@@ -0,0 +1,85 @@
+package cli
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+)
+
+// termination_message_max_size is the size of the termination message read by Kubernetes.
+const termination_message_max_size = 4096
+
+// Statuses of the termination message
+const (
+	termination_succeeded  = "succeeded"
+	termination_up_to_date = "up-to-date" // No migration was pending, nothing was executed
+	termination_failed     = "failed"
+)
+
+// terminationMessage is the outcome of a run written to the termination log, e.g. /dev/termination-log, read by
+// Kubernetes as the termination message of the container.
+type terminationMessage struct {
+	Status  string   `json:"status"`
+	RunID   string   `json:"run_id,omitempty"`
+	Version *uint16  `json:"version,omitempty"` // Version of the database at the end of the run, if known
+	Applied []uint16 `json:"applied,omitempty"`
+	Owners  []string `json:"owners,omitempty"` // Teams owning the failed versions, to page
+	Error   string   `json:"error,omitempty"`
+}
+
+// writeTerminationMessage writes the message to the termination log as JSON, failed with the error of the
+// command if any. The message is truncated to the size read by Kubernetes: the error down to half of it, then
+// the applied versions, then the owners, then the run ID and the rest of the error, keeping the status and the
+// version.
+func writeTerminationMessage(path string, message *terminationMessage, cmdErr error) error {
+	if cmdErr != nil {
+		message.Status = termination_failed
+		message.Error = cmdErr.Error()
+	} else if message.Status == "" {
+		message.Status = termination_succeeded
+	}
+
+	content, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	// Each step shortens a field, until only the status and the version are left
+	for len(content) > termination_message_max_size {
+		excess := len(content) - termination_message_max_size
+		switch {
+		case len(message.Error) > termination_message_max_size/2:
+			message.Error = truncate(message.Error, max(len(message.Error)-excess, termination_message_max_size/2))
+		case len(message.Applied) > 0:
+			message.Applied = message.Applied[:len(message.Applied)/2]
+		case len(message.Owners) > 0:
+			message.Owners = message.Owners[:len(message.Owners)/2]
+		case message.RunID != "":
+			message.RunID = truncateOrDrop(message.RunID, excess)
+		case message.Error != "":
+			message.Error = truncateOrDrop(message.Error, excess)
+		default:
+			*message = terminationMessage{Status: message.Status, Version: message.Version}
+		}
+
+		content, err = json.Marshal(message)
+		if err != nil {
+			return err
+		}
+	}
+
+	return os.WriteFile(path, content, 0o644)
+}
+
+// truncateOrDrop returns the text shortened by excess bytes, or an empty text if nothing would be left of it.
+func truncateOrDrop(text string, excess int) string {
+	if len(text)-excess <= len("...") {
+		return ""
+	}
+	return truncate(text, len(text)-excess)
+}
+
+// truncate returns the first bytes of the text, ending with "...", within the given size.
+func truncate(text string, size int) string {
+	return strings.ToValidUTF8(text[:max(size-len("..."), 0)], "") + "..."
+}
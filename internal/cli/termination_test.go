@@ -0,0 +1,83 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteTerminationMessage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "termination-log")
+
+	read := func() (*terminationMessage, int) {
+		content, err := os.ReadFile(path)
+		require.NoError(t, err)
+
+		message := &terminationMessage{}
+		require.NoError(t, json.Unmarshal(content, message))
+		return message, len(content)
+	}
+
+	version := uint16(7)
+	applied := make([]uint16, 0, 2000)
+	for v := range 2000 {
+		applied = append(applied, uint16(v+1))
+	}
+
+	// Messages within the size are written as is
+	err := writeTerminationMessage(path, &terminationMessage{RunID: "run", Version: &version, Applied: applied[:3]}, nil)
+	require.NoError(t, err)
+
+	message, _ := read()
+	assert.Equal(t, termination_succeeded, message.Status)
+	assert.Equal(t, []uint16{1, 2, 3}, message.Applied)
+
+	// A long error is kept down to half of the size, before the applied versions are dropped
+	err = writeTerminationMessage(path, &terminationMessage{RunID: "run", Applied: applied},
+		errors.New(strings.Repeat("e", 10000)))
+	require.NoError(t, err)
+
+	message, size := read()
+	assert.LessOrEqual(t, size, termination_message_max_size)
+	assert.Equal(t, termination_failed, message.Status)
+	assert.Len(t, message.Error, termination_message_max_size/2)
+	assert.NotEmpty(t, message.Applied)
+	assert.Equal(t, "run", message.RunID)
+
+	// Oversized owners are shortened after the applied versions are dropped
+	owners := make([]string, 0, 500)
+	for i := range 500 {
+		owners = append(owners, fmt.Sprintf("@acme/team-%03d", i))
+	}
+
+	err = writeTerminationMessage(path, &terminationMessage{RunID: "run", Version: &version, Applied: applied,
+		Owners: owners}, errors.New("migration 7 failed"))
+	require.NoError(t, err)
+
+	message, size = read()
+	assert.LessOrEqual(t, size, termination_message_max_size)
+	assert.Empty(t, message.Applied)
+	assert.NotEmpty(t, message.Owners)
+	assert.Equal(t, owners[:len(message.Owners)], message.Owners)
+	assert.Equal(t, "migration 7 failed", message.Error)
+	assert.Equal(t, uint16(7), *message.Version)
+
+	// A single owner larger than the size is dropped, and a long run ID is shortened before the error
+	err = writeTerminationMessage(path, &terminationMessage{RunID: strings.Repeat("r", 5000), Version: &version,
+		Owners: []string{strings.Repeat("o", 5000)}}, errors.New("migration 7 failed"))
+	require.NoError(t, err)
+
+	message, size = read()
+	assert.LessOrEqual(t, size, termination_message_max_size)
+	assert.Empty(t, message.Owners)
+	assert.Equal(t, "migration 7 failed", message.Error)
+	assert.Less(t, len(message.RunID), 5000)
+	assert.Equal(t, termination_failed, message.Status)
+}
@@ -0,0 +1,688 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	_ "github.com/lib/pq"
+	"github.com/maestro-go/maestro/core/conf"
+	"github.com/maestro-go/maestro/core/database"
+	"github.com/maestro-go/maestro/core/enums"
+	"github.com/maestro-go/maestro/core/migrator"
+	"github.com/maestro-go/maestro/internal/cli/conn"
+	"github.com/maestro-go/maestro/internal/cli/flags"
+	"github.com/maestro-go/maestro/internal/filesystem"
+	"github.com/maestro-go/maestro/internal/migrations"
+	"github.com/maestro-go/maestro/internal/report"
+	"github.com/maestro-go/maestro/internal/utils/logger"
+	"github.com/pmezard/go-difflib/difflib"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	uiStatusApplied = "applied"
+	uiStatusFailed  = "failed"
+	uiStatusPending = "pending"
+	uiStatusSkipped = "skipped"
+)
+
+// Size of the interface until the terminal reports its own
+const (
+	uiDefaultWidth  = 120
+	uiDefaultHeight = 30
+)
+
+const uiShortHelp = "↑/↓ select · enter view · d diff · r repair · b rollback · tab focus · ? help · q quit"
+
+const uiHelp = `Key bindings:
+  ↑/k, ↓/j     select the previous or next migration, or scroll the details pane when focused
+  pgup, pgdown scroll the details pane
+  g, G         select the first or last migration
+  enter, v     view the up and down files of the selected version
+  d            compare the selected version with the schema history table, and diff it with the content applied
+  r            repair the selected version in the schema history table
+  b            roll back the selected version and every later version
+  tab          switch the focus between the migrations and the details panes
+  ?            show this help
+  q, ctrl+c    quit
+
+Repair and rollback ask for confirmation in the status line, answer with y to proceed.`
+
+var (
+	uiTitleStyle    = lipgloss.NewStyle().Bold(true)
+	uiSelectedStyle = lipgloss.NewStyle().Reverse(true)
+	uiHelpStyle     = lipgloss.NewStyle().Faint(true)
+	uiPaneStyle     = lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).Padding(0, 1)
+	uiFocusedStyle  = uiPaneStyle.BorderForeground(lipgloss.Color("12"))
+)
+
+func SetupUICommand() *cobra.Command {
+	uiCmd := &cobra.Command{
+		Use:   "ui",
+		Short: "Browse migrations interactively",
+		Long: `The ui command opens a terminal interface to browse applied, pending and failed migrations, view the
+content of migration files, diff them with the content applied (found in their git history), and repair or roll
+back a selected version.
+
+Repair and rollback ask for confirmation, and rollback is refused against protected databases ("protected: true").`,
+		RunE: runUICommand,
+	}
+
+	uiCmd.Flags().SortFlags = false
+	flags.SetupDBConfigFlags(uiCmd)
+
+	return uiCmd
+}
+
+func runUICommand(cmd *cobra.Command, args []string) error {
+	logger, err := logger.NewLogger()
+	if err != nil {
+		log.Fatal(err)
+		return err
+	}
+
+	ctx := context.Background()
+
+	projectConfig, removeLocations, err := loadProjectConfig(cmd, logger)
+	if err != nil {
+		return err
+	}
+	defer removeLocations()
+
+	driver, ok := enums.MapStringToDriverType[projectConfig.Driver]
+	if !ok {
+		logError(logger, ErrInvalidDriver, errors.New(projectConfig.Driver))
+		return genError(ErrInvalidDriver, errors.New(projectConfig.Driver))
+	}
+
+	repo, cleanup, err := conn.ConnectToDatabase(ctx, projectConfig, driver)
+	if err != nil {
+		logError(logger, ErrConnectToDatabase, err)
+		return genError(ErrConnectToDatabase, err)
+	}
+	defer cleanup()
+
+	ui := newMigrationsUI(repo, projectConfig)
+
+	err = ui.load()
+	if err != nil {
+		logError(logger, ErrUI, err)
+		return genError(ErrUI, err)
+	}
+
+	program := tea.NewProgram(ui, tea.WithAltScreen(), tea.WithInput(cmd.InOrStdin()),
+		tea.WithOutput(cmd.OutOrStdout()))
+	_, err = program.Run()
+	if err != nil {
+		logError(logger, ErrUI, err)
+		return genError(ErrUI, err)
+	}
+
+	return nil
+}
+
+type uiMigration struct {
+	up     *migrations.Migration
+	down   *migrations.Migration
+	status string
+
+	// Recorded in the schema history table, or taken from the header of pending migrations
+	author string
+	ticket string
+
+	// Row of the schema history table, nil if the version is not recorded
+	recorded *database.AppliedMigration
+}
+
+// changed reports whether the description or the checksum of the local file differ from the ones recorded in
+// the schema history table.
+func (m *uiMigration) changed() bool {
+	return m.recorded != nil && (m.recorded.Description != m.up.Description || m.recorded.Checksum != *m.up.Checksum)
+}
+
+// uiConfirmation is an action waiting for confirmation in the status line.
+type uiConfirmation struct {
+	message string
+	action  func() (string, error)
+}
+
+// uiActionMsg is the result of a confirmed action, run outside of the update loop.
+type uiActionMsg struct {
+	message string
+	err     error
+}
+
+// migrationsUI is the bubbletea model of the ui command: the migrations pane lists the local migrations, the
+// details pane shows the files, the diff or the logs of the selected one, and the status line the result of the
+// last action or the pending confirmation.
+type migrationsUI struct {
+	repository database.Repository
+	config     *conf.ProjectConfig
+
+	// The repair and rollback logs are shown in the details pane, the terminal belongs to the interface
+	logger *zap.Logger
+	logs   *strings.Builder
+
+	latestMigration uint16
+	migrations      []*uiMigration
+
+	width         int
+	height        int
+	cursor        int
+	detailFocused bool
+	detailTitle   string
+	detailContent string
+	detail        viewport.Model
+	status        string
+	confirming    *uiConfirmation
+	busy          bool
+}
+
+func newMigrationsUI(repository database.Repository, config *conf.ProjectConfig) *migrationsUI {
+	logs := &strings.Builder{}
+	encoderConfig := zap.NewDevelopmentEncoderConfig()
+	encoderConfig.TimeKey = ""
+
+	ui := &migrationsUI{
+		repository: repository,
+		config:     config,
+		logger: zap.New(zapcore.NewCore(zapcore.NewConsoleEncoder(encoderConfig), zapcore.AddSync(logs),
+			zap.InfoLevel)),
+		logs:   logs,
+		detail: viewport.New(0, 0),
+	}
+	ui.resize(uiDefaultWidth, uiDefaultHeight)
+
+	return ui
+}
+
+func (u *migrationsUI) Init() tea.Cmd {
+	u.showView()
+	return nil
+}
+
+func (u *migrationsUI) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		u.resize(msg.Width, msg.Height)
+		return u, nil
+
+	case uiActionMsg:
+		u.busy = false
+		u.status = msg.message
+		if msg.err != nil {
+			u.status = fmt.Sprintf("Error: %s", msg.err)
+		}
+
+		err := u.load()
+		if err != nil {
+			u.status = fmt.Sprintf("Error: %s", err)
+		}
+		u.cursor = min(u.cursor, max(len(u.migrations)-1, 0))
+		u.showDetail("Logs", u.logs.String())
+		return u, nil
+
+	case tea.KeyMsg:
+		return u.handleKey(msg)
+	}
+
+	return u, nil
+}
+
+func (u *migrationsUI) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	key := msg.String()
+	if key == "ctrl+c" {
+		return u, tea.Quit
+	}
+
+	if u.busy {
+		return u, nil
+	}
+
+	if u.confirming != nil {
+		confirmation := u.confirming
+		u.confirming = nil
+
+		if key != "y" && key != "Y" {
+			u.status = "Cancelled"
+			return u, nil
+		}
+
+		u.busy = true
+		u.status = "Running..."
+		u.logs.Reset()
+		return u, func() tea.Msg {
+			message, err := confirmation.action()
+			return uiActionMsg{message: message, err: err}
+		}
+	}
+
+	switch key {
+	case "q":
+		return u, tea.Quit
+	case "tab":
+		u.detailFocused = !u.detailFocused
+		return u, nil
+	case "?":
+		u.showDetail("Help", uiHelp)
+		return u, nil
+	case "pgup", "pgdown":
+		var cmd tea.Cmd
+		u.detail, cmd = u.detail.Update(msg)
+		return u, cmd
+	}
+
+	if u.detailFocused && (key == "up" || key == "down" || key == "k" || key == "j") {
+		var cmd tea.Cmd
+		u.detail, cmd = u.detail.Update(msg)
+		return u, cmd
+	}
+
+	switch key {
+	case "up", "k":
+		u.selectMigration(u.cursor - 1)
+		return u, nil
+	case "down", "j":
+		u.selectMigration(u.cursor + 1)
+		return u, nil
+	case "g", "home":
+		u.selectMigration(0)
+		return u, nil
+	case "G", "end":
+		u.selectMigration(len(u.migrations) - 1)
+		return u, nil
+	}
+
+	migration := u.selected()
+	if migration == nil {
+		return u, nil
+	}
+
+	switch key {
+	case "enter", "v":
+		u.showView()
+	case "d":
+		out := &strings.Builder{}
+		u.diff(out, migration)
+		u.showDetail(fmt.Sprintf("Diff of version %d", migration.up.Version), out.String())
+	case "r":
+		u.confirming = &uiConfirmation{
+			message: fmt.Sprintf("Mark version %d as succeeded with the local checksum?", migration.up.Version),
+			action:  func() (string, error) { return u.repair(migration) },
+		}
+	case "b":
+		err := u.checkRollback(migration)
+		if err != nil {
+			u.status = fmt.Sprintf("Error: %s", err)
+			return u, nil
+		}
+		u.confirming = &uiConfirmation{
+			message: fmt.Sprintf("Roll back version %d and every later version?", migration.up.Version),
+			action:  func() (string, error) { return u.rollback(migration) },
+		}
+	}
+
+	return u, nil
+}
+
+func (u *migrationsUI) View() string {
+	header := uiTitleStyle.Render(fmt.Sprintf("maestro · latest applied version: %d", u.latestMigration))
+
+	listStyle, detailStyle := uiFocusedStyle, uiPaneStyle
+	if u.detailFocused {
+		listStyle, detailStyle = uiPaneStyle, uiFocusedStyle
+	}
+
+	// The width of the styles includes their padding
+	padding := uiPaneStyle.GetHorizontalPadding()
+
+	listWidth, detailWidth, paneHeight := u.paneSizes()
+	list := listStyle.Width(listWidth + padding).Height(paneHeight).Render(
+		uiTitleStyle.Render("Migrations") + "\n" + u.renderList(listWidth, paneHeight-1))
+	detail := detailStyle.Width(detailWidth + padding).Height(paneHeight).Render(
+		uiTitleStyle.Render(u.detailTitle) + "\n" + u.detail.View())
+
+	status := u.status
+	if u.confirming != nil {
+		status = u.confirming.message + " [y/N]"
+	}
+
+	return lipgloss.JoinVertical(lipgloss.Left, header, lipgloss.JoinHorizontal(lipgloss.Top, list, detail),
+		status, uiHelpStyle.Render(uiShortHelp))
+}
+
+// paneSizes returns the content width of the migrations and details panes, and their content height, leaving room
+// for the borders and the padding of the panes, the header, the status line and the help line.
+func (u *migrationsUI) paneSizes() (int, int, int) {
+	frameWidth, frameHeight := uiPaneStyle.GetFrameSize()
+
+	listWidth := max(u.width/2-frameWidth, 10)
+	detailWidth := max(u.width-listWidth-2*frameWidth, 10)
+	paneHeight := max(u.height-frameHeight-3, 3)
+
+	return listWidth, detailWidth, paneHeight
+}
+
+func (u *migrationsUI) resize(width, height int) {
+	u.width, u.height = width, height
+
+	_, detailWidth, paneHeight := u.paneSizes()
+	u.detail.Width = detailWidth
+	u.detail.Height = paneHeight - 1
+}
+
+// renderList returns the migrations table, scrolled to keep the selected migration visible.
+func (u *migrationsUI) renderList(width, height int) string {
+	table := &strings.Builder{}
+	writer := tabwriter.NewWriter(table, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "VERSION\tSTATUS\tDESCRIPTION\tDOWN\tCHANGED\tAUTHOR\tTICKET")
+	for _, migration := range u.migrations {
+		down := yesNo(migration.down != nil)
+		changed := "-"
+		if migration.recorded != nil {
+			changed = yesNo(migration.changed())
+		}
+		fmt.Fprintf(writer, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n", migration.up.Version, migration.status,
+			migration.up.Description, down, changed, orDash(migration.author), orDash(migration.ticket))
+	}
+	writer.Flush()
+
+	lines := strings.Split(strings.TrimRight(table.String(), "\n"), "\n")
+	rows := lines[1:]
+
+	visible := max(height-1, 1)
+	offset := max(min(u.cursor-visible+1, len(rows)-visible), 0)
+	offset = min(offset, u.cursor)
+
+	lineStyle := lipgloss.NewStyle().MaxWidth(width)
+	rendered := []string{lineStyle.Render(lines[0])}
+	for i := offset; i < len(rows) && i < offset+visible; i++ {
+		row := lineStyle.Render(rows[i])
+		if i == u.cursor {
+			row = uiSelectedStyle.Render(row)
+		}
+		rendered = append(rendered, row)
+	}
+
+	return strings.Join(rendered, "\n")
+}
+
+func (u *migrationsUI) selected() *uiMigration {
+	if u.cursor < 0 || u.cursor >= len(u.migrations) {
+		return nil
+	}
+	return u.migrations[u.cursor]
+}
+
+func (u *migrationsUI) selectMigration(index int) {
+	if len(u.migrations) == 0 {
+		return
+	}
+
+	u.cursor = max(min(index, len(u.migrations)-1), 0)
+	u.showView()
+}
+
+func (u *migrationsUI) showView() {
+	migration := u.selected()
+	if migration == nil {
+		u.showDetail("Details", "No local migrations")
+		return
+	}
+
+	out := &strings.Builder{}
+	u.view(out, migration)
+	u.showDetail(fmt.Sprintf("Version %d", migration.up.Version), out.String())
+}
+
+func (u *migrationsUI) showDetail(title, content string) {
+	u.detailTitle = title
+	u.detailContent = content
+	u.detail.SetContent(content)
+	u.detail.GotoTop()
+}
+
+// load reads the local migrations and resolves their status from the schema history table.
+func (u *migrationsUI) load() error {
+	// The down migrations are shown and needed by the rollback
+	loadConfig := u.config.Migration
+	loadConfig.Down = true
+
+	migrationsMap, _, errs := filesystem.LoadObjectsFromFiles(&loadConfig)
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	history, err := u.repository.GetAppliedMigrations()
+	if err != nil {
+		return err
+	}
+
+	latestMigration := database.LatestAppliedVersion(history)
+
+	failing := make(map[uint16]bool)
+	for _, migration := range database.FailingAppliedMigrations(history) {
+		failing[migration.Version] = true
+	}
+
+	recorded := make(map[uint16]*database.AppliedMigration, len(history))
+	for _, migration := range history {
+		recorded[migration.Version] = migration
+	}
+
+	downMigrations := make(map[uint16]*migrations.Migration, len(migrationsMap[enums.MIGRATION_DOWN]))
+	for _, migration := range migrationsMap[enums.MIGRATION_DOWN] {
+		downMigrations[migration.Version] = migration
+	}
+
+	u.latestMigration = latestMigration
+	u.migrations = make([]*uiMigration, 0, len(migrationsMap[enums.MIGRATION_UP]))
+	for _, migration := range migrationsMap[enums.MIGRATION_UP] {
+		status := uiStatusPending
+		if failing[migration.Version] {
+			status = uiStatusFailed
+		} else if migration.Version <= latestMigration {
+			status = uiStatusApplied
+		}
+
+		author, ticket := migration.Author, migration.Ticket
+		if applied, ok := recorded[migration.Version]; ok {
+			author, ticket = applied.Author, applied.Ticket
+			if status == uiStatusApplied && applied.Skipped {
+				status = uiStatusSkipped
+			}
+		}
+
+		u.migrations = append(u.migrations, &uiMigration{
+			up:       migration,
+			down:     downMigrations[migration.Version],
+			status:   status,
+			author:   author,
+			ticket:   ticket,
+			recorded: recorded[migration.Version],
+		})
+	}
+
+	return nil
+}
+
+func (u *migrationsUI) view(out io.Writer, migration *uiMigration) {
+	fmt.Fprintf(out, "-- Version %d: %s (%s, md5 %s)\n", migration.up.Version, migration.up.Description,
+		migration.status, *migration.up.Checksum)
+	fmt.Fprintln(out, "-- up")
+	fmt.Fprintln(out, strings.TrimRight(*migration.up.Content, "\n"))
+
+	if migration.down != nil {
+		fmt.Fprintln(out, "-- down")
+		fmt.Fprintln(out, strings.TrimRight(*migration.down.Content, "\n"))
+	}
+}
+
+// diff compares the description and the checksum of the local file with the ones recorded in the schema history
+// table. The content of applied files is not recorded, so when the checksum differs, the content applied is looked
+// up in the git history of the file and diffed with the local content.
+func (u *migrationsUI) diff(out io.Writer, migration *uiMigration) {
+	if migration.recorded == nil {
+		fmt.Fprintf(out, "Version %d is not recorded in the schema history table\n", migration.up.Version)
+		return
+	}
+
+	fmt.Fprintf(out, "-- Version %d: local file and schema history table\n", migration.up.Version)
+
+	writer := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "\tLOCAL\tRECORDED\t")
+	for _, field := range []struct{ name, local, recorded string }{
+		{"description", migration.up.Description, migration.recorded.Description},
+		{"md5", *migration.up.Checksum, migration.recorded.Checksum},
+	} {
+		marker := ""
+		if field.local != field.recorded {
+			marker = "differs"
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\n", field.name, field.local, field.recorded, marker)
+	}
+	writer.Flush()
+
+	if !migration.changed() {
+		fmt.Fprintln(out, "The file matches the schema history table")
+		return
+	}
+
+	fmt.Fprintf(out, "The file changed since version %d was applied, repair it to record the local file\n",
+		migration.up.Version)
+
+	if *migration.up.Checksum != migration.recorded.Checksum {
+		u.contentDiff(out, migration)
+	}
+}
+
+// contentDiff writes the unified diff of the content applied and the local content of the migration. The content
+// applied is the one of the most recent revision of the file, in its git history, having the recorded checksum.
+func (u *migrationsUI) contentDiff(out io.Writer, migration *uiMigration) {
+	files, err := filesystem.GetUpMigrationFiles(u.config.Migration.Locations, u.config.Migration.FileExtension(),
+		migration.up.Version)
+	if err != nil {
+		fmt.Fprintf(out, "Error: %s\n", err)
+		return
+	}
+
+	if len(files) != 1 {
+		fmt.Fprintf(out, "Version %d is made of several files, the content applied can not be compared\n",
+			migration.up.Version)
+		return
+	}
+
+	name := filepath.Base(files[0])
+
+	revisions, err := report.FileRevisions(files[0])
+	if err != nil {
+		fmt.Fprintf(out, "The git history of %s is not available, the content applied can not be compared: %s\n",
+			name, err)
+		return
+	}
+
+	for _, revision := range revisions {
+		content, checksum, err := filesystem.ProcessMigrationContent(revision.Content, files[0], &u.config.Migration)
+		if err != nil || checksum != migration.recorded.Checksum {
+			continue
+		}
+
+		unified, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+			A:        difflib.SplitLines(*content),
+			B:        difflib.SplitLines(*migration.up.Content),
+			FromFile: fmt.Sprintf("%s (applied, commit %.12s)", name, revision.Commit),
+			ToFile:   fmt.Sprintf("%s (local)", name),
+			Context:  3,
+		})
+		if err != nil {
+			fmt.Fprintf(out, "Error: %s\n", err)
+			return
+		}
+
+		fmt.Fprint(out, unified)
+		return
+	}
+
+	fmt.Fprintf(out, "No revision of %s in its git history has the recorded checksum, the content applied can not be "+
+		"compared\n", name)
+}
+
+func (u *migrationsUI) repair(migration *uiMigration) (string, error) {
+	err := u.repository.DoInLock(func() error {
+		err := errors.Join(u.repository.Repair([]*migrations.Migration{migration.up})...)
+		if err != nil {
+			return err
+		}
+		return syncHistoryTable(u.logger, u.repository, u.config)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("Version %d repaired", migration.up.Version), nil
+}
+
+// checkRollback returns an error if the migration can not be rolled back, before asking for confirmation.
+func (u *migrationsUI) checkRollback(migration *uiMigration) error {
+	if migration.status == uiStatusPending {
+		return fmt.Errorf("version %d is not applied", migration.up.Version)
+	}
+
+	err := checkNotProtected(u.config, "rollback")
+	if err != nil {
+		return err
+	}
+
+	for _, later := range u.migrations {
+		if later.up.Version >= migration.up.Version && later.status != uiStatusPending && later.down == nil {
+			return fmt.Errorf("missing down migration for version %d", later.up.Version)
+		}
+	}
+
+	return nil
+}
+
+func (u *migrationsUI) rollback(migration *uiMigration) (string, error) {
+	destination := migration.up.Version - 1
+
+	downConfig := u.config.Migration
+	downConfig.Down = true
+	downConfig.Destination = &destination
+
+	rollback := migrator.NewMigrator(u.logger, u.repository, &downConfig)
+	rollback.SetHistorySync(historySyncTable(u.logger, u.config))
+
+	_, err := rollback.Migrate()
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("Rolled back to version %d", destination), nil
+}
+
+// yesNo returns "yes" or "no".
+func yesNo(value bool) string {
+	if value {
+		return "yes"
+	}
+	return "no"
+}
+
+// orDash returns the value, or "-" if empty.
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
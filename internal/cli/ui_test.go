@@ -0,0 +1,170 @@
+package cli
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/creasty/defaults"
+	"github.com/maestro-go/maestro/core/conf"
+	"github.com/maestro-go/maestro/core/enums"
+	"github.com/maestro-go/maestro/core/migrator"
+	"github.com/maestro-go/maestro/internal/cli/conn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestUIDiff(t *testing.T) {
+	dir := t.TempDir()
+	migrationsDir := filepath.Join(dir, "migrations")
+	require.NoError(t, os.Mkdir(migrationsDir, 0o755))
+
+	writeMigration := func(name, content string) {
+		err := os.WriteFile(filepath.Join(migrationsDir, name), []byte(content), 0o644)
+		require.NoError(t, err)
+	}
+	writeMigration("V001_create_users.sql", "CREATE TABLE users (id INTEGER PRIMARY KEY);")
+	writeMigration("V002_create_orders.sql", "CREATE TABLE orders (id INTEGER PRIMARY KEY);")
+	writeMigration("V003_create_items.sql", "CREATE TABLE items (id INTEGER PRIMARY KEY);")
+
+	// The applied files are committed, the content applied is found in the git history
+	for _, args := range [][]string{{"init", "-q"}, {"add", "."}, {"commit", "-q", "-m", "Add migrations"}} {
+		gitCmd := exec.Command("git", append([]string{"-c", "user.name=maestro", "-c", "user.email=maestro@example.com"},
+			args...)...)
+		gitCmd.Dir = migrationsDir
+		output, err := gitCmd.CombinedOutput()
+		require.NoError(t, err, string(output))
+	}
+
+	config := &conf.ProjectConfig{}
+	defaults.MustSet(config)
+	config.Driver = "sqlite"
+	config.Migration.Locations = []string{migrationsDir}
+	destination := uint16(2)
+	config.Migration.Destination = &destination
+
+	dbFile := filepath.Join(dir, "maestro.db")
+	require.NoError(t, os.WriteFile(dbFile, nil, 0o644))
+
+	repo, cleanup, err := conn.ConnectToDSN(context.Background(), dbFile, config, enums.DRIVER_SQLITE)
+	require.NoError(t, err)
+	defer cleanup()
+
+	_, err = migrator.NewMigrator(zap.NewNop(), repo, &config.Migration).Migrate()
+	require.NoError(t, err)
+
+	// Version 2 is changed after it was applied
+	writeMigration("V002_create_orders.sql", "CREATE TABLE orders (id INTEGER PRIMARY KEY, total INTEGER);")
+
+	ui := newMigrationsUI(repo, config)
+	require.NoError(t, ui.load())
+	ui.Init()
+
+	view := ui.View()
+	assert.Contains(t, view, "latest applied version: 2")
+	assert.Regexp(t, `1 +applied +create_users +no +no`, view)
+	assert.Regexp(t, `2 +applied +create_orders +no +yes`, view)
+	assert.Regexp(t, `3 +pending +create_items +no +-`, view)
+
+	// The selected migration is shown in the details pane
+	assert.Equal(t, "Version 1", ui.detailTitle)
+	assert.Contains(t, ui.detailContent, "CREATE TABLE users (id INTEGER PRIMARY KEY);")
+
+	pressKeys(ui, "d")
+	assert.Contains(t, ui.detailContent, "The file matches the schema history table")
+
+	pressKeys(ui, "down", "d")
+	assert.Equal(t, "Diff of version 2", ui.detailTitle)
+	assert.Regexp(t, `md5 +[0-9a-f]{32} +[0-9a-f]{32} +differs`, ui.detailContent)
+	assert.Contains(t, ui.detailContent, "The file changed since version 2 was applied, repair it to record the local file")
+	assert.Contains(t, ui.detailContent, "--- V002_create_orders.sql (applied, commit ")
+	assert.Contains(t, ui.detailContent, "+++ V002_create_orders.sql (local)")
+	assert.Contains(t, ui.detailContent, "\n-CREATE TABLE orders (id INTEGER PRIMARY KEY);\n")
+	assert.Contains(t, ui.detailContent, "\n+CREATE TABLE orders (id INTEGER PRIMARY KEY, total INTEGER);\n")
+
+	pressKeys(ui, "j", "d")
+	assert.Contains(t, ui.detailContent, "Version 3 is not recorded in the schema history table")
+}
+
+func TestUIActions(t *testing.T) {
+	dir := t.TempDir()
+	migrationsDir := filepath.Join(dir, "migrations")
+	require.NoError(t, os.Mkdir(migrationsDir, 0o755))
+
+	writeMigration := func(name, content string) {
+		err := os.WriteFile(filepath.Join(migrationsDir, name), []byte(content), 0o644)
+		require.NoError(t, err)
+	}
+	writeMigration("V001_create_users.sql", "CREATE TABLE users (id INTEGER PRIMARY KEY);")
+	writeMigration("V002_create_orders.sql", "CREATE TABLE orders (id INTEGER PRIMARY KEY);")
+	writeMigration("V002_create_orders.down.sql", "DROP TABLE orders;")
+
+	config := &conf.ProjectConfig{}
+	defaults.MustSet(config)
+	config.Driver = "sqlite"
+	config.Migration.Locations = []string{migrationsDir}
+
+	dbFile := filepath.Join(dir, "maestro.db")
+	require.NoError(t, os.WriteFile(dbFile, nil, 0o644))
+
+	repo, cleanup, err := conn.ConnectToDSN(context.Background(), dbFile, config, enums.DRIVER_SQLITE)
+	require.NoError(t, err)
+	defer cleanup()
+
+	_, err = migrator.NewMigrator(zap.NewNop(), repo, &config.Migration).Migrate()
+	require.NoError(t, err)
+
+	writeMigration("V002_create_orders.sql", "CREATE TABLE orders (id INTEGER PRIMARY KEY, total INTEGER);")
+
+	ui := newMigrationsUI(repo, config)
+	require.NoError(t, ui.load())
+	ui.Init()
+
+	// Version 1 has no down migration
+	pressKeys(ui, "b")
+	assert.Nil(t, ui.confirming)
+	assert.Equal(t, "Error: missing down migration for version 1", ui.status)
+
+	// Any answer but y cancels
+	pressKeys(ui, "j", "r")
+	assert.Contains(t, ui.View(), "Mark version 2 as succeeded with the local checksum? [y/N]")
+	pressKeys(ui, "n")
+	assert.Equal(t, "Cancelled", ui.status)
+	assert.True(t, ui.migrations[1].changed())
+
+	pressKeys(ui, "r", "y")
+	assert.Equal(t, "Version 2 repaired", ui.status)
+	assert.False(t, ui.migrations[1].changed())
+
+	pressKeys(ui, "b", "y")
+	assert.Equal(t, "Rolled back to version 1", ui.status)
+	assert.Equal(t, "Logs", ui.detailTitle)
+	assert.Equal(t, uiStatusPending, ui.migrations[1].status)
+	assert.Equal(t, uint16(1), ui.latestMigration)
+}
+
+// pressKeys sends the keys to the interface, running the commands they return like the program does.
+func pressKeys(ui *migrationsUI, keys ...string) {
+	for _, key := range keys {
+		msg := tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(key)}
+		switch key {
+		case "up":
+			msg = tea.KeyMsg{Type: tea.KeyUp}
+		case "down":
+			msg = tea.KeyMsg{Type: tea.KeyDown}
+		case "enter":
+			msg = tea.KeyMsg{Type: tea.KeyEnter}
+		case "tab":
+			msg = tea.KeyMsg{Type: tea.KeyTab}
+		}
+
+		_, cmd := ui.Update(msg)
+		for cmd != nil {
+			_, cmd = ui.Update(cmd())
+		}
+	}
+}
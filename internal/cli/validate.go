@@ -0,0 +1,73 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/maestro-go/maestro/core/enums"
+	"github.com/maestro-go/maestro/core/migrator"
+	"github.com/maestro-go/maestro/internal/cli/conn"
+	"github.com/maestro-go/maestro/internal/cli/flags"
+	"github.com/maestro-go/maestro/internal/utils/logger"
+	"github.com/spf13/cobra"
+)
+
+func SetupValidateCommand() *cobra.Command {
+	validateCmd := &cobra.Command{
+		Use:   "validate",
+		Short: "Validate the migrations without migrating",
+		Long: `The validate command runs the validation of the migrate command without migrating: the schema history table
+must have no unsucceeded migration, the versions of the local migrations no gap, and the checksums of the applied
+migrations must match the local ones. The validation options of the configuration (validation-ignore,
+validate-applied-only, validate-allow-missing and the version ranges) apply, and the validation runs also
+when validate is disabled. The command fails if the validation fails, so it can be used as a check. The
+database is only read: the lock is not taken and no hook is executed.`,
+		RunE: runValidateCommand,
+	}
+
+	validateCmd.Flags().SortFlags = false
+	flags.SetupDBConfigFlags(validateCmd)
+	flags.SetupMigrationConfigFlags(validateCmd)
+
+	return validateCmd
+}
+
+func runValidateCommand(cmd *cobra.Command, args []string) error {
+	logger, err := logger.NewLogger()
+	if err != nil {
+		log.Fatal(err)
+		return err
+	}
+
+	ctx := context.Background()
+
+	projectConfig, removeLocations, err := loadProjectConfig(cmd, logger)
+	if err != nil {
+		return err
+	}
+	defer removeLocations()
+
+	driver, ok := enums.MapStringToDriverType[projectConfig.Driver]
+	if !ok {
+		logError(logger, ErrInvalidDriver, errors.New(projectConfig.Driver))
+		return genError(ErrInvalidDriver, errors.New(projectConfig.Driver))
+	}
+
+	repo, cleanup, err := conn.ConnectToDatabaseReadOnly(ctx, projectConfig, driver)
+	if err != nil {
+		logError(logger, ErrConnectToDatabase, err)
+		return genError(ErrConnectToDatabase, err)
+	}
+	defer cleanup()
+
+	err = migrator.NewMigrator(logger, repo, &projectConfig.Migration).Validate()
+	if err != nil {
+		logError(logger, ErrValidation, err)
+		return genError(ErrValidation, err)
+	}
+
+	logger.Info("Migrations are valid")
+
+	return nil
+}
@@ -7,6 +7,7 @@ const VERSION = "v1.0.2"
 const (
 	DEFAULT_PROJECT_FILE   = "maestro.yaml"
 	DEFAULT_MIGRATIONS_DIR = "./migrations"
+	DEFAULT_RESUME_FILE    = ".maestro-resume.json"
 )
 
 const NEW_MIGRATION_PLACEHOLDER = `/*
@@ -19,6 +20,13 @@ const (
 	MIGRATION_REGEX      = `^V(\d+)_([^.]+)\.sql$`
 	MIGRATION_DOWN_REGEX = `^V(\d+)_([^.]+)\.down\.sql$`
 
+	DATA_MIGRATION_REGEX      = `^D(\d+)__?([^.]+)\.sql$`
+	DATA_MIGRATION_DOWN_REGEX = `^D(\d+)__?([^.]+)\.down\.sql$`
+
+	MIGRATION_PART_REGEX = `^(\d+)_(.+)$` // Part number and description of the files of multi-file versions
+
+	VERSION_RANGE_REGEX = `^\s*(\d+)\s*-\s*(\d+)\s*$` // First and last version of a location
+
 	HOOK_REPEATABLE_REGEX      = `^R(\d+)_([^.]+)\.sql$`
 	HOOK_REPEATABLE_DOWN_REGEX = `^R(\d+)_([^.]+)\.down\.sql$`
 
@@ -30,5 +38,27 @@ const (
 	HOOK_AFTER_EACH_REGEX    = `^AE(\d+)_([^.]+)\.sql$`
 	HOOK_AFTER_VERSION_REGEX = `^AV(\d+)_(\d+)_([^.]+)\.sql$`
 
+	HOOK_ASSERTION_REGEX = `^T(\d+)_([^.]+)\.sql$`
+
+	HOOK_BEFORE_VALIDATE_REGEX = `^BVAL(\d+)_([^.]+)\.sql$`
+
+	HOOK_RUN_START_REGEX = `^RS(\d+)_([^.]+)\.sql$`
+	HOOK_RUN_END_REGEX   = `^RE(\d+)_([^.]+)\.sql$`
+
+	HOOK_BEFORE_VERSION_DOWN_REGEX = `^BV(\d+)_(\d+)_([^.]+)\.down\.sql$`
+	HOOK_AFTER_VERSION_DOWN_REGEX  = `^AV(\d+)_(\d+)_([^.]+)\.down\.sql$`
+
 	TEMPLATE_REGEX = `^([^.]+)\.template\.sql$`
+
+	SEED_REGEX = `^S(\d+)_([^.]+)(?:\.([^.]+))?\.sql$` // The optional group is the seed environment
+
+	LOAD_DIRECTIVE_REGEX = `(?im)^[ \t]*--[ \t]*maestro:load[ \t]+(\S+)[ \t]+INTO[ \t]+(\S+)[ \t\r]*$` // File path and table
+
+	NO_TRANSACTION_DIRECTIVE_REGEX  = `(?im)^[ \t]*--[ \t]*maestro:no-transaction[ \t\r]*$`
+	SKIP_VALIDATION_DIRECTIVE_REGEX = `(?im)^[ \t]*--[ \t]*maestro:skip-validation[ \t\r]*$`
+	DESTRUCTIVE_DIRECTIVE_REGEX     = `(?im)^[ \t]*--[ \t]*maestro:destructive[ \t\r]*$`
+
+	DESTRUCTIVE_STATEMENT_REGEX = `(?i)\b(DROP\s+(TABLE|SCHEMA|DATABASE|COLUMN)|TRUNCATE)\b` // Statements losing data
+
+	METADATA_DIRECTIVE_REGEX = `(?im)^[ \t]*--[ \t]*maestro:(author|date|ticket|tags)[ \t]+(.*?)[ \t\r]*$` // Header field and value
 )
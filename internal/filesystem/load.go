@@ -3,20 +3,22 @@ package filesystem
 import (
 	"crypto/md5"
 	"encoding/hex"
-	"io/fs"
+	"fmt"
 	"os"
 	"path/filepath"
-	"regexp"
 	"sort"
-	"strconv"
 	"sync"
 
 	"github.com/maestro-go/maestro/core/conf"
 	"github.com/maestro-go/maestro/core/enums"
-	internalConf "github.com/maestro-go/maestro/internal/conf"
+	"github.com/maestro-go/maestro/core/parser"
 	"github.com/maestro-go/maestro/internal/migrations"
+	"golang.org/x/sync/errgroup"
 )
 
+// load_workers is the number of files of a location loaded at the same time.
+const load_workers = 32
+
 // LoadObjectsFromFiles reads migration and hook files from the specified directories.
 //
 // This function processes files in the given directories to load migration and hook objects.
@@ -25,99 +27,156 @@ import (
 // content. For up migration files, an MD5 checksum is generated for the final content (after the templates process).
 //
 // Notes:
-//   - Files are processed concurrently for better performance.
+//   - Files are processed concurrently by a bounded pool of workers, and every file failing to load reports
+//     its error.
 //   - Mutexes ensure thread-safe updates to the migration and hook maps.
 //   - Only migrations and hooks matching the configuration criteria are loaded.
+//   - If a manifest is configured, files whose size and modification time did not change are taken from it.
+//   - If version ranges are configured, the migrations of each location must have versions of its range, or
+//     versions out of the ranges if it has none.
 func LoadObjectsFromFiles(config *conf.MigrationConfig) (
 	map[enums.MigrationType][]*migrations.Migration, map[enums.HookType][]*migrations.Hook, []error) {
 
-	templates, errs := loadTemplates(config.Locations)
+	track, ok := enums.MapStringToMigrationTrack[config.Track]
+	if !ok {
+		return nil, nil, []error{fmt.Errorf("invalid migration track: %s", config.Track)}
+	}
+
+	templates, errs := LoadTemplates(config.Locations)
 	if len(errs) > 0 {
 		return nil, nil, errs
 	}
 
+	templates = migrations.WithBuiltinTemplates(templates, config.Driver)
+
+	versionRanges, err := migrations.ParseVersionRanges(config.Locations, config.VersionRanges)
+	if err != nil {
+		return nil, nil, []error{err}
+	}
+
+	extension := config.FileExtension()
+
+	// Unchanged files are taken from the manifest, if enabled, instead of being read and processed again
+	cache := loadManifest(config.Manifest, templates)
+
 	migrationsO := make(map[enums.MigrationType][]*migrations.Migration)
 	hooksO := make(map[enums.HookType][]*migrations.Hook)
 
 	muM := new(sync.Mutex) // Locks the access to migrations slice
 	muH := new(sync.Mutex) // Locks the access to hooks slice
 
-	for _, migrationDir := range config.Locations {
+	loadErrs := make([]error, 0)
+	for locationIndex, migrationDir := range config.Locations {
 		entries, err := os.ReadDir(migrationDir)
 		if err != nil {
 			return nil, nil, []error{err}
 		}
 
-		loadObjectsErrs := make([]error, 0)
-		wg := new(sync.WaitGroup)
-		for _, entry := range entries {
-			wg.Add(1)
-			go func(entry fs.DirEntry) {
-				defer wg.Done()
+		// The files are loaded by a bounded pool of workers, every file failing to load reporting its error
+		errs := loadEntries(entries, func(entry os.DirEntry) error {
+			migration, isMigration, err := checkAndLoadMigrationInfo(entry.Name(), track, extension)
+			if err != nil {
+				return fmt.Errorf("%s: %w", filepath.Join(migrationDir, entry.Name()), err)
+			}
 
-				migration, isMigration, err := checkAndLoadMigrationInfo(entry.Name())
+			if isMigration {
+				// Migrations not loaded, e.g. down ones, are checked too, so a misplaced file fails early
+				err = versionRanges.CheckLocation(migrationDir, migration.Version)
 				if err != nil {
-					loadObjectsErrs = append(loadObjectsErrs, err)
-					return
+					return fmt.Errorf("%s: %w", filepath.Join(migrationDir, entry.Name()), err)
 				}
 
-				if isMigration {
-					if isToAddMigration(migration, config) {
-						content, err := loadFileContent(filepath.Join(migrationDir, entry.Name()), templates)
-						if err != nil {
-							loadObjectsErrs = append(loadObjectsErrs, err)
-							return
-						}
+				if isToAddMigration(migration, config) {
+					filePath := filepath.Join(migrationDir, entry.Name())
+					content, md5Checksum, err := cache.content(filePath, entry, func() (*string, bool, error) {
+						return loadFileContent(filePath, templates, extension, config.Driver)
+					})
+					if err != nil {
+						return err
+					}
 
-						migration.Content = content
+					migration.Content = content
+					migration.Location = locationIndex
+					migration.Destructive = isDestructive(content)
 
-						if migration.Type == enums.MIGRATION_UP {
-							md5Checksum := generateMd5Checksum(content)
-							migration.Checksum = &md5Checksum
-						}
+					if migration.Type == enums.MIGRATION_UP {
+						migration.Checksum = &md5Checksum
+						migration.SkipValidation = hasSkipValidationDirective(content)
 
-						muM.Lock()
-						migrationsO[migration.Type] = append(migrationsO[migration.Type], migration)
-						muM.Unlock()
+						metadata := metadataDirectives(content)
+						migration.Author = metadata["author"]
+						migration.Ticket = metadata["ticket"]
+						migration.Tags = splitTags(metadata["tags"])
 					}
-					return
+
+					muM.Lock()
+					migrationsO[migration.Type] = append(migrationsO[migration.Type], migration)
+					muM.Unlock()
 				}
+				return nil
+			}
+
+			hook, isHook, err := checkAndLoadHookInfo(entry.Name(), extension)
+			if err != nil {
+				return fmt.Errorf("%s: %w", filepath.Join(migrationDir, entry.Name()), err)
+			}
 
-				hook, isHook, err := checkAndLoadHookInfo(entry.Name())
+			// Hooks only apply to the schema track
+			if isHook && track == enums.TRACK_SCHEMA && isToAddHook(hook, config) {
+				filePath := filepath.Join(migrationDir, entry.Name())
+				content, _, err := cache.content(filePath, entry, func() (*string, bool, error) {
+					return loadFileContent(filePath, templates, extension, config.Driver)
+				})
 				if err != nil {
-					loadObjectsErrs = append(loadObjectsErrs, err)
-					return
+					return err
 				}
 
-				if isHook && isToAddHook(hook, config) {
-					content, err := loadFileContent(filepath.Join(migrationDir, entry.Name()), templates)
-					if err != nil {
-						loadObjectsErrs = append(loadObjectsErrs, err)
-						return
-					}
+				hook.Content = content
+				hook.OutsideTransaction = hasNoTransactionDirective(content)
+				hook.Location = locationIndex
+				hook.FileName = entry.Name()
 
-					hook.Content = content
+				muH.Lock()
+				hooksO[hook.Type] = append(hooksO[hook.Type], hook)
+				muH.Unlock()
+			}
+			return nil
+		})
+		loadErrs = append(loadErrs, errs...)
+	}
 
-					muH.Lock()
-					hooksO[hook.Type] = append(hooksO[hook.Type], hook)
-					muH.Unlock()
-				}
-			}(entry)
-		}
+	if len(loadErrs) > 0 {
+		return nil, nil, loadErrs
+	}
+
+	err = cache.save()
+	if err != nil {
+		return nil, nil, []error{err}
+	}
 
-		wg.Wait()
-		if len(loadObjectsErrs) > 0 {
-			return nil, nil, loadObjectsErrs
+	// Versions made of several files are executed as a single migration
+	for migrationType, migrationsOfType := range migrationsO {
+		combined, errs := combineMigrationParts(migrationsOfType, migrationType, extension)
+		if len(errs) > 0 {
+			return nil, nil, errs
 		}
+		migrationsO[migrationType] = combined
 	}
 
 	sortMigrations(&migrationsO)
 	sortHooks(&hooksO)
 
+	if config.DisallowDuplicateHooks {
+		errs := validateDuplicateHooks(hooksO, config.Locations)
+		if len(errs) > 0 {
+			return nil, nil, errs
+		}
+	}
+
 	return migrationsO, hooksO, nil
 }
 
-// loadTemplates loads migration templates from the specified directories.
+// LoadTemplates loads migration templates from the specified directories.
 //
 // This function iterates over the provided list of directory paths, reads all files
 // within each directory, and identifies files that match the template naming
@@ -125,101 +184,129 @@ func LoadObjectsFromFiles(config *conf.MigrationConfig) (
 // creating a template object.
 // These objects are collected into a slice, which is returned along with any errors
 // encountered during the process.
-func loadTemplates(migrationsDirs []string) ([]*migrations.Template, []error) {
+func LoadTemplates(migrationsDirs []string) ([]*migrations.Template, []error) {
 	templatesO := make([]*migrations.Template, 0)
 
-	re := regexp.MustCompile(internalConf.TEMPLATE_REGEX)
-
 	mu := new(sync.Mutex) // Blocks access to slice
 
+	loadErrs := make([]error, 0)
 	for _, migrationDir := range migrationsDirs {
 		entries, err := os.ReadDir(migrationDir)
 		if err != nil {
 			return nil, []error{err}
 		}
 
-		loadFilesErrs := make([]error, 0)
-		wg := new(sync.WaitGroup)
-		for _, entry := range entries {
-			wg.Add(1)
-			go func(entry fs.DirEntry) {
-				defer wg.Done()
+		errs := loadEntries(entries, func(entry os.DirEntry) error {
+			name, err := parser.ParseFileName(entry.Name(), "sql")
+			if err != nil {
+				return fmt.Errorf("%s: %w", filepath.Join(migrationDir, entry.Name()), err)
+			}
 
-				matches := re.FindStringSubmatch(entry.Name())
+			if name == nil || name.Kind != parser.KIND_TEMPLATE {
+				return nil
+			}
 
-				if matches == nil {
-					return
-				}
+			templateName := name.Description
 
-				templateName := matches[1]
+			content, err := os.ReadFile(filepath.Join(migrationDir, entry.Name()))
+			if err != nil {
+				return err
+			}
 
-				content, err := os.ReadFile(filepath.Join(migrationDir, entry.Name()))
-				if err != nil {
-					loadFilesErrs = append(loadFilesErrs, err)
-				}
+			contentStr := string(content)
 
-				contentStr := string(content)
+			template := &migrations.Template{
+				Name:    templateName,
+				Content: &contentStr,
+			}
 
-				template := &migrations.Template{
-					Name:    templateName,
-					Content: &contentStr,
-				}
+			mu.Lock()
+			templatesO = append(templatesO, template)
+			mu.Unlock()
+			return nil
+		})
+		loadErrs = append(loadErrs, errs...)
+	}
 
-				mu.Lock()
-				templatesO = append(templatesO, template)
-				mu.Unlock()
-			}(entry)
-		}
+	if len(loadErrs) > 0 {
+		return templatesO, loadErrs
+	}
+
+	return templatesO, nil
+}
+
+// loadEntries loads the entries of a directory by a bounded pool of workers. Every entry is loaded, even if others
+// fail, and the errors of the failing ones are returned in the order of the entries.
+func loadEntries(entries []os.DirEntry, load func(entry os.DirEntry) error) []error {
+	entryErrs := make([]error, len(entries)) // Indexed by entry, each worker setting its own
+
+	group := new(errgroup.Group)
+	group.SetLimit(load_workers)
+	for i, entry := range entries {
+		group.Go(func() error {
+			entryErrs[i] = load(entry)
+			return nil
+		})
+	}
+	group.Wait()
 
-		wg.Wait()
-		if len(loadFilesErrs) > 0 {
-			return templatesO, loadFilesErrs
+	errs := make([]error, 0)
+	for _, err := range entryErrs {
+		if err != nil {
+			errs = append(errs, err)
 		}
 	}
 
-	return templatesO, nil
+	return errs
+}
+
+// parseFileName parses the file name with `parser.ParseFileName`, and fails for the names looking like the ones
+// of maestro files without matching their pattern (see `parser.NearMiss`), which would be ignored otherwise.
+func parseFileName(fileName string, extension string) (*parser.FileName, error) {
+	name, err := parser.ParseFileName(fileName, extension)
+	if name != nil || err != nil {
+		return name, err
+	}
+	return nil, parser.NearMiss(fileName, extension)
+}
+
+// trackKinds are the kinds of the migration files of the tracks.
+var trackKinds = map[enums.MigrationTrack]parser.Kind{
+	enums.TRACK_SCHEMA: parser.KIND_MIGRATION,
+	enums.TRACK_DATA:   parser.KIND_DATA_MIGRATION,
 }
 
-// checkAndLoadMigrationInfo determines if the given file name corresponds to a migration and extracts its details.
+// checkAndLoadMigrationInfo determines if the given file name corresponds to a migration of the track and
+// extracts its details.
 //
-// This function iterates over a predefined map of migration types to their corresponding regex patterns,
-// attempting to match the provided file name against each pattern. If a match is found, it extracts the
-// migration's version and description from the file name and returns a Migration object with these details.
+// The file name is parsed by `parseFileName`, and a Migration object is returned with the type, version
+// and description of the file if it is a migration of the track.
 //
 // Notes:
-//   - The function uses a map (`enums.MapMigrationTypeToRegex`) that associates migration types with regex
-//     patterns to identify the type of migration.
-//   - If the file name does not match any regex pattern, the function returns nil, false, and no error.
-func checkAndLoadMigrationInfo(fileName string) (*migrations.Migration, bool, error) {
-	for migrationType, regex := range enums.MapMigrationTypeToRegex {
-		re := regexp.MustCompile(regex)
-
-		matches := re.FindStringSubmatch(fileName)
-
-		if matches != nil {
-			version := uint16(0)
-			description := string("")
-
-			versionStr := matches[1]
-			v, err := strconv.ParseUint(versionStr, 10, 16)
-			if err != nil {
-				return nil, false, err
-			}
+//   - If the file name is not the one of a migration of the track, the function returns nil, false, and no error.
+//   - Malformed names of maestro files, e.g. V1.2_description.sql or V001_description.SQL, return the error of
+//     the parser.
+func checkAndLoadMigrationInfo(fileName string, track enums.MigrationTrack, extension string) (*migrations.Migration, bool, error) {
+	name, err := parseFileName(fileName, extension)
+	if err != nil {
+		return nil, false, err
+	}
 
-			version = uint16(v)
-			description = matches[2]
+	if name == nil || name.Kind != trackKinds[track] {
+		return nil, false, nil
+	}
 
-			migration := &migrations.Migration{
-				Type:        migrationType,
-				Version:     version,
-				Description: description,
-			}
+	migration := &migrations.Migration{
+		Type:        enums.MIGRATION_UP,
+		Version:     name.Version,
+		Description: name.Description,
+	}
 
-			return migration, true, nil
-		}
+	if name.Down {
+		migration.Type = enums.MIGRATION_DOWN
 	}
 
-	return nil, false, nil
+	return migration, true, nil
 }
 
 func isToAddMigration(migration *migrations.Migration, config *conf.MigrationConfig) bool {
@@ -227,59 +314,79 @@ func isToAddMigration(migration *migrations.Migration, config *conf.MigrationCon
 		migration.Type == enums.MIGRATION_DOWN && config.Down
 }
 
+// hookPrefix is the prefix of the files of a hook type, and whether they are down files.
+type hookPrefix struct {
+	prefix string
+	down   bool
+}
+
+// hookTypes are the hook types of the file prefixes.
+var hookTypes = map[hookPrefix]enums.HookType{
+	{"R", false}:    enums.HOOK_REPEATABLE,
+	{"R", true}:     enums.HOOK_REPEATABLE_DOWN,
+	{"B", false}:    enums.HOOK_BEFORE,
+	{"BE", false}:   enums.HOOK_BEFORE_EACH,
+	{"BV", false}:   enums.HOOK_BEFORE_VERSION,
+	{"BV", true}:    enums.HOOK_BEFORE_VERSION_DOWN,
+	{"A", false}:    enums.HOOK_AFTER,
+	{"AE", false}:   enums.HOOK_AFTER_EACH,
+	{"AV", false}:   enums.HOOK_AFTER_VERSION,
+	{"AV", true}:    enums.HOOK_AFTER_VERSION_DOWN,
+	{"T", false}:    enums.HOOK_ASSERTION,
+	{"BVAL", false}: enums.HOOK_BEFORE_VALIDATE,
+	{"RS", false}:   enums.HOOK_RUN_START,
+	{"RE", false}:   enums.HOOK_RUN_END,
+}
+
 // checkAndLoadHookInfo determines if the given file name corresponds to a hook and extracts its details.
 //
-// This function iterates over a predefined map of hook types to their corresponding regex patterns,
-// attempting to match the provided file name against each pattern. If a match is found, it extracts the
-// hook's order, description and version (for BEV and AEV hooks) from the file name and returns a Hook object
-// with these details.
+// The file name is parsed by `parseFileName`, and a Hook object is returned with the type, order and
+// version (for BV and AV hooks) of the file if it is a hook.
 //
 // Notes:
-//   - The function uses a map (`enums.MapHookTypeToRegex `) that associates hook types with regex
-//     patterns to identify the type of hook.
-//   - If the file name does not match any regex pattern, the function returns nil, false, and no error.
-func checkAndLoadHookInfo(fileName string) (*migrations.Hook, bool, error) {
-	for hookType, regex := range enums.MapHookTypeToRegex {
-		re := regexp.MustCompile(regex)
-
-		matches := re.FindStringSubmatch(fileName)
-
-		if matches != nil {
-			order := uint8(0)
-
-			orderStr := matches[1]
-			o, err := strconv.ParseUint(orderStr, 10, 8)
-			if err != nil {
-				return nil, false, err
-			}
-
-			order = uint8(o)
-
-			hook := &migrations.Hook{
-				Type:  hookType,
-				Order: order,
-			}
-
-			if hookType == enums.HOOK_BEFORE_VERSION || hookType == enums.HOOK_AFTER_VERSION {
-				versionStr := matches[2]
-				v, err := strconv.ParseUint(versionStr, 10, 16)
-				if err != nil {
-					return nil, false, err
-				}
+//   - If the file name is not the one of a hook, the function returns nil, false, and no error.
+//   - Malformed names of maestro files, e.g. B01description.sql or b01_description.sql, return the error of the
+//     parser.
+func checkAndLoadHookInfo(fileName string, extension string) (*migrations.Hook, bool, error) {
+	name, err := parseFileName(fileName, extension)
+	if err != nil {
+		return nil, false, err
+	}
 
-				hook.Version = uint16(v)
-			}
+	if name == nil || name.Kind != parser.KIND_HOOK {
+		return nil, false, nil
+	}
 
-			return hook, true, nil
-		}
+	hook := &migrations.Hook{
+		Type:    hookTypes[hookPrefix{name.Prefix, name.Down}],
+		Order:   name.Order,
+		Version: name.Version,
 	}
 
-	return nil, false, nil
+	return hook, true, nil
 }
 
 func isToAddHook(hook *migrations.Hook, config *conf.MigrationConfig) bool {
+	// Before-validate and run hooks are executed in both directions
+	switch hook.Type {
+	case enums.HOOK_BEFORE_VALIDATE:
+		return config.UseBeforeValidate
+	case enums.HOOK_RUN_START:
+		return config.UseRunStart
+	case enums.HOOK_RUN_END:
+		return config.UseRunEnd
+	}
+
 	if config.Down {
-		return hook.Type == enums.HOOK_REPEATABLE_DOWN && config.UseRepeatable
+		switch hook.Type {
+		case enums.HOOK_REPEATABLE_DOWN:
+			return config.UseRepeatable
+		case enums.HOOK_BEFORE_VERSION_DOWN:
+			return config.UseBeforeVersion
+		case enums.HOOK_AFTER_VERSION_DOWN:
+			return config.UseAfterVersion
+		}
+		return false
 	}
 
 	isToAdd := false
@@ -298,21 +405,70 @@ func isToAddHook(hook *migrations.Hook, config *conf.MigrationConfig) bool {
 		isToAdd = config.UseAfterVersion
 	case enums.HOOK_REPEATABLE:
 		isToAdd = config.UseRepeatable
+	case enums.HOOK_ASSERTION:
+		isToAdd = config.UseAssertions
 	}
 	return isToAdd
 }
 
-func loadFileContent(filePath string, templates []*migrations.Template) (*string, error) {
+// loadFileContent reads the file and replaces its templates and load directives. It also reports whether the
+// content only depends on the file and the templates, i.e. no load directive was expanded. Load directives are
+// rejected if the driver can not execute the COPY or LOAD DATA statements they are expanded to.
+func loadFileContent(filePath string, templates []*migrations.Template, extension string, driver string) (
+	*string, bool, error) {
 	content, err := os.ReadFile(filePath)
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
+	return processFileContent(content, filePath, templates, extension, driver)
+}
+
+// processFileContent replaces the templates and load directives of the content of the file, as loadFileContent.
+func processFileContent(content []byte, filePath string, templates []*migrations.Template, extension string,
+	driver string) (*string, bool, error) {
 	contentStr := string(content)
 
-	migrations.ParseTemplates(&contentStr, templates)
+	err := migrations.ParseTemplates(&contentStr, templates)
+	if err != nil {
+		return nil, false, fmt.Errorf("%s: %w", filepath.Base(filePath), err)
+	}
+
+	selfContained := true
+
+	// Load directives are SQL comments
+	if extension == "sql" {
+		selfContained = !loadDirectiveMatch.MatchString(contentStr)
+		if !selfContained && !conf.SupportsLoadDirective(driver) {
+			return nil, false, fmt.Errorf("%s: maestro:load directives are not supported by the %s driver",
+				filepath.Base(filePath), driver)
+		}
+
+		err = expandLoadDirectives(&contentStr, filepath.Dir(filePath), driver)
+		if err != nil {
+			return nil, false, fmt.Errorf("%s: %w", filepath.Base(filePath), err)
+		}
+	}
+
+	return &contentStr, selfContained, nil
+}
+
+// ProcessMigrationContent processes the content of the migration file as LoadObjectsFromFiles does, e.g. a previous
+// revision of the file, and returns the processed content with its checksum. The templates are the ones of the
+// configured locations.
+func ProcessMigrationContent(content []byte, filePath string, config *conf.MigrationConfig) (*string, string, error) {
+	templates, errs := LoadTemplates(config.Locations)
+	if len(errs) > 0 {
+		return nil, "", errs[0]
+	}
+
+	processed, _, err := processFileContent(content, filePath, migrations.WithBuiltinTemplates(templates, config.Driver),
+		config.FileExtension(), config.Driver)
+	if err != nil {
+		return nil, "", err
+	}
 
-	return &contentStr, nil
+	return processed, generateMd5Checksum(processed), nil
 }
 
 func generateMd5Checksum(content *string) string {
@@ -332,10 +488,52 @@ func sortMigrations(groupedMigrations *map[enums.MigrationType][]*migrations.Mig
 	}
 }
 
+// sortHooks orders the hooks of each type by their order number.
+//
+// Hooks sharing the same order number are ordered by the position of their location in the
+// configured locations list and then by file name, so the execution order does not depend on
+// the order in which files were read.
 func sortHooks(groupedHooks *map[enums.HookType][]*migrations.Hook) {
 	for hookType := range *groupedHooks {
-		sort.Slice((*groupedHooks)[hookType], func(i, j int) bool {
-			return (*groupedHooks)[hookType][i].Order < (*groupedHooks)[hookType][j].Order
+		hooks := (*groupedHooks)[hookType]
+		sort.SliceStable(hooks, func(i, j int) bool {
+			if hooks[i].Order != hooks[j].Order {
+				return hooks[i].Order < hooks[j].Order
+			}
+			if hooks[i].Location != hooks[j].Location {
+				return hooks[i].Location < hooks[j].Location
+			}
+			return hooks[i].FileName < hooks[j].FileName
 		})
 	}
 }
+
+// validateDuplicateHooks reports hooks that share the same file name in different locations.
+func validateDuplicateHooks(groupedHooks map[enums.HookType][]*migrations.Hook, locations []string) []error {
+	errs := make([]error, 0)
+
+	// The hook types are checked in the order of the enum, so the errors are reported in the same order each run
+	hookTypes := make([]enums.HookType, 0, len(groupedHooks))
+	for hookType := range groupedHooks {
+		hookTypes = append(hookTypes, hookType)
+	}
+	sort.Slice(hookTypes, func(i, j int) bool { return hookTypes[i] < hookTypes[j] })
+
+	for _, hookType := range hookTypes {
+		hooks := groupedHooks[hookType]
+		for i := 1; i < len(hooks); i++ {
+			for j := 0; j < i; j++ {
+				if hooks[i].FileName == hooks[j].FileName {
+					errs = append(errs, fmt.Errorf("duplicated hook %s found in %s and %s",
+						hooks[i].FileName, locations[hooks[j].Location], locations[hooks[i].Location]))
+					break
+				}
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
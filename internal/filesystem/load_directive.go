@@ -0,0 +1,172 @@
+package filesystem
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/maestro-go/maestro/internal/conf"
+	"github.com/maestro-go/maestro/internal/migrations"
+)
+
+var loadDirectiveMatch = regexp.MustCompile(conf.LOAD_DIRECTIVE_REGEX)
+
+var noTransactionDirectiveMatch = regexp.MustCompile(conf.NO_TRANSACTION_DIRECTIVE_REGEX)
+
+var skipValidationDirectiveMatch = regexp.MustCompile(conf.SKIP_VALIDATION_DIRECTIVE_REGEX)
+
+var destructiveDirectiveMatch = regexp.MustCompile(conf.DESTRUCTIVE_DIRECTIVE_REGEX)
+
+var destructiveStatementMatch = regexp.MustCompile(conf.DESTRUCTIVE_STATEMENT_REGEX)
+
+var lineCommentMatch = regexp.MustCompile(`--[^\n]*`)
+
+var metadataDirectiveMatch = regexp.MustCompile(conf.METADATA_DIRECTIVE_REGEX)
+
+var copyTextEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+
+// expandLoadDirectives replaces every "-- maestro:load <file> INTO <table>" directive of the content
+// with a COPY ... FROM STDIN statement followed by the rows of the file, so the data is loaded through
+// the copy protocol and is part of the migration checksum. With the mariadb driver, the statement is a
+// LOAD DATA LOCAL INFILE statement whose file is the rows following it, in the same format.
+//
+// The file path is relative to dir. CSV (.csv) and TSV (.tsv) files are supported, and their first
+// record must be the header with the column names. Empty fields are loaded as NULL.
+func expandLoadDirectives(content *string, dir string, driver string) error {
+	if !strings.Contains(*content, "maestro:load") {
+		return nil
+	}
+
+	var expandErr error
+	expanded := loadDirectiveMatch.ReplaceAllStringFunc(*content, func(directive string) string {
+		if expandErr != nil {
+			return directive
+		}
+
+		groups := loadDirectiveMatch.FindStringSubmatch(directive)
+
+		statement, err := buildCopyFromFile(filepath.Join(dir, groups[1]), groups[2], driver)
+		if err != nil {
+			expandErr = fmt.Errorf("maestro:load %s: %w", groups[1], err)
+			return directive
+		}
+
+		return statement
+	})
+
+	if expandErr != nil {
+		return expandErr
+	}
+
+	*content = expanded
+	return nil
+}
+
+// hasNoTransactionDirective reports whether the content has a "-- maestro:no-transaction" directive line.
+func hasNoTransactionDirective(content *string) bool {
+	return strings.Contains(*content, "maestro:no-transaction") && noTransactionDirectiveMatch.MatchString(*content)
+}
+
+// hasSkipValidationDirective reports whether the content has a "-- maestro:skip-validation" directive line.
+func hasSkipValidationDirective(content *string) bool {
+	return strings.Contains(*content, "maestro:skip-validation") && skipValidationDirectiveMatch.MatchString(*content)
+}
+
+// isDestructive reports whether the content has a "-- maestro:destructive" directive line, or a statement losing
+// data outside of line comments.
+func isDestructive(content *string) bool {
+	if strings.Contains(*content, "maestro:destructive") && destructiveDirectiveMatch.MatchString(*content) {
+		return true
+	}
+	return destructiveStatementMatch.MatchString(lineCommentMatch.ReplaceAllString(*content, ""))
+}
+
+// metadataDirectives returns the values of the "-- maestro:<field> <value>" header lines of the content, by
+// field (author, date, ticket or tags). The first line of a field wins.
+func metadataDirectives(content *string) map[string]string {
+	metadata := map[string]string{}
+	for _, groups := range metadataDirectiveMatch.FindAllStringSubmatch(*content, -1) {
+		field := strings.ToLower(groups[1])
+		if _, ok := metadata[field]; !ok {
+			metadata[field] = groups[2]
+		}
+	}
+	return metadata
+}
+
+// splitTags returns the tags of a "-- maestro:tags" header line, separated by commas or spaces.
+func splitTags(value string) []string {
+	tags := strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+	if len(tags) == 0 {
+		return nil
+	}
+	return tags
+}
+
+func buildCopyFromFile(filePath string, table string, driver string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".csv":
+	case ".tsv":
+		reader.Comma = '\t'
+		reader.LazyQuotes = true
+	default:
+		return "", fmt.Errorf("unsupported data file extension %q, expected .csv or .tsv", filepath.Ext(filePath))
+	}
+
+	header, err := reader.Read()
+	if err != nil {
+		if err == io.EOF {
+			return "", fmt.Errorf("missing header")
+		}
+		return "", err
+	}
+
+	builder := strings.Builder{}
+	if driver == "mariadb" {
+		fmt.Fprintf(&builder, "LOAD DATA LOCAL INFILE '%s' INTO TABLE %s CHARACTER SET utf8mb4 (%s);\n",
+			migrations.LOAD_DATA_READER, table, strings.Join(header, ", "))
+	} else {
+		fmt.Fprintf(&builder, "COPY %s (%s) FROM STDIN;\n", table, strings.Join(header, ", "))
+	}
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+
+		for i, field := range record {
+			if i > 0 {
+				builder.WriteByte('\t')
+			}
+
+			if field == "" {
+				builder.WriteString(`\N`)
+				continue
+			}
+			builder.WriteString(copyTextEscaper.Replace(field))
+		}
+		builder.WriteByte('\n')
+	}
+
+	builder.WriteString(`\.`)
+
+	return builder.String(), nil
+}
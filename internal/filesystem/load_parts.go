@@ -0,0 +1,155 @@
+package filesystem
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/maestro-go/maestro/core/enums"
+	"github.com/maestro-go/maestro/internal/conf"
+	"github.com/maestro-go/maestro/internal/migrations"
+)
+
+var migrationPartMatch = regexp.MustCompile(conf.MIGRATION_PART_REGEX)
+
+// migrationPart is a file of a multi-file version, e.g. V012_2_indexes.sql.
+type migrationPart struct {
+	number    uint64
+	migration *migrations.Migration
+}
+
+// combineMigrationParts combines the migrations sharing a version into a single migration, executed at once
+// and recorded as a single history entry. The description of each file must start with its part number
+// (V012_1_tables.sql, V012_2_indexes.sql), whose order is the execution order of up migrations and the
+// reverse one of down migrations.
+//
+// The combined migration has the contents of the parts, one after the other, and their descriptions joined
+// with ", ". The checksum of an up migration is the one of the combined content, it skips validation if one
+// of the parts does, and its author and ticket are the first ones of the parts.
+func combineMigrationParts(migrationsOfType []*migrations.Migration, migrationType enums.MigrationType,
+	extension string) ([]*migrations.Migration, []error) {
+
+	versions := make(map[uint16][]*migrations.Migration)
+	for _, migration := range migrationsOfType {
+		versions[migration.Version] = append(versions[migration.Version], migration)
+	}
+
+	if len(versions) == len(migrationsOfType) {
+		return migrationsOfType, nil // No multi-file version
+	}
+
+	errs := make([]error, 0)
+	combined := make([]*migrations.Migration, 0, len(versions))
+	for version, files := range versions {
+		if len(files) == 1 {
+			combined = append(combined, files[0])
+			continue
+		}
+
+		migration, err := combineParts(files, migrationType, extension)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("version %d: %w", version, err))
+			continue
+		}
+		combined = append(combined, migration)
+	}
+
+	if len(errs) > 0 {
+		sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+		return nil, errs
+	}
+
+	return combined, nil
+}
+
+func combineParts(files []*migrations.Migration, migrationType enums.MigrationType,
+	extension string) (*migrations.Migration, error) {
+
+	// JSON files are documents, which can not be concatenated
+	if extension == "json" {
+		return nil, fmt.Errorf("%d files found, multi-file versions are not supported with %s files",
+			len(files), extension)
+	}
+
+	parts := make([]*migrationPart, 0, len(files))
+	for _, file := range files {
+		matches := migrationPartMatch.FindStringSubmatch(file.Description)
+		if matches == nil {
+			return nil, fmt.Errorf("%d files found, the description of the files of a multi-file version must start "+
+				"with their part number, e.g. 1_tables and 2_indexes, got %s", len(files), file.Description)
+		}
+
+		number, err := strconv.ParseUint(matches[1], 10, 16)
+		if err != nil {
+			return nil, err
+		}
+
+		parts = append(parts, &migrationPart{number: number, migration: file})
+	}
+
+	sort.Slice(parts, func(i, j int) bool {
+		if migrationType == enums.MIGRATION_DOWN {
+			return parts[i].number > parts[j].number
+		}
+		return parts[i].number < parts[j].number
+	})
+
+	combined := &migrations.Migration{
+		Version:  files[0].Version,
+		Type:     migrationType,
+		Location: files[0].Location,
+	}
+
+	descriptions := make([]string, 0, len(parts))
+	content := strings.Builder{}
+	for i, part := range parts {
+		if i > 0 && part.number == parts[i-1].number {
+			return nil, fmt.Errorf("duplicated part %d", part.number)
+		}
+
+		descriptions = append(descriptions, migrationPartMatch.FindStringSubmatch(part.migration.Description)[2])
+
+		// Each part starts on a new line, so a trailing comment does not hide the next part
+		content.WriteString(*part.migration.Content)
+		if !strings.HasSuffix(*part.migration.Content, "\n") {
+			content.WriteString("\n")
+		}
+
+		combined.SkipValidation = combined.SkipValidation || part.migration.SkipValidation
+		combined.Destructive = combined.Destructive || part.migration.Destructive
+		combined.Location = min(combined.Location, part.migration.Location) // The first location of the parts
+		if combined.Author == "" {
+			combined.Author = part.migration.Author
+		}
+		if combined.Ticket == "" {
+			combined.Ticket = part.migration.Ticket
+		}
+		for _, tag := range part.migration.Tags {
+			if !slices.Contains(combined.Tags, tag) {
+				combined.Tags = append(combined.Tags, tag)
+			}
+		}
+	}
+
+	// Down parts are described in the order of the up parts
+	if migrationType == enums.MIGRATION_DOWN {
+		for i, j := 0, len(descriptions)-1; i < j; i, j = i+1, j-1 {
+			descriptions[i], descriptions[j] = descriptions[j], descriptions[i]
+		}
+	}
+
+	combined.Description = strings.Join(descriptions, ", ")
+
+	contentStr := content.String()
+	combined.Content = &contentStr
+
+	if migrationType == enums.MIGRATION_UP {
+		checksum := generateMd5Checksum(combined.Content)
+		combined.Checksum = &checksum
+	}
+
+	return combined, nil
+}
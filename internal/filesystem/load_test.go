@@ -1,12 +1,14 @@
 package filesystem
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 	"testing"
 
 	"github.com/maestro-go/maestro/core/conf"
 	"github.com/maestro-go/maestro/core/enums"
+	"github.com/maestro-go/maestro/internal/migrations"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -76,3 +78,598 @@ func TestLoadObjectsFromFiles(t *testing.T) {
 
 	assert.Equal(t, "SAMPLE CONTENT WITH TEMPLATE TEST TEMPLATE 10 CONTENT", *migrations[enums.MIGRATION_UP][1].Content) // Assert template
 }
+
+func TestLoadHooksOrderingAcrossLocations(t *testing.T) {
+	migrationsDir1 := t.TempDir()
+	migrationsDir2 := t.TempDir()
+
+	config := &conf.MigrationConfig{
+		UseBefore: true,
+		Locations: []string{migrationsDir1, migrationsDir2},
+	}
+
+	err := os.WriteFile(filepath.Join(migrationsDir2, "B001_a.sql"), []byte("DIR2 A"), os.ModePerm)
+	assert.NoError(t, err)
+	err = os.WriteFile(filepath.Join(migrationsDir1, "B001_b.sql"), []byte("DIR1 B"), os.ModePerm)
+	assert.NoError(t, err)
+	err = os.WriteFile(filepath.Join(migrationsDir1, "B001_a.sql"), []byte("DIR1 A"), os.ModePerm)
+	assert.NoError(t, err)
+	err = os.WriteFile(filepath.Join(migrationsDir2, "B000_first.sql"), []byte("DIR2 FIRST"), os.ModePerm)
+	assert.NoError(t, err)
+
+	_, hooks, errs := LoadObjectsFromFiles(config)
+	assert.Len(t, errs, 0)
+	assert.Len(t, hooks[enums.HOOK_BEFORE], 4)
+
+	assert.Equal(t, "DIR2 FIRST", *hooks[enums.HOOK_BEFORE][0].Content)
+	assert.Equal(t, "DIR1 A", *hooks[enums.HOOK_BEFORE][1].Content)
+	assert.Equal(t, "DIR1 B", *hooks[enums.HOOK_BEFORE][2].Content)
+	assert.Equal(t, "DIR2 A", *hooks[enums.HOOK_BEFORE][3].Content)
+
+	config.DisallowDuplicateHooks = true
+
+	_, _, errs = LoadObjectsFromFiles(config)
+	assert.Len(t, errs, 1)
+
+	// The duplicated hooks are reported in the order of their types, the same each run
+	config.UseAfter = true
+	for _, dir := range []string{migrationsDir1, migrationsDir2} {
+		err = os.WriteFile(filepath.Join(dir, "A001_notify.sql"), []byte("NOTIFY"), os.ModePerm)
+		assert.NoError(t, err)
+	}
+
+	for range 10 {
+		_, _, errs = LoadObjectsFromFiles(config)
+		assert.Len(t, errs, 2)
+		assert.ErrorContains(t, errs[0], "duplicated hook B001_a.sql")
+		assert.ErrorContains(t, errs[1], "duplicated hook A001_notify.sql")
+	}
+}
+
+func TestLoadBeforeValidateHooks(t *testing.T) {
+	migrationsDir := t.TempDir()
+
+	config := &conf.MigrationConfig{
+		UseBefore:         true,
+		UseBeforeValidate: true,
+		Locations:         []string{migrationsDir},
+	}
+
+	err := os.WriteFile(filepath.Join(migrationsDir, "BVAL001_extensions.sql"), []byte("CREATE EXTENSION IF NOT EXISTS pgcrypto;"), os.ModePerm)
+	assert.NoError(t, err)
+	err = os.WriteFile(filepath.Join(migrationsDir, "B001_before.sql"), []byte("SAMPLE BEFORE CONTENT"), os.ModePerm)
+	assert.NoError(t, err)
+
+	_, hooks, errs := LoadObjectsFromFiles(config)
+	assert.Len(t, errs, 0)
+	assert.Len(t, hooks[enums.HOOK_BEFORE_VALIDATE], 1)
+	assert.Len(t, hooks[enums.HOOK_BEFORE], 1)
+	assert.Equal(t, "CREATE EXTENSION IF NOT EXISTS pgcrypto;", *hooks[enums.HOOK_BEFORE_VALIDATE][0].Content)
+
+	// Before-validate hooks are also loaded for down migrations
+	config.Down = true
+
+	_, hooks, errs = LoadObjectsFromFiles(config)
+	assert.Len(t, errs, 0)
+	assert.Len(t, hooks[enums.HOOK_BEFORE_VALIDATE], 1)
+	assert.Len(t, hooks[enums.HOOK_BEFORE], 0)
+
+	config.UseBeforeValidate = false
+
+	_, hooks, errs = LoadObjectsFromFiles(config)
+	assert.Len(t, errs, 0)
+	assert.Len(t, hooks[enums.HOOK_BEFORE_VALIDATE], 0)
+}
+
+func TestGetTemplatesUsage(t *testing.T) {
+	migrationsDir1 := t.TempDir()
+	migrationsDir2 := t.TempDir()
+
+	err := os.WriteFile(filepath.Join(migrationsDir1, "V001_test1.sql"), []byte("{{test, 1}} {{other}}"), os.ModePerm)
+	assert.NoError(t, err)
+	err = os.WriteFile(filepath.Join(migrationsDir2, "V002_test2.sql"), []byte("{{test, 2}}"), os.ModePerm)
+	assert.NoError(t, err)
+	err = os.WriteFile(filepath.Join(migrationsDir2, "B001_before.sql"), []byte("{{other}}"), os.ModePerm)
+	assert.NoError(t, err)
+	err = os.WriteFile(filepath.Join(migrationsDir2, "test.template.sql"), []byte("{{other}} $1"), os.ModePerm)
+	assert.NoError(t, err)
+
+	usage, err := GetTemplatesUsage([]string{migrationsDir1, migrationsDir2})
+	assert.NoError(t, err)
+
+	assert.Len(t, usage, 2)
+	assert.ElementsMatch(t, []string{"V001_test1.sql", "V002_test2.sql"}, usage["test"])
+	assert.ElementsMatch(t, []string{"V001_test1.sql", "B001_before.sql"}, usage["other"])
+}
+
+func TestLoadSeedsFromFiles(t *testing.T) {
+	seedsDir := t.TempDir()
+
+	err := os.WriteFile(filepath.Join(seedsDir, "S002_users.dev.sql"), []byte("DEV USERS"), os.ModePerm)
+	assert.NoError(t, err)
+	err = os.WriteFile(filepath.Join(seedsDir, "S001_countries.sql"), []byte("COUNTRIES {{test}}"), os.ModePerm)
+	assert.NoError(t, err)
+	err = os.WriteFile(filepath.Join(seedsDir, "S003_users.prod.sql"), []byte("PROD USERS"), os.ModePerm)
+	assert.NoError(t, err)
+	err = os.WriteFile(filepath.Join(seedsDir, "test.template.sql"), []byte("TEMPLATE"), os.ModePerm)
+	assert.NoError(t, err)
+	err = os.WriteFile(filepath.Join(seedsDir, "V001_test.sql"), []byte("MIGRATION"), os.ModePerm)
+	assert.NoError(t, err)
+
+	seeds, errs := LoadSeedsFromFiles([]string{seedsDir}, "dev", "")
+	assert.Len(t, errs, 0)
+	assert.Len(t, seeds, 2)
+
+	assert.Equal(t, uint16(1), seeds[0].Version)
+	assert.Equal(t, "COUNTRIES TEMPLATE", *seeds[0].Content)
+	assert.NotEmpty(t, seeds[0].Checksum)
+	assert.Equal(t, uint16(2), seeds[1].Version)
+
+	seeds, errs = LoadSeedsFromFiles([]string{seedsDir}, "", "")
+	assert.Len(t, errs, 0)
+	assert.Len(t, seeds, 1)
+}
+
+func TestLoadObjectsFromFilesDataTrack(t *testing.T) {
+	migrationsDir := t.TempDir()
+
+	config := &conf.MigrationConfig{
+		Track:     "data",
+		UseBefore: true,
+		Locations: []string{migrationsDir},
+	}
+
+	err := os.WriteFile(filepath.Join(migrationsDir, "V001_schema.sql"), []byte("SCHEMA"), os.ModePerm)
+	assert.NoError(t, err)
+	err = os.WriteFile(filepath.Join(migrationsDir, "D001__backfill.sql"), []byte("BACKFILL"), os.ModePerm)
+	assert.NoError(t, err)
+	err = os.WriteFile(filepath.Join(migrationsDir, "D002_cleanup.sql"), []byte("CLEANUP"), os.ModePerm)
+	assert.NoError(t, err)
+	err = os.WriteFile(filepath.Join(migrationsDir, "B001_before.sql"), []byte("BEFORE"), os.ModePerm)
+	assert.NoError(t, err)
+
+	migrations, hooks, errs := LoadObjectsFromFiles(config)
+	assert.Len(t, errs, 0)
+	assert.Len(t, migrations[enums.MIGRATION_UP], 2)
+	assert.Len(t, hooks, 0)
+
+	assert.Equal(t, "backfill", migrations[enums.MIGRATION_UP][0].Description)
+	assert.Equal(t, "CLEANUP", *migrations[enums.MIGRATION_UP][1].Content)
+
+	config.Track = "invalid"
+	_, _, errs = LoadObjectsFromFiles(config)
+	assert.Len(t, errs, 1)
+}
+
+func TestLoadObjectsFromFilesLoadDirective(t *testing.T) {
+	migrationsDir := t.TempDir()
+	dataDir := filepath.Join(migrationsDir, "data")
+	assert.NoError(t, os.Mkdir(dataDir, os.ModePerm))
+
+	config := &conf.MigrationConfig{
+		Locations: []string{migrationsDir},
+	}
+
+	err := os.WriteFile(filepath.Join(dataDir, "countries.csv"), []byte("code,name\nBR,Brazil\nPT,\"Port\tugal\"\nXX,\n"), os.ModePerm)
+	assert.NoError(t, err)
+	err = os.WriteFile(filepath.Join(migrationsDir, "V001_countries.sql"),
+		[]byte("CREATE TABLE countries (code CHAR(2), name TEXT);\n-- maestro:load data/countries.csv INTO countries\n"), os.ModePerm)
+	assert.NoError(t, err)
+
+	migrations, _, errs := LoadObjectsFromFiles(config)
+	assert.Len(t, errs, 0)
+	assert.Len(t, migrations[enums.MIGRATION_UP], 1)
+
+	expected := "CREATE TABLE countries (code CHAR(2), name TEXT);\n" +
+		"COPY countries (code, name) FROM STDIN;\n" +
+		"BR\tBrazil\n" +
+		"PT\tPort\\tugal\n" +
+		"XX\t\\N\n" +
+		"\\.\n"
+	assert.Equal(t, expected, *migrations[enums.MIGRATION_UP][0].Content)
+
+	checksum := *migrations[enums.MIGRATION_UP][0].Checksum
+
+	// Changing the data file changes the checksum
+	err = os.WriteFile(filepath.Join(dataDir, "countries.csv"), []byte("code,name\nBR,Brasil\n"), os.ModePerm)
+	assert.NoError(t, err)
+
+	migrations, _, errs = LoadObjectsFromFiles(config)
+	assert.Len(t, errs, 0)
+	assert.NotEqual(t, checksum, *migrations[enums.MIGRATION_UP][0].Checksum)
+
+	// MariaDB loads the same rows with LOAD DATA LOCAL INFILE
+	config.Driver = "mariadb"
+	migrations, _, errs = LoadObjectsFromFiles(config)
+	assert.Len(t, errs, 0)
+	assert.Equal(t, "CREATE TABLE countries (code CHAR(2), name TEXT);\n"+
+		"LOAD DATA LOCAL INFILE 'Reader::maestro' INTO TABLE countries CHARACTER SET utf8mb4 (code, name);\n"+
+		"BR\tBrasil\n"+
+		"\\.\n", *migrations[enums.MIGRATION_UP][0].Content)
+
+	// Drivers not executing COPY ... FROM STDIN nor LOAD DATA reject the directive
+	config.Driver = "sqlite"
+	_, _, errs = LoadObjectsFromFiles(config)
+	assert.Len(t, errs, 1)
+	assert.ErrorContains(t, errs[0], "V001_countries.sql: maestro:load directives are not supported by the sqlite driver")
+
+	config.Driver = "greenplum"
+	_, _, errs = LoadObjectsFromFiles(config)
+	assert.Len(t, errs, 0)
+
+	// Missing data file
+	err = os.Remove(filepath.Join(dataDir, "countries.csv"))
+	assert.NoError(t, err)
+
+	_, _, errs = LoadObjectsFromFiles(config)
+	assert.Len(t, errs, 1)
+}
+
+func TestLoadHookNoTransactionDirective(t *testing.T) {
+	migrationsDir := t.TempDir()
+
+	config := &conf.MigrationConfig{
+		UseAfter:  true,
+		Locations: []string{migrationsDir},
+	}
+
+	err := os.WriteFile(filepath.Join(migrationsDir, "A001_notify.sql"), []byte("-- maestro:no-transaction\nNOTIFY migrated;"), os.ModePerm)
+	assert.NoError(t, err)
+	err = os.WriteFile(filepath.Join(migrationsDir, "A002_analyze.sql"), []byte("ANALYZE; -- maestro:no-transaction"), os.ModePerm)
+	assert.NoError(t, err)
+
+	_, hooks, errs := LoadObjectsFromFiles(config)
+	assert.Len(t, errs, 0)
+	assert.Len(t, hooks[enums.HOOK_AFTER], 2)
+
+	assert.True(t, hooks[enums.HOOK_AFTER][0].OutsideTransaction)
+	assert.False(t, hooks[enums.HOOK_AFTER][1].OutsideTransaction) // The directive must be on its own line
+}
+
+func TestLoadMigrationSkipValidationDirective(t *testing.T) {
+	migrationsDir := t.TempDir()
+
+	config := &conf.MigrationConfig{
+		Locations: []string{migrationsDir},
+	}
+
+	err := os.WriteFile(filepath.Join(migrationsDir, "V001_test.sql"), []byte("-- maestro:skip-validation\nSELECT 1;"), os.ModePerm)
+	assert.NoError(t, err)
+	err = os.WriteFile(filepath.Join(migrationsDir, "V002_test.sql"), []byte("SELECT 2;"), os.ModePerm)
+	assert.NoError(t, err)
+
+	migrations, _, errs := LoadObjectsFromFiles(config)
+	assert.Len(t, errs, 0)
+	assert.True(t, migrations[enums.MIGRATION_UP][0].SkipValidation)
+	assert.False(t, migrations[enums.MIGRATION_UP][1].SkipValidation)
+}
+
+func TestLoadMigrationDestructive(t *testing.T) {
+	migrationsDir := t.TempDir()
+
+	config := &conf.MigrationConfig{
+		Locations: []string{migrationsDir},
+		Down:      true,
+	}
+
+	files := map[string]string{
+		"V001_directive.sql":   "-- maestro:destructive\nUPDATE users SET email = NULL;",
+		"V002_drop_column.sql": "ALTER TABLE users\n  DROP COLUMN email;",
+		"V003_truncate.sql":    "truncate logs;",
+		"V004_index.sql":       "DROP INDEX users_email; -- instead of DROP TABLE users",
+		"V004_index.down.sql":  "DROP TABLE users_archive;",
+	}
+	for name, content := range files {
+		err := os.WriteFile(filepath.Join(migrationsDir, name), []byte(content), os.ModePerm)
+		assert.NoError(t, err)
+	}
+
+	migrations, _, errs := LoadObjectsFromFiles(config)
+	assert.Len(t, errs, 0)
+
+	destructive := make([]bool, 0)
+	for _, migration := range migrations[enums.MIGRATION_UP] {
+		destructive = append(destructive, migration.Destructive)
+	}
+	assert.Equal(t, []bool{true, true, true, false}, destructive)
+
+	if assert.Len(t, migrations[enums.MIGRATION_DOWN], 1) {
+		assert.True(t, migrations[enums.MIGRATION_DOWN][0].Destructive)
+	}
+}
+
+func TestLoadMigrationMetadata(t *testing.T) {
+	migrationsDir := t.TempDir()
+
+	config := &conf.MigrationConfig{
+		Locations: []string{migrationsDir},
+	}
+
+	header := "-- maestro:author Jane Doe <jane@example.com>\n-- maestro:date 2026-10-16\n-- MAESTRO:TICKET OPS-123  \n" +
+		"-- maestro:tags ledger, pii\n\n"
+	err := os.WriteFile(filepath.Join(migrationsDir, "V001_test.sql"), []byte(header+"SELECT 1;"), os.ModePerm)
+	assert.NoError(t, err)
+	err = os.WriteFile(filepath.Join(migrationsDir, "V002_test.sql"), []byte("SELECT 2; -- maestro:author nobody"), os.ModePerm)
+	assert.NoError(t, err)
+
+	migrations, _, errs := LoadObjectsFromFiles(config)
+	assert.Len(t, errs, 0)
+	assert.Equal(t, "Jane Doe <jane@example.com>", migrations[enums.MIGRATION_UP][0].Author)
+	assert.Equal(t, "OPS-123", migrations[enums.MIGRATION_UP][0].Ticket)
+	assert.Equal(t, []string{"ledger", "pii"}, migrations[enums.MIGRATION_UP][0].Tags)
+	assert.Empty(t, migrations[enums.MIGRATION_UP][1].Author) // The header field must be on its own line
+	assert.Nil(t, migrations[enums.MIGRATION_UP][1].Tags)
+}
+
+func TestLoadMultiFileVersions(t *testing.T) {
+	migrationsDir := t.TempDir()
+	otherDir := t.TempDir()
+
+	config := &conf.MigrationConfig{
+		Locations: []string{migrationsDir, otherDir},
+		Down:      true,
+	}
+
+	files := map[string]string{
+		filepath.Join(migrationsDir, "V001_users.sql"):              "CREATE TABLE users (id INT);",
+		filepath.Join(migrationsDir, "V002_1_tables.sql"):           "-- maestro:ticket OPS-1\nCREATE TABLE orders (id INT); -- orders",
+		filepath.Join(otherDir, "V002_2_indexes.sql"):               "CREATE INDEX orders_id ON orders (id);\n",
+		filepath.Join(migrationsDir, "V002_10_grants.sql"):          "GRANT SELECT ON orders TO app;",
+		filepath.Join(migrationsDir, "V002_1_tables.down.sql"):      "DROP TABLE orders;",
+		filepath.Join(migrationsDir, "V002_2_indexes.down.sql"):     "DROP INDEX orders_id;",
+		filepath.Join(migrationsDir, "V003_1_single_part_name.sql"): "SELECT 1;",
+	}
+	for path, content := range files {
+		err := os.WriteFile(path, []byte(content), os.ModePerm)
+		assert.NoError(t, err)
+	}
+
+	loaded, _, errs := LoadObjectsFromFiles(config)
+	assert.Empty(t, errs)
+
+	up := loaded[enums.MIGRATION_UP]
+	assert.Len(t, up, 3)
+	assert.Empty(t, migrations.ValidateMigrations(up))
+
+	// The parts are executed in the order of their numbers, as a single migration
+	assert.Equal(t, "tables, indexes, grants", up[1].Description)
+	assert.Equal(t, "-- maestro:ticket OPS-1\nCREATE TABLE orders (id INT); -- orders\n"+
+		"CREATE INDEX orders_id ON orders (id);\nGRANT SELECT ON orders TO app;\n", *up[1].Content)
+	assert.Equal(t, generateMd5Checksum(up[1].Content), *up[1].Checksum)
+	assert.Equal(t, "OPS-1", up[1].Ticket)
+
+	// A single file keeps its description
+	assert.Equal(t, "1_single_part_name", up[2].Description)
+
+	// Down parts are executed in reverse order
+	down := loaded[enums.MIGRATION_DOWN]
+	assert.Len(t, down, 1)
+	assert.Equal(t, "tables, indexes", down[0].Description)
+	assert.Equal(t, "DROP INDEX orders_id;\nDROP TABLE orders;\n", *down[0].Content)
+
+	// The files of a multi-file version must be numbered
+	err := os.WriteFile(filepath.Join(otherDir, "V001_roles.sql"), []byte("CREATE TABLE roles (id INT);"), os.ModePerm)
+	assert.NoError(t, err)
+
+	_, _, errs = LoadObjectsFromFiles(config)
+	assert.Len(t, errs, 1)
+	assert.ErrorContains(t, errs[0], "version 1: 2 files found")
+}
+
+func TestLoadMultiFileVersionsDuplicatedPart(t *testing.T) {
+	migrationsDir := t.TempDir()
+	otherDir := t.TempDir()
+
+	config := &conf.MigrationConfig{Locations: []string{migrationsDir, otherDir}}
+
+	err := os.WriteFile(filepath.Join(migrationsDir, "V001_1_tables.sql"), []byte("SELECT 1;"), os.ModePerm)
+	assert.NoError(t, err)
+	err = os.WriteFile(filepath.Join(otherDir, "V001_1_tables.sql"), []byte("SELECT 1;"), os.ModePerm)
+	assert.NoError(t, err)
+
+	_, _, errs := LoadObjectsFromFiles(config)
+	assert.Len(t, errs, 1)
+	assert.ErrorContains(t, errs[0], "duplicated part 1")
+
+	// JSON documents can not be combined
+	config = &conf.MigrationConfig{Locations: []string{migrationsDir}, Extension: "json"}
+	err = os.WriteFile(filepath.Join(migrationsDir, "V001_1_index.json"), []byte("{}"), os.ModePerm)
+	assert.NoError(t, err)
+	err = os.WriteFile(filepath.Join(migrationsDir, "V001_2_alias.json"), []byte("{}"), os.ModePerm)
+	assert.NoError(t, err)
+
+	_, _, errs = LoadObjectsFromFiles(config)
+	assert.Len(t, errs, 1)
+	assert.ErrorContains(t, errs[0], "not supported with json files")
+}
+
+func TestLoadVersionRanges(t *testing.T) {
+	sharedDir := t.TempDir()
+	authDir := t.TempDir()
+
+	config := &conf.MigrationConfig{
+		Locations:     []string{sharedDir, authDir},
+		VersionRanges: map[string]string{authDir: "1000-1999"},
+	}
+
+	files := map[string]string{
+		filepath.Join(sharedDir, "V001_users.sql"):      "CREATE TABLE users (id INT);",
+		filepath.Join(authDir, "V1000_sessions.sql"):    "CREATE TABLE sessions (id INT);",
+		filepath.Join(authDir, "V1001_tokens.sql"):      "CREATE TABLE tokens (id INT);",
+		filepath.Join(authDir, "V1001_tokens.down.sql"): "DROP TABLE tokens;",
+	}
+	for path, content := range files {
+		err := os.WriteFile(path, []byte(content), os.ModePerm)
+		assert.NoError(t, err)
+	}
+
+	loaded, _, errs := LoadObjectsFromFiles(config)
+	assert.Empty(t, errs)
+	assert.Len(t, loaded[enums.MIGRATION_UP], 3)
+
+	// A shared location can not use the versions of a range, even with a down migration not loaded
+	err := os.WriteFile(filepath.Join(sharedDir, "V1002_roles.down.sql"), []byte("DROP TABLE roles;"), os.ModePerm)
+	assert.NoError(t, err)
+
+	_, _, errs = LoadObjectsFromFiles(config)
+	assert.Len(t, errs, 1)
+	assert.ErrorContains(t, errs[0], "V1002_roles.down.sql: version 1002 is in the range 1000-1999 of location")
+
+	err = os.Remove(filepath.Join(sharedDir, "V1002_roles.down.sql"))
+	assert.NoError(t, err)
+
+	// A location with a range can not use other versions
+	err = os.WriteFile(filepath.Join(authDir, "V002_roles.sql"), []byte("CREATE TABLE roles (id INT);"), os.ModePerm)
+	assert.NoError(t, err)
+
+	_, _, errs = LoadObjectsFromFiles(config)
+	assert.Len(t, errs, 1)
+	assert.ErrorContains(t, errs[0], "V002_roles.sql: version 2 is out of the range 1000-1999 of location")
+
+	// Ranges must belong to a location
+	config.VersionRanges = map[string]string{t.TempDir(): "1000-1999"}
+	_, _, errs = LoadObjectsFromFiles(config)
+	assert.Len(t, errs, 1)
+	assert.ErrorContains(t, errs[0], "not a migrations location")
+}
+
+func TestLoadManyFiles(t *testing.T) {
+	migrationsDir := t.TempDir()
+	for version := 1; version <= load_workers*10; version++ {
+		name := fmt.Sprintf("V%03d_test.sql", version)
+		err := os.WriteFile(filepath.Join(migrationsDir, name), []byte("SELECT 1;"), os.ModePerm)
+		assert.NoError(t, err)
+	}
+
+	config := &conf.MigrationConfig{Track: "schema", Locations: []string{migrationsDir}}
+
+	migrations, _, errs := LoadObjectsFromFiles(config)
+	assert.Empty(t, errs)
+	assert.Len(t, migrations[enums.MIGRATION_UP], load_workers*10)
+	assert.Equal(t, uint16(1), migrations[enums.MIGRATION_UP][0].Version)
+
+	// A file failing to load fails the whole load with its error
+	err := os.WriteFile(filepath.Join(migrationsDir, "V99999_out_of_range.sql"), []byte("SELECT 1;"), os.ModePerm)
+	assert.NoError(t, err)
+
+	_, _, errs = LoadObjectsFromFiles(config)
+	assert.Len(t, errs, 1)
+	assert.ErrorContains(t, errs[0], "99999")
+
+	// Every file failing to load reports its error, in the order of the files
+	err = os.WriteFile(filepath.Join(migrationsDir, "V1.2_malformed.sql"), []byte("SELECT 1;"), os.ModePerm)
+	assert.NoError(t, err)
+
+	_, _, errs = LoadObjectsFromFiles(config)
+	assert.Len(t, errs, 2)
+	assert.ErrorContains(t, errs[0], "V1.2_malformed.sql")
+	assert.ErrorContains(t, errs[1], "V99999_out_of_range.sql")
+}
+
+func TestLoadMalformedFileNames(t *testing.T) {
+	migrationsDir := t.TempDir()
+	err := os.WriteFile(filepath.Join(migrationsDir, "V001_test.sql"), []byte("SELECT 1;"), os.ModePerm)
+	assert.NoError(t, err)
+
+	config := &conf.MigrationConfig{Track: "schema", Locations: []string{migrationsDir}, UseBefore: true}
+
+	// Malformed names of maestro files, and names looking like them, fail the load instead of being ignored
+	for name, reason := range map[string]string{
+		"V1.2_test.sql":       "1:3: expected '_' after the version, found '.'",
+		"B01test.sql":         "1:4: expected '_' after the order, found 't'",
+		"V002_create.ddl.sql": "1:12: unexpected '.' in the description",
+		"V002_users.SQL": `1:12: looks like a migration but does not match its pattern because the extension "SQL" ` +
+			`is not "sql"`,
+		"be01_audit.sql": `1:1: looks like a before each hook but does not match its pattern because the prefix "be" ` +
+			`is not "BE"`,
+	} {
+		filePath := filepath.Join(migrationsDir, name)
+		err = os.WriteFile(filePath, []byte("SELECT 1;"), os.ModePerm)
+		assert.NoError(t, err)
+
+		_, _, errs := LoadObjectsFromFiles(config)
+		assert.Len(t, errs, 1)
+		assert.EqualError(t, errs[0], filePath+": "+reason)
+
+		assert.NoError(t, os.Remove(filePath))
+	}
+
+	// Other files are still ignored
+	err = os.WriteFile(filepath.Join(migrationsDir, "README.md"), []byte("# Migrations"), os.ModePerm)
+	assert.NoError(t, err)
+
+	migrations, _, errs := LoadObjectsFromFiles(config)
+	assert.Empty(t, errs)
+	assert.Len(t, migrations[enums.MIGRATION_UP], 1)
+}
+
+func TestLoadWithManifest(t *testing.T) {
+	migrationsDir := t.TempDir()
+	manifestPath := filepath.Join(t.TempDir(), "manifest.json")
+	migrationPath := filepath.Join(migrationsDir, "V001_test.sql")
+
+	err := os.WriteFile(migrationPath, []byte("SELECT 1;"), os.ModePerm)
+	assert.NoError(t, err)
+
+	config := &conf.MigrationConfig{Track: "schema", Locations: []string{migrationsDir}, Manifest: manifestPath}
+	templates := migrations.WithBuiltinTemplates(nil, config.Driver)
+
+	migrations, _, errs := LoadObjectsFromFiles(config)
+	assert.Empty(t, errs)
+	assert.Equal(t, "SELECT 1;", *migrations[enums.MIGRATION_UP][0].Content)
+	assert.FileExists(t, manifestPath)
+
+	// Unchanged files are taken from the manifest
+	cache := loadManifest(manifestPath, templates)
+	assert.Contains(t, cache.Files, migrationPath)
+	cache.Files[migrationPath].Content = "SELECT 'cached';"
+	cache.changed = true
+	assert.NoError(t, cache.save())
+
+	migrations, _, errs = LoadObjectsFromFiles(config)
+	assert.Empty(t, errs)
+	assert.Equal(t, "SELECT 'cached';", *migrations[enums.MIGRATION_UP][0].Content)
+
+	// Changed files are read again
+	err = os.WriteFile(migrationPath, []byte("SELECT 2, 3;"), os.ModePerm)
+	assert.NoError(t, err)
+
+	migrations, _, errs = LoadObjectsFromFiles(config)
+	assert.Empty(t, errs)
+	assert.Equal(t, "SELECT 2, 3;", *migrations[enums.MIGRATION_UP][0].Content)
+	assert.Equal(t, generateMd5Checksum(migrations[enums.MIGRATION_UP][0].Content), *migrations[enums.MIGRATION_UP][0].Checksum)
+}
+
+func TestLoadFile(t *testing.T) {
+	migrationsDir := t.TempDir()
+	otherDir := t.TempDir()
+
+	err := os.WriteFile(filepath.Join(migrationsDir, "test.template.sql"), []byte("TEST TEMPLATE $1 CONTENT"), os.ModePerm)
+	assert.NoError(t, err)
+	err = os.WriteFile(filepath.Join(otherDir, "V003_render.sql"), []byte("SELECT {{ test, 10 }};"), os.ModePerm)
+	assert.NoError(t, err)
+	err = os.WriteFile(filepath.Join(otherDir, "AV01_003_audit.sql"), []byte("SELECT ${maestro.version};"), os.ModePerm)
+	assert.NoError(t, err)
+	err = os.WriteFile(filepath.Join(otherDir, "notes.sql"), []byte("SELECT 1;"), os.ModePerm)
+	assert.NoError(t, err)
+
+	config := &conf.MigrationConfig{Track: "schema", Locations: []string{migrationsDir}}
+
+	// Files outside of the locations use the templates of the locations
+	migration, hook, err := LoadFile(config, filepath.Join(otherDir, "V003_render.sql"))
+	assert.NoError(t, err)
+	assert.Nil(t, hook)
+	assert.Equal(t, uint16(3), migration.Version)
+	assert.Equal(t, "SELECT TEST TEMPLATE 10 CONTENT;", *migration.Content)
+	assert.NotNil(t, migration.Checksum)
+
+	migration, hook, err = LoadFile(config, filepath.Join(otherDir, "AV01_003_audit.sql"))
+	assert.NoError(t, err)
+	assert.Nil(t, migration)
+	assert.Equal(t, enums.HOOK_AFTER_VERSION, hook.Type)
+	assert.Equal(t, uint16(3), hook.Version)
+	assert.Equal(t, "SELECT ${maestro.version};", *hook.Content)
+
+	_, _, err = LoadFile(config, filepath.Join(otherDir, "notes.sql"))
+	assert.ErrorContains(t, err, "not a migration nor a hook file")
+}
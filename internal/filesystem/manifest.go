@@ -0,0 +1,152 @@
+package filesystem
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/maestro-go/maestro/internal/migrations"
+)
+
+// manifest caches the content of the migration and hook files, once templates are replaced, along with the
+// size and modification time of the files, so unchanged files are not read and processed again by the next
+// commands. The whole manifest is discarded when the templates change.
+type manifest struct {
+	Templates string                    `json:"templates"` // Checksum of the templates the contents were rendered with
+	Files     map[string]*manifestEntry `json:"files"`     // Entries by file path
+
+	path    string
+	mu      sync.Mutex
+	changed bool
+}
+
+type manifestEntry struct {
+	Size     int64  `json:"size"`
+	ModTime  int64  `json:"mod_time"` // Modification time, in nanoseconds since the Unix epoch
+	Checksum string `json:"checksum"`
+	Content  string `json:"content"`
+}
+
+// loadManifest reads the manifest of the given path, or returns an empty manifest if it does not exist, is
+// invalid or was written with other templates. Returns nil if path is empty, disabling the cache.
+func loadManifest(path string, templates []*migrations.Template) *manifest {
+	if path == "" {
+		return nil
+	}
+
+	templatesChecksum := checksumTemplates(templates)
+
+	m := new(manifest)
+	content, err := os.ReadFile(path)
+	if err != nil || json.Unmarshal(content, m) != nil || m.Templates != templatesChecksum {
+		m = new(manifest)
+	}
+
+	m.path = path
+	m.Templates = templatesChecksum
+	if m.Files == nil {
+		m.Files = make(map[string]*manifestEntry)
+	}
+
+	return m
+}
+
+// content returns the content and checksum of the file from the manifest if the file did not change, or
+// loads the file and stores it in the manifest otherwise. Files whose content depends on other files (e.g.
+// with load directives) are never stored. A nil manifest always loads the file.
+func (m *manifest) content(filePath string, entry fs.DirEntry,
+	load func() (content *string, cacheable bool, err error)) (*string, string, error) {
+
+	if m == nil {
+		content, _, err := load()
+		if err != nil {
+			return nil, "", err
+		}
+		return content, generateMd5Checksum(content), nil
+	}
+
+	info, err := entry.Info()
+	if err != nil {
+		return nil, "", err
+	}
+
+	m.mu.Lock()
+	cached, ok := m.Files[filePath]
+	m.mu.Unlock()
+
+	if ok && cached.Size == info.Size() && cached.ModTime == info.ModTime().UnixNano() {
+		content := cached.Content
+		return &content, cached.Checksum, nil
+	}
+
+	content, cacheable, err := load()
+	if err != nil {
+		return nil, "", err
+	}
+
+	checksum := generateMd5Checksum(content)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if cacheable {
+		m.Files[filePath] = &manifestEntry{
+			Size:     info.Size(),
+			ModTime:  info.ModTime().UnixNano(),
+			Checksum: checksum,
+			Content:  *content,
+		}
+		m.changed = true
+	} else if ok {
+		delete(m.Files, filePath)
+		m.changed = true
+	}
+
+	return content, checksum, nil
+}
+
+// save writes the manifest if any entry changed.
+func (m *manifest) save() error {
+	if m == nil || !m.changed {
+		return nil
+	}
+
+	content, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	err = os.WriteFile(m.path, content, 0644)
+	if err != nil {
+		return errors.Join(errors.New("error writing the manifest"), err)
+	}
+
+	m.changed = false
+	return nil
+}
+
+// checksumTemplates returns a checksum of the names and contents of the templates.
+func checksumTemplates(templates []*migrations.Template) string {
+	sorted := make([]*migrations.Template, len(templates))
+	copy(sorted, templates)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Name < sorted[j].Name
+	})
+
+	hash := md5.New()
+	for _, template := range sorted {
+		hash.Write([]byte(template.Name))
+		hash.Write([]byte{0})
+		if template.Content != nil {
+			hash.Write([]byte(*template.Content))
+		}
+		hash.Write([]byte{0})
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
@@ -1,42 +1,58 @@
 package filesystem
 
 import (
+	"fmt"
 	"os"
-	"regexp"
-	"strconv"
+	"path/filepath"
 
-	"github.com/maestro-go/maestro/internal/conf"
+	"github.com/maestro-go/maestro/core/parser"
 )
 
-func GetLatestVersionFromFiles(migrationsDirs []string) (uint16, error) {
-	upRegex := regexp.MustCompile(conf.MIGRATION_REGEX)
-
-	latest := uint16(0)
+// GetVersionsFromFiles returns the versions of the up migration files of the directories, unordered.
+func GetVersionsFromFiles(migrationsDirs []string, extension string) ([]uint16, error) {
+	versions := make([]uint16, 0)
 	for _, migrationDir := range migrationsDirs {
 		entries, err := os.ReadDir(migrationDir)
 		if err != nil {
-			return 0, err
+			return nil, err
 		}
 
 		for _, entry := range entries {
-			matches := upRegex.FindStringSubmatch(entry.Name())
+			name, err := parseFileName(entry.Name(), extension)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", filepath.Join(migrationDir, entry.Name()), err)
+			}
 
-			if matches != nil {
-				version := uint16(0)
+			if name != nil && name.Kind == parser.KIND_MIGRATION && !name.Down {
+				versions = append(versions, name.Version)
+			}
+		}
+	}
 
-				v, err := strconv.ParseUint(matches[1], 10, 16)
-				if err != nil {
-					return 0, err
-				}
+	return versions, nil
+}
 
-				version = uint16(v)
+// GetUpMigrationFiles returns the paths of the up migration files of the version in the directories, several if
+// the version is made of several parts.
+func GetUpMigrationFiles(migrationsDirs []string, extension string, version uint16) ([]string, error) {
+	files := make([]string, 0)
+	for _, migrationDir := range migrationsDirs {
+		entries, err := os.ReadDir(migrationDir)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, entry := range entries {
+			name, err := parseFileName(entry.Name(), extension)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", filepath.Join(migrationDir, entry.Name()), err)
+			}
 
-				if version > latest {
-					latest = version
-				}
+			if name != nil && name.Kind == parser.KIND_MIGRATION && !name.Down && name.Version == version {
+				files = append(files, filepath.Join(migrationDir, entry.Name()))
 			}
 		}
 	}
 
-	return latest, nil
+	return files, nil
 }
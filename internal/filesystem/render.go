@@ -0,0 +1,65 @@
+package filesystem
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/maestro-go/maestro/core/conf"
+	"github.com/maestro-go/maestro/core/enums"
+	"github.com/maestro-go/maestro/internal/migrations"
+)
+
+// LoadFile loads a single migration or hook file, with the templates of the configured locations replaced and
+// the load directives expanded, like when it is executed. The file does not need to be in one of the locations.
+//
+// Returns the migration if the file name matches a migration of the configured track, or the hook otherwise,
+// and an error if it matches neither.
+func LoadFile(config *conf.MigrationConfig, filePath string) (*migrations.Migration, *migrations.Hook, error) {
+	track, ok := enums.MapStringToMigrationTrack[config.Track]
+	if !ok {
+		return nil, nil, fmt.Errorf("invalid migration track: %s", config.Track)
+	}
+
+	templates, errs := LoadTemplates(config.Locations)
+	if len(errs) > 0 {
+		return nil, nil, errs[0]
+	}
+
+	templates = migrations.WithBuiltinTemplates(templates, config.Driver)
+
+	extension := config.FileExtension()
+	fileName := filepath.Base(filePath)
+
+	migration, isMigration, err := checkAndLoadMigrationInfo(fileName, track, extension)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", fileName, err)
+	}
+
+	hook, isHook, err := checkAndLoadHookInfo(fileName, extension)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", fileName, err)
+	}
+
+	if !isMigration && !isHook {
+		return nil, nil, fmt.Errorf("%s is not a migration nor a hook file", fileName)
+	}
+
+	content, _, err := loadFileContent(filePath, templates, extension, config.Driver)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if isMigration {
+		migration.Content = content
+		if migration.Type == enums.MIGRATION_UP {
+			checksum := generateMd5Checksum(content)
+			migration.Checksum = &checksum
+		}
+		return migration, nil, nil
+	}
+
+	hook.Content = content
+	hook.OutsideTransaction = hasNoTransactionDirective(content)
+	hook.FileName = fileName
+	return nil, hook, nil
+}
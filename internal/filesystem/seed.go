@@ -0,0 +1,76 @@
+package filesystem
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/maestro-go/maestro/core/enums"
+	"github.com/maestro-go/maestro/core/parser"
+	"github.com/maestro-go/maestro/internal/migrations"
+)
+
+// LoadSeedsFromFiles reads the seed files from the specified directories.
+//
+// Seed files follow the "SXXX_description.sql" pattern and may be restricted to an environment
+// with the "SXXX_description.env.sql" pattern. Seeds without environment are always loaded, and
+// seeds with environment are only loaded when it matches the given environment.
+// Seeds are returned as up migrations sorted by version, with templates replaced and checksums generated.
+func LoadSeedsFromFiles(seedsDirs []string, env string, driver string) ([]*migrations.Migration, []error) {
+	templates, errs := LoadTemplates(seedsDirs)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	templates = migrations.WithBuiltinTemplates(templates, driver)
+
+	seedsO := make(map[enums.MigrationType][]*migrations.Migration)
+	errs = make([]error, 0)
+
+	for _, seedDir := range seedsDirs {
+		entries, err := os.ReadDir(seedDir)
+		if err != nil {
+			return nil, []error{err}
+		}
+
+		for _, entry := range entries {
+			name, err := parseFileName(entry.Name(), "sql")
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", filepath.Join(seedDir, entry.Name()), err))
+				continue
+			}
+
+			if name == nil || name.Kind != parser.KIND_SEED {
+				continue
+			}
+
+			if name.Environment != "" && name.Environment != env {
+				continue
+			}
+
+			content, _, err := loadFileContent(filepath.Join(seedDir, entry.Name()), templates, "sql", driver)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+
+			checksum := generateMd5Checksum(content)
+
+			seedsO[enums.MIGRATION_UP] = append(seedsO[enums.MIGRATION_UP], &migrations.Migration{
+				Version:     name.Version,
+				Description: name.Description,
+				Type:        enums.MIGRATION_UP,
+				Checksum:    &checksum,
+				Content:     content,
+			})
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	sortMigrations(&seedsO)
+
+	return seedsO[enums.MIGRATION_UP], nil
+}
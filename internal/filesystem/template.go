@@ -0,0 +1,54 @@
+package filesystem
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/maestro-go/maestro/core/parser"
+	"github.com/maestro-go/maestro/internal/migrations"
+)
+
+// GetTemplatesUsage scans the migration and hook files of the given directories and returns, for each
+// referenced template name, the names of the files referencing it.
+// Only direct references are reported, templates used by other templates are not followed.
+func GetTemplatesUsage(migrationsDirs []string) (map[string][]string, error) {
+	usage := make(map[string][]string)
+
+	for _, migrationDir := range migrationsDirs {
+		entries, err := os.ReadDir(migrationDir)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, entry := range entries {
+			filePath := filepath.Join(migrationDir, entry.Name())
+
+			name, err := parser.ParseFileName(entry.Name(), "sql")
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", filePath, err)
+			}
+
+			// Migrations of both tracks and hooks
+			if name == nil || name.Kind == parser.KIND_SEED || name.Kind == parser.KIND_TEMPLATE {
+				continue
+			}
+
+			content, err := os.ReadFile(filePath)
+			if err != nil {
+				return nil, err
+			}
+
+			names, err := migrations.FindTemplateReferences(string(content))
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", filePath, err)
+			}
+
+			for _, name := range names {
+				usage[name] = append(usage[name], entry.Name())
+			}
+		}
+	}
+
+	return usage, nil
+}
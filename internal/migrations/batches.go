@@ -0,0 +1,95 @@
+package migrations
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// batchSeparatorMatch matches the lines separating the batches of a T-SQL script, "GO" optionally followed
+// by the number of executions of the batch and a comment.
+var batchSeparatorMatch = regexp.MustCompile(`(?i)^\s*GO(?:\s+(\d+))?\s*(?:--.*)?$`)
+
+// SplitBatches splits a T-SQL script (e.g. SQL Server) into its batches, separated by GO lines as with
+// sqlcmd. GO is a client command: it only separates batches on its own line, outside of string literals,
+// quoted identifiers and block comments. A batch followed by "GO n" is returned n times. The returned
+// batches are trimmed, and empty batches are dropped.
+func SplitBatches(script string) []string {
+	batches := make([]string, 0)
+
+	builder := strings.Builder{}
+	state := batchState{}
+
+	for _, line := range strings.SplitAfter(script, "\n") {
+		if state.inCode() {
+			if matches := batchSeparatorMatch.FindStringSubmatch(strings.TrimRight(line, "\r\n")); matches != nil {
+				count := 1
+				if matches[1] != "" {
+					count, _ = strconv.Atoi(matches[1])
+				}
+
+				batch := strings.TrimSpace(builder.String())
+				for i := 0; i < count && batch != ""; i++ {
+					batches = append(batches, batch)
+				}
+				builder.Reset()
+				continue
+			}
+		}
+
+		builder.WriteString(line)
+		state.scan(line)
+	}
+
+	if batch := strings.TrimSpace(builder.String()); batch != "" {
+		batches = append(batches, batch)
+	}
+
+	return batches
+}
+
+// batchState is the lexical state of a T-SQL script at the end of the scanned lines.
+type batchState struct {
+	closingQuote byte // Closing character of the open literal or quoted identifier, 0 if none
+	commentDepth int  // Depth of the open block comments, which nest in T-SQL
+}
+
+func (s *batchState) inCode() bool {
+	return s.closingQuote == 0 && s.commentDepth == 0
+}
+
+func (s *batchState) scan(line string) {
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+
+		switch {
+		case s.commentDepth > 0:
+			if strings.HasPrefix(line[i:], "/*") {
+				s.commentDepth++
+				i++
+			} else if strings.HasPrefix(line[i:], "*/") {
+				s.commentDepth--
+				i++
+			}
+		case s.closingQuote != 0:
+			if c != s.closingQuote {
+				continue
+			}
+			// Closing characters are escaped by doubling them
+			if i+1 < len(line) && line[i+1] == c {
+				i++
+				continue
+			}
+			s.closingQuote = 0
+		case strings.HasPrefix(line[i:], "--"):
+			return
+		case strings.HasPrefix(line[i:], "/*"):
+			s.commentDepth++
+			i++
+		case c == '\'' || c == '"':
+			s.closingQuote = c
+		case c == '[':
+			s.closingQuote = ']'
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package migrations
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitBatches(t *testing.T) {
+	script := "CREATE TABLE users (id INT, name NVARCHAR(100));\r\n" +
+		"GO\r\n" +
+		"-- Procedures must be the first statement of their batch\n" +
+		"CREATE PROCEDURE add_user @name NVARCHAR(100) AS\n" +
+		"BEGIN\n" +
+		"  INSERT INTO users (name) VALUES (@name);\n" +
+		"END\n" +
+		"  go -- end of the procedure\n" +
+		"INSERT INTO users (name) VALUES ('multi-line\n" +
+		"GO\n" +
+		"literal');\n" +
+		"/* comment /* nested\n" +
+		"GO\n" +
+		"*/ */ SELECT [GO\n" +
+		"]] column] FROM users;\n" +
+		"GO 2\n" +
+		"GO\n" +
+		"SELECT 1 AS going"
+
+	batches := SplitBatches(script)
+	assert.Equal(t, []string{
+		"CREATE TABLE users (id INT, name NVARCHAR(100));",
+		"-- Procedures must be the first statement of their batch\n" +
+			"CREATE PROCEDURE add_user @name NVARCHAR(100) AS\n" +
+			"BEGIN\n" +
+			"  INSERT INTO users (name) VALUES (@name);\n" +
+			"END",
+		"INSERT INTO users (name) VALUES ('multi-line\nGO\nliteral');\n" +
+			"/* comment /* nested\nGO\n*/ */ SELECT [GO\n]] column] FROM users;",
+		"INSERT INTO users (name) VALUES ('multi-line\nGO\nliteral');\n" +
+			"/* comment /* nested\nGO\n*/ */ SELECT [GO\n]] column] FROM users;",
+		"SELECT 1 AS going",
+	}, batches)
+}
+
+func TestSplitBatchesWithoutSeparator(t *testing.T) {
+	assert.Equal(t, []string{"CREATE TABLE a (id INT); CREATE TABLE b (id INT);"},
+		SplitBatches("CREATE TABLE a (id INT); CREATE TABLE b (id INT);\n"))
+	assert.Empty(t, SplitBatches("GO\n  \nGO\n"))
+}
@@ -0,0 +1,97 @@
+package migrations
+
+import (
+	"slices"
+
+	"github.com/maestro-go/maestro/core/enums"
+)
+
+// builtinTemplate is a built-in template content with the drivers it is valid for.
+type builtinTemplate struct {
+	content string
+	drivers []enums.DriverType
+}
+
+// PostgreSQL compatible drivers, the built-in templates content targets them.
+var builtinColumnsDrivers = []enums.DriverType{enums.DRIVER_POSTGRES, enums.DRIVER_COCKROACHDB, enums.DRIVER_GREENPLUM}
+
+// Greenplum does not support triggers, and CockroachDB only recently and without plpgsql trigger functions
+// in every version.
+var builtinTriggersDrivers = []enums.DriverType{enums.DRIVER_POSTGRES}
+
+// Built-in templates are available in every project of a driver they are valid for without creating template
+// files. A template file with the same name overrides the built-in one.
+var builtinTemplates = map[string]builtinTemplate{
+	// {{audit_columns}}
+	"audit_columns": {
+		content: `created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	updated_at TIMESTAMP NOT NULL DEFAULT NOW()`,
+		drivers: builtinColumnsDrivers,
+	},
+
+	// {{soft_delete_column}}
+	"soft_delete_column": {
+		content: `deleted_at TIMESTAMP`,
+		drivers: builtinColumnsDrivers,
+	},
+
+	// {{updated_at_trigger, table}}
+	"updated_at_trigger": {
+		content: `CREATE OR REPLACE FUNCTION $1_set_updated_at() RETURNS TRIGGER AS $$
+BEGIN
+	NEW.updated_at = NOW();
+	RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER $1_updated_at BEFORE UPDATE ON $1
+FOR EACH ROW EXECUTE FUNCTION $1_set_updated_at();`,
+		drivers: builtinTriggersDrivers,
+	},
+
+	// {{drop_updated_at_trigger, table}}
+	"drop_updated_at_trigger": {
+		content: `DROP TRIGGER IF EXISTS $1_updated_at ON $1;
+DROP FUNCTION IF EXISTS $1_set_updated_at();`,
+		drivers: builtinTriggersDrivers,
+	},
+}
+
+// WithBuiltinTemplates returns the given templates plus the built-in templates valid for the given driver that
+// are not overridden by a template with the same name. Unknown drivers have no built-in templates.
+func WithBuiltinTemplates(templates []*Template, driver string) []*Template {
+	driverType, ok := enums.MapStringToDriverType[driver]
+	if !ok {
+		return templates
+	}
+
+	merged := make([]*Template, 0, len(templates)+len(builtinTemplates))
+	merged = append(merged, templates...)
+
+	for name, builtin := range builtinTemplates {
+		if !slices.Contains(builtin.drivers, driverType) {
+			continue
+		}
+
+		overridden := false
+		for _, template := range templates {
+			if template.Name == name {
+				overridden = true
+				break
+			}
+		}
+
+		if overridden {
+			continue
+		}
+
+		contentCopy := builtin.content
+		merged = append(merged, &Template{
+			Name:    name,
+			Content: &contentCopy,
+			Builtin: true,
+		})
+	}
+
+	return merged
+}
@@ -0,0 +1,232 @@
+package migrations
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const copyEndOfData = `\.`
+
+// LOAD_DATA_READER is the file of the LOAD DATA LOCAL INFILE statements followed by inline data, in the format
+// of COPY FROM STDIN, the MariaDB expansion of the maestro:load directive. The repository executing them sends
+// the inline data as the file.
+const LOAD_DATA_READER = "Reader::maestro"
+
+var (
+	copyFromStdinMatch = regexp.MustCompile(`(?i)^\s*COPY\s+.+\s+FROM\s+STDIN\b.*;\s*$`)
+	copyOptionsMatch   = regexp.MustCompile(`(?i)\b(CSV|BINARY|DELIMITER|NULL|FORMAT)\b`)
+	copyStdinHintMatch = regexp.MustCompile(`(?i)\bFROM\s+STDIN\b`)
+	loadDataLocalMatch = regexp.MustCompile(`(?i)^\s*LOAD\s+DATA\s+LOCAL\s+INFILE\s+'` + LOAD_DATA_READER + `'\s.*;\s*$`)
+)
+
+// ScriptPart is a part of a migration script. It is either plain SQL, or a COPY ... FROM STDIN or
+// LOAD DATA LOCAL INFILE statement together with its inline data.
+type ScriptPart struct {
+	SQL  string
+	Copy bool
+	Rows [][]any // Only used in COPY parts, nil values are NULLs
+	Data string  // Only used in LOAD DATA parts, the lines of the inline data as is
+}
+
+// HasCopyFromStdin reports whether the script may contain COPY ... FROM STDIN statements.
+func HasCopyFromStdin(script string) bool {
+	return copyStdinHintMatch.MatchString(script)
+}
+
+// HasLoadDataLocal reports whether the script may contain LOAD DATA LOCAL INFILE statements followed by inline data.
+func HasLoadDataLocal(script string) bool {
+	return strings.Contains(script, "'"+LOAD_DATA_READER+"'")
+}
+
+// SplitCopyStatements splits the script into plain SQL parts and COPY ... FROM STDIN parts.
+// Each COPY statement must be on a single line, followed by its data in the text format
+// (tab separated columns, \N for NULL) and terminated by a line containing only "\.".
+func SplitCopyStatements(script string) ([]*ScriptPart, error) {
+	return splitInlineData(script, &inlineDataStatement{
+		name:  "COPY FROM STDIN",
+		match: copyFromStdinMatch,
+		newPart: func(statement string) (*ScriptPart, error) {
+			if copyOptionsMatch.MatchString(statement[strings.Index(strings.ToUpper(statement), "STDIN"):]) {
+				return nil, errors.New("only the default text format is supported in COPY FROM STDIN")
+			}
+			return &ScriptPart{SQL: statement, Copy: true, Rows: make([][]any, 0)}, nil
+		},
+		addLine: func(part *ScriptPart, line string) error {
+			row, err := parseCopyTextRow(line)
+			if err != nil {
+				return err
+			}
+			part.Rows = append(part.Rows, row)
+			return nil
+		},
+	})
+}
+
+// SplitLoadDataStatements splits the script into plain SQL parts and LOAD DATA LOCAL INFILE parts reading
+// LOAD_DATA_READER, in the same way as SplitCopyStatements. The data is kept as is, as the text format of COPY
+// is the default format of LOAD DATA.
+func SplitLoadDataStatements(script string) ([]*ScriptPart, error) {
+	return splitInlineData(script, &inlineDataStatement{
+		name:  "LOAD DATA LOCAL INFILE",
+		match: loadDataLocalMatch,
+		newPart: func(statement string) (*ScriptPart, error) {
+			return &ScriptPart{SQL: statement, Copy: true}, nil
+		},
+		addLine: func(part *ScriptPart, line string) error {
+			part.Data += line + "\n"
+			return nil
+		},
+	})
+}
+
+// inlineDataStatement describes the statements followed by inline data split by splitInlineData.
+type inlineDataStatement struct {
+	name    string                                      // Name of the statement in errors
+	match   *regexp.Regexp                              // Matches the line of the statement
+	newPart func(statement string) (*ScriptPart, error) // Returns the part of the statement
+	addLine func(part *ScriptPart, line string) error   // Adds a line of data to the part
+}
+
+// splitInlineData splits the script into plain SQL parts and the parts of the statements followed by their inline
+// data, terminated by a line containing only "\.".
+func splitInlineData(script string, inline *inlineDataStatement) ([]*ScriptPart, error) {
+	parts := make([]*ScriptPart, 0)
+	lines := strings.Split(script, "\n")
+
+	sqlLines := make([]string, 0)
+	flushSQL := func() {
+		sql := strings.Join(sqlLines, "\n")
+		if strings.TrimSpace(sql) != "" {
+			parts = append(parts, &ScriptPart{SQL: sql})
+		}
+		sqlLines = sqlLines[:0]
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if !inline.match.MatchString(line) {
+			sqlLines = append(sqlLines, line)
+			continue
+		}
+
+		flushSQL()
+
+		part, err := inline.newPart(strings.TrimSpace(line))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+
+		terminated := false
+		for i++; i < len(lines); i++ {
+			dataLine := strings.TrimSuffix(lines[i], "\r")
+			if dataLine == copyEndOfData {
+				terminated = true
+				break
+			}
+
+			err = inline.addLine(part, dataLine)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", i+1, err)
+			}
+		}
+
+		if !terminated {
+			return nil, fmt.Errorf("%s data is not terminated by \"%s\"", inline.name, copyEndOfData)
+		}
+
+		parts = append(parts, part)
+	}
+
+	flushSQL()
+
+	return parts, nil
+}
+
+// parseCopyTextRow parses a row of the COPY text format.
+func parseCopyTextRow(line string) ([]any, error) {
+	columns := strings.Split(line, "\t")
+	row := make([]any, 0, len(columns))
+
+	for _, column := range columns {
+		if column == `\N` {
+			row = append(row, nil)
+			continue
+		}
+
+		value, err := unescapeCopyText(column)
+		if err != nil {
+			return nil, err
+		}
+		row = append(row, value)
+	}
+
+	return row, nil
+}
+
+func unescapeCopyText(value string) (string, error) {
+	if !strings.Contains(value, `\`) {
+		return value, nil
+	}
+
+	builder := strings.Builder{}
+	for i := 0; i < len(value); i++ {
+		if value[i] != '\\' {
+			builder.WriteByte(value[i])
+			continue
+		}
+
+		i++
+		if i >= len(value) {
+			return "", fmt.Errorf("invalid escape at the end of %q", value)
+		}
+
+		switch c := value[i]; c {
+		case 'b':
+			builder.WriteByte('\b')
+		case 'f':
+			builder.WriteByte('\f')
+		case 'n':
+			builder.WriteByte('\n')
+		case 'r':
+			builder.WriteByte('\r')
+		case 't':
+			builder.WriteByte('\t')
+		case 'v':
+			builder.WriteByte('\v')
+		case 'x':
+			end := i + 1
+			for end < len(value) && end < i+3 && strings.IndexByte("0123456789abcdefABCDEF", value[end]) >= 0 {
+				end++
+			}
+			if end == i+1 {
+				builder.WriteByte('x')
+				continue
+			}
+			b, err := strconv.ParseUint(value[i+1:end], 16, 8)
+			if err != nil {
+				return "", fmt.Errorf("invalid escape \\x%s in %q", value[i+1:end], value)
+			}
+			builder.WriteByte(byte(b))
+			i = end - 1
+		case '0', '1', '2', '3', '4', '5', '6', '7':
+			end := i
+			for end < len(value) && end < i+3 && value[end] >= '0' && value[end] <= '7' {
+				end++
+			}
+			// Escapes above \377 do not fit in a byte
+			b, err := strconv.ParseUint(value[i:end], 8, 8)
+			if err != nil {
+				return "", fmt.Errorf("invalid escape \\%s in %q", value[i:end], value)
+			}
+			builder.WriteByte(byte(b))
+			i = end - 1
+		default:
+			builder.WriteByte(c)
+		}
+	}
+
+	return builder.String(), nil
+}
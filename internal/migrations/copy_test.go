@@ -0,0 +1,89 @@
+package migrations
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitCopyStatements(t *testing.T) {
+	script := "CREATE TABLE countries (code CHAR(2), name TEXT, notes TEXT);\n" +
+		"COPY countries (code, name, notes) FROM STDIN;\n" +
+		"BR\tBrazil\t\\N\n" +
+		"PT\tPortugal\tline1\\nline2\\ttab\\\\\n" +
+		"\\.\n" +
+		"CREATE INDEX ON countries (name);\n"
+
+	parts, err := SplitCopyStatements(script)
+	assert.NoError(t, err)
+	assert.Len(t, parts, 3)
+
+	assert.False(t, parts[0].Copy)
+	assert.Equal(t, "CREATE TABLE countries (code CHAR(2), name TEXT, notes TEXT);", parts[0].SQL)
+
+	assert.True(t, parts[1].Copy)
+	assert.Equal(t, "COPY countries (code, name, notes) FROM STDIN;", parts[1].SQL)
+	assert.Equal(t, [][]any{
+		{"BR", "Brazil", nil},
+		{"PT", "Portugal", "line1\nline2\ttab\\"},
+	}, parts[1].Rows)
+
+	assert.False(t, parts[2].Copy)
+	assert.Contains(t, parts[2].SQL, "CREATE INDEX")
+}
+
+func TestSplitCopyStatementsErrors(t *testing.T) {
+	_, err := SplitCopyStatements("COPY countries FROM STDIN;\nBR\tBrazil\n")
+	assert.ErrorContains(t, err, "not terminated")
+
+	_, err = SplitCopyStatements("COPY countries FROM STDIN WITH (FORMAT csv);\nBR,Brazil\n\\.\n")
+	assert.ErrorContains(t, err, "only the default text format")
+}
+
+func TestSplitLoadDataStatements(t *testing.T) {
+	script := "CREATE TABLE countries (code CHAR(2), name TEXT);\n" +
+		"LOAD DATA LOCAL INFILE 'Reader::maestro' INTO TABLE countries CHARACTER SET utf8mb4 (code, name);\n" +
+		"BR\tBrazil\n" +
+		"XX\t\\N\r\n" +
+		"\\.\n" +
+		"CREATE INDEX name ON countries (name);\n"
+
+	parts, err := SplitLoadDataStatements(script)
+	assert.NoError(t, err)
+	assert.Len(t, parts, 3)
+
+	assert.False(t, parts[0].Copy)
+	assert.True(t, parts[1].Copy)
+	assert.Equal(t, "LOAD DATA LOCAL INFILE 'Reader::maestro' INTO TABLE countries CHARACTER SET utf8mb4 (code, name);", parts[1].SQL)
+	assert.Equal(t, "BR\tBrazil\nXX\t\\N\n", parts[1].Data)
+	assert.False(t, parts[2].Copy)
+
+	_, err = SplitLoadDataStatements("LOAD DATA LOCAL INFILE 'Reader::maestro' INTO TABLE countries;\nBR\tBrazil\n")
+	assert.ErrorContains(t, err, "LOAD DATA LOCAL INFILE data is not terminated")
+
+	// Files of the server are plain SQL
+	assert.False(t, HasLoadDataLocal("LOAD DATA INFILE '/tmp/countries.tsv' INTO TABLE countries;"))
+	assert.True(t, HasLoadDataLocal(script))
+}
+
+func TestHasCopyFromStdin(t *testing.T) {
+	assert.True(t, HasCopyFromStdin("copy countries from stdin;"))
+	assert.False(t, HasCopyFromStdin("CREATE TABLE countries (code CHAR(2));"))
+}
+
+func TestUnescapeCopyText(t *testing.T) {
+	value, err := unescapeCopyText(`a\x41\101\\b`)
+	assert.NoError(t, err)
+	assert.Equal(t, `aAA\b`, value)
+
+	_, err = unescapeCopyText(`a\`)
+	assert.Error(t, err)
+
+	// Octal escapes must fit in a byte
+	value, err = unescapeCopyText(`\377`)
+	assert.NoError(t, err)
+	assert.Equal(t, "\xff", value)
+
+	_, err = unescapeCopyText(`a\777b`)
+	assert.EqualError(t, err, `invalid escape \777 in "a\\777b"`)
+}
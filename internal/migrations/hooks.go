@@ -1,10 +1,44 @@
 package migrations
 
-import "github.com/maestro-go/maestro/core/enums"
+import (
+	"regexp"
+	"strings"
+
+	"github.com/maestro-go/maestro/core/enums"
+)
 
 type Hook struct {
-	Order   uint8
-	Version uint16 // Only used in hooks with order and version
-	Content *string
-	Type    enums.HookType
+	Order    uint8
+	Version  uint16 // Only used in hooks with order and version
+	Content  *string
+	Type     enums.HookType
+	Location int    // Index of the location (in the configured order) where the hook was found
+	FileName string // Name of the hook file, used as the last ordering tiebreak
+
+	// OutsideTransaction is set by a "-- maestro:no-transaction" directive line. The hook is executed
+	// outside of the migration transaction, so a rollback does not undo it.
+	OutsideTransaction bool
+}
+
+var hookVariableMatchRe = regexp.MustCompile(`\$\{maestro\.([a-z_]+)\}`)
+
+// WithVariables returns the hook with the ${maestro.<name>} placeholders of its content replaced by the
+// values of the variables, e.g. ${maestro.version}. Values are inserted as is, and placeholders of unknown
+// variables are left untouched. The hook is returned unchanged if its content has no placeholders.
+func (h *Hook) WithVariables(variables map[string]string) *Hook {
+	if h.Content == nil || !strings.Contains(*h.Content, "${maestro.") {
+		return h
+	}
+
+	content := hookVariableMatchRe.ReplaceAllStringFunc(*h.Content, func(placeholder string) string {
+		name := hookVariableMatchRe.FindStringSubmatch(placeholder)[1]
+		if value, ok := variables[name]; ok {
+			return value
+		}
+		return placeholder
+	})
+
+	hook := *h
+	hook.Content = &content
+	return &hook
 }
@@ -0,0 +1,25 @@
+package migrations
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHookWithVariables(t *testing.T) {
+	content := "INSERT INTO audit (version, description, run_id) VALUES (${maestro.version}, '${maestro.description}', " +
+		"'${maestro.run_id}'); -- ${maestro.unknown} ${other.version}"
+	hook := &Hook{Order: 1, Content: &content}
+
+	result := hook.WithVariables(map[string]string{"version": "3", "description": "add users", "run_id": "abc"})
+	assert.Equal(t, "INSERT INTO audit (version, description, run_id) VALUES (3, 'add users', 'abc'); "+
+		"-- ${maestro.unknown} ${other.version}", *result.Content)
+	assert.Equal(t, uint8(1), result.Order)
+
+	// The original hook is not modified
+	assert.Contains(t, *hook.Content, "${maestro.version}")
+
+	plain := "SELECT 1;"
+	hook = &Hook{Content: &plain}
+	assert.Same(t, hook, hook.WithVariables(map[string]string{"version": "3"}))
+}
@@ -0,0 +1,237 @@
+package migrations
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+)
+
+// LocationDependency is the minimum version of a location required by the migrations of another one, e.g.
+// a shared schema module the tables of a module reference.
+type LocationDependency struct {
+	Location string // Dependent location
+	Requires string // Required location
+	Version  uint16 // Minimum version of the required location
+
+	location int // Index of the dependent location in the configured locations
+	requires int // Index of the required location in the configured locations
+}
+
+// LocationDependencies are the dependencies between the locations, ordered by location.
+//
+// The required location is at its minimum version once its migrations are applied up to its first migration
+// of this version or later: a migration of the dependent location runs only then, whatever their versions.
+type LocationDependencies []*LocationDependency
+
+// ParseLocationDependencies parses the minimum versions of other locations required by each location. Both
+// locations must be migrations locations, and the dependencies must not form a cycle.
+func ParseLocationDependencies(locations []string, dependencies map[string]map[string]uint16) (LocationDependencies, error) {
+	if len(dependencies) == 0 {
+		return nil, nil
+	}
+
+	indices := make(map[string]int, len(locations))
+	for i, location := range locations {
+		indices[filepath.Clean(location)] = i
+	}
+
+	parsed := make(LocationDependencies, 0, len(dependencies))
+	for location, requirements := range dependencies {
+		locationIndex, ok := indices[filepath.Clean(location)]
+		if !ok {
+			return nil, fmt.Errorf("dependencies of %s: not a migrations location", location)
+		}
+
+		for requires, version := range requirements {
+			requiresIndex, ok := indices[filepath.Clean(requires)]
+			if !ok {
+				return nil, fmt.Errorf("dependencies of %s: %s is not a migrations location", location, requires)
+			}
+			if requiresIndex == locationIndex {
+				return nil, fmt.Errorf("dependencies of %s: a location cannot depend on itself", location)
+			}
+			if version < 1 {
+				return nil, fmt.Errorf("dependencies of %s: invalid version 0 of %s", location, requires)
+			}
+
+			parsed = append(parsed, &LocationDependency{
+				Location: filepath.Clean(location), Requires: filepath.Clean(requires), Version: version,
+				location: locationIndex, requires: requiresIndex,
+			})
+		}
+	}
+
+	sort.Slice(parsed, func(i, j int) bool {
+		if parsed[i].location != parsed[j].location {
+			return parsed[i].location < parsed[j].location
+		}
+		return parsed[i].requires < parsed[j].requires
+	})
+
+	err := parsed.checkCycles(len(locations))
+	if err != nil {
+		return nil, err
+	}
+
+	return parsed, nil
+}
+
+// checkCycles checks that no location depends on itself through other locations.
+func (d LocationDependencies) checkCycles(locations int) error {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	states := make([]int, locations)
+	var visit func(location int) *LocationDependency
+	visit = func(location int) *LocationDependency {
+		states[location] = visiting
+		for _, dependency := range d {
+			if dependency.location != location {
+				continue
+			}
+			switch states[dependency.requires] {
+			case visiting:
+				return dependency
+			case unvisited:
+				if cycle := visit(dependency.requires); cycle != nil {
+					return cycle
+				}
+			}
+		}
+		states[location] = visited
+		return nil
+	}
+
+	for _, dependency := range d {
+		if states[dependency.location] != unvisited {
+			continue
+		}
+		if cycle := visit(dependency.location); cycle != nil {
+			return fmt.Errorf("dependencies of %s: dependency cycle through %s", cycle.Location, cycle.Requires)
+		}
+	}
+
+	return nil
+}
+
+// target returns the version of the required location its dependents wait for: its first local migration
+// of the required version or later.
+func (d *LocationDependency) target(local []*Migration) (uint16, error) {
+	for _, migration := range local {
+		if migration.Location == d.requires && migration.Version >= d.Version {
+			return migration.Version, nil
+		}
+	}
+	return 0, fmt.Errorf("%s requires version %d of %s, which has no migration of this version or later",
+		d.Location, d.Version, d.Requires)
+}
+
+// missing returns the first migration of the required location up to the target version that is not in
+// the given versions, nil if none.
+func (d *LocationDependency) missing(local []*Migration, target uint16, versions map[uint16]bool) *Migration {
+	for _, migration := range local {
+		if migration.Location == d.requires && migration.Version <= target && !versions[migration.Version] {
+			return migration
+		}
+	}
+	return nil
+}
+
+// Check checks that the migrations of a run, executed in order after the applied versions, only run once
+// the locations they depend on are at their minimum version: applied, or executed before them in the run.
+// Local are the up migrations of every location, ordered by version.
+func (d LocationDependencies) Check(local []*Migration, applied map[uint16]bool, run []*Migration) []error {
+	if len(d) == 0 || len(run) == 0 {
+		return nil
+	}
+
+	targets := make(map[*LocationDependency]uint16, len(d))
+	for _, dependency := range d {
+		target, err := dependency.target(local)
+		if err != nil {
+			return []error{err}
+		}
+		targets[dependency] = target
+	}
+
+	done := make(map[uint16]bool, len(applied)+len(run))
+	for version, success := range applied {
+		done[version] = success
+	}
+
+	errs := make([]error, 0)
+	reported := make(map[*LocationDependency]bool)
+	for _, migration := range run {
+		for _, dependency := range d {
+			if dependency.location != migration.Location || reported[dependency] {
+				continue
+			}
+
+			if missing := dependency.missing(local, targets[dependency], done); missing != nil {
+				errs = append(errs, fmt.Errorf("migration %d of %s requires version %d of %s: migration %d is not "+
+					"applied before it", migration.Version, dependency.Location, dependency.Version, dependency.Requires,
+					missing.Version))
+				reported[dependency] = true
+			}
+		}
+		done[migration.Version] = true
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// CheckRollback checks that the migrations rolled back by a run leave the locations depending on their
+// location at their minimum version, as long as migrations of the dependent locations stay applied.
+func (d LocationDependencies) CheckRollback(local []*Migration, applied map[uint16]bool, rolledBack []*Migration) []error {
+	if len(d) == 0 || len(rolledBack) == 0 {
+		return nil
+	}
+
+	remaining := make(map[uint16]bool, len(applied))
+	for version, success := range applied {
+		remaining[version] = success
+	}
+	for _, migration := range rolledBack {
+		delete(remaining, migration.Version)
+	}
+
+	errs := make([]error, 0)
+	for _, dependency := range d {
+		// The dependency only matters while a migration of the dependent location stays applied
+		dependent := (*Migration)(nil)
+		for _, migration := range local {
+			if migration.Location == dependency.location && remaining[migration.Version] {
+				dependent = migration
+				break
+			}
+		}
+		if dependent == nil {
+			continue
+		}
+
+		target, err := dependency.target(local)
+		if err != nil {
+			return []error{err}
+		}
+
+		for _, migration := range rolledBack {
+			if migration.Location == dependency.requires && migration.Version <= target {
+				errs = append(errs, fmt.Errorf("migration %d of %s cannot be rolled back: %s requires version %d "+
+					"of it, and migration %d of %s stays applied", migration.Version, dependency.Requires,
+					dependency.Location, dependency.Version, dependent.Version, dependency.Location))
+				break
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
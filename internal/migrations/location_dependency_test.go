@@ -0,0 +1,93 @@
+package migrations
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLocationDependencies(t *testing.T) {
+	locations := []string{"./migrations/core", "./migrations/billing", "./migrations/reports"}
+
+	dependencies, err := ParseLocationDependencies(locations, map[string]map[string]uint16{
+		"migrations/reports":   {"./migrations/core": 10, "./migrations/billing/": 3},
+		"./migrations/billing": {"./migrations/core": 40},
+	})
+	require.NoError(t, err)
+	require.Len(t, dependencies, 3)
+	assert.Equal(t, "migrations/billing", dependencies[0].Location)
+	assert.Equal(t, "migrations/core", dependencies[0].Requires)
+	assert.Equal(t, uint16(40), dependencies[0].Version)
+	assert.Equal(t, "migrations/reports", dependencies[1].Location)
+	assert.Equal(t, "migrations/core", dependencies[1].Requires)
+
+	_, err = ParseLocationDependencies(locations, map[string]map[string]uint16{
+		"./migrations/billing": {"./migrations/unknown": 1},
+	})
+	assert.ErrorContains(t, err, "not a migrations location")
+
+	_, err = ParseLocationDependencies(locations, map[string]map[string]uint16{
+		"./migrations/billing": {"./migrations/billing": 1},
+	})
+	assert.ErrorContains(t, err, "cannot depend on itself")
+
+	_, err = ParseLocationDependencies(locations, map[string]map[string]uint16{
+		"./migrations/core":    {"./migrations/reports": 1},
+		"./migrations/billing": {"./migrations/core": 1},
+		"./migrations/reports": {"./migrations/billing": 1},
+	})
+	assert.ErrorContains(t, err, "dependency cycle")
+}
+
+func TestCheckLocationDependencies(t *testing.T) {
+	dependencies, err := ParseLocationDependencies([]string{"core", "billing"}, map[string]map[string]uint16{
+		"billing": {"core": 3},
+	})
+	require.NoError(t, err)
+
+	// Without version ranges, the versions of the locations interleave: core has no version 3
+	local := []*Migration{
+		{Version: 1, Location: 0},
+		{Version: 2, Location: 1},
+		{Version: 3, Location: 1},
+		{Version: 4, Location: 0},
+		{Version: 5, Location: 1},
+	}
+
+	// Billing waits for version 4 of core, the first one of version 3 or later
+	errs := dependencies.Check(local, map[uint16]bool{1: true}, local[1:])
+	require.Len(t, errs, 1)
+	assert.EqualError(t, errs[0], "migration 2 of billing requires version 3 of core: migration 4 is not applied before it")
+
+	// Versions executed before the migrations of billing in the run count
+	errs = dependencies.Check(local, map[uint16]bool{1: true, 2: true, 3: true}, local[3:])
+	assert.Nil(t, errs)
+
+	// Failed rows of the history are not applied
+	errs = dependencies.Check(local, map[uint16]bool{1: true, 2: true, 3: true, 4: false}, local[4:])
+	assert.Len(t, errs, 1)
+
+	// Core has no migration of the required version yet
+	errs = dependencies.Check(local[:3], map[uint16]bool{1: true}, local[1:3])
+	assert.ErrorContains(t, errs[0], "which has no migration of this version or later")
+}
+
+func TestCheckLocationDependenciesRollback(t *testing.T) {
+	dependencies, err := ParseLocationDependencies([]string{"core", "billing"}, map[string]map[string]uint16{
+		"billing": {"core": 2},
+	})
+	require.NoError(t, err)
+
+	local := []*Migration{{Version: 1, Location: 0}, {Version: 2, Location: 0}, {Version: 3, Location: 1}}
+	applied := map[uint16]bool{1: true, 2: true, 3: true}
+
+	// Billing stays applied
+	errs := dependencies.CheckRollback(local, applied, []*Migration{{Version: 2, Location: 0}})
+	require.Len(t, errs, 1)
+	assert.ErrorContains(t, errs[0], "migration 2 of core cannot be rolled back")
+
+	// Billing is rolled back first
+	errs = dependencies.CheckRollback(local, applied, []*Migration{{Version: 3, Location: 1}, {Version: 2, Location: 0}})
+	assert.Nil(t, errs)
+}
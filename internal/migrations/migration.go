@@ -12,12 +12,40 @@ type Migration struct {
 	Type        enums.MigrationType
 	Checksum    *string // Only used in migrations up
 	Content     *string
+	Location    int // Index of the location of the file in the configured locations
+
+	// SkipStatements is the number of statements of the content executed by a previous failed run,
+	// skipped when the run is resumed. Only used by repositories executing one statement at a time.
+	SkipStatements int
+
+	// SkipValidation is set by a "-- maestro:skip-validation" directive line. The history entry of the
+	// version is not validated, e.g. when it was repaired by another tool.
+	SkipValidation bool
+
+	// Destructive is set by a "-- maestro:destructive" directive line, or by statements losing data (DROP TABLE,
+	// DROP SCHEMA, DROP DATABASE, DROP COLUMN or TRUNCATE). The database is backed up before destructive
+	// migrations are executed, if a backup is configured.
+	Destructive bool
+
+	// Author and Ticket are set by the "-- maestro:author" and "-- maestro:ticket" header lines written by
+	// the create command, and recorded in the schema history table.
+	Author string
+	Ticket string
+
+	// Tags are set by the "-- maestro:tags" header line, separated by commas or spaces, e.g. to map the
+	// migration to the team owning it (see conf.OwnersConfig).
+	Tags []string
 }
 
 func ValidateMigrations(migrations []*Migration) []error {
+	return ValidateMigrationsFrom(migrations, 1)
+}
+
+// ValidateMigrationsFrom checks that the versions of the migrations are contiguous, starting at the given version.
+func ValidateMigrationsFrom(migrations []*Migration, firstVersion uint16) []error {
 	errs := make([]error, 0)
 
-	expectedVersion := uint16(1)
+	expectedVersion := firstVersion
 	for _, migration := range migrations {
 		if migration.Version != expectedVersion {
 			errs = append(errs, fmt.Errorf("expected version %d got %d", expectedVersion, migration.Version))
@@ -0,0 +1,21 @@
+package migrations
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateMigrationsFrom(t *testing.T) {
+	migrations := []*Migration{{Version: 3}, {Version: 4}, {Version: 6}}
+
+	errs := ValidateMigrations(migrations)
+	assert.Len(t, errs, 2)
+
+	errs = ValidateMigrationsFrom(migrations, 3)
+	assert.Len(t, errs, 1)
+	assert.EqualError(t, errs[0], "expected version 5 got 6")
+
+	errs = ValidateMigrationsFrom(migrations[:2], 3)
+	assert.Nil(t, errs)
+}
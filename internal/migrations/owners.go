@@ -0,0 +1,72 @@
+package migrations
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+
+	"github.com/maestro-go/maestro/core/conf"
+)
+
+// Owners are the teams owning the migrations, by location and by tag, reported with their failures so the right
+// team is paged. A nil Owners has no team.
+type Owners struct {
+	locations map[int]string // Team by index of location
+	tags      map[string]string
+	fallback  string
+}
+
+// ParseOwners parses the owners of the configuration. Each owned location must be one of the locations. Nil is
+// returned if no owner is configured.
+func ParseOwners(locations []string, config conf.OwnersConfig) (*Owners, error) {
+	if len(config.Locations) == 0 && len(config.Tags) == 0 && config.Default == "" {
+		return nil, nil
+	}
+
+	owners := &Owners{locations: make(map[int]string, len(config.Locations)), tags: config.Tags,
+		fallback: config.Default}
+
+	for location, team := range config.Locations {
+		index := slices.IndexFunc(locations, func(known string) bool {
+			return filepath.Clean(known) == filepath.Clean(location)
+		})
+		if index < 0 {
+			return nil, fmt.Errorf("owner of %s: not a migrations location", location)
+		}
+		owners.locations[index] = team
+	}
+
+	return owners, nil
+}
+
+// Of returns the teams owning the migration: the team of its location, then the teams of its tags, without
+// duplicates, or the default team if none. A nil migration, e.g. for the hooks running once per run, is owned
+// by the default team.
+func (o *Owners) Of(migration *Migration) []string {
+	if o == nil {
+		return nil
+	}
+
+	teams := make([]string, 0, 1)
+	add := func(team string) {
+		if team != "" && !slices.Contains(teams, team) {
+			teams = append(teams, team)
+		}
+	}
+
+	if migration != nil {
+		add(o.locations[migration.Location])
+		for _, tag := range migration.Tags {
+			add(o.tags[tag])
+		}
+	}
+
+	if len(teams) == 0 {
+		add(o.fallback)
+	}
+
+	if len(teams) == 0 {
+		return nil
+	}
+	return teams
+}
@@ -0,0 +1,39 @@
+package migrations
+
+import (
+	"testing"
+
+	"github.com/maestro-go/maestro/core/conf"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseOwners(t *testing.T) {
+	locations := []string{"./migrations", "./migrations/auth", "migrations/billing/"}
+
+	owners, err := ParseOwners(locations, conf.OwnersConfig{
+		Locations: map[string]string{"migrations/billing": "@acme/payments", "./migrations/auth/": "@acme/identity"},
+		Tags:      map[string]string{"pii": "@acme/privacy", "ledger": "@acme/payments"},
+		Default:   "@acme/platform",
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"@acme/identity"}, owners.Of(&Migration{Location: 1}))
+	assert.Equal(t, []string{"@acme/payments", "@acme/privacy"},
+		owners.Of(&Migration{Location: 2, Tags: []string{"ledger", "pii", "unknown"}}))
+	assert.Equal(t, []string{"@acme/privacy"}, owners.Of(&Migration{Location: 0, Tags: []string{"pii"}}))
+	assert.Equal(t, []string{"@acme/platform"}, owners.Of(&Migration{Location: 0}))
+	assert.Equal(t, []string{"@acme/platform"}, owners.Of(nil))
+
+	// Without default team, the migrations of the other locations have no owner
+	owners, err = ParseOwners(locations, conf.OwnersConfig{Locations: map[string]string{"./migrations/auth": "@acme/identity"}})
+	assert.NoError(t, err)
+	assert.Nil(t, owners.Of(&Migration{Location: 0}))
+
+	owners, err = ParseOwners(locations, conf.OwnersConfig{})
+	assert.NoError(t, err)
+	assert.Nil(t, owners)
+	assert.Nil(t, owners.Of(&Migration{Location: 1}))
+
+	_, err = ParseOwners(locations, conf.OwnersConfig{Locations: map[string]string{"./migrations/other": "@acme/other"}})
+	assert.ErrorContains(t, err, "not a migrations location")
+}
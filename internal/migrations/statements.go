@@ -0,0 +1,233 @@
+package migrations
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	splBlockStartMatch = regexp.MustCompile(`(?is)^\s*CREATE\s+(DBA\s+)?(PROCEDURE|FUNCTION)\b`)
+	splBlockEndMatch   = regexp.MustCompile(`(?is)\bEND\s+(PROCEDURE|FUNCTION)\b`)
+
+	dollarQuoteMatch  = regexp.MustCompile(`^\$([A-Za-z_][A-Za-z0-9_]*)?\$`)
+	dmlStatementMatch = regexp.MustCompile(`(?is)^\s*(WITH|INSERT|UPDATE|DELETE|MERGE)\b`)
+
+	plsqlBlockStartMatch = regexp.MustCompile(`(?is)^\s*(CREATE\s+(OR\s+REPLACE\s+)?((NON)?EDITIONABLE\s+)?` +
+		`(PROCEDURE|FUNCTION|PACKAGE|TRIGGER|TYPE)\b|DECLARE\b|BEGIN\b)`)
+)
+
+// splitDialect describes the lexical elements of a script language that may contain semicolons
+// not separating statements.
+type splitDialect struct {
+	lineComment      string
+	quotes           string
+	backslashEscapes bool
+
+	// slashTerminator makes lines containing only a slash separate statements, as in SQL*Plus.
+	slashTerminator bool
+
+	// dollarQuotes makes $$ and $tag$ delimit literals, e.g. the bodies of PostgreSQL functions.
+	dollarQuotes bool
+
+	// inBlock is called with the code of the current statement, without comments and literals,
+	// and the semicolon is kept in the statement while it returns true.
+	inBlock func(code string) bool
+}
+
+var (
+	sqlDialect = &splitDialect{lineComment: "--", quotes: `'"`}
+	splDialect = &splitDialect{lineComment: "--", quotes: `'"`, inBlock: func(code string) bool {
+		return splBlockStartMatch.MatchString(code) && !splBlockEndMatch.MatchString(code)
+	}}
+	cypherDialect = &splitDialect{lineComment: "//", quotes: "'\"`", backslashEscapes: true}
+	sparkDialect  = &splitDialect{lineComment: "--", quotes: "'\"`", backslashEscapes: true}
+	pgDialect     = &splitDialect{lineComment: "--", quotes: `'"`, dollarQuotes: true}
+	plsqlDialect  = &splitDialect{lineComment: "--", quotes: `'"`, slashTerminator: true, inBlock: func(code string) bool {
+		return plsqlBlockStartMatch.MatchString(code)
+	}}
+)
+
+// SplitStatements splits the script into its individual statements, for databases whose drivers
+// execute a single statement per call. Statements are separated by semicolons outside of string
+// literals, quoted identifiers and comments. The returned statements are trimmed, without the
+// trailing semicolon, and statements containing only comments are dropped.
+func SplitStatements(script string) []string {
+	return splitStatements(script, sqlDialect)
+}
+
+// SplitSPLStatements splits the script like SplitStatements, keeping the semicolons inside SPL
+// routines (CREATE PROCEDURE ... END PROCEDURE and CREATE FUNCTION ... END FUNCTION) in the
+// statement of the routine.
+func SplitSPLStatements(script string) []string {
+	return splitStatements(script, splDialect)
+}
+
+// SplitCypherStatements splits a Cypher script like SplitStatements, with "//" line comments,
+// backtick quoted names and backslash escapes in strings.
+func SplitCypherStatements(script string) []string {
+	return splitStatements(script, cypherDialect)
+}
+
+// SplitSparkStatements splits a Spark SQL script (e.g. Databricks) like SplitStatements, with backtick
+// quoted names and backslash escapes in strings.
+func SplitSparkStatements(script string) []string {
+	return splitStatements(script, sparkDialect)
+}
+
+// SplitClickHouseStatements splits a ClickHouse script like SplitStatements. Its quoting is the one of
+// Spark SQL: backtick quoted names and backslash escapes in strings.
+func SplitClickHouseStatements(script string) []string {
+	return splitStatements(script, sparkDialect)
+}
+
+// SplitPostgresStatements splits a PostgreSQL script like SplitStatements, where dollar quoted literals
+// ($$ ... $$ or $tag$ ... $tag$), e.g. the bodies of functions, keep their semicolons.
+func SplitPostgresStatements(script string) []string {
+	return splitStatements(script, pgDialect)
+}
+
+// IsDMLStatement reports whether the statement, as returned by the split functions, inserts, updates,
+// deletes or merges rows, possibly with a WITH clause.
+func IsDMLStatement(statement string) bool {
+	return dmlStatementMatch.MatchString(stripLeadingComments(statement))
+}
+
+// stripLeadingComments returns the statement without the comments preceding its code.
+func stripLeadingComments(statement string) string {
+	for {
+		statement = strings.TrimSpace(statement)
+		switch {
+		case strings.HasPrefix(statement, "--"):
+			_, rest, found := strings.Cut(statement, "\n")
+			if !found {
+				return ""
+			}
+			statement = rest
+		case strings.HasPrefix(statement, "/*"):
+			_, rest, found := strings.Cut(statement[2:], "*/")
+			if !found {
+				return ""
+			}
+			statement = rest
+		default:
+			return statement
+		}
+	}
+}
+
+// SplitPLSQLStatements splits an Oracle script like SplitStatements, where lines containing only a slash
+// also separate statements, as in SQL*Plus. PL/SQL blocks (anonymous blocks and CREATE PROCEDURE, FUNCTION,
+// PACKAGE, TRIGGER and TYPE) keep their semicolons and end at the next slash line, or at the end of the script.
+func SplitPLSQLStatements(script string) []string {
+	return splitStatements(script, plsqlDialect)
+}
+
+func splitStatements(script string, dialect *splitDialect) []string {
+	statements := make([]string, 0)
+
+	builder := strings.Builder{}
+	code := strings.Builder{}
+	flush := func() {
+		statement := strings.TrimSpace(builder.String())
+		if strings.TrimSpace(code.String()) != "" && statement != "" {
+			statements = append(statements, statement)
+		}
+		builder.Reset()
+		code.Reset()
+	}
+
+	for i := 0; i < len(script); i++ {
+		c := script[i]
+
+		switch {
+		case c == ';':
+			if dialect.inBlock != nil && dialect.inBlock(code.String()) {
+				builder.WriteByte(c)
+				code.WriteByte(c)
+				continue
+			}
+			flush()
+			continue
+		case c == '/' && dialect.slashTerminator && isSlashLine(script, i):
+			flush()
+			end := strings.IndexByte(script[i:], '\n')
+			if end < 0 {
+				end = len(script) - i
+			}
+			i += end - 1
+			continue
+		case strings.HasPrefix(script[i:], dialect.lineComment):
+			end := strings.IndexByte(script[i:], '\n')
+			if end < 0 {
+				end = len(script) - i
+			}
+			builder.WriteString(script[i : i+end])
+			code.WriteByte(' ')
+			i += end - 1
+			continue
+		case c == '/' && i+1 < len(script) && script[i+1] == '*':
+			end := strings.Index(script[i+2:], "*/")
+			if end < 0 {
+				end = len(script) - i
+			} else {
+				end += 4
+			}
+			builder.WriteString(script[i : i+end])
+			code.WriteByte(' ')
+			i += end - 1
+			continue
+		case c == '$' && dialect.dollarQuotes && (i == 0 || !isIdentifierByte(script[i-1])) &&
+			dollarQuoteMatch.MatchString(script[i:]):
+			tag := dollarQuoteMatch.FindString(script[i:])
+			end := strings.Index(script[i+len(tag):], tag)
+			if end < 0 {
+				end = len(script)
+			} else {
+				end += i + 2*len(tag)
+			}
+
+			builder.WriteString(script[i:end])
+			code.WriteString("''") // The content of literals is not code
+			i = end - 1
+			continue
+		case strings.IndexByte(dialect.quotes, c) >= 0:
+			// Quotes escaped by doubling them are handled as two consecutive literals
+			end := i + 1
+			for end < len(script) && script[end] != c {
+				if dialect.backslashEscapes && script[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			end = min(end+1, len(script))
+
+			builder.WriteString(script[i:end])
+			code.WriteString(string([]byte{c, c})) // The content of literals is not code
+			i = end - 1
+			continue
+		}
+
+		builder.WriteByte(c)
+		code.WriteByte(c)
+	}
+
+	flush()
+
+	return statements
+}
+
+// isSlashLine reports whether the slash at the index is the only character of its line, besides spaces.
+func isSlashLine(script string, index int) bool {
+	start := strings.LastIndexByte(script[:index], '\n') + 1
+	end := strings.IndexByte(script[index:], '\n')
+	if end < 0 {
+		end = len(script) - index
+	}
+	return strings.TrimSpace(script[start:index]) == "" && strings.TrimSpace(script[index+1:index+end]) == ""
+}
+
+// isIdentifierByte reports whether the byte can be part of an unquoted identifier, where a dollar sign does not
+// start a dollar quoted literal.
+func isIdentifierByte(c byte) bool {
+	return c == '_' || c == '$' || (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
@@ -0,0 +1,150 @@
+package migrations
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitStatements(t *testing.T) {
+	script := "-- Creates the users table\n" +
+		"CREATE TABLE users (id INT, name VARCHAR(100));\n" +
+		"INSERT INTO users VALUES (1, 'semi;colon'), (2, 'it''s');\n" +
+		"/* block; comment */ INSERT INTO \"weird;table\" VALUES (3);\n" +
+		"-- trailing comment;\n" +
+		"UPDATE users SET name = 'x' WHERE id = 1"
+
+	statements := SplitStatements(script)
+	assert.Equal(t, []string{
+		"-- Creates the users table\nCREATE TABLE users (id INT, name VARCHAR(100))",
+		"INSERT INTO users VALUES (1, 'semi;colon'), (2, 'it''s')",
+		"/* block; comment */ INSERT INTO \"weird;table\" VALUES (3)",
+		"-- trailing comment;\nUPDATE users SET name = 'x' WHERE id = 1",
+	}, statements)
+}
+
+func TestSplitStatementsEmpty(t *testing.T) {
+	assert.Empty(t, SplitStatements(""))
+	assert.Empty(t, SplitStatements("  ;\n-- only a comment\n;"))
+}
+
+func TestSplitSPLStatements(t *testing.T) {
+	script := "CREATE TABLE users (id INT, name VARCHAR(100));\n" +
+		"-- Routine with statements inside\n" +
+		"CREATE PROCEDURE add_user(p_id INT, p_name VARCHAR(100))\n" +
+		"  INSERT INTO users VALUES (p_id, p_name);\n" +
+		"  UPDATE users SET name = 'end procedure;' WHERE id = p_id;\n" +
+		"END PROCEDURE;\n" +
+		"create dba function count_users() returning int;\n" +
+		"  define n int;\n" +
+		"  select count(*) into n from users;\n" +
+		"  return n;\n" +
+		"end function\n" +
+		"document 'Counts users';\n" +
+		"EXECUTE PROCEDURE add_user(1, 'a');\n"
+
+	statements := SplitSPLStatements(script)
+	assert.Len(t, statements, 4)
+	assert.Equal(t, "CREATE TABLE users (id INT, name VARCHAR(100))", statements[0])
+	assert.True(t, strings.HasPrefix(statements[1], "-- Routine with statements inside\nCREATE PROCEDURE"))
+	assert.True(t, strings.HasSuffix(statements[1], "END PROCEDURE"))
+	assert.True(t, strings.HasSuffix(statements[2], "document 'Counts users'"))
+	assert.Equal(t, "EXECUTE PROCEDURE add_user(1, 'a')", statements[3])
+
+	// Without SPL awareness the routines are split
+	assert.Greater(t, len(SplitStatements(script)), 4)
+}
+
+func TestSplitCypherStatements(t *testing.T) {
+	script := "// Constraints\n" +
+		"CREATE CONSTRAINT user_id IF NOT EXISTS FOR (u:User) REQUIRE u.id IS UNIQUE;\n" +
+		"MATCH (a:User)-->(b:User) SET a.note = 'it\\'s; fine' RETURN count(*);\n" +
+		"MATCH (n:`weird;label`) RETURN n -- not a comment\n" +
+		";"
+
+	statements := SplitCypherStatements(script)
+	assert.Equal(t, []string{
+		"// Constraints\nCREATE CONSTRAINT user_id IF NOT EXISTS FOR (u:User) REQUIRE u.id IS UNIQUE",
+		"MATCH (a:User)-->(b:User) SET a.note = 'it\\'s; fine' RETURN count(*)",
+		"MATCH (n:`weird;label`) RETURN n -- not a comment",
+	}, statements)
+}
+
+func TestSplitSparkStatements(t *testing.T) {
+	script := "CREATE TABLE `sales;2024` (id INT) USING DELTA;\n" +
+		"INSERT INTO `sales;2024` VALUES (1) -- comment;\n" +
+		";\n" +
+		"SELECT 'it\\'s;' AS quote"
+
+	statements := SplitSparkStatements(script)
+	assert.Equal(t, []string{
+		"CREATE TABLE `sales;2024` (id INT) USING DELTA",
+		"INSERT INTO `sales;2024` VALUES (1) -- comment;",
+		"SELECT 'it\\'s;' AS quote",
+	}, statements)
+}
+
+func TestSplitClickHouseStatements(t *testing.T) {
+	script := "CREATE TABLE events (id UInt64, `name;raw` String) ENGINE = MergeTree ORDER BY id;\n" +
+		"INSERT INTO events VALUES (1, 'a\\';b');"
+
+	statements := SplitClickHouseStatements(script)
+	assert.Equal(t, []string{
+		"CREATE TABLE events (id UInt64, `name;raw` String) ENGINE = MergeTree ORDER BY id",
+		"INSERT INTO events VALUES (1, 'a\\';b')",
+	}, statements)
+}
+
+func TestSplitPLSQLStatements(t *testing.T) {
+	script := "CREATE TABLE users (id NUMBER(10), name VARCHAR2(100));\n" +
+		"CREATE OR REPLACE PROCEDURE add_user(p_id NUMBER, p_name VARCHAR2) AS\n" +
+		"BEGIN\n" +
+		"  INSERT INTO users VALUES (p_id, p_name);\n" +
+		"  UPDATE users SET name = '/' WHERE id = p_id;\n" +
+		"END;\n" +
+		"/\n" +
+		"SELECT id / 2 FROM users\n" +
+		"/\n" +
+		"-- Anonymous block\n" +
+		"BEGIN\n" +
+		"  add_user(1, 'a;b');\n" +
+		"END;\n" +
+		"  /  \n" +
+		"INSERT INTO users VALUES (2, 'c');"
+
+	statements := SplitPLSQLStatements(script)
+	assert.Len(t, statements, 5)
+	assert.Equal(t, "CREATE TABLE users (id NUMBER(10), name VARCHAR2(100))", statements[0])
+	assert.True(t, strings.HasPrefix(statements[1], "CREATE OR REPLACE PROCEDURE"))
+	assert.True(t, strings.HasSuffix(statements[1], "END;"))
+	assert.Equal(t, "SELECT id / 2 FROM users", statements[2])
+	assert.Equal(t, "-- Anonymous block\nBEGIN\n  add_user(1, 'a;b');\nEND;", statements[3])
+	assert.Equal(t, "INSERT INTO users VALUES (2, 'c')", statements[4])
+}
+
+func TestSplitPostgresStatements(t *testing.T) {
+	script := "CREATE FUNCTION touch() RETURNS trigger AS $$\n" +
+		"BEGIN\n" +
+		"  NEW.updated_at = now();\n" +
+		"  RETURN NEW;\n" +
+		"END;\n" +
+		"$$ LANGUAGE plpgsql;\n" +
+		"DO $body$ BEGIN PERFORM 1; END $body$;\n" +
+		"UPDATE users SET name = $1 WHERE price$ = 'a;b';"
+
+	statements := SplitPostgresStatements(script)
+	assert.Len(t, statements, 3)
+	assert.True(t, strings.HasSuffix(statements[0], "$$ LANGUAGE plpgsql"))
+	assert.Equal(t, "DO $body$ BEGIN PERFORM 1; END $body$", statements[1])
+	assert.Equal(t, "UPDATE users SET name = $1 WHERE price$ = 'a;b'", statements[2])
+}
+
+func TestIsDMLStatement(t *testing.T) {
+	assert.True(t, IsDMLStatement("UPDATE users SET name = 'a'"))
+	assert.True(t, IsDMLStatement("-- Backfill\n/* in batches */ insert into users select * from old_users"))
+	assert.True(t, IsDMLStatement("WITH old AS (SELECT id FROM users) DELETE FROM users USING old"))
+	assert.False(t, IsDMLStatement("CREATE TABLE updates (id INT)"))
+	assert.False(t, IsDMLStatement("-- UPDATE users\nALTER TABLE users ADD COLUMN age INT"))
+	assert.False(t, IsDMLStatement("-- Only a comment"))
+}
@@ -3,42 +3,191 @@ package migrations
 import (
 	"fmt"
 	"regexp"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+
+	"github.com/maestro-go/maestro/core/parser"
 )
 
-const migrationMatch = `\{\{([^}]+)\}\}`
+const parameterMatch = `\$(\d+)(?::=('[^']*'|[^\s,;()]+))?` // $1 or $1:=default
+
+var parameterMatchRe = regexp.MustCompile(parameterMatch)
 
 type Template struct {
 	Name    string
 	Content *string
+	Builtin bool // True if the template is provided by maestro instead of a template file
 }
 
-func ParseTemplates(content *string, templates []*Template) {
-	re := regexp.MustCompile(migrationMatch)
+type TemplateParameter struct {
+	Index   int
+	Default *string // Nil when the parameter is required
+}
 
-	matches := re.FindAllStringSubmatch(*content, -1)
+// Parameters returns the positional parameters used in the template content, ordered by index.
+//
+// A parameter may declare a default value with the `$N:=value` syntax. The default applies to
+// every occurrence of the parameter in the template.
+func (t *Template) Parameters() []*TemplateParameter {
+	parametersByIndex := make(map[int]*TemplateParameter)
 
-	for _, match := range matches {
+	for _, match := range parameterMatchRe.FindAllStringSubmatch(*t.Content, -1) {
+		index, err := strconv.Atoi(match[1])
+		if err != nil || index < 1 {
+			continue
+		}
 
-		matchContent := strings.TrimSpace(match[1])
+		parameter, ok := parametersByIndex[index]
+		if !ok {
+			parameter = &TemplateParameter{Index: index}
+			parametersByIndex[index] = parameter
+		}
 
-		values := strings.Split(matchContent, ",")
+		if match[2] != "" && parameter.Default == nil {
+			defaultValue := match[2]
+			parameter.Default = &defaultValue
+		}
+	}
 
-		name := strings.TrimSpace(values[0])
+	parameters := make([]*TemplateParameter, 0, len(parametersByIndex))
+	for _, parameter := range parametersByIndex {
+		parameters = append(parameters, parameter)
+	}
+
+	sort.Slice(parameters, func(i, j int) bool {
+		return parameters[i].Index < parameters[j].Index
+	})
+
+	return parameters
+}
 
-		for _, template := range templates {
-			if template.Name != name {
-				continue
-			}
+// render returns a copy of the template content with the positional parameters replaced by the
+// given arguments, falling back to the parameters default values when the argument is missing or empty.
+// Returns an error if a required argument is missing or if too many arguments are given.
+func (t *Template) render(args []string) (string, error) {
+	parameters := t.Parameters()
 
-			newTemplateContent := template.Content
-			for i, value := range values[1:] {
-				*newTemplateContent = strings.Replace(*newTemplateContent, fmt.Sprintf("$%d", i+1), strings.TrimSpace(value), -1)
-			}
+	defaults := make(map[int]string)
+	missing := make([]string, 0)
+	maxIndex := 0
+	for _, parameter := range parameters {
+		maxIndex = max(maxIndex, parameter.Index)
 
-			*content = strings.Replace(*content, match[0], *newTemplateContent, -1)
+		if parameter.Default != nil {
+			defaults[parameter.Index] = *parameter.Default
+		}
 
-			break
+		if parameter.Index > len(args) && parameter.Default == nil {
+			missing = append(missing, fmt.Sprintf("$%d", parameter.Index))
 		}
 	}
+
+	if len(args) > maxIndex {
+		return "", fmt.Errorf("template %s expects at most %d arguments, got %d", t.Name, maxIndex, len(args))
+	}
+
+	if len(missing) > 0 {
+		return "", fmt.Errorf("template %s is missing arguments for %s", t.Name, strings.Join(missing, ", "))
+	}
+
+	return parameterMatchRe.ReplaceAllStringFunc(*t.Content, func(match string) string {
+		index, err := strconv.Atoi(parameterMatchRe.FindStringSubmatch(match)[1])
+		if err != nil || index < 1 {
+			return match
+		}
+
+		// An empty argument of a parameter with a default uses the default, e.g. to skip it in {{name, , b}}
+		defaultValue, hasDefault := defaults[index]
+		if index <= len(args) && (args[index-1] != "" || !hasDefault) {
+			return args[index-1]
+		}
+
+		return defaultValue
+	}), nil
+}
+
+// FindTemplateReferences returns the names of the templates referenced in content, in order of
+// first appearance and without duplicates.
+// Returns an error if a reference is malformed, e.g. without template name.
+func FindTemplateReferences(content string) ([]string, error) {
+	references, err := parser.ParseReferences(content)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0)
+	for _, reference := range references {
+		if !slices.Contains(names, reference.Name) {
+			names = append(names, reference.Name)
+		}
+	}
+
+	return names, nil
+}
+
+// ParseTemplates replaces every template reference found in content with the rendered template.
+//
+// Templates are never modified: each reference is rendered from a copy of the template content,
+// so the same template can be used several times with different arguments. Rendered templates may
+// reference other templates, which are rendered recursively. References to unknown templates are
+// kept as they are.
+//
+// Returns an error if a template references itself, directly or through other templates, if
+// a template is referenced with missing or extra arguments, or if a reference has no template name.
+func ParseTemplates(content *string, templates []*Template) error {
+	templatesByName := make(map[string]*Template, len(templates))
+	for _, template := range templates {
+		templatesByName[template.Name] = template
+	}
+
+	rendered, err := renderContent(*content, templatesByName, nil)
+	if err != nil {
+		return err
+	}
+
+	*content = rendered
+
+	return nil
+}
+
+// renderContent renders all the template references of content. The stack holds the names
+// of the templates being rendered, and is used to detect circular references.
+func renderContent(content string, templates map[string]*Template, stack []string) (string, error) {
+	references, err := parser.ParseReferences(content)
+	if err != nil {
+		return "", err
+	}
+
+	rendered := new(strings.Builder)
+	offset := 0
+	for _, reference := range references {
+		template, ok := templates[reference.Name]
+		if !ok {
+			continue
+		}
+
+		if slices.Contains(stack, reference.Name) {
+			return "", fmt.Errorf("circular template reference: %s -> %s", strings.Join(stack, " -> "), reference.Name)
+		}
+
+		templateContent, err := template.render(reference.Arguments)
+		if err != nil {
+			return "", err
+		}
+
+		templateStack := append(slices.Clone(stack), reference.Name)
+		templateContent, err = renderContent(templateContent, templates, templateStack)
+		if err != nil {
+			return "", err
+		}
+
+		rendered.WriteString(content[offset:reference.Offset])
+		rendered.WriteString(templateContent)
+		offset = reference.End
+	}
+	rendered.WriteString(content[offset:])
+
+	return rendered.String(), nil
 }
@@ -23,7 +23,8 @@ func TestParseTemplatesWithoutValues(t *testing.T) {
 
 	expectedResult := "EXAMPLE test_template_1 test_template_2 test_template_1"
 
-	ParseTemplates(&content, templates)
+	err := ParseTemplates(&content, templates)
+	assert.NoError(t, err)
 
 	assert.Equal(t, expectedResult, content)
 }
@@ -40,7 +41,199 @@ func TestParseTemplatesWithValues(t *testing.T) {
 
 	expectedResult := "EXAMPLE test_template_1 1, true, \"abc\""
 
-	ParseTemplates(&content, templates)
+	err := ParseTemplates(&content, templates)
+	assert.NoError(t, err)
 
 	assert.Equal(t, expectedResult, content)
 }
+
+func TestParseTemplatesDoesNotModifyTemplates(t *testing.T) {
+	content1 := "{{test1, users}}"
+	content2 := "{{test1, orders}} {{test1, items}}"
+	template1Content := "CREATE TABLE $1;"
+	templates := []*Template{
+		{
+			Name:    "test1",
+			Content: &template1Content,
+		},
+	}
+
+	err := ParseTemplates(&content1, templates)
+	assert.NoError(t, err)
+	err = ParseTemplates(&content2, templates)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "CREATE TABLE users;", content1)
+	assert.Equal(t, "CREATE TABLE orders; CREATE TABLE items;", content2)
+	assert.Equal(t, "CREATE TABLE $1;", template1Content)
+}
+
+func TestParseTemplatesNested(t *testing.T) {
+	content := "EXAMPLE {{table, users}}"
+	tableContent := "CREATE TABLE $1 ({{columns, $1}});"
+	columnsContent := "$1_id INT"
+	templates := []*Template{
+		{
+			Name:    "table",
+			Content: &tableContent,
+		},
+		{
+			Name:    "columns",
+			Content: &columnsContent,
+		},
+	}
+
+	err := ParseTemplates(&content, templates)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "EXAMPLE CREATE TABLE users (users_id INT);", content)
+}
+
+func TestParseTemplatesCircularReference(t *testing.T) {
+	content := "EXAMPLE {{test1}}"
+	template1Content := "{{test2}}"
+	template2Content := "{{test1}}"
+	templates := []*Template{
+		{
+			Name:    "test1",
+			Content: &template1Content,
+		},
+		{
+			Name:    "test2",
+			Content: &template2Content,
+		},
+	}
+
+	err := ParseTemplates(&content, templates)
+	assert.Error(t, err)
+
+	assert.Equal(t, "EXAMPLE {{test1}}", content)
+}
+
+func TestParseTemplatesWithDefaultValues(t *testing.T) {
+	content := "{{test1, users}} {{test1, orders, 20}}"
+	template1Content := "CREATE TABLE $1 (name VARCHAR($2:=10)); -- $2"
+	templates := []*Template{
+		{
+			Name:    "test1",
+			Content: &template1Content,
+		},
+	}
+
+	err := ParseTemplates(&content, templates)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "CREATE TABLE users (name VARCHAR(10)); -- 10 CREATE TABLE orders (name VARCHAR(20)); -- 20", content)
+}
+
+func TestParseTemplatesEmptyArgumentUsesDefault(t *testing.T) {
+	content := "{{test1, , users}} {{test1, , }}"
+	template1Content := "SET search_path = $1:=public; SELECT '$2';"
+	templates := []*Template{
+		{
+			Name:    "test1",
+			Content: &template1Content,
+		},
+	}
+
+	err := ParseTemplates(&content, templates)
+	assert.NoError(t, err)
+
+	// Empty arguments of required parameters are kept
+	assert.Equal(t, "SET search_path = public; SELECT 'users'; SET search_path = public; SELECT '';", content)
+}
+
+func TestParseTemplatesArgumentsValidation(t *testing.T) {
+	template1Content := "CREATE TABLE $1 (name VARCHAR($2));"
+	templates := []*Template{
+		{
+			Name:    "test1",
+			Content: &template1Content,
+		},
+	}
+
+	missingContent := "{{test1, users}}"
+	err := ParseTemplates(&missingContent, templates)
+	assert.ErrorContains(t, err, "missing arguments for $2")
+
+	extraContent := "{{test1, users, 10, extra}}"
+	err = ParseTemplates(&extraContent, templates)
+	assert.ErrorContains(t, err, "expects at most 2 arguments, got 3")
+}
+
+func TestTemplateParameters(t *testing.T) {
+	template1Content := "$2:='abc' $1 $3:=5 $1"
+	template := &Template{
+		Name:    "test1",
+		Content: &template1Content,
+	}
+
+	parameters := template.Parameters()
+	assert.Len(t, parameters, 3)
+
+	assert.Equal(t, 1, parameters[0].Index)
+	assert.Nil(t, parameters[0].Default)
+	assert.Equal(t, "'abc'", *parameters[1].Default)
+	assert.Equal(t, "5", *parameters[2].Default)
+}
+
+func TestFindTemplateReferences(t *testing.T) {
+	content := "EXAMPLE {{test1, 1}} {{ test2 }} {{test1, 2}}"
+
+	names, err := FindTemplateReferences(content)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"test1", "test2"}, names)
+
+	_, err = FindTemplateReferences("SELECT 1;\nSELECT {{ , 1}};")
+	assert.EqualError(t, err, `2:8: missing template name in "{{ , 1}}"`)
+}
+
+func TestBuiltinTemplates(t *testing.T) {
+	content := "CREATE TABLE users ({{audit_columns}}); {{updated_at_trigger, users}}"
+
+	err := ParseTemplates(&content, WithBuiltinTemplates(nil, "postgres"))
+	assert.NoError(t, err)
+
+	assert.Contains(t, content, "updated_at TIMESTAMP NOT NULL DEFAULT NOW()")
+	assert.Contains(t, content, "CREATE TRIGGER users_updated_at BEFORE UPDATE ON users")
+	assert.Contains(t, content, "$$ LANGUAGE plpgsql;")
+}
+
+func TestBuiltinTemplatesDriver(t *testing.T) {
+	names := func(templates []*Template) []string {
+		names := make([]string, 0, len(templates))
+		for _, template := range templates {
+			names = append(names, template.Name)
+		}
+		return names
+	}
+
+	assert.ElementsMatch(t, []string{"audit_columns", "soft_delete_column", "updated_at_trigger",
+		"drop_updated_at_trigger"}, names(WithBuiltinTemplates(nil, "postgres")))
+	assert.ElementsMatch(t, []string{"audit_columns", "soft_delete_column"},
+		names(WithBuiltinTemplates(nil, "cockroachdb")))
+	assert.Empty(t, WithBuiltinTemplates(nil, "sqlite"))
+	assert.Empty(t, WithBuiltinTemplates(nil, "mongodb"))
+	assert.Empty(t, WithBuiltinTemplates(nil, "unknown"))
+
+	content := "CREATE TABLE users ({{audit_columns}});"
+	err := ParseTemplates(&content, WithBuiltinTemplates(nil, "mariadb"))
+	assert.NoError(t, err)
+	assert.Equal(t, "CREATE TABLE users ({{audit_columns}});", content)
+}
+
+func TestBuiltinTemplatesOverride(t *testing.T) {
+	content := "{{audit_columns}}"
+	auditColumnsContent := "custom_audit_columns"
+	templates := WithBuiltinTemplates([]*Template{
+		{
+			Name:    "audit_columns",
+			Content: &auditColumnsContent,
+		},
+	}, "postgres")
+
+	err := ParseTemplates(&content, templates)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "custom_audit_columns", content)
+}
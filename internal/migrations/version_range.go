@@ -0,0 +1,234 @@
+package migrations
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/maestro-go/maestro/internal/conf"
+)
+
+var versionRangeMatch = regexp.MustCompile(conf.VERSION_RANGE_REGEX)
+
+// VersionRange is the versions owned by a migrations location, from First to Last. The migrations of the
+// location must have versions of the range, and the other locations must not.
+type VersionRange struct {
+	Location string
+	First    uint16
+	Last     uint16
+}
+
+func (r *VersionRange) Contains(version uint16) bool {
+	return version >= r.First && version <= r.Last
+}
+
+func (r *VersionRange) String() string {
+	return fmt.Sprintf("%d-%d", r.First, r.Last)
+}
+
+// VersionRanges are the version ranges of the locations owning one, ordered by version. The versions out of
+// the ranges are shared by the other locations.
+//
+// The versions of each range, and the shared versions, are contiguous blocks on their own: the first migration
+// of a range has its first version, and the shared versions skip the ranges (999, 2000 with the range 1000-1999).
+type VersionRanges []*VersionRange
+
+// ParseVersionRanges parses the version ranges of the locations, "first-last" (e.g. "1000-1999"). Each range
+// must belong to one of the locations, and must not overlap another one.
+func ParseVersionRanges(locations []string, ranges map[string]string) (VersionRanges, error) {
+	if len(ranges) == 0 {
+		return nil, nil
+	}
+
+	known := make(map[string]bool, len(locations))
+	for _, location := range locations {
+		known[filepath.Clean(location)] = true
+	}
+
+	parsed := make(VersionRanges, 0, len(ranges))
+	for location, value := range ranges {
+		if !known[filepath.Clean(location)] {
+			return nil, fmt.Errorf("version range of %s: not a migrations location", location)
+		}
+
+		matches := versionRangeMatch.FindStringSubmatch(value)
+		if matches == nil {
+			return nil, fmt.Errorf("version range of %s: invalid range %q, expected first-last, e.g. 1000-1999",
+				location, value)
+		}
+
+		first, err := strconv.ParseUint(matches[1], 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("version range of %s: %w", location, err)
+		}
+		last, err := strconv.ParseUint(matches[2], 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("version range of %s: %w", location, err)
+		}
+
+		if first < 1 || first > last {
+			return nil, fmt.Errorf("version range of %s: invalid range %q, the first version must be between 1 "+
+				"and the last one", location, value)
+		}
+
+		parsed = append(parsed, &VersionRange{Location: filepath.Clean(location), First: uint16(first), Last: uint16(last)})
+	}
+
+	sort.Slice(parsed, func(i, j int) bool { return parsed[i].First < parsed[j].First })
+
+	for i := 1; i < len(parsed); i++ {
+		if parsed[i].First <= parsed[i-1].Last {
+			return nil, fmt.Errorf("version range %s of %s overlaps the range %s of %s", parsed[i], parsed[i].Location,
+				parsed[i-1], parsed[i-1].Location)
+		}
+	}
+
+	return parsed, nil
+}
+
+// Find returns the range of the version, nil for shared versions.
+func (r VersionRanges) Find(version uint16) *VersionRange {
+	for _, versionRange := range r {
+		if versionRange.Contains(version) {
+			return versionRange
+		}
+	}
+	return nil
+}
+
+// OfLocation returns the range of the location, nil if it has none.
+func (r VersionRanges) OfLocation(location string) *VersionRange {
+	location = filepath.Clean(location)
+	for _, versionRange := range r {
+		if versionRange.Location == location {
+			return versionRange
+		}
+	}
+	return nil
+}
+
+// CheckLocation checks that the version of a migration of the location belongs to it: it is in the range of
+// the location, or shared if the location has no range.
+func (r VersionRanges) CheckLocation(location string, version uint16) error {
+	owner := r.Find(version)
+	if own := r.OfLocation(location); own != nil {
+		if owner != own {
+			return fmt.Errorf("version %d is out of the range %s of location %s", version, own, own.Location)
+		}
+		return nil
+	}
+
+	if owner != nil {
+		return fmt.Errorf("version %d is in the range %s of location %s", version, owner, owner.Location)
+	}
+	return nil
+}
+
+// first returns the first version of the block of the range, the first shared version if nil. It is 0 if
+// the ranges leave no shared version.
+func (r VersionRanges) first(versionRange *VersionRange) uint16 {
+	if versionRange != nil {
+		return versionRange.First
+	}
+	return r.skipRanges(1)
+}
+
+// next returns the version following the given one in its block, 0 if the block has no version left.
+func (r VersionRanges) next(version uint16) uint16 {
+	if version == ^uint16(0) {
+		return 0
+	}
+
+	if versionRange := r.Find(version); versionRange != nil {
+		if version == versionRange.Last {
+			return 0
+		}
+		return version + 1
+	}
+	return r.skipRanges(version + 1)
+}
+
+// skipRanges returns the first shared version from the given one, 0 if there is none.
+func (r VersionRanges) skipRanges(version uint16) uint16 {
+	for _, versionRange := range r {
+		if versionRange.Contains(version) {
+			if versionRange.Last == ^uint16(0) {
+				return 0
+			}
+			version = versionRange.Last + 1
+		}
+	}
+	return version
+}
+
+// NextVersion returns the version of a new migration of the location, following the latest of the given
+// versions of its block: the range of the location, or the shared versions.
+func (r VersionRanges) NextVersion(location string, versions []uint16) (uint16, error) {
+	own := r.OfLocation(location)
+
+	latest := uint16(0)
+	for _, version := range versions {
+		if r.Find(version) == own && version > latest {
+			latest = version
+		}
+	}
+
+	next := r.first(own)
+	if latest > 0 {
+		next = r.next(latest)
+	}
+
+	if next == 0 {
+		if own != nil {
+			return 0, fmt.Errorf("no version left in the range %s of location %s", own, own.Location)
+		}
+		return 0, fmt.Errorf("no version left out of the version ranges")
+	}
+	return next, nil
+}
+
+// Heads returns a function reporting whether a version is below the highest of the given versions of its block,
+// where a missing version is a hole. Versions above it are not used yet.
+func (r VersionRanges) Heads(versions []uint16) func(version uint16) bool {
+	heads := make(map[*VersionRange]uint16)
+	for _, version := range versions {
+		block := r.Find(version)
+		heads[block] = max(heads[block], version)
+	}
+
+	return func(version uint16) bool {
+		return version < heads[r.Find(version)]
+	}
+}
+
+// ValidateMigrationsInRanges checks that the versions of the migrations are contiguous in each block of versions,
+// starting at the first version of the block. If fromFirstLocal is set, each block starts at its first
+// migration instead, e.g. when the oldest applied migrations may be missing locally.
+func ValidateMigrationsInRanges(migrations []*Migration, ranges VersionRanges, fromFirstLocal bool) []error {
+	errs := make([]error, 0)
+
+	expected := make(map[*VersionRange]uint16)
+	for _, migration := range migrations {
+		block := ranges.Find(migration.Version)
+
+		expectedVersion, ok := expected[block]
+		if !ok {
+			expectedVersion = ranges.first(block)
+			if fromFirstLocal {
+				expectedVersion = migration.Version
+			}
+		}
+
+		if migration.Version != expectedVersion {
+			errs = append(errs, fmt.Errorf("expected version %d got %d", expectedVersion, migration.Version))
+		}
+		expected[block] = ranges.next(migration.Version)
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
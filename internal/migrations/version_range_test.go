@@ -0,0 +1,119 @@
+package migrations
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseVersionRanges(t *testing.T) {
+	locations := []string{"./migrations", "./migrations/auth", "migrations/billing/"}
+
+	ranges, err := ParseVersionRanges(locations, map[string]string{
+		"migrations/billing": "2000-2999",
+		"./migrations/auth/": "1000 - 1999",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, VersionRanges{
+		{Location: "migrations/auth", First: 1000, Last: 1999},
+		{Location: "migrations/billing", First: 2000, Last: 2999},
+	}, ranges)
+
+	ranges, err = ParseVersionRanges(locations, nil)
+	assert.NoError(t, err)
+	assert.Nil(t, ranges)
+
+	_, err = ParseVersionRanges(locations, map[string]string{"./migrations/other": "1000-1999"})
+	assert.ErrorContains(t, err, "not a migrations location")
+
+	_, err = ParseVersionRanges(locations, map[string]string{"./migrations/auth": "1000"})
+	assert.ErrorContains(t, err, "invalid range")
+
+	_, err = ParseVersionRanges(locations, map[string]string{"./migrations/auth": "1999-1000"})
+	assert.ErrorContains(t, err, "invalid range")
+
+	_, err = ParseVersionRanges(locations, map[string]string{"./migrations/auth": "1000-70000"})
+	assert.Error(t, err)
+
+	_, err = ParseVersionRanges(locations, map[string]string{
+		"./migrations/auth":    "1000-1999",
+		"./migrations/billing": "1500-2999",
+	})
+	assert.ErrorContains(t, err, "overlaps the range 1000-1999 of migrations/auth")
+}
+
+func TestVersionRangesCheckLocation(t *testing.T) {
+	ranges := VersionRanges{{Location: "migrations/auth", First: 1000, Last: 1999}}
+
+	assert.NoError(t, ranges.CheckLocation("./migrations/auth", 1000))
+	assert.NoError(t, ranges.CheckLocation("./migrations", 2000))
+	assert.EqualError(t, ranges.CheckLocation("./migrations/auth", 2000),
+		"version 2000 is out of the range 1000-1999 of location migrations/auth")
+	assert.EqualError(t, ranges.CheckLocation("./migrations", 1500),
+		"version 1500 is in the range 1000-1999 of location migrations/auth")
+
+	// Without ranges, every version is shared
+	assert.NoError(t, VersionRanges(nil).CheckLocation("./migrations", 1500))
+}
+
+func TestVersionRangesNextVersion(t *testing.T) {
+	ranges := VersionRanges{
+		{Location: "migrations/auth", First: 1000, Last: 1001},
+		{Location: "migrations/billing", First: 1002, Last: 1999},
+	}
+
+	version, err := ranges.NextVersion("./migrations/auth", []uint16{1, 2})
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(1000), version)
+
+	version, err = ranges.NextVersion("./migrations", []uint16{1, 2, 1000})
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(3), version)
+
+	_, err = ranges.NextVersion("./migrations/auth", []uint16{1, 1000, 1001})
+	assert.EqualError(t, err, "no version left in the range 1000-1001 of location migrations/auth")
+
+	// The shared versions skip the ranges
+	version, err = ranges.NextVersion("./migrations", []uint16{999, 1000})
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(2000), version)
+
+	version, err = VersionRanges(nil).NextVersion("./migrations", []uint16{3, 1})
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(4), version)
+}
+
+func TestValidateMigrationsInRanges(t *testing.T) {
+	ranges := VersionRanges{{Location: "migrations/auth", First: 1000, Last: 1999}}
+	migrations := []*Migration{{Version: 1}, {Version: 2}, {Version: 1000}, {Version: 1001}}
+
+	assert.Nil(t, ValidateMigrationsInRanges(migrations, ranges, false))
+
+	// Each block starts at its first version
+	errs := ValidateMigrationsInRanges(migrations[1:], ranges, false)
+	assert.Len(t, errs, 1)
+	assert.EqualError(t, errs[0], "expected version 1 got 2")
+
+	errs = ValidateMigrationsInRanges(migrations[3:], ranges, false)
+	assert.Len(t, errs, 1)
+	assert.EqualError(t, errs[0], "expected version 1000 got 1001")
+
+	assert.Nil(t, ValidateMigrationsInRanges(migrations[1:], ranges, true))
+
+	// The shared versions continue after the ranges
+	errs = ValidateMigrationsInRanges(append(migrations, &Migration{Version: 2000}), ranges, false)
+	assert.Len(t, errs, 1)
+	assert.EqualError(t, errs[0], "expected version 3 got 2000")
+
+	assert.Len(t, ValidateMigrationsInRanges(migrations, nil, false), 1)
+}
+
+func TestVersionRangesHeads(t *testing.T) {
+	ranges := VersionRanges{{Location: "migrations/auth", First: 1000, Last: 1999}}
+
+	belowHead := ranges.Heads([]uint16{1, 3, 1000, 1002})
+	assert.True(t, belowHead(2))
+	assert.False(t, belowHead(4)) // Between the shared versions and the range
+	assert.True(t, belowHead(1001))
+	assert.False(t, belowHead(1003))
+}
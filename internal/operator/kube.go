@@ -0,0 +1,235 @@
+package operator
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// service_account_dir is the directory of the token, certificate authority and namespace of the service
+// account mounted in the pods.
+const service_account_dir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// apiError is an error status returned by the API server.
+type apiError struct {
+	Code    int    `json:"code"`
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("%s (%d): %s", e.Reason, e.Code, e.Message)
+}
+
+// isNotFound reports whether the error is a not found status of the API server.
+func isNotFound(err error) bool {
+	apiErr := &apiError{}
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound
+}
+
+// watchEvent is an event of a watch of the API server: ADDED, MODIFIED, DELETED, BOOKMARK or ERROR.
+type watchEvent struct {
+	Type   string          `json:"type"`
+	Object json.RawMessage `json:"object"`
+}
+
+// objectList is a list of objects of the API server, with the resource version to watch them from.
+type objectList struct {
+	Metadata struct {
+		ResourceVersion string `json:"resourceVersion"`
+	} `json:"metadata"`
+	Items []json.RawMessage `json:"items"`
+}
+
+// kubeClient calls the REST API of the Kubernetes API server, authenticated with the token of the service
+// account of the pod, or without authentication through kubectl proxy.
+type kubeClient struct {
+	http   *http.Client
+	server string
+	token  string
+}
+
+// newInClusterClient returns a client of the API server of the cluster the pod runs in, with the
+// certificate authority and token of its service account.
+func newInClusterClient() (*kubeClient, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("not running in a Kubernetes pod: KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT " +
+			"are not set, give the URL of kubectl proxy with --api-server")
+	}
+
+	token, err := os.ReadFile(filepath.Join(service_account_dir, "token"))
+	if err != nil {
+		return nil, fmt.Errorf("error reading the service account token: %w", err)
+	}
+
+	ca, err := os.ReadFile(filepath.Join(service_account_dir, "ca.crt"))
+	if err != nil {
+		return nil, fmt.Errorf("error reading the service account certificate authority: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, errors.New("invalid service account certificate authority")
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+
+	return &kubeClient{
+		http:   &http.Client{Transport: transport},
+		server: "https://" + net.JoinHostPort(host, port),
+		token:  strings.TrimSpace(string(token)),
+	}, nil
+}
+
+// newProxyClient returns a client of the API server behind the given URL, e.g. http://127.0.0.1:8001 for
+// kubectl proxy, which authenticates the requests.
+func newProxyClient(server string) *kubeClient {
+	return &kubeClient{http: &http.Client{}, server: strings.TrimSuffix(server, "/")}
+}
+
+// inClusterNamespace returns the namespace of the pod, empty outside of a pod.
+func inClusterNamespace() string {
+	namespace, err := os.ReadFile(filepath.Join(service_account_dir, "namespace"))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(namespace))
+}
+
+// request sends a request to the API server and returns its response, or the error status it returned.
+func (c *kubeClient) request(ctx context.Context, method string, path string, query url.Values,
+	contentType string, body any) (*http.Response, error) {
+
+	var reader io.Reader
+	if body != nil {
+		content, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(content)
+	}
+
+	target := c.server + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	request, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return nil, err
+	}
+
+	request.Header.Set("Accept", "application/json")
+	if contentType != "" {
+		request.Header.Set("Content-Type", contentType)
+	}
+	if c.token != "" {
+		request.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	response, err := c.http.Do(request)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode >= http.StatusBadRequest {
+		defer response.Body.Close()
+
+		content, _ := io.ReadAll(response.Body)
+		apiErr := &apiError{}
+		if json.Unmarshal(content, apiErr) != nil || apiErr.Message == "" {
+			apiErr.Message = strings.TrimSpace(string(content))
+		}
+		apiErr.Code = response.StatusCode
+		if apiErr.Reason == "" {
+			apiErr.Reason = http.StatusText(response.StatusCode)
+		}
+		return nil, apiErr
+	}
+
+	return response, nil
+}
+
+// do sends a request to the API server and decodes its response into out, if not nil.
+func (c *kubeClient) do(ctx context.Context, method string, path string, query url.Values, contentType string,
+	body any, out any) error {
+
+	response, err := c.request(ctx, method, path, query, contentType, body)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if out == nil {
+		return nil
+	}
+
+	return json.NewDecoder(response.Body).Decode(out)
+}
+
+// get reads the object of the path.
+func (c *kubeClient) get(ctx context.Context, path string, query url.Values, out any) error {
+	return c.do(ctx, http.MethodGet, path, query, "", nil, out)
+}
+
+// mergePatch applies a JSON merge patch to the object of the path.
+func (c *kubeClient) mergePatch(ctx context.Context, path string, patch any) error {
+	return c.do(ctx, http.MethodPatch, path, nil, "application/merge-patch+json", patch, nil)
+}
+
+// watch calls the callback with the events of the objects of the path, until the API server ends the watch,
+// e.g. at its timeoutSeconds, or the callback fails. An ERROR event, e.g. when the resource version is too
+// old, ends the watch with its status.
+func (c *kubeClient) watch(ctx context.Context, path string, query url.Values, fn func(event *watchEvent) error) error {
+	watchQuery := url.Values{}
+	for key, values := range query {
+		watchQuery[key] = values
+	}
+	watchQuery.Set("watch", "true")
+
+	response, err := c.request(ctx, http.MethodGet, path, watchQuery, "", nil)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	// One JSON event per line
+	decoder := json.NewDecoder(bufio.NewReader(response.Body))
+	for {
+		event := &watchEvent{}
+		err = decoder.Decode(event)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if event.Type == "ERROR" {
+			apiErr := &apiError{}
+			if json.Unmarshal(event.Object, apiErr) != nil {
+				apiErr.Message = string(event.Object)
+			}
+			return apiErr
+		}
+
+		err = fn(event)
+		if err != nil {
+			return err
+		}
+	}
+}
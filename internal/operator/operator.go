@@ -0,0 +1,570 @@
+// Package operator reconciles databases to the versions declared in Kubernetes resources: DatabaseMigration
+// custom resources, or ConfigMaps labelled for maestro, reporting the outcome in the status of the resources.
+package operator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/creasty/defaults"
+	"github.com/maestro-go/maestro/core/conf"
+	"github.com/maestro-go/maestro/core/database"
+	"github.com/maestro-go/maestro/core/enums"
+	"github.com/maestro-go/maestro/core/migrator"
+	"github.com/maestro-go/maestro/internal/cli/conn"
+	internalConf "github.com/maestro-go/maestro/internal/conf"
+	"github.com/maestro-go/maestro/internal/filesystem"
+	"go.uber.org/zap"
+)
+
+// Kinds of the resources declaring the versions of the databases
+const (
+	RESOURCE_DATABASE_MIGRATION = "databasemigration"
+	RESOURCE_CONFIG_MAP         = "configmap"
+)
+
+const (
+	api_group   = "maestro-go.github.io"
+	api_version = "v1alpha1"
+
+	configmap_label      = api_group + "/migration" // Label of the ConfigMaps reconciled, set to "true"
+	status_annotation    = api_group + "/status"    // Annotation of the status of the ConfigMaps, as JSON
+	default_dsn_key      = "dsn"                    // Key of the data source name in the secret
+	status_message_limit = 1024                     // Characters of the error of a failed run kept in the status
+)
+
+// Phases of the status of the resources
+const (
+	phase_ready       = "Ready"       // The database is at the declared version
+	phase_progressing = "Progressing" // The migrations are running
+	phase_failed      = "Failed"      // The run failed, it is retried once the resource changes
+	phase_blocked     = "Blocked"     // The declared version can not be reached, e.g. a rollback not allowed
+	phase_error       = "Error"       // The database could not be read, it is retried at the next resync
+)
+
+// migrationSpec is the declared state of a database.
+type migrationSpec struct {
+	Project      string        `json:"project"`             // Directory of the maestro.yaml of the project in the container
+	Version      *uint16       `json:"version,omitempty"`   // Declared version, the latest local migration if nil
+	AllowDown    bool          `json:"allowDown,omitempty"` // Rolls back the versions above the declared one
+	DSNSecretRef *secretKeyRef `json:"dsnSecretRef,omitempty"`
+}
+
+// secretKeyRef is the key of a secret of the namespace of the resource holding the data source name of the
+// database, instead of the connection of the configuration of the project.
+type secretKeyRef struct {
+	Name string `json:"name"`
+	Key  string `json:"key,omitempty"` // "dsn" if empty
+}
+
+// migrationStatus is the outcome of the latest reconciliation of a resource.
+type migrationStatus struct {
+	Phase              string `json:"phase,omitempty"`
+	Version            uint16 `json:"version"` // Latest applied version of the database
+	Message            string `json:"message,omitempty"`
+	RunID              string `json:"runID,omitempty"`              // Run of the latest migrations executed
+	ObservedGeneration int64  `json:"observedGeneration,omitempty"` // Generation of the resource reconciled
+	LastTransitionTime string `json:"lastTransitionTime,omitempty"` // Time the phase last changed
+}
+
+// objectMeta is the metadata of the objects of the API server used by the operator.
+type objectMeta struct {
+	Name        string            `json:"name"`
+	Namespace   string            `json:"namespace"`
+	Generation  int64             `json:"generation"`
+	Annotations map[string]string `json:"annotations"`
+}
+
+// migrationResource is a DatabaseMigration, or a ConfigMap declaring the same spec in its data.
+type migrationResource struct {
+	name       string
+	namespace  string
+	generation int64 // The metadata.generation of DatabaseMigrations, the hash of the data of ConfigMaps
+	spec       migrationSpec
+	status     migrationStatus
+}
+
+// Operator watches the resources of a namespace and reconciles their databases to their declared versions.
+type Operator struct {
+	logger    *zap.Logger
+	client    *kubeClient
+	namespace string
+	resource  string
+	interval  time.Duration // Delay between the resyncs of every resource
+}
+
+// NewOperator returns an operator of the resources of the given kind (RESOURCE_DATABASE_MIGRATION or
+// RESOURCE_CONFIG_MAP) of the namespace, the one of the pod if empty. The API server is reached through the
+// given URL (e.g. kubectl proxy), or with the service account of the pod if empty.
+func NewOperator(logger *zap.Logger, apiServer string, namespace string, resource string,
+	interval time.Duration) (*Operator, error) {
+
+	if resource != RESOURCE_DATABASE_MIGRATION && resource != RESOURCE_CONFIG_MAP {
+		return nil, fmt.Errorf("unknown resource %q, expected %s or %s", resource, RESOURCE_DATABASE_MIGRATION,
+			RESOURCE_CONFIG_MAP)
+	}
+
+	client := newProxyClient(apiServer)
+	if apiServer == "" {
+		var err error
+		client, err = newInClusterClient()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if namespace == "" {
+		namespace = inClusterNamespace()
+	}
+	if namespace == "" {
+		namespace = "default"
+	}
+
+	return &Operator{
+		logger:    logger.With(zap.String("namespace", namespace), zap.String("resource", resource)),
+		client:    client,
+		namespace: namespace,
+		resource:  resource,
+		interval:  interval,
+	}, nil
+}
+
+// Run reconciles every resource, then the resources changed until the next resync, every interval, until the
+// context is done. Errors of the API server are logged and retried at the next resync.
+func (o *Operator) Run(ctx context.Context) error {
+	o.logger.Info("Operator started", zap.Duration("resync interval", o.interval))
+
+	for ctx.Err() == nil {
+		resourceVersion, err := o.Resync(ctx)
+		if err == nil {
+			err = o.watch(ctx, resourceVersion)
+		}
+
+		if ctx.Err() != nil {
+			break
+		}
+
+		if err != nil {
+			o.logger.Error("Error watching the resources, retrying", zap.Error(err))
+
+			select {
+			case <-ctx.Done():
+			case <-time.After(o.interval):
+			}
+		}
+	}
+
+	o.logger.Info("Operator stopped")
+	return nil
+}
+
+// Resync reconciles every resource of the namespace, and returns the resource version to watch them from.
+func (o *Operator) Resync(ctx context.Context) (string, error) {
+	list := &objectList{}
+	err := o.client.get(ctx, o.collectionPath(), o.listQuery(), list)
+	if err != nil {
+		return "", err
+	}
+
+	for _, item := range list.Items {
+		o.reconcileObject(ctx, item)
+	}
+
+	return list.Metadata.ResourceVersion, nil
+}
+
+// watch reconciles the resources added or modified after the resource version, until the next resync.
+func (o *Operator) watch(ctx context.Context, resourceVersion string) error {
+	query := o.listQuery()
+	query.Set("resourceVersion", resourceVersion)
+	query.Set("timeoutSeconds", strconv.Itoa(max(int(o.interval/time.Second), 1)))
+
+	return o.client.watch(ctx, o.collectionPath(), query, func(event *watchEvent) error {
+		if event.Type == "ADDED" || event.Type == "MODIFIED" {
+			o.reconcileObject(ctx, event.Object)
+		}
+		return nil
+	})
+}
+
+// reconcileObject reconciles the resource of an object of the API server, and updates its status if changed.
+func (o *Operator) reconcileObject(ctx context.Context, object json.RawMessage) {
+	resource, err := o.decodeResource(object)
+	if err != nil {
+		o.logger.Error("Invalid resource", zap.Error(err))
+		return
+	}
+
+	logger := o.logger.With(zap.String("name", resource.name))
+
+	status := o.reconcile(ctx, logger, resource)
+
+	err = o.updateStatus(ctx, resource, status)
+	if err != nil {
+		logger.Error("Error updating the status", zap.Error(err))
+	}
+}
+
+// reconcile migrates the database of the resource to its declared version, and returns the status of the
+// resource. A failed run is not retried until the resource changes.
+func (o *Operator) reconcile(ctx context.Context, logger *zap.Logger, resource *migrationResource) migrationStatus {
+	status := resource.status
+	status.ObservedGeneration = resource.generation
+
+	if resource.status.Phase == phase_failed && resource.status.ObservedGeneration == resource.generation {
+		return resource.status
+	}
+
+	fail := func(phase string, err error) migrationStatus {
+		logger.Error("Reconciliation failed", zap.String("phase", phase), zap.Error(err))
+		status.Phase, status.Message = phase, statusMessage(err)
+		return status
+	}
+
+	if resource.spec.Project == "" {
+		return fail(phase_blocked, errors.New("spec.project is required"))
+	}
+
+	config, err := loadProject(resource.spec.Project)
+	if err != nil {
+		return fail(phase_error, fmt.Errorf("error loading the project: %w", err))
+	}
+
+	driver, ok := enums.MapStringToDriverType[config.Driver]
+	if !ok {
+		return fail(phase_blocked, fmt.Errorf("invalid driver %q", config.Driver))
+	}
+
+	migrationsMap, _, errs := filesystem.LoadObjectsFromFiles(&config.Migration)
+	if len(errs) > 0 {
+		return fail(phase_error, fmt.Errorf("error loading the migrations: %w", errors.Join(errs...)))
+	}
+
+	localVersions := make([]uint16, 0)
+	for _, migration := range migrationsMap[enums.MIGRATION_UP] {
+		localVersions = append(localVersions, migration.Version)
+	}
+
+	declared := uint16(0)
+	if resource.spec.Version != nil {
+		declared = *resource.spec.Version
+	} else if len(localVersions) > 0 {
+		declared = slices.Max(localVersions)
+	}
+
+	if declared != 0 && !slices.Contains(localVersions, declared) {
+		return fail(phase_blocked, fmt.Errorf("version %d has no migration file in the project", declared))
+	}
+
+	repo, cleanup, err := o.connect(ctx, resource, config, driver)
+	if err != nil {
+		return fail(phase_error, fmt.Errorf("error connecting to the database: %w", err))
+	}
+	defer cleanup()
+
+	current, err := latestAppliedVersion(repo)
+	if err != nil {
+		return fail(phase_error, err)
+	}
+	status.Version = current
+
+	if current == declared {
+		status.Phase, status.Message = phase_ready, fmt.Sprintf("Database at version %d", current)
+		return status
+	}
+
+	down := current > declared
+	if down && !resource.spec.AllowDown {
+		return fail(phase_blocked, fmt.Errorf("the database is at version %d, above the declared version %d: "+
+			"set spec.allowDown to roll it back", current, declared))
+	}
+
+	// The run may be long: the resource shows it is running
+	progressing := status
+	progressing.Phase = phase_progressing
+	progressing.Message = fmt.Sprintf("Migrating from version %d to %d", current, declared)
+	err = o.updateStatus(ctx, resource, progressing)
+	if err != nil {
+		logger.Error("Error updating the status", zap.Error(err))
+	}
+
+	migrationConfig := config.Migration
+	migrationConfig.Down = down
+	migrationConfig.Destination = &declared
+	migrationConfig.DestinationName = ""
+
+	m := migrator.NewMigrator(logger, repo, &migrationConfig)
+	status.RunID = m.RunID()
+	logger.Info("Migrating to the declared version", zap.Uint16("from", current), zap.Uint16("to", declared),
+		zap.String("run_id", m.RunID()))
+
+	result, err := m.Migrate()
+	if err != nil {
+		// The migrations of the run may have been rolled back with its transaction
+		if version, vErr := latestAppliedVersion(repo); vErr == nil {
+			status.Version = version
+		}
+		return fail(phase_failed, err)
+	}
+	status.Version = result.FinalVersion
+
+	logger.Info("Database reconciled", zap.Uint16("version", result.FinalVersion),
+		zap.Uint16s("applied", result.Applied()))
+
+	status.Phase, status.Message = phase_ready, fmt.Sprintf("Database at version %d", result.FinalVersion)
+	return status
+}
+
+// connect connects to the database of the data source name of the secret of the resource, or else to the
+// database of the configuration of the project.
+func (o *Operator) connect(ctx context.Context, resource *migrationResource, config *conf.ProjectConfig,
+	driver enums.DriverType) (database.Repository, func(), error) {
+
+	ref := resource.spec.DSNSecretRef
+	if ref == nil {
+		return conn.ConnectToDatabase(ctx, config, driver)
+	}
+
+	key := ref.Key
+	if key == "" {
+		key = default_dsn_key
+	}
+
+	secret := struct {
+		Data map[string][]byte `json:"data"` // Base64 encoded
+	}{}
+	err := o.client.get(ctx, fmt.Sprintf("/api/v1/namespaces/%s/secrets/%s", url.PathEscape(resource.namespace),
+		url.PathEscape(ref.Name)), nil, &secret)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading secret %s: %w", ref.Name, err)
+	}
+
+	dsn, ok := secret.Data[key]
+	if !ok {
+		return nil, nil, fmt.Errorf("secret %s has no key %s", ref.Name, key)
+	}
+
+	return conn.ConnectToDSN(ctx, string(dsn), config, driver)
+}
+
+// latestAppliedVersion returns the latest version applied to the database, 0 without history table.
+func latestAppliedVersion(repo database.Repository) (uint16, error) {
+	exists, err := repo.CheckSchemaHistoryTable()
+	if err != nil {
+		return 0, fmt.Errorf("error checking schema history table: %w", err)
+	}
+
+	if !exists {
+		return 0, nil
+	}
+
+	applied, err := repo.GetAppliedMigrations()
+	if err != nil {
+		return 0, fmt.Errorf("error getting applied migrations: %w", err)
+	}
+
+	return database.LatestAppliedVersion(applied), nil
+}
+
+// loadProject loads the configuration of the project of the directory, with its migration locations
+// relative to the directory.
+func loadProject(dir string) (*conf.ProjectConfig, error) {
+	config := &conf.ProjectConfig{}
+	err := defaults.Set(config)
+	if err != nil {
+		return nil, err
+	}
+
+	err = conf.LoadConfigFromFile(filepath.Join(dir, internalConf.DEFAULT_PROJECT_FILE), config)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, location := range config.Migration.Locations {
+		if !filepath.IsAbs(location) {
+			config.Migration.Locations[i] = filepath.Join(dir, location)
+		}
+	}
+
+	// Each migration track has its own history table
+	config.HistoryTable = config.TrackHistoryTable()
+	config.Migration.Extension = config.FileExtension()
+	config.Migration.Driver = config.Driver
+
+	return config, nil
+}
+
+// updateStatus writes the status of the resource if it changed, so the watch events of the status updates do
+// not trigger other updates.
+func (o *Operator) updateStatus(ctx context.Context, resource *migrationResource, status migrationStatus) error {
+	status.LastTransitionTime = resource.status.LastTransitionTime
+	if status.Phase != resource.status.Phase {
+		status.LastTransitionTime = time.Now().UTC().Format(time.RFC3339)
+	}
+
+	if status == resource.status {
+		return nil
+	}
+
+	var err error
+	if o.resource == RESOURCE_DATABASE_MIGRATION {
+		err = o.client.mergePatch(ctx, o.objectPath(resource.name)+"/status", map[string]any{"status": status})
+	} else {
+		content, mErr := json.Marshal(status)
+		if mErr != nil {
+			return mErr
+		}
+
+		err = o.client.mergePatch(ctx, o.objectPath(resource.name), map[string]any{
+			"metadata": map[string]any{"annotations": map[string]string{status_annotation: string(content)}},
+		})
+	}
+
+	// Deleted in the meantime
+	if isNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	resource.status = status
+	return nil
+}
+
+// decodeResource decodes a DatabaseMigration, or the spec of the data of a ConfigMap.
+func (o *Operator) decodeResource(object json.RawMessage) (*migrationResource, error) {
+	if o.resource == RESOURCE_DATABASE_MIGRATION {
+		migration := struct {
+			Metadata objectMeta      `json:"metadata"`
+			Spec     migrationSpec   `json:"spec"`
+			Status   migrationStatus `json:"status"`
+		}{}
+		err := json.Unmarshal(object, &migration)
+		if err != nil {
+			return nil, err
+		}
+
+		return &migrationResource{
+			name:       migration.Metadata.Name,
+			namespace:  migration.Metadata.Namespace,
+			generation: migration.Metadata.Generation,
+			spec:       migration.Spec,
+			status:     migration.Status,
+		}, nil
+	}
+
+	configMap := struct {
+		Metadata objectMeta        `json:"metadata"`
+		Data     map[string]string `json:"data"`
+	}{}
+	err := json.Unmarshal(object, &configMap)
+	if err != nil {
+		return nil, err
+	}
+
+	resource := &migrationResource{
+		name:       configMap.Metadata.Name,
+		namespace:  configMap.Metadata.Namespace,
+		generation: dataGeneration(configMap.Data),
+	}
+
+	spec, err := configMapSpec(configMap.Data)
+	if err != nil {
+		return nil, fmt.Errorf("configmap %s: %w", resource.name, err)
+	}
+	resource.spec = *spec
+
+	if content, ok := configMap.Metadata.Annotations[status_annotation]; ok {
+		// An invalid status is replaced
+		_ = json.Unmarshal([]byte(content), &resource.status)
+	}
+
+	return resource, nil
+}
+
+// configMapSpec returns the spec of the data of a ConfigMap: the project, version and allowDown keys, and the
+// dsnSecret and dsnSecretKey keys of the secret of the data source name.
+func configMapSpec(data map[string]string) (*migrationSpec, error) {
+	spec := &migrationSpec{Project: data["project"]}
+
+	if value, ok := data["version"]; ok && value != "" {
+		version, err := strconv.ParseUint(value, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version %q", value)
+		}
+		spec.Version = new(uint16)
+		*spec.Version = uint16(version)
+	}
+
+	if value, ok := data["allowDown"]; ok && value != "" {
+		allowDown, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowDown %q", value)
+		}
+		spec.AllowDown = allowDown
+	}
+
+	if data["dsnSecret"] != "" {
+		spec.DSNSecretRef = &secretKeyRef{Name: data["dsnSecret"], Key: data["dsnSecretKey"]}
+	}
+
+	return spec, nil
+}
+
+// dataGeneration returns the hash of the data of a ConfigMap, which has no generation, so the status tells
+// which data was reconciled.
+func dataGeneration(data map[string]string) int64 {
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	hash := fnv.New32a()
+	for _, key := range keys {
+		hash.Write([]byte(key + "\x00" + data[key] + "\x00"))
+	}
+	return int64(hash.Sum32())
+}
+
+// statusMessage returns the message of the error, truncated to the size kept in the status.
+func statusMessage(err error) string {
+	message := []rune(err.Error())
+	if len(message) > status_message_limit {
+		return string(message[:status_message_limit]) + "..."
+	}
+	return string(message)
+}
+
+// collectionPath returns the path of the resources of the namespace.
+func (o *Operator) collectionPath() string {
+	if o.resource == RESOURCE_DATABASE_MIGRATION {
+		return fmt.Sprintf("/apis/%s/%s/namespaces/%s/databasemigrations", api_group, api_version,
+			url.PathEscape(o.namespace))
+	}
+	return fmt.Sprintf("/api/v1/namespaces/%s/configmaps", url.PathEscape(o.namespace))
+}
+
+// objectPath returns the path of a resource of the namespace.
+func (o *Operator) objectPath(name string) string {
+	return o.collectionPath() + "/" + url.PathEscape(name)
+}
+
+// listQuery returns the query of the list and watch requests: the label of the ConfigMaps of maestro.
+func (o *Operator) listQuery() url.Values {
+	query := url.Values{}
+	if o.resource == RESOURCE_CONFIG_MAP {
+		query.Set("labelSelector", configmap_label+"=true")
+	}
+	return query
+}
@@ -0,0 +1,321 @@
+package operator
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// fakeAPIServer serves the objects of a namespace of the Kubernetes API, and records the patches.
+type fakeAPIServer struct {
+	mu      sync.Mutex
+	objects map[string]map[string]any // Objects by name
+	secrets map[string]map[string]string
+	patches []map[string]any
+}
+
+func (f *fakeAPIServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if name, ok := strings.CutPrefix(r.URL.Path, "/api/v1/namespaces/test/secrets/"); ok {
+		secret, ok := f.secrets[name]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]any{"reason": "NotFound", "code": 404, "message": "not found"})
+			return
+		}
+
+		data := map[string]string{}
+		for key, value := range secret {
+			data[key] = base64.StdEncoding.EncodeToString([]byte(value))
+		}
+		json.NewEncoder(w).Encode(map[string]any{"data": data})
+		return
+	}
+
+	path := strings.TrimSuffix(r.URL.Path, "/status")
+	parts := strings.Split(path, "/")
+	name := parts[len(parts)-1]
+
+	switch r.Method {
+	case http.MethodGet:
+		items := make([]any, 0)
+		for _, object := range f.objects {
+			items = append(items, object)
+		}
+		json.NewEncoder(w).Encode(map[string]any{"metadata": map[string]any{"resourceVersion": "1"}, "items": items})
+
+	case http.MethodPatch:
+		object, ok := f.objects[name]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		content, _ := io.ReadAll(r.Body)
+		patch := map[string]any{}
+		json.Unmarshal(content, &patch)
+		f.patches = append(f.patches, patch)
+
+		if status, ok := patch["status"]; ok {
+			object["status"] = status
+		}
+		if metadata, ok := patch["metadata"].(map[string]any); ok {
+			object["metadata"].(map[string]any)["annotations"] = metadata["annotations"]
+		}
+		json.NewEncoder(w).Encode(object)
+	}
+}
+
+// status returns the status of the object, decoded from the annotation for ConfigMaps.
+func (f *fakeAPIServer) status(t *testing.T, name string) migrationStatus {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	content, err := json.Marshal(f.objects[name]["status"])
+	if annotations, ok := f.objects[name]["metadata"].(map[string]any)["annotations"].(map[string]any); ok {
+		content, err = []byte(annotations[status_annotation].(string)), nil
+	}
+	assert.NoError(t, err)
+
+	status := migrationStatus{}
+	assert.NoError(t, json.Unmarshal(content, &status))
+	return status
+}
+
+// setupProject writes a SQLite project with the migrations V001 to V003, and returns its directory and the
+// path of its database.
+func setupProject(t *testing.T) (string, string) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "maestro.sqlite")
+
+	config := fmt.Sprintf("driver: sqlite\ndatabase: %s\ncreate-database: true\nmigrations:\n  locations: [\"migrations\"]\n",
+		dbPath)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "maestro.yaml"), []byte(config), os.ModePerm))
+
+	migrationsDir := filepath.Join(dir, "migrations")
+	assert.NoError(t, os.Mkdir(migrationsDir, os.ModePerm))
+
+	for version := 1; version <= 3; version++ {
+		up := fmt.Sprintf("CREATE TABLE t%d (id INTEGER);", version)
+		down := fmt.Sprintf("DROP TABLE t%d;", version)
+		assert.NoError(t, os.WriteFile(filepath.Join(migrationsDir, fmt.Sprintf("V%03d_t%d.sql", version, version)),
+			[]byte(up), os.ModePerm))
+		assert.NoError(t, os.WriteFile(filepath.Join(migrationsDir, fmt.Sprintf("V%03d_t%d.down.sql", version, version)),
+			[]byte(down), os.ModePerm))
+	}
+
+	return dir, dbPath
+}
+
+func newTestOperator(t *testing.T, server *fakeAPIServer, resource string) *Operator {
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+
+	operator, err := NewOperator(zap.NewNop(), httpServer.URL, "test", resource, time.Second)
+	assert.NoError(t, err)
+	return operator
+}
+
+func databaseMigration(name string, spec map[string]any) map[string]any {
+	return map[string]any{
+		"metadata": map[string]any{"name": name, "namespace": "test", "generation": 1},
+		"spec":     spec,
+	}
+}
+
+func TestReconcileDatabaseMigration(t *testing.T) {
+	ctx := context.Background()
+	project, _ := setupProject(t)
+
+	server := &fakeAPIServer{objects: map[string]map[string]any{
+		"app": databaseMigration("app", map[string]any{"project": project, "version": 2}),
+	}}
+	operator := newTestOperator(t, server, RESOURCE_DATABASE_MIGRATION)
+
+	// Up to the declared version
+	_, err := operator.Resync(ctx)
+	assert.NoError(t, err)
+
+	status := server.status(t, "app")
+	assert.Equal(t, phase_ready, status.Phase)
+	assert.Equal(t, uint16(2), status.Version)
+	assert.Equal(t, int64(1), status.ObservedGeneration)
+	assert.NotEmpty(t, status.RunID)
+	assert.NotEmpty(t, status.LastTransitionTime)
+	assert.Len(t, server.patches, 2) // Progressing, then ready
+
+	// Unchanged: the status is not patched again
+	_, err = operator.Resync(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, server.patches, 2)
+
+	// Latest local version
+	delete(server.objects["app"]["spec"].(map[string]any), "version")
+	_, err = operator.Resync(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(3), server.status(t, "app").Version)
+
+	// Below the applied version without allowDown
+	server.objects["app"]["spec"].(map[string]any)["version"] = 1
+	_, err = operator.Resync(ctx)
+	assert.NoError(t, err)
+
+	status = server.status(t, "app")
+	assert.Equal(t, phase_blocked, status.Phase)
+	assert.Equal(t, uint16(3), status.Version)
+	assert.Contains(t, status.Message, "allowDown")
+
+	// Rolled back with allowDown
+	server.objects["app"]["spec"].(map[string]any)["allowDown"] = true
+	_, err = operator.Resync(ctx)
+	assert.NoError(t, err)
+
+	status = server.status(t, "app")
+	assert.Equal(t, phase_ready, status.Phase)
+	assert.Equal(t, uint16(1), status.Version)
+
+	// Without migration file
+	server.objects["app"]["spec"].(map[string]any)["version"] = 9
+	_, err = operator.Resync(ctx)
+	assert.NoError(t, err)
+
+	status = server.status(t, "app")
+	assert.Equal(t, phase_blocked, status.Phase)
+	assert.Contains(t, status.Message, "no migration file")
+}
+
+func TestReconcileFailedRun(t *testing.T) {
+	ctx := context.Background()
+	project, _ := setupProject(t)
+
+	assert.NoError(t, os.WriteFile(filepath.Join(project, "migrations", "V002_t2.sql"), []byte("INVALID SQL;"),
+		os.ModePerm))
+
+	server := &fakeAPIServer{objects: map[string]map[string]any{
+		"app": databaseMigration("app", map[string]any{"project": project, "version": 2}),
+	}}
+	operator := newTestOperator(t, server, RESOURCE_DATABASE_MIGRATION)
+
+	_, err := operator.Resync(ctx)
+	assert.NoError(t, err)
+
+	status := server.status(t, "app")
+	assert.Equal(t, phase_failed, status.Phase)
+	assert.Equal(t, uint16(0), status.Version) // The run is rolled back with its transaction
+	assert.NotEmpty(t, status.Message)
+
+	// Not retried until the resource changes
+	patches := len(server.patches)
+	_, err = operator.Resync(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, server.patches, patches)
+
+	assert.NoError(t, os.WriteFile(filepath.Join(project, "migrations", "V002_t2.sql"),
+		[]byte("CREATE TABLE t2 (id INTEGER);"), os.ModePerm))
+	server.objects["app"]["metadata"].(map[string]any)["generation"] = 2
+
+	_, err = operator.Resync(ctx)
+	assert.NoError(t, err)
+
+	status = server.status(t, "app")
+	assert.Equal(t, phase_ready, status.Phase)
+	assert.Equal(t, uint16(2), status.Version)
+	assert.Equal(t, int64(2), status.ObservedGeneration)
+}
+
+func TestReconcileConfigMap(t *testing.T) {
+	ctx := context.Background()
+	project, dbPath := setupProject(t)
+
+	// The project database is not used: the data source name of the secret is
+	secretPath := filepath.Join(t.TempDir(), "secret.sqlite")
+
+	server := &fakeAPIServer{
+		objects: map[string]map[string]any{
+			"app": {
+				"metadata": map[string]any{"name": "app", "namespace": "test"},
+				"data":     map[string]any{"project": project, "version": "1", "dsnSecret": "app-db"},
+			},
+		},
+		secrets: map[string]map[string]string{"app-db": {"dsn": secretPath}},
+	}
+	operator := newTestOperator(t, server, RESOURCE_CONFIG_MAP)
+
+	_, err := operator.Resync(ctx)
+	assert.NoError(t, err)
+
+	status := server.status(t, "app")
+	assert.Equal(t, phase_ready, status.Phase)
+	assert.Equal(t, uint16(1), status.Version)
+	assert.NotZero(t, status.ObservedGeneration)
+
+	_, err = os.Stat(dbPath)
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(secretPath)
+	assert.NoError(t, err)
+
+	// Missing secret
+	server.objects["app"]["data"].(map[string]any)["dsnSecret"] = "missing"
+	_, err = operator.Resync(ctx)
+	assert.NoError(t, err)
+
+	status = server.status(t, "app")
+	assert.Equal(t, phase_error, status.Phase)
+	assert.Contains(t, status.Message, "missing")
+}
+
+func TestConfigMapSpec(t *testing.T) {
+	spec, err := configMapSpec(map[string]string{"project": "/p", "version": "4", "allowDown": "true",
+		"dsnSecret": "db", "dsnSecretKey": "url"})
+	assert.NoError(t, err)
+	assert.Equal(t, "/p", spec.Project)
+	assert.Equal(t, uint16(4), *spec.Version)
+	assert.True(t, spec.AllowDown)
+	assert.Equal(t, &secretKeyRef{Name: "db", Key: "url"}, spec.DSNSecretRef)
+
+	_, err = configMapSpec(map[string]string{"version": "x"})
+	assert.Error(t, err)
+
+	assert.Equal(t, dataGeneration(map[string]string{"a": "1", "b": "2"}), dataGeneration(map[string]string{"b": "2", "a": "1"}))
+	assert.NotEqual(t, dataGeneration(map[string]string{"a": "1"}), dataGeneration(map[string]string{"a": "2"}))
+}
+
+func TestWatch(t *testing.T) {
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "true", r.URL.Query().Get("watch"))
+		assert.Equal(t, "7", r.URL.Query().Get("resourceVersion"))
+
+		fmt.Fprintln(w, `{"type":"ADDED","object":{"metadata":{"name":"a"}}}`)
+		fmt.Fprintln(w, `{"type":"MODIFIED","object":{"metadata":{"name":"b"}}}`)
+		fmt.Fprintln(w, `{"type":"ERROR","object":{"code":410,"reason":"Expired","message":"too old resource version"}}`)
+	}))
+	defer httpServer.Close()
+
+	types := make([]string, 0)
+	err := newProxyClient(httpServer.URL).watch(context.Background(), "/api/v1/namespaces/test/configmaps",
+		map[string][]string{"resourceVersion": {"7"}}, func(event *watchEvent) error {
+			types = append(types, event.Type)
+			return nil
+		})
+
+	assert.Equal(t, []string{"ADDED", "MODIFIED"}, types)
+	assert.ErrorContains(t, err, "too old resource version")
+	assert.False(t, isNotFound(err))
+}
@@ -0,0 +1,125 @@
+package report
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Statuses of the changed files
+const (
+	STATUS_ADDED    = "added"
+	STATUS_MODIFIED = "modified"
+	STATUS_DELETED  = "deleted"
+)
+
+// FileChange is a file changed by a branch.
+type FileChange struct {
+	Status string // One of the STATUS_* statuses
+	Path   string // Relative to the root of the repository, with slashes
+	Abs    string // Absolute path of the file in the working tree
+}
+
+// ChangedFiles returns the files of the directories changed between the merge base of the base ref and HEAD,
+// as listed by git diff. Renamed files are a deleted file and an added file.
+func ChangedFiles(base string, dirs []string) ([]*FileChange, error) {
+	root, err := git("rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, err
+	}
+
+	args := append([]string{"diff", "--name-status", "--no-renames", "-z", base + "...HEAD", "--"}, dirs...)
+	output, err := git(args...)
+	if err != nil {
+		return nil, err
+	}
+
+	changes, err := parseNameStatus(output)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, change := range changes {
+		change.Abs = filepath.Join(strings.TrimSpace(string(root)), filepath.FromSlash(change.Path))
+	}
+
+	return changes, nil
+}
+
+// parseNameStatus parses the output of git diff --name-status -z: the status letter and the path of each file,
+// separated by NUL bytes.
+func parseNameStatus(output []byte) ([]*FileChange, error) {
+	fields := strings.Split(strings.TrimSuffix(string(output), "\x00"), "\x00")
+	if len(fields) == 1 && fields[0] == "" {
+		return []*FileChange{}, nil
+	}
+	if len(fields)%2 != 0 {
+		return nil, fmt.Errorf("unexpected output of git diff: %q", output)
+	}
+
+	changes := make([]*FileChange, 0, len(fields)/2)
+	for i := 0; i < len(fields); i += 2 {
+		change := &FileChange{Status: STATUS_MODIFIED, Path: fields[i+1]}
+		switch fields[i] {
+		case "A":
+			change.Status = STATUS_ADDED
+		case "D":
+			change.Status = STATUS_DELETED
+		}
+		changes = append(changes, change)
+	}
+
+	return changes, nil
+}
+
+// FileRevision is the content of a file in a commit.
+type FileRevision struct {
+	Commit  string
+	Content []byte
+}
+
+// FileRevisions returns the contents of the file in the commits changing it, as listed by git log, the most
+// recent first. The file is not required to exist in the working tree.
+func FileRevisions(file string) ([]*FileRevision, error) {
+	dir, name := filepath.Split(file)
+
+	output, err := gitIn(dir, "log", "--format=%H", "--", name)
+	if err != nil {
+		return nil, err
+	}
+
+	revisions := make([]*FileRevision, 0)
+	for _, commit := range strings.Fields(string(output)) {
+		content, err := gitIn(dir, "show", commit+":./"+name)
+		if err != nil {
+			continue // The commit deletes the file
+		}
+
+		revisions = append(revisions, &FileRevision{Commit: commit, Content: content})
+	}
+
+	return revisions, nil
+}
+
+// git runs git with the arguments in the current directory and returns its output.
+func git(args ...string) ([]byte, error) {
+	return gitIn("", args...)
+}
+
+// gitIn runs git with the arguments in the directory and returns its output.
+func gitIn(dir string, args ...string) ([]byte, error) {
+	stderr := &bytes.Buffer{}
+
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Stderr = stderr
+
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git %s failed: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+
+	return output, nil
+}
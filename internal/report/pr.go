@@ -0,0 +1,301 @@
+// Package report builds the reports of the migrations changed by a branch, posted as comments of its pull
+// request by bots.
+package report
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/maestro-go/maestro/core/conf"
+	"github.com/maestro-go/maestro/core/enums"
+	"github.com/maestro-go/maestro/core/parser"
+	"github.com/maestro-go/maestro/internal/filesystem"
+	"github.com/maestro-go/maestro/internal/migrations"
+)
+
+// MARKER starts the markdown of the reports, so bots find their previous comment to update it.
+const MARKER = "<!-- maestro-report -->"
+
+// Migration is an up migration changed by the branch.
+type Migration struct {
+	Version     uint16
+	Description string
+	Path        string // Relative to the root of the repository
+	Destructive bool
+	HasDown     bool
+	Author      string
+	Ticket      string
+	Owners      []string // Teams owning the migration (see conf.OwnersConfig)
+}
+
+// PullRequest is the report of the up migrations added, modified and deleted by a branch, compared with its base.
+type PullRequest struct {
+	Base     string
+	Head     uint16       // Highest local version
+	BaseHead uint16       // Highest version of the base, 0 if unknown because the migrations failed to load
+	Added    []*Migration // Pending once the branch is merged, by version
+	Modified []*Migration // Applied migrations whose checksum changes, by version
+	Deleted  []*Migration // By version
+	Owners   []string     // Teams owning the changed migrations, to request their review
+	Errors   []string     // Errors loading and validating the local migrations
+}
+
+// NewPullRequest returns the report of the changed files of the branch, with the local migrations of the
+// configuration loaded and validated as in a run. A version deleted and added again, e.g. a renamed file, is
+// modified.
+func NewPullRequest(config *conf.MigrationConfig, base string, changes []*FileChange) *PullRequest {
+	report := &PullRequest{Base: base, Added: make([]*Migration, 0), Modified: make([]*Migration, 0),
+		Deleted: make([]*Migration, 0), Owners: make([]string, 0), Errors: make([]string, 0)}
+
+	local := make(map[uint16]*migrations.Migration)
+	downs := make(map[uint16]bool)
+
+	// Load migrations, with the down migrations to report the missing ones
+	localConfig := *config
+	localConfig.Down = true
+
+	migrationsMap, _, errs := filesystem.LoadObjectsFromFiles(&localConfig)
+	for _, err := range errs {
+		report.Errors = append(report.Errors, err.Error())
+	}
+	if len(errs) == 0 {
+		for _, migration := range migrationsMap[enums.MIGRATION_UP] {
+			local[migration.Version] = migration
+			report.Head = max(report.Head, migration.Version)
+		}
+		for _, migration := range migrationsMap[enums.MIGRATION_DOWN] {
+			downs[migration.Version] = true
+		}
+
+		for _, err := range validate(config, migrationsMap[enums.MIGRATION_UP]) {
+			report.Errors = append(report.Errors, err.Error())
+		}
+	}
+
+	owners, err := migrations.ParseOwners(config.Locations, config.Owners)
+	if err != nil {
+		report.Errors = append(report.Errors, err.Error())
+	}
+
+	kind := parser.KIND_MIGRATION
+	if enums.MapStringToMigrationTrack[config.Track] == enums.TRACK_DATA {
+		kind = parser.KIND_DATA_MIGRATION
+	}
+
+	added := make(map[uint16]*Migration)
+	deleted := make(map[uint16]*Migration)
+	modified := make(map[uint16]*Migration)
+
+	for _, change := range changes {
+		location := locationIndex(config.Locations, change.Abs)
+		if location < 0 {
+			continue
+		}
+
+		name, err := parser.ParseFileName(filepath.Base(change.Abs), config.FileExtension())
+		if err != nil || name == nil || name.Kind != kind || name.Down {
+			continue // Malformed names are reported by the loading of the migrations
+		}
+
+		migration := &Migration{Version: name.Version, Description: name.Description, Path: change.Path,
+			HasDown: downs[name.Version], Owners: owners.Of(&migrations.Migration{Location: location})}
+		if loaded, ok := local[name.Version]; ok && change.Status != STATUS_DELETED {
+			migration.Destructive = loaded.Destructive
+			migration.Author, migration.Ticket = loaded.Author, loaded.Ticket
+			migration.Owners = owners.Of(loaded)
+		}
+
+		switch change.Status {
+		case STATUS_ADDED:
+			added[name.Version] = migration
+		case STATUS_DELETED:
+			deleted[name.Version] = migration
+		default:
+			modified[name.Version] = migration
+		}
+	}
+
+	for version, migration := range added {
+		if _, ok := deleted[version]; ok {
+			delete(deleted, version)
+			delete(added, version)
+			modified[version] = migration
+		}
+	}
+
+	report.Added = sortedMigrations(added)
+	report.Modified = sortedMigrations(modified)
+	report.Deleted = sortedMigrations(deleted)
+
+	for _, list := range [][]*Migration{report.Added, report.Modified, report.Deleted} {
+		for _, migration := range list {
+			for _, owner := range migration.Owners {
+				if !slices.Contains(report.Owners, owner) {
+					report.Owners = append(report.Owners, owner)
+				}
+			}
+		}
+	}
+
+	if len(errs) == 0 {
+		for version := range local {
+			if _, ok := added[version]; !ok {
+				report.BaseHead = max(report.BaseHead, version)
+			}
+		}
+		for version := range deleted {
+			report.BaseHead = max(report.BaseHead, version)
+		}
+	}
+
+	return report
+}
+
+// validate validates the versions of the local migrations as a run, without the versions of the database.
+func validate(config *conf.MigrationConfig, upMigrations []*migrations.Migration) []error {
+	if !config.Validate {
+		return nil
+	}
+
+	versionRanges, err := migrations.ParseVersionRanges(config.Locations, config.VersionRanges)
+	if err != nil {
+		return []error{err}
+	}
+
+	switch {
+	case len(versionRanges) > 0:
+		return migrations.ValidateMigrationsInRanges(upMigrations, versionRanges, config.ValidateAllowMissing)
+	case config.ValidateAllowMissing && len(upMigrations) > 0:
+		return migrations.ValidateMigrationsFrom(upMigrations, upMigrations[0].Version)
+	}
+	return migrations.ValidateMigrations(upMigrations)
+}
+
+// locationIndex returns the index of the location the file is directly in, whose files are loaded, or -1.
+func locationIndex(locations []string, path string) int {
+	for i, location := range locations {
+		abs, err := filepath.Abs(location)
+		if err == nil && abs == filepath.Dir(path) {
+			return i
+		}
+	}
+	return -1
+}
+
+func sortedMigrations(byVersion map[uint16]*Migration) []*Migration {
+	sorted := make([]*Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		sorted = append(sorted, migration)
+	}
+	slices.SortFunc(sorted, func(a, b *Migration) int {
+		return int(a.Version) - int(b.Version)
+	})
+	return sorted
+}
+
+// Markdown returns the report as markdown, starting with MARKER: the pending migrations, the warnings about
+// destructive, modified, deleted and out of order migrations and missing down migrations, and the errors.
+func (r *PullRequest) Markdown() string {
+	builder := &strings.Builder{}
+
+	fmt.Fprintln(builder, MARKER)
+	fmt.Fprintln(builder, "## Maestro migrations")
+	fmt.Fprintln(builder)
+	fmt.Fprintf(builder, "Compared with `%s`: %d added, %d modified, %d deleted. Head version: %d.\n", r.Base,
+		len(r.Added), len(r.Modified), len(r.Deleted), r.Head)
+	if len(r.Owners) > 0 {
+		fmt.Fprintln(builder)
+		fmt.Fprintf(builder, "Owners: %s\n", cell(strings.Join(r.Owners, ", ")))
+	}
+
+	if len(r.Added) > 0 {
+		fmt.Fprintln(builder)
+		fmt.Fprintln(builder, "### Pending migrations")
+		fmt.Fprintln(builder)
+		fmt.Fprintln(builder, "| Version | Description | File | Destructive | Down | Author | Ticket | Owners |")
+		fmt.Fprintln(builder, "| --- | --- | --- | --- | --- | --- | --- | --- |")
+		for _, migration := range r.Added {
+			fmt.Fprintf(builder, "| %d | %s | `%s` | %s | %s | %s | %s | %s |\n", migration.Version,
+				cell(migration.Description), cell(migration.Path), yesNo(migration.Destructive),
+				yesNo(migration.HasDown), cell(migration.Author), cell(migration.Ticket),
+				cell(strings.Join(migration.Owners, ", ")))
+		}
+	}
+
+	warnings := r.warnings()
+	if len(warnings) > 0 {
+		fmt.Fprintln(builder)
+		fmt.Fprintln(builder, "### Warnings")
+		fmt.Fprintln(builder)
+		for _, warning := range warnings {
+			fmt.Fprintf(builder, "- %s\n", warning)
+		}
+	}
+
+	fmt.Fprintln(builder)
+	fmt.Fprintln(builder, "### Validation")
+	fmt.Fprintln(builder)
+	if len(r.Errors) == 0 {
+		fmt.Fprintln(builder, "The local migrations are valid.")
+	}
+	for _, err := range r.Errors {
+		fmt.Fprintf(builder, "- %s\n", cell(err))
+	}
+
+	return builder.String()
+}
+
+// warnings returns the warnings of the report, in the order of the sections of the markdown.
+func (r *PullRequest) warnings() []string {
+	warnings := make([]string, 0)
+
+	for _, migration := range r.Added {
+		if migration.Destructive {
+			warnings = append(warnings, fmt.Sprintf("**Destructive**: version %d (`%s`) loses data, "+
+				"a backup is taken before it if configured.", migration.Version, cell(migration.Description)))
+		}
+	}
+
+	for _, migration := range r.Added {
+		if !migration.HasDown {
+			warnings = append(warnings, fmt.Sprintf("**Missing down migration**: version %d (`%s`) can not be "+
+				"rolled back.", migration.Version, cell(migration.Description)))
+		}
+	}
+
+	for _, migration := range r.Added {
+		if migration.Version < r.BaseHead {
+			warnings = append(warnings, fmt.Sprintf("**Out of order**: version %d (`%s`) is below the head "+
+				"version %d of `%s`, databases already migrated past it fail the validation.", migration.Version,
+				cell(migration.Description), r.BaseHead, r.Base))
+		}
+	}
+
+	for _, migration := range r.Modified {
+		warnings = append(warnings, fmt.Sprintf("**Modified**: version %d (`%s`) changed, the databases where "+
+			"it is applied fail the validation until they are repaired.", migration.Version,
+			cell(migration.Description)))
+	}
+
+	for _, migration := range r.Deleted {
+		warnings = append(warnings, fmt.Sprintf("**Deleted**: version %d (`%s`) was removed, the databases "+
+			"where it is applied fail the validation.", migration.Version, cell(migration.Description)))
+	}
+
+	return warnings
+}
+
+// cell escapes the pipes and newlines of a text written in a markdown table or list.
+func cell(text string) string {
+	text = strings.ReplaceAll(text, "|", "\\|")
+	return strings.ReplaceAll(text, "\n", " ")
+}
+
+func yesNo(value bool) string {
+	if value {
+		return "yes"
+	}
+	return "no"
+}
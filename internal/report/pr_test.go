@@ -0,0 +1,98 @@
+package report
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/maestro-go/maestro/core/conf"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseNameStatus(t *testing.T) {
+	changes, err := parseNameStatus([]byte("A\x00db/V003_orders.sql\x00M\x00db/V001_users.sql\x00D\x00db/V002_old.sql\x00"))
+	require.NoError(t, err)
+	assert.Equal(t, []*FileChange{
+		{Status: STATUS_ADDED, Path: "db/V003_orders.sql"},
+		{Status: STATUS_MODIFIED, Path: "db/V001_users.sql"},
+		{Status: STATUS_DELETED, Path: "db/V002_old.sql"},
+	}, changes)
+
+	changes, err = parseNameStatus(nil)
+	require.NoError(t, err)
+	assert.Empty(t, changes)
+
+	_, err = parseNameStatus([]byte("A\x00"))
+	assert.Error(t, err)
+}
+
+func TestPullRequest(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"V001_users.sql":      "CREATE TABLE users (id INT);",
+		"V001_users.down.sql": "DROP TABLE users;",
+		"V002_accounts.sql":   "CREATE TABLE accounts (id INT);",
+		"V003_posts.sql":      "CREATE TABLE posts (id INT);",
+		"V005_drop_old.sql":   "-- maestro:author ada\n-- maestro:ticket OPS-7\n-- maestro:tags ledger\nDROP TABLE old;",
+		"V006_tags.sql":       "CREATE TABLE tags (id INT);",
+		"V006_tags.down.sql":  "DROP TABLE tags;",
+	}
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), os.ModePerm))
+	}
+
+	change := func(status string, name string) *FileChange {
+		return &FileChange{Status: status, Path: "db/" + name, Abs: filepath.Join(dir, name)}
+	}
+
+	owners := conf.OwnersConfig{Tags: map[string]string{"ledger": "@acme/payments"}, Default: "@acme/platform"}
+	config := &conf.MigrationConfig{Locations: []string{dir}, Validate: true, Owners: owners}
+	report := NewPullRequest(config, "origin/main",
+		[]*FileChange{
+			change(STATUS_ADDED, "V006_tags.sql"),
+			change(STATUS_ADDED, "V006_tags.down.sql"),
+			change(STATUS_ADDED, "V003_posts.sql"),
+			change(STATUS_ADDED, "V005_drop_old.sql"),
+			change(STATUS_MODIFIED, "V001_users.sql"),
+			change(STATUS_DELETED, "V002_account.sql"), // Renamed
+			change(STATUS_ADDED, "V002_accounts.sql"),
+			change(STATUS_DELETED, "V004_legacy.sql"),
+			{Status: STATUS_ADDED, Path: "README.md", Abs: filepath.Join(filepath.Dir(dir), "README.md")},
+		})
+
+	assert.Equal(t, uint16(6), report.Head)
+	assert.Equal(t, uint16(4), report.BaseHead)
+	platform := []string{"@acme/platform"}
+	assert.Equal(t, []*Migration{
+		{Version: 3, Description: "posts", Path: "db/V003_posts.sql", Owners: platform},
+		{Version: 5, Description: "drop_old", Path: "db/V005_drop_old.sql", Destructive: true, Author: "ada",
+			Ticket: "OPS-7", Owners: []string{"@acme/payments"}},
+		{Version: 6, Description: "tags", Path: "db/V006_tags.sql", HasDown: true, Owners: platform},
+	}, report.Added)
+	assert.Equal(t, []string{"@acme/platform", "@acme/payments"}, report.Owners)
+	assert.Equal(t, []uint16{1, 2}, versions(report.Modified))
+	assert.Equal(t, []uint16{4}, versions(report.Deleted))
+	assert.Equal(t, []string{"expected version 4 got 5"}, report.Errors)
+
+	markdown := report.Markdown()
+	assert.Contains(t, markdown, MARKER+"\n## Maestro migrations\n")
+	assert.Contains(t, markdown, "Compared with `origin/main`: 3 added, 2 modified, 1 deleted. Head version: 6.")
+	assert.Contains(t, markdown, "Owners: @acme/platform, @acme/payments\n")
+	assert.Contains(t, markdown, "| 5 | drop_old | `db/V005_drop_old.sql` | yes | no | ada | OPS-7 | @acme/payments |")
+	assert.Contains(t, markdown, "- **Destructive**: version 5 (`drop_old`)")
+	assert.Contains(t, markdown, "- **Missing down migration**: version 3 (`posts`)")
+	assert.NotContains(t, markdown, "**Missing down migration**: version 6")
+	assert.Contains(t, markdown, "- **Out of order**: version 3 (`posts`) is below the head version 4 of `origin/main`")
+	assert.Contains(t, markdown, "- **Modified**: version 2 (`accounts`)")
+	assert.Contains(t, markdown, "- **Deleted**: version 4 (`legacy`)")
+	assert.Contains(t, markdown, "### Validation\n\n- expected version 4 got 5\n")
+}
+
+func versions(list []*Migration) []uint16 {
+	result := make([]uint16, 0, len(list))
+	for _, migration := range list {
+		result = append(result, migration.Version)
+	}
+	return result
+}
@@ -0,0 +1,53 @@
+package testing
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+type ClickHouseContainer struct {
+	testcontainers.Container
+	URI string // URL of github.com/ClickHouse/clickhouse-go/v2, on the native protocol port
+}
+
+func SetupClickHouse(t *testing.T) *ClickHouseContainer {
+	ctx := context.Background()
+	username := "maestro"
+	password := "password"
+	database := "maestro"
+	req := testcontainers.ContainerRequest{
+		Image:        "clickhouse/clickhouse-server:24.3-alpine",
+		ExposedPorts: []string{"9000/tcp", "8123/tcp"},
+		WaitingFor:   wait.ForHTTP("/ping").WithPort("8123/tcp").WithStartupTimeout(2 * time.Minute),
+		Env: map[string]string{
+			"CLICKHOUSE_USER":     username,
+			"CLICKHOUSE_PASSWORD": password,
+			"CLICKHOUSE_DB":       database,
+		},
+	}
+
+	container, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: req,
+		Started:          true,
+	})
+	require.NoError(t, err)
+
+	host, err := container.Host(ctx)
+	require.NoError(t, err)
+
+	port, err := container.MappedPort(ctx, "9000")
+	require.NoError(t, err)
+
+	uri := fmt.Sprintf("clickhouse://%s:%s@%s:%s/%s", username, password, host, port.Port(), database)
+
+	return &ClickHouseContainer{
+		Container: container,
+		URI:       uri,
+	}
+}
@@ -0,0 +1,32 @@
+package testing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/modules/mariadb"
+)
+
+type MariaDBContainer struct {
+	testcontainers.Container
+	DSN string // Data source name of github.com/go-sql-driver/mysql, with multiple statements enabled
+}
+
+func SetupMariaDB(t *testing.T) *MariaDBContainer {
+	ctx := context.Background()
+
+	container, err := mariadb.Run(ctx, "mariadb:11.4",
+		mariadb.WithDatabase("test_db"), mariadb.WithUsername("test_user"),
+		mariadb.WithPassword("password"))
+	require.NoError(t, err)
+
+	dsn, err := container.ConnectionString(ctx, "multiStatements=true", "parseTime=true")
+	require.NoError(t, err)
+
+	return &MariaDBContainer{
+		Container: container,
+		DSN:       dsn,
+	}
+}
@@ -0,0 +1,51 @@
+package testing
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+type MongoDBContainer struct {
+	testcontainers.Container
+	URI string
+}
+
+func SetupMongoDB(t *testing.T) *MongoDBContainer {
+	ctx := context.Background()
+	username := "maestro"
+	password := "password"
+	req := testcontainers.ContainerRequest{
+		Image:        "mongo:7",
+		ExposedPorts: []string{"27017/tcp"},
+		WaitingFor:   wait.ForLog("Waiting for connections").WithStartupTimeout(2 * time.Minute),
+		Env: map[string]string{
+			"MONGO_INITDB_ROOT_USERNAME": username,
+			"MONGO_INITDB_ROOT_PASSWORD": password,
+		},
+	}
+
+	container, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: req,
+		Started:          true,
+	})
+	require.NoError(t, err)
+
+	host, err := container.Host(ctx)
+	require.NoError(t, err)
+
+	port, err := container.MappedPort(ctx, "27017")
+	require.NoError(t, err)
+
+	uri := fmt.Sprintf("mongodb://%s:%s@%s:%s/?authSource=admin", username, password, host, port.Port())
+
+	return &MongoDBContainer{
+		Container: container,
+		URI:       uri,
+	}
+}
@@ -0,0 +1,59 @@
+package testing
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+type OracleContainer struct {
+	testcontainers.Container
+	URI string // URL of github.com/sijms/go-ora/v2, on the FREEPDB1 service
+}
+
+func SetupOracle(t *testing.T) *OracleContainer {
+	ctx := context.Background()
+	username := "maestro"
+	password := "password"
+	req := testcontainers.ContainerRequest{
+		Image:        "gvenzl/oracle-free:23-slim-faststart",
+		ExposedPorts: []string{"1521/tcp"},
+		WaitingFor:   wait.ForLog("DATABASE IS READY TO USE!").WithStartupTimeout(5 * time.Minute),
+		Env: map[string]string{
+			"ORACLE_PASSWORD":   password,
+			"APP_USER":          username,
+			"APP_USER_PASSWORD": password,
+		},
+	}
+
+	container, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: req,
+		Started:          true,
+	})
+	require.NoError(t, err)
+
+	// The lock of the repository needs DBMS_LOCK, not granted to the users by default
+	code, _, err := container.Exec(ctx, []string{"bash", "-c", fmt.Sprintf(
+		"echo 'ALTER SESSION SET CONTAINER = FREEPDB1;\nGRANT EXECUTE ON DBMS_LOCK TO %s;' | sqlplus -s / as sysdba",
+		username)})
+	require.NoError(t, err)
+	require.Equal(t, 0, code)
+
+	host, err := container.Host(ctx)
+	require.NoError(t, err)
+
+	port, err := container.MappedPort(ctx, "1521")
+	require.NoError(t, err)
+
+	uri := fmt.Sprintf("oracle://%s:%s@%s:%s/FREEPDB1", username, password, host, port.Port())
+
+	return &OracleContainer{
+		Container: container,
+		URI:       uri,
+	}
+}
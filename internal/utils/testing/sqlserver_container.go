@@ -0,0 +1,31 @@
+package testing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/modules/mssql"
+)
+
+type SQLServerContainer struct {
+	testcontainers.Container
+	DSN string // URL of github.com/microsoft/go-mssqldb, on the master database
+}
+
+func SetupSQLServer(t *testing.T) *SQLServerContainer {
+	ctx := context.Background()
+
+	container, err := mssql.Run(ctx, "mcr.microsoft.com/mssql/server:2022-CU14-ubuntu-22.04",
+		mssql.WithAcceptEULA(), mssql.WithPassword("Maestro-Passw0rd"))
+	require.NoError(t, err)
+
+	dsn, err := container.ConnectionString(ctx, "encrypt=disable")
+	require.NoError(t, err)
+
+	return &SQLServerContainer{
+		Container: container,
+		DSN:       dsn,
+	}
+}